@@ -45,9 +45,21 @@ func main() {
 		log.Fatal(err)
 	}
 
-	go server.Start()
+	// Reload the config file, the ACL users and the TLS certificates on SIGHUP.
+	reloadCh := make(chan os.Signal, 1)
+	signal.Notify(reloadCh, syscall.SIGHUP)
 
-	<-cancelCh
+	go server.Start()
 
-	server.ShutDown()
+	for {
+		select {
+		case <-reloadCh:
+			if _, err = server.ReloadConfig(); err != nil {
+				log.Printf("config reload: %v\n", err)
+			}
+		case <-cancelCh:
+			server.ShutDown()
+			return
+		}
+	}
 }
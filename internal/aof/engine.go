@@ -22,6 +22,7 @@ import (
 	logstore "github.com/echovault/sugardb/internal/aof/log"
 	"github.com/echovault/sugardb/internal/aof/preamble"
 	"github.com/echovault/sugardb/internal/clock"
+	"github.com/echovault/sugardb/internal/encryption"
 	"log"
 	"sync"
 )
@@ -32,6 +33,7 @@ type Engine struct {
 	directory    string
 	preambleRW   preamble.ReadWriter
 	appendRW     logstore.ReadWriter
+	cipher       *encryption.Cipher
 
 	mut           sync.Mutex
 	logCount      uint64
@@ -41,6 +43,7 @@ type Engine struct {
 	startRewriteFunc  func()
 	finishRewriteFunc func()
 	getStateFunc      func() map[int]map[string]internal.KeyData
+	captureStateFunc  func(onCapture func()) map[int]map[string]internal.KeyData
 	setKeyDataFunc    func(database int, key string, data internal.KeyData)
 	handleCommand     func(database int, command []byte)
 }
@@ -81,6 +84,16 @@ func WithGetStateFunc(f func() map[int]map[string]internal.KeyData) func(engine
 	}
 }
 
+// WithCaptureStateFunc sets the function used to capture the state for the preamble.
+// The function must call onCapture at the point in time the returned state represents,
+// while no write commands are being executed. This allows write commands to be logged
+// while the preamble is being created without being lost when the log is truncated.
+func WithCaptureStateFunc(f func(onCapture func()) map[int]map[string]internal.KeyData) func(engine *Engine) {
+	return func(engine *Engine) {
+		engine.captureStateFunc = f
+	}
+}
+
 func WithSetKeyDataFunc(f func(database int, key string, data internal.KeyData)) func(engine *Engine) {
 	return func(engine *Engine) {
 		engine.setKeyDataFunc = f
@@ -105,6 +118,14 @@ func WithAppendReadWriter(rw logstore.ReadWriter) func(engine *Engine) {
 	}
 }
 
+// WithCipher sets the cipher used to encrypt the preamble and the append log at rest.
+// Files written before the cipher was set, or with a previous key, are re-encrypted on the next rewrite.
+func WithCipher(cipher *encryption.Cipher) func(engine *Engine) {
+	return func(engine *Engine) {
+		engine.cipher = cipher
+	}
+}
+
 func NewAOFEngine(options ...func(engine *Engine)) (*Engine, error) {
 	engine := &Engine{
 		clock:             clock.NewClock(),
@@ -115,6 +136,7 @@ func NewAOFEngine(options ...func(engine *Engine)) (*Engine, error) {
 		startRewriteFunc:  func() {},
 		finishRewriteFunc: func() {},
 		getStateFunc:      func() map[int]map[string]internal.KeyData { return nil },
+		captureStateFunc:  nil,
 		setKeyDataFunc:    func(database int, key string, data internal.KeyData) {},
 		handleCommand:     func(database int, command []byte) {},
 	}
@@ -125,12 +147,25 @@ func NewAOFEngine(options ...func(engine *Engine)) (*Engine, error) {
 		option(engine)
 	}
 
+	// If no capture function is provided, the state is read while the log is marked.
+	if engine.captureStateFunc == nil {
+		engine.captureStateFunc = func(onCapture func()) map[int]map[string]internal.KeyData {
+			onCapture()
+			return engine.getStateFunc()
+		}
+	}
+
 	// Setup Preamble engine
 	preambleStore, err := preamble.NewPreambleStore(
 		preamble.WithClock(engine.clock),
 		preamble.WithDirectory(engine.directory),
 		preamble.WithReadWriter(engine.preambleRW),
-		preamble.WithGetStateFunc(engine.getStateFunc),
+		preamble.WithCipher(engine.cipher),
+		preamble.WithGetStateFunc(func() map[int]map[string]internal.KeyData {
+			// Mark the append log at the point of capture so that commands logged while
+			// the preamble is being written are retained when the log is truncated.
+			return engine.captureStateFunc(engine.appendStore.Mark)
+		}),
 		preamble.WithSetKeyDataFunc(engine.setKeyDataFunc),
 	)
 	if err != nil {
@@ -144,6 +179,7 @@ func NewAOFEngine(options ...func(engine *Engine)) (*Engine, error) {
 		logstore.WithDirectory(engine.directory),
 		logstore.WithStrategy(engine.syncStrategy),
 		logstore.WithReadWriter(engine.appendRW),
+		logstore.WithCipher(engine.cipher),
 		logstore.WithHandleCommandFunc(engine.handleCommand),
 	)
 	if err != nil {
@@ -160,6 +196,11 @@ func (engine *Engine) LogCommand(database int, command []byte) {
 	}
 }
 
+// SetStrategy changes the sync strategy of the append only file.
+func (engine *Engine) SetStrategy(strategy string) {
+	engine.appendStore.SetStrategy(strategy)
+}
+
 func (engine *Engine) RewriteLog() error {
 	engine.mut.Lock()
 	defer engine.mut.Unlock()
@@ -180,12 +221,29 @@ func (engine *Engine) RewriteLog() error {
 	return nil
 }
 
+// ReadFiles returns the contents of the preamble and the log files. The files are read while no
+// rewrite is in progress, so the log always contains the commands that follow the preamble.
+func (engine *Engine) ReadFiles() ([]byte, []byte, error) {
+	engine.mut.Lock()
+	defer engine.mut.Unlock()
+
+	preamble, err := engine.preambleStore.Read()
+	if err != nil {
+		return nil, nil, err
+	}
+	appendLog, err := engine.appendStore.Read()
+	if err != nil {
+		return nil, nil, err
+	}
+	return preamble, appendLog, nil
+}
+
 func (engine *Engine) Restore() error {
 	if err := engine.preambleStore.Restore(); err != nil {
-		return fmt.Errorf("restore aof error: restore preamble error: %+v", err)
+		return fmt.Errorf("restore aof error: restore preamble error: %w", err)
 	}
 	if err := engine.appendStore.Restore(); err != nil {
-		return fmt.Errorf("restore aof error: restore aof error: %+v", err)
+		return fmt.Errorf("restore aof error: restore aof error: %w", err)
 	}
 	return nil
 }
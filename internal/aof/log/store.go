@@ -15,9 +15,11 @@
 package log
 
 import (
+	"bytes"
 	"fmt"
 	"github.com/echovault/sugardb/internal"
 	"github.com/echovault/sugardb/internal/clock"
+	"github.com/echovault/sugardb/internal/encryption"
 	"github.com/tidwall/resp"
 	"io"
 	"log"
@@ -42,6 +44,8 @@ type Store struct {
 	currentDatabase int
 	// Append file sync strategy. Can only be "always", "everysec", or "no".
 	strategy string
+	// Whether the goroutine that syncs the file every second is running.
+	syncing bool
 	// Store mutex.
 	mut sync.Mutex
 	// The ReadWriter used to persist and load the log.
@@ -50,6 +54,13 @@ type Store struct {
 	directory string
 	// Function to handle command read from AOF log after restore.
 	handleCommand func(database int, command []byte)
+	// The cipher used to encrypt the log at rest. The log is written in plaintext when the cipher is nil.
+	cipher *encryption.Cipher
+	// The offset and database recorded by Mark. Commands logged after the mark are kept on Truncate.
+	mark *struct {
+		offset   int64
+		database int
+	}
 }
 
 func WithClock(clock clock.Clock) func(store *Store) {
@@ -76,6 +87,12 @@ func WithDirectory(directory string) func(store *Store) {
 	}
 }
 
+func WithCipher(cipher *encryption.Cipher) func(store *Store) {
+	return func(store *Store) {
+		store.cipher = cipher
+	}
+}
+
 func WithHandleCommandFunc(f func(database int, command []byte)) func(store *Store) {
 	return func(store *Store) {
 		store.handleCommand = f
@@ -113,28 +130,52 @@ func NewAppendStore(options ...func(store *Store)) (*Store, error) {
 
 	// Start another goroutine that takes handles syncing the content to the file system.
 	// No need to start this goroutine if sync strategy is anything other than 'everysec'.
-	if strings.EqualFold(store.strategy, "everysec") {
-		go func() {
-			ticker := time.NewTicker(1 * time.Second)
-			defer func() {
-				ticker.Stop()
-			}()
-			for {
-				store.mut.Lock()
-				if err := store.Sync(); err != nil {
-					store.mut.Unlock()
-					log.Println(fmt.Errorf("new append store error: %+v", err))
-					break
-				}
-				store.mut.Unlock()
-				<-ticker.C
-			}
-		}()
-	}
+	store.mut.Lock()
+	store.startSync()
+	store.mut.Unlock()
 
 	return store, nil
 }
 
+// SetStrategy changes the append file sync strategy. Can only be "always", "everysec", or "no".
+func (store *Store) SetStrategy(strategy string) {
+	store.mut.Lock()
+	defer store.mut.Unlock()
+	store.strategy = strings.ToLower(strategy)
+	store.startSync()
+}
+
+// startSync starts the goroutine that syncs the file every second if the strategy is 'everysec'
+// and the goroutine is not running yet. The goroutine stops when the strategy changes. The store mutex must be held.
+func (store *Store) startSync() {
+	if store.syncing || !strings.EqualFold(store.strategy, "everysec") {
+		return
+	}
+	store.syncing = true
+	go func() {
+		ticker := time.NewTicker(1 * time.Second)
+		defer func() {
+			ticker.Stop()
+		}()
+		for {
+			store.mut.Lock()
+			if !strings.EqualFold(store.strategy, "everysec") {
+				store.syncing = false
+				store.mut.Unlock()
+				return
+			}
+			if err := store.Sync(); err != nil {
+				store.syncing = false
+				store.mut.Unlock()
+				log.Println(fmt.Errorf("new append store error: %+v", err))
+				return
+			}
+			store.mut.Unlock()
+			<-ticker.C
+		}
+	}()
+}
+
 func (store *Store) Write(database int, command []byte) error {
 	// Skip operation if ReadWriter is not defined.
 	if store.rw == nil {
@@ -148,14 +189,13 @@ func (store *Store) Write(database int, command []byte) error {
 	// log the SELECT command before logging the incoming command.
 	// This allows us to switch databases appropriately when restoring the state on startup.
 	if database != store.currentDatabase {
-		_, err := store.rw.Write([]byte(fmt.Sprintf("*2\r\n$6\r\nSELECT\r\n$1\r\n%s\r\n", strconv.Itoa(database))))
-		if err != nil {
+		if _, err := store.rw.Write(store.cipher.Seal(selectCommand(database))); err != nil {
 			return fmt.Errorf("log select error: %+v", err)
 		}
 		store.currentDatabase = database
 	}
 
-	if _, err := store.rw.Write(command); err != nil {
+	if _, err := store.rw.Write(store.cipher.Seal(command)); err != nil {
 		return fmt.Errorf("log command error: %+v", err)
 	}
 
@@ -184,7 +224,16 @@ func (store *Store) Restore() error {
 		return fmt.Errorf("restore aof: %v", err)
 	}
 
-	r := resp.NewReader(store.rw)
+	b, err := io.ReadAll(store.rw)
+	if err != nil {
+		return fmt.Errorf("restore aof: %v", err)
+	}
+	b, err = store.decode(b)
+	if err != nil {
+		return fmt.Errorf("restore aof: %w", err)
+	}
+
+	r := resp.NewReader(bytes.NewReader(b))
 	database := 0
 
 	for {
@@ -223,10 +272,67 @@ func (store *Store) Restore() error {
 	return nil
 }
 
+// Read returns the contents of the log file as they're stored, including any encryption.
+func (store *Store) Read() ([]byte, error) {
+	store.mut.Lock()
+	defer store.mut.Unlock()
+
+	if store.rw == nil {
+		return nil, nil
+	}
+	if _, err := store.rw.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("read aof: %v", err)
+	}
+	return io.ReadAll(store.rw)
+}
+
+// Mark records the current end of the log. The next call to Truncate will keep all the commands
+// logged after the mark. This allows commands to be logged while the preamble is being created.
+func (store *Store) Mark() {
+	store.mut.Lock()
+	defer store.mut.Unlock()
+
+	if store.rw == nil {
+		return
+	}
+
+	offset, err := store.rw.Seek(0, io.SeekEnd)
+	if err != nil {
+		log.Printf("mark: seek error: %+v\n", err)
+		return
+	}
+	store.mark = &struct {
+		offset   int64
+		database int
+	}{offset: offset, database: store.currentDatabase}
+}
+
+// Truncate clears the log. If Mark was called before Truncate, the commands logged after the mark
+// are retained.
 func (store *Store) Truncate() error {
 	store.mut.Lock()
 	defer store.mut.Unlock()
 
+	// Read the commands logged after the mark, if there is one.
+	database := store.currentDatabase
+	var tail []byte
+	if store.mark != nil {
+		database = store.mark.database
+		if _, err := store.rw.Seek(store.mark.offset, io.SeekStart); err != nil {
+			return fmt.Errorf("truncate: seek error: %+v", err)
+		}
+		b, err := io.ReadAll(store.rw)
+		if err != nil {
+			return fmt.Errorf("truncate: read error: %+v", err)
+		}
+		// Decode the tail so that it's re-encrypted with the active key, or written in plaintext
+		// if encryption has been disabled.
+		if tail, err = store.decode(b); err != nil {
+			return fmt.Errorf("truncate: decode error: %w", err)
+		}
+		store.mark = nil
+	}
+
 	if err := store.rw.Truncate(0); err != nil {
 		return fmt.Errorf("truncate: truncate error: %+v", err)
 	}
@@ -236,14 +342,20 @@ func (store *Store) Truncate() error {
 		return fmt.Errorf("truncate: seek error: %+v", err)
 	}
 
-	// Add command to select the current database at the top of the file.
-	_, err := store.rw.Write([]byte(
-		fmt.Sprintf("*2\r\n$6\r\nSELECT\r\n$1\r\n%s\r\n", strconv.Itoa(store.currentDatabase))))
-	if err != nil {
+	// Add command to select the database at the top of the file.
+	if _, err := store.rw.Write(store.cipher.Seal(selectCommand(database))); err != nil {
 		return fmt.Errorf("truncate: log select error: %+v", err)
 	}
+
+	// Write the commands that were logged after the mark.
+	if len(tail) > 0 {
+		if _, err := store.rw.Write(store.cipher.Seal(tail)); err != nil {
+			return fmt.Errorf("truncate: log tail error: %+v", err)
+		}
+	}
+
 	// Immediately sync the file.
-	if err = store.rw.Sync(); err != nil {
+	if err := store.rw.Sync(); err != nil {
 		return fmt.Errorf("truncate: sync error: %+v", err)
 	}
 
@@ -261,3 +373,40 @@ func (store *Store) Close() error {
 	}
 	return nil
 }
+
+// decode returns the plaintext commands in the log. The log can contain plaintext commands
+// and encrypted envelopes, e.g. when encryption was enabled after the log was created.
+// The plaintext commands are only read when the cipher allows plaintext.
+func (store *Store) decode(b []byte) ([]byte, error) {
+	var out []byte
+	for len(b) > 0 {
+		if encryption.IsEncrypted(b) {
+			plaintext, n, err := store.cipher.OpenNext(b)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, plaintext...)
+			b = b[n:]
+			continue
+		}
+		// Read a plaintext command.
+		if !store.cipher.PlaintextAllowed() {
+			return nil, encryption.ErrPlaintext
+		}
+		_, n, err := resp.NewReader(bytes.NewReader(b)).ReadValue()
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if n == 0 {
+			break
+		}
+		out = append(out, b[:n]...)
+		b = b[n:]
+	}
+	return out, nil
+}
+
+func selectCommand(database int) []byte {
+	db := strconv.Itoa(database)
+	return []byte(fmt.Sprintf("*2\r\n$6\r\nSELECT\r\n$%d\r\n%s\r\n", len(db), db))
+}
@@ -16,9 +16,11 @@ package log_test
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"github.com/echovault/sugardb/internal/aof/log"
 	"github.com/echovault/sugardb/internal/clock"
+	"github.com/echovault/sugardb/internal/encryption"
 	"os"
 	"path"
 	"testing"
@@ -147,3 +149,209 @@ func Test_AppendStore(t *testing.T) {
 	}
 
 }
+
+func Test_AppendStoreTruncateAfterMark(t *testing.T) {
+	directory := "./testdata/log/with_mark"
+	t.Cleanup(func() {
+		_ = os.RemoveAll(path.Join(".", "testdata"))
+	})
+
+	beforeMark := [][]string{
+		{"SET", "key1", "value1"},
+		{"SET", "key2", "value2"},
+	}
+	afterMark := [][]string{
+		{"SET", "key3", "value3"},
+		{"SET", "key4", "value4"},
+	}
+
+	var restored []int
+	store, err := log.NewAppendStore(
+		log.WithClock(clock.NewClock()),
+		log.WithDirectory(directory),
+		log.WithStrategy("always"),
+		log.WithHandleCommandFunc(func(database int, command []byte) {
+			for _, c := range beforeMark {
+				if bytes.Contains(command, marshalRespCommand(c)) {
+					t.Errorf("expected command logged before mark to be truncated:\n%s", string(command))
+					return
+				}
+			}
+			for _, c := range afterMark {
+				if bytes.Contains(command, marshalRespCommand(c)) {
+					restored = append(restored, database)
+					return
+				}
+			}
+			t.Errorf("could not find command in commands list:\n%s", string(command))
+		}),
+	)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	for _, command := range beforeMark {
+		if err = store.Write(1, marshalRespCommand(command)); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+
+	store.Mark()
+
+	for _, command := range afterMark {
+		if err = store.Write(1, marshalRespCommand(command)); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+
+	if err = store.Truncate(); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if err = store.Restore(); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if len(restored) != len(afterMark) {
+		t.Errorf("expected %d commands to be restored, got %d", len(afterMark), len(restored))
+	}
+	for _, database := range restored {
+		if database != 1 {
+			t.Errorf("expected command to be restored to database 1, got %d", database)
+		}
+	}
+
+	if err = store.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_AppendStoreEncryption(t *testing.T) {
+	directory := "./testdata/log/with_encryption"
+	t.Cleanup(func() {
+		_ = os.RemoveAll(path.Join(".", "testdata"))
+	})
+
+	key := bytes.Repeat([]byte{1}, 32)
+	cipher, _ := encryption.NewCipher(key)
+	// The ciphers that read the log allow the plaintext commands written before encryption was enabled.
+	migrationCipher, _ := encryption.NewCipher(key)
+	migrationCipher.AllowPlaintext()
+	wrongCipher, _ := encryption.NewCipher(bytes.Repeat([]byte{2}, 32))
+	wrongCipher.AllowPlaintext()
+
+	plaintextCommands := [][]string{
+		{"SET", "key1", "value1"},
+		{"SET", "key2", "value2"},
+	}
+	encryptedCommands := [][]string{
+		{"SET", "key3", "value3"},
+		{"SET", "key4", "value4"},
+	}
+
+	write := func(cipher *encryption.Cipher, commands [][]string) {
+		store, err := log.NewAppendStore(
+			log.WithClock(clock.NewClock()),
+			log.WithDirectory(directory),
+			log.WithStrategy("always"),
+			log.WithCipher(cipher),
+		)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		for _, command := range commands {
+			if err = store.Write(0, marshalRespCommand(command)); err != nil {
+				t.Error(err)
+			}
+		}
+		if err = store.Close(); err != nil {
+			t.Error(err)
+		}
+	}
+
+	// Write commands before encryption is enabled, then write encrypted commands to the same log.
+	write(nil, plaintextCommands)
+	write(cipher, encryptedCommands)
+
+	b, err := os.ReadFile(path.Join(directory, "aof", "log.aof"))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	for _, command := range encryptedCommands {
+		if bytes.Contains(b, marshalRespCommand(command)) {
+			t.Errorf("expected command to be encrypted in the log:\n%s", string(marshalRespCommand(command)))
+		}
+	}
+
+	tests := []struct {
+		name    string
+		cipher  *encryption.Cipher
+		want    int
+		wantErr error
+	}{
+		{
+			name:   "1. Restore plaintext and encrypted commands with the right key",
+			cipher: migrationCipher,
+			want:   len(plaintextCommands) + len(encryptedCommands),
+		},
+		{
+			name:    "2. Restore plaintext commands when plaintext is not allowed returns an error",
+			cipher:  cipher,
+			wantErr: encryption.ErrPlaintext,
+		},
+		{
+			name:    "3. Restore with the wrong key returns an error",
+			cipher:  wrongCipher,
+			wantErr: encryption.ErrWrongKey,
+		},
+		{
+			name:    "4. Restore without a key returns an error",
+			cipher:  nil,
+			wantErr: encryption.ErrNoKey,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			restored := 0
+			store, err := log.NewAppendStore(
+				log.WithClock(clock.NewClock()),
+				log.WithDirectory(directory),
+				log.WithStrategy("always"),
+				log.WithCipher(test.cipher),
+				log.WithHandleCommandFunc(func(database int, command []byte) {
+					restored += 1
+				}),
+			)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer func() {
+				_ = store.Close()
+			}()
+
+			err = store.Restore()
+			if test.wantErr != nil {
+				if !errors.Is(err, test.wantErr) {
+					t.Errorf("expected error %v, got %v", test.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if restored != test.want {
+				t.Errorf("expected %d commands to be restored, got %d", test.want, restored)
+			}
+		})
+	}
+}
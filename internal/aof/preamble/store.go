@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"github.com/echovault/sugardb/internal"
 	"github.com/echovault/sugardb/internal/clock"
+	"github.com/echovault/sugardb/internal/encryption"
 	"io"
 	"os"
 	"path"
@@ -37,6 +38,7 @@ type Store struct {
 	rw             ReadWriter
 	mut            sync.Mutex
 	directory      string
+	cipher         *encryption.Cipher
 	getStateFunc   func() map[int]map[string]internal.KeyData
 	setKeyDataFunc func(database int, key string, data internal.KeyData)
 }
@@ -71,6 +73,12 @@ func WithDirectory(directory string) func(store *Store) {
 	}
 }
 
+func WithCipher(cipher *encryption.Cipher) func(store *Store) {
+	return func(store *Store) {
+		store.cipher = cipher
+	}
+}
+
 func NewPreambleStore(options ...func(store *Store)) (*Store, error) {
 	store := &Store{
 		clock:     clock.NewClock(),
@@ -124,7 +132,7 @@ func (store *Store) CreatePreamble() error {
 		return err
 	}
 
-	if _, err = store.rw.Write(o); err != nil {
+	if _, err = store.rw.Write(store.cipher.Seal(o)); err != nil {
 		return err
 	}
 
@@ -155,6 +163,10 @@ func (store *Store) Restore() error {
 		return nil
 	}
 
+	if b, err = store.cipher.Open(b); err != nil {
+		return err
+	}
+
 	state := make(map[int]map[string]internal.KeyData)
 	if err = json.Unmarshal(b, &state); err != nil {
 		return err
@@ -169,6 +181,20 @@ func (store *Store) Restore() error {
 	return nil
 }
 
+// Read returns the contents of the preamble file as they're stored, including any encryption.
+func (store *Store) Read() ([]byte, error) {
+	store.mut.Lock()
+	defer store.mut.Unlock()
+
+	if store.rw == nil {
+		return nil, nil
+	}
+	if _, err := store.rw.Seek(0, 0); err != nil {
+		return nil, fmt.Errorf("read preamble: %v", err)
+	}
+	return io.ReadAll(store.rw)
+}
+
 func (store *Store) Close() error {
 	store.mut.Lock()
 	defer store.mut.Unlock()
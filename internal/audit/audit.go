@@ -0,0 +1,335 @@
+// Copyright 2024 Kelvin Clement Mwinuka
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package audit records the commands in the audited categories in an append-only log of JSON lines.
+//
+// When the log file grows above its max size, it's renamed to <file>.1, the previous <file>.1 is renamed
+// to <file>.2 and so on. Only the configured number of rotated files is kept.
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/echovault/sugardb/internal"
+	"github.com/echovault/sugardb/internal/clock"
+	"log"
+	"os"
+	"path"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+)
+
+const (
+	OutcomeOK    = "ok"
+	OutcomeError = "error"
+)
+
+// redacted replaces the secrets in the audited commands.
+const redacted = "(redacted)"
+
+type Logger struct {
+	clock           clock.Clock
+	path            string
+	maxSize         uint64
+	maxFiles        uint
+	categories      []string
+	commands        []string
+	excludeCommands []string
+	hook            func(event internal.AuditEvent)
+	originalCommand func(cmd []string) []string
+
+	mut  sync.Mutex
+	file *os.File
+	size uint64
+}
+
+func WithClock(clock clock.Clock) func(logger *Logger) {
+	return func(logger *Logger) {
+		logger.clock = clock
+	}
+}
+
+// WithPath sets the path of the log file. Nothing is written to a file when it's empty.
+func WithPath(path string) func(logger *Logger) {
+	return func(logger *Logger) {
+		logger.path = path
+	}
+}
+
+// WithMaxSize sets the size above which the log file is rotated. The file is never rotated when it's 0.
+func WithMaxSize(maxSize uint64) func(logger *Logger) {
+	return func(logger *Logger) {
+		logger.maxSize = maxSize
+	}
+}
+
+// WithMaxFiles sets the number of rotated log files that are kept.
+func WithMaxFiles(maxFiles uint) func(logger *Logger) {
+	return func(logger *Logger) {
+		logger.maxFiles = maxFiles
+	}
+}
+
+// WithCategories sets the command categories that are audited.
+func WithCategories(categories []string) func(logger *Logger) {
+	return func(logger *Logger) {
+		logger.categories = categories
+	}
+}
+
+// WithCommands sets the commands that are audited in addition to the audited categories.
+// A command, e.g. "acl", includes its subcommands, e.g. "acl|setuser".
+func WithCommands(commands []string) func(logger *Logger) {
+	return func(logger *Logger) {
+		logger.commands = commands
+	}
+}
+
+// WithExcludeCommands sets the commands that are not audited, even when they're in an audited category.
+func WithExcludeCommands(commands []string) func(logger *Logger) {
+	return func(logger *Logger) {
+		logger.excludeCommands = commands
+	}
+}
+
+// WithHook sets the function that's called with every audit event. The function must not block.
+func WithHook(hook func(event internal.AuditEvent)) func(logger *Logger) {
+	return func(logger *Logger) {
+		logger.hook = hook
+	}
+}
+
+// WithOriginalCommand sets the function that replaces the names of a command renamed with --rename-command
+// with its original names. The secrets of the renamed commands are redacted according to their original names.
+func WithOriginalCommand(originalCommand func(cmd []string) []string) func(logger *Logger) {
+	return func(logger *Logger) {
+		logger.originalCommand = originalCommand
+	}
+}
+
+// NewLogger returns a logger that appends to the log file, which is created if it does not exist.
+func NewLogger(options ...func(logger *Logger)) (*Logger, error) {
+	logger := &Logger{
+		clock: clock.NewClock(),
+	}
+	for _, option := range options {
+		option(logger)
+	}
+	if logger.path != "" {
+		if err := logger.open(); err != nil {
+			return nil, err
+		}
+	}
+	return logger, nil
+}
+
+// Enabled returns true when the events are written to a file or passed to a hook.
+func (logger *Logger) Enabled() bool {
+	return logger != nil && (logger.path != "" || logger.hook != nil)
+}
+
+// Audited returns true when the command, including its subcommand, is audited.
+func (logger *Logger) Audited(command internal.Command, subCommand internal.SubCommand) bool {
+	if !logger.Enabled() {
+		return false
+	}
+
+	names := []string{strings.ToLower(command.Command)}
+	categories := slices.Clone(command.Categories)
+	if !reflect.DeepEqual(subCommand, internal.SubCommand{}) {
+		names = append(names, fmt.Sprintf("%s|%s", names[0], strings.ToLower(subCommand.Command)))
+		categories = append(categories, subCommand.Categories...)
+	}
+
+	matches := func(commands []string) bool {
+		return slices.ContainsFunc(commands, func(c string) bool {
+			return slices.Contains(names, strings.ToLower(c))
+		})
+	}
+	if matches(logger.excludeCommands) {
+		return false
+	}
+	if matches(logger.commands) {
+		return true
+	}
+	return slices.ContainsFunc(categories, func(category string) bool {
+		return slices.ContainsFunc(logger.categories, func(c string) bool {
+			return strings.EqualFold(c, category)
+		})
+	})
+}
+
+// Log redacts the secrets of the event's command, appends the event to the log file and passes it to the hook.
+func (logger *Logger) Log(event internal.AuditEvent) {
+	if !logger.Enabled() {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = logger.clock.Now()
+	}
+	if logger.originalCommand != nil {
+		event.Command = redact(event.Command, logger.originalCommand(event.Command))
+	} else {
+		event.Command = Redact(event.Command)
+	}
+
+	if logger.path != "" {
+		if err := logger.write(event); err != nil {
+			log.Printf("audit log: %v\n", err)
+		}
+	}
+	if logger.hook != nil {
+		logger.hook(event)
+	}
+}
+
+// Close closes the log file.
+func (logger *Logger) Close() error {
+	if logger == nil {
+		return nil
+	}
+	logger.mut.Lock()
+	defer logger.mut.Unlock()
+	if logger.file == nil {
+		return nil
+	}
+	err := logger.file.Close()
+	logger.file = nil
+	return err
+}
+
+func (logger *Logger) write(event internal.AuditEvent) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	logger.mut.Lock()
+	defer logger.mut.Unlock()
+
+	if logger.file == nil {
+		return fmt.Errorf("%s is closed", logger.path)
+	}
+	if logger.maxSize > 0 && logger.size > 0 && logger.size+uint64(len(line)) > logger.maxSize {
+		if err = logger.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := logger.file.Write(line)
+	logger.size += uint64(n)
+	return err
+}
+
+// open opens the log file for appending. The mutex must be held once the logger is in use.
+func (logger *Logger) open() error {
+	if err := os.MkdirAll(path.Dir(logger.path), os.ModePerm); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(logger.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	logger.file = f
+	logger.size = uint64(info.Size())
+	return nil
+}
+
+// rotate renames the log file to <file>.1, shifts the previous rotated files and opens a new log file.
+// The mutex must be held.
+func (logger *Logger) rotate() error {
+	if err := logger.file.Close(); err != nil {
+		return err
+	}
+	logger.file = nil
+
+	if logger.maxFiles == 0 {
+		if err := os.Remove(logger.path); err != nil {
+			return err
+		}
+		return logger.open()
+	}
+
+	for i := logger.maxFiles - 1; i >= 1; i-- {
+		err := os.Rename(fmt.Sprintf("%s.%d", logger.path, i), fmt.Sprintf("%s.%d", logger.path, i+1))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := os.Rename(logger.path, fmt.Sprintf("%s.1", logger.path)); err != nil {
+		return err
+	}
+	return logger.open()
+}
+
+// Redact returns a copy of the command with the passwords and tokens replaced.
+// The prefix of the ACL SETUSER password rules is kept, e.g. ">(redacted)".
+func Redact(cmd []string) []string {
+	return redact(cmd, cmd)
+}
+
+// redact redacts the command according to the original names of the command and its subcommand in original,
+// which has the same arguments as the command.
+func redact(cmd []string, original []string) []string {
+	res := slices.Clone(cmd)
+	if len(res) == 0 {
+		return res
+	}
+	if len(original) != len(res) {
+		original = res
+	}
+
+	switch strings.ToLower(original[0]) {
+	case "auth":
+		// AUTH <password> or AUTH <username> <password>
+		if len(res) > 1 {
+			res[len(res)-1] = redacted
+		}
+	case "hello":
+		// HELLO [protover [AUTH username password]]
+		for i := 1; i < len(res)-2; i++ {
+			if strings.EqualFold(res[i], "auth") {
+				res[i+2] = redacted
+			}
+		}
+	case "migrate":
+		// MIGRATE ... [AUTH password | AUTH2 username password]
+		for i := 1; i < len(res)-1; i++ {
+			switch {
+			case strings.EqualFold(res[i], "auth"):
+				res[i+1] = redacted
+			case strings.EqualFold(res[i], "auth2") && i+2 < len(res):
+				res[i+2] = redacted
+			}
+		}
+	case "acl":
+		// ACL SETUSER username [rule ...]
+		if len(res) > 3 && strings.EqualFold(original[1], "setuser") {
+			for i := 3; i < len(res); i++ {
+				if res[i] != "" && slices.Contains([]uint8{'>', '<', '#', '!'}, res[i][0]) {
+					res[i] = res[i][:1] + redacted
+				}
+			}
+		}
+	}
+
+	return res
+}
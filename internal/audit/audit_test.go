@@ -0,0 +1,234 @@
+// Copyright 2024 Kelvin Clement Mwinuka
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package audit_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/echovault/sugardb/internal"
+	"github.com/echovault/sugardb/internal/audit"
+	"github.com/echovault/sugardb/internal/clock"
+	"github.com/echovault/sugardb/internal/constants"
+	"os"
+	"path"
+	"slices"
+	"testing"
+)
+
+func readEvents(t *testing.T, file string) []internal.AuditEvent {
+	f, err := os.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	var events []internal.AuditEvent
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var event internal.AuditEvent
+		if err = json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+func Test_Redact(t *testing.T) {
+	tests := []struct {
+		name string
+		cmd  []string
+		want []string
+	}{
+		{
+			name: "1. Redact the password of AUTH",
+			cmd:  []string{"AUTH", "password"},
+			want: []string{"AUTH", "(redacted)"},
+		},
+		{
+			name: "2. Keep the username of AUTH",
+			cmd:  []string{"AUTH", "user", "password"},
+			want: []string{"AUTH", "user", "(redacted)"},
+		},
+		{
+			name: "3. Redact the password of HELLO",
+			cmd:  []string{"HELLO", "3", "AUTH", "user", "password", "SETNAME", "client"},
+			want: []string{"HELLO", "3", "AUTH", "user", "(redacted)", "SETNAME", "client"},
+		},
+		{
+			name: "4. Redact the passwords of MIGRATE",
+			cmd:  []string{"MIGRATE", "host", "7480", "key", "0", "1000", "AUTH2", "user", "password"},
+			want: []string{"MIGRATE", "host", "7480", "key", "0", "1000", "AUTH2", "user", "(redacted)"},
+		},
+		{
+			name: "5. Redact the password rules of ACL SETUSER",
+			cmd:  []string{"ACL", "SETUSER", "user", "on", ">password", "<old", "#hash", "!hash", "+@all"},
+			want: []string{"ACL", "SETUSER", "user", "on", ">(redacted)", "<(redacted)", "#(redacted)", "!(redacted)", "+@all"},
+		},
+		{
+			name: "6. Keep the commands without secrets",
+			cmd:  []string{"FLUSHALL"},
+			want: []string{"FLUSHALL"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := audit.Redact(test.cmd); !slices.Equal(got, test.want) {
+				t.Errorf("expected %v, got %v", test.want, got)
+			}
+		})
+	}
+}
+
+func Test_Audited(t *testing.T) {
+	logger, err := audit.NewLogger(
+		audit.WithHook(func(event internal.AuditEvent) {}),
+		audit.WithCategories([]string{constants.AdminCategory, constants.DangerousCategory}),
+		audit.WithCommands([]string{"keys", "config|set"}),
+		audit.WithExcludeCommands([]string{"acl|whoami"}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	acl := internal.Command{Command: "acl", Categories: []string{}}
+	tests := []struct {
+		name       string
+		command    internal.Command
+		subCommand internal.SubCommand
+		want       bool
+	}{
+		{
+			name:    "1. Audit a command in an audited category",
+			command: internal.Command{Command: "flushall", Categories: []string{constants.DangerousCategory}},
+			want:    true,
+		},
+		{
+			name:       "2. Audit a subcommand in an audited category",
+			command:    acl,
+			subCommand: internal.SubCommand{Command: "setuser", Categories: []string{constants.AdminCategory}},
+			want:       true,
+		},
+		{
+			name:    "3. Audit an audited command",
+			command: internal.Command{Command: "KEYS", Categories: []string{constants.ReadCategory}},
+			want:    true,
+		},
+		{
+			name:       "4. Skip an excluded subcommand",
+			command:    acl,
+			subCommand: internal.SubCommand{Command: "whoami", Categories: []string{constants.AdminCategory}},
+			want:       false,
+		},
+		{
+			name:    "5. Skip a command in another category",
+			command: internal.Command{Command: "get", Categories: []string{constants.ReadCategory}},
+			want:    false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := logger.Audited(test.command, test.subCommand); got != test.want {
+				t.Errorf("expected %t, got %t", test.want, got)
+			}
+		})
+	}
+
+	disabled, err := audit.NewLogger(audit.WithCategories([]string{constants.DangerousCategory}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if disabled.Audited(internal.Command{Command: "flushall", Categories: []string{constants.DangerousCategory}}, internal.SubCommand{}) {
+		t.Error("expected no command to be audited without a file or a hook")
+	}
+}
+
+func Test_Logger(t *testing.T) {
+	file := path.Join(t.TempDir(), "audit", "audit.log")
+	mockClock := clock.NewClock()
+
+	var hooked []internal.AuditEvent
+	logger, err := audit.NewLogger(
+		audit.WithClock(mockClock),
+		audit.WithPath(file),
+		audit.WithMaxSize(300),
+		audit.WithMaxFiles(2),
+		audit.WithHook(func(event internal.AuditEvent) {
+			hooked = append(hooked, event)
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 10; i++ {
+		logger.Log(internal.AuditEvent{
+			Username: "default",
+			Client:   "127.0.0.1:1234",
+			Command:  []string{"AUTH", fmt.Sprintf("password%d", i)},
+			Outcome:  audit.OutcomeOK,
+		})
+	}
+	if err = logger.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(hooked) != 10 {
+		t.Fatalf("expected the hook to receive 10 events, got %d", len(hooked))
+	}
+	if !slices.Equal(hooked[0].Command, []string{"AUTH", "(redacted)"}) || !hooked[0].Time.Equal(mockClock.Now()) {
+		t.Errorf("expected the hooked event to be redacted and timestamped, got %+v", hooked[0])
+	}
+
+	// The events are spread over the log file and the 2 most recent rotated files.
+	var events []internal.AuditEvent
+	for _, f := range []string{file + ".2", file + ".1", file} {
+		info, err := os.Stat(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Size() > 300 {
+			t.Errorf("expected %s to be rotated at 300 bytes, got %d bytes", f, info.Size())
+		}
+		events = append(events, readEvents(t, f)...)
+	}
+	if _, err = os.Stat(file + ".3"); !os.IsNotExist(err) {
+		t.Errorf("expected only 2 rotated files to be kept, got %v", err)
+	}
+	if len(events) == 0 || len(events) >= 10 {
+		t.Fatalf("expected the oldest events to be removed by the rotation, got %d events", len(events))
+	}
+	for _, event := range events {
+		if event.Username != "default" || event.Outcome != audit.OutcomeOK || event.Command[1] != "(redacted)" {
+			t.Errorf("unexpected event %+v", event)
+		}
+	}
+
+	// The log is appended to when it's opened again.
+	before := len(readEvents(t, file))
+	logger, err = audit.NewLogger(audit.WithPath(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger.Log(internal.AuditEvent{Command: []string{"FLUSHALL"}, Outcome: audit.OutcomeOK})
+	if err = logger.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := readEvents(t, file); len(got) != before+1 || got[len(got)-1].Command[0] != "FLUSHALL" {
+		t.Errorf("expected the event to be appended, got %+v", got)
+	}
+}
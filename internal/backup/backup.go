@@ -0,0 +1,389 @@
+// Copyright 2024 Kelvin Clement Mwinuka
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package backup uploads the standalone persistence files to a backup target and restores them at startup.
+//
+// The objects are stored in the target with the following layout:
+//
+//	snapshots/<snapshot id>/state.bin
+//	aof/<segment id>/preamble.bin
+//	aof/<segment id>/log.aof
+//
+// A snapshot is uploaded once it is complete. An AOF segment is a copy of the preamble and the log
+// at the time of the upload. A new segment is only uploaded when the AOF files have changed.
+package backup
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"github.com/echovault/sugardb/internal/clock"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Engine struct {
+	clock     clock.Clock
+	directory string
+	target    Target
+	interval  time.Duration
+
+	getLatestSnapshotTimeFunc func() int64
+	readAOFFunc               func() (preamble []byte, log []byte, err error)
+
+	mut               sync.Mutex
+	uploadedSnapshots map[int64]struct{} // Snapshots that are known to exist in the target.
+	listedSnapshots   bool               // Whether the snapshots in the target have been listed.
+	lastAOFDigest     [32]byte           // Digest of the latest AOF segment uploaded.
+	stop              chan struct{}
+	stopOnce          sync.Once
+}
+
+func WithClock(clock clock.Clock) func(engine *Engine) {
+	return func(engine *Engine) {
+		engine.clock = clock
+	}
+}
+
+func WithDirectory(directory string) func(engine *Engine) {
+	return func(engine *Engine) {
+		engine.directory = directory
+	}
+}
+
+func WithTarget(target Target) func(engine *Engine) {
+	return func(engine *Engine) {
+		engine.target = target
+	}
+}
+
+// WithInterval sets the interval between scheduled uploads. Scheduled uploads are disabled when the interval is 0.
+func WithInterval(interval time.Duration) func(engine *Engine) {
+	return func(engine *Engine) {
+		engine.interval = interval
+	}
+}
+
+// WithGetLatestSnapshotTimeFunc sets the function that returns the id of the latest complete snapshot.
+// Snapshots newer than this are still being written and are not uploaded.
+func WithGetLatestSnapshotTimeFunc(f func() int64) func(engine *Engine) {
+	return func(engine *Engine) {
+		engine.getLatestSnapshotTimeFunc = f
+	}
+}
+
+// WithReadAOFFunc sets the function that returns a consistent copy of the AOF preamble and log.
+func WithReadAOFFunc(f func() (preamble []byte, log []byte, err error)) func(engine *Engine) {
+	return func(engine *Engine) {
+		engine.readAOFFunc = f
+	}
+}
+
+func NewBackupEngine(options ...func(engine *Engine)) *Engine {
+	engine := &Engine{
+		clock:                     clock.NewClock(),
+		directory:                 "",
+		interval:                  5 * time.Minute,
+		getLatestSnapshotTimeFunc: func() int64 { return 0 },
+		readAOFFunc:               nil,
+		uploadedSnapshots:         make(map[int64]struct{}),
+		stop:                      make(chan struct{}),
+	}
+
+	for _, option := range options {
+		option(engine)
+	}
+
+	return engine
+}
+
+// Start starts the scheduled uploads in the background.
+func (engine *Engine) Start() {
+	if engine.target == nil || engine.interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(engine.interval)
+		defer func() {
+			ticker.Stop()
+		}()
+		for {
+			select {
+			case <-engine.stop:
+				return
+			case <-ticker.C:
+				if err := engine.Upload(context.Background()); err != nil {
+					log.Printf("backup upload error: %+v\n", err)
+				}
+			}
+		}
+	}()
+}
+
+// Stop stops the scheduled uploads.
+func (engine *Engine) Stop() {
+	engine.stopOnce.Do(func() {
+		close(engine.stop)
+	})
+}
+
+// Upload uploads the complete snapshots that are not in the target yet, and the AOF files if they have changed.
+func (engine *Engine) Upload(ctx context.Context) error {
+	if engine.target == nil {
+		return errors.New("no backup target configured")
+	}
+
+	engine.mut.Lock()
+	defer engine.mut.Unlock()
+
+	if err := engine.uploadSnapshots(ctx); err != nil {
+		return fmt.Errorf("upload snapshots: %w", err)
+	}
+	if err := engine.uploadAOF(ctx); err != nil {
+		return fmt.Errorf("upload aof: %w", err)
+	}
+
+	return nil
+}
+
+func (engine *Engine) uploadSnapshots(ctx context.Context) error {
+	if !engine.listedSnapshots {
+		ids, err := engine.targetIds(ctx, "snapshots/", "state.bin")
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			engine.uploadedSnapshots[id] = struct{}{}
+		}
+		engine.listedSnapshots = true
+	}
+
+	ids, err := localIds(path.Join(engine.directory, "snapshots"))
+	if err != nil {
+		return err
+	}
+
+	latest := engine.getLatestSnapshotTimeFunc()
+	for _, id := range ids {
+		if _, ok := engine.uploadedSnapshots[id]; ok || id > latest {
+			continue
+		}
+		b, err := os.ReadFile(path.Join(engine.directory, "snapshots", strconv.FormatInt(id, 10), "state.bin"))
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				// The snapshot was removed by the retention policy.
+				continue
+			}
+			return err
+		}
+		name := fmt.Sprintf("snapshots/%d/state.bin", id)
+		if err = engine.target.Put(ctx, name, bytes.NewReader(b), int64(len(b))); err != nil {
+			return err
+		}
+		engine.uploadedSnapshots[id] = struct{}{}
+		log.Printf("uploaded backup %s\n", name)
+	}
+
+	return nil
+}
+
+func (engine *Engine) uploadAOF(ctx context.Context) error {
+	if engine.readAOFFunc == nil {
+		return nil
+	}
+
+	preamble, appendLog, err := engine.readAOFFunc()
+	if err != nil {
+		return err
+	}
+	if len(preamble) == 0 && len(appendLog) == 0 {
+		return nil
+	}
+
+	digest := sha256.Sum256(append(append(slices.Clip(preamble), 0), appendLog...))
+	if digest == engine.lastAOFDigest {
+		return nil
+	}
+
+	// The log is uploaded last so that a segment is only restored once both files are uploaded.
+	segment := engine.clock.Now().UnixMilli()
+	for _, file := range []struct {
+		name string
+		data []byte
+	}{
+		{name: fmt.Sprintf("aof/%d/preamble.bin", segment), data: preamble},
+		{name: fmt.Sprintf("aof/%d/log.aof", segment), data: appendLog},
+	} {
+		if err = engine.target.Put(ctx, file.name, bytes.NewReader(file.data), int64(len(file.data))); err != nil {
+			return err
+		}
+	}
+	engine.lastAOFDigest = digest
+	log.Printf("uploaded backup aof segment %d\n", segment)
+
+	return nil
+}
+
+// Restore downloads the latest snapshot and the latest AOF segment from the target into the directory.
+// Local files take precedence: the snapshot is only downloaded if there's no local snapshot that is at least as
+// recent, and the AOF segment is only downloaded if there are no local AOF files.
+// This must be called before the snapshot and AOF engines open the files.
+func (engine *Engine) Restore(ctx context.Context) error {
+	if engine.target == nil {
+		return errors.New("no backup target configured")
+	}
+
+	engine.mut.Lock()
+	defer engine.mut.Unlock()
+
+	if err := engine.restoreSnapshot(ctx); err != nil {
+		return fmt.Errorf("restore snapshot backup: %w", err)
+	}
+	if err := engine.restoreAOF(ctx); err != nil {
+		return fmt.Errorf("restore aof backup: %w", err)
+	}
+
+	return nil
+}
+
+func (engine *Engine) restoreSnapshot(ctx context.Context) error {
+	ids, err := engine.targetIds(ctx, "snapshots/", "state.bin")
+	if err != nil || len(ids) == 0 {
+		return err
+	}
+	latest := ids[len(ids)-1]
+
+	localIds, err := localIds(path.Join(engine.directory, "snapshots"))
+	if err != nil {
+		return err
+	}
+	if len(localIds) > 0 && localIds[len(localIds)-1] >= latest {
+		return nil
+	}
+
+	name := fmt.Sprintf("snapshots/%d/state.bin", latest)
+	if err = engine.download(ctx, name, path.Join(engine.directory, filepath.FromSlash(name))); err != nil {
+		return err
+	}
+	engine.uploadedSnapshots[latest] = struct{}{}
+	log.Printf("restored backup %s\n", name)
+
+	return nil
+}
+
+func (engine *Engine) restoreAOF(ctx context.Context) error {
+	segments, err := engine.targetIds(ctx, "aof/", "log.aof")
+	if err != nil || len(segments) == 0 {
+		return err
+	}
+
+	// Do not overwrite local AOF files that have data.
+	for _, file := range []string{"preamble.bin", "log.aof"} {
+		info, err := os.Stat(path.Join(engine.directory, "aof", file))
+		if err == nil && info.Size() > 0 {
+			return nil
+		}
+	}
+
+	segment := segments[len(segments)-1]
+	for _, file := range []string{"preamble.bin", "log.aof"} {
+		name := fmt.Sprintf("aof/%d/%s", segment, file)
+		if err = engine.download(ctx, name, path.Join(engine.directory, "aof", file)); err != nil {
+			return err
+		}
+	}
+	log.Printf("restored backup aof segment %d\n", segment)
+
+	return nil
+}
+
+func (engine *Engine) download(ctx context.Context, name string, filename string) error {
+	r, err := engine.target.Get(ctx, name)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = r.Close()
+	}()
+
+	if err = os.MkdirAll(path.Dir(filename), os.ModePerm); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, os.ModePerm)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(f, r); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// targetIds returns the ids of the objects named <prefix><id>/<file> in the target, in ascending order.
+func (engine *Engine) targetIds(ctx context.Context, prefix string, file string) ([]int64, error) {
+	names, err := engine.target.List(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	var ids []int64
+	for _, name := range names {
+		parts := strings.Split(strings.TrimPrefix(name, prefix), "/")
+		if len(parts) != 2 || parts[1] != file {
+			continue
+		}
+		if id, err := strconv.ParseInt(parts[0], 10, 64); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+	return ids, nil
+}
+
+// localIds returns the ids of the snapshot directories in the directory, in ascending order.
+func localIds(directory string) ([]int64, error) {
+	entries, err := os.ReadDir(directory)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var ids []int64
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		if id, err := strconv.ParseInt(entry.Name(), 10, 64); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+	return ids, nil
+}
@@ -0,0 +1,243 @@
+// Copyright 2024 Kelvin Clement Mwinuka
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backup_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/echovault/sugardb/internal/backup"
+	"github.com/echovault/sugardb/internal/clock"
+	"io"
+	"os"
+	"path"
+	"slices"
+	"testing"
+)
+
+func newTargets(t *testing.T, name string) map[string]backup.Target {
+	s3 := newFakeS3("test-access-key", "sugardb")
+	t.Cleanup(s3.Close)
+
+	s3Target, err := backup.NewS3Target(backup.S3Options{
+		Endpoint:        s3.URL,
+		Bucket:          "sugardb",
+		Prefix:          "backups/" + name,
+		AccessKeyID:     "test-access-key",
+		SecretAccessKey: "test-secret-key",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return map[string]backup.Target{
+		"file": backup.NewFileTarget(path.Join(".", "testdata", "targets", name)),
+		"s3":   s3Target,
+	}
+}
+
+func Test_Targets(t *testing.T) {
+	t.Cleanup(func() {
+		_ = os.RemoveAll("./testdata")
+	})
+
+	objects := map[string][]byte{
+		"snapshots/1/state.bin":  []byte("snapshot-1"),
+		"snapshots/2/state.bin":  []byte("snapshot-2"),
+		"aof/1/preamble.bin":     []byte("preamble-1"),
+		"aof/1/log.aof":          []byte("log-1"),
+		"snapshots/10/state.bin": []byte("snapshot-10"),
+	}
+
+	for name, target := range newTargets(t, "objects") {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			for key, data := range objects {
+				if err := target.Put(ctx, key, bytes.NewReader(data), int64(len(data))); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+
+			// Overwrite an existing object.
+			if err := target.Put(ctx, "aof/1/log.aof", bytes.NewReader([]byte("log-1-updated")), 13); err != nil {
+				t.Error(err)
+				return
+			}
+
+			names, err := target.List(ctx, "snapshots/")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			want := []string{"snapshots/1/state.bin", "snapshots/10/state.bin", "snapshots/2/state.bin"}
+			if !slices.Equal(names, want) {
+				t.Errorf("expected objects %v, got %v", want, names)
+			}
+
+			r, err := target.Get(ctx, "aof/1/log.aof")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			b, _ := io.ReadAll(r)
+			_ = r.Close()
+			if string(b) != "log-1-updated" {
+				t.Errorf("expected object content \"log-1-updated\", got \"%s\"", string(b))
+			}
+
+			if _, err = target.Get(ctx, "snapshots/3/state.bin"); !errors.Is(err, backup.ErrNotFound) {
+				t.Errorf("expected error %v, got %v", backup.ErrNotFound, err)
+			}
+		})
+	}
+}
+
+func Test_ParseTarget(t *testing.T) {
+	tests := []struct {
+		name    string
+		url     string
+		wantErr bool
+	}{
+		{name: "1. Absolute file target", url: "file:///var/backups/sugardb"},
+		{name: "2. Relative file target", url: "file://backups/sugardb"},
+		{name: "3. S3 target with prefix", url: "s3://bucket/sugardb/backups"},
+		{name: "4. S3 target without bucket", url: "s3:///sugardb", wantErr: true},
+		{name: "5. Unsupported scheme", url: "ftp://host/sugardb", wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := backup.ParseTarget(test.url, backup.S3Options{})
+			if test.wantErr && err == nil {
+				t.Error("expected error, got nil")
+			}
+			if !test.wantErr && err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func Test_BackupEngine(t *testing.T) {
+	t.Cleanup(func() {
+		_ = os.RemoveAll("./testdata")
+	})
+
+	for name, target := range newTargets(t, "engine") {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			directory := path.Join(".", "testdata", "engine", name, "source")
+
+			// Create two complete snapshots, and one that is still being written.
+			for _, id := range []int64{1000, 2000, 3000} {
+				dir := path.Join(directory, "snapshots", fmt.Sprintf("%d", id))
+				if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+					t.Error(err)
+					return
+				}
+				if err := os.WriteFile(path.Join(dir, "state.bin"), []byte(fmt.Sprintf("state-%d", id)), os.ModePerm); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+
+			latestSnapshot := int64(2000)
+			preamble, appendLog := []byte("preamble"), []byte("log")
+			aofReads := 0
+
+			engine := backup.NewBackupEngine(
+				backup.WithClock(clock.NewClock()),
+				backup.WithDirectory(directory),
+				backup.WithTarget(target),
+				backup.WithGetLatestSnapshotTimeFunc(func() int64 { return latestSnapshot }),
+				backup.WithReadAOFFunc(func() ([]byte, []byte, error) {
+					aofReads++
+					return preamble, appendLog, nil
+				}),
+			)
+
+			if err := engine.Upload(ctx); err != nil {
+				t.Error(err)
+				return
+			}
+
+			snapshots, _ := target.List(ctx, "snapshots/")
+			if want := []string{"snapshots/1000/state.bin", "snapshots/2000/state.bin"}; !slices.Equal(snapshots, want) {
+				t.Errorf("expected snapshots %v in target, got %v", want, snapshots)
+			}
+			segments, _ := target.List(ctx, "aof/")
+			if len(segments) != 2 {
+				t.Errorf("expected 1 aof segment with 2 files in target, got %v", segments)
+			}
+
+			// Once the snapshot is complete, it is uploaded on the next upload.
+			latestSnapshot = 3000
+			if err := engine.Upload(ctx); err != nil {
+				t.Error(err)
+				return
+			}
+			snapshots, _ = target.List(ctx, "snapshots/")
+			if len(snapshots) != 3 {
+				t.Errorf("expected 3 snapshots in target, got %v", snapshots)
+			}
+			if aofReads != 2 {
+				t.Errorf("expected the aof files to be read 2 times, got %d", aofReads)
+			}
+
+			// Restore into an empty directory.
+			restoreDirectory := path.Join(".", "testdata", "engine", name, "restore")
+			restoreEngine := backup.NewBackupEngine(
+				backup.WithDirectory(restoreDirectory),
+				backup.WithTarget(target),
+			)
+			if err := restoreEngine.Restore(ctx); err != nil {
+				t.Error(err)
+				return
+			}
+
+			for file, want := range map[string]string{
+				"snapshots/3000/state.bin": "state-3000",
+				"aof/preamble.bin":         "preamble",
+				"aof/log.aof":              "log",
+			} {
+				b, err := os.ReadFile(path.Join(restoreDirectory, file))
+				if err != nil {
+					t.Error(err)
+					continue
+				}
+				if string(b) != want {
+					t.Errorf("expected restored file %s to contain \"%s\", got \"%s\"", file, want, string(b))
+				}
+			}
+			if _, err := os.Stat(path.Join(restoreDirectory, "snapshots", "1000")); err == nil {
+				t.Error("expected only the latest snapshot to be restored")
+			}
+
+			// Local AOF files are not overwritten by the backup.
+			if err := os.WriteFile(path.Join(restoreDirectory, "aof", "log.aof"), []byte("local"), os.ModePerm); err != nil {
+				t.Error(err)
+				return
+			}
+			if err := restoreEngine.Restore(ctx); err != nil {
+				t.Error(err)
+				return
+			}
+			if b, _ := os.ReadFile(path.Join(restoreDirectory, "aof", "log.aof")); string(b) != "local" {
+				t.Errorf("expected local aof file to be kept, got \"%s\"", string(b))
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright 2024 Kelvin Clement Mwinuka
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backup_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// fakeS3 is an in-memory S3-compatible object store that supports the subset of the API used by the S3 target.
+// List responses are paginated with pageSize keys per page to exercise continuation tokens.
+type fakeS3 struct {
+	*httptest.Server
+	accessKeyID string
+	bucket      string
+	pageSize    int
+	mut         sync.Mutex
+	objects     map[string][]byte
+}
+
+func newFakeS3(accessKeyID string, bucket string) *fakeS3 {
+	s := &fakeS3{
+		accessKeyID: accessKeyID,
+		bucket:      bucket,
+		pageSize:    2,
+		objects:     make(map[string][]byte),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+func (s *fakeS3) handle(w http.ResponseWriter, r *http.Request) {
+	// Check that the request is signed with the expected credentials.
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential="+s.accessKeyID+"/") ||
+		r.Header.Get("X-Amz-Date") == "" {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket != s.bucket {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	switch {
+	case r.Method == http.MethodPut && key != "":
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		sum := sha256.Sum256(body)
+		if r.Header.Get("X-Amz-Content-Sha256") != hex.EncodeToString(sum[:]) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		s.objects[key] = body
+		w.WriteHeader(http.StatusOK)
+
+	case r.Method == http.MethodGet && key != "":
+		body, ok := s.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write(body)
+
+	case r.Method == http.MethodGet && r.URL.Query().Get("list-type") == "2":
+		prefix := r.URL.Query().Get("prefix")
+		var keys []string
+		for k := range s.objects {
+			if strings.HasPrefix(k, prefix) {
+				keys = append(keys, k)
+			}
+		}
+		slices.Sort(keys)
+
+		start, _ := strconv.Atoi(r.URL.Query().Get("continuation-token"))
+		end := min(start+s.pageSize, len(keys))
+
+		type content struct {
+			Key string `xml:"Key"`
+		}
+		result := struct {
+			XMLName               xml.Name  `xml:"ListBucketResult"`
+			Contents              []content `xml:"Contents"`
+			IsTruncated           bool      `xml:"IsTruncated"`
+			NextContinuationToken string    `xml:"NextContinuationToken,omitempty"`
+		}{}
+		for _, k := range keys[start:end] {
+			result.Contents = append(result.Contents, content{Key: k})
+		}
+		if end < len(keys) {
+			result.IsTruncated = true
+			result.NextContinuationToken = strconv.Itoa(end)
+		}
+		w.Header().Set("Content-Type", "application/xml")
+		_ = xml.NewEncoder(w).Encode(result)
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,308 @@
+// Copyright 2024 Kelvin Clement Mwinuka
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backup
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// S3Options configures an S3-compatible backup target.
+type S3Options struct {
+	// Endpoint is the base URL of the object store, e.g. https://s3.eu-west-1.amazonaws.com or http://localhost:9000.
+	// Objects are addressed in path style (<endpoint>/<bucket>/<key>).
+	Endpoint string
+	// Region is used to sign the requests. Defaults to us-east-1.
+	Region string
+	// Bucket is the name of the bucket.
+	Bucket string
+	// Prefix is prepended to the names of all the objects.
+	Prefix string
+	// The credentials used to sign requests. When empty, they're read from the
+	// AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN environment variables.
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	// HTTPClient is used to make requests. Defaults to http.DefaultClient.
+	HTTPClient *http.Client
+}
+
+// S3Target stores backups in an S3-compatible object store.
+// Requests are signed with AWS Signature Version 4.
+type S3Target struct {
+	options S3Options
+	now     func() time.Time
+}
+
+// NewS3Target returns a target that stores backups in an S3-compatible object store.
+func NewS3Target(options S3Options) (*S3Target, error) {
+	if options.Endpoint == "" {
+		options.Endpoint = "https://s3.amazonaws.com"
+	}
+	options.Endpoint = strings.TrimSuffix(options.Endpoint, "/")
+	if options.Region == "" {
+		options.Region = "us-east-1"
+	}
+	if options.Bucket == "" {
+		return nil, errors.New("s3 backup target: bucket is required")
+	}
+	options.Prefix = strings.Trim(options.Prefix, "/")
+	if options.AccessKeyID == "" && options.SecretAccessKey == "" {
+		options.AccessKeyID = os.Getenv("AWS_ACCESS_KEY_ID")
+		options.SecretAccessKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+		options.SessionToken = os.Getenv("AWS_SESSION_TOKEN")
+	}
+	if options.HTTPClient == nil {
+		options.HTTPClient = http.DefaultClient
+	}
+	return &S3Target{options: options, now: time.Now}, nil
+}
+
+func (target *S3Target) Put(ctx context.Context, name string, r io.Reader, _ int64) error {
+	// The payload is buffered because the request signature includes the hash of the payload.
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	res, err := target.do(ctx, http.MethodPut, target.key(name), nil, b)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return target.error(res, name)
+	}
+	return nil
+}
+
+func (target *S3Target) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	res, err := target.do(ctx, http.MethodGet, target.key(name), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		defer res.Body.Close()
+		return nil, target.error(res, name)
+	}
+	return res.Body, nil
+}
+
+func (target *S3Target) List(ctx context.Context, prefix string) ([]string, error) {
+	var names []string
+	token := ""
+	for {
+		query := url.Values{}
+		query.Set("list-type", "2")
+		query.Set("prefix", target.key(prefix))
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+
+		res, err := target.do(ctx, http.MethodGet, "", query, nil)
+		if err != nil {
+			return nil, err
+		}
+		if res.StatusCode != http.StatusOK {
+			err = target.error(res, prefix)
+			_ = res.Body.Close()
+			return nil, err
+		}
+
+		var result struct {
+			Contents []struct {
+				Key string `xml:"Key"`
+			} `xml:"Contents"`
+			IsTruncated           bool   `xml:"IsTruncated"`
+			NextContinuationToken string `xml:"NextContinuationToken"`
+		}
+		err = xml.NewDecoder(res.Body).Decode(&result)
+		_ = res.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("s3 backup target: decode list response: %v", err)
+		}
+
+		for _, object := range result.Contents {
+			names = append(names, strings.TrimPrefix(object.Key, target.key("")))
+		}
+
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			break
+		}
+		token = result.NextContinuationToken
+	}
+	slices.Sort(names)
+	return names, nil
+}
+
+// key returns the object key for the name, including the prefix.
+func (target *S3Target) key(name string) string {
+	if target.options.Prefix == "" {
+		return name
+	}
+	return target.options.Prefix + "/" + name
+}
+
+func (target *S3Target) error(res *http.Response, name string) error {
+	if res.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	body, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+	return fmt.Errorf("s3 backup target: %s %s: %s", res.Status, name, strings.TrimSpace(string(body)))
+}
+
+func (target *S3Target) do(
+	ctx context.Context,
+	method string,
+	key string,
+	query url.Values,
+	body []byte,
+) (*http.Response, error) {
+	u, err := url.Parse(target.options.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("s3 backup target: invalid endpoint: %v", err)
+	}
+	// Encode the path segments the same way they're encoded in the signature.
+	segments := []string{target.options.Bucket}
+	if key != "" {
+		segments = append(segments, strings.Split(key, "/")...)
+	}
+	p, rawPath := strings.TrimSuffix(u.Path, "/"), strings.TrimSuffix(u.EscapedPath(), "/")
+	for _, segment := range segments {
+		p += "/" + segment
+		rawPath += "/" + uriEncode(segment)
+	}
+	u.Path, u.RawPath = p, rawPath
+	u.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = int64(len(body))
+	target.sign(req, body)
+
+	return target.options.HTTPClient.Do(req)
+}
+
+// sign adds the AWS Signature Version 4 authorization headers to the request.
+func (target *S3Target) sign(req *http.Request, body []byte) {
+	now := target.now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256Hex(body)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if target.options.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", target.options.SessionToken)
+	}
+
+	headers := []string{"host", "x-amz-content-sha256", "x-amz-date"}
+	if target.options.SessionToken != "" {
+		headers = append(headers, "x-amz-security-token")
+	}
+	var canonicalHeaders strings.Builder
+	for _, h := range headers {
+		value := req.Header.Get(h)
+		if h == "host" {
+			value = req.Host
+		}
+		canonicalHeaders.WriteString(h + ":" + strings.TrimSpace(value) + "\n")
+	}
+	signedHeaders := strings.Join(headers, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := strings.Join([]string{date, target.options.Region, "s3", "aws4_request"}, "/")
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	signingKey := hmacSHA256([]byte("AWS4"+target.options.SecretAccessKey), []byte(date))
+	signingKey = hmacSHA256(signingKey, []byte(target.options.Region))
+	signingKey = hmacSHA256(signingKey, []byte("s3"))
+	signingKey = hmacSHA256(signingKey, []byte("aws4_request"))
+	signature := hex.EncodeToString(hmacSHA256(signingKey, []byte(stringToSign)))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		target.options.AccessKeyID, scope, signedHeaders, signature,
+	))
+}
+
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	var parts []string
+	for _, key := range keys {
+		values := slices.Clone(query[key])
+		slices.Sort(values)
+		for _, value := range values {
+			parts = append(parts, uriEncode(key)+"="+uriEncode(value))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// uriEncode encodes the string as required by Signature Version 4. Only unreserved characters are left as is.
+func uriEncode(s string) string {
+	var b strings.Builder
+	for _, c := range []byte(s) {
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+			continue
+		}
+		b.WriteString(fmt.Sprintf("%%%02X", c))
+	}
+	return b.String()
+}
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
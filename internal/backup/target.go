@@ -0,0 +1,154 @@
+// Copyright 2024 Kelvin Clement Mwinuka
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// ErrNotFound is returned by a Target when the requested object does not exist.
+var ErrNotFound = errors.New("backup object not found")
+
+// Target is a location that backups are uploaded to and restored from.
+// Objects are identified by slash separated names, e.g. "snapshots/1718021112000/state.bin".
+type Target interface {
+	// Put uploads the object with the given name, replacing any existing object with the same name.
+	Put(ctx context.Context, name string, r io.Reader, size int64) error
+	// Get returns the contents of the object with the given name.
+	// Returns ErrNotFound if the object does not exist.
+	Get(ctx context.Context, name string) (io.ReadCloser, error)
+	// List returns the names of the objects that start with the given prefix, in lexical order.
+	List(ctx context.Context, prefix string) ([]string, error)
+}
+
+// FileTarget stores backups in a directory on the filesystem, e.g. a mounted network volume.
+type FileTarget struct {
+	directory string
+}
+
+// NewFileTarget returns a target that stores backups in the given directory.
+func NewFileTarget(directory string) *FileTarget {
+	return &FileTarget{directory: directory}
+}
+
+func (target *FileTarget) Put(_ context.Context, name string, r io.Reader, _ int64) error {
+	p := filepath.Join(target.directory, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(p), os.ModePerm); err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so that a partially written object is never visible.
+	f, err := os.CreateTemp(filepath.Dir(p), "."+filepath.Base(p)+".*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = os.Remove(f.Name())
+	}()
+
+	if _, err = io.Copy(f, r); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), p)
+}
+
+func (target *FileTarget) Get(_ context.Context, name string) (io.ReadCloser, error) {
+	f, err := os.Open(filepath.Join(target.directory, filepath.FromSlash(name)))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	return f, err
+}
+
+func (target *FileTarget) List(_ context.Context, prefix string) ([]string, error) {
+	var names []string
+	err := filepath.WalkDir(target.directory, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), ".") {
+			return nil
+		}
+		rel, err := filepath.Rel(target.directory, p)
+		if err != nil {
+			return err
+		}
+		if name := filepath.ToSlash(rel); strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	slices.Sort(names)
+	return names, nil
+}
+
+// ParseTarget creates a target from a URL. The supported schemes are:
+//
+//	file:///path/to/directory
+//	s3://bucket/optional/prefix
+//
+// The options are only used for S3 targets.
+func ParseTarget(rawURL string, options S3Options) (Target, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid backup target %q: %v", rawURL, err)
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "file", "":
+		directory := u.Path
+		if u.Host != "" {
+			// Relative paths, e.g. file://backups/sugardb
+			directory = path.Join(u.Host, u.Path)
+		}
+		if directory == "" {
+			return nil, fmt.Errorf("invalid backup target %q: directory is required", rawURL)
+		}
+		return NewFileTarget(directory), nil
+	case "s3":
+		if u.Host == "" {
+			return nil, fmt.Errorf("invalid backup target %q: bucket is required", rawURL)
+		}
+		options.Bucket = u.Host
+		options.Prefix = strings.Trim(u.Path, "/")
+		return NewS3Target(options)
+	default:
+		return nil, fmt.Errorf("invalid backup target %q: unsupported scheme %q", rawURL, u.Scheme)
+	}
+}
@@ -22,48 +22,125 @@ import (
 	"github.com/echovault/sugardb/internal"
 	"github.com/echovault/sugardb/internal/constants"
 	"log"
+	"maps"
 	"os"
 	"path"
 	"slices"
+	"strconv"
 	"strings"
 	"time"
 
 	"gopkg.in/yaml.v3"
 )
 
+// SaveRule triggers a snapshot when at least Changes writes have been made
+// within Seconds seconds since the last snapshot.
+type SaveRule struct {
+	Seconds uint64 `json:"Seconds" yaml:"Seconds"`
+	Changes uint64 `json:"Changes" yaml:"Changes"`
+}
+
 type Config struct {
-	TLS               bool          `json:"TLS" yaml:"TLS"`
-	MTLS              bool          `json:"MTLS" yaml:"MTLS"`
-	CertKeyPairs      [][]string    `json:"CertKeyPairs" yaml:"CertKeyPairs"`
-	ClientCAs         []string      `json:"ClientCAs" yaml:"ClientCAs"`
-	Port              uint16        `json:"Port" yaml:"Port"`
-	ServerID          string        `json:"ServerId" yaml:"ServerId"`
-	JoinAddr          string        `json:"JoinAddr" yaml:"JoinAddr"`
-	BindAddr          string        `json:"BindAddr" yaml:"BindAddr"`
-	DataDir           string        `json:"DataDir" yaml:"DataDir"`
-	BootstrapCluster  bool          `json:"BootstrapCluster" yaml:"BootstrapCluster"`
-	AclConfig         string        `json:"AclConfig" yaml:"AclConfig"`
-	ForwardCommand    bool          `json:"ForwardCommand" yaml:"ForwardCommand"`
-	RequirePass       bool          `json:"RequirePass" yaml:"RequirePass"`
-	Password          string        `json:"Password" yaml:"Password"`
-	SnapShotThreshold uint64        `json:"SnapshotThreshold" yaml:"SnapshotThreshold"`
-	SnapshotInterval  time.Duration `json:"SnapshotInterval" yaml:"SnapshotInterval"`
-	RestoreSnapshot   bool          `json:"RestoreSnapshot" yaml:"RestoreSnapshot"`
-	RestoreAOF        bool          `json:"RestoreAOF" yaml:"RestoreAOF"`
-	AOFSyncStrategy   string        `json:"AOFSyncStrategy" yaml:"AOFSyncStrategy"`
-	MaxMemory         uint64        `json:"MaxMemory" yaml:"MaxMemory"`
-	EvictionPolicy    string        `json:"EvictionPolicy" yaml:"EvictionPolicy"`
-	EvictionSample    uint          `json:"EvictionSample" yaml:"EvictionSample"`
-	EvictionInterval  time.Duration `json:"EvictionInterval" yaml:"EvictionInterval"`
-	Modules           []string      `json:"Plugins" yaml:"Plugins"`
-	DiscoveryPort     uint16        `json:"DiscoveryPort" yaml:"DiscoveryPort"`
-	RaftBindAddr      string
-	RaftBindPort      uint16
+	TLS                     bool          `json:"TLS" yaml:"TLS"`
+	MTLS                    bool          `json:"MTLS" yaml:"MTLS"`
+	CertKeyPairs            [][]string    `json:"CertKeyPairs" yaml:"CertKeyPairs"`
+	ClientCAs               []string      `json:"ClientCAs" yaml:"ClientCAs"`
+	Port                    uint16        `json:"Port" yaml:"Port"`
+	ServerID                string        `json:"ServerId" yaml:"ServerId"`
+	JoinAddr                string        `json:"JoinAddr" yaml:"JoinAddr"`
+	BindAddr                string        `json:"BindAddr" yaml:"BindAddr"`
+	DataDir                 string        `json:"DataDir" yaml:"DataDir"`
+	BootstrapCluster        bool          `json:"BootstrapCluster" yaml:"BootstrapCluster"`
+	Replica                 bool          `json:"Replica" yaml:"Replica"`
+	ReplicaOf               string        `json:"ReplicaOf" yaml:"ReplicaOf"`
+	MasterUser              string        `json:"MasterUser" yaml:"MasterUser"`
+	MasterAuth              string        `json:"MasterAuth" yaml:"MasterAuth"`
+	ReplBacklogSize         uint64        `json:"ReplBacklogSize" yaml:"ReplBacklogSize"`
+	AclConfig               string        `json:"AclConfig" yaml:"AclConfig"`
+	AclLogMaxLen            uint          `json:"AclLogMaxLen" yaml:"AclLogMaxLen"`
+	AclPasswordHash         string        `json:"AclPasswordHash" yaml:"AclPasswordHash"`
+	AclBcryptCost           int           `json:"AclBcryptCost" yaml:"AclBcryptCost"`
+	AclArgon2Time           uint32        `json:"AclArgon2Time" yaml:"AclArgon2Time"`
+	AclArgon2Memory         uint32        `json:"AclArgon2Memory" yaml:"AclArgon2Memory"`
+	AclArgon2Threads        uint8         `json:"AclArgon2Threads" yaml:"AclArgon2Threads"`
+	AclCertUserField        string        `json:"AclCertUserField" yaml:"AclCertUserField"`
+	AclCertUserOID          string        `json:"AclCertUserOID" yaml:"AclCertUserOID"`
+	AclCertNoPassword       bool          `json:"AclCertNoPassword" yaml:"AclCertNoPassword"`
+	AclJWTKeyFiles          []string      `json:"AclJWTKeyFiles" yaml:"AclJWTKeyFiles"`
+	AclJWKSFile             string        `json:"AclJWKSFile" yaml:"AclJWKSFile"`
+	AclJWTUsernameClaim     string        `json:"AclJWTUsernameClaim" yaml:"AclJWTUsernameClaim"`
+	AclJWTPermissionsClaim  string        `json:"AclJWTPermissionsClaim" yaml:"AclJWTPermissionsClaim"`
+	AclJWTIssuer            string        `json:"AclJWTIssuer" yaml:"AclJWTIssuer"`
+	AclJWTAudience          string        `json:"AclJWTAudience" yaml:"AclJWTAudience"`
+	AclJWTExpiryAction      string        `json:"AclJWTExpiryAction" yaml:"AclJWTExpiryAction"`
+	AuditLog                string        `json:"AuditLog" yaml:"AuditLog"`
+	AuditLogCategories      []string      `json:"AuditLogCategories" yaml:"AuditLogCategories"`
+	AuditLogCommands        []string      `json:"AuditLogCommands" yaml:"AuditLogCommands"`
+	AuditLogExcludeCommands []string      `json:"AuditLogExcludeCommands" yaml:"AuditLogExcludeCommands"`
+	AuditLogMaxSize         uint64        `json:"AuditLogMaxSize" yaml:"AuditLogMaxSize"`
+	AuditLogMaxFiles        uint          `json:"AuditLogMaxFiles" yaml:"AuditLogMaxFiles"`
+	ForwardCommand          bool          `json:"ForwardCommand" yaml:"ForwardCommand"`
+	ForwardPort             uint16        `json:"ForwardPort" yaml:"ForwardPort"`
+	ForwardTimeout          time.Duration `json:"ForwardTimeout" yaml:"ForwardTimeout"`
+	FailureGracePeriod      time.Duration `json:"FailureGracePeriod" yaml:"FailureGracePeriod"`
+	ReadConsistency         string        `json:"ReadConsistency" yaml:"ReadConsistency"`
+	ShardID                 string        `json:"ShardID" yaml:"ShardID"`
+	ShardSlots              string        `json:"ShardSlots" yaml:"ShardSlots"`
+	RequirePass             bool          `json:"RequirePass" yaml:"RequirePass"`
+	Password                string        `json:"Password" yaml:"Password"`
+	SnapShotThreshold       uint64        `json:"SnapshotThreshold" yaml:"SnapshotThreshold"`
+	SnapshotInterval        time.Duration `json:"SnapshotInterval" yaml:"SnapshotInterval"`
+	RestoreSnapshot         bool          `json:"RestoreSnapshot" yaml:"RestoreSnapshot"`
+	SaveRules               []SaveRule    `json:"SaveRules" yaml:"SaveRules"`
+	SnapshotRetainLast      uint          `json:"SnapshotRetainLast" yaml:"SnapshotRetainLast"`
+	SnapshotRetainHourly    uint          `json:"SnapshotRetainHourly" yaml:"SnapshotRetainHourly"`
+	SnapshotRetainDaily     uint          `json:"SnapshotRetainDaily" yaml:"SnapshotRetainDaily"`
+	StopWritesOnBGSaveError bool          `json:"StopWritesOnBGSaveError" yaml:"StopWritesOnBGSaveError"`
+	EncryptionKeyFile       string        `json:"EncryptionKeyFile" yaml:"EncryptionKeyFile"`
+	EncryptionKeyEnv        string        `json:"EncryptionKeyEnv" yaml:"EncryptionKeyEnv"`
+	BackupTarget            string        `json:"BackupTarget" yaml:"BackupTarget"`
+	BackupS3Endpoint        string        `json:"BackupS3Endpoint" yaml:"BackupS3Endpoint"`
+	BackupS3Region          string        `json:"BackupS3Region" yaml:"BackupS3Region"`
+	BackupInterval          time.Duration `json:"BackupInterval" yaml:"BackupInterval"`
+	RestoreBackup           bool          `json:"RestoreBackup" yaml:"RestoreBackup"`
+	RestoreAOF              bool          `json:"RestoreAOF" yaml:"RestoreAOF"`
+	AOFSyncStrategy         string        `json:"AOFSyncStrategy" yaml:"AOFSyncStrategy"`
+	MaxMemory               uint64        `json:"MaxMemory" yaml:"MaxMemory"`
+	EvictionPolicy          string        `json:"EvictionPolicy" yaml:"EvictionPolicy"`
+	EvictionSample          uint          `json:"EvictionSample" yaml:"EvictionSample"`
+	EvictionInterval        time.Duration `json:"EvictionInterval" yaml:"EvictionInterval"`
+	Modules                 []string      `json:"Plugins" yaml:"Plugins"`
+	DiscoveryPort           uint16        `json:"DiscoveryPort" yaml:"DiscoveryPort"`
+	ConfigFile              string        `json:"-" yaml:"-"`
+	ConfigReloadInterval    time.Duration `json:"ConfigReloadInterval" yaml:"ConfigReloadInterval"`
+	RaftBindAddr            string
+	RaftBindPort            uint16
+
+	// The commands renamed, by their original name, and disabled when the command table is built.
+	RenameCommands  map[string]string `json:"RenameCommands" yaml:"RenameCommands"`
+	DisableCommands []string          `json:"DisableCommands" yaml:"DisableCommands"`
+
+	// The limits of the TCP client connections.
+	MaxClients      uint          `json:"MaxClients" yaml:"MaxClients"`
+	MaxClientsPerIP uint          `json:"MaxClientsPerIP" yaml:"MaxClientsPerIP"`
+	Timeout         time.Duration `json:"Timeout" yaml:"Timeout"`
+	TCPKeepAlive    time.Duration `json:"TCPKeepAlive" yaml:"TCPKeepAlive"`
+	ProtectedMode   bool          `json:"ProtectedMode" yaml:"ProtectedMode"`
+
+	// The secret shared by the nodes of the cluster to authenticate the requests between nodes.
+	ClusterSecret string `json:"ClusterSecret" yaml:"ClusterSecret"`
+
+	// The directory that SNAPSHOT EXPORT writes to. Defaults to the export directory in the data directory.
+	SnapshotExportDir string `json:"SnapshotExportDir" yaml:"SnapshotExportDir"`
+
+	// Whether the persistence files that are not encrypted are read when encryption keys are configured.
+	EncryptionPlaintext bool `json:"EncryptionPlaintext" yaml:"EncryptionPlaintext"`
 }
 
 func GetConfig() (Config, error) {
 	var certKeyPairs [][]string
 	var clientCAs []string
+	var aclJWTKeyFiles []string
 
 	flag.Func("cert-key-pair",
 		"A pair of file paths representing the signed certificate and it's corresponding key separated by a comma.",
@@ -84,6 +161,26 @@ func GetConfig() (Config, error) {
 		return nil
 	})
 
+	flag.Func("acl-jwt-key-file", `Path to a key used to verify the JWTs passed to AUTH. The file is either a PEM encoded
+RSA or Ed25519 public key, or the secret of HS256 tokens. The file name without its extension is the key id.`,
+		func(s string) error {
+			aclJWTKeyFiles = append(aclJWTKeyFiles, s)
+			return nil
+		})
+
+	aclJWTExpiryAction := "reauth"
+	flag.Func("acl-jwt-expiry-action", `What happens to a connection authenticated with a JWT when the token expires.
+The options are 'reauth' to require the client to authenticate again, and 'disconnect' to close the connection.`,
+		func(option string) error {
+			if !slices.ContainsFunc([]string{"reauth", "disconnect"}, func(s string) bool {
+				return strings.EqualFold(s, option)
+			}) {
+				return errors.New("aclJWTExpiryAction must be 'reauth' or 'disconnect'")
+			}
+			aclJWTExpiryAction = strings.ToLower(option)
+			return nil
+		})
+
 	aofSyncStrategy := "everysec"
 	flag.Func("aof-sync-strategy", `How often to flush the file contents written to append only file.
 The options are 'always' for syncing on each command, 'everysec' to sync every second, and 'no' to leave it up to the os.`,
@@ -97,6 +194,25 @@ The options are 'always' for syncing on each command, 'everysec' to sync every s
 			return nil
 		})
 
+	readConsistency := constants.ReadConsistencyStale
+	flag.Func("read-consistency", `The default consistency of the reads served by a node in cluster mode.
+The options are 'stale' to read the local state, 'lease' to read after catching up with the leader's applied state,
+and 'linearizable' to read after the leader confirms its leadership with the quorum.
+Clients can change it for their connection with the READCONSISTENCY command.`,
+		func(option string) error {
+			if !slices.ContainsFunc([]string{
+				constants.ReadConsistencyStale,
+				constants.ReadConsistencyLease,
+				constants.ReadConsistencyLinearizable,
+			}, func(s string) bool {
+				return strings.EqualFold(s, option)
+			}) {
+				return errors.New("readConsistency must be 'stale', 'lease' or 'linearizable'")
+			}
+			readConsistency = strings.ToLower(option)
+			return nil
+		})
+
 	var maxMemory uint64 = 0
 	flag.Func("max-memory", `Upper memory limit before triggering eviction. 
 Supported units (kb, mb, gb, tb, pb). When 0 is passed, there will be no memory limit.
@@ -132,6 +248,56 @@ There is no limit by default.`, func(memory string) error {
 			return nil
 		})
 
+	var saveRules []SaveRule
+	flag.Func("save", `A snapshot save rule in the format "<seconds> <changes>".
+A snapshot is taken when at least <changes> writes have been made and <seconds> have passed since the last snapshot.
+This flag can be passed multiple times, a snapshot is taken when any of the rules match.
+When provided, the save rules take precedence over snapshot-interval and snapshot-threshold.`,
+		func(s string) error {
+			rule, err := ParseSaveRule(s)
+			if err != nil {
+				return err
+			}
+			saveRules = append(saveRules, rule)
+			return nil
+		})
+
+	var auditLogMaxSize uint64 = 100 * 1024 * 1024
+	flag.Func("audit-log-max-size", `The size above which the audit log file is rotated.
+Supported units (kb, mb, gb, tb, pb). When 0 is passed, the file is never rotated. Default is 100mb.`,
+		func(size string) error {
+			b, err := internal.ParseMemory(size)
+			if err != nil {
+				return err
+			}
+			auditLogMaxSize = b
+			return nil
+		})
+
+	renameCommands := make(map[string]string)
+	flag.Func(
+		"rename-command",
+		`Rename a command, in the format <command>=<new-name> (e.g. flushall=my-secret-flushall).
+A subcommand is renamed with <command>|<subcommand>=<new-name>. This flag can be specified multiple times.`,
+		func(rename string) error {
+			command, name, ok := strings.Cut(rename, "=")
+			if !ok {
+				return fmt.Errorf("\"%s\" must be in the format <command>=<new-name>", rename)
+			}
+			renameCommands[strings.TrimSpace(command)] = strings.TrimSpace(name)
+			return nil
+		})
+
+	var disableCommands []string
+	flag.Func(
+		"disable-command",
+		`Disable a command (e.g. flushall), or a subcommand with <command>|<subcommand> (e.g. module|load).
+This flag can be specified multiple times.`,
+		func(command string) error {
+			disableCommands = append(disableCommands, strings.TrimSpace(command))
+			return nil
+		})
+
 	var modules []string
 	flag.Func(
 		"loadmodule",
@@ -144,6 +310,28 @@ There is no limit by default.`, func(memory string) error {
 			return nil
 		})
 
+	maxClients := flag.Uint("maxclients", 10000, "The maximum number of connected clients. 0 is unlimited. Default is 10000.")
+	maxClientsPerIP := flag.Uint(
+		"maxclients-per-ip",
+		0,
+		"The maximum number of connected clients from the same IP address. 0 is unlimited. Default is 0.",
+	)
+	timeout := flag.Duration(
+		"timeout",
+		0,
+		"Close the connection of a client after it's idle for this duration. 0 disables the timeout. Default is 0.",
+	)
+	tcpKeepAlive := flag.Duration(
+		"tcp-keepalive",
+		300*time.Second,
+		"The period of the TCP keepalives sent to the clients. 0 disables the keepalives. Default is 300s.",
+	)
+	protectedMode := flag.Bool(
+		"protected-mode",
+		true,
+		`Only accept connections from the loopback interface when no authentication is configured,
+i.e. require-pass and mtls are disabled. Default is true.`,
+	)
 	tls := flag.Bool("tls", false, "Start the echovault in TLS mode. Default is false.")
 	mtls := flag.Bool("mtls", false, "Use mTLS to verify the client.")
 	port := flag.Int("port", 7480, "Port to use. Default is 7480")
@@ -153,10 +341,175 @@ There is no limit by default.`, func(memory string) error {
 	discoveryPort := flag.Uint("discovery-port", 7946, "Port to use for memberlist cluster discovery.")
 	dataDir := flag.String("data-dir", ".", "Directory to store snapshots and logs.")
 	bootstrapCluster := flag.Bool("bootstrap-cluster", false, "Whether this instance should bootstrap a new cluster.")
+	replica := flag.Bool(
+		"replica",
+		false,
+		`Join the raft group of the shard as a non-voting replica. Replicas receive the writes of the shard and serve reads,
+but they don't count towards the quorum, never become the leader and reject write commands. Default is false.`,
+	)
+	replicaOf := flag.String(
+		"replica-of",
+		"",
+		`The address of the primary to replicate from in the format <host>:<port>. Only works in standalone mode.
+The instance loads a copy of the primary's dataset, applies the primary's writes as they happen and rejects write commands.`,
+	)
+	masterUser := flag.String("master-user", "", "The username to authenticate with the primary when replicating.")
+	masterAuth := flag.String("master-auth", "", "The password to authenticate with the primary when replicating.")
+	replBacklogSize := flag.Uint64(
+		"repl-backlog-size",
+		1024*1024,
+		`The number of bytes of the replication stream kept by a primary, so that replicas that reconnect after a
+short disconnection only receive the writes they missed. Default is 1MB.`,
+	)
 	aclConfig := flag.String("acl-config", "", "ACL config file path.")
+	aclLogMaxLen := flag.Uint(
+		"acl-log-max-len",
+		128,
+		"The maximum number of entries kept in the ACL log of denied commands and authentications. Default is 128.",
+	)
+	aclPasswordHash := flag.String(
+		"acl-password-hash",
+		"",
+		`The algorithm used to hash the plain text passwords of ACL users, either "bcrypt" or "argon2id".
+Passwords stored with another algorithm are rehashed when their user authenticates.
+Passwords are stored as they're provided when empty. Default is empty.`,
+	)
+	aclBcryptCost := flag.Int("acl-bcrypt-cost", 10, "The cost of the bcrypt password hashes. Default is 10.")
+	aclArgon2Time := flag.Uint("acl-argon2-time", 1, "The number of passes of the argon2id password hashes. Default is 1.")
+	aclArgon2Memory := flag.Uint(
+		"acl-argon2-memory",
+		64*1024,
+		"The memory in KiB used by the argon2id password hashes. Default is 65536 (64MiB).",
+	)
+	aclArgon2Threads := flag.Uint("acl-argon2-threads", 4, "The number of threads used by the argon2id password hashes. Default is 4.")
+	aclCertUserField := flag.String(
+		"acl-cert-user-field",
+		"",
+		`The field of mTLS client certificates that holds the ACL username of the connection.
+The options are "cn" for the subject common name, "san-uri" and "san-dns" for the subject alternative names,
+and "oid" for the subject attribute configured with acl-cert-user-oid.
+Connections start as the default user when empty. Default is empty.`,
+	)
+	aclCertUserOID := flag.String(
+		"acl-cert-user-oid",
+		"",
+		`The object identifier of the client certificate subject attribute that holds the ACL username,
+e.g. "0.9.2342.19200300.100.1.1" for the UID. Only used when acl-cert-user-field is "oid".`,
+	)
+	aclCertNoPassword := flag.Bool(
+		"acl-cert-no-password",
+		false,
+		"Whether connections mapped to a user by their client certificate are authenticated without a password.",
+	)
+	aclJWKSFile := flag.String("acl-jwks-file", "", "Path to a JSON Web Key Set file with the keys used to verify the JWTs passed to AUTH.")
+	aclJWTUsernameClaim := flag.String("acl-jwt-username-claim", "sub", "The JWT claim that holds the ACL username. Default is sub.")
+	aclJWTPermissionsClaim := flag.String(
+		"acl-jwt-permissions-claim",
+		"",
+		`The JWT claim that holds the ACL rules of the connection, as a space separated string or a list of rules.
+When a token has the claim, the connection's permissions are the rules instead of the permissions of an existing user.`,
+	)
+	aclJWTIssuer := flag.String("acl-jwt-issuer", "", "The required issuer of JWTs. The issuer is not checked when empty.")
+	aclJWTAudience := flag.String("acl-jwt-audience", "", "The required audience of JWTs. The audience is not checked when empty.")
+	auditLog := flag.String(
+		"audit-log",
+		"",
+		`Path to the audit log file. The audited commands are appended to the file as JSON lines.
+The audit log is disabled when empty. Default is empty.`,
+	)
+	auditLogCategories := flag.String(
+		"audit-log-categories",
+		"admin,dangerous",
+		"Comma separated list of the command categories that are audited. Default is admin,dangerous.",
+	)
+	auditLogCommands := flag.String(
+		"audit-log-commands",
+		"",
+		`Comma separated list of commands that are audited in addition to the audited categories,
+e.g. "keys,config|set". Default is empty.`,
+	)
+	auditLogExcludeCommands := flag.String(
+		"audit-log-exclude-commands",
+		"",
+		"Comma separated list of commands that are not audited, even when they're in an audited category. Default is empty.",
+	)
+	auditLogMaxFiles := flag.Uint(
+		"audit-log-max-files",
+		5,
+		"The number of rotated audit log files that are kept. Default is 5.",
+	)
 	snapshotThreshold := flag.Uint64("snapshot-threshold", 1000, "The number of entries that trigger a snapshot. Default is 1000.")
 	snapshotInterval := flag.Duration("snapshot-interval", 5*time.Minute, "The time interval between snapshots (in seconds). Default is 5 minutes.")
 	restoreSnapshot := flag.Bool("restore-snapshot", false, "This flag prompts the echovault to restore state from snapshot when set to true. Only works in standalone mode. Higher priority than restoreAOF.")
+	snapshotRetainLast := flag.Uint(
+		"snapshot-retain-last",
+		0,
+		"The number of most recent snapshots to keep. When all the snapshot retention flags are 0, all snapshots are kept. Default is 0.",
+	)
+	snapshotRetainHourly := flag.Uint(
+		"snapshot-retain-hourly",
+		0,
+		"Keep the most recent snapshot of each of this number of most recent hours. Default is 0.",
+	)
+	snapshotRetainDaily := flag.Uint(
+		"snapshot-retain-daily",
+		0,
+		"Keep the most recent snapshot of each of this number of most recent days. Default is 0.",
+	)
+	snapshotExportDir := flag.String(
+		"snapshot-export-dir",
+		"",
+		`The directory that SNAPSHOT EXPORT writes the exported databases to. The paths passed to SNAPSHOT EXPORT must be
+inside this directory. Default is the export directory in the data directory.`,
+	)
+	stopWritesOnBGSaveError := flag.Bool(
+		"stop-writes-on-bgsave-error",
+		true,
+		"Reject write commands when the latest snapshot failed, until a snapshot succeeds. Only works in standalone mode. Default is true.",
+	)
+	encryptionKeyFile := flag.String(
+		"encryption-key-file",
+		"",
+		`Path to a file containing the keys used to encrypt snapshots, AOF and raft data at rest.
+The file contains one hex or base64 encoded 16, 24 or 32 byte AES key per line. The first key encrypts new data,
+the other keys are only used to decrypt data encrypted with previous keys.`,
+	)
+	encryptionKeyEnv := flag.String(
+		"encryption-key-env",
+		"",
+		`The name of an environment variable containing comma separated encryption keys in the same format as encryption-key-file.
+The keys from the file come before the keys from the environment variable.`,
+	)
+	encryptionPlaintext := flag.Bool(
+		"encryption-plaintext",
+		false,
+		`Read the snapshots, AOF and raft data that are not encrypted when encryption keys are configured.
+Use it to migrate the data written before encryption was enabled. Default is false.`,
+	)
+	backupTarget := flag.String(
+		"backup-target",
+		"",
+		`The location that snapshots and AOF segments are uploaded to. Only works in standalone mode.
+Supported targets are a directory (file:///path/to/directory) and an S3-compatible object store (s3://bucket/prefix).
+S3 credentials are read from the AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN environment variables.`,
+	)
+	backupS3Endpoint := flag.String(
+		"backup-s3-endpoint",
+		"https://s3.amazonaws.com",
+		"The endpoint of the S3-compatible object store used as the backup target. Default is https://s3.amazonaws.com.",
+	)
+	backupS3Region := flag.String("backup-s3-region", "us-east-1", "The region of the S3 backup target. Default is us-east-1.")
+	backupInterval := flag.Duration(
+		"backup-interval",
+		5*time.Minute,
+		"The interval between uploads to the backup target. Setting this to 0 disables scheduled uploads. Default is 5 minutes.",
+	)
+	restoreBackup := flag.Bool(
+		"restore-backup",
+		false,
+		`Download the latest snapshot and AOF segment from the backup target at startup, if there are no newer local files.
+Use it together with restore-snapshot or restore-aof. Only works in standalone mode.`,
+	)
 	restoreAOF := flag.Bool("restore-aof", false, "This flag prompts the echovault to restore state from append-only logs. Only works in standalone mode. Lower priority than restoreSnapshot.")
 	evictionSample := flag.Uint("eviction-sample", 20, "An integer specifying the number of keys to sample when checking for expired keys.")
 	evictionInterval := flag.Duration("eviction-interval", 100*time.Millisecond, "The interval between each sampling of keys to evict.")
@@ -164,6 +517,43 @@ There is no limit by default.`, func(memory string) error {
 		"forward-commands",
 		false,
 		"If the node is a follower, this flag forwards mutation command to the leader when set to true")
+	forwardPort := flag.Uint(
+		"forward-port",
+		0,
+		"Port that the node listens on for write commands forwarded by followers. A free port is picked when 0. Default is 0.",
+	)
+	forwardTimeout := flag.Duration(
+		"forward-timeout",
+		5*time.Second,
+		`The upper limit of the time a follower waits for a forwarded command to be applied by the leader,
+including retries when the leader changes. Default is 5 seconds.`,
+	)
+	clusterSecret := flag.String(
+		"cluster-secret",
+		"",
+		`The secret shared by the nodes of the cluster. The nodes use it to authenticate the commands and the
+membership changes they send each other through the forward port. Required in cluster mode.`,
+	)
+	failureGracePeriod := flag.Duration(
+		"failure-grace-period",
+		time.Minute,
+		`The time that a member of the shard that stopped responding has to come back before the leader removes it from
+the raft configuration. Members that leave gracefully are removed right away. Failed members are never removed
+automatically when 0. Default is 1 minute.`,
+	)
+	shardId := flag.String(
+		"shard-id",
+		"0",
+		`The id of the shard the node belongs to in cluster mode. Each shard is a separate raft group that serves
+a set of hash slots. Nodes only join the raft group of the nodes with the same shard id. Default is 0.`,
+	)
+	shardSlots := flag.String(
+		"shard-slots",
+		"0-16383",
+		`The hash slots that the shard serves when it's bootstrapped, e.g. "0-8191" or "0-100,200-300".
+Only used by the node that bootstraps the shard, and only if the shard has no slots yet. Default is 0-16383.
+Leave empty to start a shard without slots, e.g. to add it to the cluster and move slots to it with CLUSTER REBALANCE.`,
+	)
 	requirePass := flag.Bool(
 		"require-pass",
 		false,
@@ -173,7 +563,7 @@ There is no limit by default.`, func(memory string) error {
 		"password",
 		"",
 		`The password for the default user. ACL config file will overwrite this value. 
-It is a plain text value by default but you can provide a SHA256 hash by adding a '#' before the hash.`,
+It is a plain text value by default but you can provide a SHA256, bcrypt or argon2id hash by adding a '#' before the hash.`,
 	)
 
 	config := flag.String(
@@ -181,6 +571,12 @@ It is a plain text value by default but you can provide a SHA256 hash by adding
 		"",
 		`File path to a JSON or YAML config file.The values in this config file will override the flag values.`,
 	)
+	configReloadInterval := flag.Duration(
+		"config-reload-interval",
+		5*time.Second,
+		`The interval between each check of the config file, ACL file and TLS certificates for changes.
+Changed files are reloaded without a restart. 0 disables watching, the files are then only reloaded on SIGHUP.`,
+	)
 
 	flag.Parse()
 
@@ -192,64 +588,163 @@ It is a plain text value by default but you can provide a SHA256 hash by adding
 	if e != nil {
 		return Config{}, e
 	}
+	if *forwardPort == 0 {
+		p, e := internal.GetFreePort()
+		if e != nil {
+			return Config{}, e
+		}
+		*forwardPort = uint(p)
+	}
 
 	conf := Config{
-		CertKeyPairs:      certKeyPairs,
-		ClientCAs:         clientCAs,
-		TLS:               *tls,
-		MTLS:              *mtls,
-		Port:              uint16(*port),
-		ServerID:          *serverId,
-		JoinAddr:          *joinAddr,
-		BindAddr:          *bindAddr,
-		DataDir:           *dataDir,
-		BootstrapCluster:  *bootstrapCluster,
-		AclConfig:         *aclConfig,
-		ForwardCommand:    *forwardCommand,
-		RequirePass:       *requirePass,
-		Password:          *password,
-		SnapShotThreshold: *snapshotThreshold,
-		SnapshotInterval:  *snapshotInterval,
-		RestoreSnapshot:   *restoreSnapshot,
-		RestoreAOF:        *restoreAOF,
-		AOFSyncStrategy:   aofSyncStrategy,
-		MaxMemory:         maxMemory,
-		EvictionPolicy:    evictionPolicy,
-		EvictionSample:    *evictionSample,
-		EvictionInterval:  *evictionInterval,
-		Modules:           modules,
-		DiscoveryPort:     uint16(*discoveryPort),
-		RaftBindAddr:      raftBindAddr,
-		RaftBindPort:      uint16(raftBindPort),
+		CertKeyPairs:            certKeyPairs,
+		ClientCAs:               clientCAs,
+		TLS:                     *tls,
+		MTLS:                    *mtls,
+		Port:                    uint16(*port),
+		ServerID:                *serverId,
+		JoinAddr:                *joinAddr,
+		BindAddr:                *bindAddr,
+		DataDir:                 *dataDir,
+		BootstrapCluster:        *bootstrapCluster,
+		Replica:                 *replica,
+		ReplicaOf:               *replicaOf,
+		MasterUser:              *masterUser,
+		MasterAuth:              *masterAuth,
+		ReplBacklogSize:         *replBacklogSize,
+		AclConfig:               *aclConfig,
+		AclLogMaxLen:            *aclLogMaxLen,
+		AclPasswordHash:         *aclPasswordHash,
+		AclBcryptCost:           *aclBcryptCost,
+		AclArgon2Time:           uint32(*aclArgon2Time),
+		AclArgon2Memory:         uint32(*aclArgon2Memory),
+		AclArgon2Threads:        uint8(*aclArgon2Threads),
+		AclCertUserField:        *aclCertUserField,
+		AclCertUserOID:          *aclCertUserOID,
+		AclCertNoPassword:       *aclCertNoPassword,
+		AclJWTKeyFiles:          aclJWTKeyFiles,
+		AclJWKSFile:             *aclJWKSFile,
+		AclJWTUsernameClaim:     *aclJWTUsernameClaim,
+		AclJWTPermissionsClaim:  *aclJWTPermissionsClaim,
+		AclJWTIssuer:            *aclJWTIssuer,
+		AclJWTAudience:          *aclJWTAudience,
+		AclJWTExpiryAction:      aclJWTExpiryAction,
+		AuditLog:                *auditLog,
+		AuditLogCategories:      splitList(*auditLogCategories),
+		AuditLogCommands:        splitList(*auditLogCommands),
+		AuditLogExcludeCommands: splitList(*auditLogExcludeCommands),
+		AuditLogMaxSize:         auditLogMaxSize,
+		AuditLogMaxFiles:        *auditLogMaxFiles,
+		RenameCommands:          renameCommands,
+		DisableCommands:         disableCommands,
+		MaxClients:              *maxClients,
+		MaxClientsPerIP:         *maxClientsPerIP,
+		Timeout:                 *timeout,
+		TCPKeepAlive:            *tcpKeepAlive,
+		ProtectedMode:           *protectedMode,
+		ForwardCommand:          *forwardCommand,
+		ForwardPort:             uint16(*forwardPort),
+		ForwardTimeout:          *forwardTimeout,
+		ClusterSecret:           *clusterSecret,
+		FailureGracePeriod:      *failureGracePeriod,
+		ReadConsistency:         readConsistency,
+		ShardID:                 *shardId,
+		ShardSlots:              *shardSlots,
+		RequirePass:             *requirePass,
+		Password:                *password,
+		SnapShotThreshold:       *snapshotThreshold,
+		SnapshotInterval:        *snapshotInterval,
+		RestoreSnapshot:         *restoreSnapshot,
+		SaveRules:               saveRules,
+		SnapshotRetainLast:      *snapshotRetainLast,
+		SnapshotRetainHourly:    *snapshotRetainHourly,
+		SnapshotRetainDaily:     *snapshotRetainDaily,
+		SnapshotExportDir:       *snapshotExportDir,
+		StopWritesOnBGSaveError: *stopWritesOnBGSaveError,
+		EncryptionKeyFile:       *encryptionKeyFile,
+		EncryptionKeyEnv:        *encryptionKeyEnv,
+		EncryptionPlaintext:     *encryptionPlaintext,
+		BackupTarget:            *backupTarget,
+		BackupS3Endpoint:        *backupS3Endpoint,
+		BackupS3Region:          *backupS3Region,
+		BackupInterval:          *backupInterval,
+		RestoreBackup:           *restoreBackup,
+		RestoreAOF:              *restoreAOF,
+		AOFSyncStrategy:         aofSyncStrategy,
+		MaxMemory:               maxMemory,
+		EvictionPolicy:          evictionPolicy,
+		EvictionSample:          *evictionSample,
+		EvictionInterval:        *evictionInterval,
+		Modules:                 modules,
+		DiscoveryPort:           uint16(*discoveryPort),
+		ConfigFile:              *config,
+		ConfigReloadInterval:    *configReloadInterval,
+		RaftBindAddr:            raftBindAddr,
+		RaftBindPort:            uint16(raftBindPort),
 	}
 
 	if len(*config) > 0 {
 		// Override configurations from file.
-		if f, err := os.Open(*config); err != nil {
-			panic(err)
-		} else {
-			defer func() {
-				if err = f.Close(); err != nil {
-					log.Println(err)
-				}
-			}()
-
-			ext := path.Ext(f.Name())
-
-			if ext == ".json" {
-				if err = json.NewDecoder(f).Decode(&conf); err != nil {
-					return Config{}, nil
-				}
-			}
+		if err := loadConfigFile(&conf, *config); err != nil {
+			return Config{}, err
+		}
+	}
 
-			if ext == ".yaml" || ext == ".yml" {
-				if err = yaml.NewDecoder(f).Decode(&conf); err != nil {
-					return Config{}, err
-				}
-			}
+	return conf, validate(conf)
+}
+
+// Reload returns a copy of the config with the values of its config file applied over it.
+// The flag values are kept for the settings that are not in the file.
+func Reload(conf Config) (Config, error) {
+	if conf.ConfigFile == "" {
+		return conf, nil
+	}
+	reloaded := conf
+	// The decoders reuse the arrays of the slices they decode into, so the copy must not share them with conf.
+	reloaded.CertKeyPairs = slices.Clone(conf.CertKeyPairs)
+	for i, pair := range reloaded.CertKeyPairs {
+		reloaded.CertKeyPairs[i] = slices.Clone(pair)
+	}
+	reloaded.ClientCAs = slices.Clone(conf.ClientCAs)
+	reloaded.AclJWTKeyFiles = slices.Clone(conf.AclJWTKeyFiles)
+	reloaded.SaveRules = slices.Clone(conf.SaveRules)
+	reloaded.Modules = slices.Clone(conf.Modules)
+	reloaded.AuditLogCategories = slices.Clone(conf.AuditLogCategories)
+	reloaded.AuditLogCommands = slices.Clone(conf.AuditLogCommands)
+	reloaded.AuditLogExcludeCommands = slices.Clone(conf.AuditLogExcludeCommands)
+	reloaded.RenameCommands = maps.Clone(conf.RenameCommands)
+	reloaded.DisableCommands = slices.Clone(conf.DisableCommands)
+	if err := loadConfigFile(&reloaded, conf.ConfigFile); err != nil {
+		return conf, err
+	}
+	if err := validate(reloaded); err != nil {
+		return conf, err
+	}
+	return reloaded, nil
+}
+
+// loadConfigFile decodes the JSON or YAML config file over the config.
+func loadConfigFile(conf *Config, configFile string) error {
+	f, err := os.Open(configFile)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err = f.Close(); err != nil {
+			log.Println(err)
 		}
+	}()
+
+	switch path.Ext(f.Name()) {
+	case ".json":
+		return json.NewDecoder(f).Decode(conf)
+	case ".yaml", ".yml":
+		return yaml.NewDecoder(f).Decode(conf)
 	}
+	return nil
+}
 
+func validate(conf Config) error {
 	// If requirePass is set to true, then password must be provided as well.
 	var err error = nil
 
@@ -257,5 +752,116 @@ It is a plain text value by default but you can provide a SHA256 hash by adding
 		err = errors.New("password cannot be empty if requirePass is true")
 	}
 
-	return conf, err
+	if conf.Replica && conf.BootstrapCluster {
+		err = errors.New("a replica cannot bootstrap the cluster")
+	}
+
+	if conf.ReplicaOf != "" && (conf.BootstrapCluster || conf.JoinAddr != "") {
+		err = errors.New("replica-of is only supported in standalone mode")
+	}
+
+	if (conf.BootstrapCluster || conf.JoinAddr != "") && conf.ClusterSecret == "" {
+		err = errors.New("cluster-secret must be provided in cluster mode")
+	}
+
+	if !slices.Contains([]string{"", "bcrypt", "argon2id"}, conf.AclPasswordHash) {
+		err = fmt.Errorf("acl-password-hash must be bcrypt or argon2id, got %s", conf.AclPasswordHash)
+	}
+
+	if conf.AclArgon2Memory > 1024*1024 {
+		err = fmt.Errorf("acl-argon2-memory must be at most 1048576 (1GiB), got %d", conf.AclArgon2Memory)
+	}
+
+	if !slices.Contains([]string{"", "cn", "san-uri", "san-dns", "oid"}, conf.AclCertUserField) {
+		err = fmt.Errorf("acl-cert-user-field must be cn, san-uri, san-dns or oid, got %s", conf.AclCertUserField)
+	}
+
+	if conf.AclCertUserField == "oid" && conf.AclCertUserOID == "" {
+		err = errors.New("acl-cert-user-oid must be provided when acl-cert-user-field is oid")
+	}
+
+	if !slices.Contains([]string{"", "reauth", "disconnect"}, conf.AclJWTExpiryAction) {
+		err = fmt.Errorf("acl-jwt-expiry-action must be reauth or disconnect, got %s", conf.AclJWTExpiryAction)
+	}
+
+	if conf.AclBcryptCost < 4 || conf.AclBcryptCost > 31 {
+		err = fmt.Errorf("acl-bcrypt-cost must be between 4 and 31, got %d", conf.AclBcryptCost)
+	}
+
+	if !slices.Contains([]string{"always", "everysec", "no"}, strings.ToLower(conf.AOFSyncStrategy)) {
+		err = fmt.Errorf("aof-sync-strategy must be always, everysec or no, got %s", conf.AOFSyncStrategy)
+	}
+
+	if !slices.Contains([]string{
+		constants.NoEviction,
+		constants.AllKeysLFU, constants.AllKeysLRU, constants.AllKeysRandom,
+		constants.VolatileLFU, constants.VolatileLRU, constants.VolatileRandom,
+	}, strings.ToLower(conf.EvictionPolicy)) {
+		err = fmt.Errorf("policy %s is not a valid policy", conf.EvictionPolicy)
+	}
+
+	if conf.Timeout < 0 {
+		err = fmt.Errorf("timeout must not be negative, got %s", conf.Timeout)
+	}
+
+	if conf.TCPKeepAlive < 0 {
+		err = fmt.Errorf("tcp-keepalive must not be negative, got %s", conf.TCPKeepAlive)
+	}
+
+	if conf.EvictionInterval <= 0 {
+		err = fmt.Errorf("eviction-interval must be positive, got %s", conf.EvictionInterval)
+	}
+
+	names := make(map[string]string)
+	for command, name := range conf.RenameCommands {
+		if command == "" || name == "" || strings.ContainsAny(name, " |") {
+			err = fmt.Errorf("rename-command %s=%s must rename a command to a name without spaces", command, name)
+		}
+		if slices.ContainsFunc(conf.DisableCommands, func(c string) bool { return strings.EqualFold(c, command) }) {
+			err = fmt.Errorf("command %s cannot be both renamed and disabled", command)
+		}
+		// The subcommands are renamed within their command, so the names must only be unique within their command.
+		if parent, _, ok := strings.Cut(command, "|"); ok {
+			name = fmt.Sprintf("%s|%s", parent, name)
+		}
+		for c := range conf.RenameCommands {
+			if strings.EqualFold(c, name) && !strings.EqualFold(c, command) {
+				err = fmt.Errorf("command %s cannot be renamed to %s, which is also renamed", command, name)
+			}
+		}
+		if other, ok := names[strings.ToLower(name)]; ok {
+			err = fmt.Errorf("commands %s and %s cannot be renamed to the same name", other, command)
+		}
+		names[strings.ToLower(name)] = command
+	}
+
+	return err
+}
+
+// splitList splits a comma separated list, without the empty entries.
+func splitList(s string) []string {
+	list := make([]string, 0)
+	for _, entry := range strings.Split(s, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			list = append(list, entry)
+		}
+	}
+	return list
+}
+
+// ParseSaveRule parses a save rule in the format "<seconds> <changes>".
+func ParseSaveRule(s string) (SaveRule, error) {
+	fields := strings.Fields(s)
+	if len(fields) != 2 {
+		return SaveRule{}, fmt.Errorf("save rule \"%s\" must be in the format \"<seconds> <changes>\"", s)
+	}
+	seconds, err := strconv.ParseUint(fields[0], 10, 64)
+	if err != nil {
+		return SaveRule{}, fmt.Errorf("save rule seconds must be a positive integer, got \"%s\"", fields[0])
+	}
+	changes, err := strconv.ParseUint(fields[1], 10, 64)
+	if err != nil {
+		return SaveRule{}, fmt.Errorf("save rule changes must be a positive integer, got \"%s\"", fields[1])
+	}
+	return SaveRule{Seconds: seconds, Changes: changes}, nil
 }
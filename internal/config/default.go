@@ -9,34 +9,92 @@ import (
 func DefaultConfig() Config {
 	raftBindAddr, _ := internal.GetIPAddress()
 	raftBindPort, _ := internal.GetFreePort()
+	forwardPort, _ := internal.GetFreePort()
 
 	return Config{
-		TLS:               false,
-		MTLS:              false,
-		CertKeyPairs:      make([][]string, 0),
-		ClientCAs:         make([]string, 0),
-		Port:              7480,
-		ServerID:          "",
-		JoinAddr:          "",
-		BindAddr:          "localhost",
-		RaftBindAddr:      raftBindAddr,
-		RaftBindPort:      uint16(raftBindPort),
-		DiscoveryPort:     7946,
-		DataDir:           ".",
-		BootstrapCluster:  false,
-		AclConfig:         "",
-		ForwardCommand:    false,
-		RequirePass:       false,
-		Password:          "",
-		SnapShotThreshold: 1000,
-		SnapshotInterval:  5 * time.Minute,
-		RestoreAOF:        false,
-		RestoreSnapshot:   false,
-		AOFSyncStrategy:   "everysec",
-		MaxMemory:         0,
-		EvictionPolicy:    constants.NoEviction,
-		EvictionSample:    20,
-		EvictionInterval:  100 * time.Millisecond,
-		Modules:           make([]string, 0),
+		TLS:                     false,
+		MTLS:                    false,
+		CertKeyPairs:            make([][]string, 0),
+		ClientCAs:               make([]string, 0),
+		Port:                    7480,
+		ServerID:                "",
+		JoinAddr:                "",
+		BindAddr:                "localhost",
+		RaftBindAddr:            raftBindAddr,
+		RaftBindPort:            uint16(raftBindPort),
+		DiscoveryPort:           7946,
+		DataDir:                 ".",
+		BootstrapCluster:        false,
+		Replica:                 false,
+		ReplicaOf:               "",
+		MasterUser:              "",
+		MasterAuth:              "",
+		ReplBacklogSize:         1024 * 1024,
+		AclConfig:               "",
+		AclLogMaxLen:            128,
+		AclPasswordHash:         "",
+		AclBcryptCost:           10,
+		AclArgon2Time:           1,
+		AclArgon2Memory:         64 * 1024,
+		AclArgon2Threads:        4,
+		AclCertUserField:        "",
+		AclCertUserOID:          "",
+		AclCertNoPassword:       false,
+		AclJWTKeyFiles:          make([]string, 0),
+		AclJWKSFile:             "",
+		AclJWTUsernameClaim:     "sub",
+		AclJWTPermissionsClaim:  "",
+		AclJWTIssuer:            "",
+		AclJWTAudience:          "",
+		AclJWTExpiryAction:      "reauth",
+		AuditLog:                "",
+		AuditLogCategories:      []string{constants.AdminCategory, constants.DangerousCategory},
+		AuditLogCommands:        make([]string, 0),
+		AuditLogExcludeCommands: make([]string, 0),
+		AuditLogMaxSize:         100 * 1024 * 1024,
+		AuditLogMaxFiles:        5,
+		RenameCommands:          make(map[string]string),
+		DisableCommands:         make([]string, 0),
+		MaxClients:              10000,
+		MaxClientsPerIP:         0,
+		Timeout:                 0,
+		TCPKeepAlive:            300 * time.Second,
+		ProtectedMode:           true,
+		ForwardCommand:          false,
+		ForwardPort:             uint16(forwardPort),
+		ForwardTimeout:          5 * time.Second,
+		ClusterSecret:           "",
+		SnapshotExportDir:       "",
+		FailureGracePeriod:      time.Minute,
+		ReadConsistency:         constants.ReadConsistencyStale,
+		ShardID:                 "0",
+		ShardSlots:              "0-16383",
+		RequirePass:             false,
+		Password:                "",
+		SnapShotThreshold:       1000,
+		SnapshotInterval:        5 * time.Minute,
+		RestoreAOF:              false,
+		RestoreSnapshot:         false,
+		SaveRules:               make([]SaveRule, 0),
+		SnapshotRetainLast:      0,
+		SnapshotRetainHourly:    0,
+		SnapshotRetainDaily:     0,
+		StopWritesOnBGSaveError: true,
+		EncryptionKeyFile:       "",
+		EncryptionKeyEnv:        "",
+		EncryptionPlaintext:     false,
+		BackupTarget:            "",
+		BackupS3Endpoint:        "https://s3.amazonaws.com",
+		BackupS3Region:          "us-east-1",
+		BackupInterval:          5 * time.Minute,
+		RestoreBackup:           false,
+		AOFSyncStrategy:         "everysec",
+		MaxMemory:               0,
+		EvictionPolicy:          constants.NoEviction,
+		EvictionSample:          20,
+		EvictionInterval:        100 * time.Millisecond,
+		Modules:                 make([]string, 0),
+		ConfigFile:              "",
+		ConfigReloadInterval:    5 * time.Second,
 	}
 }
@@ -19,6 +19,7 @@ const Version = "0.13.1" // Next SugarDB version. Update this before each releas
 const (
 	ACLModule        = "acl"
 	AdminModule      = "admin"
+	ClusterModule    = "cluster"
 	ConnectionModule = "connection"
 	GenericModule    = "generic"
 	HashModule       = "hash"
@@ -68,6 +69,12 @@ const (
 	VolatileRandom = "volatile-random"
 )
 
+const (
+	ReadConsistencyStale        = "stale"
+	ReadConsistencyLease        = "lease"
+	ReadConsistencyLinearizable = "linearizable"
+)
+
 // CompositeTypes are SugarDB KeyData Value types like set, sorted set, etc.
 type CompositeType interface {
 	GetMem() int64
@@ -0,0 +1,180 @@
+// Copyright 2024 Kelvin Clement Mwinuka
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package dump serializes the value of a key into the payload returned by DUMP and accepted by RESTORE.
+// MIGRATE uses the payload to move keys between nodes.
+//
+// The payload is a JSON document that records the type of the value, followed by the payload version
+// and the CRC32 checksum of the document, so that a corrupted or incompatible payload is rejected.
+// Unlike the snapshot format, the payload preserves the type of sets, sorted sets and numbers.
+package dump
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"strconv"
+
+	"github.com/echovault/sugardb/internal/modules/set"
+	"github.com/echovault/sugardb/internal/modules/sorted_set"
+)
+
+// Version is the version of the payload format.
+const Version = 1
+
+// trailerSize is the size of the version and checksum that follow the document, e.g. "01a1b2c3d4".
+const trailerSize = 10
+
+// ErrInvalidPayload is returned when the payload is malformed, corrupted or has an unsupported version.
+var ErrInvalidPayload = errors.New("DUMP payload version or checksum are wrong")
+
+const (
+	typeString    = "string"
+	typeInteger   = "integer"
+	typeInteger64 = "integer64"
+	typeFloat     = "float"
+	typeHash      = "hash"
+	typeList      = "list"
+	typeSet       = "set"
+	typeSortedSet = "zset"
+)
+
+type document struct {
+	Type    string              `json:"Type"`
+	Scalar  string              `json:"Scalar,omitempty"`  // Strings and numbers.
+	Hash    map[string]document `json:"Hash,omitempty"`    // The fields of a hash.
+	List    []string            `json:"List,omitempty"`    // The elements of a list, or the members of a set.
+	Members []sortedSetMember   `json:"Members,omitempty"` // The members of a sorted set.
+}
+
+type sortedSetMember struct {
+	Value string  `json:"Value"`
+	Score float64 `json:"Score"`
+}
+
+// Encode serializes the value of a key.
+func Encode(value interface{}) ([]byte, error) {
+	doc, err := encodeValue(value)
+	if err != nil {
+		return nil, err
+	}
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	return append(b, fmt.Sprintf("%02x%08x", Version, crc32.ChecksumIEEE(b))...), nil
+}
+
+// Decode deserializes a payload created by Encode.
+func Decode(payload []byte) (interface{}, error) {
+	if len(payload) <= trailerSize {
+		return nil, ErrInvalidPayload
+	}
+	b, trailer := payload[:len(payload)-trailerSize], string(payload[len(payload)-trailerSize:])
+	version, err := strconv.ParseUint(trailer[:2], 16, 8)
+	if err != nil || version != Version {
+		return nil, ErrInvalidPayload
+	}
+	checksum, err := strconv.ParseUint(trailer[2:], 16, 32)
+	if err != nil || uint32(checksum) != crc32.ChecksumIEEE(b) {
+		return nil, ErrInvalidPayload
+	}
+
+	var doc document
+	if err = json.Unmarshal(b, &doc); err != nil {
+		return nil, ErrInvalidPayload
+	}
+	return decodeValue(doc)
+}
+
+func encodeValue(value interface{}) (document, error) {
+	switch v := value.(type) {
+	case string:
+		return document{Type: typeString, Scalar: v}, nil
+	case int:
+		return document{Type: typeInteger, Scalar: strconv.Itoa(v)}, nil
+	case int64:
+		return document{Type: typeInteger64, Scalar: strconv.FormatInt(v, 10)}, nil
+	case float64:
+		return document{Type: typeFloat, Scalar: strconv.FormatFloat(v, 'g', -1, 64)}, nil
+	case map[string]interface{}:
+		doc := document{Type: typeHash, Hash: make(map[string]document, len(v))}
+		for field, fieldValue := range v {
+			fieldDoc, err := encodeValue(fieldValue)
+			if err != nil {
+				return document{}, err
+			}
+			if fieldDoc.Type == typeHash || fieldDoc.Type == typeList || fieldDoc.Type == typeSet ||
+				fieldDoc.Type == typeSortedSet {
+				return document{}, fmt.Errorf("unsupported hash field type %T", fieldValue)
+			}
+			doc.Hash[field] = fieldDoc
+		}
+		return doc, nil
+	case []string:
+		return document{Type: typeList, List: v}, nil
+	case *set.Set:
+		return document{Type: typeSet, List: v.GetAll()}, nil
+	case *sorted_set.SortedSet:
+		doc := document{Type: typeSortedSet}
+		for _, member := range v.GetAll() {
+			doc.Members = append(doc.Members, sortedSetMember{Value: string(member.Value), Score: float64(member.Score)})
+		}
+		return doc, nil
+	default:
+		return document{}, fmt.Errorf("unsupported value type %T", value)
+	}
+}
+
+func decodeValue(doc document) (interface{}, error) {
+	switch doc.Type {
+	case typeString:
+		return doc.Scalar, nil
+	case typeInteger:
+		return strconv.Atoi(doc.Scalar)
+	case typeInteger64:
+		return strconv.ParseInt(doc.Scalar, 10, 64)
+	case typeFloat:
+		return strconv.ParseFloat(doc.Scalar, 64)
+	case typeHash:
+		hash := make(map[string]interface{}, len(doc.Hash))
+		for field, fieldDoc := range doc.Hash {
+			value, err := decodeValue(fieldDoc)
+			if err != nil {
+				return nil, err
+			}
+			hash[field] = value
+		}
+		return hash, nil
+	case typeList:
+		if doc.List == nil {
+			return []string{}, nil
+		}
+		return doc.List, nil
+	case typeSet:
+		return set.NewSet(doc.List), nil
+	case typeSortedSet:
+		members := make([]sorted_set.MemberParam, len(doc.Members))
+		for i, member := range doc.Members {
+			members[i] = sorted_set.MemberParam{
+				Value: sorted_set.Value(member.Value),
+				Score: sorted_set.Score(member.Score),
+			}
+		}
+		return sorted_set.NewSortedSet(members), nil
+	default:
+		return nil, fmt.Errorf("unsupported value type %s", doc.Type)
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright 2024 Kelvin Clement Mwinuka
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dump
+
+import (
+	"errors"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/echovault/sugardb/internal/modules/set"
+	"github.com/echovault/sugardb/internal/modules/sorted_set"
+)
+
+func Test_EncodeDecode(t *testing.T) {
+	tests := []struct {
+		name  string
+		value interface{}
+	}{
+		{name: "1. String", value: "value"},
+		{name: "2. Integer", value: 42},
+		{name: "3. 64-bit integer", value: int64(1) << 40},
+		{name: "4. Float", value: 3.14},
+		{name: "5. Hash", value: map[string]interface{}{"field1": "value1", "field2": 2, "field3": 3.5}},
+		{name: "6. List", value: []string{"a", "b", "a"}},
+		{name: "7. Empty list", value: []string{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			payload, err := Encode(test.value)
+			if err != nil {
+				t.Fatalf("Encode() error = %v", err)
+			}
+			got, err := Decode(payload)
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, test.value) {
+				t.Errorf("Decode() = %#v, want %#v", got, test.value)
+			}
+		})
+	}
+
+	t.Run("8. Set", func(t *testing.T) {
+		payload, err := Encode(set.NewSet([]string{"a", "b", "c"}))
+		if err != nil {
+			t.Fatalf("Encode() error = %v", err)
+		}
+		got, err := Decode(payload)
+		if err != nil {
+			t.Fatalf("Decode() error = %v", err)
+		}
+		s, ok := got.(*set.Set)
+		if !ok {
+			t.Fatalf("Decode() = %T, want *set.Set", got)
+		}
+		members := s.GetAll()
+		slices.Sort(members)
+		if !slices.Equal(members, []string{"a", "b", "c"}) {
+			t.Errorf("Decode() members = %v", members)
+		}
+	})
+
+	t.Run("9. Sorted set", func(t *testing.T) {
+		payload, err := Encode(sorted_set.NewSortedSet([]sorted_set.MemberParam{
+			{Value: "a", Score: 1}, {Value: "b", Score: 2.5},
+		}))
+		if err != nil {
+			t.Fatalf("Encode() error = %v", err)
+		}
+		got, err := Decode(payload)
+		if err != nil {
+			t.Fatalf("Decode() error = %v", err)
+		}
+		s, ok := got.(*sorted_set.SortedSet)
+		if !ok {
+			t.Fatalf("Decode() = %T, want *sorted_set.SortedSet", got)
+		}
+		if s.Cardinality() != 2 || s.Get("b").Score != 2.5 {
+			t.Errorf("Decode() members = %v", s.GetAll())
+		}
+	})
+}
+
+func Test_DecodeInvalidPayload(t *testing.T) {
+	payload, err := Encode("value")
+	if err != nil {
+		t.Fatal(err)
+	}
+	corrupted := slices.Clone(payload)
+	corrupted[len(corrupted)-trailerSize-2] ^= 1
+
+	tests := []struct {
+		name    string
+		payload []byte
+	}{
+		{name: "1. Empty payload", payload: nil},
+		{name: "2. Corrupted document", payload: corrupted},
+		{name: "3. Unsupported version", payload: append(slices.Clone(payload[:len(payload)-trailerSize]), append([]byte("02"), payload[len(payload)-8:]...)...)},
+		{name: "4. Not a payload", payload: []byte("not a dump payload")},
+	}
+	for _, test := range tests {
+		if _, err := Decode(test.payload); !errors.Is(err, ErrInvalidPayload) {
+			t.Errorf("%s: expected ErrInvalidPayload, got %v", test.name, err)
+		}
+	}
+}
@@ -0,0 +1,271 @@
+// Copyright 2024 Kelvin Clement Mwinuka
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package encryption handles the encryption of the persistence files (snapshots, AOF and raft data) at rest.
+//
+// Data is encrypted with AES-GCM and stored in envelopes with the following layout:
+//
+//	magic (4 bytes) | version (1 byte) | key id (8 bytes) | nonce (12 bytes) | length (8 bytes) | ciphertext
+//
+// The key id identifies the key that sealed the envelope, so previous keys can still be used
+// to open old data after a key rotation. Data that does not start with the magic bytes is plaintext, which is
+// only read when the cipher allows it, e.g. while migrating data written before encryption was enabled.
+package encryption
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+var (
+	// ErrInvalidKey is returned when an encryption key cannot be parsed.
+	ErrInvalidKey = errors.New("invalid encryption key")
+	// ErrNoKey is returned when encrypted data is read without an encryption key configured.
+	ErrNoKey = errors.New("data is encrypted but no encryption key is configured")
+	// ErrWrongKey is returned when encrypted data cannot be opened with any of the configured keys.
+	ErrWrongKey = errors.New("data cannot be decrypted with the configured encryption keys")
+	// ErrPlaintext is returned when plaintext data is read with an encryption key configured
+	// and plaintext data is not allowed.
+	ErrPlaintext = errors.New("data is not encrypted but an encryption key is configured")
+)
+
+const (
+	version      = 1
+	keyIdSize    = 8
+	nonceSize    = 12
+	lengthSize   = 8
+	keyIdOffset  = 5 // After the magic bytes and the version.
+	nonceOffset  = keyIdOffset + keyIdSize
+	lengthOffset = nonceOffset + nonceSize
+	headerSize   = lengthOffset + lengthSize
+)
+
+var magic = []byte{0xE5, 'S', 'D', 'B'}
+
+type key struct {
+	id   [keyIdSize]byte
+	raw  []byte
+	aead cipher.AEAD
+}
+
+// Cipher seals and opens data using the configured keys.
+// The first key is the active key used to seal new data. All the keys can open data.
+// A nil *Cipher is valid and leaves data in plaintext.
+type Cipher struct {
+	keys           []key
+	allowPlaintext bool
+}
+
+// NewCipher creates a cipher from the given keys. Each key must be 16, 24 or 32 bytes long.
+// When no keys are provided, a nil cipher is returned.
+func NewCipher(keys ...[]byte) (*Cipher, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	c := &Cipher{keys: make([]key, 0, len(keys))}
+	for _, raw := range keys {
+		block, err := aes.NewCipher(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidKey, err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidKey, err)
+		}
+		sum := sha256.Sum256(raw)
+		k := key{raw: raw, aead: aead}
+		copy(k.id[:], sum[:keyIdSize])
+		c.keys = append(c.keys, k)
+	}
+	return c, nil
+}
+
+// LoadKeys reads the encryption keys from the file and from the environment variable with the given name.
+// Keys are separated by new lines in the file and by commas in the environment variable. Lines starting
+// with '#' are ignored. Each key must be hex or base64 encoded. The keys from the file come first,
+// and the first key overall is the active key.
+func LoadKeys(file string, env string) ([][]byte, error) {
+	var encoded []string
+
+	if file != "" {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("read encryption key file: %w", err)
+		}
+		for _, line := range strings.Split(string(b), "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			encoded = append(encoded, line)
+		}
+	}
+
+	if env != "" {
+		for _, s := range strings.Split(os.Getenv(env), ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				encoded = append(encoded, s)
+			}
+		}
+		if len(encoded) == 0 {
+			return nil, fmt.Errorf("%w: environment variable %s is empty", ErrInvalidKey, env)
+		}
+	}
+
+	keys := make([][]byte, 0, len(encoded))
+	for i, s := range encoded {
+		k, err := decodeKey(s)
+		if err != nil {
+			return nil, fmt.Errorf("%w: key %d: %v", ErrInvalidKey, i+1, err)
+		}
+		keys = append(keys, k)
+	}
+
+	return keys, nil
+}
+
+func decodeKey(s string) ([]byte, error) {
+	validLength := func(b []byte) bool {
+		return len(b) == 16 || len(b) == 24 || len(b) == 32
+	}
+	if b, err := hex.DecodeString(s); err == nil && validLength(b) {
+		return b, nil
+	}
+	if b, err := base64.StdEncoding.DecodeString(s); err == nil && validLength(b) {
+		return b, nil
+	}
+	return nil, errors.New("key must be a hex or base64 encoded 16, 24 or 32 byte key")
+}
+
+// AllowPlaintext makes the cipher read plaintext data instead of returning ErrPlaintext, so that the data
+// written before encryption was enabled can be migrated.
+func (c *Cipher) AllowPlaintext() {
+	if c != nil {
+		c.allowPlaintext = true
+	}
+}
+
+// PlaintextAllowed reports whether plaintext data can be read, i.e. the cipher is nil or allows plaintext.
+func (c *Cipher) PlaintextAllowed() bool {
+	return c == nil || c.allowPlaintext
+}
+
+// Seal encrypts the data with the active key. If the cipher is nil, the data is returned unchanged.
+func (c *Cipher) Seal(data []byte) []byte {
+	if c == nil {
+		return data
+	}
+	k := c.keys[0]
+
+	out := make([]byte, headerSize, headerSize+len(data)+k.aead.Overhead())
+	copy(out, magic)
+	out[len(magic)] = version
+	copy(out[keyIdOffset:], k.id[:])
+	nonce := out[nonceOffset:lengthOffset]
+	if _, err := rand.Read(nonce); err != nil {
+		panic(fmt.Errorf("encryption: generate nonce: %v", err))
+	}
+	out = k.aead.Seal(out, nonce, data, out[:nonceOffset])
+	binary.BigEndian.PutUint64(out[lengthOffset:headerSize], uint64(len(out)-headerSize))
+
+	return out
+}
+
+// Open decrypts data sealed by Seal. Empty data is returned unchanged, and so is plaintext data
+// when it's allowed. Otherwise, plaintext data returns ErrPlaintext.
+func (c *Cipher) Open(data []byte) ([]byte, error) {
+	if !IsEncrypted(data) {
+		if len(data) > 0 && !c.PlaintextAllowed() {
+			return nil, ErrPlaintext
+		}
+		return data, nil
+	}
+	plaintext, n, err := c.OpenNext(data)
+	if err != nil {
+		return nil, err
+	}
+	if n != len(data) {
+		return nil, errors.New("encryption: unexpected data after the encrypted envelope")
+	}
+	return plaintext, nil
+}
+
+// OpenNext decrypts the envelope at the start of data and returns the plaintext along
+// with the number of bytes the envelope occupies. This is used to read streams of envelopes.
+func (c *Cipher) OpenNext(data []byte) ([]byte, int, error) {
+	if !IsEncrypted(data) {
+		return nil, 0, errors.New("encryption: data is not an encrypted envelope")
+	}
+	if len(data) < headerSize {
+		return nil, 0, errors.New("encryption: truncated envelope header")
+	}
+	if data[len(magic)] != version {
+		return nil, 0, fmt.Errorf("encryption: unsupported envelope version %d", data[len(magic)])
+	}
+	length := binary.BigEndian.Uint64(data[lengthOffset:headerSize])
+	if length > uint64(len(data)-headerSize) {
+		return nil, 0, errors.New("encryption: truncated envelope")
+	}
+	if c == nil {
+		return nil, 0, ErrNoKey
+	}
+
+	var id [keyIdSize]byte
+	copy(id[:], data[keyIdOffset:nonceOffset])
+	for _, k := range c.keys {
+		if k.id != id {
+			continue
+		}
+		nonce := data[nonceOffset:lengthOffset]
+		n := headerSize + int(length)
+		plaintext, err := k.aead.Open(nil, nonce, data[headerSize:n], data[:nonceOffset])
+		if err != nil {
+			return nil, 0, fmt.Errorf("%w: authentication failed, the data may be corrupted", ErrWrongKey)
+		}
+		return plaintext, n, nil
+	}
+
+	return nil, 0, fmt.Errorf("%w: data was encrypted with an unknown key (key id %x)", ErrWrongKey, id)
+}
+
+// Digest returns a digest of the data that changes when the active key changes.
+// When the cipher is nil, this is the MD5 checksum of the data. Otherwise, it is a truncated HMAC-SHA256 of
+// the data keyed by the active key, so that the digest does not reveal anything about the plaintext.
+func (c *Cipher) Digest(data []byte) [16]byte {
+	if c == nil {
+		return md5.Sum(data)
+	}
+	mac := hmac.New(sha256.New, c.keys[0].raw)
+	mac.Write(data)
+	var digest [16]byte
+	copy(digest[:], mac.Sum(nil))
+	return digest
+}
+
+// IsEncrypted reports whether the data starts with an encrypted envelope.
+func IsEncrypted(data []byte) bool {
+	return bytes.HasPrefix(data, magic)
+}
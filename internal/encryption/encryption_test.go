@@ -0,0 +1,242 @@
+// Copyright 2024 Kelvin Clement Mwinuka
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package encryption_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"github.com/echovault/sugardb/internal/encryption"
+	"os"
+	"path"
+	"testing"
+)
+
+func Test_Cipher(t *testing.T) {
+	oldKey := bytes.Repeat([]byte{1}, 32)
+	newKey := bytes.Repeat([]byte{2}, 16)
+	otherKey := bytes.Repeat([]byte{3}, 24)
+
+	oldCipher, _ := encryption.NewCipher(oldKey)
+	rotatedCipher, _ := encryption.NewCipher(newKey, oldKey)
+	otherCipher, _ := encryption.NewCipher(otherKey)
+	migrationCipher, _ := encryption.NewCipher(oldKey)
+	migrationCipher.AllowPlaintext()
+
+	data := []byte(`{"State":{"0":{"key1":{"Value":"value1"}}}}`)
+	oldSealed := oldCipher.Seal(data)
+	newSealed := rotatedCipher.Seal(data)
+
+	tests := []struct {
+		name    string
+		cipher  *encryption.Cipher
+		data    []byte
+		want    []byte
+		wantErr error
+	}{
+		{
+			name:   "1. Open data sealed with the same key",
+			cipher: oldCipher,
+			data:   oldSealed,
+			want:   data,
+		},
+		{
+			name:   "2. Open data sealed with a previous key after key rotation",
+			cipher: rotatedCipher,
+			data:   oldSealed,
+			want:   data,
+		},
+		{
+			name:   "3. Open data sealed with the new key after key rotation",
+			cipher: rotatedCipher,
+			data:   newSealed,
+			want:   data,
+		},
+		{
+			name:    "4. Open data sealed with a key that is not configured",
+			cipher:  otherCipher,
+			data:    newSealed,
+			wantErr: encryption.ErrWrongKey,
+		},
+		{
+			name:    "5. Open data that has been tampered with",
+			cipher:  oldCipher,
+			data:    append(bytes.Clone(oldSealed[:len(oldSealed)-1]), oldSealed[len(oldSealed)-1]^1),
+			wantErr: encryption.ErrWrongKey,
+		},
+		{
+			name:    "6. Open encrypted data without a cipher",
+			cipher:  nil,
+			data:    oldSealed,
+			wantErr: encryption.ErrNoKey,
+		},
+		{
+			name:    "7. Open plaintext data with a key",
+			cipher:  oldCipher,
+			data:    data,
+			wantErr: encryption.ErrPlaintext,
+		},
+		{
+			name:   "8. Plaintext data is returned unchanged when plaintext is allowed",
+			cipher: migrationCipher,
+			data:   data,
+			want:   data,
+		},
+		{
+			name:   "9. Encrypted data is opened when plaintext is allowed",
+			cipher: migrationCipher,
+			data:   oldSealed,
+			want:   data,
+		},
+		{
+			name:   "10. Plaintext data is returned unchanged without a cipher",
+			cipher: nil,
+			data:   data,
+			want:   data,
+		},
+		{
+			name:   "11. Empty data is returned unchanged",
+			cipher: oldCipher,
+			data:   []byte{},
+			want:   []byte{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := test.cipher.Open(test.data)
+			if test.wantErr != nil {
+				if !errors.Is(err, test.wantErr) {
+					t.Errorf("expected error %v, got %v", test.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if !bytes.Equal(got, test.want) {
+				t.Errorf("expected %s, got %s", test.want, got)
+			}
+		})
+	}
+
+	// The sealed data must not contain the plaintext.
+	if bytes.Contains(oldSealed, data) {
+		t.Error("expected sealed data to not contain the plaintext")
+	}
+	// A nil cipher leaves the data in plaintext.
+	if !bytes.Equal((*encryption.Cipher)(nil).Seal(data), data) {
+		t.Error("expected nil cipher to leave the data unchanged")
+	}
+	// The digest changes with the active key.
+	if oldCipher.Digest(data) == rotatedCipher.Digest(data) {
+		t.Error("expected the digest to change when the active key changes")
+	}
+}
+
+func Test_LoadKeys(t *testing.T) {
+	directory := path.Join(".", "testdata")
+	t.Cleanup(func() {
+		_ = os.RemoveAll(directory)
+	})
+	if err := os.MkdirAll(directory, os.ModePerm); err != nil {
+		t.Error(err)
+		return
+	}
+
+	key1 := bytes.Repeat([]byte{1}, 32)
+	key2 := bytes.Repeat([]byte{2}, 16)
+	key3 := bytes.Repeat([]byte{3}, 24)
+
+	keyFile := path.Join(directory, "keys")
+	content := "# The active key\n" + hex.EncodeToString(key1) + "\n\n" + base64.StdEncoding.EncodeToString(key2) + "\n"
+	if err := os.WriteFile(keyFile, []byte(content), os.ModePerm); err != nil {
+		t.Error(err)
+		return
+	}
+	invalidKeyFile := path.Join(directory, "invalid")
+	if err := os.WriteFile(invalidKeyFile, []byte("not-a-key"), os.ModePerm); err != nil {
+		t.Error(err)
+		return
+	}
+	t.Setenv("SUGARDB_TEST_ENCRYPTION_KEY", hex.EncodeToString(key3))
+	t.Setenv("SUGARDB_TEST_EMPTY_ENCRYPTION_KEY", "")
+
+	tests := []struct {
+		name    string
+		file    string
+		env     string
+		want    [][]byte
+		wantErr bool
+	}{
+		{
+			name: "1. No file or environment variable returns no keys",
+			want: [][]byte{},
+		},
+		{
+			name: "2. Load hex and base64 keys from a file",
+			file: keyFile,
+			want: [][]byte{key1, key2},
+		},
+		{
+			name: "3. Keys from the file come before the keys from the environment variable",
+			file: keyFile,
+			env:  "SUGARDB_TEST_ENCRYPTION_KEY",
+			want: [][]byte{key1, key2, key3},
+		},
+		{
+			name:    "4. Invalid key returns an error",
+			file:    invalidKeyFile,
+			wantErr: true,
+		},
+		{
+			name:    "5. Empty environment variable returns an error",
+			env:     "SUGARDB_TEST_EMPTY_ENCRYPTION_KEY",
+			wantErr: true,
+		},
+		{
+			name:    "6. Missing key file returns an error",
+			file:    path.Join(directory, "missing"),
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			keys, err := encryption.LoadKeys(test.file, test.env)
+			if test.wantErr {
+				if err == nil {
+					t.Error("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if len(keys) != len(test.want) {
+				t.Errorf("expected %d keys, got %d", len(test.want), len(keys))
+				return
+			}
+			for i := range keys {
+				if !bytes.Equal(keys[i], test.want[i]) {
+					t.Errorf("expected key %d to be %x, got %x", i, test.want[i], keys[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,542 @@
+// Copyright 2024 Kelvin Clement Mwinuka
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package forward implements the node-to-node channel that followers use to forward write commands
+// to the raft leader. The follower waits until the leader has applied the command and returns the
+// leader's reply to the client. Followers also use it to request the leader's read index for
+// consistent reads, and to ask the leader to change the raft configuration of the shard. Leaders use it
+// to pass cluster-wide commands on to the leaders of the other shards, and to check that the other
+// nodes have a module file before loading it.
+//
+// Each frame is a 4-byte big-endian length followed by the data, e.g. a JSON encoded Request or Response.
+// A connection carries one request and its response. The nodes authenticate each other with the
+// secret of the cluster: the server opens the connection with a random nonce, and the request and
+// the response are each followed by an HMAC-SHA256 of the nonce and the message. The server drops
+// a request that is not signed with its secret, and the client rejects a response that is not.
+// A message is preceded by a signed header with its size, so that a node only reads a large message
+// from a peer that has proven it knows the secret.
+package forward
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/echovault/sugardb/internal"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/sethvargo/go-retry"
+)
+
+// maxMessageSize is the upper limit of the size of a request or response.
+const maxMessageSize = 512 * 1024 * 1024
+
+// maxUnauthenticatedSize is the upper limit of the size of the frames that are read before the peer is
+// authenticated: the nonce, the headers of the messages and the HMACs.
+const maxUnauthenticatedSize = 64
+
+// defaultTimeout is the time the server waits for a request, and for the client to read the response,
+// when ServerOpts.Timeout is not set.
+const defaultTimeout = 5 * time.Second
+
+// nonceSize is the size of the nonce that the server opens each connection with.
+const nonceSize = 32
+
+// The labels of the HMACs of the requests and the responses, so a node cannot pass off a signed request as a response.
+const (
+	requestLabel  = "request"
+	responseLabel = "response"
+	headerLabel   = "-header"
+)
+
+// ErrNotLeader is returned by the apply function when the node is not the raft leader.
+// The command has not been applied, so the client retries it on the new leader.
+var ErrNotLeader = errors.New("not cluster leader")
+
+// ErrNoLeader is returned when the forwarding client cannot find the address of the cluster leader.
+var ErrNoLeader = errors.New("cluster leader is unknown")
+
+// ErrAuthentication is returned by the client when the response is not signed with the secret of the cluster.
+var ErrAuthentication = errors.New("forward message authentication failed")
+
+const (
+	RequestCommand            = "command"             // Apply a command on the leader.
+	RequestReadIndex          = "read-index"          // Return the leader's read index.
+	RequestCheckModule        = "check-module"        // Check that the node has a module file.
+	RequestTransferLeadership = "transfer-leadership" // Transfer the leadership of the shard to another node.
+	RequestAddNode            = "add-node"            // Add a node to the raft configuration of the shard.
+	RequestRemoveNode         = "remove-node"         // Remove a node from the raft configuration of the shard.
+	RequestPromoteNode        = "promote-node"        // Turn a non-voting replica of the shard into a voter.
+	RequestDemoteNode         = "demote-node"         // Turn a voter of the shard into a non-voting replica.
+)
+
+type Request struct {
+	Type         string   `json:"Type"`
+	Lease        bool     `json:"Lease"` // Whether the read index can rely on the leader lease.
+	ServerID     string   `json:"ServerID"`
+	ConnectionID string   `json:"ConnectionID"`
+	Protocol     int      `json:"Protocol"`
+	Database     int      `json:"Database"`
+	CMD          []string `json:"CMD"`
+	// ShardOnly is true when the command is passed on by the leader of another shard.
+	// The command is only applied on the receiving shard.
+	ShardOnly bool `json:"ShardOnly"`
+	// Path and Checksum identify the module file of a check-module request.
+	Path     string `json:"Path"`
+	Checksum string `json:"Checksum"`
+	// NodeID and NodeAddr identify the node of a transfer-leadership, add-node, remove-node,
+	// promote-node or demote-node request.
+	NodeID   string `json:"NodeID"`
+	NodeAddr string `json:"NodeAddr"`
+	// Username is the ACL user of the client that sent the command, so the leader can authorize it again.
+	// It's empty for the commands that the nodes send on their own behalf.
+	Username string `json:"Username"`
+	// UserRules are the ACL rules of the user when it was created from the rules of an identity.
+	UserRules []string `json:"UserRules"`
+	// System is true for the commands that the nodes send on their own behalf. They are not authorized again.
+	System bool `json:"System"`
+	// Asking is true when the client sent ASKING before the command.
+	Asking bool `json:"Asking"`
+}
+
+type Response struct {
+	Response  []byte `json:"Response"`
+	Index     uint64 `json:"Index"`
+	Error     string `json:"Error"`
+	NotLeader bool   `json:"NotLeader"`
+}
+
+type ServerOpts struct {
+	// Addr is the address that the server listens on.
+	Addr string
+	// Apply applies the command through raft and returns the reply.
+	// It must return an error that wraps ErrNotLeader when the node is not the leader.
+	Apply func(ctx context.Context, cmd []string) ([]byte, error)
+	// ReadIndex returns the index that a node must apply before serving a consistent read.
+	// It must return an error that wraps ErrNotLeader when the node is not the leader.
+	ReadIndex func(lease bool) (uint64, error)
+	// CheckModule returns an error when the node does not have the module file at the path,
+	// or when the checksum of the file is different.
+	CheckModule func(path, checksum string) error
+	// TransferLeadership, AddNode, RemoveNode, PromoteNode and DemoteNode change the raft configuration
+	// of the leader's shard. They must return an error that wraps ErrNotLeader when the node is not the leader.
+	TransferLeadership func(id string) error
+	AddNode            func(id, addr string) error
+	RemoveNode         func(id string) error
+	PromoteNode        func(id string) error
+	DemoteNode         func(id string) error
+	// Secret is the secret shared by the nodes of the cluster. The server only accepts the requests signed with it.
+	Secret string
+	// Timeout is the upper limit of the time the server waits for a request, and for the client to read
+	// the response. It does not include the time spent applying the request.
+	Timeout time.Duration
+}
+
+// Server receives forwarded commands on the leader.
+type Server struct {
+	options  ServerOpts
+	listener net.Listener
+	wg       sync.WaitGroup
+}
+
+func NewServer(opts ServerOpts) *Server {
+	return &Server{options: opts}
+}
+
+// Start starts listening for forwarded commands in the background.
+func (server *Server) Start() error {
+	if server.options.Secret == "" {
+		return errors.New("forward server: the cluster secret is empty")
+	}
+	listener, err := net.Listen("tcp", server.options.Addr)
+	if err != nil {
+		return fmt.Errorf("forward server listen: %w", err)
+	}
+	server.listener = listener
+
+	server.wg.Add(1)
+	go func() {
+		defer server.wg.Done()
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				if errors.Is(err, net.ErrClosed) {
+					return
+				}
+				log.Printf("forward server accept: %v\n", err)
+				continue
+			}
+			server.wg.Add(1)
+			go func() {
+				defer server.wg.Done()
+				server.handleConnection(conn)
+			}()
+		}
+	}()
+
+	return nil
+}
+
+// Addr returns the address that the server is listening on.
+func (server *Server) Addr() string {
+	if server.listener == nil {
+		return server.options.Addr
+	}
+	return server.listener.Addr().String()
+}
+
+// Shutdown stops accepting forwarded commands and waits for the commands in progress to complete.
+func (server *Server) Shutdown() {
+	if server.listener == nil {
+		return
+	}
+	if err := server.listener.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+		log.Printf("forward server close: %v\n", err)
+	}
+	server.wg.Wait()
+}
+
+func (server *Server) handleConnection(conn net.Conn) {
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	// A peer that has not sent a request yet, which includes an unauthenticated peer, can't hold the connection.
+	timeout := server.options.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	_ = conn.SetDeadline(time.Now().Add(timeout))
+
+	nonce := make([]byte, nonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		log.Printf("forward server nonce: %v\n", err)
+		return
+	}
+	if err := writeFrame(conn, nonce); err != nil {
+		log.Printf("forward server write: %v\n", err)
+		return
+	}
+
+	var request Request
+	if err := readSigned(conn, server.options.Secret, requestLabel, nonce, &request); err != nil {
+		log.Printf("forward server read from %s: %v\n", conn.RemoteAddr(), err)
+		if errors.Is(err, ErrAuthentication) {
+			// The node fails to verify the response as well, which tells it that the secrets are different.
+			_ = writeSigned(conn, server.options.Secret, responseLabel, nonce, Response{Error: err.Error()})
+		}
+		return
+	}
+
+	// Applying the request may take as long as the client is willing to wait for it.
+	_ = conn.SetDeadline(time.Time{})
+
+	var response Response
+	var err error
+	switch request.Type {
+	case RequestReadIndex:
+		response.Index, err = server.options.ReadIndex(request.Lease)
+	case RequestCheckModule:
+		err = server.options.CheckModule(request.Path, request.Checksum)
+	case RequestTransferLeadership:
+		err = server.options.TransferLeadership(request.NodeID)
+	case RequestAddNode:
+		err = server.options.AddNode(request.NodeID, request.NodeAddr)
+	case RequestRemoveNode:
+		err = server.options.RemoveNode(request.NodeID)
+	case RequestPromoteNode:
+		err = server.options.PromoteNode(request.NodeID)
+	case RequestDemoteNode:
+		err = server.options.DemoteNode(request.NodeID)
+	case RequestCommand, "":
+		ctx := context.WithValue(context.Background(), internal.ContextServerID("ServerID"), request.ServerID)
+		ctx = context.WithValue(ctx, internal.ContextConnID("ConnectionID"), request.ConnectionID)
+		ctx = context.WithValue(ctx, "Protocol", request.Protocol)
+		ctx = context.WithValue(ctx, "Database", request.Database)
+		ctx = context.WithValue(ctx, internal.ContextShardOnly("ShardOnly"), request.ShardOnly)
+		ctx = context.WithValue(ctx, internal.ContextUsername("Username"), request.Username)
+		ctx = context.WithValue(ctx, internal.ContextUserRules("UserRules"), request.UserRules)
+		ctx = context.WithValue(ctx, internal.ContextSystem("System"), request.System)
+		ctx = context.WithValue(ctx, internal.ContextAsking("Asking"), request.Asking)
+		response.Response, err = server.options.Apply(ctx, request.CMD)
+	default:
+		err = fmt.Errorf("unsupported forward request type %s", request.Type)
+	}
+	if err != nil {
+		response.Response = nil
+		response.Error = err.Error()
+		response.NotLeader = errors.Is(err, ErrNotLeader)
+	}
+
+	_ = conn.SetWriteDeadline(time.Now().Add(timeout))
+	if err = writeSigned(conn, server.options.Secret, responseLabel, nonce, response); err != nil {
+		log.Printf("forward server write: %v\n", err)
+	}
+}
+
+type ClientOpts struct {
+	// LeaderAddr returns the address of the forwarding server of the current raft leader.
+	// It returns ErrNoLeader when the leader is unknown, e.g. during an election.
+	LeaderAddr func() (string, error)
+	// Timeout is the upper limit of the time spent forwarding a command, including retries.
+	Timeout time.Duration
+	// Secret is the secret shared by the nodes of the cluster. The client signs the requests with it.
+	Secret string
+}
+
+// Client forwards commands from a follower to the leader.
+type Client struct {
+	options ClientOpts
+}
+
+func NewClient(opts ClientOpts) *Client {
+	return &Client{options: opts}
+}
+
+// Forward sends the command to the leader and returns the leader's reply once the command is applied.
+// The command is retried when the leader is unknown, unreachable, or is no longer the leader,
+// until the timeout is reached. It's not retried once the leader has accepted it, as the
+// command could have been applied.
+func (client *Client) Forward(ctx context.Context, request Request) ([]byte, error) {
+	return client.ForwardTo(ctx, client.options.LeaderAddr, request)
+}
+
+// ForwardTo is like Forward, but sends the command to the node whose address is returned by addr,
+// e.g. the leader of another shard.
+func (client *Client) ForwardTo(ctx context.Context, addr func() (string, error), request Request) ([]byte, error) {
+	request.Type = RequestCommand
+	response, err := client.do(ctx, addr, request, false)
+	if err != nil {
+		return nil, err
+	}
+	return response.Response, nil
+}
+
+// ReadIndex returns the leader's read index. See raft.ReadIndex.
+// The request is retried until the timeout is reached, as it does not modify the state.
+func (client *Client) ReadIndex(ctx context.Context, lease bool) (uint64, error) {
+	response, err := client.do(ctx, client.options.LeaderAddr, Request{Type: RequestReadIndex, Lease: lease}, true)
+	if err != nil {
+		return 0, err
+	}
+	return response.Index, nil
+}
+
+// CheckModule asks the node at the address whether it has the module file at the path with the checksum.
+// It returns the node's error when it does not.
+func (client *Client) CheckModule(ctx context.Context, addr string, path, checksum string) error {
+	_, err := client.do(ctx, func() (string, error) {
+		return addr, nil
+	}, Request{Type: RequestCheckModule, Path: path, Checksum: checksum}, false)
+	return err
+}
+
+// TransferLeadership asks the leader to transfer the leadership of the shard to the node with the id.
+// When the id is empty, the leader picks the most up-to-date follower.
+func (client *Client) TransferLeadership(ctx context.Context, id string) error {
+	_, err := client.do(ctx, client.options.LeaderAddr, Request{Type: RequestTransferLeadership, NodeID: id}, false)
+	return err
+}
+
+// AddNode asks the leader to add the node to the raft configuration of the shard.
+func (client *Client) AddNode(ctx context.Context, id, addr string) error {
+	_, err := client.do(ctx, client.options.LeaderAddr, Request{Type: RequestAddNode, NodeID: id, NodeAddr: addr}, false)
+	return err
+}
+
+// RemoveNode asks the leader to remove the node from the raft configuration of the shard.
+func (client *Client) RemoveNode(ctx context.Context, id string) error {
+	_, err := client.do(ctx, client.options.LeaderAddr, Request{Type: RequestRemoveNode, NodeID: id}, false)
+	return err
+}
+
+// PromoteNode asks the leader to turn the non-voting replica into a voter of the shard.
+func (client *Client) PromoteNode(ctx context.Context, id string) error {
+	_, err := client.do(ctx, client.options.LeaderAddr, Request{Type: RequestPromoteNode, NodeID: id}, false)
+	return err
+}
+
+// DemoteNode asks the leader to turn the voter into a non-voting replica of the shard.
+func (client *Client) DemoteNode(ctx context.Context, id string) error {
+	_, err := client.do(ctx, client.options.LeaderAddr, Request{Type: RequestDemoteNode, NodeID: id}, false)
+	return err
+}
+
+// do sends the request to the node whose address is returned by addr, and retries it until the timeout
+// is reached. When idempotent is false, the request is only retried when it was not accepted by the node.
+func (client *Client) do(ctx context.Context, addr func() (string, error), request Request,
+	idempotent bool) (Response, error) {
+	ctx, cancel := context.WithTimeout(ctx, client.options.Timeout)
+	defer cancel()
+
+	backoffPolicy := internal.RetryBackoff(retry.NewFibonacci(10*time.Millisecond), 0, 0, 500*time.Millisecond, 0)
+
+	var response Response
+	var lastErr error
+	err := retry.Do(ctx, backoffPolicy, func(ctx context.Context) error {
+		var retryable bool
+		response, retryable, lastErr = client.send(ctx, addr, request)
+		if lastErr != nil && (retryable || idempotent) {
+			return retry.RetryableError(lastErr)
+		}
+		return lastErr
+	})
+
+	if err != nil && errors.Is(err, context.DeadlineExceeded) && lastErr != nil {
+		return Response{}, fmt.Errorf("could not reach cluster node: %w", lastErr)
+	}
+	return response, err
+}
+
+// send sends the request to the node whose address is returned by addr, usually the current leader.
+// The returned boolean reports whether the request can safely be sent again.
+func (client *Client) send(ctx context.Context, nodeAddr func() (string, error), request Request) (Response, bool, error) {
+	addr, err := nodeAddr()
+	if err != nil {
+		return Response{}, true, err
+	}
+
+	dialer := net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return Response{}, true, err
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	nonce, err := readFrame(conn, maxUnauthenticatedSize)
+	if err != nil {
+		return Response{}, true, fmt.Errorf("read nonce from %s: %w", addr, err)
+	}
+	if len(nonce) != nonceSize {
+		return Response{}, true, fmt.Errorf("read nonce from %s: expected %d bytes, got %d", addr, nonceSize, len(nonce))
+	}
+
+	if err = writeSigned(conn, client.options.Secret, requestLabel, nonce, request); err != nil {
+		return Response{}, false, fmt.Errorf("send %s request to %s: %w", request.Type, addr, err)
+	}
+
+	var response Response
+	if err = readSigned(conn, client.options.Secret, responseLabel, nonce, &response); err != nil {
+		return Response{}, false, fmt.Errorf("read reply from %s: %w", addr, err)
+	}
+
+	if response.NotLeader {
+		return Response{}, true, fmt.Errorf("%w: %s", ErrNotLeader, addr)
+	}
+	if response.Error != "" {
+		return Response{}, false, errors.New(response.Error)
+	}
+
+	return response, false, nil
+}
+
+// writeSigned writes the header of the message and its HMAC, then the message and its HMAC. See sign.
+// The header holds the size of the message.
+func writeSigned(w io.Writer, secret, label string, nonce []byte, message any) error {
+	b, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	header := binary.BigEndian.AppendUint32(nil, uint32(len(b)))
+	for _, frame := range [][]byte{
+		header, sign(secret, label+headerLabel, nonce, header),
+		b, sign(secret, label, nonce, b),
+	} {
+		if err = writeFrame(w, frame); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readSigned reads a message written by writeSigned. It returns an error that wraps ErrAuthentication
+// when the message is not signed with the secret. The message is only read once the header is authenticated,
+// so an unauthenticated peer can't make the node allocate more than maxUnauthenticatedSize.
+func readSigned(r io.Reader, secret, label string, nonce []byte, message any) error {
+	header, err := readFrame(r, maxUnauthenticatedSize)
+	if err != nil {
+		return err
+	}
+	mac, err := readFrame(r, maxUnauthenticatedSize)
+	if err != nil {
+		return err
+	}
+	if len(header) != 4 || !hmac.Equal(mac, sign(secret, label+headerLabel, nonce, header)) {
+		return fmt.Errorf("%w: check that the nodes have the same cluster secret", ErrAuthentication)
+	}
+	size := binary.BigEndian.Uint32(header)
+	if size > maxMessageSize {
+		return fmt.Errorf("message size %d exceeds the limit of %d bytes", size, maxMessageSize)
+	}
+
+	b, err := readFrame(r, size)
+	if err != nil {
+		return err
+	}
+	if mac, err = readFrame(r, maxUnauthenticatedSize); err != nil {
+		return err
+	}
+	if uint32(len(b)) != size || !hmac.Equal(mac, sign(secret, label, nonce, b)) {
+		return fmt.Errorf("%w: check that the nodes have the same cluster secret", ErrAuthentication)
+	}
+	return json.Unmarshal(b, message)
+}
+
+// sign returns the HMAC-SHA256 of the message with the secret. The label and the nonce of the connection
+// are part of the HMAC, so a signed message cannot be replayed on another connection or in the other direction.
+func sign(secret, label string, nonce []byte, message []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(label))
+	mac.Write(nonce)
+	mac.Write(message)
+	return mac.Sum(nil)
+}
+
+func writeFrame(w io.Writer, b []byte) error {
+	buf := make([]byte, 4+len(b))
+	binary.BigEndian.PutUint32(buf, uint32(len(b)))
+	copy(buf[4:], b)
+	_, err := w.Write(buf)
+	return err
+}
+
+// readFrame reads a frame of up to limit bytes.
+func readFrame(r io.Reader, limit uint32) ([]byte, error) {
+	var size [4]byte
+	if _, err := io.ReadFull(r, size[:]); err != nil {
+		return nil, err
+	}
+	n := binary.BigEndian.Uint32(size[:])
+	if n > limit {
+		return nil, fmt.Errorf("frame size %d exceeds the limit of %d bytes", n, limit)
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
@@ -0,0 +1,430 @@
+// Copyright 2024 Kelvin Clement Mwinuka
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package forward
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"github.com/echovault/sugardb/internal"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const secret = "cluster-secret"
+
+func startServer(t *testing.T, apply func(ctx context.Context, cmd []string) ([]byte, error)) *Server {
+	server := NewServer(ServerOpts{Addr: "127.0.0.1:0", Apply: apply, Secret: secret})
+	if err := server.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(server.Shutdown)
+	return server
+}
+
+func Test_Forward(t *testing.T) {
+	t.Run("Test_ReturnsLeaderReply", func(t *testing.T) {
+		var received struct {
+			serverId string
+			connId   string
+			protocol int
+			database int
+			username string
+			cmd      []string
+		}
+		leader := startServer(t, func(ctx context.Context, cmd []string) ([]byte, error) {
+			received.serverId, _ = ctx.Value(internal.ContextServerID("ServerID")).(string)
+			received.connId, _ = ctx.Value(internal.ContextConnID("ConnectionID")).(string)
+			received.protocol, _ = ctx.Value("Protocol").(int)
+			received.database, _ = ctx.Value("Database").(int)
+			received.username, _ = ctx.Value(internal.ContextUsername("Username")).(string)
+			received.cmd = cmd
+			return []byte(":3\r\n"), nil
+		})
+		client := NewClient(ClientOpts{
+			LeaderAddr: func() (string, error) { return leader.Addr(), nil },
+			Timeout:    time.Second,
+			Secret:     secret,
+		})
+
+		res, err := client.Forward(context.Background(), Request{
+			ServerID:     "SERVER-1",
+			ConnectionID: "conn-1",
+			Protocol:     3,
+			Database:     2,
+			CMD:          []string{"LPUSH", "list", "a", "b", "c"},
+			Username:     "user1",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(res) != ":3\r\n" {
+			t.Errorf("expected response \":3\\r\\n\", got %q", res)
+		}
+		if received.serverId != "SERVER-1" || received.connId != "conn-1" ||
+			received.protocol != 3 || received.database != 2 || received.username != "user1" {
+			t.Errorf("unexpected request context %+v", received)
+		}
+		if strings.Join(received.cmd, " ") != "LPUSH list a b c" {
+			t.Errorf("expected command \"LPUSH list a b c\", got %v", received.cmd)
+		}
+	})
+
+	t.Run("Test_ReturnsLeaderError", func(t *testing.T) {
+		var calls atomic.Int32
+		leader := startServer(t, func(ctx context.Context, cmd []string) ([]byte, error) {
+			calls.Add(1)
+			return nil, errors.New("WRONGTYPE value at key list is not a list")
+		})
+		client := NewClient(ClientOpts{
+			LeaderAddr: func() (string, error) { return leader.Addr(), nil },
+			Timeout:    time.Second,
+			Secret:     secret,
+		})
+
+		_, err := client.Forward(context.Background(), Request{CMD: []string{"LPUSH", "list", "a"}})
+		if err == nil || err.Error() != "WRONGTYPE value at key list is not a list" {
+			t.Errorf("expected the leader's error, got %v", err)
+		}
+		if calls.Load() != 1 {
+			t.Errorf("expected the command to be sent once, got %d", calls.Load())
+		}
+	})
+
+	t.Run("Test_RetriesAcrossLeaderChange", func(t *testing.T) {
+		var mut sync.Mutex
+		var leaderAddr string
+
+		newLeader := startServer(t, func(ctx context.Context, cmd []string) ([]byte, error) {
+			return []byte("+OK\r\n"), nil
+		})
+		oldLeader := startServer(t, func(ctx context.Context, cmd []string) ([]byte, error) {
+			// The old leader has stepped down, so point the followers to the new leader.
+			mut.Lock()
+			leaderAddr = newLeader.Addr()
+			mut.Unlock()
+			return nil, ErrNotLeader
+		})
+
+		var lookups atomic.Int32
+		client := NewClient(ClientOpts{
+			LeaderAddr: func() (string, error) {
+				// The leader is unknown during the first lookup, e.g. during an election.
+				if lookups.Add(1) == 1 {
+					return "", ErrNoLeader
+				}
+				mut.Lock()
+				defer mut.Unlock()
+				if leaderAddr == "" {
+					leaderAddr = oldLeader.Addr()
+				}
+				return leaderAddr, nil
+			},
+			Timeout: 2 * time.Second,
+			Secret:  secret,
+		})
+
+		res, err := client.Forward(context.Background(), Request{CMD: []string{"SET", "key", "value"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(res) != "+OK\r\n" {
+			t.Errorf("expected response \"+OK\\r\\n\", got %q", res)
+		}
+		if lookups.Load() != 3 {
+			t.Errorf("expected 3 leader lookups, got %d", lookups.Load())
+		}
+	})
+
+	t.Run("Test_ForwardToShardOnly", func(t *testing.T) {
+		var shardOnly bool
+		leader := startServer(t, func(ctx context.Context, cmd []string) ([]byte, error) {
+			shardOnly, _ = ctx.Value(internal.ContextShardOnly("ShardOnly")).(bool)
+			return []byte("+OK\r\n"), nil
+		})
+		client := NewClient(ClientOpts{
+			LeaderAddr: func() (string, error) { return "", ErrNoLeader },
+			Timeout:    time.Second,
+			Secret:     secret,
+		})
+
+		_, err := client.ForwardTo(context.Background(), func() (string, error) {
+			return leader.Addr(), nil
+		}, Request{CMD: []string{"ACL", "DELUSER", "user1"}, ShardOnly: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !shardOnly {
+			t.Error("expected the command context to be shard only")
+		}
+	})
+
+	t.Run("Test_CheckModule", func(t *testing.T) {
+		node := NewServer(ServerOpts{
+			Addr: "127.0.0.1:0",
+			CheckModule: func(path, checksum string) error {
+				if path != "/modules/module_set.so" {
+					return errors.New("module /modules/module_other.so not found")
+				}
+				if checksum != "abc" {
+					return errors.New("module /modules/module_set.so differs from the module on the leader")
+				}
+				return nil
+			},
+			Secret: secret,
+		})
+		if err := node.Start(); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(node.Shutdown)
+		client := NewClient(ClientOpts{Timeout: time.Second, Secret: secret})
+
+		tests := []struct {
+			name     string
+			path     string
+			checksum string
+			wantErr  string
+		}{
+			{name: "1. Same module", path: "/modules/module_set.so", checksum: "abc"},
+			{
+				name:     "2. Missing module",
+				path:     "/modules/module_other.so",
+				checksum: "abc",
+				wantErr:  "module /modules/module_other.so not found",
+			},
+			{
+				name:     "3. Different module",
+				path:     "/modules/module_set.so",
+				checksum: "def",
+				wantErr:  "module /modules/module_set.so differs from the module on the leader",
+			},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				err := client.CheckModule(context.Background(), node.Addr(), tt.path, tt.checksum)
+				if tt.wantErr == "" && err != nil {
+					t.Errorf("expected no error, got %v", err)
+				}
+				if tt.wantErr != "" && (err == nil || err.Error() != tt.wantErr) {
+					t.Errorf("expected error %q, got %v", tt.wantErr, err)
+				}
+			})
+		}
+	})
+
+	t.Run("Test_RejectsWrongSecret", func(t *testing.T) {
+		var calls atomic.Int32
+		leader := startServer(t, func(ctx context.Context, cmd []string) ([]byte, error) {
+			calls.Add(1)
+			return []byte("+OK\r\n"), nil
+		})
+		client := NewClient(ClientOpts{
+			LeaderAddr: func() (string, error) { return leader.Addr(), nil },
+			Timeout:    time.Second,
+			Secret:     "other-secret",
+		})
+
+		_, err := client.Forward(context.Background(), Request{CMD: []string{"SET", "key", "value"}})
+		if !errors.Is(err, ErrAuthentication) {
+			t.Errorf("expected error to wrap ErrAuthentication, got %v", err)
+		}
+		if calls.Load() != 0 {
+			t.Errorf("expected the command not to be applied, got %d calls", calls.Load())
+		}
+	})
+
+	t.Run("Test_RejectsUnsignedRequest", func(t *testing.T) {
+		var calls atomic.Int32
+		leader := startServer(t, func(ctx context.Context, cmd []string) ([]byte, error) {
+			calls.Add(1)
+			return []byte("+OK\r\n"), nil
+		})
+
+		conn, err := net.Dial("tcp", leader.Addr())
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			_ = conn.Close()
+		})
+		_ = conn.SetDeadline(time.Now().Add(time.Second))
+		nonce, err := readFrame(conn, maxUnauthenticatedSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The header announces a message of the maximum size, which the server must not read without a valid HMAC.
+		if err = writeFrame(conn, binary.BigEndian.AppendUint32(nil, maxMessageSize)); err != nil {
+			t.Fatal(err)
+		}
+		if err = writeFrame(conn, make([]byte, sha256.Size)); err != nil {
+			t.Fatal(err)
+		}
+
+		// The server answers with an error signed with its secret, then closes the connection.
+		var response Response
+		if err = readSigned(conn, secret, responseLabel, nonce, &response); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(response.Error, ErrAuthentication.Error()) {
+			t.Errorf("expected an authentication error, got %q", response.Error)
+		}
+		if calls.Load() != 0 {
+			t.Errorf("expected the command not to be applied, got %d calls", calls.Load())
+		}
+	})
+
+	t.Run("Test_LimitsUnauthenticatedPeers", func(t *testing.T) {
+		server := NewServer(ServerOpts{Addr: "127.0.0.1:0", Secret: secret, Timeout: 100 * time.Millisecond})
+		if err := server.Start(); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(server.Shutdown)
+
+		connect := func(t *testing.T) net.Conn {
+			conn, err := net.Dial("tcp", server.Addr())
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() {
+				_ = conn.Close()
+			})
+			_ = conn.SetDeadline(time.Now().Add(time.Second))
+			if _, err = readFrame(conn, maxUnauthenticatedSize); err != nil {
+				t.Fatal(err)
+			}
+			return conn
+		}
+
+		// A frame larger than the limit of the unauthenticated frames closes the connection.
+		conn := connect(t)
+		if _, err := conn.Write(binary.BigEndian.AppendUint32(nil, maxMessageSize)); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := conn.Read(make([]byte, 1)); !errors.Is(err, io.EOF) {
+			t.Errorf("expected the server to close the connection, got %v", err)
+		}
+
+		// A peer that doesn't send a request is disconnected after the timeout.
+		conn = connect(t)
+		start := time.Now()
+		if _, err := conn.Read(make([]byte, 1)); !errors.Is(err, io.EOF) {
+			t.Errorf("expected the server to close the idle connection, got %v", err)
+		}
+		if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+			t.Errorf("expected the idle connection to be closed after 100ms, took %s", elapsed)
+		}
+	})
+
+	t.Run("Test_MembershipChanges", func(t *testing.T) {
+		var mut sync.Mutex
+		var calls []string
+		record := func(call string) {
+			mut.Lock()
+			defer mut.Unlock()
+			calls = append(calls, call)
+		}
+		leader := NewServer(ServerOpts{
+			Addr:               "127.0.0.1:0",
+			TransferLeadership: func(id string) error { record("transfer-leadership " + id); return nil },
+			AddNode:            func(id, addr string) error { record("add-node " + id + " " + addr); return nil },
+			RemoveNode:         func(id string) error { record("remove-node " + id); return nil },
+			PromoteNode:        func(id string) error { record("promote-node " + id); return nil },
+			DemoteNode:         func(id string) error { record("demote-node " + id); return nil },
+			Secret:             secret,
+		})
+		if err := leader.Start(); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(leader.Shutdown)
+
+		changeMembership := func(client *Client) []error {
+			ctx := context.Background()
+			return []error{
+				client.TransferLeadership(ctx, "2"),
+				client.AddNode(ctx, "3", "127.0.0.1:7990"),
+				client.RemoveNode(ctx, "3"),
+				client.PromoteNode(ctx, "4"),
+				client.DemoteNode(ctx, "4"),
+			}
+		}
+
+		// The membership changes of a node with another secret are refused.
+		client := NewClient(ClientOpts{
+			LeaderAddr: func() (string, error) { return leader.Addr(), nil },
+			Timeout:    time.Second,
+			Secret:     "other-secret",
+		})
+		for _, err := range changeMembership(client) {
+			if !errors.Is(err, ErrAuthentication) {
+				t.Errorf("expected error to wrap ErrAuthentication, got %v", err)
+			}
+		}
+		if len(calls) != 0 {
+			t.Errorf("expected no membership changes, got %v", calls)
+		}
+
+		client = NewClient(ClientOpts{
+			LeaderAddr: func() (string, error) { return leader.Addr(), nil },
+			Timeout:    time.Second,
+			Secret:     secret,
+		})
+		for _, err := range changeMembership(client) {
+			if err != nil {
+				t.Errorf("expected no error, got %v", err)
+			}
+		}
+		want := []string{
+			"transfer-leadership 2",
+			"add-node 3 127.0.0.1:7990",
+			"remove-node 3",
+			"promote-node 4",
+			"demote-node 4",
+		}
+		if strings.Join(calls, ", ") != strings.Join(want, ", ") {
+			t.Errorf("expected membership changes %v, got %v", want, calls)
+		}
+	})
+
+	t.Run("Test_RequiresSecret", func(t *testing.T) {
+		server := NewServer(ServerOpts{Addr: "127.0.0.1:0"})
+		if err := server.Start(); err == nil {
+			server.Shutdown()
+			t.Error("expected the server not to start without a secret")
+		}
+	})
+
+	t.Run("Test_Timeout", func(t *testing.T) {
+		client := NewClient(ClientOpts{
+			LeaderAddr: func() (string, error) { return "", ErrNoLeader },
+			Timeout:    200 * time.Millisecond,
+			Secret:     secret,
+		})
+
+		start := time.Now()
+		_, err := client.Forward(context.Background(), Request{CMD: []string{"SET", "key", "value"}})
+		if !errors.Is(err, ErrNoLeader) {
+			t.Errorf("expected error to wrap ErrNoLeader, got %v", err)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("expected forward to time out after 200ms, took %s", elapsed)
+		}
+	})
+}
@@ -34,9 +34,16 @@ type DelegateOpts struct {
 	config         config.Config
 	broadcastQueue *memberlist.TransmitLimitedQueue
 	addVoter       func(id raft.ServerID, address raft.ServerAddress, prevIndex uint64, timeout time.Duration) error
+	addNonvoter    func(id raft.ServerID, address raft.ServerAddress, prevIndex uint64, timeout time.Duration) error
 	isRaftLeader   func() bool
 	applyMutate    func(ctx context.Context, cmd []string) ([]byte, error)
 	applyDeleteKey func(ctx context.Context, key string) error
+	getShards      func() []byte
+	mergeShards    func(b []byte) bool
+	// deliverPublish and mergeSubscriptions handle the messages that the nodes send to each other directly,
+	// so they're never re-broadcast.
+	deliverPublish     func(b []byte)
+	mergeSubscriptions func(serverId string, b []byte)
 }
 
 func NewDelegate(opts DelegateOpts) *Delegate {
@@ -52,6 +59,11 @@ func (delegate *Delegate) NodeMeta(limit int) []byte {
 		RaftAddr: raft.ServerAddress(
 			fmt.Sprintf("%s:%d", delegate.options.config.RaftBindAddr, delegate.options.config.RaftBindPort)),
 		MemberlistAddr: fmt.Sprintf("%s:%d", delegate.options.config.BindAddr, delegate.options.config.DiscoveryPort),
+		ForwardAddr:    fmt.Sprintf("%s:%d", delegate.options.config.RaftBindAddr, delegate.options.config.ForwardPort),
+		ShardID:        delegate.options.config.ShardID,
+		ClientAddr:     fmt.Sprintf("%s:%d", delegate.options.config.BindAddr, delegate.options.config.Port),
+		Leader:         delegate.options.isRaftLeader(),
+		Replica:        delegate.options.config.Replica,
 	}
 
 	b, err := json.Marshal(&meta)
@@ -73,19 +85,23 @@ func (delegate *Delegate) NotifyMsg(msgBytes []byte) {
 
 	switch msg.Action {
 	case "RaftJoin":
-		// If the current node is not the cluster leader, re-broadcast the message.
-		if !delegate.options.isRaftLeader() {
+		// If the current node is not the leader of the joining node's shard, re-broadcast the message.
+		if !delegate.options.isRaftLeader() || msg.ShardID != delegate.options.config.ShardID {
 			delegate.options.broadcastQueue.QueueBroadcast(&msg)
 			return
 		}
-		err := delegate.options.addVoter(msg.NodeMeta.ServerID, msg.NodeMeta.RaftAddr, 0, 0)
+		addServer := delegate.options.addVoter
+		if msg.NodeMeta.Replica {
+			addServer = delegate.options.addNonvoter
+		}
+		err := addServer(msg.NodeMeta.ServerID, msg.NodeMeta.RaftAddr, 0, 0)
 		if err != nil {
 			log.Println(err)
 		}
 
 	case "DeleteKey":
-		// If the current node is not a cluster leader, re-broadcast the message.
-		if !delegate.options.isRaftLeader() {
+		// If the current node is not the leader of the sender's shard, re-broadcast the message.
+		if !delegate.options.isRaftLeader() || msg.ShardID != delegate.options.config.ShardID {
 			delegate.options.broadcastQueue.QueueBroadcast(&msg)
 			return
 		}
@@ -101,8 +117,10 @@ func (delegate *Delegate) NotifyMsg(msgBytes []byte) {
 		}
 
 	case "MutateData":
-		// If the current node is not a cluster leader, re-broadcast the message.
-		if !delegate.options.isRaftLeader() {
+		// Followers forward mutations to the leader with the forwarding client. This message is
+		// only sent by nodes running an older version that gossip the mutations instead.
+		// If the current node is not the leader of the sender's shard, re-broadcast the message.
+		if !delegate.options.isRaftLeader() || msg.ShardID != delegate.options.config.ShardID {
 			delegate.options.broadcastQueue.QueueBroadcast(&msg)
 			return
 		}
@@ -120,6 +138,18 @@ func (delegate *Delegate) NotifyMsg(msgBytes []byte) {
 		if _, err := delegate.options.applyMutate(ctx, cmd); err != nil {
 			log.Println(err)
 		}
+
+	case "ShardUpdate":
+		// Pass the update on if it changed the slot map of the node.
+		if delegate.options.mergeShards(msg.Content) {
+			delegate.options.broadcastQueue.QueueBroadcast(&msg)
+		}
+
+	case "Publish":
+		delegate.options.deliverPublish(msg.Content)
+
+	case "Subscriptions":
+		delegate.options.mergeSubscriptions(string(msg.ServerID), msg.Content)
 	}
 }
 
@@ -129,12 +159,14 @@ func (delegate *Delegate) GetBroadcasts(overhead, limit int) [][]byte {
 }
 
 // LocalState implements Delegate interface
+// The slot map of the node is exchanged with the other nodes in the periodic push/pull sync.
 func (delegate *Delegate) LocalState(join bool) []byte {
-	// No-Op
-	return []byte("")
+	return delegate.options.getShards()
 }
 
 // MergeRemoteState implements Delegate interface
 func (delegate *Delegate) MergeRemoteState(buf []byte, join bool) {
-	// No-Op
+	if len(buf) > 0 {
+		delegate.options.mergeShards(buf)
+	}
 }
@@ -16,52 +16,199 @@ package memberlist
 
 import (
 	"encoding/json"
-	"github.com/hashicorp/memberlist"
 	"log"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/memberlist"
 )
 
+// MembershipStats counts the membership changes observed by the node since it started.
+type MembershipStats struct {
+	Joined         uint64 // The number of times another node joined, or came back.
+	Left           uint64 // The number of times a node left gracefully.
+	Failed         uint64 // The number of times a node stopped responding.
+	Recovered      uint64 // The number of times a failed member of the node's shard came back.
+	Removed        uint64 // The number of members of the node's shard removed from the raft configuration.
+	PendingRemoval int    // The number of failed members of the node's shard waiting for the grace period to end.
+}
+
 type EventDelegate struct {
 	options EventDelegateOpts
+	mut     sync.Mutex
+	// The members of the node's shard that failed, and haven't come back yet.
+	// The timer removes the member from the raft configuration at the end of the grace period.
+	// It's nil once the member has been removed or when failed members are not removed automatically.
+	failed map[string]*time.Timer
+	stats  MembershipStats
 }
 
 type EventDelegateOpts struct {
-	incrementNodes   func()
-	decrementNodes   func()
-	removeRaftServer func(meta NodeMeta) error
+	incrementNodes      func()
+	decrementNodes      func()
+	isRaftLeader        func() bool
+	addRaftServer       func(meta NodeMeta) error
+	removeRaftServer    func(meta NodeMeta) error
+	failureGracePeriod  time.Duration
+	shardId             string
+	serverId            string
+	nodeJoined          func()
+	forgetSubscriptions func(serverId string)
 }
 
 func NewEventDelegate(opts EventDelegateOpts) *EventDelegate {
 	return &EventDelegate{
 		options: opts,
+		failed:  make(map[string]*time.Timer),
 	}
 }
 
 // NotifyJoin implements EventDelegate interface
 func (eventDelegate *EventDelegate) NotifyJoin(node *memberlist.Node) {
 	eventDelegate.options.incrementNodes()
+	if node.Name == eventDelegate.options.serverId {
+		return
+	}
+	eventDelegate.options.nodeJoined()
+
+	eventDelegate.mut.Lock()
+	defer eventDelegate.mut.Unlock()
+	eventDelegate.stats.Joined += 1
+
+	timer, failed := eventDelegate.failed[node.Name]
+	if !failed {
+		log.Printf("node %s joined the cluster\n", node.Name)
+		return
+	}
+	delete(eventDelegate.failed, node.Name)
+	eventDelegate.stats.Recovered += 1
+	if timer != nil && timer.Stop() {
+		log.Printf("node %s came back within the grace period\n", node.Name)
+	} else {
+		log.Printf("node %s came back after it was removed\n", node.Name)
+	}
+
+	// The leader adds the member back to the raft configuration if it was removed, or if its address changed.
+	var meta NodeMeta
+	if err := json.Unmarshal(node.Meta, &meta); err != nil {
+		log.Printf("could not get the metadata of node %s\n", node.Name)
+		return
+	}
+	if eventDelegate.options.isRaftLeader() {
+		// Raft configuration changes block until they're committed, so they must not hold up memberlist.
+		go func() {
+			if err := eventDelegate.options.addRaftServer(meta); err != nil {
+				log.Printf("add node %s back to the raft configuration: %v\n", node.Name, err)
+			}
+		}()
+	}
 }
 
-// NotifyLeave implements EventDelegate interface
+// NotifyLeave implements EventDelegate interface.
+// A member that leaves gracefully is removed from the raft configuration right away. A member that fails
+// is only removed if it doesn't come back within the grace period, so that a network blip doesn't shrink
+// the raft configuration.
 func (eventDelegate *EventDelegate) NotifyLeave(node *memberlist.Node) {
 	eventDelegate.options.decrementNodes()
+	eventDelegate.options.forgetSubscriptions(node.Name)
 
-	var meta NodeMeta
+	graceful := node.State == memberlist.StateLeft
 
-	err := json.Unmarshal(node.Meta, &meta)
+	eventDelegate.mut.Lock()
+	defer eventDelegate.mut.Unlock()
+	if graceful {
+		eventDelegate.stats.Left += 1
+		log.Printf("node %s left the cluster\n", node.Name)
+	} else {
+		eventDelegate.stats.Failed += 1
+		log.Printf("node %s failed\n", node.Name)
+	}
 
-	if err != nil {
+	var meta NodeMeta
+	if err := json.Unmarshal(node.Meta, &meta); err != nil {
 		log.Println("Could not get leaving node's metadata.")
 		return
 	}
 
-	err = eventDelegate.options.removeRaftServer(meta)
+	// Only the raft group of the leaving node's shard has to remove it.
+	if meta.ShardID != eventDelegate.options.shardId {
+		return
+	}
+
+	if graceful {
+		if eventDelegate.options.isRaftLeader() {
+			go eventDelegate.removeRaftServer(meta)
+		}
+		return
+	}
+
+	// Every node of the shard keeps track of the failed member, so that whichever node is the leader
+	// when the grace period ends removes it.
+	if timer := eventDelegate.failed[node.Name]; timer != nil {
+		timer.Stop()
+	}
+	eventDelegate.failed[node.Name] = nil
+	if eventDelegate.options.failureGracePeriod <= 0 {
+		log.Printf("node %s is kept in the raft configuration until it's removed manually\n", node.Name)
+		return
+	}
+	log.Printf("removing node %s from the raft configuration if it doesn't come back within %s\n",
+		node.Name, eventDelegate.options.failureGracePeriod)
+	var timer *time.Timer
+	timer = time.AfterFunc(eventDelegate.options.failureGracePeriod, func() {
+		eventDelegate.mut.Lock()
+		current, ok := eventDelegate.failed[node.Name]
+		if !ok || current != timer {
+			// The member came back, or failed again and has a new timer.
+			eventDelegate.mut.Unlock()
+			return
+		}
+		eventDelegate.failed[node.Name] = nil
+		eventDelegate.mut.Unlock()
+		if eventDelegate.options.isRaftLeader() {
+			eventDelegate.removeRaftServer(meta)
+		}
+	})
+	eventDelegate.failed[node.Name] = timer
+}
 
-	if err != nil {
-		log.Println(err)
+func (eventDelegate *EventDelegate) removeRaftServer(meta NodeMeta) {
+	if err := eventDelegate.options.removeRaftServer(meta); err != nil {
+		log.Printf("remove node %s from the raft configuration: %v\n", meta.ServerID, err)
+		return
 	}
+	eventDelegate.mut.Lock()
+	eventDelegate.stats.Removed += 1
+	eventDelegate.mut.Unlock()
+	log.Printf("removed node %s from the raft configuration\n", meta.ServerID)
 }
 
 // NotifyUpdate implements EventDelegate interface
 func (eventDelegate *EventDelegate) NotifyUpdate(node *memberlist.Node) {
 	// No-Op
 }
+
+// Stats returns the membership changes observed by the node.
+func (eventDelegate *EventDelegate) Stats() MembershipStats {
+	eventDelegate.mut.Lock()
+	defer eventDelegate.mut.Unlock()
+	stats := eventDelegate.stats
+	for _, timer := range eventDelegate.failed {
+		if timer != nil {
+			stats.PendingRemoval++
+		}
+	}
+	return stats
+}
+
+// stop cancels the pending removals.
+func (eventDelegate *EventDelegate) stop() {
+	eventDelegate.mut.Lock()
+	defer eventDelegate.mut.Unlock()
+	for name, timer := range eventDelegate.failed {
+		if timer != nil {
+			timer.Stop()
+		}
+		eventDelegate.failed[name] = nil
+	}
+}
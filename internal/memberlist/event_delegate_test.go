@@ -0,0 +1,146 @@
+// Copyright 2024 Kelvin Clement Mwinuka
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memberlist
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/memberlist"
+	"github.com/hashicorp/raft"
+)
+
+func Test_EventDelegate(t *testing.T) {
+	var mut sync.Mutex
+	var added, removed []string
+
+	newDelegate := func(gracePeriod time.Duration) *EventDelegate {
+		return NewEventDelegate(EventDelegateOpts{
+			incrementNodes: func() {},
+			decrementNodes: func() {},
+			isRaftLeader:   func() bool { return true },
+			addRaftServer: func(meta NodeMeta) error {
+				mut.Lock()
+				defer mut.Unlock()
+				added = append(added, string(meta.ServerID))
+				return nil
+			},
+			removeRaftServer: func(meta NodeMeta) error {
+				mut.Lock()
+				defer mut.Unlock()
+				removed = append(removed, string(meta.ServerID))
+				return nil
+			},
+			failureGracePeriod:  gracePeriod,
+			shardId:             "a",
+			serverId:            "node1",
+			nodeJoined:          func() {},
+			forgetSubscriptions: func(serverId string) {},
+		})
+	}
+	node := func(name string, shardId string, state memberlist.NodeStateType) *memberlist.Node {
+		meta, _ := json.Marshal(NodeMeta{ServerID: raft.ServerID(name), ShardID: shardId})
+		return &memberlist.Node{Name: name, Meta: meta, State: state}
+	}
+	// waitFor retries the check until it passes.
+	waitFor := func(t *testing.T, msg string, check func() bool) {
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			mut.Lock()
+			ok := check()
+			mut.Unlock()
+			if ok {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatal(msg)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	reset := func() {
+		mut.Lock()
+		defer mut.Unlock()
+		added, removed = nil, nil
+	}
+
+	t.Run("1. Graceful leave removes the member right away", func(t *testing.T) {
+		reset()
+		delegate := newDelegate(time.Hour)
+		delegate.NotifyLeave(node("node2", "a", memberlist.StateLeft))
+		waitFor(t, "expected node2 to be removed", func() bool { return len(removed) == 1 && removed[0] == "node2" })
+		if stats := delegate.Stats(); stats.Left != 1 || stats.Failed != 0 || stats.Removed != 1 {
+			t.Errorf("unexpected stats %+v", stats)
+		}
+	})
+
+	t.Run("2. Failed member that comes back within the grace period is kept", func(t *testing.T) {
+		reset()
+		delegate := newDelegate(200 * time.Millisecond)
+		delegate.NotifyLeave(node("node2", "a", memberlist.StateDead))
+		if stats := delegate.Stats(); stats.Failed != 1 || stats.PendingRemoval != 1 {
+			t.Errorf("unexpected stats %+v", stats)
+		}
+		delegate.NotifyJoin(node("node2", "a", memberlist.StateAlive))
+		time.Sleep(400 * time.Millisecond)
+		mut.Lock()
+		defer mut.Unlock()
+		if len(removed) != 0 {
+			t.Errorf("expected node2 to be kept, removed %v", removed)
+		}
+		if stats := delegate.Stats(); stats.Recovered != 1 || stats.PendingRemoval != 0 {
+			t.Errorf("unexpected stats %+v", stats)
+		}
+	})
+
+	t.Run("3. Failed member is removed after the grace period and added back when it returns", func(t *testing.T) {
+		reset()
+		delegate := newDelegate(50 * time.Millisecond)
+		delegate.NotifyLeave(node("node2", "a", memberlist.StateDead))
+		waitFor(t, "expected node2 to be removed", func() bool { return len(removed) == 1 })
+		if stats := delegate.Stats(); stats.Removed != 1 || stats.PendingRemoval != 0 {
+			t.Errorf("unexpected stats %+v", stats)
+		}
+		delegate.NotifyJoin(node("node2", "a", memberlist.StateAlive))
+		waitFor(t, "expected node2 to be added back", func() bool { return len(added) == 1 && added[0] == "node2" })
+	})
+
+	t.Run("4. Failed member is kept when the grace period is 0", func(t *testing.T) {
+		reset()
+		delegate := newDelegate(0)
+		delegate.NotifyLeave(node("node2", "a", memberlist.StateDead))
+		time.Sleep(100 * time.Millisecond)
+		mut.Lock()
+		defer mut.Unlock()
+		if len(removed) != 0 {
+			t.Errorf("expected node2 to be kept, removed %v", removed)
+		}
+	})
+
+	t.Run("5. Members of other shards are left to their own shard", func(t *testing.T) {
+		reset()
+		delegate := newDelegate(time.Millisecond)
+		delegate.NotifyLeave(node("node3", "b", memberlist.StateLeft))
+		delegate.NotifyLeave(node("node4", "b", memberlist.StateDead))
+		time.Sleep(100 * time.Millisecond)
+		mut.Lock()
+		defer mut.Unlock()
+		if len(removed) != 0 {
+			t.Errorf("expected no removals, removed %v", removed)
+		}
+	})
+}
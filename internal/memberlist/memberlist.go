@@ -17,6 +17,7 @@ package memberlist
 import (
 	"context"
 	"crypto/md5"
+	"encoding/json"
 	"fmt"
 	"github.com/echovault/sugardb/internal"
 	"github.com/echovault/sugardb/internal/config"
@@ -33,32 +34,66 @@ type NodeMeta struct {
 	ServerID       raft.ServerID      `json:"ServerID"`
 	MemberlistAddr string             `json:"MemberlistAddr"`
 	RaftAddr       raft.ServerAddress `json:"RaftAddr"`
+	ForwardAddr    string             `json:"ForwardAddr"`
+	ShardID        string             `json:"ShardID"`
+	ClientAddr     string             `json:"ClientAddr"` // The address that clients connect to.
+	Leader         bool               `json:"Leader"`     // Whether the node is the raft leader of its shard.
+	Replica        bool               `json:"Replica"`    // Whether the node joins its shard as a non-voting replica.
 }
 
 type Opts struct {
 	Config           config.Config
 	HasJoinedCluster func() bool
 	AddVoter         func(id raft.ServerID, address raft.ServerAddress, prevIndex uint64, timeout time.Duration) error
+	AddNonvoter      func(id raft.ServerID, address raft.ServerAddress, prevIndex uint64, timeout time.Duration) error
+	// AddRaftServer adds a member of the shard that came back after it failed to the raft configuration.
+	AddRaftServer    func(meta NodeMeta) error
 	RemoveRaftServer func(meta NodeMeta) error
 	IsRaftLeader     func() bool
 	ApplyMutate      func(ctx context.Context, cmd []string) ([]byte, error)
 	ApplyDeleteKey   func(ctx context.Context, key string) error
+	// GetShards returns the encoded slot map of the node, which is exchanged with the other nodes.
+	GetShards func() []byte
+	// MergeShards merges an encoded slot map received from another node.
+	// It reports whether the slot map of the node changed.
+	MergeShards func(b []byte) bool
+	// DeliverPublish delivers an encoded message published on another node to the subscribers of the node.
+	DeliverPublish func(b []byte)
+	// GetSubscriptions returns the encoded subscriptions of the node, which are sent to the other nodes.
+	GetSubscriptions func() []byte
+	// MergeSubscriptions records the encoded subscriptions received from another node.
+	MergeSubscriptions func(serverId string, b []byte)
+	// ForgetSubscriptions removes the subscriptions of a node that left the cluster.
+	ForgetSubscriptions func(serverId string)
 }
 
 type MemberList struct {
-	options        Opts
-	broadcastQueue *memberlist.TransmitLimitedQueue
-	noOfNodesMut   sync.RWMutex
-	noOfNodes      int
-	memberList     *memberlist.Memberlist
+	options            Opts
+	broadcastQueue     *memberlist.TransmitLimitedQueue
+	noOfNodesMut       sync.RWMutex
+	noOfNodes          int
+	memberList         *memberlist.Memberlist
+	eventDelegate      *EventDelegate
+	publishes          chan publish  // The published messages to send to the other nodes in order.
+	subscriptionsDirty chan struct{} // Signals that the subscriptions of the node changed since they were last sent.
+	stopSend           chan struct{} // Signals the goroutine that sends the messages above to stop.
+}
+
+// publish is a published message to send to the other nodes.
+type publish struct {
+	msg       *BroadcastMessage
+	shardOnly bool // Whether to only send the message to the nodes of this node's shard.
 }
 
 func NewMemberList(opts Opts) *MemberList {
 	return &MemberList{
-		options:        opts,
-		broadcastQueue: new(memberlist.TransmitLimitedQueue),
-		noOfNodesMut:   sync.RWMutex{},
-		noOfNodes:      0,
+		options:            opts,
+		broadcastQueue:     new(memberlist.TransmitLimitedQueue),
+		noOfNodesMut:       sync.RWMutex{},
+		noOfNodes:          0,
+		publishes:          make(chan publish, 4096),
+		subscriptionsDirty: make(chan struct{}, 1),
+		stopSend:           make(chan struct{}),
 	}
 }
 
@@ -69,14 +104,19 @@ func (m *MemberList) MemberListInit(ctx context.Context) {
 	cfg.BindAddr = m.options.Config.BindAddr
 	cfg.BindPort = int(m.options.Config.DiscoveryPort)
 	cfg.Delegate = NewDelegate(DelegateOpts{
-		config:         m.options.Config,
-		broadcastQueue: m.broadcastQueue,
-		addVoter:       m.options.AddVoter,
-		isRaftLeader:   m.options.IsRaftLeader,
-		applyMutate:    m.options.ApplyMutate,
-		applyDeleteKey: m.options.ApplyDeleteKey,
+		config:             m.options.Config,
+		broadcastQueue:     m.broadcastQueue,
+		addVoter:           m.options.AddVoter,
+		addNonvoter:        m.options.AddNonvoter,
+		isRaftLeader:       m.options.IsRaftLeader,
+		applyMutate:        m.options.ApplyMutate,
+		applyDeleteKey:     m.options.ApplyDeleteKey,
+		getShards:          m.options.GetShards,
+		mergeShards:        m.options.MergeShards,
+		deliverPublish:     m.options.DeliverPublish,
+		mergeSubscriptions: m.options.MergeSubscriptions,
 	})
-	cfg.Events = NewEventDelegate(EventDelegateOpts{
+	m.eventDelegate = NewEventDelegate(EventDelegateOpts{
 		incrementNodes: func() {
 			m.noOfNodesMut.Lock()
 			defer m.noOfNodesMut.Unlock()
@@ -87,8 +127,18 @@ func (m *MemberList) MemberListInit(ctx context.Context) {
 			defer m.noOfNodesMut.Unlock()
 			m.noOfNodes -= 1
 		},
-		removeRaftServer: m.options.RemoveRaftServer,
+		isRaftLeader:       m.options.IsRaftLeader,
+		addRaftServer:      m.options.AddRaftServer,
+		removeRaftServer:   m.options.RemoveRaftServer,
+		failureGracePeriod: m.options.Config.FailureGracePeriod,
+		shardId:            m.options.Config.ShardID,
+		serverId:           m.options.Config.ServerID,
+		// Send the subscriptions of this node to the nodes that join, and forget the subscriptions
+		// of the nodes that leave.
+		nodeJoined:          m.SubscriptionsChanged,
+		forgetSubscriptions: m.options.ForgetSubscriptions,
 	})
+	cfg.Events = m.eventDelegate
 
 	m.broadcastQueue.RetransmitMult = 1
 	m.broadcastQueue.NumNodes = func() int {
@@ -105,6 +155,8 @@ func (m *MemberList) MemberListInit(ctx context.Context) {
 		log.Fatal(err)
 	}
 
+	go m.send()
+
 	if m.options.Config.JoinAddr != "" {
 		backoffPolicy := internal.RetryBackoff(retry.NewFibonacci(1*time.Second), 5, 200*time.Millisecond, 0, 0)
 
@@ -120,7 +172,10 @@ func (m *MemberList) MemberListInit(ctx context.Context) {
 			log.Fatal(err)
 		}
 
-		m.broadcastRaftAddress()
+		// The node that bootstraps a shard is the first member of its raft group.
+		if !m.options.Config.BootstrapCluster {
+			m.broadcastRaftAddress()
+		}
 	}
 }
 
@@ -128,9 +183,11 @@ func (m *MemberList) broadcastRaftAddress() {
 	msg := BroadcastMessage{
 		Action: "RaftJoin",
 		NodeMeta: NodeMeta{
+			ShardID:  m.options.Config.ShardID,
 			ServerID: raft.ServerID(m.options.Config.ServerID),
 			RaftAddr: raft.ServerAddress(fmt.Sprintf("%s:%d",
 				m.options.Config.RaftBindAddr, m.options.Config.RaftBindPort)),
+			Replica: m.options.Config.Replica,
 		},
 	}
 	m.broadcastQueue.QueueBroadcast(&msg)
@@ -146,6 +203,7 @@ func (m *MemberList) ForwardDeleteKey(ctx context.Context, key string) {
 		ContentHash: md5.Sum([]byte(key)),
 		ConnId:      connId,
 		NodeMeta: NodeMeta{
+			ShardID:  m.options.Config.ShardID,
 			ServerID: raft.ServerID(m.options.Config.ServerID),
 			RaftAddr: raft.ServerAddress(fmt.Sprintf("%s:%d",
 				m.options.Config.BindAddr, m.options.Config.RaftBindPort)),
@@ -153,24 +211,153 @@ func (m *MemberList) ForwardDeleteKey(ctx context.Context, key string) {
 	})
 }
 
-// The ForwardDataMutation function is only called by non-leaders.
-// It uses the broadcast queue to forward a data mutation within the cluster.
-func (m *MemberList) ForwardDataMutation(ctx context.Context, cmd []byte) {
-	connId, _ := ctx.Value(internal.ContextConnID("ConnectionID")).(string)
-	m.broadcastQueue.QueueBroadcast(&BroadcastMessage{
-		Action:      "MutateData",
-		Content:     cmd,
-		ContentHash: md5.Sum(cmd),
-		ConnId:      connId,
+// BroadcastShards sends the encoded slot map of the node to the other nodes.
+// The update is sent to every member directly, as gossip only reaches a few of them,
+// and the nodes that miss it would otherwise only catch up in the next push/pull sync.
+func (m *MemberList) BroadcastShards(b []byte) {
+	msg := &BroadcastMessage{
+		Action:      "ShardUpdate",
+		Content:     b,
+		ContentHash: md5.Sum(b),
 		NodeMeta: NodeMeta{
+			ShardID:  m.options.Config.ShardID,
 			ServerID: raft.ServerID(m.options.Config.ServerID),
-			RaftAddr: raft.ServerAddress(fmt.Sprintf("%s:%d",
-				m.options.Config.BindAddr, m.options.Config.RaftBindPort)),
 		},
-	})
+	}
+	if m.memberList == nil {
+		m.broadcastQueue.QueueBroadcast(msg)
+		return
+	}
+	go m.sendToMembers(msg, false)
+}
+
+// BroadcastPublish sends an encoded published message to the other nodes, or only to the other nodes
+// of this node's shard when shardOnly is true. The messages are sent to every node directly and in the
+// order they're published.
+func (m *MemberList) BroadcastPublish(b []byte, shardOnly bool) {
+	if m.memberList == nil {
+		return
+	}
+	m.publishes <- publish{
+		msg: &BroadcastMessage{
+			Action:      "Publish",
+			Content:     b,
+			ContentHash: md5.Sum(b),
+			NodeMeta: NodeMeta{
+				ShardID:  m.options.Config.ShardID,
+				ServerID: raft.ServerID(m.options.Config.ServerID),
+			},
+		},
+		shardOnly: shardOnly,
+	}
+}
+
+// SubscriptionsChanged schedules sending the subscriptions of the node to the other nodes.
+// Changes that happen before the subscriptions are sent are sent together.
+func (m *MemberList) SubscriptionsChanged() {
+	select {
+	case m.subscriptionsDirty <- struct{}{}:
+	default:
+	}
+}
+
+// send sends the published messages and the subscriptions of the node to the other nodes until the
+// memberlist shuts down.
+func (m *MemberList) send() {
+	for {
+		select {
+		case <-m.stopSend:
+			return
+		case p := <-m.publishes:
+			m.sendToMembers(p.msg, p.shardOnly)
+		case <-m.subscriptionsDirty:
+			b := m.options.GetSubscriptions()
+			m.sendToMembers(&BroadcastMessage{
+				Action:      "Subscriptions",
+				Content:     b,
+				ContentHash: md5.Sum(b),
+				NodeMeta: NodeMeta{
+					ShardID:  m.options.Config.ShardID,
+					ServerID: raft.ServerID(m.options.Config.ServerID),
+				},
+			}, false)
+		}
+	}
+}
+
+// sendToMembers sends the message to every other member directly, as gossip only reaches a few of them.
+func (m *MemberList) sendToMembers(msg *BroadcastMessage, shardOnly bool) {
+	for _, node := range m.memberList.Members() {
+		if node.Name == m.options.Config.ServerID {
+			continue
+		}
+		if shardOnly {
+			var meta NodeMeta
+			if err := json.Unmarshal(node.Meta, &meta); err != nil || meta.ShardID != m.options.Config.ShardID {
+				continue
+			}
+		}
+		if err := m.memberList.SendReliable(node, msg.Message()); err != nil {
+			log.Printf("send %s to %s: %v\n", msg.Action, node.Name, err)
+		}
+	}
+}
+
+// UpdateNodeMeta sends the latest metadata of the node to the other nodes,
+// e.g. after the node becomes or stops being the leader of its shard.
+func (m *MemberList) UpdateNodeMeta() {
+	if m.memberList == nil {
+		return
+	}
+	if err := m.memberList.UpdateNode(time.Second); err != nil {
+		log.Printf("memberlist update node: %v\n", err)
+	}
+}
+
+// NodeMetas returns the metadata of all the cluster members, including this node.
+func (m *MemberList) NodeMetas() []NodeMeta {
+	var metas []NodeMeta
+	if m.memberList == nil {
+		return metas
+	}
+	for _, node := range m.memberList.Members() {
+		var meta NodeMeta
+		if err := json.Unmarshal(node.Meta, &meta); err != nil {
+			continue
+		}
+		metas = append(metas, meta)
+	}
+	return metas
+}
+
+// GetNodeMeta returns the metadata of the cluster member with the given server id.
+// The boolean is false if the member is not known to this node.
+func (m *MemberList) GetNodeMeta(serverId string) (NodeMeta, bool) {
+	for _, node := range m.memberList.Members() {
+		if node.Name != serverId {
+			continue
+		}
+		var meta NodeMeta
+		if err := json.Unmarshal(node.Meta, &meta); err != nil {
+			return NodeMeta{}, false
+		}
+		return meta, true
+	}
+	return NodeMeta{}, false
+}
+
+// MembershipStats returns the membership changes observed by the node since it started.
+func (m *MemberList) MembershipStats() MembershipStats {
+	if m.eventDelegate == nil {
+		return MembershipStats{}
+	}
+	return m.eventDelegate.Stats()
 }
 
 func (m *MemberList) MemberListShutdown() {
+	close(m.stopSend)
+	m.eventDelegate.stop()
+
 	// Gracefully leave memberlist cluster
 	err := m.memberList.Leave(500 * time.Millisecond)
 	if err != nil {
@@ -0,0 +1,131 @@
+// Copyright 2024 Kelvin Clement Mwinuka
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package migrate moves keys to another SugarDB instance. MIGRATE and the slot rebalancing
+// send the keys as DUMP payloads, which the target stores with RESTORE.
+package migrate
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/echovault/sugardb/internal"
+	"github.com/tidwall/resp"
+)
+
+// ReplyError is an error reply from the other instance.
+type ReplyError struct {
+	message string
+}
+
+func (err *ReplyError) Error() string {
+	return err.message
+}
+
+// Client sends commands to another SugarDB instance over RESP.
+type Client struct {
+	conn    net.Conn
+	reader  *resp.Reader
+	timeout time.Duration
+}
+
+// Dial connects to the instance at addr. When auth holds a password, or a username and a password,
+// the connection is authenticated before it's returned.
+func Dial(ctx context.Context, addr string, timeout time.Duration, auth []string) (*Client, error) {
+	dialer := net.Dialer{Timeout: timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	client := &Client{conn: conn, reader: resp.NewReader(conn), timeout: timeout}
+	if len(auth) > 0 {
+		if _, err = client.Do(append([]string{"AUTH"}, auth...)...); err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+	}
+	return client, nil
+}
+
+// Do sends the command and returns the reply. An error reply is returned as a *ReplyError.
+func (client *Client) Do(cmd ...string) (resp.Value, error) {
+	if client.timeout > 0 {
+		_ = client.conn.SetDeadline(time.Now().Add(client.timeout))
+	}
+	if _, err := client.conn.Write(internal.EncodeCommand(cmd)); err != nil {
+		return resp.Value{}, err
+	}
+	value, _, err := client.reader.ReadValue()
+	if err != nil {
+		return resp.Value{}, err
+	}
+	if value.Type() == resp.Error {
+		// Generic errors are prefixed by the server, cluster errors such as MOVED are not.
+		return resp.Value{}, &ReplyError{message: strings.TrimPrefix(value.Error().Error(), "Error ")}
+	}
+	return value, nil
+}
+
+func (client *Client) Close() error {
+	return client.conn.Close()
+}
+
+// Entry is a key to migrate.
+type Entry struct {
+	Key     string
+	Payload []byte        // The DUMP payload of the value.
+	TTL     time.Duration // The remaining time to live of the key. Zero when the key does not expire.
+}
+
+type Options struct {
+	Addr     string        // The address of the target instance.
+	Database int           // The database of the target instance that the keys are stored in.
+	Timeout  time.Duration // The upper limit of each round trip with the target.
+	Replace  bool          // Whether to replace the keys that already exist on the target.
+	Auth     []string      // A password, or a username and a password, to authenticate with the target.
+}
+
+// Send stores the entries on the target instance.
+// The entries are sent with RESTORE-ASKING, so that the target accepts the keys of a slot that it's importing.
+func Send(ctx context.Context, options Options, entries []Entry) error {
+	client, err := Dial(ctx, options.Addr, options.Timeout, options.Auth)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = client.Close()
+	}()
+
+	if _, err = client.Do("SELECT", strconv.Itoa(options.Database)); err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		ttl := entry.TTL.Milliseconds()
+		if entry.TTL > 0 && ttl == 0 {
+			// Don't let a key that's about to expire become persistent.
+			ttl = 1
+		}
+		cmd := []string{"RESTORE-ASKING", entry.Key, strconv.FormatInt(ttl, 10), string(entry.Payload)}
+		if options.Replace {
+			cmd = append(cmd, "REPLACE")
+		}
+		if _, err = client.Do(cmd...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -16,12 +16,11 @@ package acl
 
 import (
 	"context"
-	"crypto/sha256"
-	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/echovault/sugardb/internal"
+	"github.com/echovault/sugardb/internal/clock"
 	"github.com/echovault/sugardb/internal/config"
 	"github.com/echovault/sugardb/internal/constants"
 	"github.com/gobwas/glob"
@@ -32,14 +31,18 @@ import (
 	"path"
 	"reflect"
 	"slices"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 )
 
 type Connection struct {
-	Authenticated bool  // Whether the connection has been authenticated
-	User          *User // The user the connection is associated with
+	Authenticated bool      // Whether the connection has been authenticated
+	User          *User     // The user the connection is associated with
+	ExpiresAt     time.Time // When the credential the connection authenticated with expires, zero if it does not
+	Expired       bool      // Whether the connection must authenticate again because its credential expired
+	Rules         []string  // The rules of the identity the connection authenticated with, nil if it has none
 }
 
 type ACL struct {
@@ -48,6 +51,20 @@ type ACL struct {
 	Connections  map[*net.Conn]Connection // Connections to the echovault that are currently registered with the ACL module
 	Config       config.Config            // SugarDB configuration that contains the relevant ACL config options
 	GlobPatterns map[string]glob.Glob
+	denialLog    *denialLog     // Log of denied authentications and commands
+	hasher       passwordHasher // Hashes the plaintext passwords added to users
+
+	terminated map[*net.Conn]struct{} // Connections terminated by the ACL that the server must stop serving
+
+	authenticators []Authenticator // Verify the AUTH credentials that are not passwords, e.g. JWTs
+	clock          clock.Clock
+
+	keyspace     func(yield func(database int, key string, memory int64)) // Ranges over the keys for the quotas
+	keyspaceLock sync.Locker                                              // Keeps the keys from changing during a range
+	keyQuotas    keyQuotas                                                // Usage of the keys and memory quotas
+	usage        map[string]*quotaUsage                                   // Usage of the rate limits of each user
+	rejected     uint64                                                   // Commands and connections rejected by the quotas
+	usageMutex   sync.Mutex
 }
 
 func loadUsersFromConfigFile(filePath string) []*User {
@@ -92,7 +109,7 @@ func loadUsersFromConfigFile(filePath string) []*User {
 	return users
 }
 
-func NewACL(config config.Config) *ACL {
+func NewACL(config config.Config, options ...func(acl *ACL)) *ACL {
 	var users []*User
 
 	// 1. Initialise default ACL user
@@ -102,7 +119,7 @@ func NewACL(config config.Config) *ACL {
 		defaultUser.Passwords = []Password{
 			{
 				PasswordType:  GetPasswordType(config.Password),
-				PasswordValue: config.Password,
+				PasswordValue: strings.TrimPrefix(config.Password, "#"),
 			},
 		}
 	}
@@ -122,25 +139,61 @@ func NewACL(config config.Config) *ACL {
 		users = append([]*User{defaultUser}, users...)
 	}
 
-	// 4. Normalise all users
+	// 4. Normalise all users, and skip the users with a password hash that can't be verified.
 	for _, user := range users {
 		user.Normalise()
 	}
+	users = slices.DeleteFunc(users, func(user *User) bool {
+		if err := user.validatePasswords(); err != nil {
+			log.Printf("load ACL config: %v\n", err)
+			return true
+		}
+		return false
+	})
 
 	acl := ACL{
 		Users:        users,
 		UsersMutex:   sync.RWMutex{},
 		Connections:  make(map[*net.Conn]Connection),
+		terminated:   make(map[*net.Conn]struct{}),
 		Config:       config,
 		GlobPatterns: make(map[string]glob.Glob),
+		denialLog:    newDenialLog(config.AclLogMaxLen),
+		hasher:       newPasswordHasher(config),
+		clock:        clock.NewClock(),
+		usage:        make(map[string]*quotaUsage),
+	}
+
+	for _, option := range options {
+		option(&acl)
+	}
+
+	if jwtAuthenticator, err := NewJWTAuthenticator(config); err != nil {
+		log.Printf("jwt authenticator: %v\n", err)
+	} else if jwtAuthenticator != nil {
+		acl.AddAuthenticator(jwtAuthenticator)
 	}
 
 	acl.CompileGlobs()
+	acl.trackKeyQuotas()
 
 	return &acl
 }
 
-func (acl *ACL) RegisterConnection(conn *net.Conn) {
+// RegisterConnection associates a new connection with the default user, or with the user that its
+// client certificate maps to when --acl-cert-user-field is set. The connection must be closed when an
+// error is returned, which happens when the certificate maps to an unknown or disabled user.
+func (acl *ACL) RegisterConnection(conn *net.Conn) error {
+	// Complete the TLS handshake before locking the users, as it waits on the client.
+	var usernames []string
+	var hasCert bool
+	if acl.Config.AclCertUserField != "" {
+		var err error
+		if usernames, hasCert, err = certificateUsernames(*conn, acl.Config.AclCertUserField, acl.Config.AclCertUserOID); err != nil {
+			return err
+		}
+	}
+
 	acl.LockUsers()
 	defer acl.UnlockUsers()
 
@@ -149,10 +202,104 @@ func (acl *ACL) RegisterConnection(conn *net.Conn) {
 		return user.Username == "default"
 	})
 	defaultUser := acl.Users[defaultUserIdx]
+
+	if !hasCert {
+		if err := acl.checkMaxConnections(conn, defaultUser); err != nil {
+			acl.denialLog.add(LogReasonQuota, "CONNECT", defaultUser.Username, clientInfo(conn))
+			return err
+		}
+		acl.Connections[conn] = Connection{
+			Authenticated: defaultUser.NoPassword,
+			User:          defaultUser,
+		}
+		return nil
+	}
+
+	// Use the first name in the certificate that belongs to a user.
+	var user *User
+	for _, username := range usernames {
+		if idx := slices.IndexFunc(acl.Users, func(u *User) bool {
+			return u.Username == username
+		}); idx != -1 {
+			user = acl.Users[idx]
+			break
+		}
+	}
+	if user == nil {
+		username := ""
+		if len(usernames) > 0 {
+			username = usernames[0]
+		}
+		acl.denialLog.add(LogReasonAuth, "CERT", username, clientInfo(conn))
+		return errors.New("client certificate does not map to a user")
+	}
+	if !user.Enabled {
+		acl.denialLog.add(LogReasonAuth, "CERT", user.Username, clientInfo(conn))
+		return fmt.Errorf("user %s is disabled", user.Username)
+	}
+	if err := acl.checkMaxConnections(conn, user); err != nil {
+		acl.denialLog.add(LogReasonQuota, "CERT", user.Username, clientInfo(conn))
+		return err
+	}
+
 	acl.Connections[conn] = Connection{
-		Authenticated: defaultUser.NoPassword,
-		User:          defaultUser,
+		Authenticated: user.NoPassword || acl.Config.AclCertNoPassword,
+		User:          user,
 	}
+	return nil
+}
+
+// UnregisterConnection removes a closed connection, so that it no longer counts towards its user's connections.
+func (acl *ACL) UnregisterConnection(conn *net.Conn) {
+	acl.LockUsers()
+	defer acl.UnlockUsers()
+	if connection, ok := acl.Connections[conn]; ok {
+		delete(acl.Connections, conn)
+		acl.untrackUser(connection.User)
+	}
+	delete(acl.terminated, conn)
+}
+
+// Terminated returns true when the connection was terminated, e.g. because its user was deleted.
+// The server must stop serving the connection, even if it resets the read deadline that terminated it.
+func (acl *ACL) Terminated(conn *net.Conn) bool {
+	acl.RLockUsers()
+	defer acl.RUnlockUsers()
+	_, ok := acl.terminated[conn]
+	return ok
+}
+
+// terminateConnection marks the connection as terminated and interrupts its pending read.
+// The caller must hold the users lock.
+func (acl *ACL) terminateConnection(conn *net.Conn) {
+	acl.terminated[conn] = struct{}{}
+	_ = (*conn).SetReadDeadline(time.Now().Add(-1 * time.Second))
+}
+
+// Username returns the username of the user the connection is associated with.
+func (acl *ACL) Username(conn *net.Conn) string {
+	acl.RLockUsers()
+	defer acl.RUnlockUsers()
+	if connection, ok := acl.Connections[conn]; ok && connection.User != nil {
+		return connection.User.Username
+	}
+	return ""
+}
+
+// ForwardedUser returns the username and the rules that the commands of the connection are forwarded to the leader
+// with, so that the leader can authorize them again. The rules are nil unless the connection's user is not in the
+// list of users, i.e. it was created from the rules of an identity, as the leader does not know it.
+func (acl *ACL) ForwardedUser(conn *net.Conn) (string, []string) {
+	acl.RLockUsers()
+	defer acl.RUnlockUsers()
+	connection, ok := acl.Connections[conn]
+	if !ok || connection.User == nil {
+		return "", nil
+	}
+	if slices.Contains(acl.Users, connection.User) {
+		return connection.User.Username, nil
+	}
+	return connection.User.Username, connection.Rules
 }
 
 func (acl *ACL) SetUser(cmd []string) error {
@@ -165,10 +312,13 @@ func (acl *ACL) SetUser(cmd []string) error {
 		if user.Username == cmd[0] {
 			if err := user.UpdateUser(cmd); err != nil {
 				return err
-			} else {
-				acl.CompileGlobs()
-				return nil
 			}
+			if err := acl.hashPasswords(user); err != nil {
+				return err
+			}
+			acl.CompileGlobs()
+			acl.trackKeyQuotas()
+			return nil
 		}
 	}
 
@@ -176,6 +326,9 @@ func (acl *ACL) SetUser(cmd []string) error {
 	if err := user.UpdateUser(cmd); err != nil {
 		return err
 	}
+	if err := acl.hashPasswords(user); err != nil {
+		return err
+	}
 
 	user.Normalise()
 
@@ -183,6 +336,7 @@ func (acl *ACL) SetUser(cmd []string) error {
 	acl.Users = append(acl.Users, user)
 
 	acl.CompileGlobs()
+	acl.trackKeyQuotas()
 
 	return nil
 }
@@ -210,7 +364,7 @@ func (acl *ACL) DeleteUser(_ context.Context, usernames []string) error {
 		// Terminate every connection attached to this user
 		for connRef, connection := range acl.Connections {
 			if connection.User.Username == user.Username {
-				_ = (*connRef).SetReadDeadline(time.Now().Add(-1 * time.Second))
+				acl.terminateConnection(connRef)
 			}
 		}
 		// Delete the user from the ACL
@@ -218,55 +372,239 @@ func (acl *ACL) DeleteUser(_ context.Context, usernames []string) error {
 			return u.Username == user.Username
 		})
 	}
+	acl.trackKeyQuotas()
 	return nil
 }
 
-func (acl *ACL) AuthenticateConnection(_ context.Context, conn *net.Conn, cmd []string) error {
-	var passwords []Password
-	var user *User
+// LoadUsers loads the users from the ACL config file. In "merge" mode, the loaded users are merged into
+// the existing users with the same username. Otherwise, they replace them. Loaded users that don't exist yet are added.
+// In "sync" mode, the users that are not in the file are also deleted, except the default user, and their connections
+// are terminated.
+func (acl *ACL) LoadUsers(mode string) error {
+	acl.LockUsers()
+	defer acl.UnlockUsers()
 
-	if len(cmd) == 2 {
-		// Process AUTH <password>
-		h := sha256.New()
-		h.Write([]byte(cmd[1]))
-		passwords = []Password{
-			{PasswordType: PasswordPlainText, PasswordValue: cmd[1]},
-			{PasswordType: PasswordSHA256, PasswordValue: hex.EncodeToString(h.Sum(nil))},
-		}
-		// Authenticate with default user
-		idx := slices.IndexFunc(acl.Users, func(user *User) bool {
-			return user.Username == "default"
-		})
-		user = acl.Users[idx]
+	f, err := os.OpenFile(acl.Config.AclConfig, os.O_RDONLY, os.ModePerm)
+	if err != nil {
+		return err
 	}
 
-	if len(cmd) == 3 {
-		// Process AUTH <username> <password>
-		h := sha256.New()
-		h.Write([]byte(cmd[2]))
-		passwords = []Password{
-			{PasswordType: PasswordPlainText, PasswordValue: cmd[2]},
-			{PasswordType: PasswordSHA256, PasswordValue: hex.EncodeToString(h.Sum(nil))},
+	defer func() {
+		if err := f.Close(); err != nil {
+			log.Println(err)
+		}
+	}()
+
+	ext := path.Ext(f.Name())
+
+	var users []*User
+
+	if strings.ToLower(ext) == ".json" {
+		if err := json.NewDecoder(f).Decode(&users); err != nil {
+			return err
+		}
+	}
+
+	if slices.Contains([]string{".yaml", ".yml"}, strings.ToLower(ext)) {
+		if err := yaml.NewDecoder(f).Decode(&users); err != nil {
+			return err
 		}
-		// Find user with the specified username
+	}
+
+	// Normalise each user, and check their password hashes before changing any user.
+	for _, user := range users {
+		user.Normalise()
+		if err := user.validatePasswords(); err != nil {
+			return err
+		}
+	}
+	for _, user := range users {
+		// Traverse the list of users.
 		userFound := false
 		for _, u := range acl.Users {
-			if u.Username == cmd[1] {
-				user = u
+			if u.Username == user.Username {
 				userFound = true
+				// If we have a user with the current username and are in merge mode, merge the two users.
+				if strings.EqualFold(mode, "merge") {
+					u.Merge(user)
+				} else {
+					// If we have a user with the current username and are in replace mode, replace the user.
+					u.Replace(user)
+				}
 				break
 			}
 		}
+		// If there is no user with current loaded username is already in acl list, then append the user to the list
 		if !userFound {
-			return fmt.Errorf("no user with username %s", cmd[1])
+			acl.Users = append(acl.Users, user)
+		}
+	}
+
+	if strings.EqualFold(mode, "sync") {
+		acl.Users = slices.DeleteFunc(acl.Users, func(u *User) bool {
+			if u.Username == "default" || slices.ContainsFunc(users, func(user *User) bool {
+				return user.Username == u.Username
+			}) {
+				return false
+			}
+			// Terminate every connection attached to the deleted user
+			for connRef, connection := range acl.Connections {
+				if connection.User.Username == u.Username {
+					acl.terminateConnection(connRef)
+				}
+			}
+			return true
+		})
+	}
+
+	acl.CompileGlobs()
+	acl.trackKeyQuotas()
+
+	return nil
+}
+
+// MarshalUsers returns the JSON encoded list of users.
+func (acl *ACL) MarshalUsers() ([]byte, error) {
+	acl.RLockUsers()
+	defer acl.RUnlockUsers()
+	return json.Marshal(acl.Users)
+}
+
+// RestoreUsers replaces the list of users with the JSON encoded list of users.
+// Connections are moved to the restored user with the same username, and the connections of
+// users that no longer exist are terminated.
+func (acl *ACL) RestoreUsers(b []byte) error {
+	var users []*User
+	if err := json.Unmarshal(b, &users); err != nil {
+		return err
+	}
+	if !slices.ContainsFunc(users, func(user *User) bool {
+		return user.Username == "default"
+	}) {
+		return errors.New("restored users do not include the default user")
+	}
+	for _, user := range users {
+		user.Normalise()
+		if err := user.validatePasswords(); err != nil {
+			return err
+		}
+	}
+
+	acl.LockUsers()
+	defer acl.UnlockUsers()
+
+	acl.Users = users
+	acl.CompileGlobs()
+	acl.trackKeyQuotas()
+
+	for connRef, connection := range acl.Connections {
+		idx := slices.IndexFunc(users, func(user *User) bool {
+			return user.Username == connection.User.Username
+		})
+		if idx == -1 {
+			acl.terminateConnection(connRef)
+			continue
+		}
+		connection.User = users[idx]
+		acl.Connections[connRef] = connection
+	}
+
+	return nil
+}
+
+// inCluster returns true when the server is part of a cluster, where the users are replicated with raft.
+func (acl *ACL) inCluster() bool {
+	return acl.Config.BootstrapCluster || acl.Config.JoinAddr != ""
+}
+
+// AddAuthenticator adds an authenticator that AUTH credentials are verified with before the users' passwords.
+func (acl *ACL) AddAuthenticator(authenticator Authenticator) {
+	acl.LockUsers()
+	defer acl.UnlockUsers()
+	acl.authenticators = append(acl.authenticators, authenticator)
+}
+
+// AuthenticationConfigured returns true when the clients can authenticate, i.e. there is an authenticator
+// or an enabled user with a password.
+func (acl *ACL) AuthenticationConfigured() bool {
+	acl.RLockUsers()
+	defer acl.RUnlockUsers()
+	if len(acl.authenticators) > 0 {
+		return true
+	}
+	return slices.ContainsFunc(acl.Users, func(user *User) bool {
+		return user.Enabled && len(user.Passwords) > 0
+	})
+}
+
+func (acl *ACL) AuthenticateConnection(ctx context.Context, conn *net.Conn, cmd []string) error {
+	var username, credential string
+	deniedUsername := "default"
+
+	if len(cmd) == 2 {
+		// Process AUTH <password>
+		credential = cmd[1]
+	}
+
+	if len(cmd) == 3 {
+		// Process AUTH <username> <password>
+		username, credential = cmd[1], cmd[2]
+		deniedUsername = username
+	}
+
+	// Try the authenticators first, so that AUTH <token> does not authenticate the default user.
+	var authenticatorErr error
+	for _, authenticator := range acl.authenticators {
+		identity, err := authenticator.Authenticate(ctx, username, credential)
+		if errors.Is(err, ErrUnsupportedCredential) {
+			continue
+		}
+		if err == nil {
+			if err = acl.authenticateIdentity(conn, identity); err == nil {
+				return nil
+			}
+			deniedUsername = identity.Username
+		}
+		authenticatorErr = fmt.Errorf("%s: %v", authenticator.Name(), err)
+		break
+	}
+
+	if err := acl.authenticatePassword(conn, username, credential); err != nil {
+		acl.denialLog.add(LogReasonAuth, "AUTH", deniedUsername, clientInfo(conn))
+		if authenticatorErr != nil {
+			return authenticatorErr
 		}
+		return err
 	}
+	return nil
+}
+
+// authenticatePassword authenticates the connection with the user's passwords.
+// The default user is authenticated when the username is empty.
+func (acl *ACL) authenticatePassword(conn *net.Conn, username string, password string) error {
+	if username == "" {
+		username = "default"
+	}
+
+	// Find user with the specified username
+	idx := slices.IndexFunc(acl.Users, func(user *User) bool {
+		return user.Username == username
+	})
+	if idx == -1 {
+		return fmt.Errorf("no user with username %s", username)
+	}
+	user := acl.Users[idx]
 
 	// If user is not enabled, return error
 	if !user.Enabled {
 		return fmt.Errorf("user %s is disabled", user.Username)
 	}
 
+	// If the user has reached their max connections, return error
+	if err := acl.checkMaxConnections(conn, user); err != nil {
+		return err
+	}
+
 	// If user is set to NoPassword, then immediately authenticate connection without considering the password
 	if user.NoPassword {
 		acl.Connections[conn] = Connection{
@@ -276,62 +614,129 @@ func (acl *ACL) AuthenticateConnection(_ context.Context, conn *net.Conn, cmd []
 		return nil
 	}
 
-	for _, userPassword := range user.Passwords {
-		for _, password := range passwords {
-			if userPassword.PasswordType == password.PasswordType &&
-				userPassword.PasswordValue == password.PasswordValue &&
-				user.Enabled {
-				// Set the current connection to the selected user and set them as authenticated.
-				acl.Connections[conn] = Connection{
-					Authenticated: true,
-					User:          user,
-				}
-				return nil
+	for i, userPassword := range user.Passwords {
+		if !userPassword.verify(password) {
+			continue
+		}
+		// Migrate the password to the configured hash now that the plaintext password is known.
+		// In cluster mode, the users only change through raft, so the passwords are not migrated.
+		if !acl.inCluster() && acl.hasher.needsRehash(userPassword) {
+			if hashed, err := acl.hasher.hash(Password{PasswordType: PasswordPlainText, PasswordValue: password}); err != nil {
+				log.Printf("rehash password of user %s: %v\n", user.Username, err)
+			} else {
+				user.Passwords[i] = hashed
+				user.Normalise()
 			}
 		}
+		// Set the current connection to the selected user and set them as authenticated.
+		acl.Connections[conn] = Connection{
+			Authenticated: true,
+			User:          user,
+		}
+		return nil
 	}
 
 	return errors.New("could not authenticate user")
 }
 
-func (acl *ACL) AuthorizeConnection(conn *net.Conn, cmd []string, command internal.Command, subCommand internal.SubCommand) error {
+// authenticateIdentity authenticates the connection with an identity verified by an authenticator.
+// When the identity has rules, the connection gets a user with those rules that is not added to the list of users.
+// Otherwise, the connection is associated with the existing user with the identity's username.
+func (acl *ACL) authenticateIdentity(conn *net.Conn, identity Identity) error {
+	var user *User
+	if idx := slices.IndexFunc(acl.Users, func(u *User) bool {
+		return u.Username == identity.Username
+	}); idx != -1 {
+		user = acl.Users[idx]
+		if !user.Enabled {
+			return fmt.Errorf("user %s is disabled", user.Username)
+		}
+	}
+
+	if identity.Rules != nil {
+		user = CreateUser(identity.Username)
+		if err := user.UpdateUser(identity.Rules); err != nil {
+			return err
+		}
+		if !user.Enabled {
+			return fmt.Errorf("user %s is disabled", user.Username)
+		}
+		user.Normalise()
+		if err := acl.compileUserGlobs(user); err != nil {
+			return err
+		}
+	} else if user == nil {
+		return fmt.Errorf("no user with username %s", identity.Username)
+	}
+	if err := acl.checkMaxConnections(conn, user); err != nil {
+		return err
+	}
+
+	acl.Connections[conn] = Connection{
+		Authenticated: true,
+		User:          user,
+		ExpiresAt:     identity.ExpiresAt,
+		Rules:         identity.Rules,
+	}
+	if !identity.ExpiresAt.IsZero() {
+		time.AfterFunc(identity.ExpiresAt.Sub(acl.clock.Now()), func() {
+			acl.expireConnection(conn, identity.ExpiresAt)
+		})
+	}
+	return nil
+}
+
+// expireConnection applies --acl-jwt-expiry-action to a connection when its credential expires.
+// Nothing happens if the connection has authenticated again since.
+func (acl *ACL) expireConnection(conn *net.Conn, expiresAt time.Time) {
+	acl.LockUsers()
+	defer acl.UnlockUsers()
+
+	connection, ok := acl.Connections[conn]
+	if !ok || !connection.ExpiresAt.Equal(expiresAt) {
+		return
+	}
+
+	// The connection falls back to the default user until it authenticates again.
+	idx := slices.IndexFunc(acl.Users, func(user *User) bool {
+		return user.Username == "default"
+	})
+	acl.Connections[conn] = Connection{
+		Authenticated: acl.Users[idx].NoPassword,
+		User:          acl.Users[idx],
+		Expired:       true,
+	}
+
+	if acl.Config.AclJWTExpiryAction == JWTExpiryDisconnect {
+		acl.terminateConnection(conn)
+	}
+}
+
+func (acl *ACL) AuthorizeConnection(ctx context.Context, conn *net.Conn, cmd []string, command internal.Command, subCommand internal.SubCommand) error {
 	acl.RLockUsers()
 	defer acl.RUnlockUsers()
 
 	// Extract command, categories, and keys
-	comm := command.Command
-	categories := command.Categories
-
-	keys, err := command.KeyExtractionFunc(cmd)
+	comm, categories, keys, err := getCommandDetails(cmd, command, subCommand)
 	if err != nil {
 		return err
 	}
 
-	channels := keys.Channels
-	readKeys := keys.ReadKeys
-	writeKeys := keys.WriteKeys
-
-	if !reflect.DeepEqual(subCommand, internal.SubCommand{}) {
-		comm = fmt.Sprintf("%s|%s", comm, subCommand.Command)
-		categories = append(categories, subCommand.Categories...)
-		keys, err = subCommand.KeyExtractionFunc(cmd)
-		if err != nil {
-			return err
-		}
-	}
+	// The commands below are recognised by their original names, so that they're still allowed when renamed.
+	original := internal.OriginalCommand(command)
 
 	// Skip ack
-	if strings.EqualFold(comm, "ack") {
+	if strings.EqualFold(original, "ack") {
 		return nil
 	}
 
 	// Skip certain commands from authorization
-	if slices.Contains([]string{"ping", "echo", "hello"}, strings.ToLower(comm)) {
+	if slices.Contains([]string{"ping", "echo", "hello"}, strings.ToLower(original)) {
 		return nil
 	}
 
 	// If the command is 'auth', then return early and allow it
-	if strings.EqualFold(comm, "auth") {
+	if strings.EqualFold(original, "auth") {
 		return nil
 	}
 
@@ -343,33 +748,221 @@ func (acl *ACL) AuthorizeConnection(conn *net.Conn, cmd []string, command intern
 		return nil
 	}
 
-	// 1. Check if password is required and if the user is authenticated
+	// Check if password is required and if the user is authenticated
 	if acl.Config.RequirePass && !connection.Authenticated {
+		if connection.Expired {
+			return errors.New("credential expired, re-authenticate with AUTH")
+		}
 		return errors.New("user must be authenticated")
 	}
 
+	database := getCommandDatabase(ctx, command, cmd)
+	if reason, object, err := acl.authorizeUser(connection.User, database, comm, categories, keys); err != nil {
+		acl.denialLog.add(reason, object, connection.User.Username, clientInfo(conn))
+		return err
+	}
+
+	return nil
+}
+
+// AuthorizeUser checks whether the user is allowed to run a command that a follower forwarded on the user's behalf.
+// The follower has already authorized the command, but the user could have been changed or deleted since.
+// When the rules are not nil, the user is created from them like the user of an identity with rules.
+func (acl *ACL) AuthorizeUser(
+	ctx context.Context,
+	username string,
+	rules []string,
+	cmd []string,
+	command internal.Command,
+	subCommand internal.SubCommand,
+) error {
+	defer acl.lockForwardedUser(rules)()
+
+	if !acl.Config.RequirePass {
+		return nil
+	}
+
+	user, err := acl.forwardedUser(username, rules)
+	if err != nil {
+		return err
+	}
+
+	comm, categories, keys, err := getCommandDetails(cmd, command, subCommand)
+	if err != nil {
+		return err
+	}
+	database := getCommandDatabase(ctx, command, cmd)
+	if reason, object, err := acl.authorizeUser(user, database, comm, categories, keys); err != nil {
+		acl.denialLog.add(reason, object, username, "forwarded")
+		return err
+	}
+	return nil
+}
+
+// lockForwardedUser locks the users for forwardedUser and returns the function that unlocks them.
+// Creating a user from rules compiles its key patterns, so it needs the write lock.
+func (acl *ACL) lockForwardedUser(rules []string) func() {
+	if rules != nil {
+		acl.LockUsers()
+		return acl.UnlockUsers
+	}
+	acl.RLockUsers()
+	return acl.RUnlockUsers
+}
+
+// forwardedUser returns the user that a follower forwarded a command on behalf of. When the rules are not nil,
+// the user is created from them, as it's the user of an identity that is not in the list of users.
+// The users must be locked with lockForwardedUser.
+func (acl *ACL) forwardedUser(username string, rules []string) (*User, error) {
+	if rules != nil {
+		user := CreateUser(username)
+		if err := user.UpdateUser(rules); err != nil {
+			return nil, err
+		}
+		user.Normalise()
+		if err := acl.compileUserGlobs(user); err != nil {
+			return nil, err
+		}
+		if !user.Enabled {
+			return nil, fmt.Errorf("user %s is disabled", username)
+		}
+		return user, nil
+	}
+
+	idx := slices.IndexFunc(acl.Users, func(user *User) bool {
+		return user.Username == username
+	})
+	if idx == -1 {
+		return nil, fmt.Errorf("no user with username %s", username)
+	}
+	if !acl.Users[idx].Enabled {
+		return nil, fmt.Errorf("user %s is disabled", username)
+	}
+	return acl.Users[idx], nil
+}
+
+// DryRun checks whether the user is allowed to run the command in the database, without running the command
+// or recording a denial in the ACL log. It returns the reason of the denial, or an empty string when the command
+// is allowed.
+func (acl *ACL) DryRun(username string, database int, cmd []string, command internal.Command, subCommand internal.SubCommand) (string, error) {
+	acl.RLockUsers()
+	defer acl.RUnlockUsers()
+
+	idx := slices.IndexFunc(acl.Users, func(user *User) bool {
+		return user.Username == username
+	})
+	if idx == -1 {
+		return "", fmt.Errorf("no user with username %s", username)
+	}
+
+	comm, categories, keys, err := getCommandDetails(cmd, command, subCommand)
+	if err != nil {
+		return "", err
+	}
+	if _, _, err = acl.authorizeUser(acl.Users[idx], database, comm, categories, keys); err != nil {
+		return err.Error(), nil
+	}
+	return "", nil
+}
+
+// getCommandDetails returns the name, the categories and the keys of the command, including its subcommand.
+func getCommandDetails(
+	cmd []string,
+	command internal.Command,
+	subCommand internal.SubCommand,
+) (string, []string, internal.KeyExtractionFuncResult, error) {
+	comm := command.Command
+	categories := slices.Clone(command.Categories)
+
+	keys, err := command.KeyExtractionFunc(cmd)
+	if err != nil {
+		return "", nil, internal.KeyExtractionFuncResult{}, err
+	}
+
+	if !reflect.DeepEqual(subCommand, internal.SubCommand{}) {
+		comm = fmt.Sprintf("%s|%s", comm, subCommand.Command)
+		categories = append(categories, subCommand.Categories...)
+		keys, err = subCommand.KeyExtractionFunc(cmd)
+		if err != nil {
+			return "", nil, internal.KeyExtractionFuncResult{}, err
+		}
+	}
+
+	return comm, categories, keys, nil
+}
+
+// getCommandDatabase returns the database that the command accesses. SELECT accesses the database it selects.
+func getCommandDatabase(ctx context.Context, command internal.Command, cmd []string) int {
+	if strings.EqualFold(internal.OriginalCommand(command), "select") && len(cmd) == 2 {
+		if database, err := strconv.Atoi(cmd[1]); err == nil {
+			return database
+		}
+	}
+	database, _ := ctx.Value("Database").(int)
+	return database
+}
+
+// authorizeUser checks whether the root permissions or one of the selectors of the user allow the command.
+// When none of them do, it returns the denial of the root permissions, with its reason and the denied object.
+func (acl *ACL) authorizeUser(
+	user *User,
+	database int,
+	comm string,
+	categories []string,
+	keys internal.KeyExtractionFuncResult,
+) (string, string, error) {
+	reason, object, err := acl.authorizeSelector(&user.Selector, database, comm, categories, keys)
+	if err == nil {
+		return "", "", nil
+	}
+	for i := range user.Selectors {
+		if _, _, selectorErr := acl.authorizeSelector(&user.Selectors[i], database, comm, categories, keys); selectorErr == nil {
+			return "", "", nil
+		}
+	}
+	return reason, object, err
+}
+
+// authorizeSelector checks whether the selector allows the command. When it doesn't, it returns the reason
+// of the denial and the denied command, key or channel.
+func (acl *ACL) authorizeSelector(
+	selector *Selector,
+	database int,
+	comm string,
+	categories []string,
+	keys internal.KeyExtractionFuncResult,
+) (string, string, error) {
+	channels := keys.Channels
+	readKeys := keys.ReadKeys
+	writeKeys := keys.WriteKeys
+
 	var notAllowed []string
 
+	// 1. Check if the database is allowed
+	if len(selector.Databases) > 0 && !slices.Contains(selector.Databases, database) {
+		return LogReasonCommand, comm, fmt.Errorf("not authorised to access database %d", database)
+	}
+
 	// 2. Check if all categories are in IncludedCategories
 	count := make(map[string]int, len(categories))
-	if !slices.Contains(connection.User.IncludedCategories, "*") {
+	if !slices.Contains(selector.IncludedCategories, "*") {
 		for _, category := range categories {
 			count[category] = 0
 		}
-		for _, category := range connection.User.IncludedCategories {
+		for _, category := range selector.IncludedCategories {
 			if _, ok := count[category]; ok {
 				count[category] += 1
 			}
 		}
 		notAllowed = getUnauthorized(count, "@")
 		if len(notAllowed) > 0 {
-			return fmt.Errorf("unauthorized access to the following categories: %+v", notAllowed)
+			return LogReasonCommand, comm, fmt.Errorf("unauthorized access to the following categories: %+v", notAllowed)
 		}
 	}
 
 	// 3. Check if commands category is in ExcludedCategories
 	if slices.ContainsFunc(categories, func(category string) bool {
-		return slices.ContainsFunc(connection.User.ExcludedCategories, func(excludedCategory string) bool {
+		return slices.ContainsFunc(selector.ExcludedCategories, func(excludedCategory string) bool {
 			if excludedCategory == "*" || excludedCategory == category {
 				notAllowed = []string{fmt.Sprintf("@%s", category)}
 				return true
@@ -377,100 +970,119 @@ func (acl *ACL) AuthorizeConnection(conn *net.Conn, cmd []string, command intern
 			return false
 		})
 	}) {
-		return fmt.Errorf("unauthorized access to the following categories: %+v", notAllowed)
+		return LogReasonCommand, comm, fmt.Errorf("unauthorized access to the following categories: %+v", notAllowed)
 	}
 
 	// 4. Check if commands are in IncludedCommands
-	if !slices.ContainsFunc(connection.User.IncludedCommands, func(includedCommand string) bool {
+	if !slices.ContainsFunc(selector.IncludedCommands, func(includedCommand string) bool {
 		return includedCommand == "*" || includedCommand == comm
 	}) {
-		return fmt.Errorf("not authorised to run %s command", strings.ToUpper(comm))
+		return LogReasonCommand, comm, fmt.Errorf("not authorised to run %s command", strings.ToUpper(comm))
 	}
 
 	// 5. Check if command are in ExcludedCommands
-	if slices.ContainsFunc(connection.User.ExcludedCommands, func(excludedCommand string) bool {
+	if slices.ContainsFunc(selector.ExcludedCommands, func(excludedCommand string) bool {
 		return excludedCommand == "*" || excludedCommand == comm
 	}) {
-		return fmt.Errorf("not authorised to run %s command", strings.ToUpper(comm))
+		return LogReasonCommand, comm, fmt.Errorf("not authorised to run %s command", strings.ToUpper(comm))
 	}
 
 	// 6. PUBSUB authorisation.
 	if slices.Contains(categories, constants.PubSubCategory) {
 		// Loop through each of the channels accessed by this command
 		for _, channel := range channels {
-			// 2.1) Check if the channel is in IncludedPubSubChannels
-			if !slices.ContainsFunc(connection.User.IncludedPubSubChannels, func(includedChannelGlob string) bool {
+			// 6.1) Check if the channel is in IncludedPubSubChannels
+			if !slices.ContainsFunc(selector.IncludedPubSubChannels, func(includedChannelGlob string) bool {
 				return acl.GlobPatterns[includedChannelGlob].Match(channel)
 			}) {
-				return fmt.Errorf("not authorised to access channel &%s", channel)
+				return LogReasonChannel, channel, fmt.Errorf("not authorised to access channel &%s", channel)
 			}
-			// 2.2) Check if the channel is in ExcludedPubSubChannels
-			if slices.ContainsFunc(connection.User.ExcludedPubSubChannels, func(excludedChannelGlob string) bool {
+			// 6.2) Check if the channel is in ExcludedPubSubChannels
+			if slices.ContainsFunc(selector.ExcludedPubSubChannels, func(excludedChannelGlob string) bool {
 				return acl.GlobPatterns[excludedChannelGlob].Match(channel)
 			}) {
-				return fmt.Errorf("not authorised to access channel &%s", channel)
+				return LogReasonChannel, channel, fmt.Errorf("not authorised to access channel &%s", channel)
 			}
 		}
-		return nil
+		return "", "", nil
 	}
 
 	if len(append(readKeys, writeKeys...)) > 0 {
 		// 7. Check if nokeys is true
-		if connection.User.NoKeys {
-			return errors.New("not authorised to access any keys")
+		if selector.NoKeys {
+			return LogReasonKey, append(readKeys, writeKeys...)[0], errors.New("not authorised to access any keys")
 		}
 
-		// 8. Check if readKeys are in IncludedReadKeys
-		if len(readKeys) > 0 && !slices.ContainsFunc(readKeys, func(key string) bool {
-			return slices.ContainsFunc(connection.User.IncludedReadKeys, func(readKeyGlob string) bool {
-				if acl.GlobPatterns[readKeyGlob].Match(key) {
-					return true
-				}
-				if !slices.Contains(notAllowed, fmt.Sprintf("%s~%s", "%R", key)) {
-					notAllowed = append(notAllowed, fmt.Sprintf("%s~%s", "%R", key))
-				}
-				return false
-			})
-		}) {
-			if len(notAllowed) > 0 {
-				return fmt.Errorf("not authorised to access the following read keys: %+v", notAllowed)
+		// 8. Check if readKeys match IncludedReadKeys and don't match ExcludedReadKeys
+		for _, key := range readKeys {
+			if !acl.keyAllowed(key, selector.IncludedReadKeys, selector.ExcludedReadKeys) &&
+				!slices.Contains(notAllowed, fmt.Sprintf("%s~%s", "%R", key)) {
+				notAllowed = append(notAllowed, fmt.Sprintf("%s~%s", "%R", key))
 			}
 		}
+		if len(notAllowed) > 0 {
+			return LogReasonKey, strings.TrimPrefix(notAllowed[0], "%R~"),
+				fmt.Errorf("not authorised to access the following read keys: %+v", notAllowed)
+		}
 
-		// 9. Check if write keys are in IncludedWriteKeys
-		if len(writeKeys) > 0 && !slices.ContainsFunc(writeKeys, func(key string) bool {
-			return slices.ContainsFunc(connection.User.IncludedWriteKeys, func(writeKeyGlob string) bool {
-				if acl.GlobPatterns[writeKeyGlob].Match(key) {
-					return true
-				}
-				if !slices.Contains(notAllowed, fmt.Sprintf("%s~%s", "%W", key)) {
-					notAllowed = append(notAllowed, fmt.Sprintf("%s~%s", "%W", key))
-				}
-				return false
-			})
-		}) {
-			return fmt.Errorf("not authorised to access the following write keys: %+v", notAllowed)
+		// 9. Check if write keys match IncludedWriteKeys and don't match ExcludedWriteKeys
+		for _, key := range writeKeys {
+			if !acl.keyAllowed(key, selector.IncludedWriteKeys, selector.ExcludedWriteKeys) &&
+				!slices.Contains(notAllowed, fmt.Sprintf("%s~%s", "%W", key)) {
+				notAllowed = append(notAllowed, fmt.Sprintf("%s~%s", "%W", key))
+			}
+		}
+		if len(notAllowed) > 0 {
+			return LogReasonKey, strings.TrimPrefix(notAllowed[0], "%W~"),
+				fmt.Errorf("not authorised to access the following write keys: %+v", notAllowed)
 		}
 	}
 
+	return "", "", nil
+}
+
+// keyAllowed returns true when the key matches one of the included globs and none of the excluded globs.
+func (acl *ACL) keyAllowed(key string, includedGlobs []string, excludedGlobs []string) bool {
+	return slices.ContainsFunc(includedGlobs, func(g string) bool {
+		return acl.GlobPatterns[g].Match(key)
+	}) && !slices.ContainsFunc(excludedGlobs, func(g string) bool {
+		return acl.GlobPatterns[g].Match(key)
+	})
+}
+
+// Log returns up to count of the most recent entries of the ACL log, or all of them when count is negative.
+func (acl *ACL) Log(count int) []internal.ACLLogEntry {
+	return acl.denialLog.list(count)
+}
+
+// ResetLog removes all the entries of the ACL log.
+func (acl *ACL) ResetLog() {
+	acl.denialLog.reset()
+}
+
+// hashPasswords hashes the user's plaintext passwords with the algorithm configured with --acl-password-hash.
+func (acl *ACL) hashPasswords(user *User) error {
+	for i, password := range user.Passwords {
+		hashed, err := acl.hasher.hash(password)
+		if err != nil {
+			return err
+		}
+		user.Passwords[i] = hashed
+	}
 	return nil
 }
 
 func (acl *ACL) CompileGlobs() {
 	// Extract all the relevant globs from all the users
 	var allGlobs []string
-	var userGlobs []string
 	for _, user := range acl.Users {
-		userGlobs = append(userGlobs, user.IncludedPubSubChannels...)
-		userGlobs = append(userGlobs, user.ExcludedPubSubChannels...)
-		userGlobs = append(userGlobs, user.IncludedReadKeys...)
-		userGlobs = append(userGlobs, user.IncludedWriteKeys...)
-		for _, g := range userGlobs {
-			if !slices.Contains(allGlobs, g) {
-				allGlobs = append(allGlobs, g)
+		for _, selector := range append([]Selector{user.Selector}, user.Selectors...) {
+			for _, g := range selector.globs() {
+				if !slices.Contains(allGlobs, g) {
+					allGlobs = append(allGlobs, g)
+				}
 			}
 		}
-		userGlobs = []string{}
 	}
 	// Compile the globs that have not been compiled yet
 	for _, g := range allGlobs {
@@ -480,6 +1092,24 @@ func (acl *ACL) CompileGlobs() {
 	}
 }
 
+// compileUserGlobs compiles the globs of a user that is not in the list of users.
+// Unlike CompileGlobs, it returns an error for an invalid glob as the rules don't come from an administrator.
+func (acl *ACL) compileUserGlobs(user *User) error {
+	for _, selector := range append([]Selector{user.Selector}, user.Selectors...) {
+		for _, g := range selector.globs() {
+			if acl.GlobPatterns[g] != nil {
+				continue
+			}
+			compiled, err := glob.Compile(g)
+			if err != nil {
+				return fmt.Errorf("invalid pattern %s: %v", g, err)
+			}
+			acl.GlobPatterns[g] = compiled
+		}
+	}
+	return nil
+}
+
 func (acl *ACL) LockUsers() {
 	acl.UsersMutex.Lock()
 }
@@ -0,0 +1,44 @@
+// Copyright 2024 Kelvin Clement Mwinuka
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package acl
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrUnsupportedCredential is returned by an Authenticator when the credential is not in a format it handles,
+// so that the next authenticator, or the user's passwords, are tried instead.
+var ErrUnsupportedCredential = errors.New("unsupported credential")
+
+// Identity is the result of a successful authentication by an Authenticator.
+type Identity struct {
+	Username string
+	// Rules are the ACL rules of the connection. When nil, the connection uses the permissions
+	// of the existing user with the username.
+	Rules []string
+	// ExpiresAt is the time the credential expires. The credential does not expire when it's zero.
+	ExpiresAt time.Time
+}
+
+// Authenticator verifies the credentials passed to AUTH, in addition to the passwords of the ACL users.
+type Authenticator interface {
+	// Name identifies the authenticator in logs.
+	Name() string
+	// Authenticate verifies the credential. The username is empty when the client only passed a credential.
+	// It returns ErrUnsupportedCredential when the credential is not in a format the authenticator handles.
+	Authenticate(ctx context.Context, username string, credential string) (Identity, error)
+}
@@ -0,0 +1,79 @@
+// Copyright 2024 Kelvin Clement Mwinuka
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package acl
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"time"
+)
+
+const (
+	CertUserFieldCN     = "cn"
+	CertUserFieldSANURI = "san-uri"
+	CertUserFieldSANDNS = "san-dns"
+	CertUserFieldOID    = "oid"
+)
+
+// certHandshakeTimeout is the time a client has to complete the TLS handshake before its connection is rejected.
+const certHandshakeTimeout = 10 * time.Second
+
+// certificateUsernames returns the candidate usernames in the configured field of the client certificate.
+// It returns false when the connection did not present a client certificate.
+func certificateUsernames(conn net.Conn, field string, oid string) ([]string, bool, error) {
+	tlsConn, ok := conn.(*tls.Conn)
+	if !ok {
+		return nil, false, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), certHandshakeTimeout)
+	defer cancel()
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		return nil, false, fmt.Errorf("tls handshake: %v", err)
+	}
+
+	certs := tlsConn.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return nil, false, nil
+	}
+	return certificateField(certs[0], field, oid), true, nil
+}
+
+// certificateField returns the values of the field in the certificate.
+func certificateField(cert *x509.Certificate, field string, oid string) []string {
+	var names []string
+	switch field {
+	case CertUserFieldCN:
+		if cert.Subject.CommonName != "" {
+			names = append(names, cert.Subject.CommonName)
+		}
+	case CertUserFieldSANURI:
+		for _, uri := range cert.URIs {
+			names = append(names, uri.String())
+		}
+	case CertUserFieldSANDNS:
+		names = append(names, cert.DNSNames...)
+	case CertUserFieldOID:
+		for _, name := range cert.Subject.Names {
+			if value, ok := name.Value.(string); ok && name.Type.String() == oid {
+				names = append(names, value)
+			}
+		}
+	}
+	return names
+}
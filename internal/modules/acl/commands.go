@@ -25,6 +25,7 @@ import (
 	"os"
 	"path"
 	"slices"
+	"strconv"
 	"strings"
 )
 
@@ -115,7 +116,7 @@ func handleGetUser(params internal.HandlerFuncParams) ([]byte, error) {
 	}
 
 	// username,
-	res := fmt.Sprintf("*12\r\n+username\r\n*1\r\n+%s", user.Username)
+	res := fmt.Sprintf("*20\r\n+username\r\n*1\r\n+%s", user.Username)
 
 	// flags
 	var flags []string
@@ -171,25 +172,11 @@ func handleGetUser(params internal.HandlerFuncParams) ([]byte, error) {
 	}
 
 	// keys
-	allKeys := user.IncludedReadKeys
-	for _, key := range append(user.IncludedWriteKeys, user.IncludedReadKeys...) {
-		if !slices.Contains(allKeys, key) {
-			allKeys = append(allKeys, key)
-		}
-	}
-	res = res + fmt.Sprintf("\r\n+keys\r\n*%d", len(allKeys))
-	for _, key := range allKeys {
-		switch {
-		case slices.Contains(user.IncludedWriteKeys, key) && slices.Contains(user.IncludedReadKeys, key):
-			// Key is RW
-			res = res + fmt.Sprintf("\r\n+%s~%s", "%RW", key)
-		case slices.Contains(user.IncludedWriteKeys, key):
-			// Keys is W-Only
-			res = res + fmt.Sprintf("\r\n+%s~%s", "%W", key)
-		case slices.Contains(user.IncludedReadKeys, key):
-			// Key is R-Only
-			res = res + fmt.Sprintf("\r\n+%s~%s", "%R", key)
-		}
+	keys := append(keyRules("", user.IncludedReadKeys, user.IncludedWriteKeys),
+		keyRules("-", user.ExcludedReadKeys, user.ExcludedWriteKeys)...)
+	res = res + fmt.Sprintf("\r\n+keys\r\n*%d", len(keys))
+	for _, key := range keys {
+		res = res + fmt.Sprintf("\r\n+%s", key)
 	}
 
 	// channels
@@ -202,6 +189,29 @@ func handleGetUser(params internal.HandlerFuncParams) ([]byte, error) {
 		res = res + fmt.Sprintf("\r\n+-&%s", channel)
 	}
 
+	// databases
+	res = res + fmt.Sprintf("\r\n+databases\r\n*1\r\n+%s", user.databasesRule())
+
+	// selectors
+	res = res + fmt.Sprintf("\r\n+selectors\r\n*%d", len(user.Selectors))
+	for _, selector := range user.Selectors {
+		res = res + fmt.Sprintf("\r\n+(%s)", strings.Join(selector.rules(), " "))
+	}
+
+	// quotas
+	quotas := user.Quotas.rules()
+	res = res + fmt.Sprintf("\r\n+quotas\r\n*%d", len(quotas))
+	for _, quota := range quotas {
+		res = res + fmt.Sprintf("\r\n+%s", quota)
+	}
+
+	// usage
+	usage := acl.quotaUsageRules(user)
+	res = res + fmt.Sprintf("\r\n+usage\r\n*%d", len(usage))
+	for _, u := range usage {
+		res = res + fmt.Sprintf("\r\n+%s", u)
+	}
+
 	res += "\r\n"
 
 	return []byte(res), nil
@@ -289,66 +299,23 @@ func handleList(params internal.HandlerFuncParams) ([]byte, error) {
 		}
 		// Passwords
 		for _, password := range user.Passwords {
-			if strings.EqualFold(password.PasswordType, "plaintext") {
+			if strings.EqualFold(password.PasswordType, PasswordPlainText) {
 				s += fmt.Sprintf(" >%s", password.PasswordValue)
-			}
-			if strings.EqualFold(password.PasswordType, "SHA256") {
+			} else {
 				s += fmt.Sprintf(" #%s", password.PasswordValue)
 			}
 		}
-		// Included categories
-		for _, category := range user.IncludedCategories {
-			if category == "*" {
-				s += " +@all"
-				continue
-			}
-			s += fmt.Sprintf(" +@%s", category)
+		// Root permissions
+		for _, rule := range user.Selector.rules() {
+			s += fmt.Sprintf(" %s", rule)
 		}
-		// Excluded categories
-		for _, category := range user.ExcludedCategories {
-			if category == "*" {
-				s += " -@all"
-				continue
-			}
-			s += fmt.Sprintf(" -@%s", category)
+		// Selectors
+		for _, selector := range user.Selectors {
+			s += fmt.Sprintf(" (%s)", strings.Join(selector.rules(), " "))
 		}
-		// Included commands
-		for _, command := range user.IncludedCommands {
-			if command == "*" {
-				s += " +all"
-				continue
-			}
-			s += fmt.Sprintf(" +%s", command)
-		}
-		// Excluded commands
-		for _, command := range user.ExcludedCommands {
-			if command == "*" {
-				s += " -all"
-				continue
-			}
-			s += fmt.Sprintf(" -%s", command)
-		}
-		// Included read keys
-		for _, key := range user.IncludedReadKeys {
-			if slices.Contains(user.IncludedWriteKeys, key) {
-				s += fmt.Sprintf(" %s~%s", "%RW", key)
-				continue
-			}
-			s += fmt.Sprintf(" %s~%s", "%R", key)
-		}
-		// Included write keys
-		for _, key := range user.IncludedWriteKeys {
-			if !slices.Contains(user.IncludedReadKeys, key) {
-				s += fmt.Sprintf(" %s~%s", "%W", key)
-			}
-		}
-		// Included Pub/Sub channels
-		for _, channel := range user.IncludedPubSubChannels {
-			s += fmt.Sprintf(" +&%s", channel)
-		}
-		// Excluded Pup/Sub channels
-		for _, channel := range user.ExcludedPubSubChannels {
-			s += fmt.Sprintf(" -&%s", channel)
+		// Quotas
+		for _, quota := range user.Quotas.rules() {
+			s += fmt.Sprintf(" %s", quota)
 		}
 		res = res + fmt.Sprintf("\r\n$%d\r\n%s", len(s), s)
 	}
@@ -366,60 +333,10 @@ func handleLoad(params internal.HandlerFuncParams) ([]byte, error) {
 	if !ok {
 		return nil, errors.New("could not load ACL")
 	}
-	acl.LockUsers()
-	defer acl.UnlockUsers()
-
-	f, err := os.OpenFile(acl.Config.AclConfig, os.O_RDONLY, os.ModePerm)
-	if err != nil {
+	if err := acl.LoadUsers(params.Command[2]); err != nil {
 		return nil, err
 	}
 
-	defer func() {
-		if err := f.Close(); err != nil {
-			log.Println(err)
-		}
-	}()
-
-	ext := path.Ext(f.Name())
-
-	var users []*User
-
-	if strings.ToLower(ext) == ".json" {
-		if err := json.NewDecoder(f).Decode(&users); err != nil {
-			return nil, err
-		}
-	}
-
-	if slices.Contains([]string{".yaml", ".yml"}, strings.ToLower(ext)) {
-		if err := yaml.NewDecoder(f).Decode(&users); err != nil {
-			return nil, err
-		}
-	}
-
-	// Normalise each user
-	for _, user := range users {
-		user.Normalise()
-		// Traverse the list of users.
-		userFound := false
-		for _, u := range acl.Users {
-			if u.Username == user.Username {
-				userFound = true
-				// If we have a user with the current username and are in merge mode, merge the two users.
-				if strings.EqualFold(params.Command[2], "merge") {
-					u.Merge(user)
-				} else {
-					// If we have a user with the current username and are in replace mode, merge the two users.
-					u.Replace(user)
-				}
-				break
-			}
-		}
-		// If there is no user with current loaded username is already in acl list, then append the user to the list
-		if !userFound {
-			acl.Users = append(acl.Users, user)
-		}
-	}
-
 	return []byte(constants.OkResponse), nil
 }
 
@@ -477,6 +394,107 @@ func handleSave(params internal.HandlerFuncParams) ([]byte, error) {
 	return []byte(constants.OkResponse), nil
 }
 
+func handleDryRun(params internal.HandlerFuncParams) ([]byte, error) {
+	if len(params.Command) < 4 {
+		return nil, errors.New(constants.WrongArgsResponse)
+	}
+
+	acl, ok := params.GetACL().(*ACL)
+	if !ok {
+		return nil, errors.New("could not load ACL")
+	}
+
+	cmd := params.Command[3:]
+	idx := slices.IndexFunc(params.GetAllCommands(), func(command internal.Command) bool {
+		return strings.EqualFold(command.Command, cmd[0])
+	})
+	if idx == -1 {
+		return nil, fmt.Errorf("command '%s' not supported", strings.ToLower(cmd[0]))
+	}
+	command := params.GetAllCommands()[idx]
+
+	sc, err := internal.GetSubCommand(command, cmd)
+	if err != nil {
+		return nil, err
+	}
+	subCommand, _ := sc.(internal.SubCommand)
+
+	database, _ := params.Context.Value("Database").(int)
+	denial, err := acl.DryRun(params.Command[2], database, cmd, command, subCommand)
+	if err != nil {
+		return nil, err
+	}
+	if denial != "" {
+		return []byte(fmt.Sprintf("$%d\r\n%s\r\n", len(denial), denial)), nil
+	}
+	return []byte(constants.OkResponse), nil
+}
+
+func handleLog(params internal.HandlerFuncParams) ([]byte, error) {
+	if len(params.Command) > 3 {
+		return nil, errors.New(constants.WrongArgsResponse)
+	}
+
+	acl, ok := params.GetACL().(*ACL)
+	if !ok {
+		return nil, errors.New("could not load ACL")
+	}
+
+	count := 10
+	if len(params.Command) == 3 {
+		if strings.EqualFold(params.Command[2], "reset") {
+			acl.ResetLog()
+			return []byte(constants.OkResponse), nil
+		}
+		n, err := strconv.Atoi(params.Command[2])
+		if err != nil || n < 0 {
+			return nil, errors.New("count must be a positive integer")
+		}
+		count = n
+	}
+
+	now := params.GetClock().Now()
+	entries := acl.Log(count)
+
+	res := fmt.Sprintf("*%d\r\n", len(entries))
+	for _, entry := range entries {
+		age := strconv.FormatFloat(now.Sub(entry.LastUpdated).Seconds(), 'f', 3, 64)
+		res += "*20\r\n"
+		res += fmt.Sprintf("$5\r\ncount\r\n:%d\r\n", entry.Count)
+		res += fmt.Sprintf("$6\r\nreason\r\n$%d\r\n%s\r\n", len(entry.Reason), entry.Reason)
+		res += fmt.Sprintf("$7\r\ncontext\r\n$%d\r\n%s\r\n", len(entry.Context), entry.Context)
+		res += fmt.Sprintf("$6\r\nobject\r\n$%d\r\n%s\r\n", len(entry.Object), entry.Object)
+		res += fmt.Sprintf("$8\r\nusername\r\n$%d\r\n%s\r\n", len(entry.Username), entry.Username)
+		res += fmt.Sprintf("$11\r\nage-seconds\r\n$%d\r\n%s\r\n", len(age), age)
+		res += fmt.Sprintf("$11\r\nclient-info\r\n$%d\r\n%s\r\n", len(entry.ClientInfo), entry.ClientInfo)
+		res += fmt.Sprintf("$8\r\nentry-id\r\n:%d\r\n", entry.EntryID)
+		res += fmt.Sprintf("$17\r\ntimestamp-created\r\n:%d\r\n", entry.Created.UnixMilli())
+		res += fmt.Sprintf("$22\r\ntimestamp-last-updated\r\n:%d\r\n", entry.LastUpdated.UnixMilli())
+	}
+	return []byte(res), nil
+}
+
+func handleGenPass(params internal.HandlerFuncParams) ([]byte, error) {
+	if len(params.Command) > 3 {
+		return nil, errors.New(constants.WrongArgsResponse)
+	}
+
+	bits := 256
+	if len(params.Command) == 3 {
+		n, err := strconv.Atoi(params.Command[2])
+		if err != nil || n <= 0 || n > 4096 {
+			return nil, errors.New("bits must be an integer between 1 and 4096")
+		}
+		bits = n
+	}
+
+	password, err := generatePassword(bits)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(fmt.Sprintf("$%d\r\n%s\r\n", len(password), password)), nil
+}
+
 func Commands() []internal.Command {
 	return []internal.Command{
 		{
@@ -543,7 +561,7 @@ If the optional category is provided, lists all the commands in the category.`,
 					Command:     "getuser",
 					Module:      constants.ACLModule,
 					Categories:  []string{constants.AdminCategory, constants.SlowCategory, constants.DangerousCategory},
-					Description: "(ACL GETUSER username) List the ACL rules of a user.",
+					Description: "(ACL GETUSER username) List the ACL rules, the quotas and the current quota usage of a user.",
 					Sync:        false,
 					KeyExtractionFunc: func(cmd []string) (internal.KeyExtractionFuncResult, error) {
 						return internal.KeyExtractionFuncResult{
@@ -575,7 +593,7 @@ Deletes users and terminates their connections. Cannot delete default user.`,
 					Module:      constants.ACLModule,
 					Categories:  []string{constants.FastCategory},
 					Description: "(ACL WHOAMI) Returns the authenticated user of the current connection.",
-					Sync:        true,
+					Sync:        false,
 					KeyExtractionFunc: func(cmd []string) (internal.KeyExtractionFuncResult, error) {
 						return internal.KeyExtractionFuncResult{
 							Channels:  make([]string, 0),
@@ -590,7 +608,7 @@ Deletes users and terminates their connections. Cannot delete default user.`,
 					Module:      constants.ACLModule,
 					Categories:  []string{constants.AdminCategory, constants.SlowCategory, constants.DangerousCategory},
 					Description: "(ACL LIST) Dumps effective acl rules in ACL DSL format.",
-					Sync:        true,
+					Sync:        false,
 					KeyExtractionFunc: func(cmd []string) (internal.KeyExtractionFuncResult, error) {
 						return internal.KeyExtractionFuncResult{
 							Channels:  make([]string, 0),
@@ -605,9 +623,11 @@ Deletes users and terminates their connections. Cannot delete default user.`,
 					Module:     constants.ACLModule,
 					Categories: []string{constants.AdminCategory, constants.SlowCategory, constants.DangerousCategory},
 					Description: `
-(ACL LOAD <MERGE | REPLACE>) Reloads the rules from the configured ACL config file.
+(ACL LOAD <MERGE | REPLACE | SYNC>) Reloads the rules from the configured ACL config file.
 When 'MERGE' is passed, users from config file who share a username with users in memory will be merged.
-When 'REPLACE' is passed, users from config file who share a username with users in memory will replace the user in memory.`,
+When 'REPLACE' is passed, users from config file who share a username with users in memory will replace the user in memory.
+When 'SYNC' is passed, users are replaced like with 'REPLACE', and users in memory that are not in the config file
+are deleted, except the default user.`,
 					Sync: true,
 					KeyExtractionFunc: func(cmd []string) (internal.KeyExtractionFuncResult, error) {
 						return internal.KeyExtractionFuncResult{
@@ -633,6 +653,54 @@ When 'REPLACE' is passed, users from config file who share a username with users
 					},
 					HandlerFunc: handleSave,
 				},
+				{
+					Command:    "dryrun",
+					Module:     constants.ACLModule,
+					Categories: []string{constants.AdminCategory, constants.SlowCategory, constants.DangerousCategory},
+					Description: `(ACL DRYRUN username command [arg ...]) Checks whether the user is allowed to run the command
+in the current database without running it. Returns OK when the command is allowed, or the reason it is denied.`,
+					Sync: false,
+					KeyExtractionFunc: func(cmd []string) (internal.KeyExtractionFuncResult, error) {
+						return internal.KeyExtractionFuncResult{
+							Channels:  make([]string, 0),
+							ReadKeys:  make([]string, 0),
+							WriteKeys: make([]string, 0),
+						}, nil
+					},
+					HandlerFunc: handleDryRun,
+				},
+				{
+					Command:    "log",
+					Module:     constants.ACLModule,
+					Categories: []string{constants.AdminCategory, constants.SlowCategory, constants.DangerousCategory},
+					Description: `(ACL LOG [count | RESET]) Lists the most recent authentications and commands denied by the ACL,
+up to count entries (10 by default). Repeated denials are coalesced into one entry. RESET clears the log.`,
+					Sync: false,
+					KeyExtractionFunc: func(cmd []string) (internal.KeyExtractionFuncResult, error) {
+						return internal.KeyExtractionFuncResult{
+							Channels:  make([]string, 0),
+							ReadKeys:  make([]string, 0),
+							WriteKeys: make([]string, 0),
+						}, nil
+					},
+					HandlerFunc: handleLog,
+				},
+				{
+					Command:    "genpass",
+					Module:     constants.ACLModule,
+					Categories: []string{constants.SlowCategory},
+					Description: `(ACL GENPASS [bits]) Generates a random password from a cryptographically secure source.
+The password is hex encoded and has the number of bits of entropy (256 by default).`,
+					Sync: false,
+					KeyExtractionFunc: func(cmd []string) (internal.KeyExtractionFuncResult, error) {
+						return internal.KeyExtractionFuncResult{
+							Channels:  make([]string, 0),
+							ReadKeys:  make([]string, 0),
+							WriteKeys: make([]string, 0),
+						}, nil
+					},
+					HandlerFunc: handleGenPass,
+				},
 			},
 		},
 	}
@@ -15,20 +15,44 @@
 package acl_test
 
 import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
 	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
 	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
 	"fmt"
 	"github.com/echovault/sugardb/internal"
+	"github.com/echovault/sugardb/internal/clock"
 	"github.com/echovault/sugardb/internal/config"
 	"github.com/echovault/sugardb/internal/constants"
+	"github.com/echovault/sugardb/internal/modules/acl"
 	"github.com/echovault/sugardb/sugardb"
 	"github.com/tidwall/resp"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"math/big"
+	"net"
+	"net/url"
 	"os"
 	"path"
 	"slices"
 	"strings"
 	"sync"
 	"testing"
+	"time"
 )
 
 func setUpServer(port int, requirePass bool, aclConfig string) (*sugardb.SugarDB, error) {
@@ -1264,6 +1288,11 @@ func Test_ACL(t *testing.T) {
 					IncludeWriteKeys:  []string{"key1", "key2", "key5", "key6"},
 					IncludeChannels:   []string{"channel1", "channel2"},
 					ExcludeChannels:   []string{"channel3", "channel4"},
+					ExcludeReadKeys:   []string{"key3:*"},
+					Databases:         []int{1, 0},
+					Selectors:         []string{"+get ~cache:*"},
+					CommandsPerSecond: 100,
+					MaxKeys:           10,
 				},
 				cmd: []resp.Value{resp.StringValue("ACL"), resp.StringValue("GETUSER"), resp.StringValue("get_user_1")},
 				wantRes: []resp.Value{
@@ -1301,6 +1330,7 @@ func Test_ACL(t *testing.T) {
 						resp.StringValue("%R~key4"),
 						resp.StringValue("%W~key5"),
 						resp.StringValue("%W~key6"),
+						resp.StringValue("-%R~key3:*"),
 					}),
 					resp.StringValue("channels"),
 					resp.ArrayValue([]resp.Value{
@@ -1310,6 +1340,25 @@ func Test_ACL(t *testing.T) {
 						resp.StringValue("-&channel3"),
 						resp.StringValue("-&channel4"),
 					}),
+					resp.StringValue("databases"),
+					resp.ArrayValue([]resp.Value{resp.StringValue("db=0,1")}),
+					resp.StringValue("selectors"),
+					resp.ArrayValue([]resp.Value{resp.StringValue("(+get %RW~cache:*)")}),
+					resp.StringValue("quotas"),
+					resp.ArrayValue([]resp.Value{
+						resp.StringValue("commands-per-sec=100"),
+						resp.StringValue("maxkeys=10"),
+					}),
+					resp.StringValue("usage"),
+					resp.ArrayValue([]resp.Value{
+						resp.StringValue("commands-per-sec=0"),
+						resp.StringValue("bytes-in-per-sec=0"),
+						resp.StringValue("bytes-out-per-sec=0"),
+						resp.StringValue("connections=0"),
+						resp.StringValue("keys=0"),
+						resp.StringValue("memory=0"),
+						resp.StringValue("rejected=0"),
+					}),
 				},
 				wantErr: "",
 			},
@@ -1348,7 +1397,10 @@ func Test_ACL(t *testing.T) {
 				}
 				resArr := v.Array()
 				for i := 0; i < len(resArr); i++ {
-					if slices.Contains([]string{"username", "flags", "categories", "commands", "keys", "channels"}, resArr[i].String()) {
+					if slices.Contains([]string{
+						"username", "flags", "categories", "commands", "keys", "channels", "databases", "selectors",
+						"quotas", "usage",
+					}, resArr[i].String()) {
 						// String item
 						if resArr[i].String() != test.wantRes[i].String() {
 							t.Errorf("expected response component %+v, got %+v", test.wantRes[i], resArr[i])
@@ -2112,3 +2164,1520 @@ func Test_ACL(t *testing.T) {
 		}
 	})
 }
+
+func Test_RestoreUsers(t *testing.T) {
+	source := acl.NewACL(config.Config{})
+	if err := source.SetUser([]string{"user1", "on", ">password1", "+@read", "~key*"}); err != nil {
+		t.Fatal(err)
+	}
+	b, err := source.MarshalUsers()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	target := acl.NewACL(config.Config{})
+	if err = target.SetUser([]string{"user2", "on", ">password2"}); err != nil {
+		t.Fatal(err)
+	}
+	conn1, peer1 := net.Pipe()
+	conn2, peer2 := net.Pipe()
+	t.Cleanup(func() {
+		for _, conn := range []net.Conn{conn1, peer1, conn2, peer2} {
+			_ = conn.Close()
+		}
+	})
+	target.RegisterConnection(&conn1)
+	target.RegisterConnection(&conn2)
+	if err = target.AuthenticateConnection(context.Background(), &conn2, []string{"AUTH", "user2", "password2"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = target.RestoreUsers(b); err != nil {
+		t.Fatal(err)
+	}
+
+	var usernames []string
+	for _, user := range target.Users {
+		usernames = append(usernames, user.Username)
+	}
+	if err = compareSlices(usernames, []string{"default", "user1"}); err != nil {
+		t.Error(err)
+	}
+	if target.Connections[&conn1].User != target.Users[0] {
+		t.Error("expected the connection of the default user to use the restored default user")
+	}
+	// The connection of the deleted user is terminated.
+	if _, err = conn2.Read(make([]byte, 1)); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("expected the connection of the deleted user to be terminated, got %v", err)
+	}
+
+	if err = target.RestoreUsers([]byte(`[{"Username":"user1"}]`)); err == nil {
+		t.Error("expected an error when the default user is missing")
+	}
+}
+
+func Test_ACLLog(t *testing.T) {
+	t.Parallel()
+
+	port, err := internal.GetFreePort()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	mockServer, err := sugardb.NewSugarDB(
+		sugardb.WithConfig(config.Config{
+			BindAddr:       "localhost",
+			Port:           uint16(port),
+			EvictionPolicy: constants.NoEviction,
+			RequirePass:    true,
+			Password:       "password1",
+			AclLogMaxLen:   3,
+		}),
+	)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	go func() {
+		mockServer.Start()
+	}()
+	t.Cleanup(func() {
+		mockServer.ShutDown()
+	})
+
+	if _, err = mockServer.ACLSetUser(sugardb.User{
+		Username:             "log_user",
+		Enabled:              true,
+		AddPlainPasswords:    []string{"log_password"},
+		IncludeCategories:    []string{"*"},
+		IncludeCommands:      []string{"get", "auth"},
+		IncludeReadWriteKeys: []string{"key1"},
+	}); err != nil {
+		t.Error(err)
+		return
+	}
+
+	conn, err := internal.GetConnection("localhost", port)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+	client := resp.NewConn(conn)
+
+	do := func(cmd ...string) resp.Value {
+		values := make([]resp.Value, len(cmd))
+		for i, c := range cmd {
+			values[i] = resp.StringValue(c)
+		}
+		if err := client.WriteArray(values); err != nil {
+			t.Fatal(err)
+		}
+		v, _, err := client.ReadValue()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+
+	// Denials of the same kind are coalesced into one entry.
+	do("AUTH", "log_user", "wrong_password")
+	do("AUTH", "log_user", "wrong_password")
+	do("AUTH", "missing_user", "password")
+	if v := do("AUTH", "log_user", "log_password"); v.String() != "OK" {
+		t.Fatalf("expected AUTH response \"OK\", got %q", v.String())
+	}
+	do("HSET", "key1", "field", "value")
+	do("GET", "key2")
+
+	entries := mockServer.ACLLog()
+	if len(entries) != 3 {
+		t.Fatalf("expected the log to keep 3 entries, got %d: %+v", len(entries), entries)
+	}
+	want := []struct {
+		reason   string
+		object   string
+		username string
+		count    int
+	}{
+		{reason: acl.LogReasonKey, object: "key2", username: "log_user", count: 1},
+		{reason: acl.LogReasonCommand, object: "hset", username: "log_user", count: 1},
+		{reason: acl.LogReasonAuth, object: "AUTH", username: "missing_user", count: 1},
+	}
+	for i, entry := range entries {
+		if entry.Reason != want[i].reason || entry.Object != want[i].object ||
+			entry.Username != want[i].username || entry.Count != want[i].count {
+			t.Errorf("expected entry %d to be %+v, got %+v", i, want[i], entry)
+		}
+		if !strings.Contains(entry.ClientInfo, conn.LocalAddr().String()) {
+			t.Errorf("expected client info of entry %d to contain %s, got %q", i, conn.LocalAddr(), entry.ClientInfo)
+		}
+	}
+	if entries[0].EntryID != 3 {
+		t.Errorf("expected the id of the most recent entry to be 3, got %d", entries[0].EntryID)
+	}
+
+	// Coalesce a repeated denial with an older entry.
+	do("HSET", "key1", "field", "value")
+	entries = mockServer.ACLLog(1)
+	if len(entries) != 1 || entries[0].Object != "hset" || entries[0].Count != 2 {
+		t.Errorf("expected the most recent entry to be the coalesced HSET denial, got %+v", entries)
+	}
+
+	// Read the log with ACL LOG as the default user.
+	if v := do("AUTH", "default", "password1"); v.String() != "OK" {
+		t.Fatalf("expected AUTH response \"OK\", got %q", v.String())
+	}
+	v := do("ACL", "LOG", "2")
+	if len(v.Array()) != 2 {
+		t.Fatalf("expected ACL LOG 2 to return 2 entries, got %d", len(v.Array()))
+	}
+	fields := make(map[string]string)
+	for i := 0; i+1 < len(v.Array()[0].Array()); i += 2 {
+		fields[v.Array()[0].Array()[i].String()] = v.Array()[0].Array()[i+1].String()
+	}
+	for field, value := range map[string]string{
+		"count":    "2",
+		"reason":   "command",
+		"context":  "toplevel",
+		"object":   "hset",
+		"username": "log_user",
+		"entry-id": "2",
+	} {
+		if fields[field] != value {
+			t.Errorf("expected ACL LOG field %s to be %q, got %q", field, value, fields[field])
+		}
+	}
+	for _, field := range []string{"age-seconds", "client-info", "timestamp-created", "timestamp-last-updated"} {
+		if _, ok := fields[field]; !ok {
+			t.Errorf("expected ACL LOG to return field %s", field)
+		}
+	}
+
+	if v = do("ACL", "LOG", "-1"); v.Error() == nil {
+		t.Errorf("expected ACL LOG -1 to return an error, got %q", v.String())
+	}
+
+	if v = do("ACL", "LOG", "RESET"); v.String() != "OK" {
+		t.Errorf("expected ACL LOG RESET response \"OK\", got %q", v.String())
+	}
+	if entries = mockServer.ACLLog(); len(entries) != 0 {
+		t.Errorf("expected the log to be empty after reset, got %+v", entries)
+	}
+}
+
+func Test_ACLSelectors(t *testing.T) {
+	t.Parallel()
+
+	// Load the users from a config file to cover the selectors and excluded keys of the config format.
+	aclConfig := path.Join(t.TempDir(), "acl.yaml")
+	if err := os.WriteFile(aclConfig, []byte(`
+- Username: selector_user
+  Enabled: true
+  Passwords:
+    - PasswordType: plaintext
+      PasswordValue: selector_password
+  IncludedCommands: ["get", "select"]
+  IncludedReadKeys: ["app:*"]
+  IncludedWriteKeys: ["app:*"]
+  ExcludedReadKeys: ["app:secret:*"]
+  Selectors:
+    - IncludedCategories: ["*"]
+      IncludedCommands: ["set"]
+      IncludedWriteKeys: ["cache:*"]
+- Username: database_user
+  Enabled: true
+  NoPassword: true
+  Databases: [1]
+`), 0644); err != nil {
+		t.Error(err)
+		return
+	}
+
+	port, err := internal.GetFreePort()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	mockServer, err := setUpServer(port, true, aclConfig)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	go func() {
+		mockServer.Start()
+	}()
+	t.Cleanup(func() {
+		mockServer.ShutDown()
+	})
+
+	newClient := func(username string, password string) *resp.Conn {
+		conn, err := internal.GetConnection("localhost", port)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			_ = conn.Close()
+		})
+		client := resp.NewConn(conn)
+		if err = client.WriteArray([]resp.Value{
+			resp.StringValue("AUTH"), resp.StringValue(username), resp.StringValue(password),
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if v, _, err := client.ReadValue(); err != nil || v.String() != "OK" {
+			t.Fatalf("expected AUTH %s response \"OK\", got %q, %v", username, v.String(), err)
+		}
+		return client
+	}
+	do := func(client *resp.Conn, cmd ...string) resp.Value {
+		values := make([]resp.Value, len(cmd))
+		for i, c := range cmd {
+			values[i] = resp.StringValue(c)
+		}
+		if err := client.WriteArray(values); err != nil {
+			t.Fatal(err)
+		}
+		v, _, err := client.ReadValue()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+
+	admin := newClient("default", "password1")
+
+	t.Run("Test_HandleDryRun", func(t *testing.T) {
+		tests := []struct {
+			name     string
+			database string
+			cmd      []string
+			wantRes  string
+			wantErr  string
+		}{
+			{
+				name:    "1. Allowed by the root permissions",
+				cmd:     []string{"selector_user", "GET", "app:1"},
+				wantRes: "OK",
+			},
+			{
+				name:    "2. Denied by an excluded key pattern",
+				cmd:     []string{"selector_user", "GET", "app:secret:1"},
+				wantRes: fmt.Sprintf("not authorised to access the following read keys: [%s~%s]", "%R", "app:secret:1"),
+			},
+			{
+				name:    "3. Allowed by a selector",
+				cmd:     []string{"selector_user", "SET", "cache:1", "value"},
+				wantRes: "OK",
+			},
+			{
+				name:    "4. Denied by the root permissions and the selectors",
+				cmd:     []string{"selector_user", "SET", "app:1", "value"},
+				wantRes: "not authorised to run SET command",
+			},
+			{
+				name:    "5. Denied in a database the user can't access",
+				cmd:     []string{"database_user", "GET", "key"},
+				wantRes: "not authorised to access database 0",
+			},
+			{
+				name:     "6. Allowed in a database the user can access",
+				database: "1",
+				cmd:      []string{"database_user", "GET", "key"},
+				wantRes:  "OK",
+			},
+			{
+				name:    "7. Return error when the user doesn't exist",
+				cmd:     []string{"missing_user", "GET", "key"},
+				wantErr: "no user with username missing_user",
+			},
+			{
+				name:    "8. Return error when the command doesn't exist",
+				cmd:     []string{"selector_user", "MISSING"},
+				wantErr: "command 'missing' not supported",
+			},
+		}
+
+		for _, test := range tests {
+			t.Run(test.name, func(t *testing.T) {
+				database := test.database
+				if database == "" {
+					database = "0"
+				}
+				if v := do(admin, "SELECT", database); v.String() != "OK" {
+					t.Fatalf("expected SELECT response \"OK\", got %q", v.String())
+				}
+				v := do(admin, append([]string{"ACL", "DRYRUN"}, test.cmd...)...)
+				if test.wantErr != "" {
+					if v.Error() == nil || !strings.Contains(v.Error().Error(), test.wantErr) {
+						t.Errorf("expected error %q, got %q", test.wantErr, v.String())
+					}
+					return
+				}
+				if v.String() != test.wantRes {
+					t.Errorf("expected response %q, got %q", test.wantRes, v.String())
+				}
+			})
+		}
+	})
+
+	t.Run("Test_SelectorPermissions", func(t *testing.T) {
+		client := newClient("selector_user", "selector_password")
+		if v := do(client, "SET", "cache:1", "value"); v.String() != "OK" {
+			t.Errorf("expected SET allowed by the selector to return \"OK\", got %q", v.String())
+		}
+		if v := do(client, "GET", "app:secret:1"); v.Error() == nil {
+			t.Errorf("expected GET of an excluded key to return an error, got %q", v.String())
+		}
+
+		client = newClient("database_user", "")
+		if v := do(client, "GET", "key"); v.Error() == nil ||
+			!strings.Contains(v.Error().Error(), "not authorised to access database 0") {
+			t.Errorf("expected GET in database 0 to be denied, got %q", v.String())
+		}
+		if v := do(client, "SELECT", "1"); v.String() != "OK" {
+			t.Errorf("expected SELECT 1 response \"OK\", got %q", v.String())
+		}
+		if v := do(client, "GET", "key"); v.Error() != nil {
+			t.Errorf("expected GET in database 1 to be allowed, got %q", v.Error())
+		}
+	})
+
+	t.Run("Test_SetUserSelectors", func(t *testing.T) {
+		tests := []struct {
+			name    string
+			rules   []string
+			wantErr string
+			want    string
+		}{
+			{
+				name:  "1. Selector passed as one argument",
+				rules: []string{"on", "nopass", "+get", "~app:*", "-%W~app:readonly:*", "db=0,2", "(+@all +set %W~cache:*)"},
+				want:  "set_user on nopass +@all +get %RW~app:* +&* -%W~app:readonly:* db=0,2 (+@all +set %W~cache:*)",
+			},
+			{
+				name:  "2. Selector spread over several arguments",
+				rules: []string{"on", "nopass", "clearselectors", "(+@all", "+hget", "~hash:*)"},
+				want:  "set_user on nopass +@all +get %RW~app:* +&* -%W~app:readonly:* db=0,2 (+@all +hget %RW~hash:*)",
+			},
+			{
+				name:    "3. Return error when the selector is not closed",
+				rules:   []string{"(+get ~key"},
+				wantErr: "unmatched parenthesis in ACL selector",
+			},
+			{
+				name:    "4. Return error when the database is invalid",
+				rules:   []string{"db=one"},
+				wantErr: "invalid database one in rule db=one",
+			},
+		}
+		for _, test := range tests {
+			t.Run(test.name, func(t *testing.T) {
+				v := do(admin, append([]string{"ACL", "SETUSER", "set_user"}, test.rules...)...)
+				if test.wantErr != "" {
+					if v.Error() == nil || !strings.Contains(v.Error().Error(), test.wantErr) {
+						t.Errorf("expected error %q, got %q", test.wantErr, v.String())
+					}
+					return
+				}
+				if v.String() != "OK" {
+					t.Fatalf("expected ACL SETUSER response \"OK\", got %q", v.String())
+				}
+				v = do(admin, "ACL", "LIST")
+				idx := slices.IndexFunc(v.Array(), func(user resp.Value) bool {
+					return strings.HasPrefix(user.String(), "set_user ")
+				})
+				if idx == -1 || v.Array()[idx].String() != test.want {
+					t.Errorf("expected ACL LIST to contain %q, got %v", test.want, v.Array())
+				}
+			})
+		}
+	})
+}
+
+func Test_ACLPasswordHashing(t *testing.T) {
+	t.Parallel()
+
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte("bcrypt_password"), bcrypt.MinCost)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	salt := []byte("0123456789abcdef")
+	argon2Hash := fmt.Sprintf("$argon2id$v=%d$m=1024,t=1,p=1$%s$%s", argon2.Version,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(argon2.IDKey([]byte("argon2_password"), salt, 1, 1024, 1, 32)))
+
+	// The type of the argon2id hash in the config file is detected from its format.
+	aclConfig := path.Join(t.TempDir(), "acl.yaml")
+	if err = os.WriteFile(aclConfig, []byte(fmt.Sprintf(`
+- Username: migrate_user
+  Enabled: true
+  Passwords:
+    - PasswordType: plaintext
+      PasswordValue: migrate_password
+- Username: argon2_user
+  Enabled: true
+  Passwords:
+    - PasswordValue: "%s"
+- Username: invalid_argon2_user
+  Enabled: true
+  Passwords:
+    - PasswordValue: "%s"
+`, argon2Hash, strings.Replace(argon2Hash, "t=1", "t=0", 1))), 0644); err != nil {
+		t.Error(err)
+		return
+	}
+
+	port, err := internal.GetFreePort()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	mockServer, err := sugardb.NewSugarDB(
+		sugardb.WithConfig(config.Config{
+			BindAddr:        "localhost",
+			Port:            uint16(port),
+			EvictionPolicy:  constants.NoEviction,
+			RequirePass:     true,
+			Password:        "#" + generateSHA256Password("password1"),
+			AclConfig:       aclConfig,
+			AclPasswordHash: acl.PasswordBcrypt,
+			AclBcryptCost:   bcrypt.MinCost,
+		}),
+	)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	go func() {
+		mockServer.Start()
+	}()
+	t.Cleanup(func() {
+		mockServer.ShutDown()
+	})
+
+	conn, err := internal.GetConnection("localhost", port)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+	client := resp.NewConn(conn)
+
+	do := func(cmd ...string) resp.Value {
+		values := make([]resp.Value, len(cmd))
+		for i, c := range cmd {
+			values[i] = resp.StringValue(c)
+		}
+		if err := client.WriteArray(values); err != nil {
+			t.Fatal(err)
+		}
+		v, _, err := client.ReadValue()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	userRule := func(username string) string {
+		list, err := mockServer.ACLList()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, rule := range list {
+			if strings.HasPrefix(rule, username+" ") {
+				return rule
+			}
+		}
+		t.Fatalf("user %s not found in ACL LIST", username)
+		return ""
+	}
+
+	if v := do("AUTH", "password1"); v.String() != "OK" {
+		t.Fatalf("expected AUTH with the SHA256 --password to return \"OK\", got %q", v.String())
+	}
+	if rule := userRule("default"); !strings.Contains(rule, " #$2a$04$") {
+		t.Errorf("expected the default user's SHA256 password to be migrated to bcrypt, got %q", rule)
+	}
+
+	t.Run("Test_HashOnSetUser", func(t *testing.T) {
+		if v := do("ACL", "SETUSER", "hash_user", "on", ">hash_password", "+@all"); v.String() != "OK" {
+			t.Fatalf("expected ACL SETUSER response \"OK\", got %q", v.String())
+		}
+		rule := userRule("hash_user")
+		if strings.Contains(rule, "hash_password") || !strings.Contains(rule, " #$2a$04$") {
+			t.Errorf("expected the plaintext password to be stored as a bcrypt hash, got %q", rule)
+		}
+		if v := do("AUTH", "hash_user", "hash_password"); v.String() != "OK" {
+			t.Errorf("expected AUTH response \"OK\", got %q", v.String())
+		}
+		if v := do("AUTH", "hash_user", "wrong_password"); v.Error() == nil {
+			t.Errorf("expected AUTH with a wrong password to return an error, got %q", v.String())
+		}
+		// Removing the plaintext password removes its hash.
+		if v := do("AUTH", "default", "password1"); v.String() != "OK" {
+			t.Fatalf("expected AUTH response \"OK\", got %q", v.String())
+		}
+		if v := do("ACL", "SETUSER", "hash_user", "<hash_password"); v.String() != "OK" {
+			t.Fatalf("expected ACL SETUSER response \"OK\", got %q", v.String())
+		}
+		if rule = userRule("hash_user"); strings.Contains(rule, "#") {
+			t.Errorf("expected the password hash to be removed, got %q", rule)
+		}
+	})
+
+	t.Run("Test_DetectHashOnSetUser", func(t *testing.T) {
+		if v := do("ACL", "SETUSER", "bcrypt_user", "on", "#"+string(bcryptHash), "+@all"); v.String() != "OK" {
+			t.Fatalf("expected ACL SETUSER response \"OK\", got %q", v.String())
+		}
+		if rule := userRule("bcrypt_user"); !strings.Contains(rule, " #"+string(bcryptHash)) {
+			t.Errorf("expected the bcrypt hash to be stored as is, got %q", rule)
+		}
+		if v := do("AUTH", "bcrypt_user", "bcrypt_password"); v.String() != "OK" {
+			t.Errorf("expected AUTH response \"OK\", got %q", v.String())
+		}
+	})
+
+	t.Run("Test_RejectInvalidArgon2Hash", func(t *testing.T) {
+		// A user from the config file with a hash that can't be verified is not loaded.
+		if users, err := mockServer.ACLUsers(); err != nil || slices.Contains(users, "invalid_argon2_user") {
+			t.Errorf("expected the user with an invalid argon2id hash not to be loaded, got %v, %v", users, err)
+		}
+		for _, params := range []string{"m=1024,t=0,p=1", "m=1024,t=1,p=0", "m=1024,t=1,p=256", "m=4294967295,t=1,p=1"} {
+			hash := strings.Replace(argon2Hash, "m=1024,t=1,p=1", params, 1)
+			v := do("ACL", "SETUSER", "invalid_argon2_user", "on", "#"+hash, "+@all")
+			if v.Error() == nil || !strings.Contains(v.Error().Error(), "out of range") {
+				t.Errorf("expected ACL SETUSER with argon2id parameters %s to return an error, got %q", params, v.String())
+			}
+		}
+	})
+
+	t.Run("Test_MigrateOnAuth", func(t *testing.T) {
+		if rule := userRule("migrate_user"); !strings.Contains(rule, " >migrate_password") {
+			t.Fatalf("expected the plaintext password to be kept until authentication, got %q", rule)
+		}
+		if v := do("AUTH", "migrate_user", "migrate_password"); v.String() != "OK" {
+			t.Fatalf("expected AUTH response \"OK\", got %q", v.String())
+		}
+		if rule := userRule("migrate_user"); strings.Contains(rule, "migrate_password") ||
+			!strings.Contains(rule, " #$2a$04$") {
+			t.Errorf("expected the plaintext password to be migrated to bcrypt, got %q", rule)
+		}
+		if v := do("AUTH", "migrate_user", "migrate_password"); v.String() != "OK" {
+			t.Errorf("expected AUTH with the migrated password to return \"OK\", got %q", v.String())
+		}
+
+		if v := do("AUTH", "argon2_user", "argon2_password"); v.String() != "OK" {
+			t.Fatalf("expected AUTH with the argon2id password to return \"OK\", got %q", v.String())
+		}
+		if rule := userRule("argon2_user"); strings.Contains(rule, "$argon2id$") ||
+			!strings.Contains(rule, " #$2a$04$") {
+			t.Errorf("expected the argon2id password to be migrated to bcrypt, got %q", rule)
+		}
+	})
+
+	t.Run("Test_NoMigrationInCluster", func(t *testing.T) {
+		// The passwords of a cluster node are not migrated on authentication, as the change would only
+		// apply to the node.
+		clusterACL := acl.NewACL(config.Config{
+			BootstrapCluster: true,
+			RequirePass:      true,
+			AclPasswordHash:  acl.PasswordBcrypt,
+			AclBcryptCost:    bcrypt.MinCost,
+			Password:         "cluster_password",
+		})
+		conn, _ := net.Pipe()
+		t.Cleanup(func() {
+			_ = conn.Close()
+		})
+		if err := clusterACL.RegisterConnection(&conn); err != nil {
+			t.Fatal(err)
+		}
+		if err := clusterACL.AuthenticateConnection(context.Background(), &conn, []string{"AUTH", "cluster_password"}); err != nil {
+			t.Fatalf("expected AUTH to succeed, got %v", err)
+		}
+		for _, user := range clusterACL.Users {
+			for _, password := range user.Passwords {
+				if password.PasswordType != acl.PasswordPlainText {
+					t.Errorf("expected the password of user %s not to be migrated, got %s", user.Username, password.PasswordType)
+				}
+			}
+		}
+	})
+
+	t.Run("Test_HandleGenPass", func(t *testing.T) {
+		if v := do("AUTH", "default", "password1"); v.String() != "OK" {
+			t.Fatalf("expected AUTH response \"OK\", got %q", v.String())
+		}
+		tests := []struct {
+			name    string
+			cmd     []string
+			wantLen int
+			wantErr string
+		}{
+			{name: "1. Generate a 256 bit password by default", cmd: []string{"ACL", "GENPASS"}, wantLen: 64},
+			{name: "2. Generate a password with the number of bits", cmd: []string{"ACL", "GENPASS", "5"}, wantLen: 2},
+			{
+				name:    "3. Return an error when bits is out of range",
+				cmd:     []string{"ACL", "GENPASS", "0"},
+				wantErr: "bits must be an integer between 1 and 4096",
+			},
+		}
+		for _, test := range tests {
+			v := do(test.cmd...)
+			if test.wantErr != "" {
+				if v.Error() == nil || !strings.Contains(v.Error().Error(), test.wantErr) {
+					t.Errorf("%s: expected error %q, got %q", test.name, test.wantErr, v.String())
+				}
+				continue
+			}
+			if len(v.String()) != test.wantLen {
+				t.Errorf("%s: expected a password of length %d, got %q", test.name, test.wantLen, v.String())
+			}
+			if _, err := hex.DecodeString(v.String() + strings.Repeat("0", len(v.String())%2)); err != nil {
+				t.Errorf("%s: expected a hex encoded password, got %q", test.name, v.String())
+			}
+		}
+		if a, b := do("ACL", "GENPASS").String(), do("ACL", "GENPASS").String(); a == b {
+			t.Errorf("expected generated passwords to be different, got %q twice", a)
+		}
+
+		password, err := mockServer.ACLGenPass(128)
+		if err != nil {
+			t.Error(err)
+		}
+		if len(password) != 32 {
+			t.Errorf("expected ACLGenPass(128) to return 32 characters, got %q", password)
+		}
+	})
+}
+
+func Test_ACLClientCertificates(t *testing.T) {
+	t.Parallel()
+
+	// Create the client CA and write it to the file the server loads its client CAs from.
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test Client CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	clientCA := path.Join(t.TempDir(), "client_ca.crt")
+	if err = os.WriteFile(clientCA, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER}), 0644); err != nil {
+		t.Error(err)
+		return
+	}
+
+	uidOID := asn1.ObjectIdentifier{0, 9, 2342, 19200300, 100, 1, 1}
+	newClientCertificate := func(subject pkix.Name, uris []string) tls.Certificate {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(time.Now().UnixNano()),
+			Subject:      subject,
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		}
+		for _, uri := range uris {
+			u, err := url.Parse(uri)
+			if err != nil {
+				t.Fatal(err)
+			}
+			template.URIs = append(template.URIs, u)
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, caTemplate, &key.PublicKey, caKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+	}
+
+	serverCAs := x509.NewCertPool()
+	serverCA, err := os.ReadFile(path.Join("..", "..", "..", "openssl", "server", "rootCA.crt"))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	serverCAs.AppendCertsFromPEM(serverCA)
+
+	startServer := func(field string, oid string, noPassword bool) int {
+		port, err := internal.GetFreePort()
+		if err != nil {
+			t.Fatal(err)
+		}
+		mockServer, err := sugardb.NewSugarDB(
+			sugardb.WithConfig(config.Config{
+				BindAddr:       "localhost",
+				Port:           uint16(port),
+				EvictionPolicy: constants.NoEviction,
+				RequirePass:    true,
+				Password:       "password1",
+				TLS:            true,
+				MTLS:           true,
+				ClientCAs:      []string{clientCA},
+				CertKeyPairs: [][]string{{
+					path.Join("..", "..", "..", "openssl", "server", "server1.crt"),
+					path.Join("..", "..", "..", "openssl", "server", "server1.key"),
+				}},
+				AclCertUserField:  field,
+				AclCertUserOID:    oid,
+				AclCertNoPassword: noPassword,
+			}),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, user := range []sugardb.User{
+			{
+				Username:          "cert_user",
+				Enabled:           true,
+				AddPlainPasswords: []string{"cert_password"},
+				IncludeCategories: []string{"*"},
+				IncludeCommands:   []string{"*"},
+			},
+			{Username: "disabled_user", Enabled: false, NoPassword: true},
+		} {
+			if _, err = mockServer.ACLSetUser(user); err != nil {
+				t.Fatal(err)
+			}
+		}
+		go func() {
+			mockServer.Start()
+		}()
+		t.Cleanup(func() {
+			mockServer.ShutDown()
+		})
+		return port
+	}
+
+	do := func(client *resp.Conn, cmd ...string) resp.Value {
+		values := make([]resp.Value, len(cmd))
+		for i, c := range cmd {
+			values[i] = resp.StringValue(c)
+		}
+		if err := client.WriteArray(values); err != nil {
+			t.Fatal(err)
+		}
+		v, _, err := client.ReadValue()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+
+	tests := []struct {
+		name        string
+		field       string
+		oid         string
+		noPassword  bool
+		subject     pkix.Name
+		uris        []string
+		wantErr     string
+		wantUser    string
+		wantAuthErr bool // Whether the connection must authenticate with a password.
+	}{
+		{
+			name:       "1. Map the common name to a user without requiring a password",
+			field:      acl.CertUserFieldCN,
+			noPassword: true,
+			subject:    pkix.Name{CommonName: "cert_user"},
+			wantUser:   "cert_user",
+		},
+		{
+			name:       "2. Map the first URI of an existing user",
+			field:      acl.CertUserFieldSANURI,
+			noPassword: true,
+			subject:    pkix.Name{CommonName: "client"},
+			uris:       []string{"spiffe://sugardb/unknown", "cert_user"},
+			wantUser:   "cert_user",
+		},
+		{
+			name:        "3. Map the configured OID and require the user's password",
+			field:       acl.CertUserFieldOID,
+			oid:         uidOID.String(),
+			subject:     pkix.Name{CommonName: "client", ExtraNames: []pkix.AttributeTypeAndValue{{Type: uidOID, Value: "cert_user"}}},
+			wantUser:    "cert_user",
+			wantAuthErr: true,
+		},
+		{
+			name:       "4. Reject a certificate that maps to an unknown user",
+			field:      acl.CertUserFieldCN,
+			noPassword: true,
+			subject:    pkix.Name{CommonName: "unknown_user"},
+			wantErr:    "client certificate does not map to a user",
+		},
+		{
+			name:       "5. Reject a certificate that maps to a disabled user",
+			field:      acl.CertUserFieldCN,
+			noPassword: true,
+			subject:    pkix.Name{CommonName: "disabled_user"},
+			wantErr:    "user disabled_user is disabled",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			port := startServer(test.field, test.oid, test.noPassword)
+			conn, err := internal.GetTLSConnection("localhost", port, &tls.Config{
+				RootCAs:      serverCAs,
+				Certificates: []tls.Certificate{newClientCertificate(test.subject, test.uris)},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() {
+				_ = conn.Close()
+			}()
+			client := resp.NewConn(conn)
+
+			if test.wantErr != "" {
+				v, _, err := client.ReadValue()
+				if err != nil || v.Error() == nil || !strings.Contains(v.Error().Error(), test.wantErr) {
+					t.Errorf("expected the connection to be rejected with error %q, got %q, %v", test.wantErr, v.String(), err)
+				}
+				return
+			}
+
+			if test.wantAuthErr {
+				if v := do(client, "ACL", "WHOAMI"); v.Error() == nil {
+					t.Errorf("expected ACL WHOAMI to require authentication, got %q", v.String())
+				}
+				if v := do(client, "AUTH", test.wantUser, "cert_password"); v.String() != "OK" {
+					t.Fatalf("expected AUTH response \"OK\", got %q", v.String())
+				}
+			}
+			if v := do(client, "ACL", "WHOAMI"); v.String() != test.wantUser {
+				t.Errorf("expected ACL WHOAMI response %q, got %q", test.wantUser, v.String())
+			}
+		})
+	}
+}
+
+func Test_ACLJWTAuthentication(t *testing.T) {
+	t.Parallel()
+
+	// The server checks token expiry with the mock clock in tests.
+	now := clock.NewClock().Now()
+
+	dir := t.TempDir()
+	hsSecret := []byte("jwt_secret_of_at_least_32_bytes!")
+	if err := os.WriteFile(path.Join(dir, "hs.key"), hsSecret, 0644); err != nil {
+		t.Error(err)
+		return
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	rsaPublicKey, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if err = os.WriteFile(path.Join(dir, "rsa.pem"),
+		pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: rsaPublicKey}), 0644); err != nil {
+		t.Error(err)
+		return
+	}
+	edPublicKey, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if err = os.WriteFile(path.Join(dir, "jwks.json"), []byte(fmt.Sprintf(
+		`{"keys": [{"kty": "OKP", "crv": "Ed25519", "kid": "ed", "use": "sig", "x": "%s"}]}`,
+		base64.RawURLEncoding.EncodeToString(edPublicKey),
+	)), 0644); err != nil {
+		t.Error(err)
+		return
+	}
+
+	signToken := func(algorithm string, kid string, key any, claims map[string]any) string {
+		header, _ := json.Marshal(map[string]string{"alg": algorithm, "typ": "JWT", "kid": kid})
+		payload, _ := json.Marshal(claims)
+		signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+		var signature []byte
+		switch algorithm {
+		case acl.JWTAlgorithmHS256:
+			mac := hmac.New(sha256.New, key.([]byte))
+			mac.Write([]byte(signed))
+			signature = mac.Sum(nil)
+		case acl.JWTAlgorithmRS256:
+			digest := sha256.Sum256([]byte(signed))
+			signature, _ = rsa.SignPKCS1v15(rand.Reader, key.(*rsa.PrivateKey), crypto.SHA256, digest[:])
+		case acl.JWTAlgorithmEdDSA:
+			signature = ed25519.Sign(key.(ed25519.PrivateKey), []byte(signed))
+		}
+		return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+	}
+	claims := func(subject string, expiresIn time.Duration, extra map[string]any) map[string]any {
+		c := map[string]any{"sub": subject, "aud": "sugardb", "exp": now.Add(expiresIn).Unix()}
+		for k, v := range extra {
+			c[k] = v
+		}
+		return c
+	}
+
+	startServer := func(expiryAction string) int {
+		port, err := internal.GetFreePort()
+		if err != nil {
+			t.Fatal(err)
+		}
+		mockServer, err := sugardb.NewSugarDB(
+			sugardb.WithConfig(config.Config{
+				BindAddr:               "localhost",
+				Port:                   uint16(port),
+				EvictionPolicy:         constants.NoEviction,
+				RequirePass:            true,
+				Password:               "password1",
+				AclJWTKeyFiles:         []string{path.Join(dir, "hs.key"), path.Join(dir, "rsa.pem")},
+				AclJWKSFile:            path.Join(dir, "jwks.json"),
+				AclJWTUsernameClaim:    "sub",
+				AclJWTPermissionsClaim: "acl",
+				AclJWTAudience:         "sugardb",
+				AclJWTExpiryAction:     expiryAction,
+			}),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, user := range []sugardb.User{
+			{
+				Username:          "token_user",
+				Enabled:           true,
+				AddPlainPasswords: []string{"token_password"},
+				IncludeCategories: []string{"*"},
+				IncludeCommands:   []string{"*"},
+			},
+			{Username: "disabled_user", Enabled: false, NoPassword: true},
+		} {
+			if _, err = mockServer.ACLSetUser(user); err != nil {
+				t.Fatal(err)
+			}
+		}
+		go func() {
+			mockServer.Start()
+		}()
+		t.Cleanup(func() {
+			mockServer.ShutDown()
+		})
+		return port
+	}
+	newClient := func(port int) *resp.Conn {
+		conn, err := internal.GetConnection("localhost", port)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			_ = conn.Close()
+		})
+		return resp.NewConn(conn)
+	}
+	do := func(client *resp.Conn, cmd ...string) resp.Value {
+		values := make([]resp.Value, len(cmd))
+		for i, c := range cmd {
+			values[i] = resp.StringValue(c)
+		}
+		if err := client.WriteArray(values); err != nil {
+			t.Fatal(err)
+		}
+		v, _, err := client.ReadValue()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+
+	port := startServer(acl.JWTExpiryReauth)
+
+	t.Run("Test_AuthenticateWithToken", func(t *testing.T) {
+		tests := []struct {
+			name     string
+			auth     []string
+			wantUser string
+			wantErr  string
+		}{
+			{
+				name:     "1. Authenticate with an HS256 token",
+				auth:     []string{signToken(acl.JWTAlgorithmHS256, "hs", hsSecret, claims("token_user", time.Hour, nil))},
+				wantUser: "token_user",
+			},
+			{
+				name: "2. Authenticate with an RS256 token and the username",
+				auth: []string{
+					"token_user",
+					signToken(acl.JWTAlgorithmRS256, "", rsaKey, claims("token_user", time.Hour, nil)),
+				},
+				wantUser: "token_user",
+			},
+			{
+				name:     "3. Authenticate with an EdDSA token verified with a key from the JWKS file",
+				auth:     []string{signToken(acl.JWTAlgorithmEdDSA, "ed", edKey, claims("token_user", time.Hour, nil))},
+				wantUser: "token_user",
+			},
+			{
+				name: "4. Reject a token issued to another user",
+				auth: []string{
+					"default",
+					signToken(acl.JWTAlgorithmHS256, "hs", hsSecret, claims("token_user", time.Hour, nil)),
+				},
+				wantErr: "token is not issued to user default",
+			},
+			{
+				name:    "5. Reject an expired token",
+				auth:    []string{signToken(acl.JWTAlgorithmHS256, "hs", hsSecret, claims("token_user", -time.Second, nil))},
+				wantErr: "token is expired",
+			},
+			{
+				name:    "6. Reject a token with an invalid signature",
+				auth:    []string{signToken(acl.JWTAlgorithmHS256, "hs", []byte("other_secret_of_at_least_32_bytes"), claims("token_user", time.Hour, nil))},
+				wantErr: "invalid token signature",
+			},
+			{
+				name: "7. Reject a token for another audience",
+				auth: []string{signToken(acl.JWTAlgorithmHS256, "hs", hsSecret,
+					claims("token_user", time.Hour, map[string]any{"aud": "other"}))},
+				wantErr: "token audience is not allowed",
+			},
+			{
+				name:    "8. Reject a token of an unknown user without permissions",
+				auth:    []string{signToken(acl.JWTAlgorithmHS256, "hs", hsSecret, claims("unknown_user", time.Hour, nil))},
+				wantErr: "no user with username unknown_user",
+			},
+			{
+				name:    "9. Reject a token of a disabled user",
+				auth:    []string{signToken(acl.JWTAlgorithmHS256, "hs", hsSecret, claims("disabled_user", time.Hour, nil))},
+				wantErr: "user disabled_user is disabled",
+			},
+			{
+				name:     "10. Passwords still authenticate when tokens are enabled",
+				auth:     []string{"token_user", "token_password"},
+				wantUser: "token_user",
+			},
+		}
+		for _, test := range tests {
+			client := newClient(port)
+			v := do(client, append([]string{"AUTH"}, test.auth...)...)
+			if test.wantErr != "" {
+				if v.Error() == nil || !strings.Contains(v.Error().Error(), test.wantErr) {
+					t.Errorf("%s: expected error %q, got %q", test.name, test.wantErr, v.String())
+				}
+				continue
+			}
+			if v.String() != "OK" {
+				t.Errorf("%s: expected AUTH response \"OK\", got %q", test.name, v.String())
+				continue
+			}
+			if v = do(client, "ACL", "WHOAMI"); v.String() != test.wantUser {
+				t.Errorf("%s: expected ACL WHOAMI response %q, got %q", test.name, test.wantUser, v.String())
+			}
+		}
+	})
+
+	t.Run("Test_PermissionsClaim", func(t *testing.T) {
+		client := newClient(port)
+		token := signToken(acl.JWTAlgorithmHS256, "hs", hsSecret,
+			claims("service", time.Hour, map[string]any{"acl": []string{"+@all", "-@write", "%R~app:*"}}))
+		if v := do(client, "AUTH", token); v.String() != "OK" {
+			t.Fatalf("expected AUTH response \"OK\", got %q", v.String())
+		}
+		if v := do(client, "ACL", "WHOAMI"); v.String() != "service" {
+			t.Errorf("expected ACL WHOAMI response \"service\", got %q", v.String())
+		}
+		if v := do(client, "GET", "app:1"); v.Error() != nil {
+			t.Errorf("expected GET app:1 to be allowed, got %v", v.Error())
+		}
+		if v := do(client, "GET", "other"); v.Error() == nil {
+			t.Errorf("expected GET other to be denied, got %q", v.String())
+		}
+		if v := do(client, "SET", "app:1", "value"); v.Error() == nil {
+			t.Errorf("expected SET app:1 to be denied, got %q", v.String())
+		}
+	})
+
+	t.Run("Test_ExpiryReauth", func(t *testing.T) {
+		client := newClient(port)
+		token := signToken(acl.JWTAlgorithmHS256, "hs", hsSecret, claims("token_user", time.Second, nil))
+		if v := do(client, "AUTH", token); v.String() != "OK" {
+			t.Fatalf("expected AUTH response \"OK\", got %q", v.String())
+		}
+		<-time.After(1500 * time.Millisecond)
+		if v := do(client, "GET", "key"); v.Error() == nil ||
+			!strings.Contains(v.Error().Error(), "credential expired, re-authenticate with AUTH") {
+			t.Errorf("expected the expired connection to re-authenticate, got %q", v.String())
+		}
+		if v := do(client, "AUTH", "token_user", "token_password"); v.String() != "OK" {
+			t.Errorf("expected AUTH response \"OK\", got %q", v.String())
+		}
+		if v := do(client, "ACL", "WHOAMI"); v.String() != "token_user" {
+			t.Errorf("expected ACL WHOAMI response \"token_user\", got %q", v.String())
+		}
+	})
+
+	t.Run("Test_ExpiryDisconnect", func(t *testing.T) {
+		client := newClient(startServer(acl.JWTExpiryDisconnect))
+		token := signToken(acl.JWTAlgorithmHS256, "hs", hsSecret, claims("token_user", time.Second, nil))
+		if v := do(client, "AUTH", token); v.String() != "OK" {
+			t.Fatalf("expected AUTH response \"OK\", got %q", v.String())
+		}
+		<-time.After(1500 * time.Millisecond)
+		if err := client.WriteArray([]resp.Value{resp.StringValue("PING")}); err != nil {
+			return
+		}
+		if v, _, err := client.ReadValue(); err == nil {
+			t.Errorf("expected the connection to be closed, got %q", v.String())
+		}
+	})
+
+	t.Run("Test_InvalidKeys", func(t *testing.T) {
+		encode := base64.RawURLEncoding.EncodeToString
+		n := encode(rsaKey.PublicKey.N.Bytes())
+		tests := []struct {
+			name    string
+			keyFile string
+			jwks    string
+			wantErr string
+		}{
+			{
+				name:    "1. Reject a short secret file",
+				keyFile: "short",
+				wantErr: "secret is shorter than 32 bytes",
+			},
+			{
+				name:    "2. Reject an empty secret file",
+				keyFile: "",
+				wantErr: "empty secret",
+			},
+			{
+				name:    "3. Reject a JWKS oct key without a secret",
+				jwks:    `{"keys": [{"kty": "oct", "kid": "hs"}]}`,
+				wantErr: "key hs: empty secret",
+			},
+			{
+				name:    "4. Reject a JWKS oct key with a short secret",
+				jwks:    fmt.Sprintf(`{"keys": [{"kty": "oct", "kid": "hs", "k": "%s"}]}`, encode([]byte("short"))),
+				wantErr: "key hs: secret is shorter than 32 bytes",
+			},
+			{
+				name:    "5. Reject a JWKS RSA key with a zero exponent",
+				jwks:    fmt.Sprintf(`{"keys": [{"kty": "RSA", "kid": "rsa", "n": "%s", "e": "AA"}]}`, n),
+				wantErr: "key rsa: invalid RSA public key",
+			},
+			{
+				name: "6. Reject a JWKS RSA key with an exponent that overflows an int",
+				jwks: fmt.Sprintf(`{"keys": [{"kty": "RSA", "kid": "rsa", "n": "%s", "e": "%s"}]}`,
+					n, encode([]byte{1, 0, 0, 0, 0, 0, 0, 0, 1})),
+				wantErr: "key rsa: invalid RSA public key",
+			},
+			{
+				name:    "7. Accept a JWKS oct key with a long enough secret",
+				jwks:    fmt.Sprintf(`{"keys": [{"kty": "oct", "kid": "hs", "k": "%s"}]}`, encode(hsSecret)),
+				wantErr: "",
+			},
+		}
+		for _, test := range tests {
+			t.Run(test.name, func(t *testing.T) {
+				var conf config.Config
+				if test.jwks != "" {
+					conf.AclJWKSFile = path.Join(t.TempDir(), "jwks.json")
+					if err := os.WriteFile(conf.AclJWKSFile, []byte(test.jwks), 0644); err != nil {
+						t.Fatal(err)
+					}
+				} else {
+					keyFile := path.Join(t.TempDir(), "hs.key")
+					if err := os.WriteFile(keyFile, []byte(test.keyFile), 0644); err != nil {
+						t.Fatal(err)
+					}
+					conf.AclJWTKeyFiles = []string{keyFile}
+				}
+				_, err := acl.NewJWTAuthenticator(conf)
+				if test.wantErr == "" {
+					if err != nil {
+						t.Errorf("expected no error, got %v", err)
+					}
+					return
+				}
+				if err == nil || !strings.HasSuffix(err.Error(), test.wantErr) {
+					t.Errorf("expected error %q, got %v", test.wantErr, err)
+				}
+			})
+		}
+	})
+}
+
+func Test_ACLQuotas(t *testing.T) {
+	t.Parallel()
+
+	port, err := internal.GetFreePort()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	mockServer, err := setUpServer(port, true, "")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	go func() {
+		mockServer.Start()
+	}()
+	t.Cleanup(func() {
+		mockServer.ShutDown()
+	})
+
+	do := func(client *resp.Conn, cmd ...string) resp.Value {
+		values := make([]resp.Value, len(cmd))
+		for i, c := range cmd {
+			values[i] = resp.StringValue(c)
+		}
+		if err := client.WriteArray(values); err != nil {
+			t.Fatal(err)
+		}
+		v, _, err := client.ReadValue()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	newClient := func(username string, password string) (*resp.Conn, net.Conn, resp.Value) {
+		conn, err := internal.GetConnection("localhost", port)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			_ = conn.Close()
+		})
+		client := resp.NewConn(conn)
+		return client, conn, do(client, "AUTH", username, password)
+	}
+	usage := func(username string) []string {
+		rules, err := mockServer.ACLGetUser(username)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rules["usage"]
+	}
+
+	admin, _, _ := newClient("default", "password1")
+
+	t.Run("Test_SetUserQuotas", func(t *testing.T) {
+		tests := []struct {
+			name    string
+			rules   []string
+			wantErr string
+			want    string
+		}{
+			{
+				name:  "1. Set the quotas, with a unit for the memory quotas",
+				rules: []string{"on", "nopass", "commands-per-sec=100", "bytes-out-per-sec=1kb", "maxkeys=10", "maxmemory=1mb"},
+				want:  "quota_user on nopass +@all +all %RW~* +&* commands-per-sec=100 bytes-out-per-sec=1024 maxkeys=10 maxmemory=1048576",
+			},
+			{
+				name:  "2. Reset the quotas",
+				rules: []string{"resetquotas", "maxconns=2"},
+				want:  "quota_user on nopass +@all +all %RW~* +&* maxconns=2",
+			},
+			{
+				name:    "3. Return error when the quota is invalid",
+				rules:   []string{"maxkeys=ten"},
+				wantErr: "invalid value ten in rule maxkeys=ten",
+			},
+		}
+		for _, test := range tests {
+			t.Run(test.name, func(t *testing.T) {
+				v := do(admin, append([]string{"ACL", "SETUSER", "quota_user"}, test.rules...)...)
+				if test.wantErr != "" {
+					if v.Error() == nil || !strings.Contains(v.Error().Error(), test.wantErr) {
+						t.Errorf("expected error %q, got %q", test.wantErr, v.String())
+					}
+					return
+				}
+				if v.String() != "OK" {
+					t.Fatalf("expected ACL SETUSER response \"OK\", got %q", v.String())
+				}
+				v = do(admin, "ACL", "LIST")
+				idx := slices.IndexFunc(v.Array(), func(user resp.Value) bool {
+					return strings.HasPrefix(user.String(), "quota_user ")
+				})
+				if idx == -1 || v.Array()[idx].String() != test.want {
+					t.Errorf("expected ACL LIST to contain %q, got %v", test.want, v.Array())
+				}
+			})
+		}
+	})
+
+	t.Run("Test_RateLimits", func(t *testing.T) {
+		// The clock does not advance in tests, so the rate limits don't reset.
+		if v := do(admin, "ACL", "SETUSER", "rate_user", "on", "nopass", "commands-per-sec=3"); v.String() != "OK" {
+			t.Fatalf("expected ACL SETUSER response \"OK\", got %q", v.String())
+		}
+		client, _, _ := newClient("rate_user", "")
+		for i := 0; i < 3; i++ {
+			if v := do(client, "PING"); v.String() != "PONG" {
+				t.Errorf("expected PING %d response \"PONG\", got %q", i+1, v.String())
+			}
+		}
+		wantErr := "rate limit exceeded: user rate_user is limited to 3 commands per second"
+		if v := do(client, "PING"); v.Error() == nil || !strings.Contains(v.Error().Error(), wantErr) {
+			t.Errorf("expected error %q, got %q", wantErr, v.String())
+		}
+		if got := usage("rate_user"); !slices.Contains(got, "commands-per-sec=3") ||
+			!slices.Contains(got, "connections=1") || !slices.Contains(got, "rejected=1") {
+			t.Errorf("expected the usage to report 3 commands, 1 connection and 1 rejection, got %v", got)
+		}
+
+		if v := do(admin, "ACL", "SETUSER", "bytes_user", "on", "nopass", "bytes-out-per-sec=10"); v.String() != "OK" {
+			t.Fatalf("expected ACL SETUSER response \"OK\", got %q", v.String())
+		}
+		client, _, _ = newClient("bytes_user", "")
+		if v := do(client, "ECHO", "a response longer than 10 bytes"); v.Error() != nil {
+			t.Errorf("expected ECHO to be allowed, got %q", v.Error())
+		}
+		wantErr = "rate limit exceeded: user bytes_user is limited to 10 bytes out per second"
+		if v := do(client, "PING"); v.Error() == nil || !strings.Contains(v.Error().Error(), wantErr) {
+			t.Errorf("expected error %q, got %q", wantErr, v.String())
+		}
+	})
+
+	t.Run("Test_MaxConnections", func(t *testing.T) {
+		if v := do(admin, "ACL", "SETUSER", "conn_user", "on", ">conn_password", "maxconns=1"); v.String() != "OK" {
+			t.Fatalf("expected ACL SETUSER response \"OK\", got %q", v.String())
+		}
+		_, conn, v := newClient("conn_user", "conn_password")
+		if v.String() != "OK" {
+			t.Fatalf("expected AUTH response \"OK\", got %q", v.String())
+		}
+		wantErr := "max connections reached: user conn_user is limited to 1 connections"
+		if _, _, v = newClient("conn_user", "conn_password"); v.Error() == nil ||
+			!strings.Contains(v.Error().Error(), wantErr) {
+			t.Errorf("expected error %q, got %q", wantErr, v.String())
+		}
+
+		// The connection no longer counts once it's closed.
+		_ = conn.Close()
+		for i := 0; i < 100 && !slices.Contains(usage("conn_user"), "connections=0"); i++ {
+			<-time.After(10 * time.Millisecond)
+		}
+		if _, _, v = newClient("conn_user", "conn_password"); v.String() != "OK" {
+			t.Errorf("expected AUTH response \"OK\" after the connection was closed, got %q", v.String())
+		}
+	})
+
+	t.Run("Test_KeysAndMemoryQuotas", func(t *testing.T) {
+		if v := do(admin, "ACL", "SETUSER", "keys_user", "on", "nopass", "~keys:*", "maxkeys=2"); v.String() != "OK" {
+			t.Fatalf("expected ACL SETUSER response \"OK\", got %q", v.String())
+		}
+		client, _, _ := newClient("keys_user", "")
+		for _, key := range []string{"keys:1", "keys:2", "keys:1"} {
+			if v := do(client, "SET", key, "value"); v.String() != "OK" {
+				t.Errorf("expected SET %s response \"OK\", got %q", key, v.String())
+			}
+		}
+		wantErr := "quota exceeded: user keys_user is limited to 2 keys"
+		if v := do(client, "SET", "keys:3", "value"); v.Error() == nil || !strings.Contains(v.Error().Error(), wantErr) {
+			t.Errorf("expected error %q, got %q", wantErr, v.String())
+		}
+		// Keys outside of the user's key patterns don't count.
+		if v := do(admin, "SET", "other:1", "value"); v.String() != "OK" {
+			t.Errorf("expected SET other:1 response \"OK\", got %q", v.String())
+		}
+		if got := usage("keys_user"); !slices.Contains(got, "keys=2") {
+			t.Errorf("expected the usage to report 2 keys, got %v", got)
+		}
+		if v := do(client, "DEL", "keys:1"); v.Integer() != 1 {
+			t.Errorf("expected DEL response 1, got %q", v.String())
+		}
+		if v := do(client, "SET", "keys:3", "value"); v.String() != "OK" {
+			t.Errorf("expected SET keys:3 response \"OK\" after a key was deleted, got %q", v.String())
+		}
+
+		// Writing an existing key replaces its memory instead of adding to it.
+		memory := func(username string) string {
+			got := usage(username)
+			if idx := slices.IndexFunc(got, func(rule string) bool {
+				return strings.HasPrefix(rule, "memory=")
+			}); idx != -1 {
+				return got[idx]
+			}
+			t.Fatalf("expected the usage to report the memory, got %v", got)
+			return ""
+		}
+		before := memory("keys_user")
+		if v := do(client, "SET", "keys:3", "value"); v.String() != "OK" {
+			t.Errorf("expected SET keys:3 response \"OK\", got %q", v.String())
+		}
+		if got := memory("keys_user"); got != before {
+			t.Errorf("expected the memory to stay %s after the key was written again, got %s", before, got)
+		}
+		// The usage is counted again when the quotas change or the keys are flushed.
+		if v := do(admin, "ACL", "SETUSER", "keys_user", "maxkeys=3"); v.String() != "OK" {
+			t.Fatalf("expected ACL SETUSER response \"OK\", got %q", v.String())
+		}
+		if got := usage("keys_user"); !slices.Contains(got, "keys=2") || !slices.Contains(got, before) {
+			t.Errorf("expected the usage to report 2 keys and %s, got %v", before, got)
+		}
+		if v := do(admin, "FLUSHALL"); v.String() != "OK" {
+			t.Fatalf("expected FLUSHALL response \"OK\", got %q", v.String())
+		}
+		if got := usage("keys_user"); !slices.Contains(got, "keys=0") || !slices.Contains(got, "memory=0") {
+			t.Errorf("expected the usage to report no keys after FLUSHALL, got %v", got)
+		}
+		for _, key := range []string{"keys:1", "keys:2", "keys:3"} {
+			if v := do(client, "SET", key, "value"); v.String() != "OK" {
+				t.Errorf("expected SET %s response \"OK\" after FLUSHALL, got %q", key, v.String())
+			}
+		}
+		if got := usage("keys_user"); !slices.Contains(got, "keys=3") {
+			t.Errorf("expected the usage to report 3 keys, got %v", got)
+		}
+
+		if v := do(admin, "ACL", "SETUSER", "memory_user", "on", "nopass", "~memory:*", "maxmemory=1"); v.String() != "OK" {
+			t.Fatalf("expected ACL SETUSER response \"OK\", got %q", v.String())
+		}
+		client, _, _ = newClient("memory_user", "")
+		if v := do(client, "SET", "memory:1", "value"); v.String() != "OK" {
+			t.Errorf("expected SET memory:1 response \"OK\", got %q", v.String())
+		}
+		wantErr = "quota exceeded: user memory_user is limited to 1 bytes of memory"
+		if v := do(client, "SET", "memory:2", "value"); v.Error() == nil || !strings.Contains(v.Error().Error(), wantErr) {
+			t.Errorf("expected error %q, got %q", wantErr, v.String())
+		}
+		if v := do(client, "DEL", "memory:1"); v.Integer() != 1 {
+			t.Errorf("expected DEL response 1, got %q", v.String())
+		}
+	})
+
+	t.Run("Test_QuotaRejectionsInfo", func(t *testing.T) {
+		// The rejections of the rate limits, max connections, keys and memory quotas of the previous tests.
+		info, err := mockServer.Info("clients")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := info["clients"]["quota_rejections"]; got != "5" {
+			t.Errorf("expected INFO to report 5 quota rejections, got %q", got)
+		}
+	})
+}
@@ -0,0 +1,357 @@
+// Copyright 2024 Kelvin Clement Mwinuka
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package acl
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/echovault/sugardb/internal/clock"
+	"github.com/echovault/sugardb/internal/config"
+)
+
+const (
+	JWTAlgorithmHS256 = "HS256"
+	JWTAlgorithmRS256 = "RS256"
+	JWTAlgorithmEdDSA = "EdDSA"
+)
+
+const (
+	JWTExpiryReauth     = "reauth"
+	JWTExpiryDisconnect = "disconnect"
+)
+
+// minJWTSecretSize is the minimum size of an HS256 secret. RFC 7518 requires a key at least as long as the hash.
+const minJWTSecretSize = sha256.Size
+
+type jwtKey struct {
+	id        string
+	algorithm string
+	key       any // []byte for HS256, *rsa.PublicKey for RS256 and ed25519.PublicKey for EdDSA.
+}
+
+// JWTAuthenticator authenticates connections with JSON Web Tokens signed with HS256, RS256 or EdDSA.
+type JWTAuthenticator struct {
+	keys             []jwtKey
+	usernameClaim    string
+	permissionsClaim string
+	issuer           string
+	audience         string
+	clock            clock.Clock
+}
+
+// NewJWTAuthenticator creates a JWT authenticator with the keys in the key files and the JWKS file of the config.
+// It returns nil when no keys are configured.
+func NewJWTAuthenticator(conf config.Config) (*JWTAuthenticator, error) {
+	var keys []jwtKey
+
+	for _, keyFile := range conf.AclJWTKeyFiles {
+		key, err := loadJWTKeyFile(keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load jwt key %s: %v", keyFile, err)
+		}
+		keys = append(keys, key)
+	}
+
+	if conf.AclJWKSFile != "" {
+		jwks, err := loadJWKSFile(conf.AclJWKSFile)
+		if err != nil {
+			return nil, fmt.Errorf("load jwks %s: %v", conf.AclJWKSFile, err)
+		}
+		keys = append(keys, jwks...)
+	}
+
+	if len(keys) == 0 {
+		return nil, nil
+	}
+
+	usernameClaim := conf.AclJWTUsernameClaim
+	if usernameClaim == "" {
+		usernameClaim = "sub"
+	}
+
+	return &JWTAuthenticator{
+		keys:             keys,
+		usernameClaim:    usernameClaim,
+		permissionsClaim: conf.AclJWTPermissionsClaim,
+		issuer:           conf.AclJWTIssuer,
+		audience:         conf.AclJWTAudience,
+		clock:            clock.NewClock(),
+	}, nil
+}
+
+func (authenticator *JWTAuthenticator) Name() string {
+	return "jwt"
+}
+
+func (authenticator *JWTAuthenticator) Authenticate(_ context.Context, username string, credential string) (Identity, error) {
+	parts := strings.Split(credential, ".")
+	if len(parts) != 3 {
+		return Identity{}, ErrUnsupportedCredential
+	}
+
+	var header struct {
+		Algorithm string `json:"alg"`
+		KeyID     string `json:"kid"`
+	}
+	if err := decodeJWTSegment(parts[0], &header); err != nil {
+		return Identity{}, ErrUnsupportedCredential
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return Identity{}, errors.New("invalid token signature")
+	}
+	if !authenticator.verifySignature(header.Algorithm, header.KeyID, []byte(parts[0]+"."+parts[1]), signature) {
+		return Identity{}, errors.New("invalid token signature")
+	}
+
+	claims := make(map[string]any)
+	if err = decodeJWTSegment(parts[1], &claims); err != nil {
+		return Identity{}, errors.New("invalid token claims")
+	}
+
+	now := authenticator.clock.Now()
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return Identity{}, errors.New("token has no expiry")
+	}
+	expiresAt := time.Unix(int64(exp), 0)
+	if !now.Before(expiresAt) {
+		return Identity{}, errors.New("token is expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Before(time.Unix(int64(nbf), 0)) {
+		return Identity{}, errors.New("token is not valid yet")
+	}
+	if authenticator.issuer != "" && claims["iss"] != authenticator.issuer {
+		return Identity{}, errors.New("token issuer is not allowed")
+	}
+	if authenticator.audience != "" && !slices.Contains(stringClaim(claims["aud"]), authenticator.audience) {
+		return Identity{}, errors.New("token audience is not allowed")
+	}
+
+	claimedUsername, _ := claims[authenticator.usernameClaim].(string)
+	if claimedUsername == "" {
+		return Identity{}, fmt.Errorf("token has no %s claim", authenticator.usernameClaim)
+	}
+	if username != "" && username != claimedUsername {
+		return Identity{}, fmt.Errorf("token is not issued to user %s", username)
+	}
+
+	identity := Identity{Username: claimedUsername, ExpiresAt: expiresAt}
+	if authenticator.permissionsClaim != "" {
+		if permissions, ok := claims[authenticator.permissionsClaim]; ok {
+			// A string claim holds space separated rules.
+			if rules, ok := permissions.(string); ok {
+				identity.Rules = strings.Fields(rules)
+			} else {
+				identity.Rules = stringClaim(permissions)
+			}
+			if identity.Rules == nil {
+				identity.Rules = []string{}
+			}
+		}
+	}
+	return identity, nil
+}
+
+// verifySignature verifies the signature with the keys of the algorithm. When the token has a key id,
+// only the key with that id is used.
+func (authenticator *JWTAuthenticator) verifySignature(algorithm string, keyID string, signed []byte, signature []byte) bool {
+	for _, key := range authenticator.keys {
+		if key.algorithm != algorithm || (keyID != "" && key.id != keyID) {
+			continue
+		}
+		switch algorithm {
+		case JWTAlgorithmHS256:
+			mac := hmac.New(sha256.New, key.key.([]byte))
+			mac.Write(signed)
+			if hmac.Equal(mac.Sum(nil), signature) {
+				return true
+			}
+		case JWTAlgorithmRS256:
+			digest := sha256.Sum256(signed)
+			if rsa.VerifyPKCS1v15(key.key.(*rsa.PublicKey), crypto.SHA256, digest[:], signature) == nil {
+				return true
+			}
+		case JWTAlgorithmEdDSA:
+			if ed25519.Verify(key.key.(ed25519.PublicKey), signed, signature) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func decodeJWTSegment(segment string, v any) error {
+	b, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// stringClaim returns the values of a claim that is either a string or a list of strings.
+func stringClaim(claim any) []string {
+	switch value := claim.(type) {
+	case string:
+		return []string{value}
+	case []any:
+		var values []string
+		for _, v := range value {
+			if s, ok := v.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+// loadJWTKeyFile loads a PEM encoded RSA or Ed25519 public key, or an HS256 secret.
+// The key id is the file name without its extension.
+func loadJWTKeyFile(keyFile string) (jwtKey, error) {
+	b, err := os.ReadFile(keyFile)
+	if err != nil {
+		return jwtKey{}, err
+	}
+	id := strings.TrimSuffix(path.Base(keyFile), path.Ext(keyFile))
+
+	block, _ := pem.Decode(b)
+	if block == nil {
+		secret := bytes.TrimSpace(b)
+		if err = checkJWTSecret(secret); err != nil {
+			return jwtKey{}, err
+		}
+		return jwtKey{id: id, algorithm: JWTAlgorithmHS256, key: secret}, nil
+	}
+
+	var publicKey any
+	switch block.Type {
+	case "RSA PUBLIC KEY":
+		publicKey, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	case "PUBLIC KEY":
+		publicKey, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		err = fmt.Errorf("unsupported PEM block %s", block.Type)
+	}
+	if err != nil {
+		return jwtKey{}, err
+	}
+
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		return jwtKey{id: id, algorithm: JWTAlgorithmRS256, key: key}, nil
+	case ed25519.PublicKey:
+		return jwtKey{id: id, algorithm: JWTAlgorithmEdDSA, key: key}, nil
+	}
+	return jwtKey{}, fmt.Errorf("unsupported public key type %T", publicKey)
+}
+
+// loadJWKSFile loads the RSA, Ed25519 and symmetric keys of a JSON Web Key Set.
+// Keys with other types or with a use other than "sig" are skipped.
+func loadJWKSFile(jwksFile string) ([]jwtKey, error) {
+	b, err := os.ReadFile(jwksFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var jwks struct {
+		Keys []struct {
+			KeyType string `json:"kty"`
+			KeyID   string `json:"kid"`
+			Use     string `json:"use"`
+			Curve   string `json:"crv"`
+			N       string `json:"n"`
+			E       string `json:"e"`
+			X       string `json:"x"`
+			K       string `json:"k"`
+		} `json:"keys"`
+	}
+	if err = json.Unmarshal(b, &jwks); err != nil {
+		return nil, err
+	}
+
+	var keys []jwtKey
+	for _, k := range jwks.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		switch {
+		case k.KeyType == "RSA":
+			n, err := base64.RawURLEncoding.DecodeString(k.N)
+			if err != nil {
+				return nil, fmt.Errorf("key %s: %v", k.KeyID, err)
+			}
+			e, err := base64.RawURLEncoding.DecodeString(k.E)
+			if err != nil {
+				return nil, fmt.Errorf("key %s: %v", k.KeyID, err)
+			}
+			exponent := new(big.Int).SetBytes(e)
+			if len(n) == 0 || exponent.Sign() <= 0 || !exponent.IsInt64() || exponent.Int64() > math.MaxInt {
+				return nil, fmt.Errorf("key %s: invalid RSA public key", k.KeyID)
+			}
+			keys = append(keys, jwtKey{id: k.KeyID, algorithm: JWTAlgorithmRS256, key: &rsa.PublicKey{
+				N: new(big.Int).SetBytes(n),
+				E: int(exponent.Int64()),
+			}})
+		case k.KeyType == "OKP" && k.Curve == "Ed25519":
+			x, err := base64.RawURLEncoding.DecodeString(k.X)
+			if err != nil || len(x) != ed25519.PublicKeySize {
+				return nil, fmt.Errorf("key %s: invalid Ed25519 public key", k.KeyID)
+			}
+			keys = append(keys, jwtKey{id: k.KeyID, algorithm: JWTAlgorithmEdDSA, key: ed25519.PublicKey(x)})
+		case k.KeyType == "oct":
+			secret, err := base64.RawURLEncoding.DecodeString(k.K)
+			if err != nil {
+				return nil, fmt.Errorf("key %s: %v", k.KeyID, err)
+			}
+			if err = checkJWTSecret(secret); err != nil {
+				return nil, fmt.Errorf("key %s: %v", k.KeyID, err)
+			}
+			keys = append(keys, jwtKey{id: k.KeyID, algorithm: JWTAlgorithmHS256, key: secret})
+		}
+	}
+	return keys, nil
+}
+
+// checkJWTSecret returns an error when the HS256 secret is empty or too short to be secure.
+func checkJWTSecret(secret []byte) error {
+	if len(secret) == 0 {
+		return errors.New("empty secret")
+	}
+	if len(secret) < minJWTSecretSize {
+		return fmt.Errorf("secret is shorter than %d bytes", minJWTSecretSize)
+	}
+	return nil
+}
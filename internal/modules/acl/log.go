@@ -0,0 +1,125 @@
+// Copyright 2024 Kelvin Clement Mwinuka
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package acl
+
+import (
+	"fmt"
+	"net"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/echovault/sugardb/internal"
+	"github.com/echovault/sugardb/internal/clock"
+)
+
+const (
+	LogReasonAuth    = "auth"
+	LogReasonCommand = "command"
+	LogReasonKey     = "key"
+	LogReasonChannel = "channel"
+	LogReasonQuota   = "quota"
+)
+
+const (
+	// logGroupingWindow is the time within which a repeated denial is coalesced into the previous entry.
+	logGroupingWindow = time.Minute
+	// logGroupingDepth is the number of most recent entries searched for a denial to coalesce with.
+	logGroupingDepth = 10
+)
+
+// denialLog is a bounded log of denied authentications and commands, with the most recent entry first.
+type denialLog struct {
+	mut     sync.Mutex
+	clock   clock.Clock
+	maxLen  int
+	nextID  uint64
+	entries []internal.ACLLogEntry
+}
+
+func newDenialLog(maxLen uint) *denialLog {
+	return &denialLog{
+		clock:   clock.NewClock(),
+		maxLen:  int(maxLen),
+		entries: make([]internal.ACLLogEntry, 0),
+	}
+}
+
+// add records a denial. When a recent entry has the same reason, object and username,
+// its count is incremented and it moves to the front of the log instead.
+func (l *denialLog) add(reason string, object string, username string, clientInfo string) {
+	l.mut.Lock()
+	defer l.mut.Unlock()
+
+	if l.maxLen <= 0 {
+		return
+	}
+
+	now := l.clock.Now()
+
+	for i := 0; i < len(l.entries) && i < logGroupingDepth; i++ {
+		entry := l.entries[i]
+		if entry.Reason != reason || entry.Object != object || entry.Username != username ||
+			now.Sub(entry.LastUpdated) > logGroupingWindow {
+			continue
+		}
+		entry.Count += 1
+		entry.ClientInfo = clientInfo
+		entry.LastUpdated = now
+		l.entries = slices.Delete(l.entries, i, i+1)
+		l.entries = slices.Insert(l.entries, 0, entry)
+		return
+	}
+
+	l.entries = slices.Insert(l.entries, 0, internal.ACLLogEntry{
+		EntryID:     l.nextID,
+		Count:       1,
+		Reason:      reason,
+		Context:     "toplevel",
+		Object:      object,
+		Username:    username,
+		ClientInfo:  clientInfo,
+		Created:     now,
+		LastUpdated: now,
+	})
+	l.nextID += 1
+	if len(l.entries) > l.maxLen {
+		l.entries = l.entries[:l.maxLen]
+	}
+}
+
+// list returns up to count of the most recent entries. All the entries are returned when count is negative.
+func (l *denialLog) list(count int) []internal.ACLLogEntry {
+	l.mut.Lock()
+	defer l.mut.Unlock()
+	if count < 0 || count > len(l.entries) {
+		count = len(l.entries)
+	}
+	return slices.Clone(l.entries[:count])
+}
+
+func (l *denialLog) reset() {
+	l.mut.Lock()
+	defer l.mut.Unlock()
+	l.entries = make([]internal.ACLLogEntry, 0)
+}
+
+// clientInfo describes the client on the connection for the ACL log.
+func clientInfo(conn *net.Conn) string {
+	if conn == nil || *conn == nil {
+		return ""
+	}
+	return fmt.Sprintf("addr=%s laddr=%s", (*conn).RemoteAddr(), (*conn).LocalAddr())
+}
@@ -0,0 +1,213 @@
+// Copyright 2024 Kelvin Clement Mwinuka
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package acl
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/echovault/sugardb/internal/config"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	argon2KeyLength  = 32
+	argon2SaltLength = 16
+	// argon2MaxMemory is the largest memory parameter, in KiB, of the argon2id hashes that are accepted.
+	// It keeps a hash from exhausting the memory of the server when a password is verified.
+	argon2MaxMemory = 1024 * 1024
+)
+
+// passwordHasher hashes plain text passwords with the algorithm configured with --acl-password-hash.
+type passwordHasher struct {
+	algorithm     string // "bcrypt", "argon2id", or empty to store passwords as they're provided.
+	bcryptCost    int
+	argon2Time    uint32
+	argon2Memory  uint32
+	argon2Threads uint8
+}
+
+func newPasswordHasher(conf config.Config) passwordHasher {
+	hasher := passwordHasher{
+		algorithm:     conf.AclPasswordHash,
+		bcryptCost:    conf.AclBcryptCost,
+		argon2Time:    conf.AclArgon2Time,
+		argon2Memory:  conf.AclArgon2Memory,
+		argon2Threads: conf.AclArgon2Threads,
+	}
+	if hasher.bcryptCost < bcrypt.MinCost {
+		hasher.bcryptCost = bcrypt.DefaultCost
+	}
+	if hasher.argon2Time == 0 {
+		hasher.argon2Time = 1
+	}
+	if hasher.argon2Memory == 0 {
+		hasher.argon2Memory = 64 * 1024
+	}
+	if hasher.argon2Memory > argon2MaxMemory {
+		hasher.argon2Memory = argon2MaxMemory
+	}
+	if hasher.argon2Threads == 0 {
+		hasher.argon2Threads = 4
+	}
+	return hasher
+}
+
+// hash returns the password hashed with the configured algorithm.
+// The password is returned as is when no algorithm is configured or when it's already hashed.
+func (hasher passwordHasher) hash(password Password) (Password, error) {
+	if password.PasswordType != PasswordPlainText {
+		return password, nil
+	}
+	switch hasher.algorithm {
+	case PasswordBcrypt:
+		b, err := bcrypt.GenerateFromPassword([]byte(password.PasswordValue), hasher.bcryptCost)
+		if err != nil {
+			return Password{}, err
+		}
+		return Password{PasswordType: PasswordBcrypt, PasswordValue: string(b)}, nil
+	case PasswordArgon2id:
+		salt := make([]byte, argon2SaltLength)
+		if _, err := rand.Read(salt); err != nil {
+			return Password{}, err
+		}
+		key := argon2.IDKey([]byte(password.PasswordValue), salt,
+			hasher.argon2Time, hasher.argon2Memory, hasher.argon2Threads, argon2KeyLength)
+		return Password{
+			PasswordType: PasswordArgon2id,
+			PasswordValue: fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+				argon2.Version, hasher.argon2Memory, hasher.argon2Time, hasher.argon2Threads,
+				base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)),
+		}, nil
+	}
+	return password, nil
+}
+
+// needsRehash returns true when the password is not hashed with the configured algorithm and parameters.
+func (hasher passwordHasher) needsRehash(password Password) bool {
+	switch hasher.algorithm {
+	case PasswordBcrypt:
+		if password.PasswordType != PasswordBcrypt {
+			return true
+		}
+		cost, err := bcrypt.Cost([]byte(password.PasswordValue))
+		return err != nil || cost != hasher.bcryptCost
+	case PasswordArgon2id:
+		if password.PasswordType != PasswordArgon2id {
+			return true
+		}
+		params, _, _, err := parseArgon2id(password.PasswordValue)
+		return err != nil || params != [3]uint32{hasher.argon2Memory, hasher.argon2Time, uint32(hasher.argon2Threads)}
+	}
+	return false
+}
+
+// verify returns true when the plain text password matches the password. Hashes are compared in constant time.
+func (password Password) verify(plaintext string) bool {
+	switch password.PasswordType {
+	case PasswordPlainText:
+		return subtle.ConstantTimeCompare([]byte(password.PasswordValue), []byte(plaintext)) == 1
+	case PasswordSHA256:
+		h := sha256.Sum256([]byte(plaintext))
+		return subtle.ConstantTimeCompare(
+			[]byte(strings.ToLower(password.PasswordValue)),
+			[]byte(hex.EncodeToString(h[:])),
+		) == 1
+	case PasswordBcrypt:
+		return bcrypt.CompareHashAndPassword([]byte(password.PasswordValue), []byte(plaintext)) == nil
+	case PasswordArgon2id:
+		params, salt, key, err := parseArgon2id(password.PasswordValue)
+		if err != nil {
+			return false
+		}
+		return subtle.ConstantTimeCompare(
+			key,
+			argon2.IDKey([]byte(plaintext), salt, params[1], params[0], uint8(params[2]), uint32(len(key))),
+		) == 1
+	}
+	return false
+}
+
+// validate returns an error when the password is a hash that can't be verified.
+func (password Password) validate() error {
+	if password.PasswordType == PasswordArgon2id {
+		if _, _, _, err := parseArgon2id(password.PasswordValue); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseArgon2id parses an argon2id hash in the format "$argon2id$v=19$m=<memory>,t=<time>,p=<threads>$<salt>$<key>".
+// It returns the memory, time and threads parameters, the salt and the key.
+// The parameters must be within the limits that argon2 can compute without panicking or exhausting the memory.
+func parseArgon2id(hash string) ([3]uint32, []byte, []byte, error) {
+	var params [3]uint32
+	var version int
+
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != PasswordArgon2id {
+		return params, nil, nil, fmt.Errorf("invalid argon2id hash")
+	}
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, fmt.Errorf("unsupported argon2id version %s", parts[2])
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params[0], &params[1], &params[2]); err != nil {
+		return params, nil, nil, fmt.Errorf("invalid argon2id parameters %s", parts[3])
+	}
+	if params[1] < 1 || params[2] < 1 || params[2] > 255 || params[0] > argon2MaxMemory {
+		return params, nil, nil, fmt.Errorf("argon2id parameters %s out of range: t must be at least 1, "+
+			"p must be between 1 and 255 and m must be at most %d", parts[3], argon2MaxMemory)
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, err
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return params, nil, nil, err
+	}
+	if len(key) == 0 {
+		return params, nil, nil, fmt.Errorf("invalid argon2id hash: empty key")
+	}
+	return params, salt, key, nil
+}
+
+// getHashType detects the type of the password hash from its format.
+func getHashType(hash string) string {
+	switch {
+	case strings.HasPrefix(hash, "$2a$"), strings.HasPrefix(hash, "$2b$"), strings.HasPrefix(hash, "$2y$"):
+		return PasswordBcrypt
+	case strings.HasPrefix(hash, "$argon2id$"):
+		return PasswordArgon2id
+	default:
+		return PasswordSHA256
+	}
+}
+
+// generatePassword returns a random password of the number of bits, encoded as a hex string.
+func generatePassword(bits int) (string, error) {
+	b := make([]byte, (bits+7)/8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b)[:(bits+3)/4], nil
+}
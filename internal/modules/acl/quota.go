@@ -0,0 +1,533 @@
+// Copyright 2024 Kelvin Clement Mwinuka
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package acl
+
+import (
+	"context"
+	"fmt"
+	"github.com/echovault/sugardb/internal"
+	"github.com/gobwas/glob"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	QuotaCommandsPerSecond = "commands-per-sec"
+	QuotaBytesInPerSecond  = "bytes-in-per-sec"
+	QuotaBytesOutPerSecond = "bytes-out-per-sec"
+	QuotaMaxConnections    = "maxconns"
+	QuotaMaxKeys           = "maxkeys"
+	QuotaMaxMemory         = "maxmemory"
+)
+
+// Quotas limit the rate of the commands and traffic of a user, and the resources the user holds.
+// A quota of 0 is unlimited.
+type Quotas struct {
+	CommandsPerSecond uint64 `json:"CommandsPerSecond" yaml:"CommandsPerSecond"`
+	BytesInPerSecond  uint64 `json:"BytesInPerSecond" yaml:"BytesInPerSecond"`
+	BytesOutPerSecond uint64 `json:"BytesOutPerSecond" yaml:"BytesOutPerSecond"`
+	MaxConnections    uint64 `json:"MaxConnections" yaml:"MaxConnections"`
+	// The number of keys, and the memory used by the keys, that match the user's write key patterns.
+	MaxKeys   uint64 `json:"MaxKeys" yaml:"MaxKeys"`
+	MaxMemory uint64 `json:"MaxMemory" yaml:"MaxMemory"`
+}
+
+// removalCommands only remove keys or the members of keys, so they are not limited by the keys and memory quotas.
+var removalCommands = []string{
+	"del", "getdel", "hdel", "lpop", "rpop", "lrem", "ltrim", "spop", "srem",
+	"zmpop", "zpopmax", "zpopmin", "zrem", "zremrangebylex", "zremrangebyrank", "zremrangebyscore",
+}
+
+// set parses the value of a "<quota>=<value>" rule. It returns false when name is not a quota.
+// The bytes and memory quotas accept a unit, e.g. "10mb".
+func (quotas *Quotas) set(name string, value string) (bool, error) {
+	var quota *uint64
+	var bytes bool
+	switch strings.ToLower(name) {
+	case QuotaCommandsPerSecond:
+		quota = &quotas.CommandsPerSecond
+	case QuotaBytesInPerSecond:
+		quota, bytes = &quotas.BytesInPerSecond, true
+	case QuotaBytesOutPerSecond:
+		quota, bytes = &quotas.BytesOutPerSecond, true
+	case QuotaMaxConnections:
+		quota = &quotas.MaxConnections
+	case QuotaMaxKeys:
+		quota = &quotas.MaxKeys
+	case QuotaMaxMemory:
+		quota, bytes = &quotas.MaxMemory, true
+	default:
+		return false, nil
+	}
+
+	n, err := strconv.ParseUint(value, 10, 64)
+	if err != nil && bytes && len(value) > 2 {
+		n, err = internal.ParseMemory(value)
+	}
+	if err != nil {
+		return true, fmt.Errorf("invalid value %s in rule %s=%s", value, name, value)
+	}
+	*quota = n
+	return true, nil
+}
+
+// rules returns the quotas that are set as ACL SETUSER rules.
+func (quotas *Quotas) rules() []string {
+	var rules []string
+	for _, quota := range []struct {
+		name  string
+		value uint64
+	}{
+		{name: QuotaCommandsPerSecond, value: quotas.CommandsPerSecond},
+		{name: QuotaBytesInPerSecond, value: quotas.BytesInPerSecond},
+		{name: QuotaBytesOutPerSecond, value: quotas.BytesOutPerSecond},
+		{name: QuotaMaxConnections, value: quotas.MaxConnections},
+		{name: QuotaMaxKeys, value: quotas.MaxKeys},
+		{name: QuotaMaxMemory, value: quotas.MaxMemory},
+	} {
+		if quota.value > 0 {
+			rules = append(rules, fmt.Sprintf("%s=%d", quota.name, quota.value))
+		}
+	}
+	return rules
+}
+
+// quotaUsage is the usage of a user's rate limits in the current second.
+type quotaUsage struct {
+	window   time.Time
+	commands uint64
+	bytesIn  uint64
+	bytesOut uint64
+	rejected uint64 // The number of commands and connections rejected by the quotas.
+}
+
+// roll starts a new window when the current second has passed.
+func (usage *quotaUsage) roll(now time.Time) {
+	if window := now.Truncate(time.Second); !window.Equal(usage.window) {
+		usage.window = window
+		usage.commands = 0
+		usage.bytesIn = 0
+		usage.bytesOut = 0
+	}
+}
+
+// keyQuotas tracks the usage of the keys and memory quotas. The server reports every key it writes or deletes,
+// so the usage is kept up to date without scanning the keyspace. The keyspace is only counted again when the
+// usage is stale, i.e. after the users change or a database is flushed.
+type keyQuotas struct {
+	mutex  sync.Mutex
+	stale  bool
+	users  map[*User]*keyUsage      // The usage of the users with a keys or memory quota
+	globs  map[string]glob.Glob     // The compiled write key patterns of the users
+	memory map[int]map[string]int64 // The memory of the counted keys of each database
+}
+
+// keyUsage is the number of keys a user can write, and the memory they use.
+type keyUsage struct {
+	patterns []keyPatterns
+	keys     int
+	memory   int64
+}
+
+// keyPatterns are the write key patterns of one of the selectors of a user.
+type keyPatterns struct {
+	included []string
+	excluded []string
+}
+
+// writes returns true when one of the patterns allows writing the key. The mutex must be held.
+func (quotas *keyQuotas) writes(usage *keyUsage, key string) bool {
+	match := func(g string) bool {
+		return quotas.globs[g].Match(key)
+	}
+	return slices.ContainsFunc(usage.patterns, func(patterns keyPatterns) bool {
+		return slices.ContainsFunc(patterns.included, match) && !slices.ContainsFunc(patterns.excluded, match)
+	})
+}
+
+// count updates the usage of the users that can write the key. memory is -1 when the key is deleted.
+// The mutex must be held.
+func (quotas *keyQuotas) count(database int, key string, memory int64) {
+	previous, counted := quotas.memory[database][key]
+	tracked := false
+	for _, usage := range quotas.users {
+		if !quotas.writes(usage, key) {
+			continue
+		}
+		tracked = true
+		if counted {
+			usage.keys--
+			usage.memory -= previous
+		}
+		if memory >= 0 {
+			usage.keys++
+			usage.memory += memory
+		}
+	}
+	if !tracked || memory < 0 {
+		delete(quotas.memory[database], key)
+		return
+	}
+	if quotas.memory[database] == nil {
+		quotas.memory[database] = make(map[string]int64)
+	}
+	quotas.memory[database][key] = memory
+}
+
+// WithKeyspace option sets the function that calls yield with the database, the name and the memory usage of
+// every key, and the lock that keeps the keys from changing while it runs. It's used to count the usage of the
+// keys and memory quotas, which is then kept up to date with KeyChanged.
+func WithKeyspace(lock sync.Locker, f func(yield func(database int, key string, memory int64))) func(acl *ACL) {
+	return func(acl *ACL) {
+		acl.keyspaceLock = lock
+		acl.keyspace = f
+	}
+}
+
+// KeyChanged updates the usage of the keys and memory quotas when the server writes or deletes a key.
+// memory is the memory used by the key, or -1 when the key is deleted. The server must hold the lock passed to
+// WithKeyspace, so that the change is not counted twice by a concurrent count of the keyspace.
+func (acl *ACL) KeyChanged(database int, key string, memory int64) {
+	acl.keyQuotas.mutex.Lock()
+	defer acl.keyQuotas.mutex.Unlock()
+	if acl.keyQuotas.stale || len(acl.keyQuotas.users) == 0 {
+		return
+	}
+	acl.keyQuotas.count(database, key, memory)
+}
+
+// KeyspaceChanged marks the usage of the keys and memory quotas as stale, e.g. after a database is flushed.
+// The keyspace is counted again the next time the usage is needed.
+func (acl *ACL) KeyspaceChanged() {
+	acl.keyQuotas.mutex.Lock()
+	defer acl.keyQuotas.mutex.Unlock()
+	acl.keyQuotas.stale = true
+}
+
+// getUsage returns the usage of the user's rate limits in the current second. The usage mutex must be held.
+func (acl *ACL) getUsage(username string) *quotaUsage {
+	usage, ok := acl.usage[username]
+	if !ok {
+		usage = &quotaUsage{}
+		acl.usage[username] = usage
+	}
+	usage.roll(acl.clock.Now())
+	return usage
+}
+
+// CheckQuotas checks the command against the quotas of the user the connection is associated with.
+// bytesIn is the size of the command, which counts towards the user's bytes in whether the command is allowed or not.
+// The keys and memory quotas are only checked for commands that write keys.
+func (acl *ACL) CheckQuotas(
+	ctx context.Context,
+	conn *net.Conn,
+	bytesIn int,
+	cmd []string,
+	command internal.Command,
+	subCommand internal.SubCommand,
+) error {
+	acl.RLockUsers()
+	defer acl.RUnlockUsers()
+
+	connection, ok := acl.Connections[conn]
+	if !ok || connection.User == nil {
+		return nil
+	}
+	return acl.checkUserQuotas(ctx, connection.User, true, clientInfo(conn), bytesIn, cmd, command, subCommand)
+}
+
+// CheckForwardedQuotas checks a command that a follower forwarded on behalf of a user against the user's quotas
+// on the leader. The user is looked up like in AuthorizeUser. The keys and memory quotas of a user created from
+// the rules of an identity are left to the follower, which counts the keys of the identity's connections.
+func (acl *ACL) CheckForwardedQuotas(
+	ctx context.Context,
+	username string,
+	rules []string,
+	cmd []string,
+	command internal.Command,
+	subCommand internal.SubCommand,
+) error {
+	defer acl.lockForwardedUser(rules)()
+
+	user, err := acl.forwardedUser(username, rules)
+	if err != nil {
+		return err
+	}
+	return acl.checkUserQuotas(ctx, user, rules == nil, "forwarded", len(internal.EncodeCommand(cmd)), cmd, command, subCommand)
+}
+
+// checkUserQuotas checks the command against the quotas of the user. The keys and memory quotas are only checked
+// when countKeys is true. The client describes where the command came from in the ACL log.
+// The users lock must be held.
+func (acl *ACL) checkUserQuotas(
+	ctx context.Context,
+	user *User,
+	countKeys bool,
+	client string,
+	bytesIn int,
+	cmd []string,
+	command internal.Command,
+	subCommand internal.SubCommand,
+) error {
+	quotas := user.Quotas
+
+	comm, _, keys, err := getCommandDetails(cmd, command, subCommand)
+	if err != nil {
+		return err
+	}
+
+	// 1. Check the rate limits.
+	acl.usageMutex.Lock()
+	usage := acl.getUsage(user.Username)
+	usage.bytesIn += uint64(bytesIn)
+	switch {
+	case quotas.CommandsPerSecond > 0 && usage.commands >= quotas.CommandsPerSecond:
+		err = fmt.Errorf("rate limit exceeded: user %s is limited to %d commands per second",
+			user.Username, quotas.CommandsPerSecond)
+	case quotas.BytesInPerSecond > 0 && usage.bytesIn > quotas.BytesInPerSecond:
+		err = fmt.Errorf("rate limit exceeded: user %s is limited to %d bytes in per second",
+			user.Username, quotas.BytesInPerSecond)
+	case quotas.BytesOutPerSecond > 0 && usage.bytesOut >= quotas.BytesOutPerSecond:
+		err = fmt.Errorf("rate limit exceeded: user %s is limited to %d bytes out per second",
+			user.Username, quotas.BytesOutPerSecond)
+	}
+	acl.usageMutex.Unlock()
+
+	// 2. Check the keys and memory quotas.
+	if err == nil && countKeys && (quotas.MaxKeys > 0 || quotas.MaxMemory > 0) && len(keys.WriteKeys) > 0 &&
+		internal.IsWriteCommand(command, subCommand) && !slices.Contains(removalCommands, strings.ToLower(internal.OriginalCommand(command))) {
+		database := getCommandDatabase(ctx, command, cmd)
+		count, memory, existing := acl.keyUsage(user, database, keys.WriteKeys)
+		newKeys := 0
+		for _, key := range keys.WriteKeys {
+			if !existing[key] && acl.userWritesKey(user, key) {
+				existing[key] = true
+				newKeys++
+			}
+		}
+		switch {
+		case quotas.MaxKeys > 0 && uint64(count+newKeys) > quotas.MaxKeys:
+			err = fmt.Errorf("quota exceeded: user %s is limited to %d keys", user.Username, quotas.MaxKeys)
+		case quotas.MaxMemory > 0 && uint64(memory) >= quotas.MaxMemory:
+			err = fmt.Errorf("quota exceeded: user %s is limited to %d bytes of memory", user.Username, quotas.MaxMemory)
+		}
+	}
+
+	acl.usageMutex.Lock()
+	defer acl.usageMutex.Unlock()
+	usage = acl.getUsage(user.Username)
+	if err != nil {
+		usage.rejected++
+		acl.rejected++
+		acl.denialLog.add(LogReasonQuota, comm, user.Username, client)
+		return err
+	}
+	usage.commands++
+	return nil
+}
+
+// RecordBytesOut adds the size of a response to the bytes out of the user the connection is associated with.
+func (acl *ACL) RecordBytesOut(conn *net.Conn, bytesOut int) {
+	acl.RLockUsers()
+	defer acl.RUnlockUsers()
+
+	connection, ok := acl.Connections[conn]
+	if !ok || connection.User == nil {
+		return
+	}
+
+	acl.usageMutex.Lock()
+	defer acl.usageMutex.Unlock()
+	acl.getUsage(connection.User.Username).bytesOut += uint64(bytesOut)
+}
+
+// QuotaRejections returns the number of commands and connections of all the users rejected by the quotas.
+func (acl *ACL) QuotaRejections() uint64 {
+	acl.usageMutex.Lock()
+	defer acl.usageMutex.Unlock()
+	return acl.rejected
+}
+
+// checkMaxConnections returns an error when associating the connection with the user would exceed the user's
+// max connections. The users lock must be held.
+func (acl *ACL) checkMaxConnections(conn *net.Conn, user *User) error {
+	if user.Quotas.MaxConnections == 0 {
+		return nil
+	}
+	if uint64(acl.userConnections(user.Username, conn)) < user.Quotas.MaxConnections {
+		return nil
+	}
+	acl.usageMutex.Lock()
+	acl.getUsage(user.Username).rejected++
+	acl.rejected++
+	acl.usageMutex.Unlock()
+	return fmt.Errorf("max connections reached: user %s is limited to %d connections",
+		user.Username, user.Quotas.MaxConnections)
+}
+
+// userConnections returns the number of connections associated with the user, other than the excluded connection.
+func (acl *ACL) userConnections(username string, exclude *net.Conn) int {
+	count := 0
+	for connRef, connection := range acl.Connections {
+		if connRef != exclude && connection.User != nil && connection.User.Username == username {
+			count++
+		}
+	}
+	return count
+}
+
+// trackKeyQuotas copies the write key patterns of the users with a keys or memory quota, and marks their usage
+// as stale. It's called whenever the users change. The users lock must be held.
+func (acl *ACL) trackKeyQuotas() {
+	acl.keyQuotas.mutex.Lock()
+	defer acl.keyQuotas.mutex.Unlock()
+	acl.keyQuotas.users = make(map[*User]*keyUsage)
+	acl.keyQuotas.globs = make(map[string]glob.Glob)
+	for _, user := range acl.Users {
+		acl.trackUser(user)
+	}
+	acl.keyQuotas.stale = true
+}
+
+// trackUser adds the user to the users whose keys and memory are counted, if it has a keys or memory quota.
+// The users lock and the key quotas mutex must be held.
+func (acl *ACL) trackUser(user *User) {
+	if user.Quotas.MaxKeys == 0 && user.Quotas.MaxMemory == 0 {
+		return
+	}
+	usage := &keyUsage{}
+	for _, selector := range append([]Selector{user.Selector}, user.Selectors...) {
+		if selector.NoKeys {
+			continue
+		}
+		usage.patterns = append(usage.patterns, keyPatterns{
+			included: slices.Clone(selector.IncludedWriteKeys),
+			excluded: slices.Clone(selector.ExcludedWriteKeys),
+		})
+		for _, g := range append(slices.Clone(selector.IncludedWriteKeys), selector.ExcludedWriteKeys...) {
+			acl.keyQuotas.globs[g] = acl.GlobPatterns[g]
+		}
+	}
+	acl.keyQuotas.users[user] = usage
+	acl.keyQuotas.stale = true
+}
+
+// untrackUser stops counting the keys and memory of a user that is not in the list of users, e.g. the user of a
+// JWT with rules, once it has no connections left. The users lock must be held.
+func (acl *ACL) untrackUser(user *User) {
+	if user == nil || slices.Contains(acl.Users, user) {
+		return
+	}
+	for _, connection := range acl.Connections {
+		if connection.User == user {
+			return
+		}
+	}
+	acl.keyQuotas.mutex.Lock()
+	defer acl.keyQuotas.mutex.Unlock()
+	delete(acl.keyQuotas.users, user)
+}
+
+// keyUsage returns the number of keys the user can write and the memory they use, and which of the given keys
+// of the database are counted. The keyspace is counted first when the usage is stale.
+// The users lock must be held.
+func (acl *ACL) keyUsage(user *User, database int, keys []string) (int, int64, map[string]bool) {
+	existing := make(map[string]bool)
+	if acl.keyspace == nil {
+		return 0, 0, existing
+	}
+
+	acl.keyQuotas.mutex.Lock()
+	if _, ok := acl.keyQuotas.users[user]; !ok {
+		acl.trackUser(user)
+	}
+	_, tracked := acl.keyQuotas.users[user]
+	stale := acl.keyQuotas.stale
+	acl.keyQuotas.mutex.Unlock()
+	if !tracked {
+		return 0, 0, existing
+	}
+	if stale {
+		acl.countKeys()
+	}
+
+	acl.keyQuotas.mutex.Lock()
+	defer acl.keyQuotas.mutex.Unlock()
+	usage, ok := acl.keyQuotas.users[user]
+	if !ok {
+		return 0, 0, existing
+	}
+	for _, key := range keys {
+		if _, counted := acl.keyQuotas.memory[database][key]; counted && acl.keyQuotas.writes(usage, key) {
+			existing[key] = true
+		}
+	}
+	return usage.keys, usage.memory, existing
+}
+
+// countKeys counts the keys and memory of the tracked users by scanning the keyspace.
+// The keyspace lock is taken first, so that no key changes until the count is done.
+func (acl *ACL) countKeys() {
+	acl.keyspaceLock.Lock()
+	defer acl.keyspaceLock.Unlock()
+	acl.keyQuotas.mutex.Lock()
+	defer acl.keyQuotas.mutex.Unlock()
+	if !acl.keyQuotas.stale {
+		return
+	}
+	for _, usage := range acl.keyQuotas.users {
+		usage.keys, usage.memory = 0, 0
+	}
+	acl.keyQuotas.memory = make(map[int]map[string]int64)
+	acl.keyspace(acl.keyQuotas.count)
+	acl.keyQuotas.stale = false
+}
+
+// userWritesKey returns true when the root permissions or one of the selectors of the user allow writing the key.
+func (acl *ACL) userWritesKey(user *User, key string) bool {
+	for _, selector := range append([]Selector{user.Selector}, user.Selectors...) {
+		if !selector.NoKeys && acl.keyAllowed(key, selector.IncludedWriteKeys, selector.ExcludedWriteKeys) {
+			return true
+		}
+	}
+	return false
+}
+
+// quotaUsageRules returns the current usage of the user's quotas in the format of the quota rules.
+// The keys and memory are only counted for the users with a keys or memory quota. The users lock must be held.
+func (acl *ACL) quotaUsageRules(user *User) []string {
+	var keyRules []string
+	if user.Quotas.MaxKeys > 0 || user.Quotas.MaxMemory > 0 {
+		keys, memory, _ := acl.keyUsage(user, 0, nil)
+		keyRules = []string{fmt.Sprintf("keys=%d", keys), fmt.Sprintf("memory=%d", memory)}
+	}
+
+	acl.usageMutex.Lock()
+	defer acl.usageMutex.Unlock()
+	usage := acl.getUsage(user.Username)
+
+	rules := []string{
+		fmt.Sprintf("%s=%d", QuotaCommandsPerSecond, usage.commands),
+		fmt.Sprintf("%s=%d", QuotaBytesInPerSecond, usage.bytesIn),
+		fmt.Sprintf("%s=%d", QuotaBytesOutPerSecond, usage.bytesOut),
+		fmt.Sprintf("connections=%d", acl.userConnections(user.Username, nil)),
+	}
+	rules = append(rules, keyRules...)
+	return append(rules, fmt.Sprintf("rejected=%d", usage.rejected))
+}
@@ -15,27 +15,29 @@
 package acl
 
 import (
+	"errors"
+	"fmt"
 	"slices"
+	"strconv"
 	"strings"
 )
 
 const (
 	PasswordPlainText = "plaintext"
 	PasswordSHA256    = "SHA256"
+	PasswordBcrypt    = "bcrypt"
+	PasswordArgon2id  = "argon2id"
 )
 
 type Password struct {
-	PasswordType  string `json:"PasswordType" yaml:"PasswordType"` // plaintext, SHA256
+	PasswordType  string `json:"PasswordType" yaml:"PasswordType"` // plaintext, SHA256, bcrypt, argon2id
 	PasswordValue string `json:"PasswordValue" yaml:"PasswordValue"`
 }
 
-type User struct {
-	Username   string `json:"Username" yaml:"Username"`
-	Enabled    bool   `json:"Enabled" yaml:"Enabled"`
-	NoPassword bool   `json:"NoPassword" yaml:"NoPassword"`
-	NoKeys     bool   `json:"NoKeys" yaml:"NoKeys"`
-
-	Passwords []Password `json:"Passwords" yaml:"Passwords"`
+// Selector is a set of permissions. The root permissions of a user are a selector, and a user can have
+// additional selectors. A command is allowed when the root permissions or any of the selectors allow it.
+type Selector struct {
+	NoKeys bool `json:"NoKeys" yaml:"NoKeys"`
 
 	IncludedCategories []string `json:"IncludedCategories" yaml:"IncludedCategories"`
 	ExcludedCategories []string `json:"ExcludedCategories" yaml:"ExcludedCategories"`
@@ -45,46 +47,51 @@ type User struct {
 
 	IncludedReadKeys  []string `json:"IncludedReadKeys" yaml:"IncludedReadKeys"`
 	IncludedWriteKeys []string `json:"IncludedWriteKeys" yaml:"IncludedWriteKeys"`
+	ExcludedReadKeys  []string `json:"ExcludedReadKeys" yaml:"ExcludedReadKeys"`
+	ExcludedWriteKeys []string `json:"ExcludedWriteKeys" yaml:"ExcludedWriteKeys"`
 
 	IncludedPubSubChannels []string `json:"IncludedPubSubChannels" yaml:"IncludedPubSubChannels"`
 	ExcludedPubSubChannels []string `json:"ExcludedPubSubChannels" yaml:"ExcludedPubSubChannels"`
+
+	// The databases that the selector is restricted to. All the databases are allowed when empty.
+	Databases []int `json:"Databases" yaml:"Databases"`
 }
 
-func (user *User) Normalise() {
-	user.IncludedCategories = RemoveDuplicateEntries(user.IncludedCategories, "allCategories")
-	if len(user.IncludedCategories) == 0 {
-		user.IncludedCategories = []string{"*"}
-	}
-	user.ExcludedCategories = RemoveDuplicateEntries(user.ExcludedCategories, "allCategories")
-	if slices.Contains(user.ExcludedCategories, "*") {
-		user.IncludedCategories = []string{}
-	}
+type User struct {
+	Username   string `json:"Username" yaml:"Username"`
+	Enabled    bool   `json:"Enabled" yaml:"Enabled"`
+	NoPassword bool   `json:"NoPassword" yaml:"NoPassword"`
 
-	user.IncludedCommands = RemoveDuplicateEntries(user.IncludedCommands, "allCommands")
-	if len(user.IncludedCommands) == 0 {
-		user.IncludedCommands = []string{"*"}
-	}
-	user.ExcludedCommands = RemoveDuplicateEntries(user.ExcludedCommands, "allCommands")
-	if slices.Contains(user.ExcludedCommands, "*") {
-		user.IncludedCommands = []string{}
-	}
+	Passwords []Password `json:"Passwords" yaml:"Passwords"`
 
-	user.IncludedReadKeys = RemoveDuplicateEntries(user.IncludedReadKeys, "allKeys")
-	if len(user.IncludedReadKeys) == 0 && !user.NoKeys {
-		user.IncludedReadKeys = []string{"*"}
-	}
-	user.IncludedWriteKeys = RemoveDuplicateEntries(user.IncludedWriteKeys, "allKeys")
-	if len(user.IncludedWriteKeys) == 0 && !user.NoKeys {
-		user.IncludedWriteKeys = []string{"*"}
+	Selector  `yaml:",inline"` // The root permissions of the user.
+	Selectors []Selector       `json:"Selectors" yaml:"Selectors"` // Alternative permissions of the user.
+
+	Quotas Quotas `json:"Quotas" yaml:"Quotas"` // Rate limits and resource quotas of the user.
+}
+
+// validatePasswords returns an error when one of the passwords of the user is a hash that can't be verified.
+// It must be called after Normalise, which detects the type of the hashes.
+func (user *User) validatePasswords() error {
+	for _, password := range user.Passwords {
+		if err := password.validate(); err != nil {
+			return fmt.Errorf("user %s: invalid password hash: %w", user.Username, err)
+		}
 	}
+	return nil
+}
 
-	user.IncludedPubSubChannels = RemoveDuplicateEntries(user.IncludedPubSubChannels, "allChannels")
-	if len(user.IncludedPubSubChannels) == 0 {
-		user.IncludedPubSubChannels = []string{"*"}
+func (user *User) Normalise() {
+	user.Selector.normalise(true)
+	for i := range user.Selectors {
+		user.Selectors[i].normalise(false)
 	}
-	user.ExcludedPubSubChannels = RemoveDuplicateEntries(user.ExcludedPubSubChannels, "allChannels")
-	if slices.Contains(user.ExcludedPubSubChannels, "*") {
-		user.IncludedPubSubChannels = []string{}
+
+	// Detect the type of passwords that don't specify one
+	for i, password := range user.Passwords {
+		if password.PasswordType == "" {
+			user.Passwords[i].PasswordType = getHashType(password.PasswordValue)
+		}
 	}
 
 	// Sort passwords
@@ -92,11 +99,59 @@ func (user *User) Normalise() {
 		types := map[string]int{
 			PasswordPlainText: 0,
 			PasswordSHA256:    1,
+			PasswordBcrypt:    2,
+			PasswordArgon2id:  3,
 		}
 		return types[a.PasswordType] - types[b.PasswordType]
 	})
 }
 
+// normalise removes duplicate rules. When defaultAll is true, empty included categories, commands,
+// keys and channels allow all of them, as they do for the root permissions of a user.
+// The rules of additional selectors only allow what they list.
+func (selector *Selector) normalise(defaultAll bool) {
+	selector.IncludedCategories = RemoveDuplicateEntries(selector.IncludedCategories, "allCategories")
+	if len(selector.IncludedCategories) == 0 && defaultAll {
+		selector.IncludedCategories = []string{"*"}
+	}
+	selector.ExcludedCategories = RemoveDuplicateEntries(selector.ExcludedCategories, "allCategories")
+	if slices.Contains(selector.ExcludedCategories, "*") {
+		selector.IncludedCategories = []string{}
+	}
+
+	selector.IncludedCommands = RemoveDuplicateEntries(selector.IncludedCommands, "allCommands")
+	if len(selector.IncludedCommands) == 0 && defaultAll {
+		selector.IncludedCommands = []string{"*"}
+	}
+	selector.ExcludedCommands = RemoveDuplicateEntries(selector.ExcludedCommands, "allCommands")
+	if slices.Contains(selector.ExcludedCommands, "*") {
+		selector.IncludedCommands = []string{}
+	}
+
+	selector.IncludedReadKeys = RemoveDuplicateEntries(selector.IncludedReadKeys, "allKeys")
+	if len(selector.IncludedReadKeys) == 0 && !selector.NoKeys && defaultAll {
+		selector.IncludedReadKeys = []string{"*"}
+	}
+	selector.IncludedWriteKeys = RemoveDuplicateEntries(selector.IncludedWriteKeys, "allKeys")
+	if len(selector.IncludedWriteKeys) == 0 && !selector.NoKeys && defaultAll {
+		selector.IncludedWriteKeys = []string{"*"}
+	}
+	selector.ExcludedReadKeys = RemoveDuplicateEntries(selector.ExcludedReadKeys, "allKeys")
+	selector.ExcludedWriteKeys = RemoveDuplicateEntries(selector.ExcludedWriteKeys, "allKeys")
+
+	selector.IncludedPubSubChannels = RemoveDuplicateEntries(selector.IncludedPubSubChannels, "allChannels")
+	if len(selector.IncludedPubSubChannels) == 0 && defaultAll {
+		selector.IncludedPubSubChannels = []string{"*"}
+	}
+	selector.ExcludedPubSubChannels = RemoveDuplicateEntries(selector.ExcludedPubSubChannels, "allChannels")
+	if slices.Contains(selector.ExcludedPubSubChannels, "*") {
+		selector.IncludedPubSubChannels = []string{}
+	}
+
+	slices.Sort(selector.Databases)
+	selector.Databases = slices.Compact(selector.Databases)
+}
+
 func RemoveDuplicateEntries(entries []string, allAlias string) (res []string) {
 	entriesMap := make(map[string]int)
 	for _, entry := range entries {
@@ -118,8 +173,80 @@ func RemoveDuplicateEntries(entries []string, allAlias string) (res []string) {
 	return
 }
 
-func (user *User) UpdateUser(cmd []string) error {
+// splitSelectors separates the selectors, e.g. "(+get ~cache:*)", from the other rules and returns the rules
+// of each selector. A selector can be passed as one argument, or spread over several arguments.
+func splitSelectors(cmd []string) ([]string, [][]string, error) {
+	var rules []string
+	var selectors [][]string
+	var selector []string
+	inSelector := false
+
 	for _, str := range cmd {
+		if !inSelector && strings.HasPrefix(str, "(") {
+			inSelector = true
+			selector = []string{}
+			str = str[1:]
+		}
+		if !inSelector {
+			rules = append(rules, str)
+			continue
+		}
+		if strings.HasSuffix(str, ")") {
+			inSelector = false
+			str = strings.TrimSuffix(str, ")")
+			selector = append(selector, strings.Fields(str)...)
+			selectors = append(selectors, selector)
+			continue
+		}
+		selector = append(selector, strings.Fields(str)...)
+	}
+
+	if inSelector {
+		return nil, nil, errors.New("unmatched parenthesis in ACL selector")
+	}
+	return rules, selectors, nil
+}
+
+// parseKeyRule parses the key rules "~<pattern>", "%R~<pattern>", "%W~<pattern>" and "%RW~<pattern>".
+// A rule prefixed with '-' excludes the pattern. It returns false when str is not a key rule.
+func parseKeyRule(str string) (read bool, write bool, exclude bool, pattern string, ok bool) {
+	if strings.HasPrefix(str, "-") {
+		exclude = true
+		str = str[1:]
+	}
+	i := strings.Index(str, "~")
+	if i == -1 || i == len(str)-1 {
+		return false, false, false, "", false
+	}
+	if i == 0 {
+		return true, true, exclude, str[1:], true
+	}
+	if str[0] != '%' || i == 1 {
+		return false, false, false, "", false
+	}
+	for _, permission := range strings.ToUpper(str[1:i]) {
+		switch permission {
+		case 'R':
+			read = true
+		case 'W':
+			write = true
+		default:
+			return false, false, false, "", false
+		}
+	}
+	return read, write, exclude, str[i+1:], true
+}
+
+func (user *User) UpdateUser(cmd []string) error {
+	rules, selectors, err := splitSelectors(cmd)
+	if err != nil {
+		return err
+	}
+
+	for _, str := range rules {
+		if str == "" {
+			continue
+		}
 		// Parse enabled
 		if strings.EqualFold(str, "on") {
 			user.Enabled = true
@@ -129,139 +256,308 @@ func (user *User) UpdateUser(cmd []string) error {
 		}
 		// Parse passwords
 		if str[0] == '>' || str[0] == '#' {
-			user.Passwords = append(user.Passwords, Password{
+			password := Password{
 				PasswordType:  GetPasswordType(str),
 				PasswordValue: str[1:],
-			})
+			}
+			if err := password.validate(); err != nil {
+				return fmt.Errorf("invalid password hash: %w", err)
+			}
+			user.Passwords = append(user.Passwords, password)
 			user.NoPassword = false
 			continue
 		}
 		if str[0] == '<' {
+			// Remove the plaintext password, and the hashes of the password.
 			user.Passwords = slices.DeleteFunc(user.Passwords, func(password Password) bool {
-				return strings.EqualFold(password.PasswordType, PasswordPlainText) && password.PasswordValue == str[1:]
+				return password.verify(str[1:])
 			})
 			continue
 		}
 		if str[0] == '!' {
 			user.Passwords = slices.DeleteFunc(user.Passwords, func(password Password) bool {
-				return strings.EqualFold(password.PasswordType, PasswordSHA256) && password.PasswordValue == str[1:]
+				return !strings.EqualFold(password.PasswordType, PasswordPlainText) && password.PasswordValue == str[1:]
 			})
 			continue
 		}
-		// Parse categories
-		if strings.EqualFold(str, "nocommands") {
-			user.ExcludedCategories = []string{"*"}
-			user.ExcludedCommands = []string{"*"}
+		// Remove the additional selectors
+		if strings.EqualFold(str, "clearselectors") {
+			user.Selectors = []Selector{}
+		}
+		// Parse quotas
+		if name, value, ok := strings.Cut(str, "="); ok {
+			if isQuota, err := user.Quotas.set(name, value); isQuota {
+				if err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		if strings.EqualFold(str, "resetquotas") {
+			user.Quotas = Quotas{}
+		}
+	}
+
+	// Parse the root permissions
+	if err = user.Selector.update(slices.DeleteFunc(slices.Clone(rules), func(str string) bool {
+		return str != "" && slices.Contains([]uint8{'>', '#', '<', '!'}, str[0])
+	})); err != nil {
+		return err
+	}
+
+	// If nopass is provided, delete all passwords
+	for _, str := range rules {
+		if strings.EqualFold(str, "nopass") {
+			user.Passwords = []Password{}
+			user.NoPassword = true
+		}
+	}
+
+	for _, str := range rules {
+		// If resetpass is provided, delete all passwords and set NoPassword to false
+		if strings.EqualFold(str, "resetpass") {
+			user.Passwords = []Password{}
+			user.NoPassword = false
+		}
+	}
+
+	// Add the selectors
+	for _, selectorRules := range selectors {
+		selector := Selector{}
+		if err = selector.update(selectorRules); err != nil {
+			return err
+		}
+		selector.normalise(false)
+		user.Selectors = append(user.Selectors, selector)
+	}
+
+	return nil
+}
+
+// update applies the permission rules to the selector. Rules that don't describe permissions are ignored.
+func (selector *Selector) update(rules []string) error {
+	for _, str := range rules {
+		if str == "" {
 			continue
 		}
+		// Parse categories
 		if strings.EqualFold(str, "allCategories") {
-			user.IncludedCategories = []string{"*"}
+			selector.IncludedCategories = []string{"*"}
 			continue
 		}
 		if len(str) > 3 && str[1] == '@' {
+			category := str[2:]
+			if strings.EqualFold(category, "all") {
+				category = "*"
+			}
 			if str[0] == '+' {
-				user.IncludedCategories = append(user.IncludedCategories, str[2:])
+				selector.IncludedCategories = append(selector.IncludedCategories, category)
 				continue
 			}
 			if str[0] == '-' {
-				user.ExcludedCategories = append(user.ExcludedCategories, str[2:])
+				selector.ExcludedCategories = append(selector.ExcludedCategories, category)
 				continue
 			}
 		}
 		// Parse keys
 		if strings.EqualFold(str, "allKeys") {
-			user.IncludedReadKeys = []string{"*"}
-			user.IncludedWriteKeys = []string{"*"}
-			user.NoKeys = false
-			continue
-		}
-		if (len(str) > 1 && str[0] == '~') || len(str) > 4 && strings.EqualFold(str[0:4], "%RW~") {
-			startIndex := strings.Index(str, "~") + 1
-			user.IncludedReadKeys = append(user.IncludedReadKeys, str[startIndex:])
-			user.IncludedWriteKeys = append(user.IncludedWriteKeys, str[startIndex:])
-			user.NoKeys = false
-			continue
-		}
-		if len(str) > 3 && strings.EqualFold(str[0:3], "%R~") {
-			user.IncludedReadKeys = append(user.IncludedReadKeys, str[3:])
-			user.NoKeys = false
+			selector.IncludedReadKeys = []string{"*"}
+			selector.IncludedWriteKeys = []string{"*"}
+			selector.NoKeys = false
 			continue
 		}
-		if len(str) > 3 && strings.EqualFold(str[0:3], "%W~") {
-			user.IncludedWriteKeys = append(user.IncludedWriteKeys, str[3:])
-			user.NoKeys = false
+		if read, write, exclude, pattern, ok := parseKeyRule(str); ok {
+			switch {
+			case exclude && read:
+				selector.ExcludedReadKeys = append(selector.ExcludedReadKeys, pattern)
+			case !exclude && read:
+				selector.IncludedReadKeys = append(selector.IncludedReadKeys, pattern)
+			}
+			switch {
+			case exclude && write:
+				selector.ExcludedWriteKeys = append(selector.ExcludedWriteKeys, pattern)
+			case !exclude && write:
+				selector.IncludedWriteKeys = append(selector.IncludedWriteKeys, pattern)
+			}
+			if !exclude {
+				selector.NoKeys = false
+			}
 			continue
 		}
 		// Parse channels
 		if strings.EqualFold(str, "allChannels") {
-			user.IncludedPubSubChannels = []string{"*"}
+			selector.IncludedPubSubChannels = []string{"*"}
 			continue
 		}
 		if len(str) > 2 && str[1] == '&' {
 			if str[0] == '+' {
-				user.IncludedPubSubChannels = append(user.IncludedPubSubChannels, str[2:])
+				selector.IncludedPubSubChannels = append(selector.IncludedPubSubChannels, str[2:])
 				continue
 			}
 			if str[0] == '-' {
-				user.ExcludedPubSubChannels = append(user.ExcludedPubSubChannels, str[2:])
+				selector.ExcludedPubSubChannels = append(selector.ExcludedPubSubChannels, str[2:])
 				continue
 			}
 		}
+		// Parse databases
+		if strings.EqualFold(str, "allDatabases") {
+			selector.Databases = []int{}
+			continue
+		}
+		if len(str) > 3 && strings.EqualFold(str[0:3], "db=") {
+			for _, s := range strings.Split(str[3:], ",") {
+				database, err := strconv.Atoi(s)
+				if err != nil || database < 0 {
+					return fmt.Errorf("invalid database %s in rule %s", s, str)
+				}
+				selector.Databases = append(selector.Databases, database)
+			}
+			continue
+		}
 		// Parse commands
 		if strings.EqualFold(str, "allCommands") {
-			user.IncludedCommands = []string{"*"}
-			user.ExcludedCommands = []string{}
+			selector.IncludedCommands = []string{"*"}
+			selector.ExcludedCommands = []string{}
 			continue
 		}
 		if len(str) > 2 && !slices.Contains([]uint8{'&', '@'}, str[1]) {
+			command := str[1:]
+			if strings.EqualFold(command, "all") {
+				command = "*"
+			}
 			if str[0] == '+' {
-				user.IncludedCommands = append(user.IncludedCommands, str[1:])
+				selector.IncludedCommands = append(selector.IncludedCommands, command)
 				continue
 			}
 			if str[0] == '-' {
-				user.ExcludedCommands = append(user.ExcludedCommands, str[1:])
+				selector.ExcludedCommands = append(selector.ExcludedCommands, command)
 				continue
 			}
 		}
 	}
 
-	// If nopass is provided, delete all passwords
-	for _, str := range cmd {
-		if strings.EqualFold(str, "nopass") {
-			user.Passwords = []Password{}
-			user.NoPassword = true
-		}
-	}
-
-	for _, str := range cmd {
-		// If resetpass is provided, delete all passwords and set NoPassword to false
-		if strings.EqualFold(str, "resetpass") {
-			user.Passwords = []Password{}
-			user.NoPassword = false
-		}
-		// If nocommands is provided, disable all commands for this user
+	for _, str := range rules {
+		// If nocommands is provided, disable all commands for this selector
 		if strings.EqualFold(str, "nocommands") {
-			user.IncludedCommands = []string{}
-			user.ExcludedCommands = []string{"*"}
-			user.IncludedCategories = []string{}
-			user.ExcludedCategories = []string{"*"}
+			selector.IncludedCommands = []string{}
+			selector.ExcludedCommands = []string{"*"}
+			selector.IncludedCategories = []string{}
+			selector.ExcludedCategories = []string{"*"}
 		}
-		// If resetkeys or nokeys is provided, reset all keys that the user can access.
+		// If resetkeys or nokeys is provided, reset all keys that the selector can access.
 		if slices.Contains([]string{"resetkeys", "nokeys"}, str) {
-			user.IncludedReadKeys = []string{}
-			user.IncludedWriteKeys = []string{}
-			user.NoKeys = true
+			selector.IncludedReadKeys = []string{}
+			selector.IncludedWriteKeys = []string{}
+			selector.ExcludedReadKeys = []string{}
+			selector.ExcludedWriteKeys = []string{}
+			selector.NoKeys = true
 		}
-		// If resetchannels is provided, remove all the pub/sub channels that the user can access
+		// If resetchannels is provided, remove all the pub/sub channels that the selector can access
 		if strings.EqualFold(str, "resetchannels") {
-			user.IncludedPubSubChannels = []string{}
-			user.ExcludedPubSubChannels = []string{"*"}
+			selector.IncludedPubSubChannels = []string{}
+			selector.ExcludedPubSubChannels = []string{"*"}
 		}
 	}
 
 	return nil
 }
 
+// globs returns the key and channel glob patterns of the selector.
+func (selector *Selector) globs() []string {
+	var globs []string
+	globs = append(globs, selector.IncludedPubSubChannels...)
+	globs = append(globs, selector.ExcludedPubSubChannels...)
+	globs = append(globs, selector.IncludedReadKeys...)
+	globs = append(globs, selector.IncludedWriteKeys...)
+	globs = append(globs, selector.ExcludedReadKeys...)
+	globs = append(globs, selector.ExcludedWriteKeys...)
+	return globs
+}
+
+// rules returns the permissions of the selector as ACL SETUSER rules.
+func (selector *Selector) rules() []string {
+	var rules []string
+	// Included categories
+	for _, category := range selector.IncludedCategories {
+		if category == "*" {
+			rules = append(rules, "+@all")
+			continue
+		}
+		rules = append(rules, fmt.Sprintf("+@%s", category))
+	}
+	// Excluded categories
+	for _, category := range selector.ExcludedCategories {
+		if category == "*" {
+			rules = append(rules, "-@all")
+			continue
+		}
+		rules = append(rules, fmt.Sprintf("-@%s", category))
+	}
+	// Included commands
+	for _, command := range selector.IncludedCommands {
+		if command == "*" {
+			rules = append(rules, "+all")
+			continue
+		}
+		rules = append(rules, fmt.Sprintf("+%s", command))
+	}
+	// Excluded commands
+	for _, command := range selector.ExcludedCommands {
+		if command == "*" {
+			rules = append(rules, "-all")
+			continue
+		}
+		rules = append(rules, fmt.Sprintf("-%s", command))
+	}
+	// Included keys
+	rules = append(rules, keyRules("", selector.IncludedReadKeys, selector.IncludedWriteKeys)...)
+	// Included Pub/Sub channels
+	for _, channel := range selector.IncludedPubSubChannels {
+		rules = append(rules, fmt.Sprintf("+&%s", channel))
+	}
+	// Excluded Pup/Sub channels
+	for _, channel := range selector.ExcludedPubSubChannels {
+		rules = append(rules, fmt.Sprintf("-&%s", channel))
+	}
+	// Excluded keys
+	rules = append(rules, keyRules("-", selector.ExcludedReadKeys, selector.ExcludedWriteKeys)...)
+	// Databases
+	if len(selector.Databases) > 0 {
+		rules = append(rules, selector.databasesRule())
+	}
+	return rules
+}
+
+// databasesRule returns the rule of the databases the selector is restricted to.
+func (selector *Selector) databasesRule() string {
+	if len(selector.Databases) == 0 {
+		return "allDatabases"
+	}
+	databases := make([]string, len(selector.Databases))
+	for i, database := range selector.Databases {
+		databases[i] = strconv.Itoa(database)
+	}
+	return fmt.Sprintf("db=%s", strings.Join(databases, ","))
+}
+
+// keyRules returns the key rules for the read and write key patterns, with the prefix.
+func keyRules(prefix string, readKeys []string, writeKeys []string) []string {
+	var rules []string
+	for _, key := range readKeys {
+		if slices.Contains(writeKeys, key) {
+			rules = append(rules, fmt.Sprintf("%s%s~%s", prefix, "%RW", key))
+			continue
+		}
+		rules = append(rules, fmt.Sprintf("%s%s~%s", prefix, "%R", key))
+	}
+	for _, key := range writeKeys {
+		if !slices.Contains(readKeys, key) {
+			rules = append(rules, fmt.Sprintf("%s%s~%s", prefix, "%W", key))
+		}
+	}
+	return rules
+}
+
 func (user *User) Merge(new *User) {
 	user.Enabled = new.Enabled
 	user.NoKeys = new.NoKeys
@@ -272,8 +568,13 @@ func (user *User) Merge(new *User) {
 	user.ExcludedCommands = append(user.ExcludedCommands, new.ExcludedCommands...)
 	user.IncludedReadKeys = append(user.IncludedReadKeys, new.IncludedReadKeys...)
 	user.IncludedWriteKeys = append(user.IncludedWriteKeys, new.IncludedWriteKeys...)
+	user.ExcludedReadKeys = append(user.ExcludedReadKeys, new.ExcludedReadKeys...)
+	user.ExcludedWriteKeys = append(user.ExcludedWriteKeys, new.ExcludedWriteKeys...)
 	user.IncludedPubSubChannels = append(user.IncludedPubSubChannels, new.IncludedPubSubChannels...)
 	user.ExcludedPubSubChannels = append(user.ExcludedPubSubChannels, new.ExcludedPubSubChannels...)
+	user.Databases = append(user.Databases, new.Databases...)
+	user.Selectors = append(user.Selectors, new.Selectors...)
+	user.Quotas = new.Quotas
 
 	// Add passwords.
 	for _, password := range new.Passwords {
@@ -289,39 +590,41 @@ func (user *User) Merge(new *User) {
 
 func (user *User) Replace(new *User) {
 	user.Enabled = new.Enabled
-	user.NoKeys = new.NoKeys
 	user.NoPassword = new.NoPassword
 	user.Passwords = new.Passwords
-	user.IncludedCategories = new.IncludedCategories
-	user.ExcludedCategories = new.ExcludedCategories
-	user.IncludedCommands = new.IncludedCommands
-	user.ExcludedCommands = new.ExcludedCommands
-	user.IncludedReadKeys = new.IncludedReadKeys
-	user.IncludedWriteKeys = new.IncludedWriteKeys
-	user.IncludedPubSubChannels = new.IncludedPubSubChannels
-	user.ExcludedPubSubChannels = new.ExcludedPubSubChannels
+	user.Selector = new.Selector
+	user.Selectors = new.Selectors
+	user.Quotas = new.Quotas
 }
 
 func CreateUser(username string) *User {
 	return &User{
-		Username:               username,
-		Enabled:                true,
-		NoPassword:             false,
-		Passwords:              []Password{},
-		IncludedCategories:     []string{},
-		ExcludedCategories:     []string{},
-		IncludedCommands:       []string{},
-		ExcludedCommands:       []string{},
-		IncludedReadKeys:       []string{},
-		IncludedWriteKeys:      []string{},
-		IncludedPubSubChannels: []string{},
-		ExcludedPubSubChannels: []string{},
+		Username:   username,
+		Enabled:    true,
+		NoPassword: false,
+		Passwords:  []Password{},
+		Selector: Selector{
+			IncludedCategories:     []string{},
+			ExcludedCategories:     []string{},
+			IncludedCommands:       []string{},
+			ExcludedCommands:       []string{},
+			IncludedReadKeys:       []string{},
+			IncludedWriteKeys:      []string{},
+			ExcludedReadKeys:       []string{},
+			ExcludedWriteKeys:      []string{},
+			IncludedPubSubChannels: []string{},
+			ExcludedPubSubChannels: []string{},
+			Databases:              []int{},
+		},
+		Selectors: []Selector{},
 	}
 }
 
+// GetPasswordType returns the type of the password in a '>' or '#' rule.
+// The type of a '#' hash is detected from its format.
 func GetPasswordType(password string) string {
 	if password[0] == '#' {
-		return PasswordSHA256
+		return getHashType(password[1:])
 	}
 	return PasswordPlainText
 }
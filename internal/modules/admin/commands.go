@@ -21,6 +21,7 @@ import (
 	"github.com/echovault/sugardb/internal/constants"
 	"github.com/gobwas/glob"
 	"slices"
+	"strconv"
 	"strings"
 )
 
@@ -189,6 +190,261 @@ func handleCommandDocs(params internal.HandlerFuncParams) ([]byte, error) {
 	return []byte("*0\r\n"), nil
 }
 
+func handleInfo(params internal.HandlerFuncParams) ([]byte, error) {
+	serverInfo := params.GetServerInfo()
+
+	sections := []struct {
+		name   string
+		fields [][2]string
+	}{
+		{
+			name: "server",
+			fields: [][2]string{
+				{"server_name", serverInfo.Server},
+				{"version", serverInfo.Version},
+				{"server_id", serverInfo.Id},
+				{"mode", serverInfo.Mode},
+				{"role", serverInfo.Role},
+				{"modules", strings.Join(serverInfo.Modules, ",")},
+			},
+		},
+		{
+			name: "clients",
+			fields: [][2]string{
+				{"connected_clients", strconv.Itoa(serverInfo.Clients.Connected)},
+				{"maxclients", strconv.FormatUint(uint64(serverInfo.Clients.MaxClients), 10)},
+				{"maxclients_per_ip", strconv.FormatUint(uint64(serverInfo.Clients.MaxClientsPerIP), 10)},
+				{"rejected_connections", strconv.FormatUint(serverInfo.Clients.RejectedConnections, 10)},
+				{"quota_rejections", strconv.FormatUint(serverInfo.Clients.QuotaRejections, 10)},
+				{"timeout", strconv.FormatInt(int64(serverInfo.Clients.Timeout.Seconds()), 10)},
+				{"tcp_keepalive", strconv.FormatInt(int64(serverInfo.Clients.TCPKeepAlive.Seconds()), 10)},
+				{"protected_mode", formatInfoBool(serverInfo.Clients.ProtectedMode)},
+			},
+		},
+		{
+			name: "memory",
+			fields: [][2]string{
+				{"used_memory", strconv.FormatInt(serverInfo.MemoryUsed, 10)},
+				{"maxmemory", strconv.FormatUint(serverInfo.MaxMemory, 10)},
+			},
+		},
+		{
+			name: "persistence",
+			fields: [][2]string{
+				{"rdb_changes_since_last_save", strconv.FormatUint(serverInfo.Persistence.ChangesSinceLastSave, 10)},
+				{"rdb_bgsave_in_progress", formatInfoBool(serverInfo.Persistence.SnapshotInProgress)},
+				{"rdb_last_save_time", strconv.FormatInt(serverInfo.Persistence.LatestSnapshotMilliseconds/1000, 10)},
+				{"rdb_last_bgsave_status", func() string {
+					if serverInfo.Persistence.LastSaveError != "" {
+						return "err"
+					}
+					return "ok"
+				}()},
+				{"rdb_last_bgsave_error", serverInfo.Persistence.LastSaveError},
+				{"rdb_last_bgsave_time_sec", strconv.FormatInt(int64(serverInfo.Persistence.LastSaveDuration.Seconds()), 10)},
+				{"rdb_saves", strconv.FormatUint(serverInfo.Persistence.Saves, 10)},
+				{"aof_rewrite_in_progress", formatInfoBool(serverInfo.Persistence.AOFRewriteInProgress)},
+				{"state_captures", strconv.FormatUint(serverInfo.Persistence.StateCaptures, 10)},
+				{"latest_capture_pause_usec", strconv.FormatInt(serverInfo.Persistence.LatestCapturePause.Microseconds(), 10)},
+				{"latest_capture_copy_usec", strconv.FormatInt(serverInfo.Persistence.LatestCaptureCopy.Microseconds(), 10)},
+			},
+		},
+		{
+			name: "replication",
+			fields: func() [][2]string {
+				role := params.GetRole()
+				fields := [][2]string{{"role", role.Role}}
+				if role.Role == "master" {
+					fields = append(fields, [2]string{"connected_slaves", strconv.Itoa(len(role.Replicas))})
+					// The replication stream of a standalone primary.
+					if role.ReplicationID == "" {
+						return fields
+					}
+					for i, replica := range role.Replicas {
+						link := role.Links[replica.ServerID]
+						fields = append(fields, [2]string{
+							fmt.Sprintf("slave%d", i),
+							fmt.Sprintf("ip=%s,port=%d,state=online,offset=%d,lag=%d",
+								replica.Host, replica.Port, link.Offset, int64(link.LastAck.Seconds())),
+						})
+					}
+					return append(fields,
+						[2]string{"master_replid", role.ReplicationID},
+						[2]string{"master_repl_offset", strconv.FormatUint(role.Offset, 10)},
+						[2]string{"sync_full", strconv.FormatUint(role.SyncFull, 10)},
+						[2]string{"sync_partial_ok", strconv.FormatUint(role.SyncPartialOK, 10)},
+						[2]string{"sync_partial_err", strconv.FormatUint(role.SyncPartialErr, 10)},
+						[2]string{"repl_backlog_active", formatInfoBool(role.BacklogActive)},
+						[2]string{"repl_backlog_size", strconv.Itoa(role.BacklogSize)},
+						[2]string{"repl_backlog_first_byte_offset", strconv.FormatUint(role.BacklogFirstOffset, 10)},
+						[2]string{"repl_backlog_histlen", strconv.Itoa(role.BacklogHistlen)},
+					)
+				}
+				if role.ReplicationID != "" {
+					fields = append(fields, [2]string{"master_replid", role.ReplicationID})
+				}
+				return append(fields,
+					[2]string{"master_host", role.LeaderHost},
+					[2]string{"master_port", strconv.Itoa(role.LeaderPort)},
+					[2]string{"master_link_status", func() string {
+						if role.State == "connected" {
+							return "up"
+						}
+						return "down"
+					}()},
+					[2]string{"master_last_io_seconds_ago", func() string {
+						if role.LastContact < 0 {
+							return "-1"
+						}
+						return strconv.FormatInt(int64(role.LastContact.Seconds()), 10)
+					}()},
+					[2]string{"master_sync_in_progress", formatInfoBool(role.State == "sync")},
+					[2]string{"slave_repl_offset", strconv.FormatUint(role.Offset, 10)},
+					[2]string{"slave_repl_lag", strconv.FormatUint(role.Lag, 10)},
+					[2]string{"slave_read_only", formatInfoBool(role.Replica)},
+				)
+			}(),
+		},
+		{
+			name: "keyspace",
+			fields: func() [][2]string {
+				var fields [][2]string
+				for _, database := range params.GetKeyspaceInfo() {
+					fields = append(fields, [2]string{
+						fmt.Sprintf("db%d", database.Database),
+						fmt.Sprintf("keys=%d,expires=%d", database.Keys, database.Expires),
+					})
+				}
+				return fields
+			}(),
+		},
+	}
+
+	// If no section is specified, or "all" or "everything" is specified, return all the sections.
+	requested := make([]string, 0, len(params.Command)-1)
+	for _, section := range params.Command[1:] {
+		section = strings.ToLower(section)
+		if slices.Contains([]string{"all", "everything", "default"}, section) {
+			requested = nil
+			break
+		}
+		requested = append(requested, section)
+	}
+
+	var res strings.Builder
+	for _, section := range sections {
+		if len(requested) > 0 && !slices.Contains(requested, section.name) {
+			continue
+		}
+		if res.Len() > 0 {
+			res.WriteString("\r\n")
+		}
+		res.WriteString(fmt.Sprintf("# %s%s\r\n", strings.ToUpper(section.name[:1]), section.name[1:]))
+		for _, field := range section.fields {
+			res.WriteString(fmt.Sprintf("%s:%s\r\n", field[0], field[1]))
+		}
+	}
+
+	return []byte(fmt.Sprintf("$%d\r\n%s\r\n", res.Len(), res.String())), nil
+}
+
+func handleSnapshotList(params internal.HandlerFuncParams) ([]byte, error) {
+	if len(params.Command) != 2 {
+		return nil, errors.New(constants.WrongArgsResponse)
+	}
+
+	snapshots, err := params.ListSnapshots()
+	if err != nil {
+		return nil, err
+	}
+
+	res := fmt.Sprintf("*%d\r\n", len(snapshots))
+	for _, snapshot := range snapshots {
+		databases := make([]int, 0, len(snapshot.Databases))
+		for database, _ := range snapshot.Databases {
+			databases = append(databases, database)
+		}
+		slices.Sort(databases)
+
+		res += "*10\r\n"
+		res += fmt.Sprintf("+id\r\n:%d\r\n", snapshot.Id)
+		res += fmt.Sprintf("+size\r\n:%d\r\n", snapshot.Size)
+		res += fmt.Sprintf("+keys\r\n:%d\r\n", snapshot.Keys)
+		res += fmt.Sprintf("+latest\r\n:%s\r\n", formatInfoBool(snapshot.Latest))
+		res += fmt.Sprintf("+databases\r\n*%d\r\n", len(databases)*2)
+		for _, database := range databases {
+			res += fmt.Sprintf(":%d\r\n:%d\r\n", database, snapshot.Databases[database])
+		}
+	}
+
+	return []byte(res), nil
+}
+
+func handleSnapshotRestore(params internal.HandlerFuncParams) ([]byte, error) {
+	if len(params.Command) != 3 && len(params.Command) != 5 && len(params.Command) != 7 {
+		return nil, errors.New(constants.WrongArgsResponse)
+	}
+
+	id, err := strconv.ParseInt(params.Command[2], 10, 64)
+	if err != nil {
+		return nil, errors.New("snapshot id must be an integer")
+	}
+
+	database, target := -1, -1
+	if len(params.Command) >= 5 {
+		if !strings.EqualFold(params.Command[3], "DB") {
+			return nil, fmt.Errorf("expected DB, got %s", strings.ToUpper(params.Command[3]))
+		}
+		if database, err = strconv.Atoi(params.Command[4]); err != nil || database < 0 {
+			return nil, errors.New("database must be a positive integer")
+		}
+		target = database
+	}
+	if len(params.Command) == 7 {
+		if !strings.EqualFold(params.Command[5], "TO") {
+			return nil, fmt.Errorf("expected TO, got %s", strings.ToUpper(params.Command[5]))
+		}
+		if target, err = strconv.Atoi(params.Command[6]); err != nil || target < 0 {
+			return nil, errors.New("target database must be a positive integer")
+		}
+	}
+
+	if err = params.RestoreSnapshot(id, database, target); err != nil {
+		return nil, err
+	}
+
+	return []byte(constants.OkResponse), nil
+}
+
+func handleSnapshotExport(params internal.HandlerFuncParams) ([]byte, error) {
+	if len(params.Command) != 5 {
+		return nil, errors.New(constants.WrongArgsResponse)
+	}
+
+	id, err := strconv.ParseInt(params.Command[2], 10, 64)
+	if err != nil {
+		return nil, errors.New("snapshot id must be an integer")
+	}
+
+	database, err := strconv.Atoi(params.Command[3])
+	if err != nil || database < 0 {
+		return nil, errors.New("database must be a positive integer")
+	}
+
+	if err = params.ExportSnapshot(id, database, params.Command[4]); err != nil {
+		return nil, err
+	}
+
+	return []byte(constants.OkResponse), nil
+}
+
+func formatInfoBool(b bool) string {
+	if b {
+		return "1"
+	}
+	return "0"
+}
+
 func Commands() []internal.Command {
 	return []internal.Command{
 		{
@@ -276,6 +532,82 @@ Get the list of command names. Allows for filtering by ACL category or glob patt
 				return []byte(constants.OkResponse), nil
 			},
 		},
+		{
+			Command:    "bgsave",
+			Module:     constants.AdminModule,
+			Categories: []string{constants.AdminCategory, constants.SlowCategory, constants.DangerousCategory},
+			Description: `(BGSAVE) Trigger a snapshot save in the background.
+The status of the save is reported in the persistence section of the INFO command.`,
+			Sync: false,
+			KeyExtractionFunc: func(cmd []string) (internal.KeyExtractionFuncResult, error) {
+				return internal.KeyExtractionFuncResult{
+					Channels: make([]string, 0), ReadKeys: make([]string, 0), WriteKeys: make([]string, 0),
+				}, nil
+			},
+			HandlerFunc: func(params internal.HandlerFuncParams) ([]byte, error) {
+				if err := params.BGSave(); err != nil {
+					return nil, err
+				}
+				return []byte("+Background saving started\r\n"), nil
+			},
+		},
+		{
+			Command:     "snapshot",
+			Module:      constants.AdminModule,
+			Categories:  []string{},
+			Description: "Commands to manage the snapshots on disk",
+			Sync:        false,
+			KeyExtractionFunc: func(cmd []string) (internal.KeyExtractionFuncResult, error) {
+				return internal.KeyExtractionFuncResult{
+					Channels: make([]string, 0), ReadKeys: make([]string, 0), WriteKeys: make([]string, 0),
+				}, nil
+			},
+			SubCommands: []internal.SubCommand{
+				{
+					Command:    "list",
+					Module:     constants.AdminModule,
+					Categories: []string{constants.AdminCategory, constants.SlowCategory, constants.DangerousCategory},
+					Description: `(SNAPSHOT LIST) List the snapshots on disk from the most recent to the oldest, 
+with their size in bytes and the number of keys in each database. Only works in standalone mode.`,
+					Sync: false,
+					KeyExtractionFunc: func(cmd []string) (internal.KeyExtractionFuncResult, error) {
+						return internal.KeyExtractionFuncResult{
+							Channels: make([]string, 0), ReadKeys: make([]string, 0), WriteKeys: make([]string, 0),
+						}, nil
+					},
+					HandlerFunc: handleSnapshotList,
+				},
+				{
+					Command:    "restore",
+					Module:     constants.AdminModule,
+					Categories: []string{constants.AdminCategory, constants.SlowCategory, constants.DangerousCategory},
+					Description: `(SNAPSHOT RESTORE id [DB index [TO target]]) Restore the snapshot with the given id 
+into the running instance. All the databases are replaced by default. When DB is provided, only the target database 
+is replaced with the database at index from the snapshot. The target defaults to index. Only works in standalone mode.`,
+					Sync: false,
+					KeyExtractionFunc: func(cmd []string) (internal.KeyExtractionFuncResult, error) {
+						return internal.KeyExtractionFuncResult{
+							Channels: make([]string, 0), ReadKeys: make([]string, 0), WriteKeys: make([]string, 0),
+						}, nil
+					},
+					HandlerFunc: handleSnapshotRestore,
+				},
+				{
+					Command:    "export",
+					Module:     constants.AdminModule,
+					Categories: []string{constants.AdminCategory, constants.SlowCategory, constants.DangerousCategory},
+					Description: `(SNAPSHOT EXPORT id index path) Write the database at index from the snapshot with the 
+given id to a snapshot file at path, relative to the snapshot export directory. Only works in standalone mode.`,
+					Sync: false,
+					KeyExtractionFunc: func(cmd []string) (internal.KeyExtractionFuncResult, error) {
+						return internal.KeyExtractionFuncResult{
+							Channels: make([]string, 0), ReadKeys: make([]string, 0), WriteKeys: make([]string, 0),
+						}, nil
+					},
+					HandlerFunc: handleSnapshotExport,
+				},
+			},
+		},
 		{
 			Command:     "lastsave",
 			Module:      constants.AdminModule,
@@ -313,6 +645,39 @@ Get the list of command names. Allows for filtering by ACL category or glob patt
 				return []byte(constants.OkResponse), nil
 			},
 		},
+		{
+			Command:    "bgrewriteaof",
+			Module:     constants.AdminModule,
+			Categories: []string{constants.AdminCategory, constants.SlowCategory, constants.DangerousCategory},
+			Description: `(BGREWRITEAOF) Trigger re-writing of append process in the background.
+Write commands are only paused while the keyspace is being recorded.`,
+			Sync: false,
+			KeyExtractionFunc: func(cmd []string) (internal.KeyExtractionFuncResult, error) {
+				return internal.KeyExtractionFuncResult{
+					Channels: make([]string, 0), ReadKeys: make([]string, 0), WriteKeys: make([]string, 0),
+				}, nil
+			},
+			HandlerFunc: func(params internal.HandlerFuncParams) ([]byte, error) {
+				if err := params.BGRewriteAOF(); err != nil {
+					return nil, err
+				}
+				return []byte("+Background append only file rewriting started\r\n"), nil
+			},
+		},
+		{
+			Command:    "info",
+			Module:     constants.AdminModule,
+			Categories: []string{constants.AdminCategory, constants.SlowCategory, constants.DangerousCategory},
+			Description: `(INFO [section [section ...]]) Get information and statistics about the server.
+The supported sections are server, memory, persistence and keyspace. All sections are returned by default.`,
+			Sync: false,
+			KeyExtractionFunc: func(cmd []string) (internal.KeyExtractionFuncResult, error) {
+				return internal.KeyExtractionFuncResult{
+					Channels: make([]string, 0), ReadKeys: make([]string, 0), WriteKeys: make([]string, 0),
+				}, nil
+			},
+			HandlerFunc: handleInfo,
+		},
 		{
 			Command:     "module",
 			Module:      constants.AdminModule,
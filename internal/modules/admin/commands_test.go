@@ -22,6 +22,7 @@ import (
 	"github.com/echovault/sugardb/internal/constants"
 	"github.com/echovault/sugardb/internal/modules/acl"
 	"github.com/echovault/sugardb/internal/modules/admin"
+	"github.com/echovault/sugardb/internal/modules/cluster"
 	"github.com/echovault/sugardb/internal/modules/connection"
 	"github.com/echovault/sugardb/internal/modules/generic"
 	"github.com/echovault/sugardb/internal/modules/hash"
@@ -96,6 +97,7 @@ func Test_AdminCommands(t *testing.T) {
 		var commands []internal.Command
 		commands = append(commands, acl.Commands()...)
 		commands = append(commands, admin.Commands()...)
+		commands = append(commands, cluster.Commands()...)
 		commands = append(commands, generic.Commands()...)
 		commands = append(commands, hash.Commands()...)
 		commands = append(commands, list.Commands()...)
@@ -148,6 +150,7 @@ func Test_AdminCommands(t *testing.T) {
 		var commands []internal.Command
 		commands = append(commands, acl.Commands()...)
 		commands = append(commands, admin.Commands()...)
+		commands = append(commands, cluster.Commands()...)
 		commands = append(commands, generic.Commands()...)
 		commands = append(commands, hash.Commands()...)
 		commands = append(commands, list.Commands()...)
@@ -189,6 +192,7 @@ func Test_AdminCommands(t *testing.T) {
 		var allCommands []internal.Command
 		allCommands = append(allCommands, acl.Commands()...)
 		allCommands = append(allCommands, admin.Commands()...)
+		allCommands = append(allCommands, cluster.Commands()...)
 		allCommands = append(allCommands, generic.Commands()...)
 		allCommands = append(allCommands, hash.Commands()...)
 		allCommands = append(allCommands, list.Commands()...)
@@ -996,4 +1000,75 @@ func Test_AdminCommands(t *testing.T) {
 		_ = conn.Close()
 		mockServer.ShutDown()
 	})
+
+	t.Run("Test INFO command", func(t *testing.T) {
+		conn, err := internal.GetConnection("localhost", port)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer func() {
+			_ = conn.Close()
+		}()
+		client := resp.NewConn(conn)
+
+		tests := []struct {
+			name         string
+			command      []string
+			wantSections []string
+		}{
+			{
+				name:         "1. Return all sections by default",
+				command:      []string{"INFO"},
+				wantSections: []string{"# Server", "# Clients", "# Memory", "# Persistence", "# Replication", "# Keyspace"},
+			},
+			{
+				name:         "2. Return only the requested sections",
+				command:      []string{"INFO", "memory", "persistence"},
+				wantSections: []string{"# Memory", "# Persistence"},
+			},
+			{
+				name:         "3. Return all sections when everything is requested",
+				command:      []string{"INFO", "everything"},
+				wantSections: []string{"# Server", "# Clients", "# Memory", "# Persistence", "# Replication", "# Keyspace"},
+			},
+			{
+				name:         "4. Return the replication section of a standalone master",
+				command:      []string{"INFO", "replication"},
+				wantSections: []string{"# Replication"},
+			},
+			{
+				name:         "5. Return the clients section",
+				command:      []string{"INFO", "clients"},
+				wantSections: []string{"# Clients"},
+			},
+		}
+
+		for _, test := range tests {
+			t.Run(test.name, func(t *testing.T) {
+				command := make([]resp.Value, len(test.command))
+				for i, c := range test.command {
+					command[i] = resp.StringValue(c)
+				}
+				if err = client.WriteArray(command); err != nil {
+					t.Error(err)
+					return
+				}
+				res, _, err := client.ReadValue()
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				var sections []string
+				for _, line := range strings.Split(res.String(), "\r\n") {
+					if strings.HasPrefix(line, "# ") {
+						sections = append(sections, line)
+					}
+				}
+				if !slices.Equal(sections, test.wantSections) {
+					t.Errorf("expected sections %v, got %v", test.wantSections, sections)
+				}
+			})
+		}
+	})
 }
@@ -0,0 +1,846 @@
+// Copyright 2024 Kelvin Clement Mwinuka
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/echovault/sugardb/internal"
+	"github.com/echovault/sugardb/internal/constants"
+	"github.com/echovault/sugardb/internal/sharding"
+)
+
+func handleSlots(params internal.HandlerFuncParams) ([]byte, error) {
+	if len(params.Command) != 2 {
+		return nil, errors.New(constants.WrongArgsResponse)
+	}
+	shards, err := params.GetClusterShards()
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []string
+	for _, shard := range shards {
+		for _, slots := range shard.Slots {
+			entry := fmt.Sprintf("*%d\r\n:%d\r\n:%d\r\n", 2+len(shard.Nodes), slots[0], slots[1])
+			for _, node := range shard.Nodes {
+				entry += fmt.Sprintf("*3\r\n%s:%d\r\n%s",
+					bulkString(node.Host), node.Port, bulkString(node.ServerID))
+			}
+			entries = append(entries, entry)
+		}
+	}
+
+	return []byte(fmt.Sprintf("*%d\r\n%s", len(entries), strings.Join(entries, ""))), nil
+}
+
+func handleShards(params internal.HandlerFuncParams) ([]byte, error) {
+	if len(params.Command) != 2 {
+		return nil, errors.New(constants.WrongArgsResponse)
+	}
+	shards, err := params.GetClusterShards()
+	if err != nil {
+		return nil, err
+	}
+
+	res := fmt.Sprintf("*%d\r\n", len(shards))
+	for _, shard := range shards {
+		res += fmt.Sprintf("*4\r\n%s*%d\r\n", bulkString("slots"), 2*len(shard.Slots))
+		for _, slots := range shard.Slots {
+			res += fmt.Sprintf(":%d\r\n:%d\r\n", slots[0], slots[1])
+		}
+		res += fmt.Sprintf("%s*%d\r\n", bulkString("nodes"), len(shard.Nodes))
+		for _, node := range shard.Nodes {
+			role := "replica"
+			if node.Leader {
+				role = "master"
+			}
+			res += fmt.Sprintf("*12\r\n%s%s%s:%d\r\n%s%s%s%s%s%s%s%s",
+				bulkString("id"), bulkString(node.ServerID),
+				bulkString("port"), node.Port,
+				bulkString("ip"), bulkString(node.Host),
+				bulkString("endpoint"), bulkString(node.Host),
+				bulkString("role"), bulkString(role),
+				bulkString("health"), bulkString("online"),
+			)
+		}
+	}
+
+	return []byte(res), nil
+}
+
+func handleKeySlot(params internal.HandlerFuncParams) ([]byte, error) {
+	if len(params.Command) != 3 {
+		return nil, errors.New(constants.WrongArgsResponse)
+	}
+	return []byte(fmt.Sprintf(":%d\r\n", sharding.KeySlot(params.Command[2]))), nil
+}
+
+func handleCountKeysInSlot(params internal.HandlerFuncParams) ([]byte, error) {
+	if len(params.Command) != 3 {
+		return nil, errors.New(constants.WrongArgsResponse)
+	}
+	slot, err := strconv.Atoi(params.Command[2])
+	if err != nil || slot < 0 || slot >= sharding.SlotCount {
+		return nil, errors.New("invalid slot")
+	}
+	return []byte(fmt.Sprintf(":%d\r\n", params.CountKeysInSlot(params.Context, slot))), nil
+}
+
+func handleAsking(params internal.HandlerFuncParams) ([]byte, error) {
+	if len(params.Command) != 1 {
+		return nil, errors.New(constants.WrongArgsResponse)
+	}
+	if err := params.SetAsking(params.Connection); err != nil {
+		return nil, err
+	}
+	return []byte(constants.OkResponse), nil
+}
+
+func handleGetKeysInSlot(params internal.HandlerFuncParams) ([]byte, error) {
+	if len(params.Command) != 4 {
+		return nil, errors.New(constants.WrongArgsResponse)
+	}
+	slot, err := strconv.Atoi(params.Command[2])
+	if err != nil || slot < 0 || slot >= sharding.SlotCount {
+		return nil, errors.New("invalid slot")
+	}
+	count, err := strconv.Atoi(params.Command[3])
+	if err != nil || count < 0 {
+		return nil, errors.New("invalid number of keys")
+	}
+
+	keys := params.GetKeysInSlot(params.Context, slot, count)
+	res := fmt.Sprintf("*%d\r\n", len(keys))
+	for _, key := range keys {
+		res += bulkString(key)
+	}
+	return []byte(res), nil
+}
+
+func handleSetSlot(params internal.HandlerFuncParams) ([]byte, error) {
+	if len(params.Command) < 4 {
+		return nil, errors.New(constants.WrongArgsResponse)
+	}
+	slots, err := sharding.ParseSlotRanges(params.Command[2])
+	if err != nil || len(slots) == 0 {
+		return nil, errors.New("invalid slot")
+	}
+
+	state := strings.ToUpper(params.Command[3])
+	id := ""
+	switch state {
+	case "IMPORTING", "MIGRATING", "NODE":
+		if len(params.Command) != 5 {
+			return nil, errors.New(constants.WrongArgsResponse)
+		}
+		id = params.Command[4]
+	case "STABLE":
+		if len(params.Command) != 4 {
+			return nil, errors.New(constants.WrongArgsResponse)
+		}
+	default:
+		return nil, fmt.Errorf("invalid SETSLOT state %s", params.Command[3])
+	}
+
+	if err = params.SetSlot(slots, state, id); err != nil {
+		return nil, err
+	}
+	return []byte(constants.OkResponse), nil
+}
+
+func handleRebalance(params internal.HandlerFuncParams) ([]byte, error) {
+	options := internal.RebalanceOptions{BatchSize: 100, Timeout: 5 * time.Second}
+	for i := 2; i < len(params.Command); i++ {
+		switch strings.ToUpper(params.Command[i]) {
+		case "BATCH":
+			if i+1 >= len(params.Command) {
+				return nil, errors.New(constants.WrongArgsResponse)
+			}
+			batch, err := strconv.Atoi(params.Command[i+1])
+			if err != nil || batch <= 0 {
+				return nil, errors.New("batch size must be a positive integer")
+			}
+			options.BatchSize = batch
+			i++
+		case "TIMEOUT":
+			if i+1 >= len(params.Command) {
+				return nil, errors.New(constants.WrongArgsResponse)
+			}
+			timeout, err := strconv.ParseInt(params.Command[i+1], 10, 64)
+			if err != nil || timeout <= 0 {
+				return nil, errors.New("timeout must be a positive integer")
+			}
+			options.Timeout = time.Duration(timeout) * time.Millisecond
+			i++
+		case "AUTH":
+			if i+1 >= len(params.Command) {
+				return nil, errors.New(constants.WrongArgsResponse)
+			}
+			options.Auth = params.Command[i+1 : i+2]
+			i++
+		case "AUTH2":
+			if i+2 >= len(params.Command) {
+				return nil, errors.New(constants.WrongArgsResponse)
+			}
+			options.Auth = params.Command[i+1 : i+3]
+			i += 2
+		default:
+			return nil, fmt.Errorf("unknown option %s for CLUSTER REBALANCE", strings.ToUpper(params.Command[i]))
+		}
+	}
+
+	moved, err := params.Rebalance(params.Context, options)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(fmt.Sprintf(":%d\r\n", moved)), nil
+}
+
+func handleInfo(params internal.HandlerFuncParams) ([]byte, error) {
+	if len(params.Command) != 2 {
+		return nil, errors.New(constants.WrongArgsResponse)
+	}
+	info, err := params.GetClusterInfo()
+	if err != nil {
+		return nil, err
+	}
+	lines := []string{
+		"cluster_enabled:1",
+		fmt.Sprintf("cluster_state:%s", info.State),
+		fmt.Sprintf("cluster_slots_assigned:%d", info.SlotsAssigned),
+		fmt.Sprintf("cluster_known_nodes:%d", info.KnownNodes),
+		fmt.Sprintf("cluster_size:%d", info.Size),
+		fmt.Sprintf("cluster_my_id:%s", info.MyID),
+		fmt.Sprintf("cluster_my_shard_id:%s", info.ShardID),
+		fmt.Sprintf("cluster_leader_id:%s", info.LeaderID),
+		fmt.Sprintf("raft_state:%s", strings.ToLower(info.RaftState)),
+		fmt.Sprintf("raft_replica:%d", boolInt(info.Replica)),
+		fmt.Sprintf("raft_term:%d", info.Term),
+		fmt.Sprintf("raft_commit_index:%d", info.CommitIndex),
+		fmt.Sprintf("raft_applied_index:%d", info.AppliedIndex),
+		fmt.Sprintf("raft_replication_lag:%d", info.Lag),
+		fmt.Sprintf("cluster_members_joined:%d", info.MembersJoined),
+		fmt.Sprintf("cluster_members_left:%d", info.MembersLeft),
+		fmt.Sprintf("cluster_members_failed:%d", info.MembersFailed),
+		fmt.Sprintf("cluster_members_recovered:%d", info.MembersRecovered),
+		fmt.Sprintf("cluster_members_removed:%d", info.MembersRemoved),
+		fmt.Sprintf("cluster_members_pending_removal:%d", info.MembersPendingRemoval),
+	}
+	return []byte(bulkString(strings.Join(lines, "\r\n") + "\r\n")), nil
+}
+
+func handleNodes(params internal.HandlerFuncParams) ([]byte, error) {
+	if len(params.Command) != 2 {
+		return nil, errors.New(constants.WrongArgsResponse)
+	}
+	nodes, err := params.GetClusterNodes()
+	if err != nil {
+		return nil, err
+	}
+
+	var res string
+	for _, node := range nodes {
+		var flags []string
+		if node.Myself {
+			flags = append(flags, "myself")
+		}
+		leader := "-"
+		if node.Leader {
+			flags = append(flags, "master")
+		} else {
+			flags = append(flags, "slave")
+			if node.LeaderID != "" {
+				leader = node.LeaderID
+			}
+		}
+		if node.Replica {
+			// Non-voting replicas never become the leader.
+			flags = append(flags, "nofailover")
+		}
+		link := "connected"
+		if !node.Connected {
+			flags = append(flags, "fail")
+			link = "disconnected"
+		}
+		_, raftPort, _ := net.SplitHostPort(node.RaftAddr)
+
+		line := fmt.Sprintf("%s %s:%d@%s %s %s 0 0 0 %s",
+			node.ServerID, node.Host, node.Port, raftPort, strings.Join(flags, ","), leader, link)
+		if node.Leader {
+			for _, slots := range node.Slots {
+				if slots[0] == slots[1] {
+					line += fmt.Sprintf(" %d", slots[0])
+				} else {
+					line += fmt.Sprintf(" %d-%d", slots[0], slots[1])
+				}
+			}
+		}
+		res += line + "\n"
+	}
+	return []byte(bulkString(res)), nil
+}
+
+func handleMyID(params internal.HandlerFuncParams) ([]byte, error) {
+	if len(params.Command) != 2 {
+		return nil, errors.New(constants.WrongArgsResponse)
+	}
+	info, err := params.GetClusterInfo()
+	if err != nil {
+		return nil, err
+	}
+	return []byte(bulkString(info.MyID)), nil
+}
+
+func handleLeader(params internal.HandlerFuncParams) ([]byte, error) {
+	if len(params.Command) != 2 {
+		return nil, errors.New(constants.WrongArgsResponse)
+	}
+	info, err := params.GetClusterInfo()
+	if err != nil {
+		return nil, err
+	}
+	if info.LeaderID == "" {
+		return []byte("$-1\r\n"), nil
+	}
+	return []byte(bulkString(info.LeaderID)), nil
+}
+
+func handleFailover(params internal.HandlerFuncParams) ([]byte, error) {
+	if len(params.Command) > 3 {
+		return nil, errors.New(constants.WrongArgsResponse)
+	}
+	id := ""
+	if len(params.Command) == 3 {
+		id = params.Command[2]
+	}
+	if err := params.ClusterFailover(params.Context, id); err != nil {
+		return nil, err
+	}
+	return []byte(constants.OkResponse), nil
+}
+
+func handleForget(params internal.HandlerFuncParams) ([]byte, error) {
+	if len(params.Command) != 3 {
+		return nil, errors.New(constants.WrongArgsResponse)
+	}
+	if err := params.ClusterForget(params.Context, params.Command[2]); err != nil {
+		return nil, err
+	}
+	return []byte(constants.OkResponse), nil
+}
+
+func handleAddNode(params internal.HandlerFuncParams) ([]byte, error) {
+	if len(params.Command) != 4 {
+		return nil, errors.New(constants.WrongArgsResponse)
+	}
+	if err := params.ClusterAddNode(params.Context, params.Command[2], params.Command[3]); err != nil {
+		return nil, err
+	}
+	return []byte(constants.OkResponse), nil
+}
+
+func handleRemoveNode(params internal.HandlerFuncParams) ([]byte, error) {
+	if len(params.Command) != 3 {
+		return nil, errors.New(constants.WrongArgsResponse)
+	}
+	if err := params.ClusterRemoveNode(params.Context, params.Command[2]); err != nil {
+		return nil, err
+	}
+	return []byte(constants.OkResponse), nil
+}
+
+func handlePromote(params internal.HandlerFuncParams) ([]byte, error) {
+	if len(params.Command) != 3 {
+		return nil, errors.New(constants.WrongArgsResponse)
+	}
+	if err := params.ClusterPromote(params.Context, params.Command[2]); err != nil {
+		return nil, err
+	}
+	return []byte(constants.OkResponse), nil
+}
+
+func handleDemote(params internal.HandlerFuncParams) ([]byte, error) {
+	if len(params.Command) != 3 {
+		return nil, errors.New(constants.WrongArgsResponse)
+	}
+	if err := params.ClusterDemote(params.Context, params.Command[2]); err != nil {
+		return nil, err
+	}
+	return []byte(constants.OkResponse), nil
+}
+
+func handleRole(params internal.HandlerFuncParams) ([]byte, error) {
+	if len(params.Command) != 1 {
+		return nil, errors.New(constants.WrongArgsResponse)
+	}
+	role := params.GetRole()
+	if role.Role == "slave" {
+		return []byte(fmt.Sprintf("*5\r\n%s%s:%d\r\n%s:%d\r\n",
+			bulkString(role.Role), bulkString(role.LeaderHost), role.LeaderPort, bulkString(role.State), role.Offset)), nil
+	}
+	res := fmt.Sprintf("*3\r\n%s:%d\r\n*%d\r\n", bulkString(role.Role), role.Offset, len(role.Replicas))
+	for _, replica := range role.Replicas {
+		// The offset of each replica is only tracked by standalone primaries, it's 0 in cluster mode.
+		res += fmt.Sprintf("*3\r\n%s%s%s",
+			bulkString(replica.Host), bulkString(strconv.Itoa(replica.Port)),
+			bulkString(strconv.FormatUint(role.Links[replica.ServerID].Offset, 10)))
+	}
+	return []byte(res), nil
+}
+
+func handleReplicaOf(params internal.HandlerFuncParams) ([]byte, error) {
+	if len(params.Command) != 3 {
+		return nil, errors.New(constants.WrongArgsResponse)
+	}
+	addr := ""
+	if !strings.EqualFold(params.Command[1], "no") || !strings.EqualFold(params.Command[2], "one") {
+		port, err := strconv.Atoi(params.Command[2])
+		if err != nil || port < 1 || port > 65535 {
+			return nil, errors.New("port must be an integer between 1 and 65535")
+		}
+		addr = net.JoinHostPort(params.Command[1], strconv.Itoa(port))
+	}
+	if err := params.ReplicaOf(addr); err != nil {
+		return nil, err
+	}
+	return []byte(constants.OkResponse), nil
+}
+
+func handlePSync(params internal.HandlerFuncParams) ([]byte, error) {
+	if len(params.Command) != 3 {
+		return nil, errors.New(constants.WrongArgsResponse)
+	}
+	offset, err := strconv.ParseInt(params.Command[2], 10, 64)
+	if err != nil {
+		return nil, errors.New("offset must be an integer")
+	}
+	// The replies and the replication stream are written directly to the connection.
+	if err = params.PSync(params.Connection, params.Command[1], offset); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+func handleReplConf(params internal.HandlerFuncParams) ([]byte, error) {
+	if len(params.Command) < 3 || len(params.Command)%2 != 1 {
+		return nil, errors.New(constants.WrongArgsResponse)
+	}
+	for i := 1; i < len(params.Command); i += 2 {
+		if err := params.ReplConf(params.Connection, params.Command[i], params.Command[i+1]); err != nil {
+			return nil, err
+		}
+	}
+	// Acknowledgements are not replied to, as the connection carries the replication stream.
+	if strings.EqualFold(params.Command[1], "ack") {
+		return nil, nil
+	}
+	return []byte(constants.OkResponse), nil
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func bulkString(s string) string {
+	return fmt.Sprintf("$%d\r\n%s\r\n", len(s), s)
+}
+
+func Commands() []internal.Command {
+	return []internal.Command{
+		{
+			Command:     "cluster",
+			Module:      constants.ClusterModule,
+			Categories:  []string{},
+			Description: "Cluster commands",
+			Sync:        false,
+			KeyExtractionFunc: func(cmd []string) (internal.KeyExtractionFuncResult, error) {
+				return internal.KeyExtractionFuncResult{
+					Channels:  make([]string, 0),
+					ReadKeys:  make([]string, 0),
+					WriteKeys: make([]string, 0),
+				}, nil
+			},
+			SubCommands: []internal.SubCommand{
+				{
+					Command:    "slots",
+					Module:     constants.ClusterModule,
+					Categories: []string{constants.SlowCategory},
+					Description: `(CLUSTER SLOTS) Returns the slot ranges of the cluster and the nodes that serve them.
+The leader of the shard that serves a range is listed first.`,
+					Sync: false,
+					KeyExtractionFunc: func(cmd []string) (internal.KeyExtractionFuncResult, error) {
+						return internal.KeyExtractionFuncResult{
+							Channels:  make([]string, 0),
+							ReadKeys:  make([]string, 0),
+							WriteKeys: make([]string, 0),
+						}, nil
+					},
+					HandlerFunc: handleSlots,
+				},
+				{
+					Command:     "shards",
+					Module:      constants.ClusterModule,
+					Categories:  []string{constants.SlowCategory},
+					Description: "(CLUSTER SHARDS) Returns the shards of the cluster with their slots and nodes.",
+					Sync:        false,
+					KeyExtractionFunc: func(cmd []string) (internal.KeyExtractionFuncResult, error) {
+						return internal.KeyExtractionFuncResult{
+							Channels:  make([]string, 0),
+							ReadKeys:  make([]string, 0),
+							WriteKeys: make([]string, 0),
+						}, nil
+					},
+					HandlerFunc: handleShards,
+				},
+				{
+					Command:     "info",
+					Module:      constants.ClusterModule,
+					Categories:  []string{constants.SlowCategory},
+					Description: "(CLUSTER INFO) Returns the state of the cluster as seen by the node, and the raft state of the node.",
+					Sync:        false,
+					KeyExtractionFunc: func(cmd []string) (internal.KeyExtractionFuncResult, error) {
+						return internal.KeyExtractionFuncResult{
+							Channels:  make([]string, 0),
+							ReadKeys:  make([]string, 0),
+							WriteKeys: make([]string, 0),
+						}, nil
+					},
+					HandlerFunc: handleInfo,
+				},
+				{
+					Command:    "nodes",
+					Module:     constants.ClusterModule,
+					Categories: []string{constants.SlowCategory},
+					Description: `(CLUSTER NODES) Returns the nodes of the cluster, one per line, in the format
+<id> <ip:port@raft-port> <flags> <leader-id> <ping-sent> <pong-recv> <config-epoch> <link-state> <slot> ...
+Non-voting replicas are flagged with nofailover. Nodes of the node's shard that have left or failed are flagged
+with fail until they are forgotten.`,
+					Sync: false,
+					KeyExtractionFunc: func(cmd []string) (internal.KeyExtractionFuncResult, error) {
+						return internal.KeyExtractionFuncResult{
+							Channels:  make([]string, 0),
+							ReadKeys:  make([]string, 0),
+							WriteKeys: make([]string, 0),
+						}, nil
+					},
+					HandlerFunc: handleNodes,
+				},
+				{
+					Command:     "myid",
+					Module:      constants.ClusterModule,
+					Categories:  []string{constants.SlowCategory},
+					Description: "(CLUSTER MYID) Returns the server id of the node.",
+					Sync:        false,
+					KeyExtractionFunc: func(cmd []string) (internal.KeyExtractionFuncResult, error) {
+						return internal.KeyExtractionFuncResult{
+							Channels:  make([]string, 0),
+							ReadKeys:  make([]string, 0),
+							WriteKeys: make([]string, 0),
+						}, nil
+					},
+					HandlerFunc: handleMyID,
+				},
+				{
+					Command:     "leader",
+					Module:      constants.ClusterModule,
+					Categories:  []string{constants.SlowCategory},
+					Description: "(CLUSTER LEADER) Returns the server id of the leader of the node's shard, or nil when the leader is unknown.",
+					Sync:        false,
+					KeyExtractionFunc: func(cmd []string) (internal.KeyExtractionFuncResult, error) {
+						return internal.KeyExtractionFuncResult{
+							Channels:  make([]string, 0),
+							ReadKeys:  make([]string, 0),
+							WriteKeys: make([]string, 0),
+						}, nil
+					},
+					HandlerFunc: handleLeader,
+				},
+				{
+					Command:    "failover",
+					Module:     constants.ClusterModule,
+					Categories: []string{constants.AdminCategory, constants.SlowCategory, constants.DangerousCategory},
+					Description: `(CLUSTER FAILOVER [node-id]) Transfers the leadership of the node's shard to the node with the id.
+Without a node id, a follower takes over the leadership and a leader hands it over to the most up-to-date follower.`,
+					Sync: false,
+					KeyExtractionFunc: func(cmd []string) (internal.KeyExtractionFuncResult, error) {
+						return internal.KeyExtractionFuncResult{
+							Channels:  make([]string, 0),
+							ReadKeys:  make([]string, 0),
+							WriteKeys: make([]string, 0),
+						}, nil
+					},
+					HandlerFunc: handleFailover,
+				},
+				{
+					Command:    "forget",
+					Module:     constants.ClusterModule,
+					Categories: []string{constants.AdminCategory, constants.SlowCategory, constants.DangerousCategory},
+					Description: `(CLUSTER FORGET node-id) Removes a node that has left or failed from the raft configuration of the node's shard.
+Nodes that are still members of the cluster must be removed with CLUSTER REMOVENODE.`,
+					Sync: false,
+					KeyExtractionFunc: func(cmd []string) (internal.KeyExtractionFuncResult, error) {
+						return internal.KeyExtractionFuncResult{
+							Channels:  make([]string, 0),
+							ReadKeys:  make([]string, 0),
+							WriteKeys: make([]string, 0),
+						}, nil
+					},
+					HandlerFunc: handleForget,
+				},
+				{
+					Command:     "addnode",
+					Module:      constants.ClusterModule,
+					Categories:  []string{constants.AdminCategory, constants.SlowCategory, constants.DangerousCategory},
+					Description: "(CLUSTER ADDNODE node-id raft-address) Adds the node as a voter to the raft configuration of the node's shard.",
+					Sync:        false,
+					KeyExtractionFunc: func(cmd []string) (internal.KeyExtractionFuncResult, error) {
+						return internal.KeyExtractionFuncResult{
+							Channels:  make([]string, 0),
+							ReadKeys:  make([]string, 0),
+							WriteKeys: make([]string, 0),
+						}, nil
+					},
+					HandlerFunc: handleAddNode,
+				},
+				{
+					Command:     "removenode",
+					Module:      constants.ClusterModule,
+					Categories:  []string{constants.AdminCategory, constants.SlowCategory, constants.DangerousCategory},
+					Description: "(CLUSTER REMOVENODE node-id) Removes the node from the raft configuration of the node's shard.",
+					Sync:        false,
+					KeyExtractionFunc: func(cmd []string) (internal.KeyExtractionFuncResult, error) {
+						return internal.KeyExtractionFuncResult{
+							Channels:  make([]string, 0),
+							ReadKeys:  make([]string, 0),
+							WriteKeys: make([]string, 0),
+						}, nil
+					},
+					HandlerFunc: handleRemoveNode,
+				},
+				{
+					Command:    "promote",
+					Module:     constants.ClusterModule,
+					Categories: []string{constants.AdminCategory, constants.SlowCategory, constants.DangerousCategory},
+					Description: `(CLUSTER PROMOTE node-id) Turns the non-voting replica into a voter of the node's shard.
+The node starts counting towards the quorum and can become the leader.`,
+					Sync: false,
+					KeyExtractionFunc: func(cmd []string) (internal.KeyExtractionFuncResult, error) {
+						return internal.KeyExtractionFuncResult{
+							Channels:  make([]string, 0),
+							ReadKeys:  make([]string, 0),
+							WriteKeys: make([]string, 0),
+						}, nil
+					},
+					HandlerFunc: handlePromote,
+				},
+				{
+					Command:    "demote",
+					Module:     constants.ClusterModule,
+					Categories: []string{constants.AdminCategory, constants.SlowCategory, constants.DangerousCategory},
+					Description: `(CLUSTER DEMOTE node-id) Turns the voter into a non-voting replica of the node's shard.
+The replica keeps receiving the writes of the shard and serving reads, but rejects write commands.
+The leader can't be demoted, its leadership has to be transferred with CLUSTER FAILOVER first.`,
+					Sync: false,
+					KeyExtractionFunc: func(cmd []string) (internal.KeyExtractionFuncResult, error) {
+						return internal.KeyExtractionFuncResult{
+							Channels:  make([]string, 0),
+							ReadKeys:  make([]string, 0),
+							WriteKeys: make([]string, 0),
+						}, nil
+					},
+					HandlerFunc: handleDemote,
+				},
+				{
+					Command:     "keyslot",
+					Module:      constants.ClusterModule,
+					Categories:  []string{constants.SlowCategory},
+					Description: "(CLUSTER KEYSLOT key) Returns the hash slot of the key.",
+					Sync:        false,
+					KeyExtractionFunc: func(cmd []string) (internal.KeyExtractionFuncResult, error) {
+						return internal.KeyExtractionFuncResult{
+							Channels:  make([]string, 0),
+							ReadKeys:  make([]string, 0),
+							WriteKeys: make([]string, 0),
+						}, nil
+					},
+					HandlerFunc: handleKeySlot,
+				},
+				{
+					Command:     "countkeysinslot",
+					Module:      constants.ClusterModule,
+					Categories:  []string{constants.SlowCategory},
+					Description: "(CLUSTER COUNTKEYSINSLOT slot) Returns the number of keys in the hash slot on this node.",
+					Sync:        false,
+					KeyExtractionFunc: func(cmd []string) (internal.KeyExtractionFuncResult, error) {
+						return internal.KeyExtractionFuncResult{
+							Channels:  make([]string, 0),
+							ReadKeys:  make([]string, 0),
+							WriteKeys: make([]string, 0),
+						}, nil
+					},
+					HandlerFunc: handleCountKeysInSlot,
+				},
+				{
+					Command:     "getkeysinslot",
+					Module:      constants.ClusterModule,
+					Categories:  []string{constants.SlowCategory},
+					Description: "(CLUSTER GETKEYSINSLOT slot count) Returns up to count keys of the hash slot on this node.",
+					Sync:        false,
+					KeyExtractionFunc: func(cmd []string) (internal.KeyExtractionFuncResult, error) {
+						return internal.KeyExtractionFuncResult{
+							Channels:  make([]string, 0),
+							ReadKeys:  make([]string, 0),
+							WriteKeys: make([]string, 0),
+						}, nil
+					},
+					HandlerFunc: handleGetKeysInSlot,
+				},
+				{
+					Command:    "setslot",
+					Module:     constants.ClusterModule,
+					Categories: []string{constants.AdminCategory, constants.SlowCategory, constants.DangerousCategory},
+					Description: `(CLUSTER SETSLOT slot|range IMPORTING shard-id | MIGRATING shard-id | NODE shard-id | STABLE)
+Changes the state of the slots in the node's shard. The shard can be identified by its id or by the id of one of its nodes.
+IMPORTING - The slots are being imported from the shard. Commands preceded by ASKING are accepted for the slots.
+MIGRATING - The slots are being migrated to the shard. Clients are redirected with ASK for the keys that have been moved.
+NODE - Assigns the slots to the shard. Must be sent to the destination shard first, then to the source shard.
+STABLE - Clears the IMPORTING and MIGRATING states of the slots.
+Must be sent to the leader of the shard.`,
+					Sync: false,
+					KeyExtractionFunc: func(cmd []string) (internal.KeyExtractionFuncResult, error) {
+						return internal.KeyExtractionFuncResult{
+							Channels:  make([]string, 0),
+							ReadKeys:  make([]string, 0),
+							WriteKeys: make([]string, 0),
+						}, nil
+					},
+					HandlerFunc: handleSetSlot,
+				},
+				{
+					Command:    "rebalance",
+					Module:     constants.ClusterModule,
+					Categories: []string{constants.AdminCategory, constants.SlowCategory, constants.DangerousCategory},
+					Description: `(CLUSTER REBALANCE [BATCH count] [TIMEOUT milliseconds] [AUTH password | AUTH2 username password])
+Moves slots between the shards of the cluster until each shard serves the same number of slots, and returns the number
+of slots moved. The keys of each slot are moved online with MIGRATE, count keys at a time (100 by default).
+TIMEOUT - The timeout of each round trip with the other nodes (5000 by default).
+AUTH - Authenticate with the other nodes with the password.
+AUTH2 - Authenticate with the other nodes with the username and password.`,
+					Sync: false,
+					KeyExtractionFunc: func(cmd []string) (internal.KeyExtractionFuncResult, error) {
+						return internal.KeyExtractionFuncResult{
+							Channels:  make([]string, 0),
+							ReadKeys:  make([]string, 0),
+							WriteKeys: make([]string, 0),
+						}, nil
+					},
+					HandlerFunc: handleRebalance,
+				},
+			},
+		},
+		{
+			Command:    "role",
+			Module:     constants.ClusterModule,
+			Categories: []string{constants.AdminCategory, constants.FastCategory, constants.DangerousCategory},
+			Description: `(ROLE) Returns the replication role of the node. The leader of a shard and a standalone node
+are masters, and the followers of a shard are slaves.`,
+			Sync: false,
+			KeyExtractionFunc: func(cmd []string) (internal.KeyExtractionFuncResult, error) {
+				return internal.KeyExtractionFuncResult{
+					Channels:  make([]string, 0),
+					ReadKeys:  make([]string, 0),
+					WriteKeys: make([]string, 0),
+				}, nil
+			},
+			HandlerFunc: handleRole,
+		},
+		{
+			Command:    "replicaof",
+			Module:     constants.ClusterModule,
+			Categories: []string{constants.AdminCategory, constants.SlowCategory, constants.DangerousCategory},
+			Description: `(REPLICAOF host port | NO ONE) Makes a standalone node an asynchronous replica of the primary
+at host and port. The replica loads a copy of the primary's dataset, then applies the primary's writes as they happen,
+and rejects write commands. REPLICAOF NO ONE stops the replication and turns the replica into a primary
+that keeps its dataset.`,
+			Sync: false,
+			KeyExtractionFunc: func(cmd []string) (internal.KeyExtractionFuncResult, error) {
+				return internal.KeyExtractionFuncResult{
+					Channels:  make([]string, 0),
+					ReadKeys:  make([]string, 0),
+					WriteKeys: make([]string, 0),
+				}, nil
+			},
+			HandlerFunc: handleReplicaOf,
+		},
+		{
+			Command:    "psync",
+			Module:     constants.ClusterModule,
+			Categories: []string{constants.AdminCategory, constants.SlowCategory, constants.DangerousCategory},
+			Description: `(PSYNC replicationid offset) Sent by a replica to start receiving the replication stream.
+The primary continues from the offset when the replication id matches its stream and the offset is still in its backlog.
+Otherwise, it sends a copy of its dataset first. Use "?" and -1 to request a full resynchronization.`,
+			Sync: false,
+			KeyExtractionFunc: func(cmd []string) (internal.KeyExtractionFuncResult, error) {
+				return internal.KeyExtractionFuncResult{
+					Channels:  make([]string, 0),
+					ReadKeys:  make([]string, 0),
+					WriteKeys: make([]string, 0),
+				}, nil
+			},
+			HandlerFunc: handlePSync,
+		},
+		{
+			Command:    "replconf",
+			Module:     constants.ClusterModule,
+			Categories: []string{constants.AdminCategory, constants.FastCategory, constants.DangerousCategory},
+			Description: `(REPLCONF option value [option value ...]) Sent by a replica to configure its replication link.
+"listening-port" announces the port the replica listens on, and "ack" acknowledges the offset the replica has applied.`,
+			Sync: false,
+			KeyExtractionFunc: func(cmd []string) (internal.KeyExtractionFuncResult, error) {
+				return internal.KeyExtractionFuncResult{
+					Channels:  make([]string, 0),
+					ReadKeys:  make([]string, 0),
+					WriteKeys: make([]string, 0),
+				}, nil
+			},
+			HandlerFunc: handleReplConf,
+		},
+		{
+			Command:    "asking",
+			Module:     constants.ClusterModule,
+			Categories: []string{constants.FastCategory, constants.ConnectionCategory},
+			Description: `(ASKING) Allows the next command of the connection to access a slot
+that is being imported by the node's shard. Sent by cluster clients after an ASK redirection.`,
+			Sync: false,
+			KeyExtractionFunc: func(cmd []string) (internal.KeyExtractionFuncResult, error) {
+				return internal.KeyExtractionFuncResult{
+					Channels:  make([]string, 0),
+					ReadKeys:  make([]string, 0),
+					WriteKeys: make([]string, 0),
+				}, nil
+			},
+			HandlerFunc: handleAsking,
+		},
+	}
+}
@@ -0,0 +1,243 @@
+// Copyright 2024 Kelvin Clement Mwinuka
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/echovault/sugardb/internal"
+	"github.com/echovault/sugardb/internal/config"
+	"github.com/echovault/sugardb/internal/constants"
+	"github.com/echovault/sugardb/sugardb"
+	"github.com/tidwall/resp"
+)
+
+func setUpServer(port int) (*sugardb.SugarDB, error) {
+	return sugardb.NewSugarDB(
+		sugardb.WithConfig(config.Config{
+			BindAddr:       "localhost",
+			Port:           uint16(port),
+			DataDir:        "",
+			EvictionPolicy: constants.NoEviction,
+		}),
+	)
+}
+
+func Test_Cluster(t *testing.T) {
+	port, err := internal.GetFreePort()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	mockServer, err := setUpServer(port)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	go func() {
+		mockServer.Start()
+	}()
+
+	t.Cleanup(func() {
+		mockServer.ShutDown()
+	})
+
+	conn, err := internal.GetConnection("localhost", port)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+	client := resp.NewConn(conn)
+
+	// The tests run in order on the same connection.
+	tests := []struct {
+		name    string
+		command []string
+		want    string
+		wantErr string
+	}{
+		{
+			name:    "1. Return the slot of a key",
+			command: []string{"CLUSTER", "KEYSLOT", "foo"},
+			want:    "12182",
+		},
+		{
+			name:    "2. Return the slot of the hashtag of a key",
+			command: []string{"CLUSTER", "KEYSLOT", "{foo}.bar"},
+			want:    "12182",
+		},
+		{
+			name:    "3. Set keys in the slot",
+			command: []string{"MSET", "{foo}.1", "a", "{foo}.2", "b", "bar", "c"},
+			want:    "OK",
+		},
+		{
+			name:    "4. Count the keys in the slot",
+			command: []string{"CLUSTER", "COUNTKEYSINSLOT", "12182"},
+			want:    "2",
+		},
+		{
+			name:    "5. Count the keys in an empty slot",
+			command: []string{"CLUSTER", "COUNTKEYSINSLOT", "0"},
+			want:    "0",
+		},
+		{
+			name:    "6. Return error when the slot is out of range",
+			command: []string{"CLUSTER", "COUNTKEYSINSLOT", "16384"},
+			wantErr: "Error invalid slot",
+		},
+		{
+			name:    "7. Return error when KEYSLOT has no key",
+			command: []string{"CLUSTER", "KEYSLOT"},
+			wantErr: "Error " + constants.WrongArgsResponse,
+		},
+		{
+			name:    "8. Return error from CLUSTER SLOTS in standalone mode",
+			command: []string{"CLUSTER", "SLOTS"},
+			wantErr: "Error This instance has cluster support disabled",
+		},
+		{
+			name:    "9. Return error from CLUSTER SHARDS in standalone mode",
+			command: []string{"CLUSTER", "SHARDS"},
+			wantErr: "Error This instance has cluster support disabled",
+		},
+		{
+			name:    "10. Return error from ASKING in standalone mode",
+			command: []string{"ASKING"},
+			wantErr: "Error This instance has cluster support disabled",
+		},
+		{
+			name:    "11. Return the keys in the slot",
+			command: []string{"CLUSTER", "GETKEYSINSLOT", "12182", "10"},
+			want:    "[{foo}.1 {foo}.2]",
+		},
+		{
+			name:    "12. Return up to count keys in the slot",
+			command: []string{"CLUSTER", "GETKEYSINSLOT", "12182", "1"},
+			want:    "[{foo}.1]",
+		},
+		{
+			name:    "13. Return error from GETKEYSINSLOT when the count is negative",
+			command: []string{"CLUSTER", "GETKEYSINSLOT", "12182", "-1"},
+			wantErr: "Error invalid number of keys",
+		},
+		{
+			name:    "14. Return error from SETSLOT when the state is invalid",
+			command: []string{"CLUSTER", "SETSLOT", "0-100", "UNKNOWN"},
+			wantErr: "Error invalid SETSLOT state UNKNOWN",
+		},
+		{
+			name:    "15. Return error from SETSLOT when the slot is out of range",
+			command: []string{"CLUSTER", "SETSLOT", "16384", "STABLE"},
+			wantErr: "Error invalid slot",
+		},
+		{
+			name:    "16. Return error from SETSLOT IMPORTING without a shard",
+			command: []string{"CLUSTER", "SETSLOT", "0", "IMPORTING"},
+			wantErr: "Error " + constants.WrongArgsResponse,
+		},
+		{
+			name:    "17. Return error from SETSLOT in standalone mode",
+			command: []string{"CLUSTER", "SETSLOT", "0", "NODE", "1"},
+			wantErr: "Error This instance has cluster support disabled",
+		},
+		{
+			name:    "18. Return error from REBALANCE when the batch size is invalid",
+			command: []string{"CLUSTER", "REBALANCE", "BATCH", "0"},
+			wantErr: "Error batch size must be a positive integer",
+		},
+		{
+			name:    "19. Return error from REBALANCE in standalone mode",
+			command: []string{"CLUSTER", "REBALANCE"},
+			wantErr: "Error This instance has cluster support disabled",
+		},
+		{
+			name:    "20. Return error from CLUSTER INFO in standalone mode",
+			command: []string{"CLUSTER", "INFO"},
+			wantErr: "Error This instance has cluster support disabled",
+		},
+		{
+			name:    "21. Return error from CLUSTER NODES in standalone mode",
+			command: []string{"CLUSTER", "NODES"},
+			wantErr: "Error This instance has cluster support disabled",
+		},
+		{
+			name:    "22. Return error from CLUSTER FAILOVER in standalone mode",
+			command: []string{"CLUSTER", "FAILOVER"},
+			wantErr: "Error This instance has cluster support disabled",
+		},
+		{
+			name:    "23. Return error from CLUSTER ADDNODE without a raft address",
+			command: []string{"CLUSTER", "ADDNODE", "node-1"},
+			wantErr: "Error " + constants.WrongArgsResponse,
+		},
+		{
+			name:    "24. Return error from CLUSTER FORGET in standalone mode",
+			command: []string{"CLUSTER", "FORGET", "node-1"},
+			wantErr: "Error This instance has cluster support disabled",
+		},
+		{
+			name:    "25. Return master role in standalone mode",
+			command: []string{"ROLE"},
+			want:    "[master 0 []]",
+		},
+		{
+			name:    "26. Return error from CLUSTER PROMOTE in standalone mode",
+			command: []string{"CLUSTER", "PROMOTE", "node-1"},
+			wantErr: "Error This instance has cluster support disabled",
+		},
+		{
+			name:    "27. Return error from CLUSTER DEMOTE without a node id",
+			command: []string{"CLUSTER", "DEMOTE"},
+			wantErr: "Error " + constants.WrongArgsResponse,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			command := make([]resp.Value, len(test.command))
+			for i, c := range test.command {
+				command[i] = resp.StringValue(c)
+			}
+			if err = client.WriteArray(command); err != nil {
+				t.Error(err)
+				return
+			}
+
+			res, _, err := client.ReadValue()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+
+			if test.wantErr != "" {
+				if res.Error() == nil || !strings.Contains(res.Error().Error(), test.wantErr) {
+					t.Errorf("expected error \"%s\", got \"%v\"", test.wantErr, res)
+				}
+				return
+			}
+
+			if res.String() != test.want {
+				t.Errorf("expected response \"%s\", got \"%s\"", test.want, res.String())
+			}
+		})
+	}
+}
@@ -20,6 +20,7 @@ import (
 	"github.com/echovault/sugardb/internal/modules/acl"
 	"slices"
 	"strconv"
+	"strings"
 
 	"github.com/echovault/sugardb/internal"
 	"github.com/echovault/sugardb/internal/constants"
@@ -171,6 +172,46 @@ func handleSwapDB(params internal.HandlerFuncParams) ([]byte, error) {
 	return []byte(constants.OkResponse), nil
 }
 
+func handleReadConsistency(params internal.HandlerFuncParams) ([]byte, error) {
+	switch len(params.Command) {
+	default:
+		return nil, errors.New(constants.WrongArgsResponse)
+	case 1:
+		consistency := params.GetConnectionInfo(params.Connection).ReadConsistency
+		return []byte(fmt.Sprintf("$%d\r\n%s\r\n", len(consistency), consistency)), nil
+	case 2:
+		consistency := strings.ToLower(params.Command[1])
+		if !slices.Contains([]string{
+			constants.ReadConsistencyLinearizable,
+			constants.ReadConsistencyLease,
+			constants.ReadConsistencyStale,
+		}, consistency) {
+			return nil, errors.New("read consistency must be one of LINEARIZABLE, LEASE or STALE")
+		}
+		params.SetReadConsistency(params.Connection, consistency)
+		return []byte(constants.OkResponse), nil
+	}
+}
+
+func handleClientList(params internal.HandlerFuncParams) ([]byte, error) {
+	if len(params.Command) != 2 {
+		return nil, errors.New(constants.WrongArgsResponse)
+	}
+
+	now := params.GetClock().Now()
+	var res strings.Builder
+	for _, client := range params.ListClients() {
+		res.WriteString(fmt.Sprintf(
+			"id=%d addr=%s laddr=%s name=%s age=%d idle=%d db=%d sub=%d user=%s resp=%d cmd=%s\n",
+			client.Id, client.Addr, client.LocalAddr, client.Name,
+			int64(now.Sub(client.Created).Seconds()), int64(now.Sub(client.LastCommandAt).Seconds()),
+			client.Database, client.Subscriptions, client.User, client.Protocol, client.LastCommand,
+		))
+	}
+
+	return []byte(fmt.Sprintf("$%d\r\n%s\r\n", res.Len(), res.String())), nil
+}
+
 func Commands() []internal.Command {
 	return []internal.Command{
 		{
@@ -277,5 +318,57 @@ and the other way around.`,
 			},
 			HandlerFunc: handleSwapDB,
 		},
+		{
+			Command:    "readconsistency",
+			Module:     constants.ConnectionModule,
+			Categories: []string{constants.FastCategory, constants.ConnectionCategory},
+			Description: `(READCONSISTENCY [LINEARIZABLE | LEASE | STALE])
+Set the consistency of the reads served to the current connection in cluster mode.
+STALE reads the node's local state. LEASE waits until the node has caught up with the leader's applied state.
+LINEARIZABLE also waits for the leader to confirm its leadership with the quorum.
+When no level is provided, the current level is returned.`,
+			Sync: false,
+			KeyExtractionFunc: func(cmd []string) (internal.KeyExtractionFuncResult, error) {
+				return internal.KeyExtractionFuncResult{
+					Channels:  make([]string, 0),
+					ReadKeys:  make([]string, 0),
+					WriteKeys: make([]string, 0),
+				}, nil
+			},
+			HandlerFunc: handleReadConsistency,
+		},
+		{
+			Command:     "client",
+			Module:      constants.ConnectionModule,
+			Categories:  []string{},
+			Description: "Commands pertaining to the client connections",
+			Sync:        false,
+			KeyExtractionFunc: func(cmd []string) (internal.KeyExtractionFuncResult, error) {
+				return internal.KeyExtractionFuncResult{
+					Channels: make([]string, 0), ReadKeys: make([]string, 0), WriteKeys: make([]string, 0),
+				}, nil
+			},
+			SubCommands: []internal.SubCommand{
+				{
+					Command: "list",
+					Module:  constants.ConnectionModule,
+					Categories: []string{
+						constants.AdminCategory,
+						constants.SlowCategory,
+						constants.DangerousCategory,
+						constants.ConnectionCategory,
+					},
+					Description: `(CLIENT LIST) Get the list of the TCP clients connected to the server, 
+with the address, name, age, idle time, database, subscriptions, user, protocol and latest command of each client.`,
+					Sync: false,
+					KeyExtractionFunc: func(cmd []string) (internal.KeyExtractionFuncResult, error) {
+						return internal.KeyExtractionFuncResult{
+							Channels: make([]string, 0), ReadKeys: make([]string, 0), WriteKeys: make([]string, 0),
+						}, nil
+					},
+					HandlerFunc: handleClientList,
+				},
+			},
+		},
 	}
 }
@@ -997,4 +997,109 @@ func Test_Connection(t *testing.T) {
 			}
 		}
 	})
+
+	t.Run("Test_HandleReadConsistency", func(t *testing.T) {
+		t.Parallel()
+
+		port, err := internal.GetFreePort()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		mockServer, err := setUpServer(port, false, "")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		go func() {
+			mockServer.Start()
+		}()
+		t.Cleanup(func() {
+			mockServer.ShutDown()
+		})
+
+		conn, err := internal.GetConnection("localhost", port)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer func() {
+			_ = conn.Close()
+		}()
+		client := resp.NewConn(conn)
+
+		// The tests run in order on the same connection.
+		tests := []struct {
+			name    string
+			command []string
+			want    string
+			wantErr error
+		}{
+			{
+				name:    "1. Return the default read consistency",
+				command: []string{"READCONSISTENCY"},
+				want:    "stale",
+			},
+			{
+				name:    "2. Set linearizable read consistency",
+				command: []string{"READCONSISTENCY", "LINEARIZABLE"},
+				want:    "OK",
+			},
+			{
+				name:    "3. Return the read consistency set on the connection",
+				command: []string{"READCONSISTENCY"},
+				want:    "linearizable",
+			},
+			{
+				name:    "4. Set lease read consistency",
+				command: []string{"READCONSISTENCY", "lease"},
+				want:    "OK",
+			},
+			{
+				name:    "5. Reads are served in standalone mode",
+				command: []string{"GET", "key1"},
+				want:    "",
+			},
+			{
+				name:    "6. Return error when the read consistency is not supported",
+				command: []string{"READCONSISTENCY", "eventual"},
+				wantErr: errors.New("read consistency must be one of LINEARIZABLE, LEASE or STALE"),
+			},
+			{
+				name:    "7. Command too long",
+				command: []string{"READCONSISTENCY", "lease", "stale"},
+				wantErr: errors.New(constants.WrongArgsResponse),
+			},
+			{
+				name:    "8. Failed set does not change the read consistency",
+				command: []string{"READCONSISTENCY"},
+				want:    "lease",
+			},
+		}
+
+		for _, test := range tests {
+			command := make([]resp.Value, len(test.command))
+			for i, arg := range test.command {
+				command[i] = resp.StringValue(arg)
+			}
+			if err = client.WriteArray(command); err != nil {
+				t.Error(err)
+				return
+			}
+			res, _, err := client.ReadValue()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if test.wantErr != nil {
+				if !strings.Contains(res.Error().Error(), test.wantErr.Error()) {
+					t.Errorf("%s: expected error \"%s\", got \"%s\"", test.name, test.wantErr.Error(), res.Error().Error())
+				}
+				continue
+			}
+			if res.String() != test.want {
+				t.Errorf("%s: expected response \"%s\", got \"%s\"", test.name, test.want, res.String())
+			}
+		}
+	})
 }
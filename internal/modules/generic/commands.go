@@ -18,13 +18,17 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"net"
 	"reflect"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/echovault/sugardb/internal"
 	"github.com/echovault/sugardb/internal/constants"
+	"github.com/echovault/sugardb/internal/dump"
+	"github.com/echovault/sugardb/internal/migrate"
 )
 
 type KeyObject struct {
@@ -869,6 +873,144 @@ func handleObjIdleTime(params internal.HandlerFuncParams) ([]byte, error) {
 	return []byte(fmt.Sprintf("+%v\r\n", idletime)), nil
 }
 
+func handleDump(params internal.HandlerFuncParams) ([]byte, error) {
+	keys, err := dumpKeyFunc(params.Command)
+	if err != nil {
+		return nil, err
+	}
+	key := keys.ReadKeys[0]
+
+	if !params.KeysExist(params.Context, []string{key})[key] {
+		return []byte("$-1\r\n"), nil
+	}
+
+	payload, err := dump.Encode(params.GetValues(params.Context, []string{key})[key])
+	if err != nil {
+		return nil, err
+	}
+
+	return []byte(fmt.Sprintf("$%d\r\n%s\r\n", len(payload), payload)), nil
+}
+
+func handleRestore(params internal.HandlerFuncParams) ([]byte, error) {
+	keys, err := restoreKeyFunc(params.Command)
+	if err != nil {
+		return nil, err
+	}
+	key := keys.WriteKeys[0]
+
+	ttl, err := strconv.ParseInt(params.Command[2], 10, 64)
+	if err != nil || ttl < 0 {
+		return nil, errors.New("invalid TTL value, must be >= 0")
+	}
+
+	options, err := getRestoreCommandOptions(params.Command[4:])
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := dump.Decode([]byte(params.Command[3]))
+	if err != nil {
+		return nil, err
+	}
+
+	if params.KeysExist(params.Context, []string{key})[key] {
+		if !options.replace {
+			return nil, errors.New("BUSYKEY Target key name already exists.")
+		}
+		// Delete the key first so that the restored key does not inherit its expiry time.
+		if err = params.DeleteKey(params.Context, key); err != nil {
+			return nil, err
+		}
+	}
+
+	var expireAt time.Time
+	if ttl > 0 {
+		if options.absTTL {
+			expireAt = time.UnixMilli(ttl)
+		} else {
+			expireAt = params.GetClock().Now().Add(time.Duration(ttl) * time.Millisecond)
+		}
+		// A key whose absolute expiry time has already passed is not restored.
+		if !expireAt.After(params.GetClock().Now()) {
+			return []byte(constants.OkResponse), nil
+		}
+	}
+
+	if err = params.SetValues(params.Context, map[string]interface{}{key: value}); err != nil {
+		return nil, err
+	}
+	if !expireAt.IsZero() {
+		params.SetExpiry(params.Context, key, expireAt, false)
+	}
+
+	return []byte(constants.OkResponse), nil
+}
+
+func handleMigrate(params internal.HandlerFuncParams) ([]byte, error) {
+	options, err := getMigrateCommandOptions(params.Command)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	exists := params.KeysExist(params.Context, options.keys)
+	for _, key := range options.keys {
+		if exists[key] && !slices.Contains(keys, key) {
+			keys = append(keys, key)
+		}
+	}
+
+	values := params.GetValues(params.Context, keys)
+	var entries []migrate.Entry
+	for _, key := range keys {
+		if values[key] == nil {
+			continue
+		}
+		payload, err := dump.Encode(values[key])
+		if err != nil {
+			return nil, err
+		}
+		var ttl time.Duration
+		if expireAt := params.GetExpiry(params.Context, key); !expireAt.IsZero() {
+			if ttl = expireAt.Sub(params.GetClock().Now()); ttl <= 0 {
+				continue
+			}
+		}
+		entries = append(entries, migrate.Entry{Key: key, Payload: payload, TTL: ttl})
+	}
+
+	if len(entries) == 0 {
+		return []byte("+NOKEY\r\n"), nil
+	}
+
+	if err = migrate.Send(params.Context, migrate.Options{
+		Addr:     net.JoinHostPort(options.host, options.port),
+		Database: options.database,
+		Timeout:  options.timeout,
+		Replace:  options.replace,
+		Auth:     options.auth,
+	}, entries); err != nil {
+		var replyErr *migrate.ReplyError
+		if errors.As(err, &replyErr) {
+			return nil, fmt.Errorf("Target instance replied with error: %v", err)
+		}
+		return nil, fmt.Errorf("IOERR error or timeout migrating to target instance: %v", err)
+	}
+
+	if !options.copy {
+		cmd := []string{"DEL"}
+		for _, entry := range entries {
+			cmd = append(cmd, entry.Key)
+		}
+		if _, err = params.ApplyCommand(params.Context, cmd); err != nil {
+			return nil, err
+		}
+	}
+
+	return []byte(constants.OkResponse), nil
+}
+
 func Commands() []internal.Command {
 	return []internal.Command{
 		{
@@ -1209,5 +1351,57 @@ The command is only available when the maxmemory-policy configuration directive
 			KeyExtractionFunc: objIdleTimeKeyFunc,
 			HandlerFunc:       handleObjIdleTime,
 		},
+		{
+			Command:    "dump",
+			Module:     constants.GenericModule,
+			Categories: []string{constants.KeyspaceCategory, constants.ReadCategory, constants.SlowCategory},
+			Description: `(DUMP key) Serialize the value stored at key and return it.
+The payload can be stored back into a key with RESTORE. Returns nil if the key does not exist.`,
+			Sync:              false,
+			KeyExtractionFunc: dumpKeyFunc,
+			HandlerFunc:       handleDump,
+		},
+		{
+			Command:    "restore",
+			Module:     constants.GenericModule,
+			Categories: []string{constants.KeyspaceCategory, constants.WriteCategory, constants.SlowCategory, constants.DangerousCategory},
+			Description: `(RESTORE key ttl serialized-value [REPLACE] [ABSTTL])
+Create a key from a payload returned by DUMP. If ttl is 0, the key is created without an expiry,
+otherwise the key expires after ttl milliseconds.
+REPLACE - Replace the key if it already exists. Without it, an error is returned when the key exists.
+ABSTTL - The ttl is an absolute unix time in milliseconds.`,
+			Sync:              true,
+			KeyExtractionFunc: restoreKeyFunc,
+			HandlerFunc:       handleRestore,
+		},
+		{
+			Command:    "restore-asking",
+			Module:     constants.GenericModule,
+			Categories: []string{constants.KeyspaceCategory, constants.WriteCategory, constants.SlowCategory, constants.DangerousCategory},
+			Description: `(RESTORE-ASKING key ttl serialized-value [REPLACE] [ABSTTL])
+Same as RESTORE, but implies ASKING so that the keys of a slot that is being imported are accepted.
+Used by MIGRATE.`,
+			Sync:              true,
+			KeyExtractionFunc: restoreKeyFunc,
+			HandlerFunc:       handleRestore,
+		},
+		{
+			Command:    "migrate",
+			Module:     constants.GenericModule,
+			Categories: []string{constants.KeyspaceCategory, constants.SlowCategory, constants.DangerousCategory},
+			Description: `(MIGRATE host port key|"" destination-db timeout [COPY] [REPLACE]
+[AUTH password | AUTH2 username password] [KEYS key [key ...]])
+Transfer keys to the destination instance. The keys are deleted from this instance
+once the destination has stored them. The transfer is not atomic: the writes to the keys during the
+transfer are lost. Returns NOKEY when none of the keys exist.
+COPY - Do not delete the keys from this instance.
+REPLACE - Replace the keys that already exist on the destination instance.
+AUTH - Authenticate with the destination instance with the password.
+AUTH2 - Authenticate with the destination instance with the username and password.
+KEYS - Transfer multiple keys. The key argument must be an empty string.`,
+			Sync:              false,
+			KeyExtractionFunc: migrateKeyFunc,
+			HandlerFunc:       handleMigrate,
+		},
 	}
 }
@@ -17,6 +17,7 @@ package generic_test
 import (
 	"errors"
 	"fmt"
+	"slices"
 	"strconv"
 	"strings"
 	"testing"
@@ -3332,6 +3333,118 @@ func Test_Generic(t *testing.T) {
 			})
 		}
 	})
+
+	t.Run("Test_HandleDUMP_RESTORE", func(t *testing.T) {
+		t.Parallel()
+		conn, err := internal.GetConnection("localhost", port)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer func() {
+			_ = conn.Close()
+		}()
+		client := resp.NewConn(conn)
+
+		do := func(command ...string) resp.Value {
+			values := make([]resp.Value, len(command))
+			for i, c := range command {
+				values[i] = resp.StringValue(c)
+			}
+			if err := client.WriteArray(values); err != nil {
+				t.Fatal(err)
+			}
+			res, _, err := client.ReadValue()
+			if err != nil {
+				t.Fatal(err)
+			}
+			return res
+		}
+
+		for _, command := range [][]string{
+			{"SET", "DumpKey1", "value1"},
+			{"SADD", "DumpKey2", "a", "b", "c"},
+			{"ZADD", "DumpKey3", "1.5", "a", "2", "b"},
+			{"HSET", "DumpKey4", "field1", "value1", "field2", "2"},
+			{"LPUSH", "DumpKey5", "a", "b"},
+		} {
+			if res := do(command...); res.Error() != nil {
+				t.Fatalf("preset %v: %v", command, res.Error())
+			}
+		}
+
+		tests := []struct {
+			name     string
+			key      string
+			restored string
+			verify   []string
+			want     string
+		}{
+			{name: "1. Restore a string", key: "DumpKey1", restored: "RestoredKey1", verify: []string{"GET", "RestoredKey1"}, want: "value1"},
+			{name: "2. Restore a set", key: "DumpKey2", restored: "RestoredKey2", verify: []string{"SCARD", "RestoredKey2"}, want: "3"},
+			{name: "3. Restore a sorted set", key: "DumpKey3", restored: "RestoredKey3", verify: []string{"ZSCORE", "RestoredKey3", "a"}, want: "1.5"},
+			{name: "4. Restore a hash", key: "DumpKey4", restored: "RestoredKey4", verify: []string{"HLEN", "RestoredKey4"}, want: "2"},
+			{name: "5. Restore a list", key: "DumpKey5", restored: "RestoredKey5", verify: []string{"LLEN", "RestoredKey5"}, want: "2"},
+		}
+		for _, test := range tests {
+			t.Run(test.name, func(t *testing.T) {
+				payload := do("DUMP", test.key)
+				if payload.Error() != nil || payload.IsNull() {
+					t.Fatalf("expected payload, got %v", payload)
+				}
+				if res := do("RESTORE", test.restored, "0", payload.String()); res.String() != "OK" {
+					t.Fatalf("expected OK, got %v", res)
+				}
+				if res := do(test.verify...); res.String() != test.want {
+					t.Errorf("expected %s, got %v", test.want, res)
+				}
+				if res := do("TYPE", test.restored); res.String() != do("TYPE", test.key).String() {
+					t.Errorf("expected type %s, got %v", do("TYPE", test.key).String(), res)
+				}
+			})
+		}
+
+		t.Run("6. Return nil when dumping a key that does not exist", func(t *testing.T) {
+			if res := do("DUMP", "DumpKeyMissing"); !res.IsNull() {
+				t.Errorf("expected nil, got %v", res)
+			}
+		})
+
+		t.Run("7. Return error when restoring an existing key without REPLACE", func(t *testing.T) {
+			payload := do("DUMP", "DumpKey1").String()
+			if res := do("RESTORE", "DumpKey1", "0", payload); res.Error() == nil ||
+				!strings.Contains(res.Error().Error(), "BUSYKEY") {
+				t.Errorf("expected BUSYKEY error, got %v", res)
+			}
+		})
+
+		t.Run("8. Replace an existing key and set its ttl", func(t *testing.T) {
+			payload := do("DUMP", "DumpKey1").String()
+			if res := do("RESTORE", "DumpKey5", "100000", payload, "REPLACE"); res.String() != "OK" {
+				t.Fatalf("expected OK, got %v", res)
+			}
+			if res := do("GET", "DumpKey5"); res.String() != "value1" {
+				t.Errorf("expected value1, got %v", res)
+			}
+			if res := do("TTL", "DumpKey5"); res.Integer() <= 0 {
+				t.Errorf("expected positive ttl, got %v", res)
+			}
+		})
+
+		t.Run("9. Return error when the payload is invalid", func(t *testing.T) {
+			if res := do("RESTORE", "RestoredKey6", "0", "invalid payload"); res.Error() == nil ||
+				!strings.Contains(res.Error().Error(), "DUMP payload version or checksum are wrong") {
+				t.Errorf("expected invalid payload error, got %v", res)
+			}
+		})
+
+		t.Run("10. Return error when the ttl is negative", func(t *testing.T) {
+			payload := do("DUMP", "DumpKey1").String()
+			if res := do("RESTORE", "RestoredKey7", "-1", payload); res.Error() == nil {
+				t.Errorf("expected error, got %v", res)
+			}
+		})
+	})
 }
 
 // Certain commands will need to be tested in a server with an eviction policy.
@@ -3690,3 +3803,210 @@ func Test_LRU_Generic(t *testing.T) {
 	})
 
 }
+
+// Testing MIGRATE between two servers.
+func Test_Migrate(t *testing.T) {
+	var ports []int
+	for _, password := range []string{"", "password1"} {
+		port, err := internal.GetFreePort()
+		if err != nil {
+			t.Fatal(err)
+		}
+		conf := config.Config{
+			BindAddr:       "localhost",
+			Port:           uint16(port),
+			DataDir:        "",
+			EvictionPolicy: constants.NoEviction,
+		}
+		if password != "" {
+			conf.RequirePass = true
+			conf.Password = password
+		}
+		server, err := sugardb.NewSugarDB(sugardb.WithConfig(conf))
+		if err != nil {
+			t.Fatal(err)
+		}
+		go func() {
+			server.Start()
+		}()
+		t.Cleanup(func() {
+			server.ShutDown()
+		})
+		ports = append(ports, port)
+	}
+
+	connect := func(port int, auth ...string) func(command ...string) resp.Value {
+		conn, err := internal.GetConnection("localhost", port)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			_ = conn.Close()
+		})
+		client := resp.NewConn(conn)
+		do := func(command ...string) resp.Value {
+			values := make([]resp.Value, len(command))
+			for i, c := range command {
+				values[i] = resp.StringValue(c)
+			}
+			if err := client.WriteArray(values); err != nil {
+				t.Fatal(err)
+			}
+			res, _, err := client.ReadValue()
+			if err != nil {
+				t.Fatal(err)
+			}
+			return res
+		}
+		if len(auth) > 0 {
+			if res := do(append([]string{"AUTH"}, auth...)...); res.String() != "OK" {
+				t.Fatalf("auth: %v", res)
+			}
+		}
+		return do
+	}
+	// A key exists when it can be dumped.
+	exists := func(do func(command ...string) resp.Value, key string) bool {
+		return !do("DUMP", key).IsNull()
+	}
+
+	source := connect(ports[0])
+	target := connect(ports[1], "password1")
+	targetPort := strconv.Itoa(ports[1])
+
+	for _, command := range [][]string{
+		{"SET", "MigrateKey1", "value1"},
+		{"SET", "MigrateKey2", "value2", "PX", "100000"},
+		{"SADD", "MigrateKey3", "a", "b"},
+		{"SET", "MigrateKey4", "value4"},
+		{"SET", "MigrateKey5", "value5"},
+	} {
+		if res := source(command...); res.Error() != nil {
+			t.Fatalf("preset %v: %v", command, res.Error())
+		}
+	}
+
+	tests := []struct {
+		name          string
+		command       []string
+		want          string
+		wantErr       string
+		sourceKeys    []string // Keys that are expected on the source after the command.
+		targetKeys    []string // Keys that are expected on the target after the command.
+		targetMissing []string // Keys that are not expected on the target after the command.
+	}{
+		{
+			name:       "1. Migrate a single key",
+			command:    []string{"MIGRATE", "localhost", targetPort, "MigrateKey1", "0", "1000", "AUTH", "password1"},
+			want:       "OK",
+			targetKeys: []string{"MigrateKey1"},
+		},
+		{
+			name:       "2. Migrate multiple keys with KEYS",
+			command:    []string{"MIGRATE", "localhost", targetPort, "", "0", "1000", "AUTH", "password1", "KEYS", "MigrateKey2", "MigrateKey3"},
+			want:       "OK",
+			targetKeys: []string{"MigrateKey2", "MigrateKey3"},
+		},
+		{
+			name:       "3. Keep the keys on the source with COPY",
+			command:    []string{"MIGRATE", "localhost", targetPort, "MigrateKey4", "0", "1000", "COPY", "AUTH", "password1"},
+			want:       "OK",
+			sourceKeys: []string{"MigrateKey4"},
+			targetKeys: []string{"MigrateKey4"},
+		},
+		{
+			name:       "4. Return error when the key exists on the target without REPLACE",
+			command:    []string{"MIGRATE", "localhost", targetPort, "MigrateKey4", "0", "1000", "AUTH", "password1"},
+			wantErr:    "BUSYKEY",
+			sourceKeys: []string{"MigrateKey4"},
+		},
+		{
+			name:       "5. Replace the key on the target with REPLACE",
+			command:    []string{"MIGRATE", "localhost", targetPort, "MigrateKey4", "0", "1000", "REPLACE", "AUTH2", "default", "password1"},
+			want:       "OK",
+			targetKeys: []string{"MigrateKey4"},
+		},
+		{
+			name:          "6. Migrate to another database",
+			command:       []string{"MIGRATE", "localhost", targetPort, "MigrateKey5", "1", "1000", "AUTH", "password1"},
+			want:          "OK",
+			targetMissing: []string{"MigrateKey5"},
+		},
+		{
+			name:    "7. Return NOKEY when no key exists",
+			command: []string{"MIGRATE", "localhost", targetPort, "", "0", "1000", "KEYS", "MigrateKeyMissing"},
+			want:    "NOKEY",
+		},
+		{
+			name:       "8. Return error when the target rejects the credentials",
+			command:    []string{"MIGRATE", "localhost", targetPort, "MigrateKeyNew", "0", "1000", "AUTH", "wrong"},
+			wantErr:    "Target instance replied with error",
+			sourceKeys: []string{"MigrateKeyNew"},
+		},
+		{
+			name:    "9. Return error when KEYS is used with a key",
+			command: []string{"MIGRATE", "localhost", targetPort, "MigrateKey1", "0", "1000", "KEYS", "MigrateKey2"},
+			wantErr: "the key argument must be an empty string",
+		},
+		{
+			name:    "10. Return error when the command is too short",
+			command: []string{"MIGRATE", "localhost", targetPort, "MigrateKey1", "0"},
+			wantErr: constants.WrongArgsResponse,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.name == "8. Return error when the target rejects the credentials" {
+				source("SET", "MigrateKeyNew", "value")
+			}
+			res := source(test.command...)
+			if test.wantErr != "" {
+				if res.Error() == nil || !strings.Contains(res.Error().Error(), test.wantErr) {
+					t.Errorf("expected error \"%s\", got \"%v\"", test.wantErr, res)
+				}
+			} else if res.String() != test.want {
+				t.Errorf("expected response \"%s\", got \"%v\"", test.want, res)
+			}
+
+			for _, key := range test.sourceKeys {
+				if !exists(source, key) {
+					t.Errorf("expected key %s on the source", key)
+				}
+			}
+			if test.wantErr == "" && test.want == "OK" && !slices.Contains(test.command, "COPY") {
+				for _, key := range test.targetKeys {
+					if exists(source, key) {
+						t.Errorf("expected key %s to be deleted from the source", key)
+					}
+				}
+			}
+			for _, key := range test.targetKeys {
+				if !exists(target, key) {
+					t.Errorf("expected key %s on the target", key)
+				}
+			}
+			for _, key := range test.targetMissing {
+				if exists(target, key) {
+					t.Errorf("expected key %s not to be in database 0 of the target", key)
+				}
+			}
+		})
+	}
+
+	t.Run("11. Preserve the type and ttl of the migrated keys", func(t *testing.T) {
+		if res := target("SCARD", "MigrateKey3"); res.Integer() != 2 {
+			t.Errorf("expected set with 2 members, got %v", res)
+		}
+		if res := target("PTTL", "MigrateKey2"); res.Integer() <= 0 || res.Integer() > 100000 {
+			t.Errorf("expected ttl of the migrated key, got %v", res)
+		}
+		if res := target("TTL", "MigrateKey1"); res.Integer() != -1 {
+			t.Errorf("expected key without expiry, got %v", res)
+		}
+		target("SELECT", "1")
+		if res := target("GET", "MigrateKey5"); res.String() != "value5" {
+			t.Errorf("expected key in database 1, got %v", res)
+		}
+	})
+}
@@ -18,6 +18,7 @@ import (
 	"errors"
 	"fmt"
 	"github.com/echovault/sugardb/internal/clock"
+	"github.com/echovault/sugardb/internal/constants"
 	"strconv"
 	"strings"
 	"time"
@@ -116,3 +117,92 @@ func getSetCommandOptions(clock clock.Clock, cmd []string, options SetOptions) (
 		return SetOptions{}, fmt.Errorf("unknown option %s for set command", strings.ToUpper(cmd[0]))
 	}
 }
+
+type MigrateOptions struct {
+	host     string
+	port     string
+	database int
+	timeout  time.Duration
+	copy     bool
+	replace  bool
+	auth     []string // A password, or a username and a password.
+	keys     []string
+}
+
+// getMigrateCommandOptions parses MIGRATE host port key|"" destination-db timeout [COPY] [REPLACE]
+// [AUTH password | AUTH2 username password] [KEYS key [key ...]].
+func getMigrateCommandOptions(cmd []string) (MigrateOptions, error) {
+	if len(cmd) < 6 {
+		return MigrateOptions{}, errors.New(constants.WrongArgsResponse)
+	}
+	options := MigrateOptions{host: cmd[1], port: cmd[2]}
+
+	database, err := strconv.Atoi(cmd[4])
+	if err != nil || database < 0 {
+		return MigrateOptions{}, errors.New("destination-db must be a non-negative integer")
+	}
+	options.database = database
+
+	timeout, err := strconv.ParseInt(cmd[5], 10, 64)
+	if err != nil || timeout < 0 {
+		return MigrateOptions{}, errors.New("timeout must be a non-negative integer")
+	}
+	options.timeout = time.Duration(timeout) * time.Millisecond
+
+	for i := 6; i < len(cmd); i++ {
+		switch strings.ToLower(cmd[i]) {
+		case "copy":
+			options.copy = true
+		case "replace":
+			options.replace = true
+		case "auth":
+			if i+1 >= len(cmd) {
+				return MigrateOptions{}, errors.New("password required after AUTH")
+			}
+			options.auth = cmd[i+1 : i+2]
+			i++
+		case "auth2":
+			if i+2 >= len(cmd) {
+				return MigrateOptions{}, errors.New("username and password required after AUTH2")
+			}
+			options.auth = cmd[i+1 : i+3]
+			i += 2
+		case "keys":
+			if cmd[3] != "" {
+				return MigrateOptions{}, errors.New("when using KEYS, the key argument must be an empty string")
+			}
+			options.keys = cmd[i+1:]
+			i = len(cmd)
+		default:
+			return MigrateOptions{}, fmt.Errorf("unknown option %s for migrate command", strings.ToUpper(cmd[i]))
+		}
+	}
+
+	if cmd[3] != "" {
+		options.keys = []string{cmd[3]}
+	}
+	if len(options.keys) == 0 {
+		return MigrateOptions{}, errors.New(constants.WrongArgsResponse)
+	}
+	return options, nil
+}
+
+type RestoreOptions struct {
+	replace bool
+	absTTL  bool
+}
+
+func getRestoreCommandOptions(cmd []string) (RestoreOptions, error) {
+	options := RestoreOptions{}
+	for _, option := range cmd {
+		switch strings.ToLower(option) {
+		case "replace":
+			options.replace = true
+		case "absttl":
+			options.absTTL = true
+		default:
+			return RestoreOptions{}, fmt.Errorf("unknown option %s for restore command", strings.ToUpper(option))
+		}
+	}
+	return options, nil
+}
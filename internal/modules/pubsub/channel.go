@@ -28,6 +28,7 @@ type Channel struct {
 	subscribersRWMut sync.RWMutex             // RWMutex to concurrency control when accessing channel subscribers.
 	subscribers      map[*net.Conn]*resp.Conn // Map containing the channel subscribers.
 	messageChan      *chan string             // Messages published to this channel will be sent to this channel.
+	sharded          bool                     // Whether the channel is a shard channel subscribed to with SSUBSCRIBE.
 }
 
 // WithName option sets the channels name.
@@ -45,6 +46,13 @@ func WithPattern(pattern string) func(channel *Channel) {
 	}
 }
 
+// WithSharded option marks the channel as a shard channel. Its messages are delivered as "smessage".
+func WithSharded() func(channel *Channel) {
+	return func(channel *Channel) {
+		channel.sharded = true
+	}
+}
+
 func NewChannel(options ...func(channel *Channel)) *Channel {
 	messageChan := make(chan string, 4096)
 
@@ -68,12 +76,17 @@ func (ch *Channel) Start() {
 		for {
 			message := <-*ch.messageChan
 
+			kind := "message"
+			if ch.sharded {
+				kind = "smessage"
+			}
+
 			ch.subscribersRWMut.RLock()
 
 			for _, conn := range ch.subscribers {
 				go func(conn *resp.Conn) {
 					if err := conn.WriteArray([]resp.Value{
-						resp.StringValue("message"),
+						resp.StringValue(kind),
 						resp.StringValue(ch.name),
 						resp.StringValue(message),
 					}); err != nil {
@@ -128,6 +141,14 @@ func (ch *Channel) IsActive() bool {
 	return active
 }
 
+// IsSubscribed returns true when the connection is subscribed to the channel.
+func (ch *Channel) IsSubscribed(conn *net.Conn) bool {
+	ch.subscribersRWMut.RLock()
+	defer ch.subscribersRWMut.RUnlock()
+	_, ok := ch.subscribers[conn]
+	return ok
+}
+
 func (ch *Channel) NumSubs() int {
 	ch.subscribersRWMut.RLock()
 	defer ch.subscribersRWMut.RUnlock()
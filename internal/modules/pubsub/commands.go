@@ -62,6 +62,43 @@ func handlePublish(params internal.HandlerFuncParams) ([]byte, error) {
 		return nil, errors.New(constants.WrongArgsResponse)
 	}
 	pubsub.Publish(params.Context, params.Command[2], params.Command[1])
+	// In cluster mode, the subscribers on the other nodes receive the message too.
+	params.PublishToCluster(params.Command[1], params.Command[2], false)
+	return []byte(constants.OkResponse), nil
+}
+
+func handleSSubscribe(params internal.HandlerFuncParams) ([]byte, error) {
+	pubsub, ok := params.GetPubSub().(*PubSub)
+	if !ok {
+		return nil, errors.New("could not load pubsub module")
+	}
+	channels := params.Command[1:]
+	if len(channels) == 0 {
+		return nil, errors.New(constants.WrongArgsResponse)
+	}
+	pubsub.SSubscribe(params.Context, params.Connection, channels)
+	return nil, nil
+}
+
+func handleSUnsubscribe(params internal.HandlerFuncParams) ([]byte, error) {
+	pubsub, ok := params.GetPubSub().(*PubSub)
+	if !ok {
+		return nil, errors.New("could not load pubsub module")
+	}
+	return pubsub.SUnsubscribe(params.Context, params.Connection, params.Command[1:]), nil
+}
+
+func handleSPublish(params internal.HandlerFuncParams) ([]byte, error) {
+	pubsub, ok := params.GetPubSub().(*PubSub)
+	if !ok {
+		return nil, errors.New("could not load pubsub module")
+	}
+	if len(params.Command) != 3 {
+		return nil, errors.New(constants.WrongArgsResponse)
+	}
+	pubsub.SPublish(params.Context, params.Command[2], params.Command[1])
+	// In cluster mode, only the subscribers on the other nodes of the shard receive the message.
+	params.PublishToCluster(params.Command[1], params.Command[2], true)
 	return []byte(constants.OkResponse), nil
 }
 
@@ -100,6 +137,32 @@ func handlePubSubNumSubs(params internal.HandlerFuncParams) ([]byte, error) {
 	return pubsub.NumSub(params.Command[2:]), nil
 }
 
+func handlePubSubShardChannels(params internal.HandlerFuncParams) ([]byte, error) {
+	if len(params.Command) > 3 {
+		return nil, errors.New(constants.WrongArgsResponse)
+	}
+
+	pubsub, ok := params.GetPubSub().(*PubSub)
+	if !ok {
+		return nil, errors.New("could not load pubsub module")
+	}
+
+	pattern := ""
+	if len(params.Command) == 3 {
+		pattern = params.Command[2]
+	}
+
+	return pubsub.ShardChannels(pattern), nil
+}
+
+func handlePubSubShardNumSub(params internal.HandlerFuncParams) ([]byte, error) {
+	pubsub, ok := params.GetPubSub().(*PubSub)
+	if !ok {
+		return nil, errors.New("could not load pubsub module")
+	}
+	return pubsub.ShardNumSub(params.Command[2:]), nil
+}
+
 func Commands() []internal.Command {
 	return []internal.Command{
 		{
@@ -145,7 +208,7 @@ func Commands() []internal.Command {
 			Module:      constants.PubSubModule,
 			Categories:  []string{constants.PubSubCategory, constants.FastCategory},
 			Description: "(PUBLISH channel message) Publish a message to the specified channel.",
-			Sync:        true,
+			Sync:        false,
 			KeyExtractionFunc: func(cmd []string) (internal.KeyExtractionFuncResult, error) {
 				// Treat the channel as a key
 				if len(cmd) != 3 {
@@ -159,6 +222,61 @@ func Commands() []internal.Command {
 			},
 			HandlerFunc: handlePublish,
 		},
+		{
+			Command:     "ssubscribe",
+			Module:      constants.PubSubModule,
+			Categories:  []string{constants.PubSubCategory, constants.ConnectionCategory, constants.SlowCategory},
+			Description: "(SSUBSCRIBE shardchannel [shardchannel ...]) Subscribe to one or more shard channels.",
+			Sync:        false,
+			KeyExtractionFunc: func(cmd []string) (internal.KeyExtractionFuncResult, error) {
+				// Treat the shard channels as keys
+				if len(cmd) < 2 {
+					return internal.KeyExtractionFuncResult{}, errors.New(constants.WrongArgsResponse)
+				}
+				return internal.KeyExtractionFuncResult{
+					Channels:  cmd[1:],
+					ReadKeys:  make([]string, 0),
+					WriteKeys: make([]string, 0),
+				}, nil
+			},
+			HandlerFunc: handleSSubscribe,
+		},
+		{
+			Command:    "sunsubscribe",
+			Module:     constants.PubSubModule,
+			Categories: []string{constants.PubSubCategory, constants.ConnectionCategory, constants.SlowCategory},
+			Description: `(SUNSUBSCRIBE [shardchannel [shardchannel ...]]) Unsubscribe from a list of shard channels.
+If the shard channel list is not provided, then the connection will be unsubscribed from all the shard channels that
+it's currently subscribed to.`,
+			Sync: false,
+			KeyExtractionFunc: func(cmd []string) (internal.KeyExtractionFuncResult, error) {
+				return internal.KeyExtractionFuncResult{
+					Channels:  cmd[1:],
+					ReadKeys:  make([]string, 0),
+					WriteKeys: make([]string, 0),
+				}, nil
+			},
+			HandlerFunc: handleSUnsubscribe,
+		},
+		{
+			Command:    "spublish",
+			Module:     constants.PubSubModule,
+			Categories: []string{constants.PubSubCategory, constants.FastCategory},
+			Description: `(SPUBLISH shardchannel message) Publish a message to the specified shard channel.
+In cluster mode, the message is only delivered to the subscribers on the nodes of the shard that serves the channel's slot.`,
+			Sync: false,
+			KeyExtractionFunc: func(cmd []string) (internal.KeyExtractionFuncResult, error) {
+				if len(cmd) != 3 {
+					return internal.KeyExtractionFuncResult{}, errors.New(constants.WrongArgsResponse)
+				}
+				return internal.KeyExtractionFuncResult{
+					Channels:  cmd[1:2],
+					ReadKeys:  make([]string, 0),
+					WriteKeys: make([]string, 0),
+				}, nil
+			},
+			HandlerFunc: handleSPublish,
+		},
 		{
 			Command:    "unsubscribe",
 			Module:     constants.PubSubModule,
@@ -208,7 +326,7 @@ it's currently subscribe to.`,
 				}, nil
 			},
 			HandlerFunc: func(_ internal.HandlerFuncParams) ([]byte, error) {
-				return nil, errors.New("provide CHANNELS, NUMPAT, or NUMSUB subcommand")
+				return nil, errors.New("provide CHANNELS, NUMPAT, NUMSUB, SHARDCHANNELS, or SHARDNUMSUB subcommand")
 			},
 			SubCommands: []internal.SubCommand{
 				{
@@ -259,6 +377,38 @@ channel name and how many clients are currently subscribed to the channel.`,
 					},
 					HandlerFunc: handlePubSubNumSubs,
 				},
+				{
+					Command:    "shardchannels",
+					Module:     constants.PubSubModule,
+					Categories: []string{constants.PubSubCategory, constants.SlowCategory},
+					Description: `(PUBSUB SHARDCHANNELS [pattern]) Returns an array containing the list of active shard channels
+that match the given pattern. If no pattern is provided, all active shard channels are returned.`,
+					Sync: false,
+					KeyExtractionFunc: func(cmd []string) (internal.KeyExtractionFuncResult, error) {
+						return internal.KeyExtractionFuncResult{
+							Channels:  make([]string, 0),
+							ReadKeys:  make([]string, 0),
+							WriteKeys: make([]string, 0),
+						}, nil
+					},
+					HandlerFunc: handlePubSubShardChannels,
+				},
+				{
+					Command:    "shardnumsub",
+					Module:     constants.PubSubModule,
+					Categories: []string{constants.PubSubCategory, constants.SlowCategory},
+					Description: `(PUBSUB SHARDNUMSUB [shardchannel [shardchannel ...]]) Return an array of arrays containing the
+provided shard channel name and how many clients are currently subscribed to the shard channel.`,
+					Sync: false,
+					KeyExtractionFunc: func(cmd []string) (internal.KeyExtractionFuncResult, error) {
+						return internal.KeyExtractionFuncResult{
+							Channels:  cmd[2:],
+							ReadKeys:  make([]string, 0),
+							WriteKeys: make([]string, 0),
+						}, nil
+					},
+					HandlerFunc: handlePubSubShardNumSub,
+				},
 			},
 		},
 	}
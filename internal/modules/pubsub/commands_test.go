@@ -15,6 +15,7 @@
 package pubsub_test
 
 import (
+	"fmt"
 	"github.com/echovault/sugardb/internal"
 	"github.com/echovault/sugardb/internal/config"
 	"github.com/echovault/sugardb/internal/constants"
@@ -1010,4 +1011,102 @@ func Test_PubSub(t *testing.T) {
 			})
 		}
 	})
+
+	t.Run("Test_HandleShardChannels", func(t *testing.T) {
+		t.Parallel()
+
+		var rawConnections []net.Conn
+		establishConnection := func() *resp.Conn {
+			conn, err := internal.GetConnection("localhost", port)
+			if err != nil {
+				t.Error(err)
+			}
+			rawConnections = append(rawConnections, conn)
+			return resp.NewConn(conn)
+		}
+		defer func() {
+			for _, conn := range rawConnections {
+				_ = conn.Close()
+			}
+		}()
+
+		do := func(client *resp.Conn, cmd ...string) resp.Value {
+			command := make([]resp.Value, len(cmd))
+			for i, c := range cmd {
+				command[i] = resp.StringValue(c)
+			}
+			if err := client.WriteArray(command); err != nil {
+				t.Error(err)
+			}
+			res, _, err := client.ReadValue()
+			if err != nil {
+				t.Error(err)
+			}
+			return res
+		}
+
+		// Subscribe 2 connections to the shard channels, and 1 connection to a regular channel with the same name.
+		shardChannels := []string{"shard_channel1", "shard_channel2"}
+		subscribers := []*resp.Conn{establishConnection(), establishConnection()}
+		for _, subscriber := range subscribers {
+			if err := subscriber.WriteArray([]resp.Value{
+				resp.StringValue("SSUBSCRIBE"), resp.StringValue(shardChannels[0]), resp.StringValue(shardChannels[1]),
+			}); err != nil {
+				t.Error(err)
+			}
+			for i, channel := range shardChannels {
+				// Read the shard channel subscription confirmations.
+				res, _, err := subscriber.ReadValue()
+				if err != nil {
+					t.Error(err)
+				}
+				if want := fmt.Sprintf("[ssubscribe %s %d]", channel, i+1); res.String() != want {
+					t.Errorf("expected confirmation %s, got %v", want, res)
+				}
+			}
+		}
+		regularSubscriber := establishConnection()
+		do(regularSubscriber, "SUBSCRIBE", "shard_channel1")
+
+		client := establishConnection()
+		res := do(client, "PUBSUB", "SHARDCHANNELS", "shard_channel*")
+		if got := []string{res.Array()[0].String(), res.Array()[1].String()}; !slices.Contains(got, "shard_channel1") ||
+			!slices.Contains(got, "shard_channel2") || len(res.Array()) != 2 {
+			t.Errorf("expected shard channels %v, got %v", shardChannels, res)
+		}
+		res = do(client, "PUBSUB", "SHARDNUMSUB", "shard_channel1", "shard_channel3")
+		if res.String() != "[[shard_channel1 2] [shard_channel3 0]]" {
+			t.Errorf("expected shard_channel1 to have 2 subscribers and shard_channel3 none, got %v", res)
+		}
+
+		// SPUBLISH only reaches the subscribers of the shard channel.
+		if res = do(client, "SPUBLISH", "shard_channel1", "hello"); res.String() != "OK" {
+			t.Errorf("expected OK, got %v", res)
+		}
+		for _, subscriber := range subscribers {
+			rv, _, err := subscriber.ReadValue()
+			if err != nil {
+				t.Error(err)
+			}
+			if rv.String() != "[smessage shard_channel1 hello]" {
+				t.Errorf("expected smessage from shard_channel1, got %v", rv)
+			}
+		}
+		if res = do(client, "PUBLISH", "shard_channel1", "regular"); res.String() != "OK" {
+			t.Errorf("expected OK, got %v", res)
+		}
+		if rv, _, _ := regularSubscriber.ReadValue(); rv.String() != "[message shard_channel1 regular]" {
+			t.Errorf("expected message from shard_channel1, got %v", rv)
+		}
+
+		// SUNSUBSCRIBE without channels unsubscribes from all the shard channels.
+		res = do(subscribers[0], "SUNSUBSCRIBE")
+		if res.String() != "[[sunsubscribe shard_channel1 1] [sunsubscribe shard_channel2 2]]" {
+			t.Errorf("expected to unsubscribe from both shard channels, got %v", res)
+		}
+		res = do(client, "PUBSUB", "SHARDNUMSUB", "shard_channel1")
+		if res.String() != "[[shard_channel1 1]]" {
+			t.Errorf("expected shard_channel1 to have 1 subscriber, got %v", res)
+		}
+	})
 }
@@ -28,14 +28,42 @@ import (
 
 type PubSub struct {
 	channels      []*Channel
+	shardChannels []*Channel // The shard channels subscribed to with SSUBSCRIBE.
 	channelsRWMut sync.RWMutex
+	remote        map[string]Summary // The subscriptions of the other cluster members by server id.
+	remoteRWMut   sync.RWMutex
+	onChange      func() // Called when the subscriptions of the node change.
 }
 
-func NewPubSub() *PubSub {
-	return &PubSub{
+// Summary holds the number of subscribers of each active channel, pattern and shard channel of a node.
+// Cluster members exchange their summaries so that PUBSUB returns the subscriptions of the whole cluster.
+type Summary struct {
+	Channels      map[string]int `json:"Channels"`
+	Patterns      map[string]int `json:"Patterns"`
+	ShardChannels map[string]int `json:"ShardChannels"`
+}
+
+// WithSubscriptionsChanged option sets the function that's called when the subscriptions of the node change.
+// The function must not block.
+func WithSubscriptionsChanged(f func()) func(ps *PubSub) {
+	return func(ps *PubSub) {
+		ps.onChange = f
+	}
+}
+
+func NewPubSub(options ...func(ps *PubSub)) *PubSub {
+	ps := &PubSub{
 		channels:      []*Channel{},
+		shardChannels: []*Channel{},
 		channelsRWMut: sync.RWMutex{},
+		remote:        make(map[string]Summary),
+		remoteRWMut:   sync.RWMutex{},
+		onChange:      func() {},
+	}
+	for _, option := range options {
+		option(ps)
 	}
+	return ps
 }
 
 func (ps *PubSub) Subscribe(_ context.Context, conn *net.Conn, channels []string, withPattern bool) {
@@ -89,6 +117,8 @@ func (ps *PubSub) Subscribe(_ context.Context, conn *net.Conn, channels []string
 			}
 		}
 	}
+
+	ps.onChange()
 }
 
 func (ps *PubSub) Unsubscribe(_ context.Context, conn *net.Conn, channels []string, withPattern bool) []byte {
@@ -168,6 +198,10 @@ func (ps *PubSub) Unsubscribe(_ context.Context, conn *net.Conn, channels []stri
 		}
 	}
 
+	if len(unsubscribed) > 0 {
+		ps.onChange()
+	}
+
 	res := fmt.Sprintf("*%d\r\n", len(unsubscribed))
 	for key, value := range unsubscribed {
 		res += fmt.Sprintf("*3\r\n+%s\r\n$%d\r\n%s\r\n:%d\r\n", action, len(value), value, key)
@@ -199,50 +233,52 @@ func (ps *PubSub) Channels(pattern string) []byte {
 	ps.channelsRWMut.RLock()
 	defer ps.channelsRWMut.RUnlock()
 
-	var count int
-	var res string
-
-	if pattern == "" {
-		for _, channel := range ps.channels {
-			if channel.IsActive() {
-				res += fmt.Sprintf("$%d\r\n%s\r\n", len(channel.name), channel.name)
-				count += 1
-			}
-		}
-		res = fmt.Sprintf("*%d\r\n%s", count, res)
-		return []byte(res)
+	var g glob.Glob
+	if pattern != "" {
+		g = glob.MustCompile(pattern)
+	}
+	match := func(name string, isPattern bool) bool {
+		// If channel is a pattern channel, then directly compare the channel name to pattern.
+		// Otherwise, check if the channel name matches the provided glob pattern.
+		return g == nil || (isPattern && name == pattern) || g.Match(name)
 	}
 
-	g := glob.MustCompile(pattern)
-
+	var names []string
 	for _, channel := range ps.channels {
-		// If channel is a pattern channel, then directly compare the channel name to pattern
-		if channel.pattern != nil && channel.name == pattern && channel.IsActive() {
-			res += fmt.Sprintf("$%d\r\n%s\r\n", len(channel.name), channel.name)
-			count += 1
-			continue
-		}
-		// Channel is not a pattern channel. Check if the channel name matches the provided glob pattern
-		if g.Match(channel.name) && channel.IsActive() {
-			res += fmt.Sprintf("$%d\r\n%s\r\n", len(channel.name), channel.name)
-			count += 1
+		if channel.IsActive() && match(channel.name, channel.pattern != nil) {
+			names = append(names, channel.name)
 		}
 	}
-
-	return []byte(fmt.Sprintf("*%d\r\n%s", count, res))
+	names = ps.appendRemoteNames(names, func(summary Summary) map[string]int {
+		return summary.Channels
+	}, func(name string) bool {
+		return match(name, false)
+	})
+	names = ps.appendRemoteNames(names, func(summary Summary) map[string]int {
+		return summary.Patterns
+	}, func(name string) bool {
+		return match(name, true)
+	})
+
+	return encodeNames(names)
 }
 
 func (ps *PubSub) NumPat() int {
 	ps.channelsRWMut.RLock()
 	defer ps.channelsRWMut.RUnlock()
 
-	var count int
+	var names []string
 	for _, channel := range ps.channels {
 		if channel.pattern != nil && channel.IsActive() {
-			count += 1
+			names = append(names, channel.name)
 		}
 	}
-	return count
+	names = ps.appendRemoteNames(names, func(summary Summary) map[string]int {
+		return summary.Patterns
+	}, func(string) bool {
+		return true
+	})
+	return len(names)
 }
 
 func (ps *PubSub) NumSub(channels []string) []byte {
@@ -251,15 +287,230 @@ func (ps *PubSub) NumSub(channels []string) []byte {
 
 	res := fmt.Sprintf("*%d\r\n", len(channels))
 	for _, channel := range channels {
-		// If it's a pattern channel, skip it
+		count := ps.remoteCount(channel, func(summary Summary) map[string]int {
+			return summary.Channels
+		})
 		chanIdx := slices.IndexFunc(ps.channels, func(c *Channel) bool {
 			return c.name == channel
 		})
-		if chanIdx == -1 {
-			res += fmt.Sprintf("*2\r\n$%d\r\n%s\r\n:0\r\n", len(channel), channel)
+		if chanIdx != -1 {
+			count += ps.channels[chanIdx].NumSubs()
+		}
+		res += fmt.Sprintf("*2\r\n$%d\r\n%s\r\n:%d\r\n", len(channel), channel, count)
+	}
+	return []byte(res)
+}
+
+// SSubscribe subscribes the connection to the shard channels.
+// Shard channels are separate from the channels subscribed to with SUBSCRIBE and don't support patterns.
+func (ps *PubSub) SSubscribe(_ context.Context, conn *net.Conn, channels []string) {
+	ps.channelsRWMut.Lock()
+	defer ps.channelsRWMut.Unlock()
+
+	r := resp.NewConn(*conn)
+
+	for i, name := range channels {
+		channelIdx := slices.IndexFunc(ps.shardChannels, func(channel *Channel) bool {
+			return channel.name == name
+		})
+		if channelIdx == -1 {
+			channel := NewChannel(WithName(name), WithSharded())
+			channel.Start()
+			ps.shardChannels = append(ps.shardChannels, channel)
+			channelIdx = len(ps.shardChannels) - 1
+		}
+		if ps.shardChannels[channelIdx].Subscribe(conn) {
+			if err := r.WriteArray([]resp.Value{
+				resp.StringValue("ssubscribe"),
+				resp.StringValue(name),
+				resp.IntegerValue(i + 1),
+			}); err != nil {
+				log.Println(err)
+			}
+		}
+	}
+
+	ps.onChange()
+}
+
+// SUnsubscribe unsubscribes the connection from the shard channels.
+// If no channels are provided, the connection is unsubscribed from all the shard channels.
+func (ps *PubSub) SUnsubscribe(_ context.Context, conn *net.Conn, channels []string) []byte {
+	ps.channelsRWMut.RLock()
+	defer ps.channelsRWMut.RUnlock()
+
+	var unsubscribed []string
+	for _, channel := range ps.shardChannels {
+		if len(channels) > 0 && !slices.Contains(channels, channel.name) {
 			continue
 		}
-		res += fmt.Sprintf("*2\r\n$%d\r\n%s\r\n:%d\r\n", len(channel), channel, ps.channels[chanIdx].NumSubs())
+		if channel.Unsubscribe(conn) {
+			unsubscribed = append(unsubscribed, channel.name)
+		}
+	}
+
+	if len(unsubscribed) > 0 {
+		ps.onChange()
+	}
+
+	res := fmt.Sprintf("*%d\r\n", len(unsubscribed))
+	for i, name := range unsubscribed {
+		res += fmt.Sprintf("*3\r\n+sunsubscribe\r\n$%d\r\n%s\r\n:%d\r\n", len(name), name, i+1)
+	}
+	return []byte(res)
+}
+
+// SPublish publishes the message to the subscribers of the shard channel.
+func (ps *PubSub) SPublish(_ context.Context, message string, channelName string) {
+	ps.channelsRWMut.RLock()
+	defer ps.channelsRWMut.RUnlock()
+
+	for _, channel := range ps.shardChannels {
+		if channel.name == channelName {
+			channel.Publish(message)
+		}
+	}
+}
+
+// ShardChannels returns the active shard channels that match the glob pattern.
+// All the active shard channels are returned when the pattern is empty.
+func (ps *PubSub) ShardChannels(pattern string) []byte {
+	ps.channelsRWMut.RLock()
+	defer ps.channelsRWMut.RUnlock()
+
+	match := func(string) bool {
+		return true
+	}
+	if pattern != "" {
+		match = glob.MustCompile(pattern).Match
+	}
+
+	var names []string
+	for _, channel := range ps.shardChannels {
+		if channel.IsActive() && match(channel.name) {
+			names = append(names, channel.name)
+		}
+	}
+	names = ps.appendRemoteNames(names, func(summary Summary) map[string]int {
+		return summary.ShardChannels
+	}, match)
+
+	return encodeNames(names)
+}
+
+// ShardNumSub returns the number of subscribers of each of the shard channels.
+func (ps *PubSub) ShardNumSub(channels []string) []byte {
+	ps.channelsRWMut.RLock()
+	defer ps.channelsRWMut.RUnlock()
+
+	res := fmt.Sprintf("*%d\r\n", len(channels))
+	for _, name := range channels {
+		count := ps.remoteCount(name, func(summary Summary) map[string]int {
+			return summary.ShardChannels
+		})
+		for _, channel := range ps.shardChannels {
+			if channel.name == name {
+				count += channel.NumSubs()
+			}
+		}
+		res += fmt.Sprintf("*2\r\n$%d\r\n%s\r\n:%d\r\n", len(name), name, count)
+	}
+	return []byte(res)
+}
+
+// Summary returns the number of subscribers of each active channel, pattern and shard channel of the node.
+func (ps *PubSub) Summary() Summary {
+	ps.channelsRWMut.RLock()
+	defer ps.channelsRWMut.RUnlock()
+
+	summary := Summary{
+		Channels:      make(map[string]int),
+		Patterns:      make(map[string]int),
+		ShardChannels: make(map[string]int),
+	}
+	for _, channel := range ps.channels {
+		if n := channel.NumSubs(); n > 0 {
+			if channel.pattern != nil {
+				summary.Patterns[channel.name] = n
+			} else {
+				summary.Channels[channel.name] = n
+			}
+		}
+	}
+	for _, channel := range ps.shardChannels {
+		if n := channel.NumSubs(); n > 0 {
+			summary.ShardChannels[channel.name] = n
+		}
+	}
+	return summary
+}
+
+// Subscriptions returns the number of channels, patterns and shard channels the connection is subscribed to.
+func (ps *PubSub) Subscriptions(conn *net.Conn) int {
+	ps.channelsRWMut.RLock()
+	defer ps.channelsRWMut.RUnlock()
+
+	count := 0
+	for _, channels := range [][]*Channel{ps.channels, ps.shardChannels} {
+		for _, channel := range channels {
+			if channel.IsSubscribed(conn) {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+// SetRemote records the subscriptions of another cluster member.
+func (ps *PubSub) SetRemote(serverId string, summary Summary) {
+	ps.remoteRWMut.Lock()
+	defer ps.remoteRWMut.Unlock()
+	ps.remote[serverId] = summary
+}
+
+// RemoveRemote removes the subscriptions of a cluster member, e.g. after it leaves the cluster.
+func (ps *PubSub) RemoveRemote(serverId string) {
+	ps.remoteRWMut.Lock()
+	defer ps.remoteRWMut.Unlock()
+	delete(ps.remote, serverId)
+}
+
+// appendRemoteNames appends the names that the other cluster members report in the given field of their
+// summaries and that match. The names that are already in the list are skipped.
+func (ps *PubSub) appendRemoteNames(names []string, field func(summary Summary) map[string]int,
+	match func(name string) bool) []string {
+	ps.remoteRWMut.RLock()
+	defer ps.remoteRWMut.RUnlock()
+
+	var remote []string
+	for _, summary := range ps.remote {
+		for name := range field(summary) {
+			if match(name) && !slices.Contains(names, name) && !slices.Contains(remote, name) {
+				remote = append(remote, name)
+			}
+		}
+	}
+	slices.Sort(remote)
+	return append(names, remote...)
+}
+
+// remoteCount returns the number of subscribers that the other cluster members report for the name
+// in the given field of their summaries.
+func (ps *PubSub) remoteCount(name string, field func(summary Summary) map[string]int) int {
+	ps.remoteRWMut.RLock()
+	defer ps.remoteRWMut.RUnlock()
+
+	count := 0
+	for _, summary := range ps.remote {
+		count += field(summary)[name]
+	}
+	return count
+}
+
+func encodeNames(names []string) []byte {
+	res := fmt.Sprintf("*%d\r\n", len(names))
+	for _, name := range names {
+		res += fmt.Sprintf("$%d\r\n%s\r\n", len(name), name)
 	}
 	return []byte(res)
 }
@@ -20,6 +20,8 @@ import (
 	"fmt"
 	"github.com/echovault/sugardb/internal"
 	"github.com/echovault/sugardb/internal/config"
+	"github.com/echovault/sugardb/internal/encryption"
+	"github.com/echovault/sugardb/internal/sharding"
 	"github.com/hashicorp/raft"
 	"io"
 	"log"
@@ -30,6 +32,7 @@ import (
 
 type FSMOpts struct {
 	Config                config.Config
+	Cipher                *encryption.Cipher
 	GetState              func() map[int]map[string]internal.KeyData
 	GetCommand            func(command string) (internal.Command, error)
 	SetValues             func(ctx context.Context, entries map[string]interface{}) error
@@ -39,6 +42,13 @@ type FSMOpts struct {
 	FinishSnapshot        func()
 	SetLatestSnapshotTime func(msec int64)
 	GetHandlerFuncParams  func(ctx context.Context, cmd []string, conn *net.Conn) internal.HandlerFuncParams
+	GetShard              func() *sharding.Shard
+	SetShard              func(shard sharding.Shard, claim bool)
+	GetACLUsers           func() ([]byte, error)
+	SetACLUsers           func(b []byte) error
+	GetModules            func() []internal.LoadedModule
+	SetModules            func(modules []internal.LoadedModule)
+	appliedIndex          *appliedIndex
 }
 
 type FSM struct {
@@ -57,6 +67,8 @@ func (fsm *FSM) Apply(log *raft.Log) interface{} {
 	default:
 		// No-Op
 	case raft.LogCommand:
+		defer fsm.options.appliedIndex.set(log.Index)
+
 		var request internal.ApplyRequest
 
 		if err := json.Unmarshal(log.Data, &request); err != nil {
@@ -90,6 +102,20 @@ func (fsm *FSM) Apply(log *raft.Log) interface{} {
 				Response: []byte("OK"),
 			}
 
+		case "set-shard", "claim-shard":
+			// Record the slots of the shard. A claim is only recorded if the shard has no slots yet.
+			if request.Shard == nil {
+				return internal.ApplyResponse{
+					Error:    fmt.Errorf("%s request without shard", request.Type),
+					Response: nil,
+				}
+			}
+			fsm.options.SetShard(*request.Shard, strings.EqualFold(request.Type, "claim-shard"))
+			return internal.ApplyResponse{
+				Error:    nil,
+				Response: []byte("OK"),
+			}
+
 		case "command":
 			// Handle command
 			command, err := fsm.options.GetCommand(request.CMD[0])
@@ -133,12 +159,22 @@ func (fsm *FSM) Apply(log *raft.Log) interface{} {
 
 // Snapshot implements raft.FSM interface
 func (fsm *FSM) Snapshot() (raft.FSMSnapshot, error) {
+	// Users and modules are captured with the data so that they match the applied index.
+	users, err := fsm.options.GetACLUsers()
+	if err != nil {
+		return nil, err
+	}
 	return NewFSMSnapshot(SnapshotOpts{
 		config:                fsm.options.Config,
+		cipher:                fsm.options.Cipher,
 		startSnapshot:         fsm.options.StartSnapshot,
 		finishSnapshot:        fsm.options.FinishSnapshot,
 		setLatestSnapshotTime: fsm.options.SetLatestSnapshotTime,
 		data:                  fsm.options.GetState(),
+		appliedIndex:          fsm.options.appliedIndex.get(),
+		shard:                 fsm.options.GetShard(),
+		aclUsers:              users,
+		modules:               fsm.options.GetModules(),
 	}), nil
 }
 
@@ -151,6 +187,12 @@ func (fsm *FSM) Restore(snapshot io.ReadCloser) error {
 		return err
 	}
 
+	// Decrypt the snapshot. The error is returned so that the node fails to start with a clear message
+	// when the encryption key is wrong.
+	if b, err = fsm.options.Cipher.Open(b); err != nil {
+		return fmt.Errorf("restore raft snapshot: %w", err)
+	}
+
 	data := internal.SnapshotObject{
 		State:                      make(map[int]map[string]internal.KeyData),
 		LatestSnapshotMilliseconds: 0,
@@ -175,5 +217,22 @@ func (fsm *FSM) Restore(snapshot io.ReadCloser) error {
 	// Set latest snapshot milliseconds.
 	fsm.options.SetLatestSnapshotTime(data.LatestSnapshotMilliseconds)
 
+	// Restore the slots of the shard.
+	if data.Shard != nil {
+		fsm.options.SetShard(*data.Shard, false)
+	}
+
+	// Restore the ACL users and the loaded modules.
+	// Snapshots taken before users were replicated have neither, so the local ones are kept.
+	if len(data.ACLUsers) > 0 {
+		if err := fsm.options.SetACLUsers(data.ACLUsers); err != nil {
+			return err
+		}
+		fsm.options.SetModules(data.Modules)
+	}
+
+	// The restored state includes all the logs up to the applied index of the snapshot.
+	fsm.options.appliedIndex.set(data.RaftAppliedIndex)
+
 	return nil
 }
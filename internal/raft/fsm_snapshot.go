@@ -18,6 +18,8 @@ import (
 	"encoding/json"
 	"github.com/echovault/sugardb/internal"
 	"github.com/echovault/sugardb/internal/config"
+	"github.com/echovault/sugardb/internal/encryption"
+	"github.com/echovault/sugardb/internal/sharding"
 	"github.com/hashicorp/raft"
 	"strconv"
 	"strings"
@@ -26,10 +28,15 @@ import (
 
 type SnapshotOpts struct {
 	config                config.Config
+	cipher                *encryption.Cipher
 	data                  map[int]map[string]internal.KeyData
 	startSnapshot         func()
 	finishSnapshot        func()
 	setLatestSnapshotTime func(msec int64)
+	appliedIndex          uint64                  // The index of the latest log applied to the data.
+	shard                 *sharding.Shard         // The slots of the node's shard.
+	aclUsers              []byte                  // The JSON encoded ACL users.
+	modules               []internal.LoadedModule // The modules loaded from dynamic libraries.
 }
 
 type Snapshot struct {
@@ -55,6 +62,10 @@ func (s *Snapshot) Persist(sink raft.SnapshotSink) error {
 	snapshotObject := internal.SnapshotObject{
 		State:                      internal.FilterExpiredKeys(time.Now(), s.options.data),
 		LatestSnapshotMilliseconds: int64(msec),
+		RaftAppliedIndex:           s.options.appliedIndex,
+		Shard:                      s.options.shard,
+		ACLUsers:                   s.options.aclUsers,
+		Modules:                    s.options.modules,
 	}
 
 	o, err := json.Marshal(snapshotObject)
@@ -64,7 +75,7 @@ func (s *Snapshot) Persist(sink raft.SnapshotSink) error {
 		return err
 	}
 
-	if _, err = sink.Write(o); err != nil {
+	if _, err = sink.Write(s.options.cipher.Seal(o)); err != nil {
 		_ = sink.Cancel()
 		return err
 	}
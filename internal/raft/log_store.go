@@ -0,0 +1,65 @@
+// Copyright 2024 Kelvin Clement Mwinuka
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package raft
+
+import (
+	"fmt"
+	"github.com/echovault/sugardb/internal/encryption"
+	"github.com/hashicorp/raft"
+)
+
+// encryptedLogStore encrypts the data of the raft log entries before they're written to the underlying store,
+// and decrypts them when they're read. Entries written before encryption was enabled are read as plaintext
+// when the cipher allows it.
+type encryptedLogStore struct {
+	raft.LogStore
+	cipher *encryption.Cipher
+}
+
+func newEncryptedLogStore(store raft.LogStore, cipher *encryption.Cipher) raft.LogStore {
+	if cipher == nil {
+		return store
+	}
+	return &encryptedLogStore{LogStore: store, cipher: cipher}
+}
+
+func (s *encryptedLogStore) GetLog(index uint64, log *raft.Log) error {
+	if err := s.LogStore.GetLog(index, log); err != nil {
+		return err
+	}
+	data, err := s.cipher.Open(log.Data)
+	if err != nil {
+		return fmt.Errorf("raft log %d: %w", index, err)
+	}
+	log.Data = data
+	return nil
+}
+
+func (s *encryptedLogStore) StoreLog(log *raft.Log) error {
+	return s.StoreLogs([]*raft.Log{log})
+}
+
+func (s *encryptedLogStore) StoreLogs(logs []*raft.Log) error {
+	// Encrypt copies of the logs, the originals are kept in plaintext by the log cache.
+	encrypted := make([]*raft.Log, len(logs))
+	for i, log := range logs {
+		l := *log
+		if len(l.Data) > 0 {
+			l.Data = s.cipher.Seal(l.Data)
+		}
+		encrypted[i] = &l
+	}
+	return s.LogStore.StoreLogs(encrypted)
+}
@@ -20,11 +20,14 @@ import (
 	"fmt"
 	"github.com/echovault/sugardb/internal"
 	"github.com/echovault/sugardb/internal/config"
+	"github.com/echovault/sugardb/internal/encryption"
 	"github.com/echovault/sugardb/internal/memberlist"
+	"github.com/echovault/sugardb/internal/sharding"
 	"log"
 	"net"
 	"os"
 	"path/filepath"
+	"strconv"
 	"time"
 
 	"github.com/hashicorp/raft"
@@ -33,6 +36,7 @@ import (
 
 type Opts struct {
 	Config                config.Config
+	Cipher                *encryption.Cipher
 	SetValues             func(ctx context.Context, entries map[string]interface{}) error
 	SetExpiry             func(ctx context.Context, key string, expire time.Time, touch bool)
 	GetState              func() map[int]map[string]internal.KeyData
@@ -42,16 +46,24 @@ type Opts struct {
 	FinishSnapshot        func()
 	SetLatestSnapshotTime func(msec int64)
 	GetHandlerFuncParams  func(ctx context.Context, cmd []string, conn *net.Conn) internal.HandlerFuncParams
+	GetShard              func() *sharding.Shard
+	SetShard              func(shard sharding.Shard, claim bool)
+	GetACLUsers           func() ([]byte, error)
+	SetACLUsers           func(b []byte) error
+	GetModules            func() []internal.LoadedModule
+	SetModules            func(modules []internal.LoadedModule)
 }
 
 type Raft struct {
 	options Opts
 	raft    *raft.Raft
+	applied *appliedIndex
 }
 
 func NewRaft(opts Opts) *Raft {
 	return &Raft{
 		options: opts,
+		applied: newAppliedIndex(),
 	}
 }
 
@@ -78,7 +90,7 @@ func (r *Raft) RaftInit(ctx context.Context) {
 			log.Fatal(err)
 		}
 
-		logStore, err = raft.NewLogCache(512, boltdb)
+		logStore, err = raft.NewLogCache(512, newEncryptedLogStore(boltdb, r.options.Cipher))
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -114,6 +126,7 @@ func (r *Raft) RaftInit(ctx context.Context) {
 		raftConfig,
 		NewFSM(FSMOpts{
 			Config:                r.options.Config,
+			Cipher:                r.options.Cipher,
 			GetState:              r.options.GetState,
 			GetCommand:            r.options.GetCommand,
 			SetValues:             r.options.SetValues,
@@ -123,6 +136,13 @@ func (r *Raft) RaftInit(ctx context.Context) {
 			FinishSnapshot:        r.options.FinishSnapshot,
 			SetLatestSnapshotTime: r.options.SetLatestSnapshotTime,
 			GetHandlerFuncParams:  r.options.GetHandlerFuncParams,
+			GetShard:              r.options.GetShard,
+			SetShard:              r.options.SetShard,
+			GetACLUsers:           r.options.GetACLUsers,
+			SetACLUsers:           r.options.SetACLUsers,
+			GetModules:            r.options.GetModules,
+			SetModules:            r.options.SetModules,
+			appliedIndex:          r.applied,
 		}),
 		logStore,
 		stableStore,
@@ -141,7 +161,7 @@ func (r *Raft) RaftInit(ctx context.Context) {
 				{
 					Suffrage: raft.Voter,
 					ID:       raft.ServerID(conf.ServerID),
-					Address:  raft.ServerAddress(conf.RaftBindAddr),
+					Address:  raftTransport.LocalAddr(),
 				},
 			},
 		}).Error()
@@ -171,6 +191,23 @@ func (r *Raft) HasJoinedCluster() bool {
 	return isFollower && hasLeader
 }
 
+// LeaderID returns the server id of the current cluster leader. It's empty when the leader is unknown.
+func (r *Raft) LeaderID() string {
+	_, leaderID := r.raft.LeaderWithID()
+	return string(leaderID)
+}
+
+// LeaderCh returns a channel that receives true when the node becomes the leader, and false when it loses leadership.
+func (r *Raft) LeaderCh() <-chan bool {
+	return r.raft.LeaderCh()
+}
+
+// IsNotLeaderError reports whether the error was returned because the command was
+// applied on a node that is not the leader. Such commands have not been applied.
+func IsNotLeaderError(err error) bool {
+	return errors.Is(err, raft.ErrNotLeader)
+}
+
 func (r *Raft) AddVoter(
 	id raft.ServerID,
 	address raft.ServerAddress,
@@ -199,6 +236,64 @@ func (r *Raft) AddVoter(
 	return nil
 }
 
+// AddNonvoter adds a replica to the raft configuration of the shard. Non-voters receive the logs of the
+// shard but don't count towards the quorum, so they don't slow down writes.
+func (r *Raft) AddNonvoter(
+	id raft.ServerID,
+	address raft.ServerAddress,
+	prevIndex uint64,
+	timeout time.Duration,
+) error {
+	if r.IsRaftLeader() {
+		raftConfig := r.raft.GetConfiguration()
+		if err := raftConfig.Error(); err != nil {
+			return errors.New("could not retrieve raft config")
+		}
+
+		for _, s := range raftConfig.Configuration().Servers {
+			// Check if a node already exists with the current attributes.
+			if s.ID == id && s.Address == address {
+				return fmt.Errorf("node with id %s and address %s already exists", id, address)
+			}
+		}
+
+		err := r.raft.AddNonvoter(id, address, prevIndex, timeout).Error()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// AddServer adds a member of the shard that returned to the cluster back to the raft configuration.
+// A server that is still part of the configuration with the same address keeps its place and its suffrage.
+func (r *Raft) AddServer(meta memberlist.NodeMeta) error {
+	if !r.IsRaftLeader() {
+		return errors.New("not leader, could not add node")
+	}
+
+	future := r.raft.GetConfiguration()
+	if err := future.Error(); err != nil {
+		return errors.New("could not retrieve raft config")
+	}
+	voter := !meta.Replica
+	for _, s := range future.Configuration().Servers {
+		if s.ID != meta.ServerID {
+			continue
+		}
+		if s.Address == meta.RaftAddr {
+			return nil
+		}
+		voter = s.Suffrage == raft.Voter
+	}
+
+	if voter {
+		return r.raft.AddVoter(meta.ServerID, meta.RaftAddr, 0, 0).Error()
+	}
+	return r.raft.AddNonvoter(meta.ServerID, meta.RaftAddr, 0, 0).Error()
+}
+
 func (r *Raft) RemoveServer(meta memberlist.NodeMeta) error {
 	if !r.IsRaftLeader() {
 		return errors.New("not leader, could not remove node")
@@ -211,6 +306,159 @@ func (r *Raft) RemoveServer(meta memberlist.NodeMeta) error {
 	return nil
 }
 
+// Server is a member of the raft configuration of the node's shard.
+type Server struct {
+	ID      string
+	Address string
+	Voter   bool
+}
+
+// Servers returns the members of the latest raft configuration of the node's shard.
+func (r *Raft) Servers() ([]Server, error) {
+	future := r.raft.GetConfiguration()
+	if err := future.Error(); err != nil {
+		return nil, fmt.Errorf("could not retrieve raft config: %w", err)
+	}
+	var servers []Server
+	for _, s := range future.Configuration().Servers {
+		servers = append(servers, Server{
+			ID:      string(s.ID),
+			Address: string(s.Address),
+			Voter:   s.Suffrage == raft.Voter,
+		})
+	}
+	return servers, nil
+}
+
+// IsNonvoter reports whether the node is a non-voting replica in the latest raft configuration of its shard.
+func (r *Raft) IsNonvoter() bool {
+	future := r.raft.GetConfiguration()
+	if err := future.Error(); err != nil {
+		return false
+	}
+	for _, s := range future.Configuration().Servers {
+		if s.ID == raft.ServerID(r.options.Config.ServerID) {
+			return s.Suffrage == raft.Nonvoter
+		}
+	}
+	return false
+}
+
+// ReplicationLag returns the number of logs committed by the shard that the node has not applied yet,
+// and the time since the node last heard from the leader. The time is 0 on the leader,
+// and -1 when the node has never heard from a leader.
+func (r *Raft) ReplicationLag() (uint64, time.Duration) {
+	// The commit index is only exposed through the stats.
+	commitIndex, _ := strconv.ParseUint(r.raft.Stats()["commit_index"], 10, 64)
+	var lag uint64
+	if applied := r.applied.get(); commitIndex > applied {
+		lag = commitIndex - applied
+	}
+
+	if r.IsRaftLeader() {
+		return lag, 0
+	}
+	lastContact := r.raft.LastContact()
+	if lastContact.IsZero() {
+		return lag, -1
+	}
+	return lag, time.Since(lastContact)
+}
+
+// State returns the raft state of the node, e.g. Leader or Follower.
+func (r *Raft) State() string {
+	return r.raft.State().String()
+}
+
+// Stats returns the raft statistics of the node, such as the term, commit_index and applied_index.
+func (r *Raft) Stats() map[string]string {
+	return r.raft.Stats()
+}
+
+// TransferLeadership transfers the leadership of the shard to the server with the id.
+// When the id is empty, raft picks the most up-to-date follower.
+func (r *Raft) TransferLeadership(id string) error {
+	if id == "" {
+		return r.raft.LeadershipTransfer().Error()
+	}
+	servers, err := r.Servers()
+	if err != nil {
+		return err
+	}
+	for _, s := range servers {
+		if s.ID != id {
+			continue
+		}
+		if !s.Voter {
+			return fmt.Errorf("node %s is not a voter", id)
+		}
+		if r.LeaderID() == id {
+			return fmt.Errorf("node %s is already the leader", id)
+		}
+		return r.raft.LeadershipTransferToServer(raft.ServerID(s.ID), raft.ServerAddress(s.Address)).Error()
+	}
+	return fmt.Errorf("unknown node %s", id)
+}
+
+// AddNode adds the server as a voter to the raft configuration of the shard.
+func (r *Raft) AddNode(id, address string) error {
+	return r.raft.AddVoter(raft.ServerID(id), raft.ServerAddress(address), 0, 0).Error()
+}
+
+// PromoteNode turns the non-voting replica with the id into a voter of the shard.
+func (r *Raft) PromoteNode(id string) error {
+	servers, err := r.Servers()
+	if err != nil {
+		return err
+	}
+	for _, s := range servers {
+		if s.ID != id {
+			continue
+		}
+		if s.Voter {
+			return fmt.Errorf("node %s is already a voter", id)
+		}
+		return r.raft.AddVoter(raft.ServerID(s.ID), raft.ServerAddress(s.Address), 0, 0).Error()
+	}
+	return fmt.Errorf("unknown node %s", id)
+}
+
+// DemoteNode turns the voter with the id into a non-voting replica of the shard.
+// The leader can't be demoted, its leadership has to be transferred first.
+func (r *Raft) DemoteNode(id string) error {
+	servers, err := r.Servers()
+	if err != nil {
+		return err
+	}
+	for _, s := range servers {
+		if s.ID != id {
+			continue
+		}
+		if !s.Voter {
+			return fmt.Errorf("node %s is already a replica", id)
+		}
+		if r.LeaderID() == id {
+			return fmt.Errorf("node %s is the leader, transfer the leadership first", id)
+		}
+		return r.raft.DemoteVoter(raft.ServerID(id), 0, 0).Error()
+	}
+	return fmt.Errorf("unknown node %s", id)
+}
+
+// RemoveNode removes the server from the raft configuration of the shard.
+func (r *Raft) RemoveNode(id string) error {
+	servers, err := r.Servers()
+	if err != nil {
+		return err
+	}
+	for _, s := range servers {
+		if s.ID == id {
+			return r.raft.RemoveServer(raft.ServerID(id), 0, 0).Error()
+		}
+	}
+	return fmt.Errorf("unknown node %s", id)
+}
+
 func (r *Raft) TakeSnapshot() error {
 	return r.raft.Snapshot().Error()
 }
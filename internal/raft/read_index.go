@@ -0,0 +1,106 @@
+// Copyright 2024 Kelvin Clement Mwinuka
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package raft
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+// appliedIndex tracks the index of the latest log applied to the FSM.
+// raft.Raft's AppliedIndex is updated when the logs are dispatched to the FSM, before they are applied,
+// so it can't be used to tell whether a read will observe a log.
+type appliedIndex struct {
+	mut    sync.Mutex
+	index  uint64
+	notify chan struct{} // Closed and replaced each time the index advances.
+}
+
+func newAppliedIndex() *appliedIndex {
+	return &appliedIndex{notify: make(chan struct{})}
+}
+
+func (a *appliedIndex) get() uint64 {
+	a.mut.Lock()
+	defer a.mut.Unlock()
+	return a.index
+}
+
+// set advances the index. Lower indexes are ignored.
+func (a *appliedIndex) set(index uint64) {
+	a.mut.Lock()
+	defer a.mut.Unlock()
+	if index <= a.index {
+		return
+	}
+	a.index = index
+	close(a.notify)
+	a.notify = make(chan struct{})
+}
+
+// wait blocks until the index is at least the given index or the context is done.
+func (a *appliedIndex) wait(ctx context.Context, index uint64) error {
+	for {
+		a.mut.Lock()
+		if a.index >= index {
+			a.mut.Unlock()
+			return nil
+		}
+		notify := a.notify
+		a.mut.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-notify:
+		}
+	}
+}
+
+// ReadIndex returns the index of the latest log applied to the leader's FSM.
+// A read on any node observes all the writes acknowledged before the ReadIndex call once
+// the node has applied this index.
+//
+// When lease is false, a barrier is committed first, which confirms that the node is still the leader
+// and that all the logs committed by previous leaders are applied.
+// When lease is true, the leader relies on its lease instead: raft steps down a leader that hasn't heard from
+// the quorum within the leader lease timeout. This saves the quorum round trip, but right after an election
+// the new leader may not have applied all the logs committed by the previous leader.
+//
+// Returns raft.ErrNotLeader if the node is not the leader.
+func (r *Raft) ReadIndex(lease bool, timeout time.Duration) (uint64, error) {
+	if !r.IsRaftLeader() {
+		return 0, raft.ErrNotLeader
+	}
+	if !lease {
+		if err := r.raft.Barrier(timeout).Error(); err != nil {
+			if errors.Is(err, raft.ErrLeadershipLost) {
+				// The barrier does not modify the state, so it's safe to retry on the new leader.
+				return 0, raft.ErrNotLeader
+			}
+			return 0, err
+		}
+	}
+	return r.applied.get(), nil
+}
+
+// WaitForIndex blocks until the node has applied the log with the given index, or the context is done.
+func (r *Raft) WaitForIndex(ctx context.Context, index uint64) error {
+	return r.applied.wait(ctx, index)
+}
@@ -0,0 +1,422 @@
+// Copyright 2024 Kelvin Clement Mwinuka
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package replication
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/echovault/sugardb/internal"
+)
+
+// maxWriteSize is the upper limit of the size of each write of the stream to a replica.
+const maxWriteSize = 64 * 1024
+
+// backlog is a ring buffer that holds the latest bytes of the stream.
+type backlog struct {
+	buf     []byte
+	index   int    // The position of the next byte to write.
+	histlen int    // The number of bytes held.
+	end     uint64 // The offset of the byte that follows the latest byte held.
+}
+
+func newBacklog(size int, offset uint64) *backlog {
+	return &backlog{buf: make([]byte, size), end: offset}
+}
+
+func (b *backlog) write(data []byte) {
+	b.end += uint64(len(data))
+	if len(data) > len(b.buf) {
+		data = data[len(data)-len(b.buf):]
+	}
+	for len(data) > 0 {
+		n := copy(b.buf[b.index:], data)
+		b.index = (b.index + n) % len(b.buf)
+		b.histlen = min(b.histlen+n, len(b.buf))
+		data = data[n:]
+	}
+}
+
+// start returns the offset of the oldest byte held.
+func (b *backlog) start() uint64 {
+	return b.end - uint64(b.histlen)
+}
+
+// read returns up to max bytes from the offset. It returns false when the offset is no longer,
+// or not yet, part of the backlog.
+func (b *backlog) read(offset uint64, max int) ([]byte, bool) {
+	if offset < b.start() || offset > b.end {
+		return nil, false
+	}
+	count := min(int(b.end-offset), max)
+	res := make([]byte, count)
+	from := (b.index - int(b.end-offset) + len(b.buf)) % len(b.buf)
+	n := copy(res, b.buf[from:])
+	copy(res[n:], b.buf)
+	return res, true
+}
+
+// link is the connection of a replica to the primary.
+type link struct {
+	conn    *net.Conn
+	port    int       // The port the replica listens on.
+	offset  uint64    // The offset of the next byte to send.
+	ack     uint64    // The offset acknowledged by the replica.
+	lastAck time.Time // The time of the latest acknowledgement.
+	notify  chan struct{}
+	done    chan struct{}
+}
+
+// ReplicaInfo describes a replica connected to the primary.
+type ReplicaInfo struct {
+	Host    string
+	Port    int
+	Offset  uint64        // The offset acknowledged by the replica.
+	LastAck time.Duration // The time since the replica last acknowledged its offset.
+}
+
+// Stats holds the state of the primary's stream.
+type Stats struct {
+	ID                 string // The id of the stream.
+	Offset             uint64 // The offset of the end of the stream.
+	BacklogActive      bool   // Whether the backlog has been created. It's created when the first replica connects.
+	BacklogSize        int
+	BacklogFirstOffset uint64
+	BacklogHistlen     int
+	SyncFull           uint64 // The number of full resynchronizations served.
+	SyncPartialOK      uint64 // The number of partial resynchronizations accepted.
+	SyncPartialErr     uint64 // The number of partial resynchronizations denied.
+}
+
+type PrimaryOpts struct {
+	BacklogSize int
+	// CaptureState returns a point-in-time copy of the store. The onCapture function is called
+	// while writes are paused, at the exact point in time the copy represents.
+	CaptureState func(onCapture func()) map[int]map[string]internal.KeyData
+}
+
+// Primary streams the write commands executed by the instance to its replicas.
+type Primary struct {
+	options  PrimaryOpts
+	mut      sync.Mutex
+	id       string
+	offset   uint64
+	database int      // The database selected by the stream, or -1 when the next command must select it.
+	backlog  *backlog // Nil until the first replica connects.
+	links    map[*net.Conn]*link
+	ports    map[*net.Conn]int // The ports announced by replicas with REPLCONF listening-port.
+	stats    Stats
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+func NewPrimary(options PrimaryOpts) *Primary {
+	if options.BacklogSize <= 0 {
+		options.BacklogSize = DefaultBacklogSize
+	}
+	primary := &Primary{
+		options:  options,
+		id:       newID(),
+		database: -1,
+		links:    make(map[*net.Conn]*link),
+		ports:    make(map[*net.Conn]int),
+		stop:     make(chan struct{}),
+	}
+	go primary.ping()
+	return primary
+}
+
+// Close disconnects the replicas and stops pinging them.
+func (primary *Primary) Close() {
+	primary.stopOnce.Do(func() {
+		close(primary.stop)
+	})
+	primary.mut.Lock()
+	defer primary.mut.Unlock()
+	for conn, _ := range primary.links {
+		primary.dropLink(conn)
+	}
+}
+
+// Feed appends a write command executed on the database to the stream.
+// Commands are only recorded once a replica has connected.
+func (primary *Primary) Feed(database int, cmd []string) {
+	primary.mut.Lock()
+	defer primary.mut.Unlock()
+	primary.feed(database, cmd)
+}
+
+func (primary *Primary) feed(database int, cmd []string) {
+	if primary.backlog == nil {
+		return
+	}
+	var data []byte
+	if database >= 0 && database != primary.database {
+		data = internal.EncodeCommand([]string{"SELECT", strconv.Itoa(database)})
+		primary.database = database
+	}
+	data = append(data, internal.EncodeCommand(cmd)...)
+	primary.backlog.write(data)
+	primary.offset += uint64(len(data))
+	for _, l := range primary.links {
+		select {
+		case l.notify <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Reset starts a new stream and disconnects the replicas, so that they resynchronize from scratch.
+// It's called when the dataset is replaced by a full resynchronization with the instance's own primary.
+func (primary *Primary) Reset() {
+	primary.mut.Lock()
+	defer primary.mut.Unlock()
+	for conn, _ := range primary.links {
+		primary.dropLink(conn)
+	}
+	primary.id = newID()
+	primary.backlog = nil
+	primary.database = -1
+}
+
+// SetListeningPort records the port that the replica on the connection listens on.
+func (primary *Primary) SetListeningPort(conn *net.Conn, port int) {
+	primary.mut.Lock()
+	defer primary.mut.Unlock()
+	primary.ports[conn] = port
+	if l, ok := primary.links[conn]; ok {
+		l.port = port
+	}
+}
+
+// Ack records the offset that the replica on the connection has applied.
+func (primary *Primary) Ack(conn *net.Conn, offset uint64) {
+	primary.mut.Lock()
+	defer primary.mut.Unlock()
+	if l, ok := primary.links[conn]; ok {
+		l.ack = offset
+		l.lastAck = time.Now()
+	}
+}
+
+// Disconnect forgets the replica on the connection. It's called when the connection is closed.
+func (primary *Primary) Disconnect(conn *net.Conn) {
+	primary.mut.Lock()
+	defer primary.mut.Unlock()
+	if l, ok := primary.links[conn]; ok {
+		close(l.done)
+		delete(primary.links, conn)
+	}
+	delete(primary.ports, conn)
+}
+
+// Linked returns true when the stream is sent to a replica on the connection.
+func (primary *Primary) Linked(conn *net.Conn) bool {
+	primary.mut.Lock()
+	defer primary.mut.Unlock()
+	_, ok := primary.links[conn]
+	return ok
+}
+
+// dropLink closes the connection of a replica. The caller must hold the lock.
+func (primary *Primary) dropLink(conn *net.Conn) {
+	if l, ok := primary.links[conn]; ok {
+		close(l.done)
+		delete(primary.links, conn)
+	}
+	_ = (*conn).Close()
+}
+
+// Sync handles PSYNC from the replica on the connection. The replica continues from the offset when the
+// id matches the stream and the backlog still holds the offset. Otherwise, the dataset is sent to the replica.
+// The replies are written to the connection, after which the stream is sent to the replica in the background.
+func (primary *Primary) Sync(conn *net.Conn, id string, offset int64) error {
+	primary.mut.Lock()
+	if id == primary.id && primary.backlog != nil && offset >= 0 {
+		if _, ok := primary.backlog.read(uint64(offset), 0); ok {
+			l := primary.addLink(conn, uint64(offset))
+			primary.stats.SyncPartialOK += 1
+			reply := fmt.Sprintf("+CONTINUE %s\r\n", primary.id)
+			primary.mut.Unlock()
+			if _, err := (*conn).Write([]byte(reply)); err != nil {
+				primary.Disconnect(conn)
+				return err
+			}
+			go primary.stream(l)
+			return nil
+		}
+	}
+	if id != "?" {
+		primary.stats.SyncPartialErr += 1
+	}
+	primary.mut.Unlock()
+
+	var l *link
+	var reply string
+	state := primary.options.CaptureState(func() {
+		primary.mut.Lock()
+		defer primary.mut.Unlock()
+		if primary.backlog == nil {
+			primary.backlog = newBacklog(primary.options.BacklogSize, primary.offset)
+		}
+		// The replica starts from the default database, so the next command selects its database.
+		primary.database = -1
+		l = primary.addLink(conn, primary.offset)
+		reply = fmt.Sprintf("+FULLRESYNC %s %d\r\n", primary.id, primary.offset)
+	})
+
+	payload, err := EncodeState(state)
+	if err != nil {
+		primary.Disconnect(conn)
+		return err
+	}
+	reply += fmt.Sprintf("$%d\r\n", len(payload))
+	if _, err = (*conn).Write(append(append([]byte(reply), payload...), '\r', '\n')); err != nil {
+		primary.Disconnect(conn)
+		return err
+	}
+
+	primary.mut.Lock()
+	primary.stats.SyncFull += 1
+	l.lastAck = time.Now()
+	primary.mut.Unlock()
+
+	go primary.stream(l)
+	return nil
+}
+
+// addLink registers the replica on the connection, replacing its previous link if any. The caller must hold the lock.
+func (primary *Primary) addLink(conn *net.Conn, offset uint64) *link {
+	if l, ok := primary.links[conn]; ok {
+		close(l.done)
+	}
+	l := &link{
+		conn:    conn,
+		port:    primary.ports[conn],
+		offset:  offset,
+		ack:     offset,
+		lastAck: time.Now(),
+		notify:  make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+	primary.links[conn] = l
+	// Send what the backlog already holds past the offset.
+	l.notify <- struct{}{}
+	return l
+}
+
+// stream sends the stream to the replica until the link is closed.
+func (primary *Primary) stream(l *link) {
+	for {
+		select {
+		case <-l.done:
+			return
+		case <-l.notify:
+		}
+		for {
+			primary.mut.Lock()
+			select {
+			case <-l.done:
+				primary.mut.Unlock()
+				return
+			default:
+			}
+			data, ok := primary.backlog.read(l.offset, maxWriteSize)
+			if !ok {
+				// The replica fell behind the backlog, it has to resynchronize from scratch.
+				log.Printf("replica %s fell behind the replication backlog, disconnecting\n", (*l.conn).RemoteAddr())
+				primary.dropLink(l.conn)
+				primary.mut.Unlock()
+				return
+			}
+			primary.mut.Unlock()
+			if len(data) == 0 {
+				break
+			}
+			_ = (*l.conn).SetWriteDeadline(time.Now().Add(Timeout))
+			if _, err := (*l.conn).Write(data); err != nil {
+				log.Printf("replica %s: %v\n", (*l.conn).RemoteAddr(), err)
+				primary.mut.Lock()
+				if primary.links[l.conn] == l {
+					primary.dropLink(l.conn)
+				}
+				primary.mut.Unlock()
+				return
+			}
+			l.offset += uint64(len(data))
+		}
+	}
+}
+
+// ping sends PING to the replicas at each interval, and disconnects the replicas that stopped acknowledging.
+func (primary *Primary) ping() {
+	ticker := time.NewTicker(PingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-primary.stop:
+			return
+		case <-ticker.C:
+			primary.mut.Lock()
+			for conn, l := range primary.links {
+				if time.Since(l.lastAck) > Timeout {
+					log.Printf("replica %s timed out, disconnecting\n", (*conn).RemoteAddr())
+					primary.dropLink(conn)
+				}
+			}
+			if len(primary.links) > 0 {
+				primary.feed(-1, []string{"PING"})
+			}
+			primary.mut.Unlock()
+		}
+	}
+}
+
+// Replicas returns the replicas connected to the primary.
+func (primary *Primary) Replicas() []ReplicaInfo {
+	primary.mut.Lock()
+	defer primary.mut.Unlock()
+	replicas := make([]ReplicaInfo, 0, len(primary.links))
+	for conn, l := range primary.links {
+		host, _, _ := net.SplitHostPort((*conn).RemoteAddr().String())
+		replicas = append(replicas, ReplicaInfo{
+			Host:    host,
+			Port:    l.port,
+			Offset:  l.ack,
+			LastAck: time.Since(l.lastAck),
+		})
+	}
+	return replicas
+}
+
+// Stats returns the state of the stream.
+func (primary *Primary) Stats() Stats {
+	primary.mut.Lock()
+	defer primary.mut.Unlock()
+	stats := primary.stats
+	stats.ID = primary.id
+	stats.Offset = primary.offset
+	stats.BacklogSize = primary.options.BacklogSize
+	if primary.backlog != nil {
+		stats.BacklogActive = true
+		stats.BacklogFirstOffset = primary.backlog.start()
+		stats.BacklogHistlen = primary.backlog.histlen
+	}
+	return stats
+}
@@ -0,0 +1,278 @@
+// Copyright 2024 Kelvin Clement Mwinuka
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package replication
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/echovault/sugardb/internal"
+	"github.com/tidwall/resp"
+)
+
+const (
+	StateConnect   = "connect"   // The replica is connecting to the primary.
+	StateSync      = "sync"      // The replica is resynchronizing with the primary.
+	StateConnected = "connected" // The replica is receiving the stream.
+)
+
+// ReplicaStatus holds the state of the replica's link to its primary.
+type ReplicaStatus struct {
+	Addr   string
+	State  string
+	ID     string    // The id of the primary's stream, "?" before the first resynchronization.
+	Offset uint64    // The offset of the stream that the replica has applied.
+	LastIO time.Time // The time the replica last received data from the primary. Zero when it never did.
+}
+
+type ReplicaOpts struct {
+	Addr          string   // The address of the primary.
+	Auth          []string // A password, or a username and a password, to authenticate with the primary.
+	ListeningPort int      // The port the replica listens on, announced to the primary.
+	// Load replaces the dataset with the one received in a full resynchronization.
+	Load func(state map[int]map[string]internal.KeyData)
+	// Apply executes a write command of the stream on the database.
+	Apply func(database int, cmd []string) error
+}
+
+// Replica follows the stream of a primary, reconnecting and resynchronizing whenever the link breaks.
+type Replica struct {
+	options  ReplicaOpts
+	mut      sync.Mutex
+	state    string
+	id       string
+	offset   uint64
+	database int
+	lastIO   time.Time
+	conn     net.Conn
+	cancel   context.CancelFunc
+	done     chan struct{}
+}
+
+func NewReplica(options ReplicaOpts) *Replica {
+	return &Replica{
+		options: options,
+		state:   StateConnect,
+		id:      "?",
+	}
+}
+
+// Start connects to the primary in the background.
+func (replica *Replica) Start(ctx context.Context) {
+	ctx, replica.cancel = context.WithCancel(ctx)
+	replica.done = make(chan struct{})
+	go replica.run(ctx)
+}
+
+// Stop closes the link to the primary and waits until the replica has stopped applying the stream.
+func (replica *Replica) Stop() {
+	replica.cancel()
+	replica.Disconnect()
+	<-replica.done
+}
+
+// Disconnect breaks the current link to the primary. The replica reconnects and
+// continues from its offset when the primary's backlog still holds it.
+func (replica *Replica) Disconnect() {
+	replica.mut.Lock()
+	defer replica.mut.Unlock()
+	if replica.conn != nil {
+		_ = replica.conn.Close()
+	}
+}
+
+// Status returns the state of the link to the primary.
+func (replica *Replica) Status() ReplicaStatus {
+	replica.mut.Lock()
+	defer replica.mut.Unlock()
+	return ReplicaStatus{
+		Addr:   replica.options.Addr,
+		State:  replica.state,
+		ID:     replica.id,
+		Offset: replica.offset,
+		LastIO: replica.lastIO,
+	}
+}
+
+func (replica *Replica) run(ctx context.Context) {
+	defer close(replica.done)
+	for {
+		err := replica.sync(ctx)
+		replica.mut.Lock()
+		replica.state = StateConnect
+		replica.conn = nil
+		replica.mut.Unlock()
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("replication with primary %s: %v\n", replica.options.Addr, err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(RetryInterval):
+		}
+	}
+}
+
+// sync connects to the primary, resynchronizes and applies the stream until the link breaks.
+func (replica *Replica) sync(ctx context.Context) error {
+	dialer := net.Dialer{Timeout: Timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", replica.options.Addr)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+	replica.mut.Lock()
+	replica.conn = conn
+	replica.mut.Unlock()
+	// Stop may have been called while dialing.
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	reader := resp.NewReader(conn)
+	do := func(cmd ...string) (resp.Value, error) {
+		_ = conn.SetDeadline(time.Now().Add(Timeout))
+		if _, err := conn.Write(internal.EncodeCommand(cmd)); err != nil {
+			return resp.Value{}, err
+		}
+		value, _, err := reader.ReadValue()
+		if err != nil {
+			return resp.Value{}, err
+		}
+		if value.Type() == resp.Error {
+			return resp.Value{}, errors.New(strings.TrimPrefix(value.Error().Error(), "Error "))
+		}
+		return value, nil
+	}
+
+	if len(replica.options.Auth) > 0 {
+		if _, err = do(append([]string{"AUTH"}, replica.options.Auth...)...); err != nil {
+			return fmt.Errorf("auth: %w", err)
+		}
+	}
+	if _, err = do("REPLCONF", "listening-port", strconv.Itoa(replica.options.ListeningPort)); err != nil {
+		return fmt.Errorf("replconf: %w", err)
+	}
+
+	replica.mut.Lock()
+	replica.state = StateSync
+	id, offset := replica.id, strconv.FormatUint(replica.offset, 10)
+	replica.mut.Unlock()
+	if id == "?" {
+		offset = "-1"
+	}
+
+	value, err := do("PSYNC", id, offset)
+	if err != nil {
+		return fmt.Errorf("psync: %w", err)
+	}
+	reply := strings.Fields(value.String())
+	switch {
+	case len(reply) == 3 && strings.EqualFold(reply[0], "FULLRESYNC"):
+		offset, err := strconv.ParseUint(reply[2], 10, 64)
+		if err != nil {
+			return fmt.Errorf("psync: invalid offset %q", reply[2])
+		}
+		payload, _, err := reader.ReadValue()
+		if err != nil {
+			return err
+		}
+		state, err := DecodeState(payload.Bytes())
+		if err != nil {
+			return fmt.Errorf("full resync: %w", err)
+		}
+		replica.options.Load(state)
+		replica.mut.Lock()
+		replica.id = reply[1]
+		replica.offset = offset
+		replica.database = 0
+		replica.mut.Unlock()
+	case len(reply) == 2 && strings.EqualFold(reply[0], "CONTINUE"):
+	default:
+		return fmt.Errorf("psync: unexpected reply %q", value.String())
+	}
+
+	replica.mut.Lock()
+	replica.state = StateConnected
+	replica.lastIO = time.Now()
+	replica.mut.Unlock()
+
+	// Acknowledge the offset at each interval until the link breaks.
+	stopAck := make(chan struct{})
+	defer close(stopAck)
+	go func() {
+		ticker := time.NewTicker(PingInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stopAck:
+				return
+			case <-ticker.C:
+				replica.mut.Lock()
+				ack := internal.EncodeCommand([]string{"REPLCONF", "ACK", strconv.FormatUint(replica.offset, 10)})
+				replica.mut.Unlock()
+				_ = conn.SetWriteDeadline(time.Now().Add(Timeout))
+				if _, err := conn.Write(ack); err != nil {
+					return
+				}
+			}
+		}
+	}()
+
+	for {
+		_ = conn.SetReadDeadline(time.Now().Add(Timeout))
+		value, n, err := reader.ReadValue()
+		if err != nil {
+			return err
+		}
+		cmd := make([]string, len(value.Array()))
+		for i, token := range value.Array() {
+			cmd[i] = token.String()
+		}
+
+		replica.mut.Lock()
+		replica.lastIO = time.Now()
+		database := replica.database
+		replica.mut.Unlock()
+
+		switch {
+		case len(cmd) == 0:
+		case strings.EqualFold(cmd[0], "PING"):
+		case strings.EqualFold(cmd[0], "SELECT") && len(cmd) == 2:
+			if database, err = strconv.Atoi(cmd[1]); err != nil {
+				return fmt.Errorf("invalid database %q", cmd[1])
+			}
+		default:
+			if err = replica.options.Apply(database, cmd); err != nil {
+				log.Printf("replication apply %s: %v\n", cmd[0], err)
+			}
+		}
+
+		replica.mut.Lock()
+		replica.database = database
+		replica.offset += uint64(n)
+		replica.mut.Unlock()
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright 2024 Kelvin Clement Mwinuka
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package replication implements the asynchronous primary-replica replication of standalone instances.
+// Unlike the raft cluster, there is no consensus: the primary acknowledges writes before the replicas
+// receive them, and a replica serves the dataset as of the last command it has applied.
+//
+// A replica connects to the primary over the client protocol and sends PSYNC with the id of the stream it
+// followed last and the offset it reached. When the missing part of the stream is still in the primary's
+// backlog, the primary replies +CONTINUE and resumes the stream from the offset. Otherwise, it replies
+// +FULLRESYNC <id> <offset> followed by a bulk string that holds a point-in-time copy of the dataset,
+// and streams the write commands executed after the copy was taken.
+//
+// The stream is a sequence of RESP encoded commands, and offsets count its bytes. The primary selects the
+// database of the commands that follow with SELECT, and sends PING when there are no writes so that
+// replicas can tell a quiet link from a broken one. Replicas acknowledge the offset they've applied
+// with REPLCONF ACK <offset>.
+package replication
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"github.com/echovault/sugardb/internal"
+	"github.com/echovault/sugardb/internal/dump"
+)
+
+const (
+	// DefaultBacklogSize is the default number of bytes of the stream that the primary keeps
+	// for the partial resynchronization of replicas.
+	DefaultBacklogSize = 1024 * 1024
+	// PingInterval is the interval at which the primary pings replicas, and replicas acknowledge their offset.
+	PingInterval = time.Second
+	// Timeout is the time after which either side of the link considers it broken when it hasn't heard from the other.
+	Timeout = 60 * time.Second
+	// RetryInterval is the time a replica waits before it reconnects to the primary.
+	RetryInterval = time.Second
+)
+
+// entry is a key of the dataset sent in a full resynchronization.
+type entry struct {
+	Database int    `json:"Database"`
+	Key      string `json:"Key"`
+	Value    []byte `json:"Value"`    // The DUMP payload of the value.
+	ExpireAt int64  `json:"ExpireAt"` // Unix epoch in milliseconds. Zero when the key does not expire.
+}
+
+// EncodeState serializes the dataset sent to a replica in a full resynchronization.
+// The values are encoded as DUMP payloads, so their types are preserved.
+func EncodeState(state map[int]map[string]internal.KeyData) ([]byte, error) {
+	entries := make([]entry, 0)
+	for database, data := range state {
+		for key, keyData := range data {
+			value, err := dump.Encode(keyData.Value)
+			if err != nil {
+				return nil, err
+			}
+			e := entry{Database: database, Key: key, Value: value}
+			if keyData.ExpireAt != (time.Time{}) {
+				e.ExpireAt = keyData.ExpireAt.UnixMilli()
+			}
+			entries = append(entries, e)
+		}
+	}
+	return json.Marshal(entries)
+}
+
+// DecodeState deserializes a dataset created by EncodeState.
+func DecodeState(payload []byte) (map[int]map[string]internal.KeyData, error) {
+	var entries []entry
+	if err := json.Unmarshal(payload, &entries); err != nil {
+		return nil, err
+	}
+	state := make(map[int]map[string]internal.KeyData)
+	for _, e := range entries {
+		value, err := dump.Decode(e.Value)
+		if err != nil {
+			return nil, err
+		}
+		keyData := internal.KeyData{Value: value}
+		if e.ExpireAt != 0 {
+			keyData.ExpireAt = time.UnixMilli(e.ExpireAt)
+		}
+		if state[e.Database] == nil {
+			state[e.Database] = make(map[string]internal.KeyData)
+		}
+		state[e.Database][e.Key] = keyData
+	}
+	return state, nil
+}
+
+// newID returns a random 40 character replication id.
+func newID() string {
+	b := make([]byte, 20)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,90 @@
+// Copyright 2024 Kelvin Clement Mwinuka
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package replication
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/echovault/sugardb/internal"
+)
+
+func Test_Backlog(t *testing.T) {
+	b := newBacklog(8, 100)
+	b.write([]byte("abcde"))
+	b.write([]byte("fghij"))
+
+	if b.start() != 102 || b.end != 110 || b.histlen != 8 {
+		t.Fatalf("expected the backlog to hold offsets 102 to 110, got %d to %d", b.start(), b.end)
+	}
+
+	tests := []struct {
+		name   string
+		offset uint64
+		max    int
+		want   string
+		ok     bool
+	}{
+		{name: "1. Read across the end of the buffer", offset: 103, max: 16, want: "defghij", ok: true},
+		{name: "2. Read up to max bytes", offset: 102, max: 3, want: "cde", ok: true},
+		{name: "3. Read at the end", offset: 110, max: 16, want: "", ok: true},
+		{name: "4. Offset overwritten", offset: 101, max: 16, ok: false},
+		{name: "5. Offset not written yet", offset: 111, max: 16, ok: false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, ok := b.read(test.offset, test.max)
+			if ok != test.ok {
+				t.Fatalf("read(%d) ok = %v, want %v", test.offset, ok, test.ok)
+			}
+			if ok && string(got) != test.want {
+				t.Errorf("read(%d) = %q, want %q", test.offset, got, test.want)
+			}
+		})
+	}
+
+	t.Run("6. Write larger than the buffer", func(t *testing.T) {
+		b.write([]byte("0123456789"))
+		got, ok := b.read(b.start(), 16)
+		if !ok || string(got) != "23456789" || b.start() != 112 {
+			t.Errorf("read(%d) = %q, %v, want \"23456789\"", b.start(), got, ok)
+		}
+	})
+}
+
+func Test_EncodeDecodeState(t *testing.T) {
+	expireAt := time.UnixMilli(time.Now().Add(time.Hour).UnixMilli())
+	state := map[int]map[string]internal.KeyData{
+		0: {
+			"key1": {Value: "value1"},
+			"key2": {Value: 42, ExpireAt: expireAt},
+		},
+		3: {
+			"key3": {Value: []string{"a", "b"}},
+		},
+	}
+	payload, err := EncodeState(state)
+	if err != nil {
+		t.Fatalf("EncodeState() error = %v", err)
+	}
+	got, err := DecodeState(payload)
+	if err != nil {
+		t.Fatalf("DecodeState() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, state) {
+		t.Errorf("DecodeState() = %v, want %v", got, state)
+	}
+}
@@ -0,0 +1,382 @@
+// Copyright 2024 Kelvin Clement Mwinuka
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package sharding maps keys onto hash slots and hash slots onto shards.
+//
+// The keyspace is split into 16384 hash slots, the same way as in Redis Cluster, so that cluster clients
+// can compute the slot of a key locally. Each shard is a raft group that serves a set of slots.
+// The slots of a shard are recorded in the raft log of the shard and gossiped to the other shards.
+// Every change to the slots of a shard has a higher epoch than the epochs known by the node that makes
+// the change, so when two shards claim the same slot, the claim with the highest epoch wins.
+package sharding
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// SlotCount is the number of hash slots in the keyspace.
+const SlotCount = 16384
+
+// KeySlot returns the hash slot of the key.
+// If the key contains a non-empty hashtag, e.g. the "user1" in "{user1}.name", only the hashtag is hashed,
+// which allows related keys to be placed in the same slot.
+func KeySlot(key string) int {
+	if start := strings.IndexByte(key, '{'); start != -1 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			key = key[start+1 : start+1+end]
+		}
+	}
+	return int(crc16([]byte(key)) % SlotCount)
+}
+
+// crc16 implements the CRC16-CCITT (XMODEM) checksum used by Redis Cluster.
+func crc16(b []byte) uint16 {
+	var crc uint16
+	for _, c := range b {
+		crc ^= uint16(c) << 8
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// SlotRange is an inclusive range of hash slots.
+type SlotRange struct {
+	Start int `json:"Start"`
+	End   int `json:"End"`
+}
+
+// ParseSlotRanges parses comma separated slots and slot ranges, e.g. "0-5460,6000".
+func ParseSlotRanges(s string) ([]SlotRange, error) {
+	var slots []int
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		bounds := strings.SplitN(part, "-", 2)
+		start, err := parseSlot(bounds[0])
+		if err != nil {
+			return nil, err
+		}
+		end := start
+		if len(bounds) == 2 {
+			if end, err = parseSlot(bounds[1]); err != nil {
+				return nil, err
+			}
+		}
+		if start > end {
+			return nil, fmt.Errorf("invalid slot range %s", part)
+		}
+		for slot := start; slot <= end; slot++ {
+			slots = append(slots, slot)
+		}
+	}
+	return ToRanges(slots), nil
+}
+
+func parseSlot(s string) (int, error) {
+	slot, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil || slot < 0 || slot >= SlotCount {
+		return 0, fmt.Errorf("invalid slot %s, slots must be between 0 and %d", s, SlotCount-1)
+	}
+	return slot, nil
+}
+
+// ToRanges returns the sorted ranges that cover the slots. Duplicate slots are ignored.
+func ToRanges(slots []int) []SlotRange {
+	slots = slices.Clone(slots)
+	slices.Sort(slots)
+	slots = slices.Compact(slots)
+	var ranges []SlotRange
+	for _, slot := range slots {
+		if len(ranges) > 0 && ranges[len(ranges)-1].End == slot-1 {
+			ranges[len(ranges)-1].End = slot
+			continue
+		}
+		ranges = append(ranges, SlotRange{Start: slot, End: slot})
+	}
+	return ranges
+}
+
+// ExpandSlotRanges returns the sorted slots covered by the ranges.
+func ExpandSlotRanges(ranges []SlotRange) []int {
+	var slots []int
+	for _, r := range ranges {
+		for slot := r.Start; slot <= r.End; slot++ {
+			slots = append(slots, slot)
+		}
+	}
+	slices.Sort(slots)
+	return slices.Compact(slots)
+}
+
+// FormatSlotRanges formats the ranges in the format accepted by ParseSlotRanges.
+func FormatSlotRanges(ranges []SlotRange) string {
+	parts := make([]string, len(ranges))
+	for i, r := range ranges {
+		if r.Start == r.End {
+			parts[i] = strconv.Itoa(r.Start)
+		} else {
+			parts[i] = fmt.Sprintf("%d-%d", r.Start, r.End)
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// Shard describes the slots served by a shard.
+type Shard struct {
+	ID    string      `json:"ID"`
+	Epoch uint64      `json:"Epoch"`
+	Slots []SlotRange `json:"Slots"`
+	// Slots of this shard that are being migrated, mapped to the id of the destination shard.
+	Migrating map[int]string `json:"Migrating,omitempty"`
+	// Slots that are being migrated into this shard, mapped to the id of the source shard.
+	Importing map[int]string `json:"Importing,omitempty"`
+}
+
+// Owns reports whether the slot is in the slot ranges of the shard.
+func (shard Shard) Owns(slot int) bool {
+	for _, r := range shard.Slots {
+		if slot >= r.Start && slot <= r.End {
+			return true
+		}
+	}
+	return false
+}
+
+// SlotMap is a node's view of the slots served by each shard of the cluster.
+type SlotMap struct {
+	mut    sync.RWMutex
+	shards map[string]Shard
+	owners [SlotCount]string // The id of the shard that owns each slot. Empty when the slot is unassigned.
+}
+
+func NewSlotMap() *SlotMap {
+	return &SlotMap{shards: make(map[string]Shard)}
+}
+
+// Update records the shard if its epoch is higher than the epoch of the known record of the shard.
+// It reports whether the slot map changed.
+func (m *SlotMap) Update(shard Shard) bool {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	if current, ok := m.shards[shard.ID]; ok && current.Epoch >= shard.Epoch {
+		return false
+	}
+	m.shards[shard.ID] = shard
+	m.rebuild()
+	return true
+}
+
+// rebuild recomputes the owner of each slot. When multiple shards claim a slot,
+// the shard with the highest epoch owns it. Ties are broken by the lowest shard id.
+func (m *SlotMap) rebuild() {
+	ids := make([]string, 0, len(m.shards))
+	for id := range m.shards {
+		ids = append(ids, id)
+	}
+	slices.SortFunc(ids, func(a, b string) int {
+		if m.shards[a].Epoch != m.shards[b].Epoch {
+			if m.shards[a].Epoch < m.shards[b].Epoch {
+				return -1
+			}
+			return 1
+		}
+		return strings.Compare(b, a)
+	})
+	m.owners = [SlotCount]string{}
+	// Later shards take precedence over earlier ones.
+	for _, id := range ids {
+		for _, r := range m.shards[id].Slots {
+			for slot := r.Start; slot <= r.End; slot++ {
+				m.owners[slot] = id
+			}
+		}
+	}
+}
+
+// Shard returns the record of the shard with the given id.
+func (m *SlotMap) Shard(id string) (Shard, bool) {
+	m.mut.RLock()
+	defer m.mut.RUnlock()
+	shard, ok := m.shards[id]
+	return shard, ok
+}
+
+// Shards returns the records of all the known shards, sorted by id.
+// The slot ranges of each shard only include the slots the shard owns.
+func (m *SlotMap) Shards() []Shard {
+	m.mut.RLock()
+	defer m.mut.RUnlock()
+	owned := make(map[string][]int)
+	for slot, id := range m.owners {
+		if id != "" {
+			owned[id] = append(owned[id], slot)
+		}
+	}
+	shards := make([]Shard, 0, len(m.shards))
+	for _, shard := range m.shards {
+		shard.Slots = ToRanges(owned[shard.ID])
+		shards = append(shards, shard)
+	}
+	slices.SortFunc(shards, func(a, b Shard) int {
+		return strings.Compare(a.ID, b.ID)
+	})
+	return shards
+}
+
+// Records returns the records of all the known shards as they were received, sorted by id.
+func (m *SlotMap) Records() []Shard {
+	m.mut.RLock()
+	defer m.mut.RUnlock()
+	shards := make([]Shard, 0, len(m.shards))
+	for _, shard := range m.shards {
+		shards = append(shards, shard)
+	}
+	slices.SortFunc(shards, func(a, b Shard) int {
+		return strings.Compare(a.ID, b.ID)
+	})
+	return shards
+}
+
+// Owner returns the id of the shard that owns the slot. It's empty when the slot is unassigned.
+func (m *SlotMap) Owner(slot int) string {
+	m.mut.RLock()
+	defer m.mut.RUnlock()
+	return m.owners[slot]
+}
+
+// MaxEpoch returns the highest epoch known by the node.
+func (m *SlotMap) MaxEpoch() uint64 {
+	m.mut.RLock()
+	defer m.mut.RUnlock()
+	var epoch uint64
+	for _, shard := range m.shards {
+		epoch = max(epoch, shard.Epoch)
+	}
+	return epoch
+}
+
+// Empty reports whether no shard has been recorded yet.
+func (m *SlotMap) Empty() bool {
+	m.mut.RLock()
+	defer m.mut.RUnlock()
+	return len(m.shards) == 0
+}
+
+type RouteKind int
+
+const (
+	RouteLocal      RouteKind = iota // The slot is served by the local shard.
+	RouteMigrating                   // The slot is served by the local shard, but is being migrated to Route.Shard.
+	RouteImporting                   // The slot is being imported by the local shard, and the client sent ASKING.
+	RouteMoved                       // The slot is served by Route.Shard.
+	RouteUnassigned                  // The slot is not served by any shard.
+)
+
+type Route struct {
+	Kind  RouteKind
+	Slot  int
+	Shard string
+}
+
+// Route decides where a command on the slot is served, from the point of view of a node in the local shard.
+// asking reports whether the client sent ASKING before the command.
+func (m *SlotMap) Route(local string, slot int, asking bool) Route {
+	m.mut.RLock()
+	defer m.mut.RUnlock()
+
+	owner := m.owners[slot]
+	if owner == local {
+		if destination, ok := m.shards[local].Migrating[slot]; ok {
+			return Route{Kind: RouteMigrating, Slot: slot, Shard: destination}
+		}
+		return Route{Kind: RouteLocal, Slot: slot, Shard: local}
+	}
+	if _, ok := m.shards[local].Importing[slot]; ok && asking {
+		return Route{Kind: RouteImporting, Slot: slot, Shard: local}
+	}
+	if owner == "" {
+		return Route{Kind: RouteUnassigned, Slot: slot}
+	}
+	return Route{Kind: RouteMoved, Slot: slot, Shard: owner}
+}
+
+// Error is an error that cluster clients act on, e.g. a MOVED redirection.
+// Its message starts with the error code and is sent to the client as is, without the generic error prefix.
+type Error struct {
+	msg string
+}
+
+func (err *Error) Error() string {
+	return err.msg
+}
+
+// NewError returns a cluster error with the message formatted according to the format specifier.
+func NewError(format string, a ...any) *Error {
+	return &Error{msg: fmt.Sprintf(format, a...)}
+}
+
+// IsError reports whether the error is a cluster error.
+func IsError(err error) bool {
+	var clusterErr *Error
+	return errors.As(err, &clusterErr)
+}
+
+var (
+	// ErrCrossSlot is returned when the keys of a command hash to different slots.
+	ErrCrossSlot = NewError("CROSSSLOT Keys in request don't hash to the same slot")
+	// ErrReadOnly is returned when a write command is sent to a non-voting replica.
+	ErrReadOnly = NewError("READONLY You can't write against a read only replica.")
+	// ErrClusterDown is returned when the slot of a command is not served by any shard.
+	ErrClusterDown = NewError("CLUSTERDOWN Hash slot not served")
+	// ErrTryAgain is returned when some of the keys of a multi-key command have been migrated.
+	ErrTryAgain = NewError("TRYAGAIN Multiple keys request during rehashing of slot")
+)
+
+// MovedError tells the client that the slot is served by the node at addr.
+func MovedError(slot int, addr string) *Error {
+	return NewError("MOVED %d %s", slot, addr)
+}
+
+// AskError tells the client to send ASKING followed by the command to the node at addr, as the slot is being
+// migrated to it.
+func AskError(slot int, addr string) *Error {
+	return NewError("ASK %d %s", slot, addr)
+}
+
+// CommandSlot returns the slot of the keys. It returns -1 when there are no keys,
+// and ErrCrossSlot when the keys hash to different slots.
+func CommandSlot(keys []string) (int, error) {
+	slot := -1
+	for _, key := range keys {
+		s := KeySlot(key)
+		if slot != -1 && s != slot {
+			return -1, ErrCrossSlot
+		}
+		slot = s
+	}
+	return slot, nil
+}
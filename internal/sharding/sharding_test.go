@@ -0,0 +1,194 @@
+// Copyright 2024 Kelvin Clement Mwinuka
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sharding
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func Test_KeySlot(t *testing.T) {
+	tests := []struct {
+		key  string
+		want int
+	}{
+		{key: "", want: 0},
+		{key: "123456789", want: 12739}, // CRC16 XMODEM check value 0x31C3.
+		{key: "foo", want: 12182},
+		{key: "bar", want: 5061},
+		{key: "{user1000}.following", want: KeySlot("user1000")},
+		{key: "{user1000}.followers", want: KeySlot("user1000")},
+		{key: "foo{}{bar}", want: KeySlot("foo{}{bar}")}, // Empty hashtag, the whole key is hashed.
+		{key: "foo{{bar}}zap", want: KeySlot("{bar")},
+		{key: "foo{bar}{zap}", want: KeySlot("bar")},
+	}
+	for _, test := range tests {
+		if got := KeySlot(test.key); got != test.want {
+			t.Errorf("KeySlot(%q) = %d, want %d", test.key, got, test.want)
+		}
+	}
+}
+
+func Test_ParseSlotRanges(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    []SlotRange
+		wantErr bool
+	}{
+		{input: "0-16383", want: []SlotRange{{Start: 0, End: 16383}}},
+		{input: "0-100, 200,101-150", want: []SlotRange{{Start: 0, End: 150}, {Start: 200, End: 200}}},
+		{input: "5,5,6", want: []SlotRange{{Start: 5, End: 6}}},
+		{input: "", want: nil},
+		{input: "10-5", wantErr: true},
+		{input: "0-16384", wantErr: true},
+		{input: "a-b", wantErr: true},
+	}
+	for _, test := range tests {
+		got, err := ParseSlotRanges(test.input)
+		if (err != nil) != test.wantErr {
+			t.Errorf("ParseSlotRanges(%q) error = %v, wantErr %v", test.input, err, test.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("ParseSlotRanges(%q) = %v, want %v", test.input, got, test.want)
+		}
+		if err == nil && test.input != "" {
+			if formatted, _ := ParseSlotRanges(FormatSlotRanges(got)); !reflect.DeepEqual(formatted, got) {
+				t.Errorf("FormatSlotRanges(%v) does not round trip", got)
+			}
+		}
+	}
+}
+
+func Test_ExpandSlotRanges(t *testing.T) {
+	got := ExpandSlotRanges([]SlotRange{{Start: 5, End: 7}, {Start: 1, End: 1}, {Start: 6, End: 8}})
+	if want := []int{1, 5, 6, 7, 8}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ExpandSlotRanges() = %v, want %v", got, want)
+	}
+	if got = ExpandSlotRanges(nil); len(got) != 0 {
+		t.Errorf("ExpandSlotRanges(nil) = %v, want no slots", got)
+	}
+}
+
+func Test_SlotMap(t *testing.T) {
+	t.Run("Test_UpdateEpochs", func(t *testing.T) {
+		m := NewSlotMap()
+		if !m.Empty() {
+			t.Error("expected new slot map to be empty")
+		}
+		if !m.Update(Shard{ID: "a", Epoch: 1, Slots: []SlotRange{{Start: 0, End: 8191}}}) {
+			t.Error("expected update of new shard to change the slot map")
+		}
+		if !m.Update(Shard{ID: "b", Epoch: 2, Slots: []SlotRange{{Start: 8192, End: 16383}}}) {
+			t.Error("expected update of new shard to change the slot map")
+		}
+		// Records with an epoch that is not higher than the known epoch are ignored.
+		if m.Update(Shard{ID: "a", Epoch: 1, Slots: []SlotRange{{Start: 0, End: 16383}}}) {
+			t.Error("expected update with the same epoch to be ignored")
+		}
+		if m.Owner(0) != "a" || m.Owner(8191) != "a" || m.Owner(8192) != "b" || m.Owner(16383) != "b" {
+			t.Errorf("unexpected owners %s %s %s %s", m.Owner(0), m.Owner(8191), m.Owner(8192), m.Owner(16383))
+		}
+		if m.MaxEpoch() != 2 {
+			t.Errorf("expected max epoch 2, got %d", m.MaxEpoch())
+		}
+
+		// Shard a claims slot 9000 with a higher epoch, so it takes over the slot from shard b.
+		m.Update(Shard{ID: "a", Epoch: 3, Slots: []SlotRange{{Start: 0, End: 8191}, {Start: 9000, End: 9000}}})
+		if m.Owner(9000) != "a" {
+			t.Errorf("expected shard a to own slot 9000, got %s", m.Owner(9000))
+		}
+		want := []Shard{
+			{ID: "a", Epoch: 3, Slots: []SlotRange{{Start: 0, End: 8191}, {Start: 9000, End: 9000}}},
+			{ID: "b", Epoch: 2, Slots: []SlotRange{{Start: 8192, End: 8999}, {Start: 9001, End: 16383}}},
+		}
+		if got := m.Shards(); !reflect.DeepEqual(got, want) {
+			t.Errorf("expected shards %+v, got %+v", want, got)
+		}
+		// The records keep the slots as they were claimed.
+		if got := m.Records()[1].Slots; !reflect.DeepEqual(got, []SlotRange{{Start: 8192, End: 16383}}) {
+			t.Errorf("expected the record of shard b to be unchanged, got %+v", got)
+		}
+	})
+
+	t.Run("Test_TieBreak", func(t *testing.T) {
+		m := NewSlotMap()
+		m.Update(Shard{ID: "b", Epoch: 1, Slots: []SlotRange{{Start: 0, End: 10}}})
+		m.Update(Shard{ID: "a", Epoch: 1, Slots: []SlotRange{{Start: 5, End: 15}}})
+		if m.Owner(7) != "a" {
+			t.Errorf("expected the lowest shard id to own a slot claimed with the same epoch, got %s", m.Owner(7))
+		}
+	})
+
+	t.Run("Test_Route", func(t *testing.T) {
+		m := NewSlotMap()
+		m.Update(Shard{
+			ID:        "a",
+			Epoch:     1,
+			Slots:     []SlotRange{{Start: 0, End: 99}},
+			Migrating: map[int]string{10: "b"},
+			Importing: map[int]string{200: "b"},
+		})
+		m.Update(Shard{ID: "b", Epoch: 2, Slots: []SlotRange{{Start: 100, End: 299}}})
+
+		tests := []struct {
+			name   string
+			slot   int
+			asking bool
+			want   Route
+		}{
+			{name: "1. Local slot", slot: 5, want: Route{Kind: RouteLocal, Slot: 5, Shard: "a"}},
+			{name: "2. Migrating slot", slot: 10, want: Route{Kind: RouteMigrating, Slot: 10, Shard: "b"}},
+			{name: "3. Moved slot", slot: 150, want: Route{Kind: RouteMoved, Slot: 150, Shard: "b"}},
+			{name: "4. Importing slot without ASKING", slot: 200, want: Route{Kind: RouteMoved, Slot: 200, Shard: "b"}},
+			{name: "5. Importing slot with ASKING", slot: 200, asking: true, want: Route{Kind: RouteImporting, Slot: 200, Shard: "a"}},
+			{name: "6. Unassigned slot", slot: 1000, want: Route{Kind: RouteUnassigned, Slot: 1000}},
+		}
+		for _, test := range tests {
+			if got := m.Route("a", test.slot, test.asking); got != test.want {
+				t.Errorf("%s: expected route %+v, got %+v", test.name, test.want, got)
+			}
+		}
+	})
+}
+
+func Test_CommandSlot(t *testing.T) {
+	if slot, err := CommandSlot(nil); slot != -1 || err != nil {
+		t.Errorf("expected -1 and no error without keys, got %d %v", slot, err)
+	}
+	if slot, err := CommandSlot([]string{"{user1}.a", "{user1}.b"}); slot != KeySlot("user1") || err != nil {
+		t.Errorf("expected slot %d, got %d %v", KeySlot("user1"), slot, err)
+	}
+	if _, err := CommandSlot([]string{"foo", "bar"}); !errors.Is(err, ErrCrossSlot) {
+		t.Errorf("expected ErrCrossSlot, got %v", err)
+	}
+}
+
+func Test_Error(t *testing.T) {
+	if err := MovedError(3999, "127.0.0.1:6381"); err.Error() != "MOVED 3999 127.0.0.1:6381" {
+		t.Errorf("unexpected MOVED error %q", err.Error())
+	}
+	if err := AskError(3999, "127.0.0.1:6381"); err.Error() != "ASK 3999 127.0.0.1:6381" {
+		t.Errorf("unexpected ASK error %q", err.Error())
+	}
+	if !IsError(fmt.Errorf("wrapped: %w", ErrClusterDown)) {
+		t.Error("expected wrapped cluster error to be a cluster error")
+	}
+	if IsError(errors.New("CROSSSLOT")) {
+		t.Error("expected plain error not to be a cluster error")
+	}
+}
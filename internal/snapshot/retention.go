@@ -0,0 +1,293 @@
+// Copyright 2024 Kelvin Clement Mwinuka
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snapshot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/echovault/sugardb/internal"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Retention determines which snapshots are kept after a new snapshot is taken.
+// A snapshot is kept if it's retained by any of the policies. The latest snapshot is always kept.
+// When all the policies are 0, all the snapshots are kept.
+type Retention struct {
+	Last   int // Keep the N most recent snapshots.
+	Hourly int // Keep the most recent snapshot of each of the N most recent hours that have a snapshot.
+	Daily  int // Keep the most recent snapshot of each of the N most recent days that have a snapshot.
+}
+
+func WithRetention(retention Retention) func(engine *Engine) {
+	return func(engine *Engine) {
+		engine.retention = retention
+	}
+}
+
+// ids returns the ids of all the snapshots in the snapshot directory, from the most recent to the oldest.
+// The id of a snapshot is the unix time in milliseconds at which it was taken.
+func (engine *Engine) ids() ([]int64, error) {
+	entries, err := os.ReadDir(path.Join(engine.directory, "snapshots"))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return []int64{}, nil
+		}
+		return nil, err
+	}
+	ids := make([]int64, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		id, err := strconv.ParseInt(entry.Name(), 10, 64)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	slices.SortFunc(ids, func(a, b int64) int {
+		if a > b {
+			return -1
+		}
+		if a < b {
+			return 1
+		}
+		return 0
+	})
+	return ids, nil
+}
+
+// retained returns the ids that must be kept according to the retention policies.
+func (engine *Engine) retained(ids []int64, retention Retention) map[int64]bool {
+	keep := make(map[int64]bool)
+	if len(ids) > 0 {
+		keep[ids[0]] = true
+	}
+	if latest := engine.getLatestSnapshotTimeFunc(); latest != 0 {
+		keep[latest] = true
+	}
+
+	for i := 0; i < len(ids) && i < retention.Last; i++ {
+		keep[ids[i]] = true
+	}
+
+	keepPeriods := func(period time.Duration, count int) {
+		seen := make(map[int64]bool)
+		// The ids are sorted from the most recent, so the first id in each period is the one to keep.
+		for _, id := range ids {
+			bucket := time.UnixMilli(id).UTC().Truncate(period).UnixMilli()
+			if seen[bucket] {
+				continue
+			}
+			if len(seen) >= count {
+				return
+			}
+			seen[bucket] = true
+			keep[id] = true
+		}
+	}
+	keepPeriods(time.Hour, retention.Hourly)
+	keepPeriods(24*time.Hour, retention.Daily)
+
+	return keep
+}
+
+// applyRetention deletes the snapshots that are not retained by any of the retention policies.
+func (engine *Engine) applyRetention() error {
+	engine.statusMut.RLock()
+	retention := engine.retention
+	engine.statusMut.RUnlock()
+
+	if retention == (Retention{}) {
+		return nil
+	}
+
+	ids, err := engine.ids()
+	if err != nil {
+		return err
+	}
+
+	keep := engine.retained(ids, retention)
+	for _, id := range ids {
+		if keep[id] {
+			continue
+		}
+		if err = os.RemoveAll(path.Join(engine.directory, "snapshots", strconv.FormatInt(id, 10))); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// List returns the information about all the snapshots on disk, from the most recent to the oldest.
+func (engine *Engine) List() ([]internal.SnapshotInfo, error) {
+	ids, err := engine.ids()
+	if err != nil {
+		return nil, err
+	}
+
+	latest := engine.getLatestSnapshotTimeFunc()
+
+	snapshots := make([]internal.SnapshotInfo, 0, len(ids))
+	for _, id := range ids {
+		fi, err := os.Stat(path.Join(engine.directory, "snapshots", strconv.FormatInt(id, 10), "state.bin"))
+		if err != nil {
+			// Skip snapshot directories without a state file.
+			continue
+		}
+		snapshotObject, err := engine.Load(id)
+		if err != nil {
+			return nil, err
+		}
+		info := internal.SnapshotInfo{
+			Id:        id,
+			Size:      fi.Size(),
+			Databases: make(map[int]int),
+			Latest:    id == latest,
+		}
+		for database, data := range snapshotObject.State {
+			info.Databases[database] = len(data)
+			info.Keys += len(data)
+		}
+		snapshots = append(snapshots, info)
+	}
+
+	return snapshots, nil
+}
+
+// Load reads the snapshot with the given id. Expired keys are removed from the returned state.
+func (engine *Engine) Load(id int64) (internal.SnapshotObject, error) {
+	b, err := os.ReadFile(path.Join(engine.directory, "snapshots", strconv.FormatInt(id, 10), "state.bin"))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return internal.SnapshotObject{}, fmt.Errorf("snapshot %d not found", id)
+		}
+		return internal.SnapshotObject{}, err
+	}
+
+	if b, err = engine.cipher.Open(b); err != nil {
+		return internal.SnapshotObject{}, fmt.Errorf("snapshot %d: %w", id, err)
+	}
+
+	snapshotObject := internal.SnapshotObject{}
+	if err = json.Unmarshal(b, &snapshotObject); err != nil {
+		return internal.SnapshotObject{}, err
+	}
+	snapshotObject.State = internal.FilterExpiredKeys(engine.clock.Now(), snapshotObject.State)
+
+	return snapshotObject, nil
+}
+
+// WithExportDirectory sets the directory that Export writes to.
+func WithExportDirectory(directory string) func(engine *Engine) {
+	return func(engine *Engine) {
+		engine.exportDirectory = directory
+	}
+}
+
+// Export writes a database from the snapshot with the given id to the file at the given path.
+// The path is relative to the export directory, or an absolute path inside it, so that a client can't write
+// anywhere else. The file has the same format as a snapshot state file, so it can be placed in the snapshot
+// directory of another instance and restored from there.
+func (engine *Engine) Export(id int64, database int, name string) error {
+	directory := engine.exportDirectory
+	if directory == "" {
+		directory = path.Join(engine.directory, "export")
+	}
+	directory, err := filepath.Abs(directory)
+	if err != nil {
+		return err
+	}
+	file, err := exportPath(directory, name)
+	if err != nil {
+		return err
+	}
+
+	snapshotObject, err := engine.Load(id)
+	if err != nil {
+		return err
+	}
+
+	data, ok := snapshotObject.State[database]
+	if !ok {
+		return fmt.Errorf("database %d not found in snapshot %d", database, id)
+	}
+
+	out, err := json.Marshal(internal.SnapshotObject{
+		State:                      map[int]map[string]internal.KeyData{database: data},
+		LatestSnapshotMilliseconds: snapshotObject.LatestSnapshotMilliseconds,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return err
+	}
+	// A symbolic link in the export directory must not lead the file outside of it.
+	if err = checkExportLinks(directory, file); err != nil {
+		return err
+	}
+
+	return os.WriteFile(file, engine.cipher.Seal(out), 0600)
+}
+
+// exportPath returns the path of the export file name in the absolute export directory.
+// It returns an error when the name leads outside of the directory.
+func exportPath(directory string, name string) (string, error) {
+	file := name
+	if !filepath.IsAbs(file) {
+		file = filepath.Join(directory, file)
+	}
+	if !insideDirectory(directory, file) {
+		return "", fmt.Errorf("export path %s is outside of the export directory %s", name, directory)
+	}
+	return filepath.Clean(file), nil
+}
+
+// checkExportLinks returns an error when the export file is a symbolic link, or when its directory resolves
+// outside of the export directory once the symbolic links are followed.
+func checkExportLinks(directory string, file string) error {
+	if fi, err := os.Lstat(file); err == nil && fi.Mode()&fs.ModeSymlink != 0 {
+		return fmt.Errorf("export path %s is a symbolic link", file)
+	}
+	resolvedDirectory, err := filepath.EvalSymlinks(directory)
+	if err != nil {
+		return err
+	}
+	resolvedDir, err := filepath.EvalSymlinks(filepath.Dir(file))
+	if err != nil {
+		return err
+	}
+	if resolvedDir != resolvedDirectory && !insideDirectory(resolvedDirectory, resolvedDir) {
+		return fmt.Errorf("export path %s is outside of the export directory %s", file, directory)
+	}
+	return nil
+}
+
+// insideDirectory returns true when the file is in the directory or one of its subdirectories.
+func insideDirectory(directory string, file string) bool {
+	rel, err := filepath.Rel(directory, file)
+	return err == nil && rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
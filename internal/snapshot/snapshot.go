@@ -15,17 +15,18 @@
 package snapshot
 
 import (
-	"crypto/md5"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/echovault/sugardb/internal"
 	"github.com/echovault/sugardb/internal/clock"
+	"github.com/echovault/sugardb/internal/encryption"
 	"io"
 	"io/fs"
 	"log"
 	"os"
 	"path"
+	"sync"
 	"sync/atomic"
 	"time"
 )
@@ -33,23 +34,57 @@ import (
 // This package contains the snapshot engine for standalone mode.
 // Snapshots in cluster mode will be handled using the raft package in the raft layer.
 
+// ErrNothingToSnapshot is returned when the state has not changed since the latest snapshot.
+var ErrNothingToSnapshot = errors.New("nothing new to snapshot")
+
+// ErrSnapshotInProgress is returned when a snapshot is requested while another one is being taken.
+var ErrSnapshotInProgress = errors.New("snapshot already in progress")
+
+// bgSaveRetryDelay is the time to wait before retrying an automatic snapshot after a failed one.
+const bgSaveRetryDelay = 5 * time.Second
+
 type Manifest struct {
 	LatestSnapshotMilliseconds int64
 	LatestSnapshotHash         [16]byte
 }
 
+// SaveRule triggers an automatic snapshot when at least Changes writes have been made
+// and at least Interval has elapsed since the last successful snapshot.
+type SaveRule struct {
+	Interval time.Duration
+	Changes  uint64
+}
+
+// Status holds the statistics of the snapshot engine.
+type Status struct {
+	ChangesSinceLastSave uint64        // Number of writes since the last successful snapshot.
+	LastSaveTime         time.Time     // Time of the last successful snapshot, or of engine start if there's none.
+	LastSaveError        error         // The error returned by the latest snapshot attempt, nil if it succeeded.
+	LastSaveDuration     time.Duration // Time taken by the latest snapshot attempt.
+	Saves                uint64        // Number of successful snapshots since the engine was started.
+}
+
 type Engine struct {
 	clock                     clock.Clock
 	changeCount               atomic.Uint64
 	directory                 string
 	snapshotInterval          time.Duration
 	snapshotThreshold         uint64
+	saveRules                 []SaveRule
+	snapshotMut               sync.Mutex // Ensures only one snapshot is taken at a time.
+	statusMut                 sync.RWMutex
+	status                    Status
+	lastSave                  time.Time // Monotonic time of the last successful snapshot, used to evaluate the save rules.
+	lastAttempt               time.Time // Monotonic time of the latest snapshot attempt.
 	startSnapshotFunc         func()
 	finishSnapshotFunc        func()
 	getStateFunc              func() map[int]map[string]internal.KeyData
 	setLatestSnapshotTimeFunc func(msec int64)
 	getLatestSnapshotTimeFunc func() int64
 	setKeyDataFunc            func(database int, key string, data internal.KeyData)
+	retention                 Retention
+	exportDirectory           string // The directory Export writes to. Defaults to "export" in the directory.
+	cipher                    *encryption.Cipher
 }
 
 func WithClock(clock clock.Clock) func(engine *Engine) {
@@ -76,6 +111,22 @@ func WithThreshold(threshold uint64) func(engine *Engine) {
 	}
 }
 
+// WithSaveRules sets the rules that trigger automatic snapshots. A snapshot is taken when any of the rules match.
+// When no rules are provided, a single rule is derived from the interval and threshold options.
+func WithSaveRules(rules ...SaveRule) func(engine *Engine) {
+	return func(engine *Engine) {
+		engine.saveRules = rules
+	}
+}
+
+// WithCipher sets the cipher used to encrypt the snapshots at rest.
+// Changing the active key causes the next snapshot to be taken even if the state has not changed.
+func WithCipher(cipher *encryption.Cipher) func(engine *Engine) {
+	return func(engine *Engine) {
+		engine.cipher = cipher
+	}
+}
+
 func WithStartSnapshotFunc(f func()) func(engine *Engine) {
 	return func(engine *Engine) {
 		engine.startSnapshotFunc = f
@@ -135,30 +186,139 @@ func NewSnapshotEngine(options ...func(engine *Engine)) *Engine {
 		option(engine)
 	}
 
-	if engine.snapshotInterval != 0 {
-		go func() {
-			ticker := time.NewTicker(engine.snapshotInterval)
-			defer func() {
-				ticker.Stop()
-			}()
-			for {
-				<-ticker.C
-				if engine.changeCount.Load() == engine.snapshotThreshold {
-					if err := engine.TakeSnapshot(); err != nil {
-						log.Println(err)
-					}
-				}
+	engine.saveRules = deriveSaveRules(engine.snapshotInterval, engine.snapshotThreshold, engine.saveRules)
+
+	engine.status.LastSaveTime = engine.clock.Now()
+	engine.lastSave = time.Now()
+
+	go func() {
+		for {
+			<-time.After(engine.tickInterval())
+			if !engine.shouldSnapshot() {
+				continue
 			}
-		}()
-	}
+			if err := engine.TakeSnapshot(); err != nil && !errors.Is(err, ErrSnapshotInProgress) {
+				log.Println(err)
+			}
+		}
+	}()
 
 	return engine
 }
 
+// deriveSaveRules returns the save rules, or a single rule derived from the interval and threshold
+// if no save rules are provided.
+func deriveSaveRules(interval time.Duration, threshold uint64, rules []SaveRule) []SaveRule {
+	if len(rules) == 0 && interval != 0 {
+		return []SaveRule{{Interval: interval, Changes: threshold}}
+	}
+	return rules
+}
+
+// SetSaveRules replaces the rules that trigger automatic snapshots. The rules take effect from the next check.
+// When no rules are provided, a single rule is derived from the interval and threshold.
+func (engine *Engine) SetSaveRules(interval time.Duration, threshold uint64, rules ...SaveRule) {
+	engine.statusMut.Lock()
+	defer engine.statusMut.Unlock()
+	engine.snapshotInterval = interval
+	engine.snapshotThreshold = threshold
+	engine.saveRules = deriveSaveRules(interval, threshold, rules)
+}
+
+// SetRetention replaces the retention policies applied after the next snapshot.
+func (engine *Engine) SetRetention(retention Retention) {
+	engine.statusMut.Lock()
+	defer engine.statusMut.Unlock()
+	engine.retention = retention
+}
+
+// tickInterval returns the time between checks of the save rules. The rules are checked every second,
+// or more often if a rule has a shorter interval.
+func (engine *Engine) tickInterval() time.Duration {
+	engine.statusMut.RLock()
+	defer engine.statusMut.RUnlock()
+	tickInterval := time.Second
+	for _, rule := range engine.saveRules {
+		if rule.Interval > 0 && rule.Interval < tickInterval {
+			tickInterval = rule.Interval
+		}
+	}
+	return tickInterval
+}
+
+// shouldSnapshot returns true when any of the save rules match.
+// After a failed snapshot, automatic snapshots are retried only after bgSaveRetryDelay.
+func (engine *Engine) shouldSnapshot() bool {
+	engine.statusMut.RLock()
+	defer engine.statusMut.RUnlock()
+
+	now := time.Now()
+	changes := engine.changeCount.Load()
+
+	if changes == 0 {
+		return false
+	}
+	if engine.status.LastSaveError != nil && now.Sub(engine.lastAttempt) < bgSaveRetryDelay {
+		return false
+	}
+
+	for _, rule := range engine.saveRules {
+		if changes >= rule.Changes && now.Sub(engine.lastSave) >= rule.Interval {
+			return true
+		}
+	}
+	return false
+}
+
+// Status returns the current statistics of the snapshot engine.
+func (engine *Engine) Status() Status {
+	engine.statusMut.RLock()
+	defer engine.statusMut.RUnlock()
+	status := engine.status
+	status.ChangesSinceLastSave = engine.changeCount.Load()
+	return status
+}
+
+// TakeSnapshot takes a snapshot of the current state and records the outcome in the engine's status.
+// Returns ErrSnapshotInProgress if another snapshot is being taken.
 func (engine *Engine) TakeSnapshot() error {
+	if !engine.snapshotMut.TryLock() {
+		return ErrSnapshotInProgress
+	}
+	defer engine.snapshotMut.Unlock()
+
 	engine.startSnapshotFunc()
 	defer engine.finishSnapshotFunc()
 
+	start := time.Now()
+	changes := engine.changeCount.Load()
+
+	err := engine.takeSnapshot()
+
+	engine.statusMut.Lock()
+	defer engine.statusMut.Unlock()
+
+	engine.lastAttempt = time.Now()
+	engine.status.LastSaveDuration = engine.lastAttempt.Sub(start)
+
+	if err != nil && !errors.Is(err, ErrNothingToSnapshot) {
+		engine.status.LastSaveError = err
+		return err
+	}
+
+	// Only discount the changes that were included in this snapshot.
+	engine.changeCount.Add(^(changes - 1))
+	engine.status.LastSaveError = nil
+	engine.status.LastSaveTime = engine.clock.Now()
+	engine.lastSave = start
+	if err == nil {
+		engine.status.Saves += 1
+	}
+
+	return err
+}
+
+func (engine *Engine) takeSnapshot() error {
 	// Extract current time
 	msec := engine.clock.Now().UnixMilli()
 
@@ -227,9 +387,9 @@ func (engine *Engine) TakeSnapshot() error {
 		return err
 	}
 
-	snapshotHash := md5.Sum(out)
+	snapshotHash := engine.cipher.Digest(out)
 	if snapshotHash == manifest.LatestSnapshotHash {
-		return errors.New("nothing new to snapshot")
+		return ErrNothingToSnapshot
 	}
 
 	// Update the snapshotObject
@@ -250,7 +410,7 @@ func (engine *Engine) TakeSnapshot() error {
 
 	// Write the latest manifest data
 	manifest = &Manifest{
-		LatestSnapshotHash:         md5.Sum(out),
+		LatestSnapshotHash:         engine.cipher.Digest(out),
 		LatestSnapshotMilliseconds: msec,
 	}
 	mo, err := json.Marshal(manifest)
@@ -277,7 +437,7 @@ func (engine *Engine) TakeSnapshot() error {
 	}
 
 	// Create snapshot file
-	f, err := os.OpenFile(path.Join(dirname, "state.bin"), os.O_WRONLY|os.O_CREATE, os.ModePerm)
+	f, err := os.OpenFile(path.Join(dirname, "state.bin"), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, os.ModePerm)
 	if err != nil {
 		log.Println(err)
 		return err
@@ -289,7 +449,7 @@ func (engine *Engine) TakeSnapshot() error {
 	}()
 
 	// Write state to file
-	if _, err = f.Write(out); err != nil {
+	if _, err = f.Write(engine.cipher.Seal(out)); err != nil {
 		return err
 	}
 	if err = f.Sync(); err != nil {
@@ -299,71 +459,53 @@ func (engine *Engine) TakeSnapshot() error {
 	// Set the latest snapshot in unix milliseconds
 	engine.setLatestSnapshotTimeFunc(msec)
 
-	// Reset the change count
-	engine.resetChangeCount()
+	// Remove the snapshots that are no longer retained.
+	if err = engine.applyRetention(); err != nil {
+		log.Printf("snapshot retention error: %+v\n", err)
+	}
 
 	return nil
 }
 
+// Restore restores the latest snapshot. This is the snapshot in the manifest, unless there's a more recent
+// snapshot in the snapshot directory that is not in the manifest, e.g. one that was restored from a backup.
 func (engine *Engine) Restore() error {
-	mf, err := os.Open(path.Join(engine.directory, "snapshots", "manifest.bin"))
-	if err != nil && errors.Is(err, fs.ErrNotExist) {
-		return errors.New("no snapshot manifest, skipping snapshot restore")
-	}
+	ids, err := engine.ids()
 	if err != nil {
 		return err
 	}
-	defer func() {
-		if err := mf.Close(); err != nil {
-			log.Println(err)
-		}
-	}()
 
 	manifest := new(Manifest)
-
-	md, err := io.ReadAll(mf)
-	if err != nil {
+	md, err := os.ReadFile(path.Join(engine.directory, "snapshots", "manifest.bin"))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
 		return err
 	}
-
-	if err = json.Unmarshal(md, manifest); err != nil {
-		return err
+	if errors.Is(err, fs.ErrNotExist) && len(ids) == 0 {
+		return errors.New("no snapshot manifest, skipping snapshot restore")
 	}
-
-	if manifest.LatestSnapshotMilliseconds == 0 {
-		return errors.New("no snapshot to restore")
+	if err == nil {
+		if err = json.Unmarshal(md, manifest); err != nil {
+			return err
+		}
 	}
 
-	sf, err := os.Open(path.Join(
-		engine.directory,
-		"snapshots",
-		fmt.Sprintf("%d", manifest.LatestSnapshotMilliseconds),
-		"state.bin"))
-	if err != nil && errors.Is(err, fs.ErrNotExist) {
-		return fmt.Errorf("snapshot file %d/state.bin not found, skipping snapshot", manifest.LatestSnapshotMilliseconds)
+	latest := manifest.LatestSnapshotMilliseconds
+	if len(ids) > 0 && ids[0] > latest {
+		// The ids are sorted in descending order.
+		latest = ids[0]
 	}
-	if err != nil {
-		return err
+	if latest == 0 {
+		return errors.New("no snapshot to restore")
 	}
-	defer func() {
-		if err := sf.Close(); err != nil {
-			log.Println(err)
-		}
-	}()
 
-	sd, err := io.ReadAll(sf)
+	snapshotObject, err := engine.Load(latest)
 	if err != nil {
-		return nil
-	}
-
-	snapshotObject := new(internal.SnapshotObject)
-	if err = json.Unmarshal(sd, snapshotObject); err != nil {
 		return err
 	}
 
 	engine.setLatestSnapshotTimeFunc(snapshotObject.LatestSnapshotMilliseconds)
 
-	for database, data := range internal.FilterExpiredKeys(engine.clock.Now(), snapshotObject.State) {
+	for database, data := range snapshotObject.State {
 		for key, keyData := range data {
 			engine.setKeyDataFunc(database, key, keyData)
 		}
@@ -377,7 +519,3 @@ func (engine *Engine) Restore() error {
 func (engine *Engine) IncrementChangeCount() {
 	engine.changeCount.Add(1)
 }
-
-func (engine *Engine) resetChangeCount() {
-	engine.changeCount.Store(0)
-}
@@ -20,6 +20,9 @@ import (
 	"github.com/echovault/sugardb/internal/clock"
 	"github.com/echovault/sugardb/internal/snapshot"
 	"os"
+	"path"
+	"path/filepath"
+	"slices"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -134,3 +137,289 @@ func Test_SnapshotEngine(t *testing.T) {
 
 	_ = os.RemoveAll(directory)
 }
+
+func Test_SnapshotEngineSaveRules(t *testing.T) {
+	directory := "./testdata/save_rules"
+	t.Cleanup(func() {
+		_ = os.RemoveAll("./testdata")
+	})
+
+	state := map[int]map[string]internal.KeyData{
+		0: {"key1": {Value: "value1"}},
+	}
+	var latestSnapshotTime atomic.Int64
+
+	tests := []struct {
+		name      string
+		directory string
+		rules     []snapshot.SaveRule
+		changes   int
+		wantSaves uint64
+		wantErr   bool
+	}{
+		{
+			name:      "1. Do not snapshot when no rule matches",
+			directory: path.Join(directory, "no_match"),
+			rules: []snapshot.SaveRule{
+				{Interval: 10 * time.Millisecond, Changes: 10},
+				{Interval: time.Hour, Changes: 1},
+			},
+			changes:   5,
+			wantSaves: 0,
+		},
+		{
+			name:      "2. Snapshot when the changes exceed the threshold of any rule",
+			directory: path.Join(directory, "match"),
+			rules: []snapshot.SaveRule{
+				{Interval: time.Hour, Changes: 1},
+				{Interval: 10 * time.Millisecond, Changes: 3},
+			},
+			changes:   5,
+			wantSaves: 1,
+		},
+		{
+			name: "3. Report the error when the snapshot fails",
+			directory: func() string {
+				// Use a file as the directory so that the snapshot directory cannot be created.
+				_ = os.MkdirAll(directory, os.ModePerm)
+				f, _ := os.Create(path.Join(directory, "file"))
+				_ = f.Close()
+				return path.Join(directory, "file")
+			}(),
+			rules:     []snapshot.SaveRule{{Interval: 10 * time.Millisecond, Changes: 1}},
+			changes:   1,
+			wantSaves: 0,
+			wantErr:   true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			engine := snapshot.NewSnapshotEngine(
+				snapshot.WithDirectory(test.directory),
+				snapshot.WithSaveRules(test.rules...),
+				snapshot.WithGetStateFunc(func() map[int]map[string]internal.KeyData { return state }),
+				snapshot.WithSetLatestSnapshotTimeFunc(func(msec int64) { latestSnapshotTime.Store(msec) }),
+				snapshot.WithGetLatestSnapshotTimeFunc(func() int64 { return latestSnapshotTime.Load() }),
+			)
+
+			for i := 0; i < test.changes; i++ {
+				engine.IncrementChangeCount()
+			}
+
+			<-time.After(100 * time.Millisecond)
+
+			status := engine.Status()
+			if status.Saves != test.wantSaves {
+				t.Errorf("expected %d saves, got %d", test.wantSaves, status.Saves)
+			}
+			if (status.LastSaveError != nil) != test.wantErr {
+				t.Errorf("expected last save error %v, got %v", test.wantErr, status.LastSaveError)
+			}
+			wantChanges := uint64(test.changes)
+			if test.wantSaves > 0 {
+				wantChanges = 0
+			}
+			if status.ChangesSinceLastSave != wantChanges {
+				t.Errorf("expected %d changes since last save, got %d", wantChanges, status.ChangesSinceLastSave)
+			}
+		})
+	}
+}
+
+func Test_SnapshotRetention(t *testing.T) {
+	directory := "./testdata/retention"
+	t.Cleanup(func() {
+		_ = os.RemoveAll("./testdata")
+	})
+
+	latest := clock.NewClock().Now().UnixMilli()
+	existing := []int64{
+		latest - time.Minute.Milliseconds(),
+		latest - (30 * time.Minute).Milliseconds(),
+		latest - (90 * time.Minute).Milliseconds(),
+		latest - (25 * time.Hour).Milliseconds(),
+		latest - (49 * time.Hour).Milliseconds(),
+	}
+
+	state := map[int]map[string]internal.KeyData{
+		0: {"key1": {Value: "value1"}, "key2": {Value: "value2"}},
+		1: {"key1": {Value: "value1"}},
+	}
+
+	tests := []struct {
+		name      string
+		retention snapshot.Retention
+		want      []int64
+	}{
+		{
+			name:      "1. Keep all the snapshots when there is no retention policy",
+			retention: snapshot.Retention{},
+			want:      append([]int64{latest}, existing...),
+		},
+		{
+			name:      "2. Keep the last N snapshots",
+			retention: snapshot.Retention{Last: 2},
+			want:      []int64{latest, existing[0]},
+		},
+		{
+			name:      "3. Keep the most recent snapshot of each hour",
+			retention: snapshot.Retention{Last: 1, Hourly: 3},
+			want:      []int64{latest, existing[1], existing[2]},
+		},
+		{
+			name:      "4. Keep the most recent snapshot of each day",
+			retention: snapshot.Retention{Daily: 3},
+			want:      []int64{latest, existing[3], existing[4]},
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := path.Join(directory, fmt.Sprintf("%d", i))
+			for _, id := range existing {
+				if err := os.MkdirAll(path.Join(dir, "snapshots", fmt.Sprintf("%d", id)), os.ModePerm); err != nil {
+					t.Error(err)
+					return
+				}
+				if err := os.WriteFile(
+					path.Join(dir, "snapshots", fmt.Sprintf("%d", id), "state.bin"),
+					[]byte(`{"State":{"0":{"key1":{"Value":"value1"}}},"LatestSnapshotMilliseconds":0}`),
+					os.ModePerm,
+				); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+
+			var latestSnapshotTime atomic.Int64
+			engine := snapshot.NewSnapshotEngine(
+				snapshot.WithClock(clock.NewClock()),
+				snapshot.WithDirectory(dir),
+				snapshot.WithInterval(0),
+				snapshot.WithRetention(test.retention),
+				snapshot.WithGetStateFunc(func() map[int]map[string]internal.KeyData { return state }),
+				snapshot.WithSetLatestSnapshotTimeFunc(func(msec int64) { latestSnapshotTime.Store(msec) }),
+				snapshot.WithGetLatestSnapshotTimeFunc(func() int64 { return latestSnapshotTime.Load() }),
+			)
+
+			if err := engine.TakeSnapshot(); err != nil {
+				t.Error(err)
+				return
+			}
+
+			snapshots, err := engine.List()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+
+			got := make([]int64, len(snapshots))
+			for j, s := range snapshots {
+				got[j] = s.Id
+			}
+			if !slices.Equal(got, test.want) {
+				t.Errorf("expected snapshots %v, got %v", test.want, got)
+			}
+
+			// Check the information of the latest snapshot.
+			if !snapshots[0].Latest {
+				t.Error("expected the first snapshot to be the latest")
+			}
+			if snapshots[0].Keys != 3 || snapshots[0].Databases[0] != 2 || snapshots[0].Databases[1] != 1 {
+				t.Errorf("expected 3 keys (2 in database 0, 1 in database 1), got %d (%v)",
+					snapshots[0].Keys, snapshots[0].Databases)
+			}
+			if snapshots[0].Size <= 0 {
+				t.Errorf("expected snapshot size to be greater than 0, got %d", snapshots[0].Size)
+			}
+		})
+	}
+}
+
+func Test_SnapshotExport(t *testing.T) {
+	directory := "./testdata/export"
+	t.Cleanup(func() {
+		_ = os.RemoveAll("./testdata")
+	})
+
+	state := map[int]map[string]internal.KeyData{
+		0: {"key1": {Value: "value1"}, "key2": {Value: "value2"}},
+		1: {"key3": {Value: "value3"}},
+	}
+
+	// Export into the snapshot directory of another engine.
+	exportDir := path.Join(directory, "other")
+
+	var latestSnapshotTime atomic.Int64
+	engine := snapshot.NewSnapshotEngine(
+		snapshot.WithDirectory(directory),
+		snapshot.WithExportDirectory(exportDir),
+		snapshot.WithInterval(0),
+		snapshot.WithGetStateFunc(func() map[int]map[string]internal.KeyData { return state }),
+		snapshot.WithSetLatestSnapshotTimeFunc(func(msec int64) { latestSnapshotTime.Store(msec) }),
+		snapshot.WithGetLatestSnapshotTimeFunc(func() int64 { return latestSnapshotTime.Load() }),
+	)
+
+	if err := engine.TakeSnapshot(); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if err := engine.Export(latestSnapshotTime.Load(), 2, "db2.bin"); err == nil {
+		t.Error("expected error when exporting a database that is not in the snapshot")
+	}
+
+	// The paths that lead outside of the export directory are refused.
+	if err := os.MkdirAll(exportDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("..", path.Join(exportDir, "parent")); err != nil {
+		t.Fatal(err)
+	}
+	absDirectory, err := filepath.Abs(directory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{
+		"../outside.bin",
+		"snapshots/../../outside.bin",
+		path.Join(absDirectory, "outside.bin"),
+		"parent/outside.bin",
+	} {
+		if err := engine.Export(latestSnapshotTime.Load(), 1, name); err == nil {
+			t.Errorf("expected error when exporting to %s", name)
+		}
+	}
+	if _, err := os.Stat(path.Join(directory, "outside.bin")); err == nil {
+		t.Error("expected no file to be written outside of the export directory")
+	}
+
+	// Export database 1 and restore it with the other engine.
+	if err := engine.Export(latestSnapshotTime.Load(), 1, "snapshots/1/state.bin"); err != nil {
+		t.Error(err)
+		return
+	}
+	for name, want := range map[string]os.FileMode{
+		path.Join(exportDir, "snapshots", "1"):              0700,
+		path.Join(exportDir, "snapshots", "1", "state.bin"): 0600,
+	} {
+		fi, err := os.Stat(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fi.Mode().Perm() != want {
+			t.Errorf("expected %s to have permissions %o, got %o", name, want, fi.Mode().Perm())
+		}
+	}
+
+	other := snapshot.NewSnapshotEngine(snapshot.WithDirectory(exportDir), snapshot.WithInterval(0))
+	snapshotObject, err := other.Load(1)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(snapshotObject.State) != 1 || snapshotObject.State[1]["key3"].Value != "value3" {
+		t.Errorf("expected exported snapshot to only contain database 1, got %v", snapshotObject.State)
+	}
+}
@@ -16,6 +16,7 @@ package internal
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net"
@@ -25,6 +26,7 @@ import (
 
 	"github.com/echovault/sugardb/internal/clock"
 	"github.com/echovault/sugardb/internal/constants"
+	"github.com/echovault/sugardb/internal/sharding"
 )
 
 type KeyData struct {
@@ -95,6 +97,25 @@ func (k *KeyData) GetMem() (int64, error) {
 type ContextServerID string
 type ContextConnID string
 
+// ContextShardOnly is the context key of the flag that is set when a cluster-wide command was passed
+// on by the leader of another shard, so that the command is not passed on again.
+type ContextShardOnly string
+
+// ContextUsername is the context key of the ACL user of the client that sent a command.
+// Followers forward it with the command, so that the leader can authorize the command again.
+type ContextUsername string
+
+// ContextUserRules is the context key of the ACL rules of the client's user when it was created from the rules
+// of an identity, which the leader does not know.
+type ContextUserRules string
+
+// ContextSystem is the context key of the flag that is set for the commands that a node runs on its own behalf
+// rather than on behalf of a client, e.g. the deletion of the keys moved by MIGRATE.
+type ContextSystem string
+
+// ContextAsking is the context key of the flag that is set when the client sent ASKING before the command.
+type ContextAsking string
+
 type ApplyRequest struct {
 	Type         string   `json:"Type"` // command | delete-key
 	ServerID     string   `json:"ServerID"`
@@ -103,6 +124,8 @@ type ApplyRequest struct {
 	Database     int      `json:"Database"`
 	CMD          []string `json:"CMD"`
 	Key          string   `json:"Key"` // Optional: Used with delete-key type to specify which key to delete.
+	// Optional: Used with set-shard and claim-shard types to specify the slots of the shard.
+	Shard *sharding.Shard `json:"Shard,omitempty"`
 }
 
 type ApplyResponse struct {
@@ -113,18 +136,83 @@ type ApplyResponse struct {
 type SnapshotObject struct {
 	State                      map[int]map[string]KeyData
 	LatestSnapshotMilliseconds int64
+	// The index of the latest raft log included in the state. Only set in cluster mode.
+	RaftAppliedIndex uint64 `json:",omitempty"`
+	// The slots of the node's shard. Only set in cluster mode.
+	Shard *sharding.Shard `json:",omitempty"`
+	// The JSON encoded ACL users. Only set in cluster mode.
+	ACLUsers json.RawMessage `json:",omitempty"`
+	// The modules loaded from dynamic libraries. Only set in cluster mode.
+	Modules []LoadedModule `json:",omitempty"`
+}
+
+// LoadedModule is a module loaded from a dynamic library, with the args it was loaded with.
+type LoadedModule struct {
+	Path string
+	Args []string
+}
+
+// SnapshotInfo holds information about a snapshot on disk.
+type SnapshotInfo struct {
+	Id        int64       // The id of the snapshot, which is the unix time in milliseconds at which it was taken.
+	Size      int64       // The size of the snapshot file in bytes.
+	Keys      int         // The total number of keys in the snapshot.
+	Databases map[int]int // The number of keys in each database in the snapshot.
+	Latest    bool        // Whether this is the latest snapshot.
 }
 
 // ServerInfo holds information about the server/node.
 type ServerInfo struct {
-	Server     string
-	Version    string
-	Id         string
-	Mode       string
-	Role       string
-	Modules    []string
-	MemoryUsed int64
-	MaxMemory  uint64
+	Server      string
+	Version     string
+	Id          string
+	Mode        string
+	Role        string
+	Modules     []string
+	MemoryUsed  int64
+	MaxMemory   uint64
+	Persistence PersistenceInfo
+	Clients     ClientsInfo
+}
+
+// ClientsInfo holds the number of TCP clients and the limits of the client connections.
+type ClientsInfo struct {
+	Connected           int           // The number of connected clients.
+	MaxClients          uint          // The maximum number of connected clients. 0 is unlimited.
+	MaxClientsPerIP     uint          // The maximum number of connected clients per IP address. 0 is unlimited.
+	RejectedConnections uint64        // The number of connections refused by the limits and the protected mode.
+	QuotaRejections     uint64        // The number of commands and connections rejected by the ACL quotas of the users.
+	Timeout             time.Duration // The idle time after which a client is disconnected. 0 disables the timeout.
+	TCPKeepAlive        time.Duration // The period of the TCP keepalives. 0 disables the keepalives.
+	ProtectedMode       bool          // Whether only loopback clients are accepted when no authentication is configured.
+}
+
+// DatabaseInfo holds the number of keys in a database.
+type DatabaseInfo struct {
+	Database int
+	Keys     int
+	Expires  int // The number of keys with an expiry time.
+}
+
+// RebalanceOptions configures how CLUSTER REBALANCE moves keys between shards.
+type RebalanceOptions struct {
+	BatchSize int           // The number of keys moved with each MIGRATE.
+	Timeout   time.Duration // The timeout of each round trip with the other nodes.
+	Auth      []string      // A password, or a username and a password, to authenticate with the other nodes.
+}
+
+// PersistenceInfo holds the status of the snapshot and AOF processes.
+type PersistenceInfo struct {
+	SnapshotInProgress         bool          // Whether a snapshot is currently being taken.
+	AOFRewriteInProgress       bool          // Whether an AOF rewrite is currently in progress.
+	LatestSnapshotMilliseconds int64         // Unix epoch in milliseconds of the latest snapshot.
+	StateCaptures              uint64        // Number of state captures completed for snapshots and AOF rewrites.
+	LatestCapturePause         time.Duration // Time that write commands were paused during the latest state capture.
+	LatestCaptureCopy          time.Duration // Time it took to copy the state during the latest state capture.
+	ChangesSinceLastSave       uint64        // Number of writes since the latest successful snapshot.
+	Saves                      uint64        // Number of successful snapshots since the server was started.
+	LastSaveError              string        // The error of the latest snapshot attempt. Empty if it succeeded.
+	LastSaveDuration           time.Duration // Time taken by the latest snapshot attempt.
 }
 
 // ConnectionInfo holds information about the connection
@@ -133,6 +221,118 @@ type ConnectionInfo struct {
 	Name     string // Alias name for this connection.
 	Protocol int    // The RESP protocol used by the client. Can be either 2 or 3.
 	Database int    // Database index currently being used by the connection.
+	// The consistency of the reads served to the connection in cluster mode.
+	// Can be either stale, lease or linearizable.
+	ReadConsistency string
+	// Whether the client sent ASKING before the next command, which allows the command to access
+	// a slot that is being imported by the node's shard.
+	Asking bool
+
+	Addr          string    // The address of the client.
+	LocalAddr     string    // The address of the server the client is connected to.
+	Created       time.Time // The time the connection was established.
+	LastCommand   string    // The latest command of the client, e.g. "get" or "client|list".
+	LastCommandAt time.Time // The time of the latest command of the client.
+}
+
+// ClientInfo describes a TCP client, as listed by CLIENT LIST.
+type ClientInfo struct {
+	ConnectionInfo
+	User          string // The ACL user of the connection.
+	Subscriptions int    // The number of channels, patterns and shard channels the client is subscribed to.
+}
+
+// ClusterShard holds information about a shard of the cluster and the slots it serves.
+type ClusterShard struct {
+	ID    string
+	Slots [][2]int      // Inclusive ranges of the slots served by the shard.
+	Nodes []ClusterNode // The nodes of the shard. The leader comes first.
+}
+
+// ClusterNode holds information about a node of the cluster.
+type ClusterNode struct {
+	ServerID string
+	Host     string
+	Port     int
+	Leader   bool
+}
+
+// ClusterNodeInfo holds the topology information of a node of the cluster.
+type ClusterNodeInfo struct {
+	ClusterNode
+	ShardID  string
+	RaftAddr string   // The address of the node's raft transport.
+	LeaderID string   // The server id of the leader of the node's shard. Empty when the leader is unknown.
+	Slots    [][2]int // Inclusive ranges of the slots served by the node's shard.
+	Myself   bool     // Whether this is the node that returned the information.
+	Replica  bool     // Whether the node is a non-voting replica of its shard.
+	// Whether the node is a member of the cluster. Nodes of the raft configuration of this node's
+	// shard that have left or failed are not connected.
+	Connected bool
+}
+
+// ClusterInfo holds the state of the cluster as seen by a node.
+type ClusterInfo struct {
+	State         string // ok when every slot is served by a shard with a leader, fail otherwise.
+	SlotsAssigned int    // The number of slots served by a shard.
+	KnownNodes    int    // The number of members of the cluster.
+	Size          int    // The number of shards that serve at least one slot.
+	MyID          string
+	ShardID       string
+	LeaderID      string // The server id of the leader of the node's shard. Empty when the leader is unknown.
+	RaftState     string // The raft state of the node, e.g. Leader or Follower.
+	Replica       bool   // Whether the node is a non-voting replica of its shard.
+	Term          uint64
+	CommitIndex   uint64
+	AppliedIndex  uint64
+	Lag           uint64 // The number of logs committed by the shard that the node has not applied yet.
+	// The membership changes observed by the node since it started.
+	MembersJoined         uint64 // The number of times another node joined, or came back.
+	MembersLeft           uint64 // The number of times a node left gracefully.
+	MembersFailed         uint64 // The number of times a node stopped responding.
+	MembersRecovered      uint64 // The number of times a failed member of the node's shard came back.
+	MembersRemoved        uint64 // The number of members of the node's shard removed from the raft configuration.
+	MembersPendingRemoval int    // The number of failed members of the node's shard waiting for the grace period to end.
+}
+
+// RoleInfo holds the replication role of a node.
+type RoleInfo struct {
+	Role   string // Either master for the leader of a shard or a standalone node, or slave for a follower.
+	Offset uint64 // The index of the latest raft log applied by the node.
+	// The client address of the leader and the state of the connection to it (connected or connect).
+	// Only set for followers.
+	LeaderHost string
+	LeaderPort int
+	State      string
+	// Whether the follower is a non-voting replica that never becomes the leader.
+	Replica bool
+	// The number of logs committed by the shard that the follower has not applied yet,
+	// and the time since it last heard from the leader. LastContact is -1 when it never heard from a leader.
+	Lag         uint64
+	LastContact time.Duration
+	// The followers of the shard. Only set for leaders.
+	Replicas []ClusterNode
+	// The id of the replication stream. For a standalone replica, the id of the primary's stream.
+	// Only set in standalone mode.
+	ReplicationID string
+	// The state of each replica of a standalone primary, by server id.
+	Links map[string]ReplicaLink
+	// The number of full and partial resynchronizations served by a standalone primary,
+	// and the number of partial resynchronizations it denied.
+	SyncFull       uint64
+	SyncPartialOK  uint64
+	SyncPartialErr uint64
+	// The backlog that a standalone primary keeps for partial resynchronizations.
+	BacklogActive      bool
+	BacklogSize        int
+	BacklogFirstOffset uint64
+	BacklogHistlen     int
+}
+
+// ReplicaLink holds the state of a standalone replica as seen by its primary.
+type ReplicaLink struct {
+	Offset  uint64        // The offset of the replication stream acknowledged by the replica.
+	LastAck time.Duration // The time since the replica last acknowledged its offset.
 }
 
 // KeyExtractionFuncResult is the return type of the KeyExtractionFunc for the command/subcommand.
@@ -186,10 +386,27 @@ type HandlerFuncParams struct {
 	// GetPubSub returns the SugarDB instance's PubSub engine.
 	// There's no need to use this outside of the pubsub package.
 	GetPubSub func() interface{}
+	// PublishToCluster sends a message published on this node to the other cluster members, so that their
+	// subscribers receive it too. Messages to shard channels are only sent to the nodes of this node's shard.
+	// It's a no-op in standalone mode.
+	PublishToCluster func(channel, message string, sharded bool)
 	// TakeSnapshot triggers a snapshot by the SugarDB instance.
 	TakeSnapshot func() error
+	// BGSave triggers a snapshot in the background by the SugarDB instance.
+	BGSave func() error
+	// ListSnapshots returns the information about the snapshots on disk.
+	ListSnapshots func() ([]SnapshotInfo, error)
+	// RestoreSnapshot restores the snapshot with the given id into the running instance.
+	// When database is -1, the whole snapshot is restored. Otherwise, the database from the snapshot
+	// is restored into the target database.
+	RestoreSnapshot func(id int64, database int, target int) error
+	// ExportSnapshot writes the database from the snapshot with the given id to the file at path,
+	// which must be in the snapshot export directory.
+	ExportSnapshot func(id int64, database int, path string) error
 	// RewriteAOF triggers a compaction of the commands logs by the SugarDB instance.
 	RewriteAOF func() error
+	// BGRewriteAOF triggers a compaction of the commands logs in the background.
+	BGRewriteAOF func() error
 	// GetLatestSnapshotTime returns the latest snapshot timestamp.
 	GetLatestSnapshotTime func() int64
 	// LoadModule loads the provided module with the given args passed to the module's
@@ -202,10 +419,67 @@ type HandlerFuncParams struct {
 	ListModules func() []string
 	// SetConnectionInfo sets the connection's protocol and clientname.
 	SetConnectionInfo func(conn *net.Conn, clientname string, protocol int, database int)
+	// SetReadConsistency sets the consistency of the reads served to the connection in cluster mode.
+	SetReadConsistency func(conn *net.Conn, consistency string)
+	// SetAsking sets the ASKING flag of the connection for its next command.
+	// Returns an error when the instance is not in cluster mode.
+	SetAsking func(conn *net.Conn) error
+	// GetClusterShards returns the shards of the cluster, sorted by id.
+	// Returns an error when the instance is not in cluster mode.
+	GetClusterShards func() ([]ClusterShard, error)
+	// GetClusterInfo returns the state of the cluster as seen by the node.
+	// Returns an error when the instance is not in cluster mode.
+	GetClusterInfo func() (ClusterInfo, error)
+	// GetClusterNodes returns the nodes of the cluster, sorted by shard with the leader of each shard first.
+	// Returns an error when the instance is not in cluster mode.
+	GetClusterNodes func() ([]ClusterNodeInfo, error)
+	// ClusterFailover transfers the leadership of the node's shard to the node with the id.
+	ClusterFailover func(ctx context.Context, id string) error
+	// ClusterForget removes a node that is no longer a member of the cluster from the raft
+	// configuration of the node's shard.
+	ClusterForget func(ctx context.Context, id string) error
+	// ClusterAddNode adds the node with the raft address to the raft configuration of the node's shard.
+	ClusterAddNode func(ctx context.Context, id string, addr string) error
+	// ClusterRemoveNode removes the node from the raft configuration of the node's shard.
+	ClusterRemoveNode func(ctx context.Context, id string) error
+	// ClusterPromote turns a non-voting replica of the node's shard into a voter.
+	ClusterPromote func(ctx context.Context, id string) error
+	// ClusterDemote turns a voter of the node's shard into a non-voting replica.
+	ClusterDemote func(ctx context.Context, id string) error
+	// GetRole returns the replication role of the node.
+	GetRole func() RoleInfo
+	// ReplicaOf makes a standalone instance replicate the primary at the address,
+	// or stops the replication when the address is empty.
+	ReplicaOf func(addr string) error
+	// PSync starts streaming the replication stream to the replica on the connection, from the offset when
+	// the id matches the stream and the backlog still holds the offset, or from a copy of the dataset otherwise.
+	// The replies are written directly to the connection.
+	PSync func(conn *net.Conn, id string, offset int64) error
+	// ReplConf records the listening port, or the acknowledged offset, of the replica on the connection.
+	ReplConf func(conn *net.Conn, option string, value string) error
+	// ApplyCommand executes a write command on behalf of a handler, e.g. to delete the keys moved by MIGRATE.
+	// In cluster mode, the command is applied through the raft log of the node's shard.
+	ApplyCommand func(ctx context.Context, cmd []string) ([]byte, error)
+	// CountKeysInSlot returns the number of keys in the hash slot in the current database of the node.
+	CountKeysInSlot func(ctx context.Context, slot int) int
+	// GetKeysInSlot returns up to count keys of the hash slot in the current database of the node.
+	GetKeysInSlot func(ctx context.Context, slot int, count int) []string
+	// SetSlot changes the state of the slots in the record of the node's shard.
+	// The state is one of IMPORTING, MIGRATING, NODE and STABLE, and id is the shard, or a server of the shard,
+	// that the slots are imported from, migrated to or assigned to. Returns an error when the node is not
+	// the leader of its shard.
+	SetSlot func(slots []sharding.SlotRange, state string, id string) error
+	// Rebalance moves slots between the shards of the cluster until each shard serves the same number of slots.
+	// Returns the number of slots that were moved.
+	Rebalance func(ctx context.Context, options RebalanceOptions) (int, error)
 	// GetConnectionInfo returns information about the current connection.
 	GetConnectionInfo func(conn *net.Conn) ConnectionInfo
+	// ListClients returns the TCP clients connected to the server, sorted by id.
+	ListClients func() []ClientInfo
 	// GetServerInfo returns information about the server when requested by commands such as HELLO.
 	GetServerInfo func() ServerInfo
+	// GetKeyspaceInfo returns the number of keys in each database that holds keys, sorted by database.
+	GetKeyspaceInfo func() []DatabaseInfo
 	// SwapDBs swaps two databases,
 	// so that immediately all the clients connected to a given database will see the data of the other database,
 	// and the other way around.
@@ -224,6 +498,32 @@ type HandlerFuncParams struct {
 	GetObjectIdleTime func(ctx context.Context, keys string) (float64, error)
 }
 
+// ACLLogEntry describes an authentication or a command denied by the ACL, as returned by ACL LOG.
+// Denials with the same reason, object and username that happen within a minute of each other
+// are coalesced into one entry.
+type ACLLogEntry struct {
+	EntryID     uint64    // The id of the entry. Ids keep increasing after the log is reset.
+	Count       int       // The number of denials coalesced into the entry.
+	Reason      string    // "auth", "command", "key", "channel" or "quota".
+	Context     string    // Where the command was executed. Always "toplevel".
+	Object      string    // The denied command, key or channel. "AUTH" for failed authentications.
+	Username    string    // The user that was denied.
+	ClientInfo  string    // The address of the client that was denied.
+	Created     time.Time // The time of the first denial.
+	LastUpdated time.Time // The time of the last denial.
+}
+
+// AuditEvent describes a command recorded by the audit log.
+type AuditEvent struct {
+	Time     time.Time `json:"time"`
+	Username string    `json:"user"`            // The ACL user of the connection. Empty for embedded calls.
+	Client   string    `json:"client"`          // The address of the client. "embedded" for embedded calls.
+	Database int       `json:"database"`        // The database selected when the command was run.
+	Command  []string  `json:"command"`         // The command and its arguments, with the secrets redacted.
+	Outcome  string    `json:"outcome"`         // "ok" or "error".
+	Error    string    `json:"error,omitempty"` // The error returned by the command.
+}
+
 // HandlerFunc is a functions described by a command where the bulk of the command handling is done.
 // This function returns a byte slice which contains a RESP2 response. The response from this function
 // is forwarded directly to the client connection that triggered the command.
@@ -239,6 +539,9 @@ type Command struct {
 	Sync        bool         // Specifies if command should be synced across replication cluster
 	KeyExtractionFunc
 	HandlerFunc
+
+	// The original keyword of a command renamed with --rename-command. Empty if the command is not renamed.
+	OriginalCommand string
 }
 
 type SubCommand struct {
@@ -147,10 +147,24 @@ func GetSubCommand(command Command, cmd []string) (interface{}, error) {
 	return nil, fmt.Errorf("command %s %s not supported", cmd[0], cmd[1])
 }
 
+// OriginalCommand returns the keyword the command was registered with, before it was renamed with --rename-command.
+// The checks for specific commands, such as AUTH or SELECT, must use it so that they keep working for renamed commands.
+func OriginalCommand(command Command) string {
+	if command.OriginalCommand != "" {
+		return command.OriginalCommand
+	}
+	return command.Command
+}
+
 func IsWriteCommand(command Command, subCommand SubCommand) bool {
 	return slices.Contains(append(command.Categories, subCommand.Categories...), constants.WriteCategory)
 }
 
+func IsReadCommand(command Command, subCommand SubCommand) bool {
+	return slices.Contains(command.Categories, constants.ReadCategory) ||
+		slices.Contains(subCommand.Categories, constants.ReadCategory)
+}
+
 func AbsInt(n int) int {
 	if n < 0 {
 		return -n
@@ -442,7 +456,7 @@ func GetConnection(addr string, port int) (net.Conn, error) {
 
 	go func() {
 		for {
-			conn, err = net.Dial("tcp", fmt.Sprintf("%s:%d", addr, port))
+			conn, err = net.Dial("tcp", net.JoinHostPort(addr, strconv.Itoa(port)))
 			if err != nil && errors.Is(err.(*net.OpError), syscall.ECONNREFUSED) {
 				// If we get a "connection refused error, try again."
 				continue
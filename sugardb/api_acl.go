@@ -19,18 +19,25 @@ import (
 	"fmt"
 	"github.com/echovault/sugardb/internal"
 	"github.com/tidwall/resp"
+	"strconv"
 	"strings"
 )
 
 // ACLLoadOptions modifies the behaviour of the ACLLoad function.
 // If Merge is true, the ACL configuration from the file will be merged with the in-memory ACL configuration.
 // If Replace is set to true, the ACL configuration from the file will replace the in-memory ACL configuration.
-// If both flags are set to true, Merge will be prioritised.
+// If Sync is set to true, the users are replaced, and the in-memory users that are not in the file are deleted,
+// except the default user.
+// If several flags are set to true, Merge will be prioritised, then Replace.
 type ACLLoadOptions struct {
 	Merge   bool
 	Replace bool
+	Sync    bool
 }
 
+// ACLLogEntry describes an authentication or a command denied by the ACL, as returned by ACLLog.
+type ACLLogEntry = internal.ACLLogEntry
+
 // User is the user object passed to the ACLSetUser function to update an existing user or create a new user.
 //
 // Username - string - the user's username.
@@ -51,11 +58,13 @@ type ACLLoadOptions struct {
 //
 // AddPlainPasswords - []string - the list of plaintext passwords to add to the user's passwords.
 //
-// RemovePlainPasswords - []string - the list of plaintext passwords to remove from the user's passwords.
+// RemovePlainPasswords - []string - the list of plaintext passwords to remove from the user's passwords,
+// including their hashes.
 //
-// AddHashPasswords - []string - the list of SHA256 password hashes to add to the user's passwords.
+// AddHashPasswords - []string - the list of SHA256, bcrypt or argon2id password hashes to add to the user's passwords.
+// The type of each hash is detected from its format.
 //
-// RemoveHashPasswords - []string - the list of SHA256 password hashes to add to the user's passwords.
+// RemoveHashPasswords - []string - the list of password hashes to remove from the user's passwords.
 //
 // IncludeCategories - []string - the list of ACL command categories to allow this user to access, default is all.
 //
@@ -76,11 +85,45 @@ type ACLLoadOptions struct {
 // IncludeWriteKeys - []string - the list of keys the user is allowed write access to. The default is all.
 // This field accepts glob pattern strings.
 //
+// ExcludeReadWriteKeys - []string - the list of keys the user is not allowed to read or write, even when they match
+// the included keys. This field accepts glob pattern strings.
+//
+// ExcludeReadKeys - []string - the list of keys the user is not allowed to read. This field accepts glob pattern strings.
+//
+// ExcludeWriteKeys - []string - the list of keys the user is not allowed to write. This field accepts glob pattern strings.
+//
 // IncludeChannels - []string - the list of PubSub channels the user is allowed to access ("Subscribe" and "Publish").
 // This field accepts glob pattern strings.
 //
 // ExcludeChannels - []string - the list of PubSub channels the user cannot access ("Subscribe" and "Publish").
 // This field accepts glob pattern strings.
+//
+// AllDatabases - bool - if true, the user is allowed to access all the databases. This is the default.
+//
+// Databases - []int - the list of databases the user is allowed to access.
+//
+// ClearSelectors - bool - if true, the user's selectors are removed.
+//
+// Selectors - []string - the list of selectors to add to the user. A selector is an alternative set of permissions
+// written as space-separated rules, e.g. "+get ~cache:*". The user is allowed to run a command when either their
+// permissions or one of their selectors allow it. Unlike the user's permissions, a selector allows nothing by default.
+//
+// ResetQuotas - bool - if true, the user's quotas are removed.
+//
+// CommandsPerSecond - uint64 - the number of commands the user's connections can run per second.
+//
+// BytesInPerSecond - uint64 - the number of bytes the user's connections can send per second.
+//
+// BytesOutPerSecond - uint64 - the number of bytes the user's connections can receive per second.
+//
+// MaxConnections - uint64 - the number of connections that can be associated with the user.
+//
+// MaxKeys - uint64 - the number of keys matching the user's write key patterns that the user can create.
+//
+// MaxMemory - uint64 - the memory in bytes, of the keys matching the user's write key patterns, above which the user's
+// write commands are rejected.
+//
+// A quota of 0 leaves the user's quota unchanged. Quotas are unlimited by default.
 type User struct {
 	Username      string
 	Enabled       bool
@@ -106,8 +149,26 @@ type User struct {
 	IncludeReadKeys      []string
 	IncludeWriteKeys     []string
 
+	ExcludeReadWriteKeys []string
+	ExcludeReadKeys      []string
+	ExcludeWriteKeys     []string
+
 	IncludeChannels []string
 	ExcludeChannels []string
+
+	AllDatabases bool
+	Databases    []int
+
+	ClearSelectors bool
+	Selectors      []string
+
+	ResetQuotas       bool
+	CommandsPerSecond uint64
+	BytesInPerSecond  uint64
+	BytesOutPerSecond uint64
+	MaxConnections    uint64
+	MaxKeys           uint64
+	MaxMemory         uint64
 }
 
 // ACLCat returns either the list of all categories or the list of commands within a specified category.
@@ -237,6 +298,54 @@ func (server *SugarDB) ACLSetUser(user User) (bool, error) {
 		cmd = append(cmd, fmt.Sprintf("-&%s", channel))
 	}
 
+	for _, key := range user.ExcludeReadWriteKeys {
+		cmd = append(cmd, fmt.Sprintf("-%s~%s", "%RW", key))
+	}
+
+	for _, key := range user.ExcludeReadKeys {
+		cmd = append(cmd, fmt.Sprintf("-%s~%s", "%R", key))
+	}
+
+	for _, key := range user.ExcludeWriteKeys {
+		cmd = append(cmd, fmt.Sprintf("-%s~%s", "%W", key))
+	}
+
+	if user.AllDatabases {
+		cmd = append(cmd, "allDatabases")
+	}
+
+	for _, database := range user.Databases {
+		cmd = append(cmd, fmt.Sprintf("db=%d", database))
+	}
+
+	if user.ClearSelectors {
+		cmd = append(cmd, "clearselectors")
+	}
+
+	for _, selector := range user.Selectors {
+		cmd = append(cmd, fmt.Sprintf("(%s)", selector))
+	}
+
+	if user.ResetQuotas {
+		cmd = append(cmd, "resetquotas")
+	}
+
+	for _, quota := range []struct {
+		name  string
+		value uint64
+	}{
+		{name: "commands-per-sec", value: user.CommandsPerSecond},
+		{name: "bytes-in-per-sec", value: user.BytesInPerSecond},
+		{name: "bytes-out-per-sec", value: user.BytesOutPerSecond},
+		{name: "maxconns", value: user.MaxConnections},
+		{name: "maxkeys", value: user.MaxKeys},
+		{name: "maxmemory", value: user.MaxMemory},
+	} {
+		if quota.value > 0 {
+			cmd = append(cmd, fmt.Sprintf("%s=%d", quota.name, quota.value))
+		}
+	}
+
 	b, err := server.handleCommand(server.context, internal.EncodeCommand(cmd), nil, false, true)
 	if err != nil {
 		return false, err
@@ -281,12 +390,26 @@ func (server *SugarDB) ACLSetUser(user User) (bool, error) {
 // If the user is allowed write access to all keys, the slice will contain "%W~*".
 // For each key glob pattern the user has write access to, the slice will contain "%W~<pattern>".
 //
+// For each key glob pattern the user is not allowed to access, the slice will contain "-%RW~<pattern>",
+// "-%R~<pattern>" or "-%W~<pattern>".
+//
 // "channels" - string slice af pubsub channels associated with the user.
 // If the user is allowed to access all channels, the slice will contain "+&*".
 // For each channel the user is allowed to access, the slice will contain "+&<channel>".
 // If the user is not allowed to access any channels, the slice will contain "-&*".
 // For each channel the user is not allowed to access, the slice will contain "-&<channel>".
 //
+// "databases" - string slice containing "allDatabases" if the user is allowed to access all databases,
+// otherwise "db=<database>,<database>..." with the databases the user is allowed to access.
+//
+// "selectors" - string slice af the user's selectors, each formatted as "(<rule> <rule>...)".
+//
+// "quotas" - string slice af the user's quotas, each formatted as "<quota>=<value>", e.g. "maxkeys=100".
+//
+// "usage" - string slice af the user's current usage of their quotas: "commands-per-sec=<n>", "bytes-in-per-sec=<n>"
+// and "bytes-out-per-sec=<n>" in the current second, "connections=<n>", "keys=<n>" and "memory=<bytes>",
+// and "rejected=<n>", the number of commands and connections rejected by the quotas.
+//
 // Errors:
 //
 // "user not found" - if the user requested does not exist in the ACL rules.
@@ -361,6 +484,8 @@ func (server *SugarDB) ACLLoad(options ACLLoadOptions) (bool, error) {
 		cmd = append(cmd, "MERGE")
 	case options.Replace:
 		cmd = append(cmd, "REPLACE")
+	case options.Sync:
+		cmd = append(cmd, "SYNC")
 	default:
 		cmd = append(cmd, "REPLACE")
 	}
@@ -385,3 +510,79 @@ func (server *SugarDB) ACLSave() (bool, error) {
 	s, err := internal.ParseStringResponse(b)
 	return strings.EqualFold(s, "ok"), err
 }
+
+// ACLDryRun checks whether the user is allowed to run the command in the current database, without running it.
+//
+// Parameters:
+//
+// `username` - string - The username of the user.
+//
+// `command` - ...string - The command and its arguments, e.g. "GET", "key".
+//
+// Returns: "OK" when the user is allowed to run the command, otherwise the reason the command is denied.
+//
+// Errors:
+//
+// "no user with username <username>" - when the user does not exist.
+//
+// "command '<command>' not supported" - when the command does not exist.
+func (server *SugarDB) ACLDryRun(username string, command ...string) (string, error) {
+	cmd := append([]string{"ACL", "DRYRUN", username}, command...)
+	b, err := server.handleCommand(server.context, internal.EncodeCommand(cmd), nil, false, true)
+	if err != nil {
+		return "", err
+	}
+	return internal.ParseStringResponse(b)
+}
+
+// ACLLog returns the most recent authentications and commands denied by the ACL, with the most recent first.
+// Repeated denials by the same user of the same object within a minute are coalesced into one entry.
+//
+// Parameters:
+//
+// `count` - ...int - The maximum number of entries to return. If more than one count is passed, only the first
+// one is used. When omitted or negative, all the entries are returned.
+//
+// Returns: A slice of ACLLogEntry.
+func (server *SugarDB) ACLLog(count ...int) []ACLLogEntry {
+	n := -1
+	if len(count) > 0 {
+		n = count[0]
+	}
+	return server.acl.Log(n)
+}
+
+// ACLGenPass generates a random password from a cryptographically secure source.
+//
+// Parameters:
+//
+// `bits` - ...int - the number of bits of entropy of the password, 256 by default.
+//
+// Returns: the hex encoded password.
+//
+// Errors:
+//
+// "bits must be an integer between 1 and 4096" - when bits is out of range.
+func (server *SugarDB) ACLGenPass(bits ...int) (string, error) {
+	cmd := []string{"ACL", "GENPASS"}
+	if len(bits) > 0 {
+		cmd = append(cmd, strconv.Itoa(bits[0]))
+	}
+	b, err := server.handleCommand(server.context, internal.EncodeCommand(cmd), nil, false, true)
+	if err != nil {
+		return "", err
+	}
+	return internal.ParseStringResponse(b)
+}
+
+// ACLLogReset removes all the entries of the ACL log.
+//
+// Returns: true if the log is reset.
+func (server *SugarDB) ACLLogReset() (bool, error) {
+	b, err := server.handleCommand(server.context, internal.EncodeCommand([]string{"ACL", "LOG", "RESET"}), nil, false, true)
+	if err != nil {
+		return false, err
+	}
+	s, err := internal.ParseStringResponse(b)
+	return strings.EqualFold(s, "ok"), err
+}
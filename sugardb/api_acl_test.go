@@ -660,3 +660,50 @@ func TestSugarDB_ACLConfig(t *testing.T) {
 		}
 	})
 }
+
+func TestSugarDB_ACLDryRun(t *testing.T) {
+	server := createSugarDB()
+	t.Cleanup(func() {
+		server.ShutDown()
+	})
+
+	if _, err := server.ACLSetUser(User{
+		Username:             "dryrun_user",
+		Enabled:              true,
+		NoPassword:           true,
+		IncludeCommands:      []string{"get"},
+		IncludeReadWriteKeys: []string{"key*"},
+		ExcludeReadKeys:      []string{"key:secret"},
+		Selectors:            []string{"+@all +set %W~cache:*"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		command []string
+		want    string
+		wantErr bool
+	}{
+		{name: "1. Allowed by the user's permissions", command: []string{"GET", "key1"}, want: "OK"},
+		{name: "2. Allowed by a selector", command: []string{"SET", "cache:1", "value"}, want: "OK"},
+		{
+			name:    "3. Denied by an excluded key",
+			command: []string{"GET", "key:secret"},
+			want:    "not authorised to access the following read keys: [%R~key:secret]",
+		},
+		{name: "4. Denied command", command: []string{"DEL", "key1"}, want: "not authorised to run DEL command"},
+		{name: "5. Unknown command", command: []string{"MISSING"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := server.ACLDryRun("dryrun_user", tt.command...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ACLDryRun() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ACLDryRun() got = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -15,10 +15,13 @@
 package sugardb
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"github.com/echovault/sugardb/internal"
+	"github.com/tidwall/resp"
 	"slices"
+	"strconv"
 	"strings"
 )
 
@@ -174,8 +177,8 @@ func (server *SugarDB) CommandCount() (int, error) {
 
 // Save triggers a new snapshot.
 //
-// Returns: true if the save was started. The OK response does not confirm that the save was successfully synced to
-// file. Only that the background process has started.
+// Returns: true if the save was successful. In cluster mode, the OK response does not confirm that the save was
+// successfully synced to file. Only that the background process has started.
 func (server *SugarDB) Save() (bool, error) {
 	b, err := server.handleCommand(server.context, internal.EncodeCommand([]string{"SAVE"}), nil, false, true)
 	if err != nil {
@@ -185,6 +188,148 @@ func (server *SugarDB) Save() (bool, error) {
 	return strings.EqualFold(res, "ok"), err
 }
 
+// BGSave triggers a new snapshot in the background.
+//
+// Returns: true if the save was started. The outcome of the save is reported in the persistence section of Info.
+//
+// Errors:
+//
+// "snapshot already in progress" - If another snapshot is currently being taken.
+func (server *SugarDB) BGSave() (bool, error) {
+	b, err := server.handleCommand(server.context, internal.EncodeCommand([]string{"BGSAVE"}), nil, false, true)
+	if err != nil {
+		return false, err
+	}
+	res, err := internal.ParseStringResponse(b)
+	return strings.EqualFold(res, "Background saving started"), err
+}
+
+// SnapshotInfo holds the information about a snapshot on disk.
+//
+// Id is the id of the snapshot, which is the unix time in milliseconds at which the snapshot was taken.
+//
+// Size is the size of the snapshot file in bytes.
+//
+// Keys is the total number of keys in the snapshot.
+//
+// Databases is a map of the number of keys in each database in the snapshot.
+//
+// Latest is true for the snapshot that is restored on startup.
+type SnapshotInfo struct {
+	Id        int64
+	Size      int64
+	Keys      int
+	Databases map[int]int
+	Latest    bool
+}
+
+// ListSnapshots lists the snapshots on disk. Only works in standalone mode.
+//
+// Returns: a slice of SnapshotInfo ordered from the most recent to the oldest snapshot.
+func (server *SugarDB) ListSnapshots() ([]SnapshotInfo, error) {
+	b, err := server.handleCommand(server.context, internal.EncodeCommand([]string{"SNAPSHOT", "LIST"}), nil, false, true)
+	if err != nil {
+		return nil, err
+	}
+
+	r := resp.NewReader(bytes.NewReader(b))
+	v, _, err := r.ReadValue()
+	if err != nil {
+		return nil, err
+	}
+
+	snapshots := make([]SnapshotInfo, len(v.Array()))
+	for i, entry := range v.Array() {
+		fields := entry.Array()
+		snapshots[i].Databases = make(map[int]int)
+		for j := 0; j < len(fields)-1; j += 2 {
+			switch fields[j].String() {
+			case "id":
+				snapshots[i].Id = int64(fields[j+1].Integer())
+			case "size":
+				snapshots[i].Size = int64(fields[j+1].Integer())
+			case "keys":
+				snapshots[i].Keys = fields[j+1].Integer()
+			case "latest":
+				snapshots[i].Latest = fields[j+1].Integer() == 1
+			case "databases":
+				databases := fields[j+1].Array()
+				for k := 0; k < len(databases)-1; k += 2 {
+					snapshots[i].Databases[databases[k].Integer()] = databases[k+1].Integer()
+				}
+			}
+		}
+	}
+
+	return snapshots, nil
+}
+
+// RestoreSnapshot replaces all the databases in the running instance with the databases from the snapshot.
+// Only works in standalone mode.
+//
+// Parameters:
+//
+// `id` - int64 - The id of the snapshot to restore.
+//
+// Returns: true if the snapshot was restored.
+func (server *SugarDB) RestoreSnapshot(id int64) (bool, error) {
+	cmd := []string{"SNAPSHOT", "RESTORE", strconv.FormatInt(id, 10)}
+	b, err := server.handleCommand(server.context, internal.EncodeCommand(cmd), nil, false, true)
+	if err != nil {
+		return false, err
+	}
+	res, err := internal.ParseStringResponse(b)
+	return strings.EqualFold(res, "ok"), err
+}
+
+// RestoreSnapshotDB replaces a single database in the running instance with a database from the snapshot.
+// Only works in standalone mode.
+//
+// Parameters:
+//
+// `id` - int64 - The id of the snapshot to restore from.
+//
+// `database` - int - The index of the database in the snapshot.
+//
+// `target` - int - The index of the database in the running instance to replace.
+//
+// Returns: true if the database was restored.
+func (server *SugarDB) RestoreSnapshotDB(id int64, database int, target int) (bool, error) {
+	cmd := []string{
+		"SNAPSHOT", "RESTORE", strconv.FormatInt(id, 10),
+		"DB", strconv.Itoa(database), "TO", strconv.Itoa(target),
+	}
+	b, err := server.handleCommand(server.context, internal.EncodeCommand(cmd), nil, false, true)
+	if err != nil {
+		return false, err
+	}
+	res, err := internal.ParseStringResponse(b)
+	return strings.EqualFold(res, "ok"), err
+}
+
+// ExportSnapshotDB writes a single database from the snapshot to a file with the same format as a snapshot file.
+// Only works in standalone mode.
+//
+// Parameters:
+//
+// `id` - int64 - The id of the snapshot to export from.
+//
+// `database` - int - The index of the database in the snapshot.
+//
+// `path` - string - The path of the file to write, relative to the snapshot export directory.
+// Paths outside of the export directory are refused.
+//
+// Returns: true if the database was exported.
+func (server *SugarDB) ExportSnapshotDB(id int64, database int, path string) (bool, error) {
+	cmd := []string{"SNAPSHOT", "EXPORT", strconv.FormatInt(id, 10), strconv.Itoa(database), path}
+	b, err := server.handleCommand(server.context, internal.EncodeCommand(cmd), nil, false, true)
+	if err != nil {
+		return false, err
+	}
+	res, err := internal.ParseStringResponse(b)
+	return strings.EqualFold(res, "ok"), err
+}
+
 // LastSave returns the unix epoch milliseconds timestamp of the last save.
 func (server *SugarDB) LastSave() (int, error) {
 	b, err := server.handleCommand(server.context, internal.EncodeCommand([]string{"LASTSAVE"}), nil, false, true)
@@ -203,7 +348,55 @@ func (server *SugarDB) RewriteAOF() (string, error) {
 	return internal.ParseStringResponse(b)
 }
 
+// BGRewriteAOF triggers a compaction of the AOF file in the background.
+//
+// Returns: a status message if the rewrite was started. The response does not confirm that the rewrite
+// was successful, only that the background process has started.
+func (server *SugarDB) BGRewriteAOF() (string, error) {
+	b, err := server.handleCommand(server.context, internal.EncodeCommand([]string{"BGREWRITEAOF"}), nil, false, true)
+	if err != nil {
+		return "", err
+	}
+	return internal.ParseStringResponse(b)
+}
+
+// Info returns information and statistics about the server.
+//
+// Parameters:
+//
+// `sections` - ...string - The sections to return (e.g. "server", "clients", "memory", "persistence", "replication", "keyspace").
+// If no section is provided, all sections are returned.
+//
+// Returns: a map of section names to the fields in each section. Section names are in lowercase.
+func (server *SugarDB) Info(sections ...string) (map[string]map[string]string, error) {
+	b, err := server.handleCommand(server.context, internal.EncodeCommand(append([]string{"INFO"}, sections...)), nil, false, true)
+	if err != nil {
+		return nil, err
+	}
+	res, err := internal.ParseStringResponse(b)
+	if err != nil {
+		return nil, err
+	}
+	info := make(map[string]map[string]string)
+	var section string
+	for _, line := range strings.Split(res, "\r\n") {
+		switch {
+		case line == "":
+			continue
+		case strings.HasPrefix(line, "# "):
+			section = strings.ToLower(strings.TrimPrefix(line, "# "))
+			info[section] = make(map[string]string)
+		case section != "":
+			if field, value, ok := strings.Cut(line, ":"); ok {
+				info[section][field] = value
+			}
+		}
+	}
+	return info, nil
+}
+
 // AddCommand adds a new command to SugarDB. The added command can be executed using the ExecuteCommand method.
+// The command is renamed when it's renamed with the RenameCommands config option.
 //
 // Parameters:
 //
@@ -212,6 +405,8 @@ func (server *SugarDB) RewriteAOF() (string, error) {
 // Errors:
 //
 // "command <command> already exists" - If a command with the same command name as the passed command already exists.
+//
+// "command <command> is disabled" - If the command is disabled with the DisableCommands config option.
 func (server *SugarDB) AddCommand(command CommandOptions) error {
 	server.commandsRWMut.Lock()
 	defer server.commandsRWMut.Unlock()
@@ -224,7 +419,7 @@ func (server *SugarDB) AddCommand(command CommandOptions) error {
 
 	if command.SubCommand == nil || len(command.SubCommand) == 0 {
 		// Add command with no subcommands
-		server.commands = append(server.commands, internal.Command{
+		return server.addCommand(internal.Command{
 			Command: command.Command,
 			Module:  strings.ToLower(command.Module), // Convert module to lower case for uniformity
 			Categories: func() []string {
@@ -258,7 +453,6 @@ func (server *SugarDB) AddCommand(command CommandOptions) error {
 				})
 			}),
 		})
-		return nil
 	}
 
 	// Add command with subcommands
@@ -325,8 +519,17 @@ func (server *SugarDB) AddCommand(command CommandOptions) error {
 		}
 	}
 
-	server.commands = append(server.commands, newCommand)
+	return server.addCommand(newCommand)
+}
 
+// addCommand adds the command to the command table, renamed as configured.
+// The commands lock must be held.
+func (server *SugarDB) addCommand(command internal.Command) error {
+	configured, ok := server.configureCommand(command)
+	if !ok {
+		return fmt.Errorf("command %s is disabled", command.Command)
+	}
+	server.commands = append(server.commands, configured)
 	return nil
 }
 
@@ -375,6 +578,9 @@ func (server *SugarDB) RemoveCommand(command ...string) {
 	server.commandsRWMut.Lock()
 	defer server.commandsRWMut.Unlock()
 
+	// The renamed commands are removed by their original names.
+	command = server.commandName(command)
+
 	switch len(command) {
 	case 1:
 		// Remove command
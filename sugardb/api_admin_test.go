@@ -567,3 +567,328 @@ func TestSugarDB_LastSave(t *testing.T) {
 		})
 	}
 }
+
+func TestSugarDB_BGRewriteAOF(t *testing.T) {
+	conf := DefaultConfig()
+	conf.DataDir = path.Join(".", "testdata", "data")
+	conf.EvictionPolicy = constants.NoEviction
+	server := createSugarDBWithConfig(conf)
+
+	tests := []struct {
+		name       string
+		inProgress bool
+		want       string
+		wantErr    bool
+	}{
+		{
+			name:    "1. Return status response when background rewrite is started",
+			want:    "Background append only file rewriting started",
+			wantErr: false,
+		},
+		{
+			name:       "2. Return an error when a rewrite is already in progress",
+			inProgress: true,
+			want:       "",
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Wait for the previous rewrite to finish.
+			for server.rewriteAOFInProgress.Load() {
+				time.Sleep(10 * time.Millisecond)
+			}
+			if tt.inProgress {
+				server.rewriteAOFInProgress.Store(true)
+				defer server.rewriteAOFInProgress.Store(false)
+			}
+			got, err := server.BGRewriteAOF()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("BGRewriteAOF() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("BGRewriteAOF() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSugarDB_Info(t *testing.T) {
+	server := createSugarDB()
+	server.setLatestSnapshot(clock.NewClock().Now().UnixMilli())
+	_ = server.getState()
+
+	tests := []struct {
+		name     string
+		sections []string
+		want     map[string][]string
+		wantErr  bool
+	}{
+		{
+			name:     "1. Return all sections when no section is specified",
+			sections: []string{},
+			want: map[string][]string{
+				"server":      {"server_name", "version", "server_id", "mode", "role", "modules"},
+				"clients":     {"connected_clients", "maxclients", "rejected_connections", "quota_rejections", "protected_mode"},
+				"memory":      {"used_memory", "maxmemory"},
+				"persistence": {"rdb_bgsave_in_progress", "rdb_last_save_time", "aof_rewrite_in_progress", "state_captures"},
+				"replication": {"role", "connected_slaves"},
+				"keyspace":    {},
+			},
+			wantErr: false,
+		},
+		{
+			name:     "2. Return only the specified section",
+			sections: []string{"PERSISTENCE"},
+			want: map[string][]string{
+				"persistence": {"latest_capture_pause_usec", "latest_capture_copy_usec"},
+			},
+			wantErr: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := server.Info(tt.sections...)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Info() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if len(got) != len(tt.want) {
+				t.Errorf("Info() expected %d sections, got %d", len(tt.want), len(got))
+				return
+			}
+			for section, fields := range tt.want {
+				for _, field := range fields {
+					if _, ok := got[section][field]; !ok {
+						t.Errorf("Info() expected field %s in section %s", field, section)
+					}
+				}
+			}
+			if got["persistence"]["state_captures"] != "1" {
+				t.Errorf("Info() expected state_captures to be 1, got %s", got["persistence"]["state_captures"])
+			}
+		})
+	}
+}
+
+func TestSugarDB_BGSave(t *testing.T) {
+	conf := DefaultConfig()
+	conf.DataDir = path.Join(".", "testdata", "data")
+	conf.EvictionPolicy = constants.NoEviction
+	server := createSugarDBWithConfig(conf)
+
+	tests := []struct {
+		name    string
+		want    bool
+		wantErr bool
+	}{
+		{
+			name:    "1. Return true response when background save process is started",
+			want:    true,
+			wantErr: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := server.BGSave()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("BGSave() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("BGSave() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSugarDB_StopWritesOnBGSaveError(t *testing.T) {
+	dataDir := path.Join(".", "testdata", "stop_writes")
+	t.Cleanup(func() {
+		_ = os.RemoveAll(dataDir)
+	})
+
+	tests := []struct {
+		name                    string
+		stopWritesOnBGSaveError bool
+		wantErr                 error
+	}{
+		{
+			name:                    "1. Reject write commands when the latest snapshot failed",
+			stopWritesOnBGSaveError: true,
+			wantErr: errors.New(
+				"MISCONF Errors writing the snapshot to disk. Commands that may modify the data set are disabled. " +
+					"Please check the server logs for details about the error."),
+		},
+		{
+			name:                    "2. Accept write commands when stop-writes-on-bgsave-error is disabled",
+			stopWritesOnBGSaveError: false,
+			wantErr:                 nil,
+		},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Create a file in place of the snapshots directory so that the snapshot fails.
+			dir := path.Join(dataDir, strconv.Itoa(i))
+			if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+				t.Error(err)
+				return
+			}
+			if err := os.WriteFile(path.Join(dir, "snapshots"), []byte{}, os.ModePerm); err != nil {
+				t.Error(err)
+				return
+			}
+
+			conf := DefaultConfig()
+			conf.DataDir = dir
+			conf.EvictionPolicy = constants.NoEviction
+			conf.StopWritesOnBGSaveError = tt.stopWritesOnBGSaveError
+			server := createSugarDBWithConfig(conf)
+
+			if _, _, err := server.Set("key1", "value1", SETOptions{}); err != nil {
+				t.Error(err)
+				return
+			}
+			if _, err := server.Save(); err == nil {
+				t.Error("expected save to fail")
+				return
+			}
+
+			info, err := server.Info("persistence")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if info["persistence"]["rdb_last_bgsave_status"] != "err" {
+				t.Errorf("expected rdb_last_bgsave_status to be err, got %s", info["persistence"]["rdb_last_bgsave_status"])
+			}
+
+			_, _, err = server.Set("key2", "value2", SETOptions{})
+			if tt.wantErr == nil && err != nil {
+				t.Errorf("Set() expected no error, got %v", err)
+				return
+			}
+			if tt.wantErr != nil && (err == nil || err.Error() != tt.wantErr.Error()) {
+				t.Errorf("Set() expected error %v, got %v", tt.wantErr, err)
+				return
+			}
+
+			// Read commands must still be accepted.
+			if _, err = server.Get("key1"); err != nil {
+				t.Errorf("Get() expected no error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestSugarDB_Snapshots(t *testing.T) {
+	dataDir := path.Join(".", "testdata", "snapshots")
+	t.Cleanup(func() {
+		_ = os.RemoveAll(dataDir)
+	})
+
+	conf := DefaultConfig()
+	conf.DataDir = dataDir
+	conf.EvictionPolicy = constants.NoEviction
+	server := createSugarDBWithConfig(conf)
+
+	// Set keys in databases 0 and 1.
+	for database, keys := range map[int][]string{0: {"key1", "key2"}, 1: {"key3"}} {
+		if err := server.SelectDB(database); err != nil {
+			t.Error(err)
+			return
+		}
+		for _, key := range keys {
+			if _, _, err := server.Set(key, "value", SETOptions{}); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}
+
+	if _, err := server.Save(); err != nil {
+		t.Error(err)
+		return
+	}
+
+	snapshots, err := server.ListSnapshots()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(snapshots) != 1 {
+		t.Errorf("expected 1 snapshot, got %d", len(snapshots))
+		return
+	}
+	id := snapshots[0].Id
+	if !snapshots[0].Latest || snapshots[0].Keys != 3 ||
+		snapshots[0].Databases[0] != 2 || snapshots[0].Databases[1] != 1 {
+		t.Errorf("unexpected snapshot info %+v", snapshots[0])
+	}
+
+	// Modify the data after the snapshot.
+	if _, _, err = server.Set("key4", "value", SETOptions{}); err != nil {
+		t.Error(err)
+		return
+	}
+	if _, err = server.Del("key3"); err != nil {
+		t.Error(err)
+		return
+	}
+
+	// Restore the whole snapshot.
+	ok, err := server.RestoreSnapshot(id)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !ok {
+		t.Error("expected RestoreSnapshot to return true")
+	}
+	if v, _ := server.Get("key3"); v != "value" {
+		t.Errorf("expected key3 to be restored, got %q", v)
+	}
+	if v, _ := server.Get("key4"); v != "" {
+		t.Errorf("expected key4 to be removed by the restore, got %q", v)
+	}
+
+	// Restore database 1 from the snapshot into database 2.
+	if ok, err = server.RestoreSnapshotDB(id, 1, 2); err != nil {
+		t.Error(err)
+		return
+	}
+	if !ok {
+		t.Error("expected RestoreSnapshotDB to return true")
+	}
+	if err = server.SelectDB(2); err != nil {
+		t.Error(err)
+		return
+	}
+	if v, _ := server.Get("key3"); v != "value" {
+		t.Errorf("expected key3 to be restored into database 2, got %q", v)
+	}
+
+	// Restoring a snapshot that does not exist returns an error.
+	if _, err = server.RestoreSnapshot(id + 1); err == nil {
+		t.Error("expected error when restoring a snapshot that does not exist")
+	}
+
+	// Export database 0 from the snapshot into the export directory in the data directory.
+	exportPath := path.Join(dataDir, "export", "db0.bin")
+	if ok, err = server.ExportSnapshotDB(id, 0, "db0.bin"); err != nil {
+		t.Error(err)
+		return
+	}
+	if !ok {
+		t.Error("expected ExportSnapshotDB to return true")
+	}
+	if _, err = os.Stat(exportPath); err != nil {
+		t.Errorf("expected exported file to exist: %v", err)
+	}
+
+	// Exporting outside of the export directory returns an error.
+	if _, err = server.ExportSnapshotDB(id, 0, path.Join("..", "db0.bin")); err == nil {
+		t.Error("expected error when exporting outside of the export directory")
+	}
+}
@@ -0,0 +1,299 @@
+// Copyright 2024 Kelvin Clement Mwinuka
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sugardb
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/echovault/sugardb/internal"
+)
+
+// ClusterShard describes a shard of the cluster. Slots holds the inclusive ranges of the hash slots
+// served by the shard, and Nodes holds the nodes of the shard with the leader first.
+type ClusterShard = internal.ClusterShard
+
+// ClusterNode describes a node of a shard. Host and Port are the address that clients connect to.
+type ClusterNode = internal.ClusterNode
+
+// ClusterNodeInfo describes a node of the cluster as returned by ClusterNodes. It holds the node's shard,
+// raft address, the leader of its shard and the slots the shard serves.
+type ClusterNodeInfo = internal.ClusterNodeInfo
+
+// ClusterInfo describes the state of the cluster as seen by a node, as returned by ClusterInfo.
+type ClusterInfo = internal.ClusterInfo
+
+// RoleInfo describes the replication role of a node, as returned by Role.
+type RoleInfo = internal.RoleInfo
+
+// ReplicaLink describes a replica of a standalone primary, as listed in RoleInfo.Links.
+type ReplicaLink = internal.ReplicaLink
+
+// ClusterKeySlot returns the hash slot of the key.
+//
+// Parameters:
+//
+// `key` - string - The key. If the key contains a hashtag, e.g. "{user1}.name", only the hashtag is hashed.
+//
+// Returns: The hash slot of the key, between 0 and 16383.
+func (server *SugarDB) ClusterKeySlot(key string) (int, error) {
+	b, err := server.handleCommand(server.context, internal.EncodeCommand([]string{"CLUSTER", "KEYSLOT", key}), nil, false, true)
+	if err != nil {
+		return 0, err
+	}
+	return internal.ParseIntegerResponse(b)
+}
+
+// ClusterCountKeysInSlot returns the number of keys in the hash slot in the current database of this node.
+//
+// Parameters:
+//
+// `slot` - int - The hash slot.
+//
+// Errors:
+//
+// "invalid slot" - When the slot is not between 0 and 16383.
+func (server *SugarDB) ClusterCountKeysInSlot(slot int) (int, error) {
+	b, err := server.handleCommand(server.context, internal.EncodeCommand([]string{"CLUSTER", "COUNTKEYSINSLOT", strconv.Itoa(slot)}), nil, false, true)
+	if err != nil {
+		return 0, err
+	}
+	return internal.ParseIntegerResponse(b)
+}
+
+// ClusterShards returns the shards of the cluster, sorted by id.
+//
+// Errors:
+//
+// "This instance has cluster support disabled" - When SugarDB is running in standalone mode.
+func (server *SugarDB) ClusterShards() ([]ClusterShard, error) {
+	return server.getClusterShards()
+}
+
+// ClusterInfo returns the state of the cluster as seen by this node, and the raft state of this node.
+//
+// Errors:
+//
+// "This instance has cluster support disabled" - When SugarDB is running in standalone mode.
+func (server *SugarDB) ClusterInfo() (ClusterInfo, error) {
+	return server.getClusterInfo()
+}
+
+// ClusterNodes returns the nodes of the cluster sorted by shard, with the leader of each shard first.
+// Nodes of this node's shard that have left or failed are returned with Connected set to false
+// until they are forgotten.
+//
+// Errors:
+//
+// "This instance has cluster support disabled" - When SugarDB is running in standalone mode.
+func (server *SugarDB) ClusterNodes() ([]ClusterNodeInfo, error) {
+	return server.getClusterNodes()
+}
+
+// ClusterMyID returns the server id of this node.
+//
+// Errors:
+//
+// "This instance has cluster support disabled" - When SugarDB is running in standalone mode.
+func (server *SugarDB) ClusterMyID() (string, error) {
+	b, err := server.handleCommand(server.context, internal.EncodeCommand([]string{"CLUSTER", "MYID"}), nil, false, true)
+	if err != nil {
+		return "", err
+	}
+	return internal.ParseStringResponse(b)
+}
+
+// ClusterLeader returns the server id of the leader of this node's shard.
+// It returns an empty string when the leader is unknown, e.g. during an election.
+//
+// Errors:
+//
+// "This instance has cluster support disabled" - When SugarDB is running in standalone mode.
+func (server *SugarDB) ClusterLeader() (string, error) {
+	b, err := server.handleCommand(server.context, internal.EncodeCommand([]string{"CLUSTER", "LEADER"}), nil, false, true)
+	if err != nil {
+		return "", err
+	}
+	return internal.ParseStringResponse(b)
+}
+
+// ClusterFailover transfers the leadership of this node's shard.
+//
+// Parameters:
+//
+// `nodeID` - string - The server id of the node of the shard that becomes the leader. When empty, a follower
+// takes over the leadership itself, and a leader hands it over to the most up-to-date follower.
+//
+// Errors:
+//
+// "This instance has cluster support disabled" - When SugarDB is running in standalone mode.
+//
+// "unknown node <id>" - When the node is not a member of the shard.
+func (server *SugarDB) ClusterFailover(nodeID string) (bool, error) {
+	cmd := []string{"CLUSTER", "FAILOVER"}
+	if nodeID != "" {
+		cmd = append(cmd, nodeID)
+	}
+	b, err := server.handleCommand(server.context, internal.EncodeCommand(cmd), nil, false, true)
+	if err != nil {
+		return false, err
+	}
+	s, err := internal.ParseStringResponse(b)
+	return strings.EqualFold(s, "ok"), err
+}
+
+// ClusterForget removes a node that has left or failed from the raft configuration of this node's shard.
+//
+// Parameters:
+//
+// `nodeID` - string - The server id of the node.
+//
+// Errors:
+//
+// "This instance has cluster support disabled" - When SugarDB is running in standalone mode.
+//
+// "node <id> is still a member of the cluster, use CLUSTER REMOVENODE" - When the node has not left the cluster.
+func (server *SugarDB) ClusterForget(nodeID string) (bool, error) {
+	b, err := server.handleCommand(server.context, internal.EncodeCommand([]string{"CLUSTER", "FORGET", nodeID}), nil, false, true)
+	if err != nil {
+		return false, err
+	}
+	s, err := internal.ParseStringResponse(b)
+	return strings.EqualFold(s, "ok"), err
+}
+
+// ClusterAddNode adds a node as a voter to the raft configuration of this node's shard.
+//
+// Parameters:
+//
+// `nodeID` - string - The server id of the node.
+//
+// `raftAddr` - string - The address of the node's raft transport, e.g. "10.0.0.2:8000".
+//
+// Errors:
+//
+// "This instance has cluster support disabled" - When SugarDB is running in standalone mode.
+func (server *SugarDB) ClusterAddNode(nodeID string, raftAddr string) (bool, error) {
+	b, err := server.handleCommand(server.context, internal.EncodeCommand([]string{"CLUSTER", "ADDNODE", nodeID, raftAddr}), nil, false, true)
+	if err != nil {
+		return false, err
+	}
+	s, err := internal.ParseStringResponse(b)
+	return strings.EqualFold(s, "ok"), err
+}
+
+// ClusterRemoveNode removes a node from the raft configuration of this node's shard.
+//
+// Parameters:
+//
+// `nodeID` - string - The server id of the node.
+//
+// Errors:
+//
+// "This instance has cluster support disabled" - When SugarDB is running in standalone mode.
+//
+// "unknown node <id>" - When the node is not a member of the shard.
+func (server *SugarDB) ClusterRemoveNode(nodeID string) (bool, error) {
+	b, err := server.handleCommand(server.context, internal.EncodeCommand([]string{"CLUSTER", "REMOVENODE", nodeID}), nil, false, true)
+	if err != nil {
+		return false, err
+	}
+	s, err := internal.ParseStringResponse(b)
+	return strings.EqualFold(s, "ok"), err
+}
+
+// ClusterPromote turns a non-voting replica of this node's shard into a voter.
+//
+// Parameters:
+//
+// `nodeID` - string - The server id of the replica.
+//
+// Errors:
+//
+// "This instance has cluster support disabled" - When SugarDB is running in standalone mode.
+//
+// "node <id> is already a voter" - When the node is not a replica.
+func (server *SugarDB) ClusterPromote(nodeID string) (bool, error) {
+	b, err := server.handleCommand(server.context, internal.EncodeCommand([]string{"CLUSTER", "PROMOTE", nodeID}), nil, false, true)
+	if err != nil {
+		return false, err
+	}
+	s, err := internal.ParseStringResponse(b)
+	return strings.EqualFold(s, "ok"), err
+}
+
+// ClusterDemote turns a voter of this node's shard into a non-voting replica.
+//
+// Parameters:
+//
+// `nodeID` - string - The server id of the voter.
+//
+// Errors:
+//
+// "This instance has cluster support disabled" - When SugarDB is running in standalone mode.
+//
+// "node <id> is the leader, transfer the leadership first" - When the node is the leader of the shard.
+func (server *SugarDB) ClusterDemote(nodeID string) (bool, error) {
+	b, err := server.handleCommand(server.context, internal.EncodeCommand([]string{"CLUSTER", "DEMOTE", nodeID}), nil, false, true)
+	if err != nil {
+		return false, err
+	}
+	s, err := internal.ParseStringResponse(b)
+	return strings.EqualFold(s, "ok"), err
+}
+
+// Role returns the replication role of this node. The leader of a shard and a standalone node are masters,
+// and the followers of a shard and the replicas of a standalone primary are slaves. Followers also report
+// whether they are non-voting replicas, and how far they lag behind the leader. Standalone nodes also report
+// the id and offset of the replication stream.
+func (server *SugarDB) Role() RoleInfo {
+	return server.getRole()
+}
+
+// ReplicaOf makes this standalone node an asynchronous replica of the primary at host and port.
+// The replica loads a copy of the primary's dataset in the background, then applies the primary's writes
+// as they happen. Write commands are rejected with a READONLY error while the node is a replica.
+//
+// Parameters:
+//
+// `host` - string - The host of the primary.
+//
+// `port` - int - The port of the primary.
+//
+// Errors:
+//
+// "REPLICAOF is not allowed in cluster mode" - When SugarDB is running in cluster mode.
+func (server *SugarDB) ReplicaOf(host string, port int) (bool, error) {
+	b, err := server.handleCommand(server.context, internal.EncodeCommand([]string{"REPLICAOF", host, strconv.Itoa(port)}), nil, false, true)
+	if err != nil {
+		return false, err
+	}
+	s, err := internal.ParseStringResponse(b)
+	return strings.EqualFold(s, "ok"), err
+}
+
+// ReplicaOfNoOne stops the replication of this standalone node and turns it into a primary that keeps its dataset.
+//
+// Errors:
+//
+// "REPLICAOF is not allowed in cluster mode" - When SugarDB is running in cluster mode.
+func (server *SugarDB) ReplicaOfNoOne() (bool, error) {
+	b, err := server.handleCommand(server.context, internal.EncodeCommand([]string{"REPLICAOF", "NO", "ONE"}), nil, false, true)
+	if err != nil {
+		return false, err
+	}
+	s, err := internal.ParseStringResponse(b)
+	return strings.EqualFold(s, "ok"), err
+}
@@ -0,0 +1,102 @@
+// Copyright 2024 Kelvin Clement Mwinuka
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sugardb
+
+import (
+	"context"
+	"testing"
+)
+
+func TestSugarDB_ClusterKeySlot(t *testing.T) {
+	t.Parallel()
+	server := createSugarDB()
+	tests := []struct {
+		name string
+		key  string
+		want int
+	}{
+		{name: "1. Return the slot of the key", key: "foo", want: 12182},
+		{name: "2. Return the slot of the hashtag", key: "{foo}.bar", want: 12182},
+		{name: "3. Hash the whole key when the hashtag is empty", key: "{}foo", want: 9500},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := server.ClusterKeySlot(tt.key)
+			if err != nil {
+				t.Errorf("ClusterKeySlot() error = %v", err)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("ClusterKeySlot() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSugarDB_ClusterCountKeysInSlot(t *testing.T) {
+	t.Parallel()
+	server := createSugarDB()
+	for _, key := range []string{"{user1}.name", "{user1}.email", "user2"} {
+		if err := presetValue(server, context.Background(), key, "value"); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+	tests := []struct {
+		name    string
+		slot    int
+		want    int
+		wantErr bool
+	}{
+		{name: "1. Count the keys in the slot", slot: 8106, want: 2},
+		{name: "2. Count the keys in an empty slot", slot: 0, want: 0},
+		{name: "3. Return error when the slot is out of range", slot: 16384, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := server.ClusterCountKeysInSlot(tt.slot)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ClusterCountKeysInSlot() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("ClusterCountKeysInSlot() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSugarDB_ClusterShards(t *testing.T) {
+	t.Parallel()
+	server := createSugarDB()
+	if _, err := server.ClusterShards(); err == nil {
+		t.Error("ClusterShards() expected error in standalone mode")
+	}
+}
+
+func TestSugarDB_Role(t *testing.T) {
+	t.Parallel()
+	server := createSugarDB()
+	role := server.Role()
+	if role.Role != "master" || role.Offset != 0 || len(role.Replicas) != 0 {
+		t.Errorf("Role() got = %+v, want a master without replicas", role)
+	}
+	if _, err := server.ClusterInfo(); err == nil {
+		t.Error("ClusterInfo() expected error in standalone mode")
+	}
+	if _, err := server.ClusterNodes(); err == nil {
+		t.Error("ClusterNodes() expected error in standalone mode")
+	}
+}
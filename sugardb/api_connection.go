@@ -16,7 +16,10 @@ package sugardb
 
 import (
 	"errors"
+	"fmt"
+	"github.com/echovault/sugardb/internal"
 	"slices"
+	"strings"
 )
 
 // SetProtocol sets the RESP protocol that's expected from responses to embedded API calls.
@@ -68,3 +71,57 @@ func (server *SugarDB) SelectDB(database int) error {
 
 	return nil
 }
+
+// SetReadConsistency sets the consistency of the reads served to the embedded API calls in cluster mode.
+// This does not affect the read consistency of any of the TCP clients.
+//
+// Parameters:
+//
+// `consistency` - string - The read consistency. One of "linearizable", "lease" or "stale".
+// Stale reads are served from the node's local state. Lease reads wait until the node has caught up
+// with the leader's applied state. Linearizable reads also wait for the leader to confirm its leadership
+// with the quorum.
+//
+// Errors:
+//
+// "unsupported read consistency" - When the provided consistency is not one of the supported values.
+func (server *SugarDB) SetReadConsistency(consistency string) error {
+	consistency = strings.ToLower(consistency)
+	if !isReadConsistency(consistency) {
+		return fmt.Errorf("unsupported read consistency %q", consistency)
+	}
+	server.connInfo.mut.Lock()
+	defer server.connInfo.mut.Unlock()
+	server.connInfo.embedded.ReadConsistency = consistency
+	return nil
+}
+
+// ClientList returns the TCP clients connected to the server. The embedded API is not a TCP client,
+// so it's not listed.
+//
+// Returns: a map of the fields of each client, sorted by id. The fields are "id", "addr", "laddr", "name", "age",
+// "idle", "db", "sub", "user", "resp" and "cmd". The age and idle times are in seconds.
+func (server *SugarDB) ClientList() ([]map[string]string, error) {
+	b, err := server.handleCommand(server.context, internal.EncodeCommand([]string{"CLIENT", "LIST"}), nil, false, true)
+	if err != nil {
+		return nil, err
+	}
+	res, err := internal.ParseStringResponse(b)
+	if err != nil {
+		return nil, err
+	}
+	clients := make([]map[string]string, 0)
+	for _, line := range strings.Split(res, "\n") {
+		if line == "" {
+			continue
+		}
+		client := make(map[string]string)
+		for _, field := range strings.Fields(line) {
+			if key, value, ok := strings.Cut(field, "="); ok {
+				client[key] = value
+			}
+		}
+		clients = append(clients, client)
+	}
+	return clients, nil
+}
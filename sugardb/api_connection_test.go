@@ -283,3 +283,47 @@ func TestSugarDB_SetProtocol(t *testing.T) {
 		})
 	}
 }
+
+func TestSugarDB_SetReadConsistency(t *testing.T) {
+	t.Parallel()
+	server := createSugarDB()
+	tests := []struct {
+		name        string
+		consistency string
+		want        string
+		wantErr     bool
+	}{
+		{
+			name:        "1. Change read consistency to linearizable",
+			consistency: "linearizable",
+			want:        "linearizable",
+			wantErr:     false,
+		},
+		{
+			name:        "2. Change read consistency to lease regardless of case",
+			consistency: "LEASE",
+			want:        "lease",
+			wantErr:     false,
+		},
+		{
+			name:        "3. Return error when read consistency is not supported",
+			consistency: "eventual",
+			want:        "lease",
+			wantErr:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := server.SetReadConsistency(tt.consistency)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("SetReadConsistency() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			// Check the read consistency of the embedded connection
+			if server.connInfo.embedded.ReadConsistency != tt.want {
+				t.Errorf("SetReadConsistency() consistency = %v, want %v",
+					server.connInfo.embedded.ReadConsistency, tt.want)
+			}
+		})
+	}
+}
@@ -31,11 +31,12 @@ type conn struct {
 
 var connections sync.Map
 
-// ReadPubSubMessage is returned by the Subscribe and PSubscribe functions.
+// ReadPubSubMessage is returned by the Subscribe, PSubscribe and SSubscribe functions.
 //
 // This function is lazy, therefore it needs to be invoked in order to read the next message.
 // When the message is read, the function returns a string slice with 3 elements.
-// Index 0 holds the event type which in this case will be "message". Index 1 holds the channel name.
+// Index 0 holds the event type which in this case will be "message", or "smessage" for shard channels.
+// Index 1 holds the channel name.
 // Index 2 holds the actual message.
 type ReadPubSubMessage func() []string
 
@@ -171,6 +172,59 @@ func (server *SugarDB) PUnsubscribe(tag string, patterns ...string) {
 	_, _ = server.handleCommand(server.context, internal.EncodeCommand(cmd), c.(conn).writeConn, false, true)
 }
 
+// SSubscribe subscribes the caller to the list of provided shard channels.
+//
+// Parameters:
+//
+// `tag` - string - The tag used to identify this subscription instance.
+//
+// `channels` - ...string - The list of shard channels to subscribe to.
+//
+// Returns: ReadPubSubMessage function which reads the next message sent to the subscription instance.
+// This function is blocking.
+func (server *SugarDB) SSubscribe(tag string, channels ...string) (ReadPubSubMessage, error) {
+	readConn, writeConn, err := establishConnections(tag)
+	if err != nil {
+		return func() []string {
+			return []string{}
+		}, err
+	}
+
+	// Subscribe connection to the provided shard channels.
+	cmd := append([]string{"SSUBSCRIBE"}, channels...)
+	go func() {
+		_, _ = server.handleCommand(server.context, internal.EncodeCommand(cmd), writeConn, false, true)
+	}()
+
+	return func() []string {
+		r := resp.NewConn(*readConn)
+		v, _, _ := r.ReadValue()
+
+		res := make([]string, len(v.Array()))
+		for i := 0; i < len(res); i++ {
+			res[i] = v.Array()[i].String()
+		}
+
+		return res
+	}, nil
+}
+
+// SUnsubscribe unsubscribes the caller from the given shard channels.
+//
+// Parameters:
+//
+// `tag` - string - The tag used to identify this subscription instance.
+//
+// `channels` - ...string - The list of shard channels to unsubscribe from.
+func (server *SugarDB) SUnsubscribe(tag string, channels ...string) {
+	c, ok := connections.Load(tag)
+	if !ok {
+		return
+	}
+	cmd := append([]string{"SUNSUBSCRIBE"}, channels...)
+	_, _ = server.handleCommand(server.context, internal.EncodeCommand(cmd), c.(conn).writeConn, false, true)
+}
+
 // Publish publishes a message to the given channel.
 //
 // Parameters:
@@ -190,6 +244,26 @@ func (server *SugarDB) Publish(channel, message string) (bool, error) {
 	return strings.EqualFold(s, "ok"), err
 }
 
+// SPublish publishes a message to the given shard channel.
+// In cluster mode, the message is only delivered to the subscribers on the nodes of the shard that serves the channel.
+//
+// Parameters:
+//
+// `channel` - string - The shard channel to publish the message to.
+//
+// `message` - string - The message to publish to the specified shard channel.
+//
+// Returns: true when the publish is successful. This does not indicate whether each subscriber has received the message,
+// only that the message has been published.
+func (server *SugarDB) SPublish(channel, message string) (bool, error) {
+	b, err := server.handleCommand(server.context, internal.EncodeCommand([]string{"SPUBLISH", channel, message}), nil, false, true)
+	if err != nil {
+		return false, err
+	}
+	s, err := internal.ParseStringResponse(b)
+	return strings.EqualFold(s, "ok"), err
+}
+
 // PubSubChannels returns the list of channels & patterns that match the glob pattern provided.
 //
 // Parameters:
@@ -251,3 +325,54 @@ func (server *SugarDB) PubSubNumSub(channels ...string) (map[string]int, error)
 
 	return result, nil
 }
+
+// PubSubShardChannels returns the list of active shard channels that match the glob pattern provided.
+//
+// Parameters:
+//
+// `pattern` - string - The glob pattern used to match the shard channel names.
+//
+// Returns: A string slice of all the active shard channels (i.e. shard channels that have 1 or more subscribers).
+func (server *SugarDB) PubSubShardChannels(pattern string) ([]string, error) {
+	cmd := []string{"PUBSUB", "SHARDCHANNELS"}
+	if pattern != "" {
+		cmd = append(cmd, pattern)
+	}
+	b, err := server.handleCommand(server.context, internal.EncodeCommand(cmd), nil, false, true)
+	if err != nil {
+		return nil, err
+	}
+	return internal.ParseStringArrayResponse(b)
+}
+
+// PubSubShardNumSub returns the number of subscribers for each of the specified shard channels.
+//
+// Parameters:
+//
+// `channels` - ...string - The list of shard channels whose number of subscribers is to be checked.
+//
+// Returns: A map of map[string]int where the key is the shard channel name and the value is the number of subscribers.
+func (server *SugarDB) PubSubShardNumSub(channels ...string) (map[string]int, error) {
+	cmd := append([]string{"PUBSUB", "SHARDNUMSUB"}, channels...)
+
+	b, err := server.handleCommand(server.context, internal.EncodeCommand(cmd), nil, false, true)
+	if err != nil {
+		return nil, err
+	}
+
+	r := resp.NewReader(bytes.NewReader(b))
+	v, _, err := r.ReadValue()
+	if err != nil {
+		return nil, err
+	}
+
+	arr := v.Array()
+
+	result := make(map[string]int, len(arr))
+	for _, entry := range arr {
+		e := entry.Array()
+		result[e[0].String()] = e[1].Integer()
+	}
+
+	return result, nil
+}
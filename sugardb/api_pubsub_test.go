@@ -126,6 +126,79 @@ func TestSugarDB_PSubscribe(t *testing.T) {
 	server.PUnsubscribe(tag, patterns...)
 }
 
+func TestSugarDB_SSubscribe(t *testing.T) {
+	server := createSugarDB()
+
+	// Subscribe to shard channels.
+	tag := "shard_tag"
+	channels := []string{"shard_channel1", "shard_channel2"}
+	readMessage, err := server.SSubscribe(tag, channels...)
+	if err != nil {
+		t.Errorf("SSubscribe() error = %v", err)
+	}
+	for i := 0; i < len(channels); i++ {
+		message := readMessage()
+		if message[0] != "ssubscribe" {
+			t.Errorf("SSUBSCRIBE() expected index 0 for message at %d to be \"ssubscribe\", got %s", i, message[0])
+		}
+		if !slices.Contains(channels, message[1]) {
+			t.Errorf("SSUBSCRIBE() unexpected string \"%s\" at index 1 for message %d", message[1], i)
+		}
+	}
+
+	// Shard channels are separate from regular channels.
+	active, err := server.PubSubChannels("")
+	if err != nil {
+		t.Errorf("PubSubChannels() error = %v", err)
+	}
+	for _, channel := range channels {
+		if slices.Contains(active, channel) {
+			t.Errorf("PubSubChannels() expected shard channel %s not to be a regular channel", channel)
+		}
+	}
+	activeShard, err := server.PubSubShardChannels("shard_channel*")
+	if err != nil {
+		t.Errorf("PubSubShardChannels() error = %v", err)
+	}
+	slices.Sort(activeShard)
+	if !reflect.DeepEqual(activeShard, channels) {
+		t.Errorf("PubSubShardChannels() got = %v, want %v", activeShard, channels)
+	}
+	numSub, err := server.PubSubShardNumSub("shard_channel1", "shard_channel3")
+	if err != nil {
+		t.Errorf("PubSubShardNumSub() error = %v", err)
+	}
+	if want := map[string]int{"shard_channel1": 1, "shard_channel3": 0}; !reflect.DeepEqual(numSub, want) {
+		t.Errorf("PubSubShardNumSub() got = %v, want %v", numSub, want)
+	}
+
+	// Publishing to a regular channel with the same name doesn't reach the shard channel subscribers.
+	if _, err = server.Publish("shard_channel1", "regular message"); err != nil {
+		t.Errorf("PUBLISH() err = %v", err)
+	}
+	ok, err := server.SPublish("shard_channel1", "shard message")
+	if err != nil {
+		t.Errorf("SPUBLISH() err = %v", err)
+	}
+	if !ok {
+		t.Errorf("SPUBLISH() could not publish message to shard channel shard_channel1")
+	}
+	message := readMessage()
+	if want := []string{"smessage", "shard_channel1", "shard message"}; !reflect.DeepEqual(message, want) {
+		t.Errorf("SSUBSCRIBE() got message %v, want %v", message, want)
+	}
+
+	// Unsubscribe from the shard channels.
+	server.SUnsubscribe(tag, channels...)
+	numSub, err = server.PubSubShardNumSub(channels...)
+	if err != nil {
+		t.Errorf("PubSubShardNumSub() error = %v", err)
+	}
+	if want := map[string]int{"shard_channel1": 0, "shard_channel2": 0}; !reflect.DeepEqual(numSub, want) {
+		t.Errorf("PubSubShardNumSub() got = %v, want %v", numSub, want)
+	}
+}
+
 func TestSugarDB_PubSubChannels(t *testing.T) {
 	server := createSugarDB()
 	tests := []struct {
@@ -0,0 +1,56 @@
+// Copyright 2024 Kelvin Clement Mwinuka
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sugardb
+
+import (
+	"context"
+	"github.com/echovault/sugardb/internal"
+	"github.com/echovault/sugardb/internal/audit"
+	"net"
+)
+
+// AuditEvent describes a command recorded by the audit log, as passed to the hook set with WithAuditHook.
+type AuditEvent = internal.AuditEvent
+
+// WithAuditHook is an option to the NewSugarDB function that sets a function that's called with every audited command,
+// whether the audit log file is enabled or not. The commands that are audited are configured with the
+// AuditLogCategories, AuditLogCommands and AuditLogExcludeCommands config options.
+// The secrets of the command are redacted. The function is called after the command has run and must not block.
+func WithAuditHook(hook func(event AuditEvent)) func(sugardb *SugarDB) {
+	return func(sugardb *SugarDB) {
+		sugardb.auditHook = hook
+	}
+}
+
+// auditCommand records the outcome of a command in the audit log.
+func (server *SugarDB) auditCommand(ctx context.Context, conn *net.Conn, embedded bool, cmd []string, err error) {
+	event := internal.AuditEvent{
+		Client:  "embedded",
+		Command: cmd,
+		Outcome: audit.OutcomeOK,
+	}
+	event.Database, _ = ctx.Value("Database").(int)
+	if conn != nil && !embedded {
+		event.Client = (*conn).RemoteAddr().String()
+		if server.acl != nil {
+			event.Username = server.acl.Username(conn)
+		}
+	}
+	if err != nil {
+		event.Outcome = audit.OutcomeError
+		event.Error = err.Error()
+	}
+	server.audit.Log(event)
+}
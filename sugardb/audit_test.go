@@ -0,0 +1,203 @@
+// Copyright 2024 Kelvin Clement Mwinuka
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sugardb
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/echovault/sugardb/internal"
+	"github.com/echovault/sugardb/internal/audit"
+	"github.com/echovault/sugardb/internal/constants"
+	"github.com/tidwall/resp"
+	"os"
+	"path"
+	"slices"
+	"sync"
+	"testing"
+)
+
+func Test_AuditLog(t *testing.T) {
+	port, err := internal.GetFreePort()
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := path.Join(t.TempDir(), "audit.log")
+
+	var mut sync.Mutex
+	var hooked []AuditEvent
+
+	conf := DefaultConfig()
+	conf.DataDir = ""
+	conf.BindAddr = "localhost"
+	conf.Port = uint16(port)
+	conf.EvictionPolicy = constants.NoEviction
+	conf.AuditLog = file
+	conf.AuditLogCommands = []string{"get"}
+	conf.AuditLogExcludeCommands = []string{"ping"}
+
+	server, err := NewSugarDB(
+		WithConfig(conf),
+		WithAuditHook(func(event AuditEvent) {
+			mut.Lock()
+			defer mut.Unlock()
+			hooked = append(hooked, event)
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Start()
+	t.Cleanup(server.ShutDown)
+
+	conn, err := internal.GetConnection("localhost", port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = conn.Close()
+	})
+	client := resp.NewConn(conn)
+	for _, cmd := range [][]string{
+		{"ACL", "SETUSER", "audited_user", "on", ">secret"},
+		{"ACL", "GETUSER", "missing_user"},
+		{"GET", "key"},
+		{"SET", "key", "value"},
+		{"PING"},
+	} {
+		values := make([]resp.Value, len(cmd))
+		for i, c := range cmd {
+			values[i] = resp.StringValue(c)
+		}
+		if err = client.WriteArray(values); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err = client.ReadValue(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err = server.ACLDelUser("audited_user"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []AuditEvent{
+		{Username: "default", Command: []string{"ACL", "SETUSER", "audited_user", "on", ">(redacted)"}, Outcome: audit.OutcomeOK},
+		{Username: "default", Command: []string{"ACL", "GETUSER", "missing_user"}, Outcome: audit.OutcomeError, Error: "user not found"},
+		{Username: "default", Command: []string{"GET", "key"}, Outcome: audit.OutcomeOK},
+		{Client: "embedded", Command: []string{"ACL", "DELUSER", "audited_user"}, Outcome: audit.OutcomeOK},
+	}
+
+	b, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var logged []AuditEvent
+	for _, line := range bytes.Split(bytes.TrimSpace(b), []byte("\n")) {
+		var event AuditEvent
+		if err = json.Unmarshal(line, &event); err != nil {
+			t.Fatal(err)
+		}
+		logged = append(logged, event)
+	}
+
+	mut.Lock()
+	defer mut.Unlock()
+	for name, events := range map[string][]AuditEvent{"file": logged, "hook": hooked} {
+		if len(events) != len(want) {
+			t.Fatalf("expected %d events in the %s, got %+v", len(want), name, events)
+		}
+		for i, event := range events {
+			if event.Username != want[i].Username || !slices.Equal(event.Command, want[i].Command) ||
+				event.Outcome != want[i].Outcome || event.Error != want[i].Error || event.Database != 0 {
+				t.Errorf("expected %s event %d to be %+v, got %+v", name, i, want[i], event)
+			}
+			if want[i].Client == "embedded" && event.Client != "embedded" ||
+				want[i].Client == "" && event.Client != conn.LocalAddr().String() {
+				t.Errorf("expected the client of %s event %d to be set, got %q", name, i, event.Client)
+			}
+		}
+	}
+}
+
+func Test_AuditLogRenamedCommands(t *testing.T) {
+	port, err := internal.GetFreePort()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mut sync.Mutex
+	var hooked []AuditEvent
+
+	conf := DefaultConfig()
+	conf.DataDir = ""
+	conf.BindAddr = "localhost"
+	conf.Port = uint16(port)
+	conf.EvictionPolicy = constants.NoEviction
+	conf.AuditLogCommands = []string{"myauth"}
+	conf.RenameCommands = map[string]string{"acl": "myacl", "auth": "myauth"}
+
+	server, err := NewSugarDB(
+		WithConfig(conf),
+		WithAuditHook(func(event AuditEvent) {
+			mut.Lock()
+			defer mut.Unlock()
+			hooked = append(hooked, event)
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Start()
+	t.Cleanup(server.ShutDown)
+
+	conn, err := internal.GetConnection("localhost", port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = conn.Close()
+	})
+	client := resp.NewConn(conn)
+	for _, cmd := range [][]string{
+		{"MYACL", "SETUSER", "alice", "on", ">s3cret"},
+		{"MYAUTH", "alice", "s3cret"},
+	} {
+		values := make([]resp.Value, len(cmd))
+		for i, c := range cmd {
+			values[i] = resp.StringValue(c)
+		}
+		if err = client.WriteArray(values); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err = client.ReadValue(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The events have the names the client used, and the secrets are redacted according to the original names.
+	want := [][]string{
+		{"MYACL", "SETUSER", "alice", "on", ">(redacted)"},
+		{"MYAUTH", "alice", "(redacted)"},
+	}
+	mut.Lock()
+	defer mut.Unlock()
+	if len(hooked) != len(want) {
+		t.Fatalf("expected %d events, got %+v", len(want), hooked)
+	}
+	for i, event := range hooked {
+		if !slices.Equal(event.Command, want[i]) {
+			t.Errorf("expected event %d to have command %v, got %v", i, want[i], event.Command)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright 2024 Kelvin Clement Mwinuka
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sugardb
+
+import (
+	"github.com/echovault/sugardb/internal/backup"
+)
+
+// BackupTarget is a location that snapshots and AOF segments are uploaded to and restored from.
+// Implement this interface to back up to a custom location.
+type BackupTarget = backup.Target
+
+// S3BackupOptions configures an S3-compatible backup target.
+type S3BackupOptions = backup.S3Options
+
+// ErrBackupNotFound must be returned (or wrapped) by BackupTarget.Get when the object does not exist.
+var ErrBackupNotFound = backup.ErrNotFound
+
+// NewFileBackupTarget returns a BackupTarget that stores backups in the given directory.
+func NewFileBackupTarget(directory string) BackupTarget {
+	return backup.NewFileTarget(directory)
+}
+
+// NewS3BackupTarget returns a BackupTarget that stores backups in an S3-compatible object store.
+//
+// Errors:
+//
+// "s3 backup target: bucket is required" - When the bucket is not provided.
+func NewS3BackupTarget(options S3BackupOptions) (BackupTarget, error) {
+	return backup.NewS3Target(options)
+}
+
+// WithBackupTarget is an option to the NewSugarDB function that allows you to pass a custom BackupTarget.
+// This takes precedence over the BackupTarget URL in the configuration. Only works in standalone mode.
+func WithBackupTarget(target BackupTarget) func(sugardb *SugarDB) {
+	return func(sugardb *SugarDB) {
+		sugardb.backupTarget = target
+	}
+}
+
+// newBackupTarget returns the backup target from the options or the configuration.
+// Returns nil if no backup target is configured.
+func (server *SugarDB) newBackupTarget() (backup.Target, error) {
+	if server.backupTarget != nil {
+		return server.backupTarget, nil
+	}
+	if server.config.BackupTarget == "" {
+		return nil, nil
+	}
+	return backup.ParseTarget(server.config.BackupTarget, backup.S3Options{
+		Endpoint: server.config.BackupS3Endpoint,
+		Region:   server.config.BackupS3Region,
+	})
+}
@@ -0,0 +1,201 @@
+// Copyright 2024 Kelvin Clement Mwinuka
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sugardb
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/echovault/sugardb/internal"
+	"github.com/echovault/sugardb/internal/modules/set"
+	"github.com/echovault/sugardb/internal/modules/sorted_set"
+)
+
+// captureBatchSize is the number of keys copied each time the store lock is acquired during a state capture.
+const captureBatchSize = 1000
+
+// stateCapture is a copy-on-write view of the store at the moment the capture was started.
+// Instead of copying the whole store while writers wait, only the list of keys is recorded up front.
+// Any write to a key while the capture is active first saves the key's previous value into preImages,
+// so the background copy can always read the value the key had when the capture started.
+type stateCapture struct {
+	// The keys that existed in each database when the capture started.
+	keys map[int][]string
+	// Values of keys as they were when the capture started, saved just before the key was first modified.
+	// A nil entry means the key did not exist when the capture started.
+	preImages map[int]map[string]*internal.KeyData
+}
+
+// beginStateCapture registers a new copy-on-write capture of the store.
+// Write commands are paused only for the time it takes to record the keyspace.
+// The onCapture function, if provided, is called while writes are paused. This allows callers to record
+// other state (e.g. the current AOF offset) at the exact point in time the capture represents.
+func (server *SugarDB) beginStateCapture(onCapture func()) *stateCapture {
+	start := time.Now()
+
+	server.stateCapture.pause.Lock()
+	defer server.stateCapture.pause.Unlock()
+
+	server.storeLock.RLock()
+	capture := &stateCapture{
+		keys:      make(map[int][]string, len(server.store)),
+		preImages: make(map[int]map[string]*internal.KeyData, len(server.store)),
+	}
+	for database, data := range server.store {
+		capture.keys[database] = make([]string, 0, len(data))
+		capture.preImages[database] = make(map[string]*internal.KeyData)
+		for key, _ := range data {
+			capture.keys[database] = append(capture.keys[database], key)
+		}
+	}
+	server.storeLock.RUnlock()
+
+	server.stateCapture.mut.Lock()
+	server.stateCapture.active = append(server.stateCapture.active, capture)
+	server.stateCapture.mut.Unlock()
+
+	if onCapture != nil {
+		onCapture()
+	}
+
+	server.stateCapture.lastPause.Store(int64(time.Since(start)))
+
+	return capture
+}
+
+// collectStateCapture copies the state represented by the capture and unregisters it.
+// The copy is done in batches so that write commands can interleave with the copy.
+func (server *SugarDB) collectStateCapture(capture *stateCapture) map[int]map[string]internal.KeyData {
+	start := time.Now()
+
+	state := make(map[int]map[string]internal.KeyData, len(capture.keys))
+	for database, keys := range capture.keys {
+		state[database] = make(map[string]internal.KeyData, len(keys))
+		for i := 0; i < len(keys); i += captureBatchSize {
+			batch := keys[i:min(i+captureBatchSize, len(keys))]
+			server.storeLock.RLock()
+			server.stateCapture.mut.Lock()
+			for _, key := range batch {
+				if data, ok := capture.preImages[database][key]; ok {
+					if data != nil {
+						state[database][key] = *data
+					}
+					continue
+				}
+				if data, ok := server.store[database][key]; ok {
+					state[database][key] = internal.KeyData{
+						Value:    copyValue(data.Value),
+						ExpireAt: data.ExpireAt,
+					}
+				}
+			}
+			server.stateCapture.mut.Unlock()
+			server.storeLock.RUnlock()
+		}
+	}
+
+	server.stateCapture.mut.Lock()
+	server.stateCapture.active = slices.DeleteFunc(server.stateCapture.active, func(c *stateCapture) bool {
+		return c == capture
+	})
+	server.stateCapture.mut.Unlock()
+
+	server.stateCapture.lastCopy.Store(int64(time.Since(start)))
+	server.stateCapture.count.Add(1)
+
+	return state
+}
+
+// captureState returns a point-in-time copy of the store without blocking writers for the duration of the copy.
+func (server *SugarDB) captureState(onCapture func()) map[int]map[string]internal.KeyData {
+	return server.collectStateCapture(server.beginStateCapture(onCapture))
+}
+
+// preserveKeys saves the current values of the keys into all the active captures before they're modified.
+// This is called before a write command's handler runs because handlers can mutate values in place.
+func (server *SugarDB) preserveKeys(ctx context.Context, keys []string) {
+	if len(keys) == 0 || !server.hasActiveStateCapture() {
+		return
+	}
+	database := ctx.Value("Database").(int)
+	server.storeLock.RLock()
+	defer server.storeLock.RUnlock()
+	for _, key := range keys {
+		server.preserveKey(database, key)
+	}
+}
+
+// preserveKey saves the current value of the key into all the active captures that have not seen the key yet.
+// The caller must hold the store lock.
+func (server *SugarDB) preserveKey(database int, key string) {
+	server.stateCapture.mut.Lock()
+	defer server.stateCapture.mut.Unlock()
+	for _, capture := range server.stateCapture.active {
+		if capture.preImages[database] == nil {
+			// The database did not exist when the capture started, so none of its keys belong in the capture.
+			continue
+		}
+		if _, ok := capture.preImages[database][key]; ok {
+			continue
+		}
+		data, ok := server.store[database][key]
+		if !ok {
+			capture.preImages[database][key] = nil
+			continue
+		}
+		capture.preImages[database][key] = &internal.KeyData{
+			Value:    copyValue(data.Value),
+			ExpireAt: data.ExpireAt,
+		}
+	}
+}
+
+// preserveDatabase saves the current values of all the keys in the database before the database is cleared.
+// The caller must hold the store lock.
+func (server *SugarDB) preserveDatabase(database int) {
+	if !server.hasActiveStateCapture() {
+		return
+	}
+	for key, _ := range server.store[database] {
+		server.preserveKey(database, key)
+	}
+}
+
+func (server *SugarDB) hasActiveStateCapture() bool {
+	server.stateCapture.mut.Lock()
+	defer server.stateCapture.mut.Unlock()
+	return len(server.stateCapture.active) > 0
+}
+
+// copyValue returns a copy of the value that will not be affected by in-place mutations of the original.
+func copyValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, val := range v {
+			m[key] = val
+		}
+		return m
+	case []string:
+		return slices.Clone(v)
+	case *set.Set:
+		return set.NewSet(v.GetAll())
+	case *sorted_set.SortedSet:
+		return sorted_set.NewSortedSet(v.GetAll())
+	default:
+		return value
+	}
+}
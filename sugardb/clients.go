@@ -0,0 +1,201 @@
+// Copyright 2024 Kelvin Clement Mwinuka
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sugardb
+
+import (
+	"cmp"
+	"crypto/tls"
+	"errors"
+	"github.com/echovault/sugardb/internal"
+	"github.com/echovault/sugardb/internal/config"
+	"net"
+	"slices"
+	"strings"
+	"time"
+)
+
+var (
+	errMaxClients      = errors.New("ERR max number of clients reached")
+	errMaxClientsPerIP = errors.New("ERR max number of clients reached for this IP address")
+	errProtectedMode   = errors.New("DENIED SugarDB is running in protected mode because protected mode is enabled " +
+		"and no authentication is configured. In this mode connections are only accepted from the loopback interface. " +
+		"Enable require-pass or mtls, add an ACL user with a password or a JWT key, " +
+		"or disable protected mode with --protected-mode=false.")
+)
+
+// registerConnection records the connection of a TCP client. It returns an error when the connection exceeds
+// the client limits, or when it's refused by the protected mode.
+func (server *SugarDB) registerConnection(conn *net.Conn, id uint64) error {
+	conf := server.liveConfig()
+	addr := (*conn).RemoteAddr().String()
+
+	if conf.ProtectedMode && !server.authenticationConfigured(conf) && !isLoopback(addr) {
+		return errProtectedMode
+	}
+
+	server.connInfo.mut.Lock()
+	defer server.connInfo.mut.Unlock()
+
+	if conf.MaxClients > 0 && uint(len(server.connInfo.tcpClients)) >= conf.MaxClients {
+		return errMaxClients
+	}
+	if conf.MaxClientsPerIP > 0 {
+		var count uint
+		for _, info := range server.connInfo.tcpClients {
+			if addrHost(info.Addr) == addrHost(addr) {
+				count++
+			}
+		}
+		if count >= conf.MaxClientsPerIP {
+			return errMaxClientsPerIP
+		}
+	}
+
+	now := server.clock.Now()
+	server.connInfo.tcpClients[conn] = internal.ConnectionInfo{
+		Id:              id,
+		Name:            "",
+		Protocol:        2,
+		Database:        0,
+		ReadConsistency: conf.ReadConsistency,
+		Addr:            addr,
+		LocalAddr:       (*conn).LocalAddr().String(),
+		Created:         now,
+		LastCommandAt:   now,
+	}
+	return nil
+}
+
+// unregisterConnection removes the record of a TCP client when it disconnects.
+func (server *SugarDB) unregisterConnection(conn *net.Conn) {
+	server.connInfo.mut.Lock()
+	defer server.connInfo.mut.Unlock()
+	delete(server.connInfo.tcpClients, conn)
+}
+
+// touchConnection records the latest command of a TCP client.
+func (server *SugarDB) touchConnection(conn *net.Conn, command string) {
+	server.connInfo.mut.Lock()
+	defer server.connInfo.mut.Unlock()
+	info, ok := server.connInfo.tcpClients[conn]
+	if !ok {
+		return
+	}
+	info.LastCommand = command
+	info.LastCommandAt = server.clock.Now()
+	server.connInfo.tcpClients[conn] = info
+}
+
+// listClients returns the connected TCP clients, sorted by id.
+func (server *SugarDB) listClients() []internal.ClientInfo {
+	server.connInfo.mut.RLock()
+	conns := make([]*net.Conn, 0, len(server.connInfo.tcpClients))
+	clients := make([]internal.ClientInfo, 0, len(server.connInfo.tcpClients))
+	for conn, info := range server.connInfo.tcpClients {
+		conns = append(conns, conn)
+		clients = append(clients, internal.ClientInfo{ConnectionInfo: info})
+	}
+	server.connInfo.mut.RUnlock()
+
+	for i, conn := range conns {
+		if server.acl != nil {
+			clients[i].User = server.acl.Username(conn)
+		}
+		clients[i].Subscriptions = server.pubSub.Subscriptions(conn)
+	}
+	slices.SortFunc(clients, func(a, b internal.ClientInfo) int {
+		return cmp.Compare(a.Id, b.Id)
+	})
+	return clients
+}
+
+// getClientsInfo returns the number of TCP clients, the limits of the client connections and the number of
+// connections and commands they rejected.
+func (server *SugarDB) getClientsInfo() internal.ClientsInfo {
+	conf := server.liveConfig()
+	server.connInfo.mut.RLock()
+	connected := len(server.connInfo.tcpClients)
+	server.connInfo.mut.RUnlock()
+	var quotaRejections uint64
+	if server.acl != nil {
+		quotaRejections = server.acl.QuotaRejections()
+	}
+	return internal.ClientsInfo{
+		Connected:           connected,
+		MaxClients:          conf.MaxClients,
+		MaxClientsPerIP:     conf.MaxClientsPerIP,
+		RejectedConnections: server.rejectedConnections.Load(),
+		QuotaRejections:     quotaRejections,
+		Timeout:             conf.Timeout,
+		TCPKeepAlive:        conf.TCPKeepAlive,
+		ProtectedMode:       conf.ProtectedMode,
+	}
+}
+
+// idleDeadline returns the time after which the client is disconnected if it does not send a command.
+// Clients that are subscribed to channels are expected to be idle, so they have no deadline.
+func (server *SugarDB) idleDeadline(conn *net.Conn) time.Time {
+	timeout := server.liveConfig().Timeout
+	if timeout <= 0 || server.pubSub.Subscriptions(conn) > 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(timeout)
+}
+
+// setKeepAlive sets the period of the TCP keepalives of the connection. 0 disables the keepalives.
+func setKeepAlive(conn net.Conn, period time.Duration) error {
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		conn = tlsConn.NetConn()
+	}
+	tcpConn, ok := conn.(*net.TCPConn)
+	if !ok {
+		return nil
+	}
+	if period <= 0 {
+		return tcpConn.SetKeepAlive(false)
+	}
+	if err := tcpConn.SetKeepAlive(true); err != nil {
+		return err
+	}
+	return tcpConn.SetKeepAlivePeriod(period)
+}
+
+// authenticationConfigured returns true when the clients must authenticate with a password or a client certificate,
+// or can authenticate as an ACL user with a password or with a JWT.
+func (server *SugarDB) authenticationConfigured(conf config.Config) bool {
+	if conf.RequirePass || conf.MTLS {
+		return true
+	}
+	return server.acl != nil && server.acl.AuthenticationConfigured()
+}
+
+// isLoopback returns true when the address is on the loopback interface.
+func isLoopback(addr string) bool {
+	host := addrHost(addr)
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// addrHost returns the host of a "host:port" address.
+func addrHost(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
@@ -0,0 +1,317 @@
+// Copyright 2024 Kelvin Clement Mwinuka
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sugardb
+
+import (
+	"context"
+	"errors"
+	"github.com/echovault/sugardb/internal"
+	"github.com/echovault/sugardb/internal/config"
+	"github.com/echovault/sugardb/internal/constants"
+	"github.com/tidwall/resp"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// remoteConn is a connection from a remote address.
+type remoteConn struct {
+	net.Conn
+	addr net.Addr
+}
+
+func (conn remoteConn) RemoteAddr() net.Addr {
+	return conn.addr
+}
+
+func Test_ClientConnections(t *testing.T) {
+	port, err := internal.GetFreePort()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conf := DefaultConfig()
+	conf.DataDir = ""
+	conf.BindAddr = "localhost"
+	conf.Port = uint16(port)
+	conf.EvictionPolicy = constants.NoEviction
+	conf.MaxClients = 2
+
+	server, err := NewSugarDB(WithConfig(conf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Start()
+	t.Cleanup(server.ShutDown)
+
+	setConfig := func(f func(conf *config.Config)) {
+		server.configMut.Lock()
+		defer server.configMut.Unlock()
+		f(&server.config)
+	}
+
+	connect := func(t *testing.T) (*resp.Conn, net.Conn) {
+		conn, err := internal.GetConnection("localhost", port)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			_ = conn.Close()
+		})
+		return resp.NewConn(conn), conn
+	}
+	send := func(t *testing.T, client *resp.Conn, cmd ...string) resp.Value {
+		values := make([]resp.Value, len(cmd))
+		for i, c := range cmd {
+			values[i] = resp.StringValue(c)
+		}
+		if err := client.WriteArray(values); err != nil {
+			t.Fatal(err)
+		}
+		res, _, err := client.ReadValue()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+	waitForClients := func(t *testing.T, n int) {
+		for i := 0; i < 100; i++ {
+			if len(server.listClients()) == n {
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatalf("expected %d clients, got %d", n, len(server.listClients()))
+	}
+
+	t.Run("1. Refuse the connections above maxclients", func(t *testing.T) {
+		client1, conn1 := connect(t)
+		client2, _ := connect(t)
+		send(t, client1, "PING")
+		send(t, client2, "PING")
+
+		client3, _ := connect(t)
+		res, _, err := client3.ReadValue()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Error() == nil || res.Error().Error() != errMaxClients.Error() {
+			t.Errorf("expected %q, got %v", errMaxClients, res)
+		}
+
+		// A client can connect once another one disconnects.
+		_ = conn1.Close()
+		waitForClients(t, 1)
+		client4, _ := connect(t)
+		if res := send(t, client4, "PING"); res.String() != "PONG" {
+			t.Errorf("expected PONG, got %v", res)
+		}
+	})
+	waitForClients(t, 0)
+
+	t.Run("2. Refuse the connections above maxclients-per-ip", func(t *testing.T) {
+		setConfig(func(conf *config.Config) {
+			conf.MaxClients = 0
+			conf.MaxClientsPerIP = 1
+		})
+		t.Cleanup(func() {
+			setConfig(func(conf *config.Config) { conf.MaxClientsPerIP = 0 })
+		})
+
+		client1, _ := connect(t)
+		send(t, client1, "PING")
+		client2, _ := connect(t)
+		res, _, err := client2.ReadValue()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Error() == nil || res.Error().Error() != errMaxClientsPerIP.Error() {
+			t.Errorf("expected %q, got %v", errMaxClientsPerIP, res)
+		}
+	})
+	waitForClients(t, 0)
+
+	t.Run("3. Disconnect the idle clients that are not subscribed", func(t *testing.T) {
+		setConfig(func(conf *config.Config) { conf.Timeout = 200 * time.Millisecond })
+		t.Cleanup(func() {
+			setConfig(func(conf *config.Config) { conf.Timeout = 0 })
+		})
+
+		idle, _ := connect(t)
+		send(t, idle, "PING")
+		subscriber, _ := connect(t)
+		send(t, subscriber, "SUBSCRIBE", "channel")
+
+		time.Sleep(500 * time.Millisecond)
+		if _, _, err := idle.ReadValue(); err == nil {
+			t.Error("expected the idle client to be disconnected")
+		}
+		if res := send(t, subscriber, "PING"); res.Error() != nil {
+			t.Errorf("expected the subscribed client to stay connected, got %v", res)
+		}
+	})
+	waitForClients(t, 0)
+
+	t.Run("4. List the connected clients", func(t *testing.T) {
+		client1, conn1 := connect(t)
+		client2, conn2 := connect(t)
+		send(t, client1, "SELECT", "1")
+		send(t, client2, "PING")
+
+		res := send(t, client2, "CLIENT", "LIST")
+		lines := strings.Split(strings.TrimSpace(res.String()), "\n")
+		if len(lines) != 2 {
+			t.Fatalf("expected 2 clients, got %q", res.String())
+		}
+		want := map[string]map[string]string{
+			conn1.LocalAddr().String(): {"laddr": conn1.RemoteAddr().String(),
+				"db": "1", "sub": "0", "user": "default", "resp": "2", "cmd": "select"},
+			conn2.LocalAddr().String(): {"laddr": conn2.RemoteAddr().String(),
+				"db": "0", "sub": "0", "user": "default", "resp": "2", "cmd": "client|list"},
+		}
+		for _, line := range lines {
+			fields := make(map[string]string)
+			for _, field := range strings.Fields(line) {
+				key, value, _ := strings.Cut(field, "=")
+				fields[key] = value
+			}
+			wantFields, ok := want[fields["addr"]]
+			if !ok {
+				t.Errorf("unexpected client %q", line)
+				continue
+			}
+			for key, value := range wantFields {
+				if fields[key] != value {
+					t.Errorf("expected client %s to have %s=%s, got %q", fields["addr"], key, value, line)
+				}
+			}
+		}
+
+		clients, err := server.ClientList()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(clients) != 2 {
+			t.Fatalf("expected the embedded API to list the 2 clients, got %v", clients)
+		}
+		id1, _ := strconv.Atoi(clients[0]["id"])
+		id2, _ := strconv.Atoi(clients[1]["id"])
+		if id1 >= id2 {
+			t.Errorf("expected the clients to be sorted by id, got %v", clients)
+		}
+	})
+	waitForClients(t, 0)
+
+	t.Run("5. Report the clients in INFO", func(t *testing.T) {
+		client, _ := connect(t)
+		send(t, client, "PING")
+
+		info, err := server.Info("clients")
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := map[string]string{
+			"connected_clients":    "1",
+			"maxclients":           "0",
+			"maxclients_per_ip":    "0",
+			"rejected_connections": "2",
+			"quota_rejections":     "0",
+			"timeout":              "0",
+			"tcp_keepalive":        strconv.Itoa(int(conf.TCPKeepAlive.Seconds())),
+			"protected_mode":       "1",
+		}
+		for field, value := range want {
+			if info["clients"][field] != value {
+				t.Errorf("expected %s to be %s, got %q", field, value, info["clients"][field])
+			}
+		}
+	})
+
+	t.Run("6. Refuse the remote connections in protected mode", func(t *testing.T) {
+		local, remote := net.Pipe()
+		t.Cleanup(func() {
+			_ = local.Close()
+			_ = remote.Close()
+		})
+		var conn net.Conn = remoteConn{Conn: local, addr: &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 50000}}
+		var loopbackConn net.Conn = remoteConn{Conn: local, addr: &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 50000}}
+
+		if err := server.registerConnection(&conn, 1000); !errors.Is(err, errProtectedMode) {
+			t.Errorf("expected the remote connection to be refused, got %v", err)
+		}
+		if err := server.registerConnection(&loopbackConn, 1001); err != nil {
+			t.Errorf("expected the loopback connection to be accepted, got %v", err)
+		}
+		server.unregisterConnection(&loopbackConn)
+
+		setConfig(func(conf *config.Config) { conf.RequirePass = true })
+		if err := server.registerConnection(&conn, 1002); err != nil {
+			t.Errorf("expected the remote connection to be accepted with authentication, got %v", err)
+		}
+		server.unregisterConnection(&conn)
+
+		// An ACL user with a password counts as authentication, even though it's not required.
+		setConfig(func(conf *config.Config) { conf.RequirePass = false })
+		if err := server.acl.SetUser([]string{"protected_user", "on", ">password"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := server.registerConnection(&conn, 1004); err != nil {
+			t.Errorf("expected the remote connection to be accepted with an ACL user with a password, got %v", err)
+		}
+		server.unregisterConnection(&conn)
+		if err := server.acl.DeleteUser(context.Background(), []string{"protected_user"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := server.registerConnection(&conn, 1005); !errors.Is(err, errProtectedMode) {
+			t.Errorf("expected the remote connection to be refused once the user is deleted, got %v", err)
+		}
+
+		setConfig(func(conf *config.Config) { conf.ProtectedMode = false })
+		if err := server.registerConnection(&conn, 1003); err != nil {
+			t.Errorf("expected the remote connection to be accepted without protected mode, got %v", err)
+		}
+		server.unregisterConnection(&conn)
+	})
+
+	t.Run("7. Disconnect the clients of a deleted user", func(t *testing.T) {
+		for _, timeout := range []time.Duration{0, time.Minute} {
+			setConfig(func(conf *config.Config) {
+				conf.MaxClients = 0
+				conf.Timeout = timeout
+			})
+
+			admin, _ := connect(t)
+			if res := send(t, admin, "ACL", "SETUSER", "deleted_user", "on", ">password", "+@all", "~*"); res.String() != "OK" {
+				t.Fatalf("expected OK, got %v", res)
+			}
+			client, _ := connect(t)
+			if res := send(t, client, "AUTH", "deleted_user", "password"); res.String() != "OK" {
+				t.Fatalf("expected OK, got %v", res)
+			}
+
+			// The user deletes itself, so the connection is terminated while its command is running.
+			if res := send(t, client, "ACL", "DELUSER", "deleted_user"); res.String() != "OK" {
+				t.Fatalf("expected OK, got %v", res)
+			}
+			_ = client.WriteArray([]resp.Value{resp.StringValue("SET"), resp.StringValue("key"), resp.StringValue("value")})
+			if res, _, err := client.ReadValue(); err == nil {
+				t.Errorf("timeout %s: expected the connection of the deleted user to be closed, got %v", timeout, res)
+			}
+		}
+		setConfig(func(conf *config.Config) { conf.Timeout = 0 })
+	})
+}
@@ -17,8 +17,14 @@ package sugardb
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/echovault/sugardb/internal"
+	"github.com/echovault/sugardb/internal/constants"
+	"github.com/echovault/sugardb/internal/forward"
+	"github.com/echovault/sugardb/internal/raft"
+	"slices"
+	"strings"
 	"time"
 )
 
@@ -69,6 +75,15 @@ func (server *SugarDB) raftApplyCommand(ctx context.Context, cmd []string) ([]by
 	connectionId, _ := ctx.Value(internal.ContextConnID("ConnectionID")).(string)
 	protocol, _ := ctx.Value("Protocol").(int)
 	database, _ := ctx.Value("Database").(int)
+	shardOnly, _ := ctx.Value(internal.ContextShardOnly("ShardOnly")).(bool)
+
+	original := server.originalCommand(cmd)
+	clusterWide := !shardOnly && isClusterWideCommand(original)
+	if clusterWide && strings.EqualFold(original[0], "module") && strings.EqualFold(original[1], "load") && len(cmd) > 2 {
+		if err := server.checkClusterModule(ctx, cmd[2]); err != nil {
+			return nil, err
+		}
+	}
 
 	applyRequest := internal.ApplyRequest{
 		Type:         "command",
@@ -100,5 +115,230 @@ func (server *SugarDB) raftApplyCommand(ctx context.Context, cmd []string) ([]by
 		return nil, r.Error
 	}
 
+	if clusterWide {
+		if err = server.applyOnOtherShards(ctx, cmd); err != nil {
+			return nil, err
+		}
+	}
+
 	return r.Response, nil
 }
+
+// isClusterWideCommand reports whether the command changes the ACL users or the loaded modules.
+// These are applied on every shard of the cluster instead of the shard of the node only.
+func isClusterWideCommand(cmd []string) bool {
+	if len(cmd) < 2 {
+		return false
+	}
+	switch strings.ToLower(cmd[0]) {
+	case "acl":
+		return slices.Contains([]string{"setuser", "deluser", "load"}, strings.ToLower(cmd[1]))
+	case "module":
+		return slices.Contains([]string{"load", "unload"}, strings.ToLower(cmd[1]))
+	}
+	return false
+}
+
+// checkClusterModule checks that every other node of the cluster has the same module file as this node.
+// The module is not loaded anywhere when a node is missing it or has a different file.
+func (server *SugarDB) checkClusterModule(ctx context.Context, path string) error {
+	checksum, err := moduleChecksum(path)
+	if err != nil {
+		return err
+	}
+	var conflicts []string
+	for _, meta := range server.memberList.NodeMetas() {
+		if string(meta.ServerID) == server.config.ServerID || meta.ForwardAddr == "" {
+			continue
+		}
+		if err = server.forwardClient.CheckModule(ctx, meta.ForwardAddr, path, checksum); err != nil {
+			conflicts = append(conflicts, fmt.Sprintf("%s (%v)", meta.ServerID, err))
+		}
+	}
+	if len(conflicts) > 0 {
+		return fmt.Errorf("module %s conflicts on nodes %s", path, strings.Join(conflicts, ", "))
+	}
+	return nil
+}
+
+// applyOnOtherShards passes a cluster wide command applied on this shard to the leaders of the other shards.
+func (server *SugarDB) applyOnOtherShards(ctx context.Context, cmd []string) error {
+	serverId, _ := ctx.Value(internal.ContextServerID("ServerID")).(string)
+	protocol, _ := ctx.Value("Protocol").(int)
+	database, _ := ctx.Value("Database").(int)
+
+	var shards []string
+	for _, meta := range server.memberList.NodeMetas() {
+		if meta.ShardID != server.config.ShardID && !slices.Contains(shards, meta.ShardID) {
+			shards = append(shards, meta.ShardID)
+		}
+	}
+	slices.Sort(shards)
+
+	var errs []error
+	for _, shardId := range shards {
+		_, err := server.forwardClient.ForwardTo(ctx, func() (string, error) {
+			return server.shardLeaderForwardAddr(shardId)
+		}, forward.Request{
+			ServerID:     serverId,
+			ConnectionID: "nil",
+			Protocol:     protocol,
+			Database:     database,
+			CMD:          cmd,
+			ShardOnly:    true,
+			System:       true,
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("shard %s: %w", shardId, err))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("applied on shard %s but not on every shard: %w", server.config.ShardID, errors.Join(errs...))
+	}
+	return nil
+}
+
+// shardLeaderForwardAddr returns the address of the forwarding server of the leader of the shard.
+func (server *SugarDB) shardLeaderForwardAddr(shardId string) (string, error) {
+	for _, meta := range server.memberList.NodeMetas() {
+		if meta.ShardID == shardId && meta.Leader && meta.ForwardAddr != "" {
+			return meta.ForwardAddr, nil
+		}
+	}
+	return "", fmt.Errorf("%w: shard %s", forward.ErrNoLeader, shardId)
+}
+
+// forwardCommand sends the command to the cluster leader and waits for the leader to apply it.
+// It returns the leader's reply, or the error returned by the leader.
+func (server *SugarDB) forwardCommand(ctx context.Context, cmd []string) ([]byte, error) {
+	serverId, _ := ctx.Value(internal.ContextServerID("ServerID")).(string)
+	connectionId, _ := ctx.Value(internal.ContextConnID("ConnectionID")).(string)
+	protocol, _ := ctx.Value("Protocol").(int)
+	database, _ := ctx.Value("Database").(int)
+	username, _ := ctx.Value(internal.ContextUsername("Username")).(string)
+	rules, _ := ctx.Value(internal.ContextUserRules("UserRules")).([]string)
+	system, _ := ctx.Value(internal.ContextSystem("System")).(bool)
+	asking, _ := ctx.Value(internal.ContextAsking("Asking")).(bool)
+
+	return server.forwardClient.Forward(ctx, forward.Request{
+		ServerID:     serverId,
+		ConnectionID: connectionId,
+		Protocol:     protocol,
+		Database:     database,
+		CMD:          cmd,
+		Username:     username,
+		UserRules:    rules,
+		System:       system,
+		Asking:       asking,
+	})
+}
+
+// applyForwardedCommand applies a command forwarded by a follower. A command sent on behalf of a client goes
+// through the checks of handleCommand again on the leader: the permissions and quotas of the client's user,
+// and the routing of the keys. Only the commands that the nodes send on their own behalf may have no user.
+func (server *SugarDB) applyForwardedCommand(ctx context.Context, cmd []string) ([]byte, error) {
+	if !server.raft.IsRaftLeader() {
+		return nil, forward.ErrNotLeader
+	}
+
+	command, err := server.getCommand(cmd[0])
+	if err != nil {
+		return nil, err
+	}
+	sc, err := internal.GetSubCommand(command, cmd)
+	if err != nil {
+		return nil, err
+	}
+	subCommand, _ := sc.(internal.SubCommand)
+
+	if system, _ := ctx.Value(internal.ContextSystem("System")).(bool); !system {
+		username, _ := ctx.Value(internal.ContextUsername("Username")).(string)
+		rules, _ := ctx.Value(internal.ContextUserRules("UserRules")).([]string)
+		if username == "" {
+			return nil, errors.New("forwarded command has no user")
+		}
+		if err = server.acl.AuthorizeUser(ctx, username, rules, cmd, command, subCommand); err != nil {
+			return nil, err
+		}
+		if err = server.acl.CheckForwardedQuotas(ctx, username, rules, cmd, command, subCommand); err != nil {
+			return nil, err
+		}
+		asking, _ := ctx.Value(internal.ContextAsking("Asking")).(bool)
+		if strings.EqualFold(internal.OriginalCommand(command), "restore-asking") {
+			asking = true
+		}
+		if err = server.routeCommand(ctx, command, subCommand, cmd, asking); err != nil {
+			return nil, err
+		}
+	}
+
+	if err = server.checkWritesAllowed(command, subCommand); err != nil {
+		return nil, err
+	}
+
+	res, err := server.raftApplyCommand(ctx, cmd)
+	if raft.IsNotLeaderError(err) {
+		return nil, forward.ErrNotLeader
+	}
+	return res, err
+}
+
+// forwardLeaderAddr returns the address of the forwarding server of the current cluster leader.
+func (server *SugarDB) forwardLeaderAddr() (string, error) {
+	leaderId := server.raft.LeaderID()
+	if leaderId == "" {
+		return "", forward.ErrNoLeader
+	}
+	meta, ok := server.memberList.GetNodeMeta(leaderId)
+	if !ok || meta.ForwardAddr == "" {
+		return "", fmt.Errorf("%w: no forwarding address for leader %s", forward.ErrNoLeader, leaderId)
+	}
+	return meta.ForwardAddr, nil
+}
+
+// readIndex returns the read index of the leader for a follower's read. See raft.ReadIndex.
+func (server *SugarDB) readIndex(lease bool) (uint64, error) {
+	index, err := server.raft.ReadIndex(lease, server.config.ForwardTimeout)
+	if raft.IsNotLeaderError(err) {
+		return 0, forward.ErrNotLeader
+	}
+	return index, err
+}
+
+// waitForReadConsistency blocks until a read on this node satisfies the given read consistency.
+// Stale reads are served from the local state immediately. Lease and linearizable reads get the
+// read index from the leader and wait until this node has applied it.
+func (server *SugarDB) waitForReadConsistency(ctx context.Context, consistency string) error {
+	if consistency == "" || consistency == constants.ReadConsistencyStale {
+		return nil
+	}
+	lease := consistency == constants.ReadConsistencyLease
+
+	ctx, cancel := context.WithTimeout(ctx, server.config.ForwardTimeout)
+	defer cancel()
+
+	var index uint64
+	var err error = forward.ErrNotLeader
+	if server.raft.IsRaftLeader() {
+		index, err = server.readIndex(lease)
+	}
+	if errors.Is(err, forward.ErrNotLeader) {
+		index, err = server.forwardClient.ReadIndex(ctx, lease)
+	}
+	if err != nil {
+		return fmt.Errorf("could not serve %s read: %w", consistency, err)
+	}
+
+	if err = server.raft.WaitForIndex(ctx, index); err != nil {
+		return fmt.Errorf("could not serve %s read: timed out waiting for index %d: %w", consistency, index, err)
+	}
+	return nil
+}
+
+func isReadConsistency(consistency string) bool {
+	return slices.Contains([]string{
+		constants.ReadConsistencyStale,
+		constants.ReadConsistencyLease,
+		constants.ReadConsistencyLinearizable,
+	}, consistency)
+}
@@ -0,0 +1,152 @@
+// Copyright 2024 Kelvin Clement Mwinuka
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sugardb
+
+import (
+	"fmt"
+	"github.com/echovault/sugardb/internal"
+	"slices"
+	"strings"
+)
+
+// configureCommand renames the command and its subcommands, and removes its disabled subcommands, as configured by
+// RenameCommands and DisableCommands. It returns false when the command is disabled.
+//
+// The command table holds the new names, so the clients, the ACL, COMMAND and the AOF only see the new names.
+// The handlers and key extraction functions of the renamed commands receive the command with its original names.
+func (server *SugarDB) configureCommand(command internal.Command) (internal.Command, bool) {
+	original := command.Command
+	if server.commandDisabled(original) {
+		return internal.Command{}, false
+	}
+
+	name, renamed := server.renamedCommand(original)
+	if renamed {
+		command.Command = name
+		command.OriginalCommand = original
+		command.KeyExtractionFunc, command.HandlerFunc = withOriginalNames(
+			command.KeyExtractionFunc, command.HandlerFunc, original)
+	}
+
+	if len(command.SubCommands) == 0 {
+		return command, true
+	}
+	subCommands := make([]internal.SubCommand, 0, len(command.SubCommands))
+	for _, subCommand := range command.SubCommands {
+		path := fmt.Sprintf("%s|%s", original, subCommand.Command)
+		if server.commandDisabled(path) {
+			continue
+		}
+		subName, subRenamed := server.renamedCommand(path)
+		if renamed || subRenamed {
+			subCommand.KeyExtractionFunc, subCommand.HandlerFunc = withOriginalNames(
+				subCommand.KeyExtractionFunc, subCommand.HandlerFunc, original, subCommand.Command)
+		}
+		if subRenamed {
+			subCommand.Command = subName
+		}
+		subCommands = append(subCommands, subCommand)
+	}
+	command.SubCommands = subCommands
+
+	return command, true
+}
+
+// withOriginalNames wraps the functions of a renamed command so that they receive the command with its original
+// names, as the handlers that serve several commands rely on them.
+func withOriginalNames(
+	keyExtractionFunc internal.KeyExtractionFunc,
+	handlerFunc internal.HandlerFunc,
+	names ...string,
+) (internal.KeyExtractionFunc, internal.HandlerFunc) {
+	originalCommand := func(cmd []string) []string {
+		res := slices.Clone(cmd)
+		for i := 0; i < len(names) && i < len(res); i++ {
+			res[i] = names[i]
+		}
+		return res
+	}
+	if keyExtractionFunc != nil {
+		f := keyExtractionFunc
+		keyExtractionFunc = func(cmd []string) (internal.KeyExtractionFuncResult, error) {
+			return f(originalCommand(cmd))
+		}
+	}
+	if handlerFunc != nil {
+		f := handlerFunc
+		handlerFunc = func(params internal.HandlerFuncParams) ([]byte, error) {
+			params.Command = originalCommand(params.Command)
+			return f(params)
+		}
+	}
+	return keyExtractionFunc, handlerFunc
+}
+
+// renamedCommand returns the new name of the command or subcommand, e.g. "module|load", if it's renamed.
+func (server *SugarDB) renamedCommand(command string) (string, bool) {
+	for c, name := range server.config.RenameCommands {
+		if strings.EqualFold(c, command) {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// commandDisabled returns true when the command or subcommand, e.g. "module|load", is disabled.
+func (server *SugarDB) commandDisabled(command string) bool {
+	return slices.ContainsFunc(server.config.DisableCommands, func(c string) bool {
+		return strings.EqualFold(c, command)
+	})
+}
+
+// commandName replaces the original names of a renamed command and subcommand with their new names.
+// The embedded API and the commands run by the server itself use the original names.
+func (server *SugarDB) commandName(cmd []string) []string {
+	if len(server.config.RenameCommands) == 0 || len(cmd) == 0 {
+		return cmd
+	}
+	res := slices.Clone(cmd)
+	if name, ok := server.renamedCommand(cmd[0]); ok {
+		res[0] = name
+	}
+	if len(cmd) > 1 {
+		if name, ok := server.renamedCommand(fmt.Sprintf("%s|%s", cmd[0], cmd[1])); ok {
+			res[1] = name
+		}
+	}
+	return res
+}
+
+// originalCommand replaces the new names of a renamed command and subcommand with their original names.
+func (server *SugarDB) originalCommand(cmd []string) []string {
+	if len(server.config.RenameCommands) == 0 || len(cmd) == 0 {
+		return cmd
+	}
+	res := slices.Clone(cmd)
+	for c, name := range server.config.RenameCommands {
+		if !strings.Contains(c, "|") && strings.EqualFold(name, cmd[0]) {
+			res[0] = c
+		}
+	}
+	if len(res) > 1 {
+		for c, name := range server.config.RenameCommands {
+			command, subCommand, ok := strings.Cut(c, "|")
+			if ok && strings.EqualFold(command, res[0]) && strings.EqualFold(name, cmd[1]) {
+				res[1] = subCommand
+			}
+		}
+	}
+	return res
+}
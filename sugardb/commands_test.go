@@ -0,0 +1,222 @@
+// Copyright 2024 Kelvin Clement Mwinuka
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sugardb
+
+import (
+	"github.com/echovault/sugardb/internal"
+	"github.com/echovault/sugardb/internal/constants"
+	"github.com/tidwall/resp"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func Test_RenameDisableCommands(t *testing.T) {
+	port, err := internal.GetFreePort()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conf := DefaultConfig()
+	conf.DataDir = ""
+	conf.BindAddr = "localhost"
+	conf.Port = uint16(port)
+	conf.EvictionPolicy = constants.NoEviction
+	conf.RenameCommands = map[string]string{
+		"flushall":   "secret-flushall",
+		"acl|whoami": "me",
+		"acl|users":  "list-users",
+	}
+	conf.DisableCommands = []string{"keys", "module|load", "custom"}
+
+	server, err := NewSugarDB(WithConfig(conf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Start()
+	t.Cleanup(server.ShutDown)
+
+	conn, err := internal.GetConnection("localhost", port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = conn.Close()
+	})
+	client := resp.NewConn(conn)
+	send := func(cmd ...string) resp.Value {
+		values := make([]resp.Value, len(cmd))
+		for i, c := range cmd {
+			values[i] = resp.StringValue(c)
+		}
+		if err := client.WriteArray(values); err != nil {
+			t.Fatal(err)
+		}
+		res, _, err := client.ReadValue()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+
+	t.Run("1. Run the renamed commands by their new names only", func(t *testing.T) {
+		send("SELECT", "1")
+		send("SET", "key", "value")
+		send("SELECT", "0")
+		send("SET", "key", "value")
+
+		if res := send("FLUSHALL"); res.Error() == nil || !strings.Contains(res.Error().Error(), "not supported") {
+			t.Errorf("expected FLUSHALL to be not supported, got %v", res)
+		}
+		if res := send("SECRET-FLUSHALL"); res.String() != "OK" {
+			t.Fatalf("expected OK, got %v", res)
+		}
+		// The handler runs FLUSHALL, which is served by the same handler as FLUSHDB, so every database is flushed.
+		send("SELECT", "1")
+		if res := send("EXISTS", "key"); res.Integer() != 0 {
+			t.Errorf("expected the key of database 1 to be flushed, got %v", res)
+		}
+		send("SELECT", "0")
+
+		if res := send("ACL", "ME"); res.String() != "default" {
+			t.Errorf("expected the renamed subcommand to return default, got %v", res)
+		}
+		if res := send("ACL", "WHOAMI"); res.Error() == nil {
+			t.Errorf("expected ACL WHOAMI to be not supported, got %v", res)
+		}
+	})
+
+	t.Run("2. Reject the disabled commands and subcommands", func(t *testing.T) {
+		if res := send("KEYS", "*"); res.Error() == nil || !strings.Contains(res.Error().Error(), "not supported") {
+			t.Errorf("expected KEYS to be not supported, got %v", res)
+		}
+		if res := send("MODULE", "LOAD", "module.so"); res.Error() == nil || !strings.Contains(res.Error().Error(), "not supported") {
+			t.Errorf("expected MODULE LOAD to be not supported, got %v", res)
+		}
+		err := server.AddCommand(CommandOptions{Command: "custom"})
+		if err == nil || err.Error() != "command custom is disabled" {
+			t.Errorf("expected the disabled command not to be added, got %v", err)
+		}
+	})
+
+	t.Run("3. List the commands by their new names", func(t *testing.T) {
+		var commands []string
+		for _, v := range send("COMMAND", "LIST").Array() {
+			commands = append(commands, v.String())
+		}
+		for _, command := range []string{"secret-flushall", "acl me", "module unload"} {
+			if !slices.Contains(commands, command) {
+				t.Errorf("expected COMMAND LIST to contain %s", command)
+			}
+		}
+		for _, command := range []string{"flushall", "acl whoami", "keys", "module load"} {
+			if slices.Contains(commands, command) {
+				t.Errorf("expected COMMAND LIST not to contain %s", command)
+			}
+		}
+
+		dangerous, err := server.ACLCat(constants.DangerousCategory)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Contains(dangerous, "secret-flushall") || slices.Contains(dangerous, "flushall") ||
+			slices.Contains(dangerous, "keys") {
+			t.Errorf("expected ACL CAT to list the renamed commands and not the disabled ones, got %v", dangerous)
+		}
+	})
+
+	t.Run("4. Run the renamed commands by their original names in the embedded API", func(t *testing.T) {
+		if _, _, err := server.Set("key", "value", SETOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := server.ExecuteCommand("FLUSHALL"); err != nil {
+			t.Fatal(err)
+		}
+		if value, err := server.Get("key"); err != nil || value != "" {
+			t.Errorf("expected the key to be flushed, got %q, %v", value, err)
+		}
+		if users, err := server.ACLUsers(); err != nil || !slices.Equal(users, []string{"default"}) {
+			t.Errorf("expected the renamed subcommand to return the users, got %v, %v", users, err)
+		}
+	})
+
+	t.Run("5. Reject a command renamed to the name of another command", func(t *testing.T) {
+		conf := DefaultConfig()
+		conf.DataDir = ""
+		conf.RenameCommands = map[string]string{"get": "set"}
+		_, err := NewSugarDB(WithConfig(conf))
+		if err == nil || err.Error() != "rename command: command set already exists" {
+			t.Errorf("expected the duplicate name to be rejected, got %v", err)
+		}
+	})
+
+	t.Run("6. Authenticate with a renamed AUTH", func(t *testing.T) {
+		port, err := internal.GetFreePort()
+		if err != nil {
+			t.Fatal(err)
+		}
+		conf := DefaultConfig()
+		conf.DataDir = ""
+		conf.BindAddr = "localhost"
+		conf.Port = uint16(port)
+		conf.EvictionPolicy = constants.NoEviction
+		conf.RequirePass = true
+		conf.Password = "password"
+		conf.RenameCommands = map[string]string{"auth": "myauth", "ping": "myping"}
+
+		server, err := NewSugarDB(WithConfig(conf))
+		if err != nil {
+			t.Fatal(err)
+		}
+		go server.Start()
+		t.Cleanup(server.ShutDown)
+
+		conn, err := internal.GetConnection("localhost", port)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			_ = conn.Close()
+		})
+		client := resp.NewConn(conn)
+		send := func(cmd ...string) resp.Value {
+			values := make([]resp.Value, len(cmd))
+			for i, c := range cmd {
+				values[i] = resp.StringValue(c)
+			}
+			if err := client.WriteArray(values); err != nil {
+				t.Fatal(err)
+			}
+			res, _, err := client.ReadValue()
+			if err != nil {
+				t.Fatal(err)
+			}
+			return res
+		}
+
+		if res := send("MYPING"); res.String() != "PONG" {
+			t.Errorf("expected the renamed PING to be allowed before authentication, got %v", res)
+		}
+		if res := send("GET", "key"); res.Error() == nil {
+			t.Errorf("expected GET to require authentication, got %v", res)
+		}
+		if res := send("MYAUTH", "password"); res.String() != "OK" {
+			t.Fatalf("expected the renamed AUTH to authenticate the connection, got %v", res)
+		}
+		if res := send("SET", "key", "value"); res.String() != "OK" {
+			t.Errorf("expected SET to be allowed after authentication, got %v", res)
+		}
+	})
+}
@@ -18,6 +18,7 @@ import (
 	"github.com/echovault/sugardb/internal"
 	"github.com/echovault/sugardb/internal/config"
 	"github.com/echovault/sugardb/internal/constants"
+	"strings"
 	"time"
 )
 
@@ -28,7 +29,7 @@ func DefaultConfig() config.Config {
 }
 
 func (server *SugarDB) GetServerInfo() internal.ServerInfo {
-	return internal.ServerInfo{
+	info := internal.ServerInfo{
 		Server:  "sugardb",
 		Version: constants.Version,
 		Id:      server.config.ServerID,
@@ -49,8 +50,27 @@ func (server *SugarDB) GetServerInfo() internal.ServerInfo {
 		}(),
 		Modules:    server.ListModules(),
 		MemoryUsed: server.memUsed,
-		MaxMemory:  server.config.MaxMemory,
+		MaxMemory:  server.liveConfig().MaxMemory,
+		Clients:    server.getClientsInfo(),
+		Persistence: internal.PersistenceInfo{
+			SnapshotInProgress:         server.snapshotInProgress.Load(),
+			AOFRewriteInProgress:       server.rewriteAOFInProgress.Load(),
+			LatestSnapshotMilliseconds: server.getLatestSnapshotTime(),
+			StateCaptures:              server.stateCapture.count.Load(),
+			LatestCapturePause:         time.Duration(server.stateCapture.lastPause.Load()),
+			LatestCaptureCopy:          time.Duration(server.stateCapture.lastCopy.Load()),
+		},
 	}
+	if !server.isInCluster() {
+		status := server.snapshotEngine.Status()
+		info.Persistence.ChangesSinceLastSave = status.ChangesSinceLastSave
+		info.Persistence.Saves = status.Saves
+		info.Persistence.LastSaveDuration = status.LastSaveDuration
+		if status.LastSaveError != nil {
+			info.Persistence.LastSaveError = status.LastSaveError.Error()
+		}
+	}
+	return info
 }
 
 // WithTLS is an option to the NewSugarDB function that allows you to pass a
@@ -163,6 +183,57 @@ func WithBootstrapCluster(b ...bool) func(sugardb *SugarDB) {
 	}
 }
 
+// WithReplica is an option to the NewSugarDB function that allows you to pass a
+// custom Replica to SugarDB. A replica joins the raft group of its shard as a non-voter,
+// so it serves reads without slowing down writes or counting towards the quorum. It rejects write commands.
+// If not specified, SugarDB will use the default configuration from config.DefaultConfig().
+func WithReplica(b ...bool) func(sugardb *SugarDB) {
+	return func(sugardb *SugarDB) {
+		if len(b) > 0 {
+			sugardb.config.Replica = b[0]
+		} else {
+			sugardb.config.Replica = true
+		}
+	}
+}
+
+// WithReplicaOf is an option to the NewSugarDB function that allows you to pass a
+// custom ReplicaOf to SugarDB. The address is the <host>:<port> of a standalone primary that the
+// instance replicates asynchronously. It rejects write commands while it's a replica.
+// If not specified, SugarDB will use the default configuration from config.DefaultConfig().
+func WithReplicaOf(addr string) func(sugardb *SugarDB) {
+	return func(sugardb *SugarDB) {
+		sugardb.config.ReplicaOf = addr
+	}
+}
+
+// WithMasterUser is an option to the NewSugarDB function that allows you to pass a
+// custom MasterUser to SugarDB. It's the username used to authenticate with the primary.
+// If not specified, SugarDB will use the default configuration from config.DefaultConfig().
+func WithMasterUser(user string) func(sugardb *SugarDB) {
+	return func(sugardb *SugarDB) {
+		sugardb.config.MasterUser = user
+	}
+}
+
+// WithMasterAuth is an option to the NewSugarDB function that allows you to pass a
+// custom MasterAuth to SugarDB. It's the password used to authenticate with the primary.
+// If not specified, SugarDB will use the default configuration from config.DefaultConfig().
+func WithMasterAuth(password string) func(sugardb *SugarDB) {
+	return func(sugardb *SugarDB) {
+		sugardb.config.MasterAuth = password
+	}
+}
+
+// WithReplBacklogSize is an option to the NewSugarDB function that allows you to pass a
+// custom ReplBacklogSize to SugarDB.
+// If not specified, SugarDB will use the default configuration from config.DefaultConfig().
+func WithReplBacklogSize(size uint64) func(sugardb *SugarDB) {
+	return func(sugardb *SugarDB) {
+		sugardb.config.ReplBacklogSize = size
+	}
+}
+
 // WithAclConfig is an option to the NewSugarDB function that allows you to pass a
 // custom AclConfig to SugarDB.
 // If not specified, SugarDB will use the default configuration from config.DefaultConfig().
@@ -172,6 +243,154 @@ func WithAclConfig(aclConfig string) func(sugardb *SugarDB) {
 	}
 }
 
+// WithAclLogMaxLen is an option to the NewSugarDB function that allows you to pass a
+// custom AclLogMaxLen to SugarDB.
+// If not specified, SugarDB will use the default configuration from config.DefaultConfig().
+func WithAclLogMaxLen(maxLen uint) func(sugardb *SugarDB) {
+	return func(sugardb *SugarDB) {
+		sugardb.config.AclLogMaxLen = maxLen
+	}
+}
+
+// WithAclPasswordHash is an option to the NewSugarDB function that allows you to pass a
+// custom AclPasswordHash to SugarDB.
+// If not specified, SugarDB will use the default configuration from config.DefaultConfig().
+func WithAclPasswordHash(algorithm string) func(sugardb *SugarDB) {
+	return func(sugardb *SugarDB) {
+		sugardb.config.AclPasswordHash = algorithm
+	}
+}
+
+// WithAclBcryptCost is an option to the NewSugarDB function that allows you to pass a
+// custom AclBcryptCost to SugarDB.
+// If not specified, SugarDB will use the default configuration from config.DefaultConfig().
+func WithAclBcryptCost(cost int) func(sugardb *SugarDB) {
+	return func(sugardb *SugarDB) {
+		sugardb.config.AclBcryptCost = cost
+	}
+}
+
+// WithAclArgon2Time is an option to the NewSugarDB function that allows you to pass a
+// custom AclArgon2Time to SugarDB.
+// If not specified, SugarDB will use the default configuration from config.DefaultConfig().
+func WithAclArgon2Time(passes uint32) func(sugardb *SugarDB) {
+	return func(sugardb *SugarDB) {
+		sugardb.config.AclArgon2Time = passes
+	}
+}
+
+// WithAclArgon2Memory is an option to the NewSugarDB function that allows you to pass a
+// custom AclArgon2Memory to SugarDB.
+// If not specified, SugarDB will use the default configuration from config.DefaultConfig().
+func WithAclArgon2Memory(memory uint32) func(sugardb *SugarDB) {
+	return func(sugardb *SugarDB) {
+		sugardb.config.AclArgon2Memory = memory
+	}
+}
+
+// WithAclArgon2Threads is an option to the NewSugarDB function that allows you to pass a
+// custom AclArgon2Threads to SugarDB.
+// If not specified, SugarDB will use the default configuration from config.DefaultConfig().
+func WithAclArgon2Threads(threads uint8) func(sugardb *SugarDB) {
+	return func(sugardb *SugarDB) {
+		sugardb.config.AclArgon2Threads = threads
+	}
+}
+
+// WithAclCertUserField is an option to the NewSugarDB function that allows you to pass a
+// custom AclCertUserField to SugarDB.
+// If not specified, SugarDB will use the default configuration from config.DefaultConfig().
+func WithAclCertUserField(field string) func(sugardb *SugarDB) {
+	return func(sugardb *SugarDB) {
+		sugardb.config.AclCertUserField = field
+	}
+}
+
+// WithAclCertUserOID is an option to the NewSugarDB function that allows you to pass a
+// custom AclCertUserOID to SugarDB.
+// If not specified, SugarDB will use the default configuration from config.DefaultConfig().
+func WithAclCertUserOID(oid string) func(sugardb *SugarDB) {
+	return func(sugardb *SugarDB) {
+		sugardb.config.AclCertUserOID = oid
+	}
+}
+
+// WithAclCertNoPassword is an option to the NewSugarDB function that allows you to pass a
+// custom AclCertNoPassword to SugarDB.
+// If not specified, SugarDB will use the default configuration from config.DefaultConfig().
+func WithAclCertNoPassword(b ...bool) func(sugardb *SugarDB) {
+	return func(sugardb *SugarDB) {
+		if len(b) > 0 {
+			sugardb.config.AclCertNoPassword = b[0]
+		} else {
+			sugardb.config.AclCertNoPassword = true
+		}
+	}
+}
+
+// WithAclJWTKeyFiles is an option to the NewSugarDB function that allows you to pass a
+// custom AclJWTKeyFiles to SugarDB.
+// If not specified, SugarDB will use the default configuration from config.DefaultConfig().
+func WithAclJWTKeyFiles(keyFiles []string) func(sugardb *SugarDB) {
+	return func(sugardb *SugarDB) {
+		sugardb.config.AclJWTKeyFiles = keyFiles
+	}
+}
+
+// WithAclJWKSFile is an option to the NewSugarDB function that allows you to pass a
+// custom AclJWKSFile to SugarDB.
+// If not specified, SugarDB will use the default configuration from config.DefaultConfig().
+func WithAclJWKSFile(jwksFile string) func(sugardb *SugarDB) {
+	return func(sugardb *SugarDB) {
+		sugardb.config.AclJWKSFile = jwksFile
+	}
+}
+
+// WithAclJWTUsernameClaim is an option to the NewSugarDB function that allows you to pass a
+// custom AclJWTUsernameClaim to SugarDB.
+// If not specified, SugarDB will use the default configuration from config.DefaultConfig().
+func WithAclJWTUsernameClaim(claim string) func(sugardb *SugarDB) {
+	return func(sugardb *SugarDB) {
+		sugardb.config.AclJWTUsernameClaim = claim
+	}
+}
+
+// WithAclJWTPermissionsClaim is an option to the NewSugarDB function that allows you to pass a
+// custom AclJWTPermissionsClaim to SugarDB.
+// If not specified, SugarDB will use the default configuration from config.DefaultConfig().
+func WithAclJWTPermissionsClaim(claim string) func(sugardb *SugarDB) {
+	return func(sugardb *SugarDB) {
+		sugardb.config.AclJWTPermissionsClaim = claim
+	}
+}
+
+// WithAclJWTIssuer is an option to the NewSugarDB function that allows you to pass a
+// custom AclJWTIssuer to SugarDB.
+// If not specified, SugarDB will use the default configuration from config.DefaultConfig().
+func WithAclJWTIssuer(issuer string) func(sugardb *SugarDB) {
+	return func(sugardb *SugarDB) {
+		sugardb.config.AclJWTIssuer = issuer
+	}
+}
+
+// WithAclJWTAudience is an option to the NewSugarDB function that allows you to pass a
+// custom AclJWTAudience to SugarDB.
+// If not specified, SugarDB will use the default configuration from config.DefaultConfig().
+func WithAclJWTAudience(audience string) func(sugardb *SugarDB) {
+	return func(sugardb *SugarDB) {
+		sugardb.config.AclJWTAudience = audience
+	}
+}
+
+// WithAclJWTExpiryAction is an option to the NewSugarDB function that allows you to pass a
+// custom AclJWTExpiryAction to SugarDB.
+// If not specified, SugarDB will use the default configuration from config.DefaultConfig().
+func WithAclJWTExpiryAction(action string) func(sugardb *SugarDB) {
+	return func(sugardb *SugarDB) {
+		sugardb.config.AclJWTExpiryAction = action
+	}
+}
+
 // WithForwardCommand is an option to the NewSugarDB function that allows you to pass a
 // custom ForwardCommand to SugarDB.
 // If not specified, SugarDB will use the default configuration from config.DefaultConfig().
@@ -185,6 +404,62 @@ func WithForwardCommand(b ...bool) func(sugardb *SugarDB) {
 	}
 }
 
+// WithForwardPort is an option to the NewSugarDB function that allows you to pass a
+// custom ForwardPort to SugarDB.
+// If not specified, SugarDB will use the default configuration from config.DefaultConfig().
+func WithForwardPort(forwardPort uint16) func(sugardb *SugarDB) {
+	return func(sugardb *SugarDB) {
+		sugardb.config.ForwardPort = forwardPort
+	}
+}
+
+// WithReadConsistency is an option to the NewSugarDB function that allows you to pass a
+// custom ReadConsistency to SugarDB. It's the default read consistency of the TCP connections and embedded API calls.
+// If not specified, SugarDB will use the default configuration from config.DefaultConfig().
+func WithReadConsistency(readConsistency string) func(sugardb *SugarDB) {
+	return func(sugardb *SugarDB) {
+		sugardb.config.ReadConsistency = strings.ToLower(readConsistency)
+	}
+}
+
+// WithShardID is an option to the NewSugarDB function that allows you to pass a
+// custom ShardID to SugarDB. Nodes only join the raft group of the nodes with the same shard id.
+// If not specified, SugarDB will use the default configuration from config.DefaultConfig().
+func WithShardID(shardID string) func(sugardb *SugarDB) {
+	return func(sugardb *SugarDB) {
+		sugardb.config.ShardID = shardID
+	}
+}
+
+// WithShardSlots is an option to the NewSugarDB function that allows you to pass custom
+// ShardSlots to SugarDB, e.g. "0-8191". The slots are claimed by the node that bootstraps the shard.
+// If not specified, SugarDB will use the default configuration from config.DefaultConfig().
+func WithShardSlots(shardSlots string) func(sugardb *SugarDB) {
+	return func(sugardb *SugarDB) {
+		sugardb.config.ShardSlots = shardSlots
+	}
+}
+
+// WithForwardTimeout is an option to the NewSugarDB function that allows you to pass a
+// custom ForwardTimeout to SugarDB.
+// If not specified, SugarDB will use the default configuration from config.DefaultConfig().
+func WithForwardTimeout(forwardTimeout time.Duration) func(sugardb *SugarDB) {
+	return func(sugardb *SugarDB) {
+		sugardb.config.ForwardTimeout = forwardTimeout
+	}
+}
+
+// WithFailureGracePeriod is an option to the NewSugarDB function that allows you to pass a
+// custom FailureGracePeriod to SugarDB. A member of the shard that stops responding is only removed from
+// the raft configuration if it doesn't come back within this period. Failed members are never removed
+// automatically when it's 0.
+// If not specified, SugarDB will use the default configuration from config.DefaultConfig().
+func WithFailureGracePeriod(period time.Duration) func(sugardb *SugarDB) {
+	return func(sugardb *SugarDB) {
+		sugardb.config.FailureGracePeriod = period
+	}
+}
+
 // WithRequirePass is an option to the NewSugarDB function that allows you to pass a
 // custom RequirePass to SugarDB.
 // If not specified, SugarDB will use the default configuration from config.DefaultConfig().
@@ -225,6 +500,80 @@ func WithSnapshotInterval(snapshotInterval time.Duration) func(sugardb *SugarDB)
 	}
 }
 
+// SaveRule triggers a snapshot when at least Changes writes have been made
+// and Seconds seconds have passed since the last snapshot.
+type SaveRule = config.SaveRule
+
+// WithSaveRules is an option to the NewSugarDB function that allows you to pass
+// custom SaveRules to SugarDB. A snapshot is taken when any of the rules match.
+// If not specified, SugarDB will use the SnapshotInterval and SnapShotThreshold as the only rule.
+func WithSaveRules(rules ...SaveRule) func(sugardb *SugarDB) {
+	return func(sugardb *SugarDB) {
+		sugardb.config.SaveRules = rules
+	}
+}
+
+// WithSnapshotRetainLast is an option to the NewSugarDB function that allows you to pass a
+// custom SnapshotRetainLast to SugarDB.
+// If not specified, SugarDB will use the default configuration from config.DefaultConfig().
+func WithSnapshotRetainLast(n uint) func(sugardb *SugarDB) {
+	return func(sugardb *SugarDB) {
+		sugardb.config.SnapshotRetainLast = n
+	}
+}
+
+// WithSnapshotRetainHourly is an option to the NewSugarDB function that allows you to pass a
+// custom SnapshotRetainHourly to SugarDB.
+// If not specified, SugarDB will use the default configuration from config.DefaultConfig().
+func WithSnapshotRetainHourly(n uint) func(sugardb *SugarDB) {
+	return func(sugardb *SugarDB) {
+		sugardb.config.SnapshotRetainHourly = n
+	}
+}
+
+// WithSnapshotRetainDaily is an option to the NewSugarDB function that allows you to pass a
+// custom SnapshotRetainDaily to SugarDB.
+// If not specified, SugarDB will use the default configuration from config.DefaultConfig().
+func WithSnapshotRetainDaily(n uint) func(sugardb *SugarDB) {
+	return func(sugardb *SugarDB) {
+		sugardb.config.SnapshotRetainDaily = n
+	}
+}
+
+// WithStopWritesOnBGSaveError is an option to the NewSugarDB function that allows you to pass a
+// custom StopWritesOnBGSaveError to SugarDB.
+// If not specified, SugarDB will use the default configuration from config.DefaultConfig().
+func WithStopWritesOnBGSaveError(b ...bool) func(sugardb *SugarDB) {
+	return func(sugardb *SugarDB) {
+		if len(b) > 0 {
+			sugardb.config.StopWritesOnBGSaveError = b[0]
+		} else {
+			sugardb.config.StopWritesOnBGSaveError = true
+		}
+	}
+}
+
+// WithEncryptionKeyFile is an option to the NewSugarDB function that allows you to pass a
+// custom EncryptionKeyFile to SugarDB.
+// The file contains hex or base64 encoded AES keys, one per line. The first key encrypts new
+// persistence files, the other keys are only used to read files encrypted with previous keys.
+// If not specified, SugarDB will use the default configuration from config.DefaultConfig().
+func WithEncryptionKeyFile(encryptionKeyFile string) func(sugardb *SugarDB) {
+	return func(sugardb *SugarDB) {
+		sugardb.config.EncryptionKeyFile = encryptionKeyFile
+	}
+}
+
+// WithEncryptionKeyEnv is an option to the NewSugarDB function that allows you to pass a
+// custom EncryptionKeyEnv to SugarDB.
+// This is the name of the environment variable that holds comma separated, hex or base64 encoded AES keys.
+// If not specified, SugarDB will use the default configuration from config.DefaultConfig().
+func WithEncryptionKeyEnv(encryptionKeyEnv string) func(sugardb *SugarDB) {
+	return func(sugardb *SugarDB) {
+		sugardb.config.EncryptionKeyEnv = encryptionKeyEnv
+	}
+}
+
 // WithRestoreSnapshot is an option to the NewSugarDB function that allows you to pass a
 // custom RestoreSnapshot to SugarDB.
 // If not specified, SugarDB will use the default configuration from config.DefaultConfig().
@@ -331,3 +680,167 @@ func WithRaftBindPort(raftBindPort uint16) func(sugardb *SugarDB) {
 		sugardb.config.RaftBindPort = raftBindPort
 	}
 }
+
+// WithConfigFile is an option to the NewSugarDB function that allows you to pass a
+// custom ConfigFile to SugarDB. The file is reloaded by ReloadConfig and when it changes.
+// If not specified, SugarDB will use the default configuration from config.DefaultConfig().
+func WithConfigFile(configFile string) func(sugardb *SugarDB) {
+	return func(sugardb *SugarDB) {
+		sugardb.config.ConfigFile = configFile
+	}
+}
+
+// WithConfigReloadInterval is an option to the NewSugarDB function that allows you to pass a
+// custom ConfigReloadInterval to SugarDB.
+// If not specified, SugarDB will use the default configuration from config.DefaultConfig().
+func WithConfigReloadInterval(configReloadInterval time.Duration) func(sugardb *SugarDB) {
+	return func(sugardb *SugarDB) {
+		sugardb.config.ConfigReloadInterval = configReloadInterval
+	}
+}
+
+// WithAuditLog is an option to the NewSugarDB function that allows you to pass a
+// custom AuditLog to SugarDB. The audit log is disabled when it's empty.
+// If not specified, SugarDB will use the default configuration from config.DefaultConfig().
+func WithAuditLog(auditLog string) func(sugardb *SugarDB) {
+	return func(sugardb *SugarDB) {
+		sugardb.config.AuditLog = auditLog
+	}
+}
+
+// WithAuditLogCategories is an option to the NewSugarDB function that allows you to pass a
+// custom AuditLogCategories to SugarDB.
+// If not specified, SugarDB will use the default configuration from config.DefaultConfig().
+func WithAuditLogCategories(categories []string) func(sugardb *SugarDB) {
+	return func(sugardb *SugarDB) {
+		sugardb.config.AuditLogCategories = categories
+	}
+}
+
+// WithAuditLogCommands is an option to the NewSugarDB function that allows you to pass a
+// custom AuditLogCommands to SugarDB.
+// If not specified, SugarDB will use the default configuration from config.DefaultConfig().
+func WithAuditLogCommands(commands []string) func(sugardb *SugarDB) {
+	return func(sugardb *SugarDB) {
+		sugardb.config.AuditLogCommands = commands
+	}
+}
+
+// WithAuditLogExcludeCommands is an option to the NewSugarDB function that allows you to pass a
+// custom AuditLogExcludeCommands to SugarDB.
+// If not specified, SugarDB will use the default configuration from config.DefaultConfig().
+func WithAuditLogExcludeCommands(commands []string) func(sugardb *SugarDB) {
+	return func(sugardb *SugarDB) {
+		sugardb.config.AuditLogExcludeCommands = commands
+	}
+}
+
+// WithAuditLogMaxSize is an option to the NewSugarDB function that allows you to pass a
+// custom AuditLogMaxSize to SugarDB.
+// If not specified, SugarDB will use the default configuration from config.DefaultConfig().
+func WithAuditLogMaxSize(maxSize uint64) func(sugardb *SugarDB) {
+	return func(sugardb *SugarDB) {
+		sugardb.config.AuditLogMaxSize = maxSize
+	}
+}
+
+// WithAuditLogMaxFiles is an option to the NewSugarDB function that allows you to pass a
+// custom AuditLogMaxFiles to SugarDB.
+// If not specified, SugarDB will use the default configuration from config.DefaultConfig().
+func WithAuditLogMaxFiles(maxFiles uint) func(sugardb *SugarDB) {
+	return func(sugardb *SugarDB) {
+		sugardb.config.AuditLogMaxFiles = maxFiles
+	}
+}
+
+// WithRenameCommands is an option to the NewSugarDB function that allows you to pass a
+// custom RenameCommands to SugarDB. The map holds the new names of the commands by their original name,
+// e.g. "flushall", or "command|subcommand" for subcommands, e.g. "module|load".
+// If not specified, SugarDB will use the default configuration from config.DefaultConfig().
+func WithRenameCommands(renameCommands map[string]string) func(sugardb *SugarDB) {
+	return func(sugardb *SugarDB) {
+		sugardb.config.RenameCommands = renameCommands
+	}
+}
+
+// WithDisableCommands is an option to the NewSugarDB function that allows you to pass a
+// custom DisableCommands to SugarDB. Subcommands are specified as "command|subcommand", e.g. "module|load".
+// If not specified, SugarDB will use the default configuration from config.DefaultConfig().
+func WithDisableCommands(disableCommands []string) func(sugardb *SugarDB) {
+	return func(sugardb *SugarDB) {
+		sugardb.config.DisableCommands = disableCommands
+	}
+}
+
+// WithMaxClients is an option to the NewSugarDB function that allows you to pass a
+// custom MaxClients to SugarDB. 0 means there's no limit.
+// If not specified, SugarDB will use the default configuration from config.DefaultConfig().
+func WithMaxClients(maxClients uint) func(sugardb *SugarDB) {
+	return func(sugardb *SugarDB) {
+		sugardb.config.MaxClients = maxClients
+	}
+}
+
+// WithMaxClientsPerIP is an option to the NewSugarDB function that allows you to pass a
+// custom MaxClientsPerIP to SugarDB. 0 means there's no limit.
+// If not specified, SugarDB will use the default configuration from config.DefaultConfig().
+func WithMaxClientsPerIP(maxClientsPerIP uint) func(sugardb *SugarDB) {
+	return func(sugardb *SugarDB) {
+		sugardb.config.MaxClientsPerIP = maxClientsPerIP
+	}
+}
+
+// WithTimeout is an option to the NewSugarDB function that allows you to pass a
+// custom Timeout to SugarDB. Clients that are idle for longer than the timeout are disconnected.
+// 0 disables the timeout.
+// If not specified, SugarDB will use the default configuration from config.DefaultConfig().
+func WithTimeout(timeout time.Duration) func(sugardb *SugarDB) {
+	return func(sugardb *SugarDB) {
+		sugardb.config.Timeout = timeout
+	}
+}
+
+// WithTCPKeepAlive is an option to the NewSugarDB function that allows you to pass a
+// custom TCPKeepAlive to SugarDB. 0 disables the TCP keepalives.
+// If not specified, SugarDB will use the default configuration from config.DefaultConfig().
+func WithTCPKeepAlive(tcpKeepAlive time.Duration) func(sugardb *SugarDB) {
+	return func(sugardb *SugarDB) {
+		sugardb.config.TCPKeepAlive = tcpKeepAlive
+	}
+}
+
+// WithProtectedMode is an option to the NewSugarDB function that allows you to pass a
+// custom ProtectedMode to SugarDB.
+// If not specified, SugarDB will use the default configuration from config.DefaultConfig().
+func WithProtectedMode(protectedMode bool) func(sugardb *SugarDB) {
+	return func(sugardb *SugarDB) {
+		sugardb.config.ProtectedMode = protectedMode
+	}
+}
+
+// WithClusterSecret is an option to the NewSugarDB function that allows you to pass a
+// custom ClusterSecret to SugarDB.
+// If not specified, SugarDB will use the default configuration from config.DefaultConfig().
+func WithClusterSecret(clusterSecret string) func(sugardb *SugarDB) {
+	return func(sugardb *SugarDB) {
+		sugardb.config.ClusterSecret = clusterSecret
+	}
+}
+
+// WithSnapshotExportDir is an option to the NewSugarDB function that allows you to pass a
+// custom SnapshotExportDir to SugarDB.
+// If not specified, SugarDB will use the default configuration from config.DefaultConfig().
+func WithSnapshotExportDir(snapshotExportDir string) func(sugardb *SugarDB) {
+	return func(sugardb *SugarDB) {
+		sugardb.config.SnapshotExportDir = snapshotExportDir
+	}
+}
+
+// WithEncryptionPlaintext is an option to the NewSugarDB function that allows you to pass a
+// custom EncryptionPlaintext to SugarDB.
+// If not specified, SugarDB will use the default configuration from config.DefaultConfig().
+func WithEncryptionPlaintext(encryptionPlaintext bool) func(sugardb *SugarDB) {
+	return func(sugardb *SugarDB) {
+		sugardb.config.EncryptionPlaintext = encryptionPlaintext
+	}
+}
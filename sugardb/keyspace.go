@@ -58,19 +58,11 @@ func (server *SugarDB) SwapDBs(database1, database2 int) {
 	for connection, info := range server.connInfo.tcpClients {
 		switch info.Database {
 		case database1:
-			server.connInfo.tcpClients[connection] = internal.ConnectionInfo{
-				Id:       info.Id,
-				Name:     info.Name,
-				Protocol: info.Protocol,
-				Database: database2,
-			}
+			info.Database = database2
+			server.connInfo.tcpClients[connection] = info
 		case database2:
-			server.connInfo.tcpClients[connection] = internal.ConnectionInfo{
-				Id:       info.Id,
-				Name:     info.Name,
-				Protocol: info.Protocol,
-				Database: database1,
-			}
+			info.Database = database1
+			server.connInfo.tcpClients[connection] = info
 		}
 	}
 }
@@ -84,8 +76,15 @@ func (server *SugarDB) Flush(database int) {
 	server.keysWithExpiry.rwMutex.Lock()
 	defer server.keysWithExpiry.rwMutex.Unlock()
 
+	// The keys and memory quotas are counted again from the remaining keys.
+	if server.acl != nil {
+		server.acl.KeyspaceChanged()
+	}
+
 	if database == -1 {
 		for db, _ := range server.store {
+			// Preserve the keys for any state capture in progress.
+			server.preserveDatabase(db)
 			// Clear db store.
 			clear(server.store[db])
 			// Clear db volatile key tracker.
@@ -102,6 +101,8 @@ func (server *SugarDB) Flush(database int) {
 		return
 	}
 
+	// Preserve the keys for any state capture in progress.
+	server.preserveDatabase(database)
 	// Clear db store.
 	clear(server.store[database])
 	// Clear db volatile key tracker.
@@ -116,6 +117,96 @@ func (server *SugarDB) Flush(database int) {
 	server.lruCache.cache[database].Mutex.Unlock()
 }
 
+// replaceStore swaps the whole dataset for the state in one step, so that no command observes a partial dataset.
+// The new databases are built before the store lock is taken.
+func (server *SugarDB) replaceStore(state map[int]map[string]internal.KeyData) {
+	var memUsed int64
+	store := make(map[int]map[string]internal.KeyData, len(state))
+	keys := make(map[int][]string, len(state))
+	keysWithExpiry := make(map[int][]string, len(state))
+	for database, data := range state {
+		store[database] = make(map[string]internal.KeyData, len(data))
+		keys[database] = make([]string, 0, len(data))
+		keysWithExpiry[database] = make([]string, 0)
+		for key, value := range data {
+			mem, err := value.GetMem()
+			if err != nil {
+				log.Printf("replaceStore error: %+v\n", err)
+				continue
+			}
+			store[database][key] = value
+			keys[database] = append(keys[database], key)
+			if value.ExpireAt != (time.Time{}) {
+				keysWithExpiry[database] = append(keysWithExpiry[database], key)
+			}
+			memUsed += mem + int64(unsafe.Sizeof(key)) + int64(len(key))
+		}
+	}
+
+	func() {
+		server.storeLock.Lock()
+		defer server.storeLock.Unlock()
+
+		for database, _ := range store {
+			if server.store[database] == nil {
+				server.createDatabase(database)
+			}
+		}
+
+		// Preserve the replaced and the new keys for any state capture in progress.
+		for database, _ := range server.store {
+			server.preserveDatabase(database)
+			if server.hasActiveStateCapture() {
+				for key, _ := range store[database] {
+					server.preserveKey(database, key)
+				}
+			}
+		}
+
+		server.keysWithExpiry.rwMutex.Lock()
+		defer server.keysWithExpiry.rwMutex.Unlock()
+
+		for database, _ := range server.store {
+			if store[database] == nil {
+				store[database] = make(map[string]internal.KeyData)
+				keysWithExpiry[database] = make([]string, 0)
+			}
+			server.store[database] = store[database]
+			server.keysWithExpiry.keys[database] = keysWithExpiry[database]
+			// Clear db LFU cache.
+			server.lfuCache.cache[database].Mutex.Lock()
+			server.lfuCache.cache[database].Flush()
+			server.lfuCache.cache[database].Mutex.Unlock()
+			// Clear db LRU cache.
+			server.lruCache.cache[database].Mutex.Lock()
+			server.lruCache.cache[database].Flush()
+			server.lruCache.cache[database].Mutex.Unlock()
+		}
+		server.memUsed = memUsed
+
+		// The keys and memory quotas are counted again from the new keys.
+		if server.acl != nil {
+			server.acl.KeyspaceChanged()
+		}
+
+		if !server.isInCluster() {
+			server.snapshotEngine.IncrementChangeCount()
+		}
+	}()
+
+	// Asynchronously update the keys in the cache.
+	go func(keys map[int][]string) {
+		for database, keys := range keys {
+			ctx := context.WithValue(context.Background(), "Database", database)
+			for _, key := range keys {
+				if _, err := server.updateKeysInCache(ctx, []string{key}); err != nil {
+					log.Printf("replaceStore error: %+v\n", err)
+				}
+			}
+		}
+	}(keys)
+}
+
 func (server *SugarDB) keysExist(ctx context.Context, keys []string) map[string]bool {
 	server.storeLock.RLock()
 	defer server.storeLock.RUnlock()
@@ -168,6 +259,7 @@ func (server *SugarDB) getValues(ctx context.Context, keys []string) map[string]
 				if err != nil {
 					log.Printf("keyExists: %+v\n", err)
 				}
+				server.feedDeleteKey(ctx, key)
 			} else if server.isInCluster() && server.raft.IsRaftLeader() {
 				// If we're in a raft cluster, and we're the leader, send command to delete the key in the cluster.
 				err := server.raftApplyDeleteKey(ctx, key)
@@ -198,10 +290,11 @@ func (server *SugarDB) getValues(ctx context.Context, keys []string) map[string]
 }
 
 func (server *SugarDB) setValues(ctx context.Context, entries map[string]interface{}) error {
+	conf := server.liveConfig()
 	server.storeLock.Lock()
 	defer server.storeLock.Unlock()
 
-	if internal.IsMaxMemoryExceeded(server.memUsed, server.config.MaxMemory) && server.config.EvictionPolicy == constants.NoEviction {
+	if internal.IsMaxMemoryExceeded(server.memUsed, conf.MaxMemory) && conf.EvictionPolicy == constants.NoEviction {
 
 		return errors.New("max memory reached, key value not set")
 	}
@@ -214,6 +307,7 @@ func (server *SugarDB) setValues(ctx context.Context, entries map[string]interfa
 	}
 
 	for key, value := range entries {
+		server.preserveKey(database, key)
 		expireAt := time.Time{}
 		if _, ok := server.store[database][key]; ok {
 			expireAt = server.store[database][key].ExpireAt
@@ -231,6 +325,10 @@ func (server *SugarDB) setValues(ctx context.Context, entries map[string]interfa
 		server.memUsed += int64(unsafe.Sizeof(key))
 		server.memUsed += int64(len(key))
 
+		if server.acl != nil {
+			server.acl.KeyChanged(database, key, mem+int64(unsafe.Sizeof(key))+int64(len(key)))
+		}
+
 		if !server.isInCluster() {
 			server.snapshotEngine.IncrementChangeCount()
 		}
@@ -255,6 +353,7 @@ func (server *SugarDB) setExpiry(ctx context.Context, key string, expireAt time.
 
 	database := ctx.Value("Database").(int)
 
+	server.preserveKey(database, key)
 	server.store[database][key] = internal.KeyData{
 		Value:    server.store[database][key].Value,
 		ExpireAt: expireAt,
@@ -279,6 +378,7 @@ func (server *SugarDB) setExpiry(ctx context.Context, key string, expireAt time.
 }
 
 func (server *SugarDB) deleteKey(ctx context.Context, key string) error {
+	conf := server.liveConfig()
 	database := ctx.Value("Database").(int)
 
 	// Deduct memory usage in tracker.
@@ -292,7 +392,11 @@ func (server *SugarDB) deleteKey(ctx context.Context, key string) error {
 	server.memUsed -= int64(len(key))
 
 	// Delete the key from keyLocks and store.
+	server.preserveKey(database, key)
 	delete(server.store[database], key)
+	if server.acl != nil {
+		server.acl.KeyChanged(database, key, -1)
+	}
 
 	// Remove key from slice of keys associated with expiry.
 	server.keysWithExpiry.rwMutex.Lock()
@@ -303,9 +407,9 @@ func (server *SugarDB) deleteKey(ctx context.Context, key string) error {
 
 	// Remove the key from the cache associated with the database.
 	switch {
-	case slices.Contains([]string{constants.AllKeysLFU, constants.VolatileLFU}, server.config.EvictionPolicy):
+	case slices.Contains([]string{constants.AllKeysLFU, constants.VolatileLFU}, conf.EvictionPolicy):
 		server.lfuCache.cache[database].Delete(key)
-	case slices.Contains([]string{constants.AllKeysLRU, constants.VolatileLRU}, server.config.EvictionPolicy):
+	case slices.Contains([]string{constants.AllKeysLRU, constants.VolatileLRU}, conf.EvictionPolicy):
 		server.lruCache.cache[database].Delete(key)
 	}
 
@@ -334,28 +438,15 @@ func (server *SugarDB) createDatabase(database int) {
 	server.lruCache.cache[database] = eviction.NewCacheLRU()
 }
 
-func (server *SugarDB) getState() map[int]map[string]interface{} {
-	// Wait unit there's no state mutation or copy in progress before starting a new copy process.
-	for {
-		if !server.stateCopyInProgress.Load() && !server.stateMutationInProgress.Load() {
-			server.stateCopyInProgress.Store(true)
-			break
-		}
-	}
-	data := make(map[int]map[string]interface{})
-	for db, store := range server.store {
-		data[db] = make(map[string]interface{})
-		for k, v := range store {
-			data[db][k] = v
-		}
-	}
-	server.stateCopyInProgress.Store(false)
-	return data
+// getState returns a point-in-time copy of the store for snapshots and AOF preambles.
+func (server *SugarDB) getState() map[int]map[string]internal.KeyData {
+	return server.captureState(nil)
 }
 
 // updateKeysInCache updates either the key access count or the most recent access time in the cache
 // depending on whether an LFU or LRU strategy was used.
 func (server *SugarDB) updateKeysInCache(ctx context.Context, keys []string) (int64, error) {
+	conf := server.liveConfig()
 	database := ctx.Value("Database").(int)
 	var touchCounter int64
 
@@ -364,7 +455,7 @@ func (server *SugarDB) updateKeysInCache(ctx context.Context, keys []string) (in
 		return touchCounter, nil
 	}
 	// If max memory is 0, there's no max so no need to update caches.
-	if server.config.MaxMemory == 0 {
+	if conf.MaxMemory == 0 {
 		return touchCounter, nil
 	}
 
@@ -379,7 +470,7 @@ func (server *SugarDB) updateKeysInCache(ctx context.Context, keys []string) (in
 
 		touchCounter++
 
-		switch strings.ToLower(server.config.EvictionPolicy) {
+		switch strings.ToLower(conf.EvictionPolicy) {
 		case constants.AllKeysLFU:
 			server.lfuCache.cache[database].Mutex.Lock()
 			server.lfuCache.cache[database].Update(key)
@@ -434,8 +525,9 @@ func (server *SugarDB) updateKeysInCache(ctx context.Context, keys []string) (in
 
 // adjustMemoryUsage should only be called from standalone echovault or from raft cluster leader.
 func (server *SugarDB) adjustMemoryUsage(ctx context.Context) error {
+	conf := server.liveConfig()
 	// If max memory is 0, there's no need to adjust memory usage.
-	if server.config.MaxMemory == 0 {
+	if conf.MaxMemory == 0 {
 		return nil
 	}
 
@@ -444,12 +536,12 @@ func (server *SugarDB) adjustMemoryUsage(ctx context.Context) error {
 	// Check if memory usage is above max-memory.
 	// If it is, pop items from the cache until we get under the limit.
 	// If we're using less memory than the max-memory, there's no need to evict.
-	if uint64(server.memUsed) < server.config.MaxMemory {
+	if uint64(server.memUsed) < conf.MaxMemory {
 		return nil
 	}
 	// Force a garbage collection first before we start evicting keys.
 	runtime.GC()
-	if uint64(server.memUsed) < server.config.MaxMemory {
+	if uint64(server.memUsed) < conf.MaxMemory {
 		return nil
 	}
 
@@ -459,7 +551,7 @@ func (server *SugarDB) adjustMemoryUsage(ctx context.Context) error {
 
 	log.Printf("Memory used: %v, Max Memory: %v", server.GetServerInfo().MemoryUsed, server.GetServerInfo().MaxMemory)
 	switch {
-	case slices.Contains([]string{constants.AllKeysLFU, constants.VolatileLFU}, strings.ToLower(server.config.EvictionPolicy)):
+	case slices.Contains([]string{constants.AllKeysLFU, constants.VolatileLFU}, strings.ToLower(conf.EvictionPolicy)):
 		// Remove keys from LFU cache until we're below the max memory limit or
 		// until the LFU cache is empty.
 		server.lfuCache.cache[database].Mutex.Lock()
@@ -478,6 +570,7 @@ func (server *SugarDB) adjustMemoryUsage(ctx context.Context) error {
 					log.Printf("Evicting key %v from database %v \n", key, database)
 					return fmt.Errorf("adjustMemoryUsage -> LFU cache eviction: %+v", err)
 				}
+				server.feedDeleteKey(ctx, key)
 			} else if server.isInCluster() && server.raft.IsRaftLeader() {
 				// If in raft cluster, send command to delete key from cluster
 				if err := server.raftApplyDeleteKey(ctx, key); err != nil {
@@ -488,11 +581,11 @@ func (server *SugarDB) adjustMemoryUsage(ctx context.Context) error {
 			// Run garbage collection
 			runtime.GC()
 			// Return if we're below max memory
-			if uint64(server.memUsed) < server.config.MaxMemory {
+			if uint64(server.memUsed) < conf.MaxMemory {
 				return nil
 			}
 		}
-	case slices.Contains([]string{constants.AllKeysLRU, constants.VolatileLRU}, strings.ToLower(server.config.EvictionPolicy)):
+	case slices.Contains([]string{constants.AllKeysLRU, constants.VolatileLRU}, strings.ToLower(conf.EvictionPolicy)):
 		// Remove keys from th LRU cache until we're below the max memory limit or
 		// until the LRU cache is empty.
 		server.lruCache.cache[database].Mutex.Lock()
@@ -510,6 +603,7 @@ func (server *SugarDB) adjustMemoryUsage(ctx context.Context) error {
 					log.Printf("Evicting key %v from database %v \n", key, database)
 					return fmt.Errorf("adjustMemoryUsage -> LRU cache eviction: %+v", err)
 				}
+				server.feedDeleteKey(ctx, key)
 			} else if server.isInCluster() && server.raft.IsRaftLeader() {
 				// If in cluster mode and the node is a cluster leader,
 				// send command to delete the key from the cluster.
@@ -521,11 +615,11 @@ func (server *SugarDB) adjustMemoryUsage(ctx context.Context) error {
 			// Run garbage collection
 			runtime.GC()
 			// Return if we're below max memory
-			if uint64(server.memUsed) < server.config.MaxMemory {
+			if uint64(server.memUsed) < conf.MaxMemory {
 				return nil
 			}
 		}
-	case slices.Contains([]string{constants.AllKeysRandom}, strings.ToLower(server.config.EvictionPolicy)):
+	case slices.Contains([]string{constants.AllKeysRandom}, strings.ToLower(conf.EvictionPolicy)):
 		// Remove random keys until we're below the max memory limit
 		// or there are no more keys remaining.
 		for {
@@ -547,6 +641,7 @@ func (server *SugarDB) adjustMemoryUsage(ctx context.Context) error {
 
 									return fmt.Errorf("adjustMemoryUsage -> all keys random: %+v", err)
 								}
+								server.feedDeleteKey(ctx, key)
 							} else if server.isInCluster() && server.raft.IsRaftLeader() {
 								if err := server.raftApplyDeleteKey(ctx, key); err != nil {
 
@@ -556,7 +651,7 @@ func (server *SugarDB) adjustMemoryUsage(ctx context.Context) error {
 							// Run garbage collection
 							runtime.GC()
 							// Return if we're below max memory
-							if uint64(server.memUsed) < server.config.MaxMemory {
+							if uint64(server.memUsed) < conf.MaxMemory {
 								return nil
 							}
 						}
@@ -565,7 +660,7 @@ func (server *SugarDB) adjustMemoryUsage(ctx context.Context) error {
 				}
 			}
 		}
-	case slices.Contains([]string{constants.VolatileRandom}, strings.ToLower(server.config.EvictionPolicy)):
+	case slices.Contains([]string{constants.VolatileRandom}, strings.ToLower(conf.EvictionPolicy)):
 		// Remove random keys with an associated expiry time until we're below the max memory limit
 		// or there are no more keys with expiry time.
 		for {
@@ -582,6 +677,7 @@ func (server *SugarDB) adjustMemoryUsage(ctx context.Context) error {
 
 					return fmt.Errorf("adjustMemoryUsage -> volatile keys random: %+v", err)
 				}
+				server.feedDeleteKey(ctx, key)
 			} else if server.isInCluster() && server.raft.IsRaftLeader() {
 				if err := server.raftApplyDeleteKey(ctx, key); err != nil {
 
@@ -592,7 +688,7 @@ func (server *SugarDB) adjustMemoryUsage(ctx context.Context) error {
 			// Run garbage collection
 			runtime.GC()
 			// Return if we're below max memory
-			if uint64(server.memUsed) < server.config.MaxMemory {
+			if uint64(server.memUsed) < conf.MaxMemory {
 				return nil
 			}
 		}
@@ -607,6 +703,7 @@ func (server *SugarDB) adjustMemoryUsage(ctx context.Context) error {
 // if the key is expired, it will be evicted.
 // This function is only executed in standalone mode or by the raft cluster leader.
 func (server *SugarDB) evictKeysWithExpiredTTL(ctx context.Context) error {
+	conf := server.liveConfig()
 	// Only execute this if we're in standalone mode, or raft cluster leader.
 	if server.isInCluster() && !server.raft.IsRaftLeader() {
 		return nil
@@ -618,7 +715,7 @@ func (server *SugarDB) evictKeysWithExpiredTTL(ctx context.Context) error {
 
 	// Sample size should be the configured sample size, or the size of the keys with expiry,
 	// whichever one is smaller.
-	sampleSize := int(server.config.EvictionSample)
+	sampleSize := int(conf.EvictionSample)
 	if len(server.keysWithExpiry.keys[database]) < sampleSize {
 		sampleSize = len(server.keysWithExpiry.keys)
 	}
@@ -652,6 +749,7 @@ func (server *SugarDB) evictKeysWithExpiredTTL(ctx context.Context) error {
 			if err := server.deleteKey(ctx, k); err != nil {
 				return fmt.Errorf("evictKeysWithExpiredTTL -> standalone delete: %+v", err)
 			}
+			server.feedDeleteKey(ctx, k)
 		} else if server.isInCluster() && server.raft.IsRaftLeader() {
 			if err := server.raftApplyDeleteKey(ctx, k); err != nil {
 				return fmt.Errorf("evictKeysWithExpiredTTL -> cluster delete: %+v", err)
@@ -746,3 +844,41 @@ func (server *SugarDB) getObjectIdleTime(ctx context.Context, key string) (float
 
 	return secs, nil
 }
+
+// rangeKeyUsage calls yield with the database, the name and the memory usage of every key.
+// The store lock must be held, and yield must not access the store.
+func (server *SugarDB) rangeKeyUsage(yield func(database int, key string, memory int64)) {
+	for database, store := range server.store {
+		for key, data := range store {
+			mem, err := data.GetMem()
+			if err != nil {
+				continue
+			}
+			yield(database, key, mem+int64(unsafe.Sizeof(key))+int64(len(key)))
+		}
+	}
+}
+
+// getKeyspaceInfo returns the number of keys in each database that holds keys.
+func (server *SugarDB) getKeyspaceInfo() []internal.DatabaseInfo {
+	server.storeLock.RLock()
+	defer server.storeLock.RUnlock()
+
+	var info []internal.DatabaseInfo
+	for database, store := range server.store {
+		if len(store) == 0 {
+			continue
+		}
+		databaseInfo := internal.DatabaseInfo{Database: database, Keys: len(store)}
+		for _, data := range store {
+			if !data.ExpireAt.IsZero() {
+				databaseInfo.Expires++
+			}
+		}
+		info = append(info, databaseInfo)
+	}
+	slices.SortFunc(info, func(a, b internal.DatabaseInfo) int {
+		return a.Database - b.Database
+	})
+	return info
+}
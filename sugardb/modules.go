@@ -20,9 +20,10 @@ import (
 	"fmt"
 	"github.com/echovault/sugardb/internal"
 	"github.com/echovault/sugardb/internal/clock"
-	"github.com/echovault/sugardb/internal/constants"
+	"github.com/echovault/sugardb/internal/sharding"
 	"io"
 	"net"
+	"slices"
 	"strings"
 )
 
@@ -48,12 +49,18 @@ func (server *SugarDB) getHandlerFuncParams(ctx context.Context, cmd []string, c
 		SetValues:             server.setValues,
 		SetExpiry:             server.setExpiry,
 		TakeSnapshot:          server.takeSnapshot,
+		BGSave:                server.bgSave,
+		ListSnapshots:         server.listSnapshots,
+		RestoreSnapshot:       server.restoreSnapshot,
+		ExportSnapshot:        server.exportSnapshot,
 		GetLatestSnapshotTime: server.getLatestSnapshotTime,
 		RewriteAOF:            server.rewriteAOF,
-		LoadModule:            server.LoadModule,
-		UnloadModule:          server.UnloadModule,
+		BGRewriteAOF:          server.bgRewriteAOF,
+		LoadModule:            server.loadModule,
+		UnloadModule:          server.unloadModule,
 		ListModules:           server.ListModules,
 		GetPubSub:             server.getPubSub,
+		PublishToCluster:      server.publishToCluster,
 		GetACL:                server.getACL,
 		GetAllCommands:        server.getCommands,
 		GetClock:              server.getClock,
@@ -64,6 +71,8 @@ func (server *SugarDB) getHandlerFuncParams(ctx context.Context, cmd []string, c
 		GetObjectIdleTime:     server.getObjectIdleTime,
 		SwapDBs:               server.SwapDBs,
 		GetServerInfo:         server.GetServerInfo,
+		GetKeyspaceInfo:       server.getKeyspaceInfo,
+		ApplyCommand:          server.applyCommand,
 		DeleteKey: func(ctx context.Context, key string) error {
 			server.storeLock.Lock()
 			defer server.storeLock.Unlock()
@@ -74,6 +83,7 @@ func (server *SugarDB) getHandlerFuncParams(ctx context.Context, cmd []string, c
 			defer server.connInfo.mut.RUnlock()
 			return server.connInfo.tcpClients[conn]
 		},
+		ListClients: server.listClients,
 		SetConnectionInfo: func(conn *net.Conn, clientname string, protocol int, database int) {
 			server.connInfo.mut.Lock()
 			defer server.connInfo.mut.Unlock()
@@ -100,26 +110,63 @@ func (server *SugarDB) getHandlerFuncParams(ctx context.Context, cmd []string, c
 
 			server.connInfo.tcpClients[conn] = info
 		},
+		SetReadConsistency: func(conn *net.Conn, consistency string) {
+			server.connInfo.mut.Lock()
+			defer server.connInfo.mut.Unlock()
+			info := server.connInfo.tcpClients[conn]
+			info.ReadConsistency = consistency
+			server.connInfo.tcpClients[conn] = info
+		},
+		SetAsking:         server.setAsking,
+		GetClusterShards:  server.getClusterShards,
+		GetClusterInfo:    server.getClusterInfo,
+		GetClusterNodes:   server.getClusterNodes,
+		ClusterFailover:   server.clusterFailover,
+		ClusterForget:     server.clusterForget,
+		ClusterAddNode:    server.clusterAddNode,
+		ClusterRemoveNode: server.clusterRemoveNode,
+		ClusterPromote:    server.clusterPromote,
+		ClusterDemote:     server.clusterDemote,
+		GetRole:           server.getRole,
+		ReplicaOf:         server.replicaOf,
+		PSync:             server.psync,
+		ReplConf:          server.replConf,
+		CountKeysInSlot:   server.countKeysInSlot,
+		GetKeysInSlot:     server.getKeysInSlot,
+		SetSlot:           server.setSlot,
+		Rebalance:         server.rebalance,
 	}
 }
 
-func (server *SugarDB) handleCommand(ctx context.Context, message []byte, conn *net.Conn, replay bool, embedded bool) ([]byte, error) {
+func (server *SugarDB) handleCommand(ctx context.Context, message []byte, conn *net.Conn, replay bool, embedded bool) (res []byte, err error) {
 	// Prepare context before processing the command.
+	var readConsistency string
 	server.connInfo.mut.RLock()
+	// A replayed command keeps the connection info of the caller's context, including the database it was logged on.
 	if embedded && !replay {
 		// The call is triggered via the embedded API.
 		// Add embedded connection info to the context of the request.
 		ctx = context.WithValue(ctx, "ConnectionName", server.connInfo.embedded.Name)
 		ctx = context.WithValue(ctx, "Protocol", server.connInfo.embedded.Protocol)
 		ctx = context.WithValue(ctx, "Database", server.connInfo.embedded.Database)
-	} else {
+		readConsistency = server.connInfo.embedded.ReadConsistency
+	} else if !replay {
 		// The call is triggered by a TCP connection.
 		// Add TCP connection info to the context of the request.
 		ctx = context.WithValue(ctx, "ConnectionName", server.connInfo.tcpClients[conn].Name)
 		ctx = context.WithValue(ctx, "Protocol", server.connInfo.tcpClients[conn].Protocol)
 		ctx = context.WithValue(ctx, "Database", server.connInfo.tcpClients[conn].Database)
+		readConsistency = server.connInfo.tcpClients[conn].ReadConsistency
 	}
 	server.connInfo.mut.RUnlock()
+	if embedded {
+		// The embedded API is not subject to the ACL, so the leader does not authorize its forwarded commands.
+		ctx = context.WithValue(ctx, internal.ContextSystem("System"), true)
+	} else if conn != nil && server.acl != nil {
+		username, rules := server.acl.ForwardedUser(conn)
+		ctx = context.WithValue(ctx, internal.ContextUsername("Username"), username)
+		ctx = context.WithValue(ctx, internal.ContextUserRules("UserRules"), rules)
+	}
 
 	cmd, err := internal.Decode(message)
 	if err != nil {
@@ -135,6 +182,14 @@ func (server *SugarDB) handleCommand(ctx context.Context, message []byte, conn *
 		return nil, io.EOF
 	}
 
+	// The embedded API calls the renamed commands by their original names.
+	if embedded {
+		if renamed := server.commandName(cmd); !slices.Equal(renamed, cmd) {
+			cmd = renamed
+			message = internal.EncodeCommand(cmd)
+		}
+	}
+
 	command, err := server.getCommand(cmd[0])
 	if err != nil {
 		return nil, err
@@ -153,21 +208,82 @@ func (server *SugarDB) handleCommand(ctx context.Context, message []byte, conn *
 		handler = subCommand.HandlerFunc
 	}
 
+	// Record the latest command of the TCP client for CLIENT LIST.
+	if conn != nil && !embedded {
+		name := strings.ToLower(command.Command)
+		if ok {
+			name = fmt.Sprintf("%s|%s", name, strings.ToLower(subCommand.Command))
+		}
+		server.touchConnection(conn, name)
+	}
+
+	// Record the outcome of the command in the audit log, including denials.
+	if !replay && server.audit.Audited(command, subCommand) {
+		defer func() {
+			server.auditCommand(ctx, conn, embedded, cmd, err)
+		}()
+	}
+
 	if conn != nil && server.acl != nil && !embedded {
 		// Authorize connection if it's provided and if ACL module is present
 		// and the embedded parameter is false.
-		if err = server.acl.AuthorizeConnection(conn, cmd, command, subCommand); err != nil {
+		if err = server.acl.AuthorizeConnection(ctx, conn, cmd, command, subCommand); err != nil {
+			return nil, err
+		}
+		// Enforce the rate limits and resource quotas of the connection's user.
+		if err = server.acl.CheckQuotas(ctx, conn, len(message), cmd, command, subCommand); err != nil {
 			return nil, err
 		}
 	}
 
-	// If the command is a write command, wait for state copy to finish.
+	// In cluster mode, redirect the client when the slot of the command's keys is served by another shard.
+	if server.isInCluster() && !replay {
+		// ASKING only applies to the command that follows it.
+		asking := false
+		if conn != nil && !embedded && !strings.EqualFold(internal.OriginalCommand(command), "asking") {
+			asking = server.consumeAsking(conn)
+		}
+		// RESTORE-ASKING is sent by MIGRATE to store the keys of a slot that is being imported.
+		if strings.EqualFold(internal.OriginalCommand(command), "restore-asking") {
+			asking = true
+		}
+		if err = server.routeCommand(ctx, command, subCommand, cmd, asking); err != nil {
+			return nil, err
+		}
+		// The leader routes a forwarded command again.
+		ctx = context.WithValue(ctx, internal.ContextAsking("Asking"), asking)
+	}
+
+	// Reject the writes that this node does not accept before pausing the state captures for them.
+	if !replay {
+		if err = server.checkWritesAllowed(command, subCommand); err != nil {
+			return nil, err
+		}
+	}
+
+	// If the command is a write command, hold off state captures until the command has been
+	// executed and logged. Preserve the affected keys for any capture that is already in progress.
+	// In cluster mode, raft applies writes and takes snapshots on the same goroutine, so there is no need to pause.
 	if internal.IsWriteCommand(command, subCommand) {
-		for {
-			if !server.stateCopyInProgress.Load() {
-				server.stateMutationInProgress.Store(true)
-				break
+		if !server.isInCluster() {
+			server.stateCapture.pause.RLock()
+			defer server.stateCapture.pause.RUnlock()
+		}
+		if server.hasActiveStateCapture() {
+			keyExtractionFunc := command.KeyExtractionFunc
+			if subCommand.KeyExtractionFunc != nil {
+				keyExtractionFunc = subCommand.KeyExtractionFunc
 			}
+			if keys, err := keyExtractionFunc(cmd); err == nil {
+				server.preserveKeys(ctx, keys.WriteKeys)
+			}
+		}
+	}
+
+	// In cluster mode, catch up with the leader before serving reads that are not allowed to be stale.
+	if server.isInCluster() && !replay && !synchronize && internal.IsReadCommand(command, subCommand) {
+		if err = server.waitForReadConsistency(ctx, readConsistency); err != nil {
+			return nil, err
 		}
 	}
 
@@ -178,13 +294,12 @@ func (server *SugarDB) handleCommand(ctx context.Context, message []byte, conn *
 		}
 
 		if internal.IsWriteCommand(command, subCommand) && !replay {
-			server.connInfo.mut.RLock()
-			server.aofEngine.LogCommand(server.connInfo.tcpClients[conn].Database, message)
-			server.connInfo.mut.RUnlock()
+			// The database is the one the command ran on, including for the embedded API which has no TCP client.
+			database, _ := ctx.Value("Database").(int)
+			server.aofEngine.LogCommand(database, message)
+			server.feedReplicas(database, cmd)
 		}
 
-		server.stateMutationInProgress.Store(false)
-
 		return res, err
 	}
 
@@ -198,15 +313,82 @@ func (server *SugarDB) handleCommand(ctx context.Context, message []byte, conn *
 		return res, err
 	}
 
-	// Forward message to leader and return immediate OK response
+	// Forward the command to the leader and return the leader's reply once it's applied.
 	if server.config.ForwardCommand {
-		server.memberList.ForwardDataMutation(ctx, message)
-		return []byte(constants.OkResponse), nil
+		return server.forwardCommand(ctx, cmd)
 	}
 
 	return nil, errors.New("not cluster leader, cannot carry out command")
 }
 
+// checkWritesAllowed returns an error when the command writes but this node does not accept writes.
+func (server *SugarDB) checkWritesAllowed(command internal.Command, subCommand internal.SubCommand) error {
+	if !internal.IsWriteCommand(command, subCommand) {
+		return nil
+	}
+
+	// Replicas only serve reads.
+	if server.isReadOnly() {
+		return sharding.ErrReadOnly
+	}
+
+	// In standalone mode, reject write commands when the latest snapshot failed if configured to do so.
+	if !server.isInCluster() && server.liveConfig().StopWritesOnBGSaveError &&
+		server.snapshotEngine.Status().LastSaveError != nil {
+		return errors.New(
+			"MISCONF Errors writing the snapshot to disk. Commands that may modify the data set are disabled. " +
+				"Please check the server logs for details about the error.")
+	}
+
+	return nil
+}
+
+// applyCommand executes a write command on behalf of a handler, e.g. the deletion of the keys moved by MIGRATE.
+// In cluster mode, the command is applied through the raft log like a write command received from a client.
+func (server *SugarDB) applyCommand(ctx context.Context, cmd []string) ([]byte, error) {
+	cmd = server.commandName(cmd)
+	if server.isInCluster() {
+		ctx = context.WithValue(ctx, internal.ContextSystem("System"), true)
+		if server.raft.IsRaftLeader() {
+			return server.raftApplyCommand(ctx, cmd)
+		}
+		if server.config.ForwardCommand {
+			return server.forwardCommand(ctx, cmd)
+		}
+		return nil, errors.New("not cluster leader, cannot carry out command")
+	}
+
+	command, err := server.getCommand(cmd[0])
+	if err != nil {
+		return nil, err
+	}
+	keyExtractionFunc := command.KeyExtractionFunc
+	handler := command.HandlerFunc
+	sc, err := internal.GetSubCommand(command, cmd)
+	if err != nil {
+		return nil, err
+	}
+	if subCommand, ok := sc.(internal.SubCommand); ok {
+		keyExtractionFunc = subCommand.KeyExtractionFunc
+		handler = subCommand.HandlerFunc
+	}
+
+	server.stateCapture.pause.RLock()
+	defer server.stateCapture.pause.RUnlock()
+	if keys, err := keyExtractionFunc(cmd); err == nil {
+		server.preserveKeys(ctx, keys.WriteKeys)
+	}
+
+	res, err := handler(server.getHandlerFuncParams(ctx, cmd, nil))
+	if err != nil {
+		return nil, err
+	}
+	database, _ := ctx.Value("Database").(int)
+	server.aofEngine.LogCommand(database, internal.EncodeCommand(cmd))
+	server.feedReplicas(database, cmd)
+	return res, nil
+}
+
 func (server *SugarDB) getCommands() []internal.Command {
 	return server.commands
 }
@@ -16,10 +16,14 @@ package sugardb
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"github.com/echovault/sugardb/internal"
+	"io"
 	"io/fs"
+	"log"
 	"os"
 	"plugin"
 	"slices"
@@ -34,7 +38,20 @@ import (
 //
 // `args` - ...string - A list of args that will be passed unmodified to the plugins command's
 // KeyExtractionFunc and HandlerFunc
+//
+// In cluster mode, the module is loaded on every node of the cluster. The module file must be present
+// with the same contents at the same path on every node.
 func (server *SugarDB) LoadModule(path string, args ...string) error {
+	if !server.isInCluster() {
+		return server.loadModule(path, args...)
+	}
+	cmd := append([]string{"MODULE", "LOAD", path}, args...)
+	_, err := server.handleCommand(server.context, internal.EncodeCommand(cmd), nil, false, true)
+	return err
+}
+
+// loadModule loads an external module on this node only.
+func (server *SugarDB) loadModule(path string, args ...string) error {
 	server.commandsRWMut.Lock()
 	defer server.commandsRWMut.Unlock()
 
@@ -111,13 +128,8 @@ func (server *SugarDB) LoadModule(path string, args ...string) error {
 		return errors.New("handler function has unexpected signature")
 	}
 
-	// Remove the currently loaded version of this module and replace it with the new one
-	server.commands = slices.DeleteFunc(server.commands, func(command internal.Command) bool {
-		return strings.EqualFold(command.Module, path)
-	})
-
-	// Add the new command
-	server.commands = append(server.commands, internal.Command{
+	// Rename the command or refuse to load it as configured.
+	newCommand, ok := server.configureCommand(internal.Command{
 		Command: *command,
 		Module:  path,
 		Categories: func() []string {
@@ -153,6 +165,21 @@ func (server *SugarDB) LoadModule(path string, args ...string) error {
 			)
 		},
 	})
+	if !ok {
+		return fmt.Errorf("load module: command %s is disabled", *command)
+	}
+
+	// Remove the currently loaded version of this module and replace it with the new one
+	server.commands = slices.DeleteFunc(server.commands, func(command internal.Command) bool {
+		return strings.EqualFold(command.Module, path)
+	})
+	server.commands = append(server.commands, newCommand)
+
+	// Record the module so that it's included in the raft snapshots.
+	server.loadedModules = slices.DeleteFunc(server.loadedModules, func(module internal.LoadedModule) bool {
+		return strings.EqualFold(module.Path, path)
+	})
+	server.loadedModules = append(server.loadedModules, internal.LoadedModule{Path: path, Args: args})
 
 	return nil
 }
@@ -162,12 +189,29 @@ func (server *SugarDB) LoadModule(path string, args ...string) error {
 // Parameters:
 //
 // `module` - string - module name as displayed by the ListModules method.
+//
+// In cluster mode, the module is unloaded on every node of the cluster.
 func (server *SugarDB) UnloadModule(module string) {
+	if !server.isInCluster() {
+		server.unloadModule(module)
+		return
+	}
+	cmd := []string{"MODULE", "UNLOAD", module}
+	if _, err := server.handleCommand(server.context, internal.EncodeCommand(cmd), nil, false, true); err != nil {
+		log.Printf("unload module %s: %v\n", module, err)
+	}
+}
+
+// unloadModule unloads a module on this node only.
+func (server *SugarDB) unloadModule(module string) {
 	server.commandsRWMut.Lock()
 	defer server.commandsRWMut.Unlock()
 	server.commands = slices.DeleteFunc(server.commands, func(command internal.Command) bool {
 		return strings.EqualFold(command.Module, module)
 	})
+	server.loadedModules = slices.DeleteFunc(server.loadedModules, func(loaded internal.LoadedModule) bool {
+		return strings.EqualFold(loaded.Path, module)
+	})
 }
 
 // ListModules lists the currently loaded modules
@@ -186,3 +230,66 @@ func (server *SugarDB) ListModules() []string {
 	}
 	return modules
 }
+
+// getModules returns the modules loaded from dynamic libraries and their args.
+func (server *SugarDB) getModules() []internal.LoadedModule {
+	server.commandsRWMut.RLock()
+	defer server.commandsRWMut.RUnlock()
+	modules := make([]internal.LoadedModule, len(server.loadedModules))
+	copy(modules, server.loadedModules)
+	return modules
+}
+
+// setModules loads and unloads modules so that this node has the modules restored from a raft snapshot.
+// A module that can't be loaded on this node is logged and skipped.
+func (server *SugarDB) setModules(modules []internal.LoadedModule) {
+	for _, loaded := range server.getModules() {
+		if !slices.ContainsFunc(modules, func(module internal.LoadedModule) bool {
+			return strings.EqualFold(module.Path, loaded.Path) && slices.Equal(module.Args, loaded.Args)
+		}) {
+			server.unloadModule(loaded.Path)
+		}
+	}
+	current := server.getModules()
+	for _, module := range modules {
+		if slices.ContainsFunc(current, func(loaded internal.LoadedModule) bool {
+			return strings.EqualFold(module.Path, loaded.Path)
+		}) {
+			continue
+		}
+		if err := server.loadModule(module.Path, module.Args...); err != nil {
+			log.Printf("module %s conflicts with the cluster: %v\n", module.Path, err)
+		}
+	}
+}
+
+// moduleChecksum returns the hex encoded SHA-256 checksum of the module file.
+func moduleChecksum(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return "", fmt.Errorf("module %s not found", path)
+		}
+		return "", err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// checkModule checks that the module file exists on this node with the given checksum.
+func (server *SugarDB) checkModule(path, checksum string) error {
+	sum, err := moduleChecksum(path)
+	if err != nil {
+		return err
+	}
+	if sum != checksum {
+		return fmt.Errorf("module %s differs from the module on the leader", path)
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+// Copyright 2024 Kelvin Clement Mwinuka
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sugardb
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/echovault/sugardb/internal/modules/pubsub"
+)
+
+// recentPublishesSize is the number of message ids each node remembers to drop duplicate messages.
+const recentPublishesSize = 4096
+
+// clusterPublish is a message published on a node that's sent to the other cluster members.
+type clusterPublish struct {
+	ID      string `json:"ID"` // The server id of the node where the message was published and a sequence number.
+	Channel string `json:"Channel"`
+	Message string `json:"Message"`
+	Sharded bool   `json:"Sharded"` // Whether the message was published to a shard channel with SPUBLISH.
+}
+
+// clusterSubscriptions are the subscriptions of a node that are sent to the other cluster members.
+type clusterSubscriptions struct {
+	ShardID string         `json:"ShardID"`
+	Summary pubsub.Summary `json:"Summary"`
+}
+
+// recentMessages remembers the ids of the latest messages, forgetting the oldest id once it's full.
+type recentMessages struct {
+	mut   sync.Mutex
+	ids   map[string]struct{}
+	order []string
+	next  int
+}
+
+func newRecentMessages(size int) *recentMessages {
+	return &recentMessages{
+		ids:   make(map[string]struct{}, size),
+		order: make([]string, size),
+	}
+}
+
+// seen records the id and reports whether it was already recorded.
+func (r *recentMessages) seen(id string) bool {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	if _, ok := r.ids[id]; ok {
+		return true
+	}
+	delete(r.ids, r.order[r.next])
+	r.order[r.next] = id
+	r.ids[id] = struct{}{}
+	r.next = (r.next + 1) % len(r.order)
+	return false
+}
+
+// publishToCluster sends a message published on this node to the other cluster members.
+// Messages published to shard channels are only sent to the other nodes of this node's shard.
+func (server *SugarDB) publishToCluster(channel, message string, sharded bool) {
+	if !server.isInCluster() {
+		return
+	}
+	b, err := json.Marshal(clusterPublish{
+		ID:      fmt.Sprintf("%s-%d", server.config.ServerID, server.publishSequence.Add(1)),
+		Channel: channel,
+		Message: message,
+		Sharded: sharded,
+	})
+	if err != nil {
+		log.Printf("encode published message: %v\n", err)
+		return
+	}
+	server.memberList.BroadcastPublish(b, sharded)
+}
+
+// deliverPublish delivers a message published on another node to the subscribers of this node.
+// A message that was already delivered is dropped.
+func (server *SugarDB) deliverPublish(b []byte) {
+	var msg clusterPublish
+	if err := json.Unmarshal(b, &msg); err != nil {
+		log.Printf("decode published message: %v\n", err)
+		return
+	}
+	if server.recentPublishes.seen(msg.ID) {
+		return
+	}
+	if msg.Sharded {
+		server.pubSub.SPublish(server.context, msg.Message, msg.Channel)
+		return
+	}
+	server.pubSub.Publish(server.context, msg.Message, msg.Channel)
+}
+
+// subscriptionsChanged schedules sending the subscriptions of this node to the other cluster members.
+func (server *SugarDB) subscriptionsChanged() {
+	if server.memberList != nil {
+		server.memberList.SubscriptionsChanged()
+	}
+}
+
+// getSubscriptions returns the encoded subscriptions of this node.
+func (server *SugarDB) getSubscriptions() []byte {
+	b, err := json.Marshal(clusterSubscriptions{
+		ShardID: server.config.ShardID,
+		Summary: server.pubSub.Summary(),
+	})
+	if err != nil {
+		log.Printf("encode subscriptions: %v\n", err)
+		return nil
+	}
+	return b
+}
+
+// mergeSubscriptions records the subscriptions of another cluster member.
+// Shard channels only count for the nodes of the same shard.
+func (server *SugarDB) mergeSubscriptions(serverId string, b []byte) {
+	var subscriptions clusterSubscriptions
+	if err := json.Unmarshal(b, &subscriptions); err != nil {
+		log.Printf("decode subscriptions: %v\n", err)
+		return
+	}
+	if subscriptions.ShardID != server.config.ShardID {
+		subscriptions.Summary.ShardChannels = nil
+	}
+	server.pubSub.SetRemote(serverId, subscriptions.Summary)
+}
+
+// forgetSubscriptions removes the subscriptions of a cluster member that left the cluster.
+func (server *SugarDB) forgetSubscriptions(serverId string) {
+	server.pubSub.RemoveRemote(serverId)
+}
@@ -0,0 +1,41 @@
+// Copyright 2024 Kelvin Clement Mwinuka
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sugardb
+
+import (
+	"testing"
+)
+
+func Test_recentMessages(t *testing.T) {
+	recent := newRecentMessages(2)
+	steps := []struct {
+		id   string
+		want bool
+	}{
+		{id: "a-1", want: false},
+		{id: "a-1", want: true},
+		{id: "b-1", want: false},
+		{id: "a-1", want: true},
+		// The oldest id is forgotten once the ids don't fit anymore.
+		{id: "a-2", want: false},
+		{id: "a-1", want: false},
+		{id: "a-2", want: true},
+	}
+	for i, step := range steps {
+		if got := recent.seen(step.id); got != step.want {
+			t.Errorf("step %d: seen(%s) = %v, want %v", i, step.id, got, step.want)
+		}
+	}
+}
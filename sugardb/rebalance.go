@@ -0,0 +1,248 @@
+// Copyright 2024 Kelvin Clement Mwinuka
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sugardb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/echovault/sugardb/internal"
+	"github.com/echovault/sugardb/internal/migrate"
+	"github.com/echovault/sugardb/internal/sharding"
+	"github.com/tidwall/resp"
+)
+
+// slotMove is a range of slots to move from one shard to another.
+type slotMove struct {
+	from  string
+	to    string
+	slots sharding.SlotRange
+}
+
+// rebalance moves slots from the shards that serve more than their share of the slots to the shards
+// that serve less, until every shard serves the same number of slots.
+//
+// Each range of slots is moved online. The destination shard imports the slots and the source shard
+// migrates them, so that clients are redirected with ASK while the keys are moved in batches with MIGRATE.
+// Once the keys are moved, both shards record the destination shard as the owner of the slots.
+func (server *SugarDB) rebalance(ctx context.Context, options internal.RebalanceOptions) (int, error) {
+	if !server.isInCluster() {
+		return 0, errClusterDisabled
+	}
+
+	leaders := make(map[string]string)
+	owned := make(map[string][]int)
+	for _, meta := range server.memberList.NodeMetas() {
+		if _, ok := owned[meta.ShardID]; !ok {
+			owned[meta.ShardID] = make([]int, 0)
+		}
+		if meta.Leader && meta.ClientAddr != "" {
+			leaders[meta.ShardID] = meta.ClientAddr
+		}
+	}
+	for _, shard := range server.slotMap.Shards() {
+		if len(shard.Migrating) > 0 || len(shard.Importing) > 0 {
+			return 0, fmt.Errorf("shard %s has slots that are being migrated, set them to STABLE first", shard.ID)
+		}
+		owned[shard.ID] = sharding.ExpandSlotRanges(shard.Slots)
+	}
+	for id := range owned {
+		if _, ok := leaders[id]; !ok {
+			return 0, fmt.Errorf("shard %s has no leader", id)
+		}
+	}
+
+	moves := planRebalance(owned)
+	moved := 0
+	for _, move := range moves {
+		if err := server.moveSlots(ctx, options, leaders, move); err != nil {
+			return moved, fmt.Errorf("move slots %s from shard %s to shard %s: %w",
+				sharding.FormatSlotRanges([]sharding.SlotRange{move.slots}), move.from, move.to, err)
+		}
+		moved += move.slots.End - move.slots.Start + 1
+	}
+	return moved, nil
+}
+
+// planRebalance returns the ranges of slots to move so that each shard serves the same number of slots.
+// When the slots can't be split evenly, the shards that serve the most slots keep the extra slots.
+// The shards that give up slots give up their highest slots.
+func planRebalance(owned map[string][]int) []slotMove {
+	ids := make([]string, 0, len(owned))
+	total := 0
+	for id, slots := range owned {
+		ids = append(ids, id)
+		total += len(slots)
+	}
+	if len(ids) == 0 || total == 0 {
+		return nil
+	}
+	slices.SortFunc(ids, func(a, b string) int {
+		if len(owned[a]) != len(owned[b]) {
+			return len(owned[b]) - len(owned[a])
+		}
+		return strings.Compare(a, b)
+	})
+
+	target := make(map[string]int, len(ids))
+	for i, id := range ids {
+		target[id] = total / len(ids)
+		if i < total%len(ids) {
+			target[id]++
+		}
+	}
+
+	type surplus struct {
+		id    string
+		slots []int
+	}
+	var surpluses []surplus
+	for _, id := range ids {
+		if excess := len(owned[id]) - target[id]; excess > 0 {
+			slots := slices.Clone(owned[id])
+			slices.Sort(slots)
+			surpluses = append(surpluses, surplus{id: id, slots: slots[len(slots)-excess:]})
+		}
+	}
+
+	var moves []slotMove
+	for _, id := range ids {
+		need := target[id] - len(owned[id])
+		for need > 0 && len(surpluses) > 0 {
+			n := min(need, len(surpluses[0].slots))
+			for _, r := range sharding.ToRanges(surpluses[0].slots[:n]) {
+				moves = append(moves, slotMove{from: surpluses[0].id, to: id, slots: r})
+			}
+			surpluses[0].slots = surpluses[0].slots[n:]
+			if len(surpluses[0].slots) == 0 {
+				surpluses = surpluses[1:]
+			}
+			need -= n
+		}
+	}
+	return moves
+}
+
+// moveSlots moves a range of slots and their keys between the shards through the leaders of the shards.
+func (server *SugarDB) moveSlots(ctx context.Context, options internal.RebalanceOptions,
+	leaders map[string]string, move slotMove) error {
+	source, err := migrate.Dial(ctx, leaders[move.from], options.Timeout, options.Auth)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = source.Close()
+	}()
+	destination, err := migrate.Dial(ctx, leaders[move.to], options.Timeout, options.Auth)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = destination.Close()
+	}()
+
+	slots := sharding.FormatSlotRanges([]sharding.SlotRange{move.slots})
+	if _, err = destination.Do("CLUSTER", "SETSLOT", slots, "IMPORTING", move.from); err != nil {
+		return err
+	}
+	if _, err = source.Do("CLUSTER", "SETSLOT", slots, "MIGRATING", move.to); err != nil {
+		return err
+	}
+
+	// Keys created from now on in the migrating slots are created on the destination shard,
+	// so the databases that hold keys of the slots can't change anymore.
+	databases, err := keyspaceDatabases(source)
+	if err != nil {
+		return err
+	}
+	host, port, err := net.SplitHostPort(leaders[move.to])
+	if err != nil {
+		return err
+	}
+	for _, database := range databases {
+		if _, err = source.Do("SELECT", strconv.Itoa(database)); err != nil {
+			return err
+		}
+		for slot := move.slots.Start; slot <= move.slots.End; slot++ {
+			if err = migrateSlotKeys(source, options, host, port, database, slot); err != nil {
+				return err
+			}
+		}
+	}
+
+	if _, err = destination.Do("CLUSTER", "SETSLOT", slots, "NODE", move.to); err != nil {
+		return err
+	}
+	_, err = source.Do("CLUSTER", "SETSLOT", slots, "NODE", move.to)
+	return err
+}
+
+// migrateSlotKeys moves the keys of the slot in the selected database of the source connection in batches.
+func migrateSlotKeys(source *migrate.Client, options internal.RebalanceOptions,
+	host, port string, database, slot int) error {
+	for {
+		res, err := source.Do("CLUSTER", "GETKEYSINSLOT", strconv.Itoa(slot), strconv.Itoa(options.BatchSize))
+		if err != nil {
+			return err
+		}
+		if len(res.Array()) == 0 {
+			return nil
+		}
+		cmd := []string{"MIGRATE", host, port, "", strconv.Itoa(database),
+			strconv.FormatInt(options.Timeout.Milliseconds(), 10), "REPLACE"}
+		switch len(options.Auth) {
+		case 1:
+			cmd = append(cmd, "AUTH", options.Auth[0])
+		case 2:
+			cmd = append(cmd, "AUTH2", options.Auth[0], options.Auth[1])
+		}
+		cmd = append(cmd, "KEYS")
+		for _, key := range res.Array() {
+			cmd = append(cmd, key.String())
+		}
+		if _, err = source.Do(cmd...); err != nil {
+			return err
+		}
+	}
+}
+
+// keyspaceDatabases returns the databases that hold keys, from the keyspace section of INFO.
+func keyspaceDatabases(client *migrate.Client) ([]int, error) {
+	res, err := client.Do("INFO", "keyspace")
+	if err != nil {
+		return nil, err
+	}
+	if res.Type() != resp.BulkString {
+		return nil, errors.New("unexpected INFO reply")
+	}
+	var databases []int
+	for _, line := range strings.Split(res.String(), "\r\n") {
+		name, _, ok := strings.Cut(line, ":")
+		if !ok || !strings.HasPrefix(name, "db") {
+			continue
+		}
+		database, err := strconv.Atoi(strings.TrimPrefix(name, "db"))
+		if err != nil {
+			return nil, err
+		}
+		databases = append(databases, database)
+	}
+	return databases, nil
+}
@@ -0,0 +1,77 @@
+// Copyright 2024 Kelvin Clement Mwinuka
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sugardb
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/echovault/sugardb/internal/sharding"
+)
+
+func Test_planRebalance(t *testing.T) {
+	slots := func(ranges string) []int {
+		r, err := sharding.ParseSlotRanges(ranges)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sharding.ExpandSlotRanges(r)
+	}
+
+	tests := []struct {
+		name  string
+		owned map[string][]int
+		want  []slotMove
+	}{
+		{
+			name:  "1. Move half of the slots to an empty shard",
+			owned: map[string][]int{"a": slots("0-16383"), "b": {}},
+			want:  []slotMove{{from: "a", to: "b", slots: sharding.SlotRange{Start: 8192, End: 16383}}},
+		},
+		{
+			name:  "2. Split the slots between three shards",
+			owned: map[string][]int{"a": slots("0-9"), "b": {}, "c": {}},
+			want: []slotMove{
+				{from: "a", to: "b", slots: sharding.SlotRange{Start: 4, End: 6}},
+				{from: "a", to: "c", slots: sharding.SlotRange{Start: 7, End: 9}},
+			},
+		},
+		{
+			name:  "3. Move the highest slots in contiguous ranges",
+			owned: map[string][]int{"a": slots("0-4,10"), "b": slots("5-6")},
+			want: []slotMove{
+				{from: "a", to: "b", slots: sharding.SlotRange{Start: 4, End: 4}},
+				{from: "a", to: "b", slots: sharding.SlotRange{Start: 10, End: 10}},
+			},
+		},
+		{
+			name:  "4. Don't move slots between balanced shards",
+			owned: map[string][]int{"a": slots("0-4"), "b": slots("5-8")},
+			want:  nil,
+		},
+		{
+			name:  "5. Don't move slots when no shard has slots",
+			owned: map[string][]int{"a": {}, "b": {}},
+			want:  nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := planRebalance(tt.owned); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("planRebalance() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
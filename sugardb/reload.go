@@ -0,0 +1,296 @@
+// Copyright 2024 Kelvin Clement Mwinuka
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sugardb
+
+import (
+	"context"
+	"fmt"
+	"github.com/echovault/sugardb/internal"
+	"github.com/echovault/sugardb/internal/config"
+	"github.com/echovault/sugardb/internal/snapshot"
+	"log"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ConfigReloadResult reports the outcome of ReloadConfig.
+type ConfigReloadResult struct {
+	// Applied lists the settings that were reloaded without a restart.
+	Applied []string
+	// RequiresRestart lists the settings that changed in the config file but only take effect after a restart.
+	RequiresRestart []string
+}
+
+// liveSettings are the config file settings that are applied to a running instance.
+var liveSettings = []string{
+	"MaxMemory",
+	"EvictionPolicy",
+	"EvictionSample",
+	"EvictionInterval",
+	"ConfigReloadInterval",
+	"MaxClients",
+	"MaxClientsPerIP",
+	"Timeout",
+	"TCPKeepAlive",
+	"ProtectedMode",
+}
+
+// livePersistenceSettings are the config file settings that are applied to a running instance in standalone mode.
+// In cluster mode, persistence is handled by the raft layer, which only reads them on startup.
+var livePersistenceSettings = []string{
+	"SnapshotThreshold",
+	"SnapshotInterval",
+	"SaveRules",
+	"SnapshotRetainLast",
+	"SnapshotRetainHourly",
+	"SnapshotRetainDaily",
+	"AOFSyncStrategy",
+	"StopWritesOnBGSaveError",
+}
+
+// liveTLSSettings are the config file settings that are applied to new connections when TLS is enabled.
+var liveTLSSettings = []string{
+	"CertKeyPairs",
+	"ClientCAs",
+}
+
+// liveConfig returns a copy of the config that is safe to read while the config is being reloaded.
+func (server *SugarDB) liveConfig() config.Config {
+	server.configMut.RLock()
+	defer server.configMut.RUnlock()
+	return server.config
+}
+
+// ReloadConfig reloads the ACL users from the ACL config file, the settings in the config file and the TLS
+// certificates without restarting the instance. The ACL users that are not in the ACL config file are deleted,
+// except the default user. In cluster mode, every node of the cluster reloads its ACL config file.
+//
+// Only the settings that are safe to change on a running instance are applied: the eviction settings, the snapshot
+// and AOF settings in standalone mode, and the TLS certificates. The other settings that changed in the config
+// file are reported in the result's RequiresRestart list and take effect on the next start.
+// Settings that are removed from the config file keep their current value.
+//
+// Nothing is applied when the config file, the ACL file or the certificates cannot be loaded.
+func (server *SugarDB) ReloadConfig() (ConfigReloadResult, error) {
+	server.reloadMut.Lock()
+	defer server.reloadMut.Unlock()
+
+	result := ConfigReloadResult{
+		Applied:         []string{},
+		RequiresRestart: []string{},
+	}
+	current := server.liveConfig()
+
+	reloaded, err := config.Reload(current)
+	if err != nil {
+		return result, fmt.Errorf("reload config file: %w", err)
+	}
+
+	live := slices.Clone(liveSettings)
+	if !server.isInCluster() {
+		live = append(live, livePersistenceSettings...)
+	}
+	tlsEnabled := current.TLS || current.MTLS
+	if tlsEnabled {
+		live = append(live, liveTLSSettings...)
+	}
+
+	for _, setting := range changedSettings(current, reloaded) {
+		if slices.Contains(live, setting) {
+			result.Applied = append(result.Applied, setting)
+		} else {
+			result.RequiresRestart = append(result.RequiresRestart, setting)
+		}
+	}
+
+	var tlsConfig = server.tlsConfig.Load()
+	if tlsEnabled && tlsConfig != nil {
+		if tlsConfig, err = loadTLSConfig(reloaded); err != nil {
+			return ConfigReloadResult{}, fmt.Errorf("reload tls certificates: %w", err)
+		}
+	}
+
+	if current.AclConfig != "" {
+		if err = server.reloadUsers(); err != nil {
+			return ConfigReloadResult{}, fmt.Errorf("reload acl users: %w", err)
+		}
+		result.Applied = append(result.Applied, "ACL users")
+	}
+
+	if tlsEnabled && tlsConfig != nil {
+		server.tlsConfig.Store(tlsConfig)
+		result.Applied = append(result.Applied, "TLS certificates")
+	}
+
+	server.configMut.Lock()
+	server.config.MaxMemory = reloaded.MaxMemory
+	server.config.EvictionPolicy = reloaded.EvictionPolicy
+	server.config.EvictionSample = reloaded.EvictionSample
+	server.config.EvictionInterval = reloaded.EvictionInterval
+	server.config.ConfigReloadInterval = reloaded.ConfigReloadInterval
+	server.config.MaxClients = reloaded.MaxClients
+	server.config.MaxClientsPerIP = reloaded.MaxClientsPerIP
+	server.config.Timeout = reloaded.Timeout
+	server.config.TCPKeepAlive = reloaded.TCPKeepAlive
+	server.config.ProtectedMode = reloaded.ProtectedMode
+	if !server.isInCluster() {
+		server.config.SnapShotThreshold = reloaded.SnapShotThreshold
+		server.config.SnapshotInterval = reloaded.SnapshotInterval
+		server.config.SaveRules = reloaded.SaveRules
+		server.config.SnapshotRetainLast = reloaded.SnapshotRetainLast
+		server.config.SnapshotRetainHourly = reloaded.SnapshotRetainHourly
+		server.config.SnapshotRetainDaily = reloaded.SnapshotRetainDaily
+		server.config.AOFSyncStrategy = reloaded.AOFSyncStrategy
+		server.config.StopWritesOnBGSaveError = reloaded.StopWritesOnBGSaveError
+	}
+	if tlsEnabled {
+		server.config.CertKeyPairs = reloaded.CertKeyPairs
+		server.config.ClientCAs = reloaded.ClientCAs
+	}
+	server.configMut.Unlock()
+
+	if !server.isInCluster() {
+		rules := make([]snapshot.SaveRule, len(reloaded.SaveRules))
+		for i, rule := range reloaded.SaveRules {
+			rules[i] = snapshot.SaveRule{
+				Interval: time.Duration(rule.Seconds) * time.Second,
+				Changes:  rule.Changes,
+			}
+		}
+		server.snapshotEngine.SetSaveRules(reloaded.SnapshotInterval, reloaded.SnapShotThreshold, rules...)
+		server.snapshotEngine.SetRetention(snapshot.Retention{
+			Last:   int(reloaded.SnapshotRetainLast),
+			Hourly: int(reloaded.SnapshotRetainHourly),
+			Daily:  int(reloaded.SnapshotRetainDaily),
+		})
+		server.aofEngine.SetStrategy(reloaded.AOFSyncStrategy)
+	}
+
+	logReloadResult(result)
+
+	return result, nil
+}
+
+// reloadUsers makes the ACL users match the ACL config file. The users that are not in the file are deleted,
+// except the default user, and their connections are closed. In cluster mode, the reload goes through raft
+// like ACL LOAD, so that every node of the cluster reloads its ACL config file.
+func (server *SugarDB) reloadUsers() error {
+	if !server.isInCluster() {
+		return server.acl.LoadUsers("sync")
+	}
+	cmd := server.commandName([]string{"ACL", "LOAD", "SYNC"})
+	if server.raft.IsRaftLeader() {
+		_, err := server.raftApplyCommand(server.context, cmd)
+		return err
+	}
+	_, err := server.forwardCommand(context.WithValue(server.context, internal.ContextSystem("System"), true), cmd)
+	return err
+}
+
+// changedSettings returns the config file names of the settings that differ between the configs.
+func changedSettings(current config.Config, reloaded config.Config) []string {
+	var changed []string
+	currentValue, reloadedValue := reflect.ValueOf(current), reflect.ValueOf(reloaded)
+	for i := 0; i < currentValue.NumField(); i++ {
+		field := currentValue.Type().Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		if !reflect.DeepEqual(currentValue.Field(i).Interface(), reloadedValue.Field(i).Interface()) {
+			changed = append(changed, name)
+		}
+	}
+	return changed
+}
+
+// watchConfig reloads the config when the config file, the ACL file or the TLS certificates change.
+// The files are checked every ConfigReloadInterval. It returns when the context is cancelled.
+func (server *SugarDB) watchConfig(ctx context.Context) {
+	files := server.watchedFiles()
+	for {
+		interval := server.liveConfig().ConfigReloadInterval
+		if interval <= 0 {
+			// Watching is disabled, check again later in case it's enabled by a reload.
+			interval = time.Second
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+		if server.liveConfig().ConfigReloadInterval <= 0 {
+			continue
+		}
+
+		latest := server.watchedFiles()
+		if reflect.DeepEqual(files, latest) {
+			continue
+		}
+		files = latest
+
+		if _, err := server.ReloadConfig(); err != nil {
+			log.Printf("config reload: %v\n", err)
+			continue
+		}
+		// The reload can change the watched files, e.g. the paths of the certificates.
+		files = server.watchedFiles()
+	}
+}
+
+type watchedFile struct {
+	modTime time.Time
+	size    int64
+}
+
+// watchedFiles returns the modification time and size of the files that trigger a reload when they change.
+// A file that does not exist has a zero value.
+func (server *SugarDB) watchedFiles() map[string]watchedFile {
+	conf := server.liveConfig()
+	paths := []string{conf.ConfigFile, conf.AclConfig}
+	if conf.TLS || conf.MTLS {
+		for _, pair := range conf.CertKeyPairs {
+			paths = append(paths, pair...)
+		}
+		paths = append(paths, conf.ClientCAs...)
+	}
+
+	files := make(map[string]watchedFile)
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		files[path] = watchedFile{}
+		if info, err := os.Stat(path); err == nil {
+			files[path] = watchedFile{modTime: info.ModTime(), size: info.Size()}
+		}
+	}
+	return files
+}
+
+func logReloadResult(result ConfigReloadResult) {
+	if len(result.Applied) > 0 {
+		log.Printf("config reloaded: %s\n", strings.Join(result.Applied, ", "))
+	}
+	if len(result.RequiresRestart) > 0 {
+		log.Printf("config changes that require a restart: %s\n", strings.Join(result.RequiresRestart, ", "))
+	}
+}
@@ -0,0 +1,225 @@
+// Copyright 2024 Kelvin Clement Mwinuka
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sugardb
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"github.com/echovault/sugardb/internal"
+	"github.com/echovault/sugardb/internal/constants"
+	"github.com/tidwall/resp"
+	"os"
+	"path"
+	"slices"
+	"testing"
+	"time"
+)
+
+func Test_ReloadConfig(t *testing.T) {
+	writeJSON := func(t *testing.T, file string, v any) {
+		b, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = os.WriteFile(file, b, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	newServer := func(t *testing.T, configFile string, aclFile string, reloadInterval time.Duration) *SugarDB {
+		port, err := internal.GetFreePort()
+		if err != nil {
+			t.Fatal(err)
+		}
+		conf := DefaultConfig()
+		conf.DataDir = t.TempDir()
+		conf.BindAddr = "localhost"
+		conf.Port = uint16(port)
+		conf.TLS = true
+		conf.CertKeyPairs = [][]string{
+			{path.Join("..", "openssl", "server", "server1.crt"), path.Join("..", "openssl", "server", "server1.key")},
+		}
+		conf.AclConfig = aclFile
+		conf.ConfigFile = configFile
+		conf.ConfigReloadInterval = reloadInterval
+
+		server, err := NewSugarDB(WithConfig(conf))
+		if err != nil {
+			t.Fatal(err)
+		}
+		go server.Start()
+		t.Cleanup(server.ShutDown)
+
+		// Wait for the listener to load the TLS config.
+		for i := 0; i < 100 && server.tlsConfig.Load() == nil; i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+		if server.tlsConfig.Load() == nil {
+			t.Fatal("server did not start")
+		}
+		return server
+	}
+
+	t.Run("1. Apply the live settings and report the settings that require a restart", func(t *testing.T) {
+		dir := t.TempDir()
+		configFile := path.Join(dir, "config.json")
+		aclFile := path.Join(dir, "acl.json")
+		writeJSON(t, configFile, map[string]any{})
+		writeJSON(t, aclFile, []map[string]any{})
+
+		server := newServer(t, configFile, aclFile, 0)
+		previousTLSConfig := server.tlsConfig.Load()
+
+		writeJSON(t, configFile, map[string]any{
+			"MaxMemory":          1024,
+			"EvictionPolicy":     constants.AllKeysLRU,
+			"AOFSyncStrategy":    "always",
+			"SnapshotRetainLast": 3,
+			"Port":               1234,
+			"CertKeyPairs": [][]string{
+				{path.Join("..", "openssl", "server", "server2.crt"), path.Join("..", "openssl", "server", "server2.key")},
+			},
+		})
+		writeJSON(t, aclFile, []map[string]any{
+			{"Username": "reloaded", "Enabled": true, "NoPassword": true},
+		})
+
+		result, err := server.ReloadConfig()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, setting := range []string{
+			"MaxMemory", "EvictionPolicy", "AOFSyncStrategy", "SnapshotRetainLast",
+			"CertKeyPairs", "ACL users", "TLS certificates",
+		} {
+			if !slices.Contains(result.Applied, setting) {
+				t.Errorf("expected %s to be applied, got %v", setting, result.Applied)
+			}
+		}
+		if !slices.Equal(result.RequiresRestart, []string{"Port"}) {
+			t.Errorf("expected only Port to require a restart, got %v", result.RequiresRestart)
+		}
+
+		conf := server.liveConfig()
+		if conf.MaxMemory != 1024 || conf.EvictionPolicy != constants.AllKeysLRU || conf.AOFSyncStrategy != "always" {
+			t.Errorf("expected the live settings to be applied, got max memory %d, policy %s, aof sync strategy %s",
+				conf.MaxMemory, conf.EvictionPolicy, conf.AOFSyncStrategy)
+		}
+		if conf.Port == 1234 {
+			t.Error("expected the port not to change until a restart")
+		}
+		if server.tlsConfig.Load() == previousTLSConfig {
+			t.Error("expected the TLS certificates to be reloaded")
+		}
+
+		users, err := server.ACLUsers()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Contains(users, "reloaded") {
+			t.Errorf("expected the reloaded user to be loaded, got %v", users)
+		}
+	})
+
+	t.Run("2. Apply nothing when the config file is invalid", func(t *testing.T) {
+		dir := t.TempDir()
+		configFile := path.Join(dir, "config.json")
+		writeJSON(t, configFile, map[string]any{})
+
+		server := newServer(t, configFile, "", 0)
+
+		writeJSON(t, configFile, map[string]any{
+			"MaxMemory":      1024,
+			"EvictionPolicy": "not-a-policy",
+		})
+
+		if _, err := server.ReloadConfig(); err == nil {
+			t.Error("expected an error for an invalid eviction policy")
+		}
+		if conf := server.liveConfig(); conf.MaxMemory != 0 {
+			t.Errorf("expected max memory to remain 0, got %d", conf.MaxMemory)
+		}
+	})
+
+	t.Run("3. Reload the config when the config file changes", func(t *testing.T) {
+		dir := t.TempDir()
+		configFile := path.Join(dir, "config.json")
+		writeJSON(t, configFile, map[string]any{})
+
+		server := newServer(t, configFile, "", 20*time.Millisecond)
+
+		writeJSON(t, configFile, map[string]any{"MaxMemory": 2048, "ConfigReloadInterval": 20 * time.Millisecond})
+
+		for i := 0; i < 100 && server.liveConfig().MaxMemory != 2048; i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+		if conf := server.liveConfig(); conf.MaxMemory != 2048 {
+			t.Errorf("expected max memory to be reloaded to 2048, got %d", conf.MaxMemory)
+		}
+	})
+
+	t.Run("4. Delete the users that are removed from the ACL file and close their connections", func(t *testing.T) {
+		dir := t.TempDir()
+		configFile := path.Join(dir, "config.json")
+		aclFile := path.Join(dir, "acl.json")
+		writeJSON(t, configFile, map[string]any{})
+		writeJSON(t, aclFile, []map[string]any{
+			{"Username": "kept", "Enabled": true, "NoPassword": true, "IncludedCategories": []string{"*"}},
+			{"Username": "removed", "Enabled": true, "NoPassword": true, "IncludedCategories": []string{"*"}},
+		})
+
+		server := newServer(t, configFile, aclFile, 0)
+
+		conn, err := tls.Dial("tcp", fmt.Sprintf("localhost:%d", server.config.Port), &tls.Config{InsecureSkipVerify: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			_ = conn.Close()
+		})
+		client := resp.NewConn(conn)
+		if err = client.WriteArray([]resp.Value{
+			resp.StringValue("AUTH"), resp.StringValue("removed"), resp.StringValue("password"),
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if res, _, err := client.ReadValue(); err != nil || res.String() != "OK" {
+			t.Fatalf("expected OK, got %v, %v", res, err)
+		}
+
+		writeJSON(t, aclFile, []map[string]any{
+			{"Username": "kept", "Enabled": true, "NoPassword": true, "IncludedCategories": []string{"*"}},
+		})
+		if _, err = server.ReloadConfig(); err != nil {
+			t.Fatal(err)
+		}
+
+		users, err := server.ACLUsers()
+		if err != nil {
+			t.Fatal(err)
+		}
+		slices.Sort(users)
+		if !slices.Equal(users, []string{"default", "kept"}) {
+			t.Errorf("expected users [default kept], got %v", users)
+		}
+
+		_ = client.WriteArray([]resp.Value{resp.StringValue("PING")})
+		if res, _, err := client.ReadValue(); err == nil {
+			t.Errorf("expected the connection of the removed user to be closed, got %v", res)
+		}
+	})
+}
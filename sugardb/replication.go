@@ -0,0 +1,253 @@
+// Copyright 2024 Kelvin Clement Mwinuka
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sugardb
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/echovault/sugardb/internal"
+	"github.com/echovault/sugardb/internal/replication"
+	"github.com/tidwall/resp"
+)
+
+// isReadOnly returns true when the node is a replica that rejects write commands.
+// In cluster mode, non-voting replicas only serve reads. In standalone mode, so do the replicas of a primary.
+func (server *SugarDB) isReadOnly() bool {
+	if server.isInCluster() {
+		return server.raft.IsNonvoter()
+	}
+	server.replication.mut.RLock()
+	defer server.replication.mut.RUnlock()
+	return server.replication.replica != nil
+}
+
+// replicaOf makes this standalone instance a replica of the primary at addr, or a primary when addr is empty.
+// The instance keeps its dataset until the new primary sends its own.
+func (server *SugarDB) replicaOf(addr string) error {
+	if server.isInCluster() {
+		return errors.New("REPLICAOF is not allowed in cluster mode")
+	}
+	if addr != "" {
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			return fmt.Errorf("invalid primary address %q", addr)
+		}
+	}
+
+	server.replication.mut.Lock()
+	defer server.replication.mut.Unlock()
+
+	if server.replication.replica != nil {
+		previous := server.replication.replica.Status().Addr
+		if previous == addr {
+			return nil
+		}
+		server.replication.replica.Stop()
+		server.replication.replica = nil
+		log.Printf("stopped replicating %s\n", previous)
+	}
+	if addr == "" {
+		return nil
+	}
+
+	var auth []string
+	if server.config.MasterAuth != "" {
+		if server.config.MasterUser != "" {
+			auth = append(auth, server.config.MasterUser)
+		}
+		auth = append(auth, server.config.MasterAuth)
+	}
+	server.replication.replica = replication.NewReplica(replication.ReplicaOpts{
+		Addr:          addr,
+		Auth:          auth,
+		ListeningPort: int(server.config.Port),
+		Load:          server.loadReplicatedState,
+		Apply:         server.applyReplicatedCommand,
+	})
+	server.replication.replica.Start(server.context)
+	log.Printf("replicating %s\n", addr)
+	return nil
+}
+
+// loadReplicatedState replaces the dataset with the one sent by the primary in a full resynchronization.
+func (server *SugarDB) loadReplicatedState(state map[int]map[string]internal.KeyData) {
+	func() {
+		server.stateCapture.pause.RLock()
+		defer server.stateCapture.pause.RUnlock()
+		server.replaceStore(state)
+	}()
+
+	// The replicas of this instance followed the previous dataset.
+	server.replication.primary.Reset()
+
+	// The AOF no longer describes the dataset.
+	if err := server.aofEngine.RewriteLog(); err != nil {
+		log.Printf("rewrite aof after full resync: %v\n", err)
+	}
+}
+
+// applyReplicatedCommand executes a write command received from the primary.
+func (server *SugarDB) applyReplicatedCommand(database int, cmd []string) error {
+	ctx := context.WithValue(server.context, "Protocol", 2)
+	ctx = context.WithValue(ctx, "Database", database)
+	_, err := server.applyCommand(ctx, cmd)
+	return err
+}
+
+// feedReplicas appends a write command executed on the database to the replication stream.
+func (server *SugarDB) feedReplicas(database int, cmd []string) {
+	if server.replication.primary != nil {
+		server.replication.primary.Feed(database, cmd)
+	}
+}
+
+// feedDeleteKey propagates the deletion of an expired or evicted key to the replicas.
+func (server *SugarDB) feedDeleteKey(ctx context.Context, key string) {
+	database, _ := ctx.Value("Database").(int)
+	server.feedReplicas(database, []string{"DEL", key})
+}
+
+// psync starts the replication of this instance to the replica on the connection.
+func (server *SugarDB) psync(conn *net.Conn, id string, offset int64) error {
+	if server.isInCluster() {
+		return errors.New("PSYNC is not allowed in cluster mode")
+	}
+	if conn == nil {
+		return errors.New("PSYNC is only supported over TCP connections")
+	}
+	return server.replication.primary.Sync(conn, id, offset)
+}
+
+// serveReplica reads the acknowledgements of the replica on the connection after PSYNC handed the connection
+// over to the stream. The stream is the only writer of the connection from then on, so nothing is replied here.
+// It returns when the connection is closed.
+func (server *SugarDB) serveReplica(conn *net.Conn, r io.Reader) {
+	// The primary disconnects the replicas that stop acknowledging, so the link has no idle deadline.
+	if err := (*conn).SetReadDeadline(time.Time{}); err != nil {
+		log.Println(err)
+	}
+	for {
+		message, err := internal.ReadMessage(r)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				log.Println(err)
+			}
+			return
+		}
+		if len(message) == 0 {
+			// Connection closed
+			return
+		}
+		// A read can hold several acknowledgements.
+		reader := resp.NewReader(bytes.NewReader(message))
+		for {
+			value, _, err := reader.ReadValue()
+			if err != nil {
+				break
+			}
+			cmd := value.Array()
+			if len(cmd) != 3 || !strings.EqualFold(cmd[0].String(), "REPLCONF") {
+				log.Printf("ignoring unexpected command from replica %s\n", (*conn).RemoteAddr())
+				continue
+			}
+			if err = server.replConf(conn, cmd[1].String(), cmd[2].String()); err != nil {
+				log.Println(err)
+			}
+		}
+	}
+}
+
+// replConf records the options that the replica on the connection sends before and during the replication.
+func (server *SugarDB) replConf(conn *net.Conn, option string, value string) error {
+	if server.isInCluster() || conn == nil {
+		return nil
+	}
+	switch strings.ToLower(option) {
+	case "listening-port":
+		port, err := strconv.Atoi(value)
+		if err != nil || port < 0 || port > 65535 {
+			return fmt.Errorf("invalid port %q", value)
+		}
+		server.replication.primary.SetListeningPort(conn, port)
+	case "ack":
+		offset, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid offset %q", value)
+		}
+		server.replication.primary.Ack(conn, offset)
+	}
+	return nil
+}
+
+// getStandaloneRole returns the replication role of this standalone instance.
+func (server *SugarDB) getStandaloneRole() internal.RoleInfo {
+	server.replication.mut.RLock()
+	replica := server.replication.replica
+	server.replication.mut.RUnlock()
+
+	if replica != nil {
+		status := replica.Status()
+		role := internal.RoleInfo{
+			Role:          "slave",
+			Offset:        status.Offset,
+			State:         status.State,
+			Replica:       true,
+			LastContact:   -1,
+			ReplicationID: status.ID,
+		}
+		if host, port, err := net.SplitHostPort(status.Addr); err == nil {
+			role.LeaderHost = host
+			role.LeaderPort, _ = strconv.Atoi(port)
+		}
+		if !status.LastIO.IsZero() {
+			role.LastContact = time.Since(status.LastIO)
+		}
+		return role
+	}
+
+	stats := server.replication.primary.Stats()
+	role := internal.RoleInfo{
+		Role:               "master",
+		Offset:             stats.Offset,
+		Replicas:           make([]internal.ClusterNode, 0),
+		ReplicationID:      stats.ID,
+		Links:              make(map[string]internal.ReplicaLink),
+		SyncFull:           stats.SyncFull,
+		SyncPartialOK:      stats.SyncPartialOK,
+		SyncPartialErr:     stats.SyncPartialErr,
+		BacklogActive:      stats.BacklogActive,
+		BacklogSize:        stats.BacklogSize,
+		BacklogFirstOffset: stats.BacklogFirstOffset,
+		BacklogHistlen:     stats.BacklogHistlen,
+	}
+	for _, r := range server.replication.primary.Replicas() {
+		id := net.JoinHostPort(r.Host, strconv.Itoa(r.Port))
+		role.Replicas = append(role.Replicas, internal.ClusterNode{ServerID: id, Host: r.Host, Port: r.Port})
+		role.Links[id] = internal.ReplicaLink{Offset: r.Offset, LastAck: r.LastAck}
+	}
+	slices.SortFunc(role.Replicas, func(a, b internal.ClusterNode) int {
+		return strings.Compare(a.ServerID, b.ServerID)
+	})
+	return role
+}
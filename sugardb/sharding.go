@@ -0,0 +1,488 @@
+// Copyright 2024 Kelvin Clement Mwinuka
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sugardb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/echovault/sugardb/internal"
+	"github.com/echovault/sugardb/internal/memberlist"
+	"github.com/echovault/sugardb/internal/sharding"
+)
+
+var errClusterDisabled = errors.New("This instance has cluster support disabled")
+
+// getShard returns the slots of the node's shard. It's nil when the shard has no slots yet.
+func (server *SugarDB) getShard() *sharding.Shard {
+	shard, ok := server.slotMap.Shard(server.config.ShardID)
+	if !ok {
+		return nil
+	}
+	return &shard
+}
+
+// setShard records the slots of a shard from the raft log of the node's shard.
+// A claim is only recorded when the shard has no slots yet.
+func (server *SugarDB) setShard(shard sharding.Shard, claim bool) {
+	if _, ok := server.slotMap.Shard(shard.ID); ok && claim {
+		return
+	}
+	if server.slotMap.Update(shard) {
+		server.broadcastShards()
+	}
+}
+
+// getShards returns the encoded slot map of the node.
+func (server *SugarDB) getShards() []byte {
+	b, err := json.Marshal(server.slotMap.Records())
+	if err != nil {
+		log.Printf("encode shards: %v\n", err)
+		return nil
+	}
+	return b
+}
+
+// mergeShards merges the slot map received from another node and reports whether the slot map changed.
+func (server *SugarDB) mergeShards(b []byte) bool {
+	var shards []sharding.Shard
+	if err := json.Unmarshal(b, &shards); err != nil {
+		log.Printf("decode shards: %v\n", err)
+		return false
+	}
+	changed := false
+	for _, shard := range shards {
+		if server.slotMap.Update(shard) {
+			changed = true
+		}
+	}
+	return changed
+}
+
+func (server *SugarDB) broadcastShards() {
+	if server.memberList == nil {
+		return
+	}
+	if b := server.getShards(); b != nil {
+		server.memberList.BroadcastShards(b)
+	}
+}
+
+// raftApplyShard records the slots of the node's shard in the raft log of the shard.
+func (server *SugarDB) raftApplyShard(shard sharding.Shard, claim bool) error {
+	requestType := "set-shard"
+	if claim {
+		requestType = "claim-shard"
+	}
+
+	b, err := json.Marshal(internal.ApplyRequest{
+		Type:     requestType,
+		ServerID: server.config.ServerID,
+		Shard:    &shard,
+	})
+	if err != nil {
+		return fmt.Errorf("could not parse %s request for shard %s", requestType, shard.ID)
+	}
+
+	applyFuture := server.raft.Apply(b, 500*time.Millisecond)
+	if err = applyFuture.Error(); err != nil {
+		return err
+	}
+
+	r, ok := applyFuture.Response().(internal.ApplyResponse)
+	if !ok {
+		return fmt.Errorf("unprocessable entity %v", r)
+	}
+	return r.Error
+}
+
+// claimShardSlots claims the configured slots for the node's shard if the shard has no slots yet.
+// Only the node that bootstraps the shard claims the slots, once it becomes the leader of the shard.
+func (server *SugarDB) claimShardSlots() {
+	if !server.config.BootstrapCluster || server.getShard() != nil {
+		return
+	}
+	slots, err := sharding.ParseSlotRanges(server.config.ShardSlots)
+	if err != nil {
+		log.Printf("claim shard slots: %v\n", err)
+		return
+	}
+	if len(slots) == 0 {
+		// The shard starts without slots, they are moved to it later.
+		return
+	}
+	shard := sharding.Shard{
+		ID:    server.config.ShardID,
+		Epoch: server.slotMap.MaxEpoch() + 1,
+		Slots: slots,
+	}
+	if err = server.raftApplyShard(shard, true); err != nil {
+		log.Printf("claim shard slots: %v\n", err)
+	}
+}
+
+// watchLeadership updates the metadata that the node gossips whenever it becomes or stops being the leader
+// of its shard, so that the other shards know where to redirect clients.
+func (server *SugarDB) watchLeadership() {
+	leaderCh := server.raft.LeaderCh()
+	for {
+		select {
+		case <-server.stopLeadership:
+			return
+		case leader := <-leaderCh:
+			server.memberList.UpdateNodeMeta()
+			if leader {
+				server.claimShardSlots()
+			}
+		}
+	}
+}
+
+// routeCommand checks that the node's shard serves the slot of the command's keys.
+// It returns a cluster error that redirects the client when the slot is served by another shard.
+func (server *SugarDB) routeCommand(ctx context.Context, command internal.Command, subCommand internal.SubCommand,
+	cmd []string, asking bool) error {
+	keyExtractionFunc := command.KeyExtractionFunc
+	if subCommand.KeyExtractionFunc != nil {
+		keyExtractionFunc = subCommand.KeyExtractionFunc
+	}
+	if keyExtractionFunc == nil {
+		return nil
+	}
+	// Let the handler report malformed commands.
+	keys, err := keyExtractionFunc(cmd)
+	if err != nil {
+		return nil
+	}
+
+	// All the commands of a cluster where no shard has claimed slots yet are served locally.
+	if server.slotMap.Empty() {
+		return nil
+	}
+
+	allKeys := append(slices.Clone(keys.ReadKeys), keys.WriteKeys...)
+	// Shard channels are routed like keys, to the shard that serves their slot.
+	shardChannels := isShardChannelCommand(internal.OriginalCommand(command))
+	if shardChannels {
+		allKeys = append(allKeys, keys.Channels...)
+	}
+	// The keys must hash to the same slot even when their slots are served by the same shard,
+	// as the slots can be moved to different shards at any time.
+	slot, err := sharding.CommandSlot(allKeys)
+	if err != nil {
+		return err
+	}
+	if slot == -1 {
+		return nil
+	}
+
+	route := server.slotMap.Route(server.config.ShardID, slot, asking)
+	switch route.Kind {
+	case sharding.RouteUnassigned:
+		return sharding.ErrClusterDown
+	case sharding.RouteMoved:
+		addr, ok := server.shardClientAddr(route.Shard)
+		if !ok {
+			return sharding.ErrClusterDown
+		}
+		return sharding.MovedError(slot, addr)
+	case sharding.RouteMigrating:
+		// Shard channels hold no data, they're served by the source shard until the migration completes.
+		if shardChannels {
+			return nil
+		}
+		// Serve the keys that are still on this node. Ask the client to try the keys that
+		// have already been migrated on the destination shard.
+		slices.Sort(allKeys)
+		allKeys = slices.Compact(allKeys)
+		missing := 0
+		for _, exists := range server.keysExist(ctx, allKeys) {
+			if !exists {
+				missing++
+			}
+		}
+		switch {
+		case missing == 0:
+			return nil
+		case missing < len(allKeys):
+			return sharding.ErrTryAgain
+		}
+		addr, ok := server.shardClientAddr(route.Shard)
+		if !ok {
+			return sharding.ErrClusterDown
+		}
+		return sharding.AskError(slot, addr)
+	}
+	return nil
+}
+
+// isShardChannelCommand reports whether the command accesses shard channels.
+func isShardChannelCommand(command string) bool {
+	return slices.ContainsFunc([]string{"ssubscribe", "sunsubscribe", "spublish"}, func(c string) bool {
+		return strings.EqualFold(c, command)
+	})
+}
+
+// shardClientAddr returns the client address of a node of the shard, preferring the leader of the shard.
+func (server *SugarDB) shardClientAddr(shardId string) (string, bool) {
+	var addr string
+	for _, meta := range server.memberList.NodeMetas() {
+		if meta.ShardID != shardId || meta.ClientAddr == "" {
+			continue
+		}
+		if meta.Leader {
+			return meta.ClientAddr, true
+		}
+		addr = meta.ClientAddr
+	}
+	return addr, addr != ""
+}
+
+// consumeAsking clears the ASKING flag of the connection and reports whether it was set.
+// The flag only applies to the command that follows ASKING.
+func (server *SugarDB) consumeAsking(conn *net.Conn) bool {
+	server.connInfo.mut.Lock()
+	defer server.connInfo.mut.Unlock()
+	info, ok := server.connInfo.tcpClients[conn]
+	if !ok || !info.Asking {
+		return false
+	}
+	info.Asking = false
+	server.connInfo.tcpClients[conn] = info
+	return true
+}
+
+func (server *SugarDB) setAsking(conn *net.Conn) error {
+	if !server.isInCluster() {
+		return errClusterDisabled
+	}
+	// The embedded API has no connection to redirect.
+	if conn == nil {
+		return nil
+	}
+	server.connInfo.mut.Lock()
+	defer server.connInfo.mut.Unlock()
+	info := server.connInfo.tcpClients[conn]
+	info.Asking = true
+	server.connInfo.tcpClients[conn] = info
+	return nil
+}
+
+// getClusterShards returns the shards of the cluster with the slots they serve and their nodes.
+func (server *SugarDB) getClusterShards() ([]internal.ClusterShard, error) {
+	if !server.isInCluster() {
+		return nil, errClusterDisabled
+	}
+
+	nodes := make(map[string][]internal.ClusterNode)
+	for _, meta := range server.memberList.NodeMetas() {
+		if node, ok := clusterNode(meta); ok {
+			nodes[meta.ShardID] = append(nodes[meta.ShardID], node)
+		}
+	}
+
+	var shards []internal.ClusterShard
+	for _, shard := range server.slotMap.Shards() {
+		clusterShard := internal.ClusterShard{ID: shard.ID, Nodes: nodes[shard.ID]}
+		for _, r := range shard.Slots {
+			clusterShard.Slots = append(clusterShard.Slots, [2]int{r.Start, r.End})
+		}
+		slices.SortFunc(clusterShard.Nodes, func(a, b internal.ClusterNode) int {
+			if a.Leader != b.Leader {
+				if a.Leader {
+					return -1
+				}
+				return 1
+			}
+			return strings.Compare(a.ServerID, b.ServerID)
+		})
+		shards = append(shards, clusterShard)
+	}
+	return shards, nil
+}
+
+func clusterNode(meta memberlist.NodeMeta) (internal.ClusterNode, bool) {
+	host, port, err := net.SplitHostPort(meta.ClientAddr)
+	if err != nil {
+		return internal.ClusterNode{}, false
+	}
+	p, err := strconv.Atoi(port)
+	if err != nil {
+		return internal.ClusterNode{}, false
+	}
+	return internal.ClusterNode{
+		ServerID: string(meta.ServerID),
+		Host:     host,
+		Port:     p,
+		Leader:   meta.Leader,
+	}, true
+}
+
+// countKeysInSlot returns the number of keys in the slot in the database of the context.
+func (server *SugarDB) countKeysInSlot(ctx context.Context, slot int) int {
+	server.storeLock.RLock()
+	defer server.storeLock.RUnlock()
+
+	database, _ := ctx.Value("Database").(int)
+	count := 0
+	for key := range server.store[database] {
+		if sharding.KeySlot(key) == slot {
+			count++
+		}
+	}
+	return count
+}
+
+// getKeysInSlot returns up to count keys of the slot in the database of the context, sorted by name.
+func (server *SugarDB) getKeysInSlot(ctx context.Context, slot int, count int) []string {
+	server.storeLock.RLock()
+	defer server.storeLock.RUnlock()
+
+	database, _ := ctx.Value("Database").(int)
+	keys := make([]string, 0)
+	for key := range server.store[database] {
+		if sharding.KeySlot(key) == slot {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+	if len(keys) > count {
+		keys = keys[:count]
+	}
+	return keys
+}
+
+// slotKeysDatabase returns a database that holds keys of the slot, or -1 when the slot has no keys.
+func (server *SugarDB) slotKeysDatabase(slot int) int {
+	server.storeLock.RLock()
+	defer server.storeLock.RUnlock()
+
+	for database, store := range server.store {
+		for key := range store {
+			if sharding.KeySlot(key) == slot {
+				return database
+			}
+		}
+	}
+	return -1
+}
+
+// resolveShardID returns the id of the shard with the given id, or of the shard of the server with the given id.
+func (server *SugarDB) resolveShardID(id string) (string, bool) {
+	if _, ok := server.slotMap.Shard(id); ok {
+		return id, true
+	}
+	for _, meta := range server.memberList.NodeMetas() {
+		if meta.ShardID == id {
+			return id, true
+		}
+		if string(meta.ServerID) == id {
+			return meta.ShardID, true
+		}
+	}
+	return "", false
+}
+
+// setSlot changes the state of the slots in the record of the node's shard, and records the change in the raft log
+// of the shard with a higher epoch than any epoch known by the node.
+func (server *SugarDB) setSlot(slots []sharding.SlotRange, state string, id string) error {
+	if !server.isInCluster() {
+		return errClusterDisabled
+	}
+	if !server.raft.IsRaftLeader() {
+		return errors.New("SETSLOT must be sent to the leader of the shard")
+	}
+
+	local := server.config.ShardID
+	state = strings.ToUpper(state)
+	shardId := ""
+	if state != "STABLE" {
+		var ok bool
+		if shardId, ok = server.resolveShardID(id); !ok {
+			return fmt.Errorf("unknown shard or node %s", id)
+		}
+	}
+
+	shard := sharding.Shard{ID: local}
+	if record := server.getShard(); record != nil {
+		shard = *record
+	}
+	owned := sharding.ExpandSlotRanges(shard.Slots)
+	migrating := maps.Clone(shard.Migrating)
+	if migrating == nil {
+		migrating = make(map[int]string)
+	}
+	importing := maps.Clone(shard.Importing)
+	if importing == nil {
+		importing = make(map[int]string)
+	}
+
+	for _, slot := range sharding.ExpandSlotRanges(slots) {
+		switch state {
+		case "IMPORTING":
+			if shardId == local {
+				return fmt.Errorf("cannot import slot %d from the node's own shard", slot)
+			}
+			if server.slotMap.Owner(slot) == local {
+				return fmt.Errorf("slot %d is already served by this shard", slot)
+			}
+			importing[slot] = shardId
+		case "MIGRATING":
+			if shardId == local {
+				return fmt.Errorf("cannot migrate slot %d to the node's own shard", slot)
+			}
+			if !slices.Contains(owned, slot) {
+				return fmt.Errorf("slot %d is not served by this shard", slot)
+			}
+			migrating[slot] = shardId
+		case "NODE":
+			if shardId == local {
+				owned = append(owned, slot)
+			} else {
+				if database := server.slotKeysDatabase(slot); slices.Contains(owned, slot) && database != -1 {
+					return fmt.Errorf("slot %d still has keys in database %d", slot, database)
+				}
+				owned = slices.DeleteFunc(owned, func(s int) bool { return s == slot })
+			}
+			delete(importing, slot)
+			delete(migrating, slot)
+		case "STABLE":
+			delete(importing, slot)
+			delete(migrating, slot)
+		default:
+			return fmt.Errorf("invalid SETSLOT state %s", state)
+		}
+	}
+
+	shard.Slots = sharding.ToRanges(owned)
+	shard.Migrating, shard.Importing = nil, nil
+	if len(migrating) > 0 {
+		shard.Migrating = migrating
+	}
+	if len(importing) > 0 {
+		shard.Importing = importing
+	}
+	shard.Epoch = max(server.slotMap.MaxEpoch(), shard.Epoch) + 1
+	return server.raftApplyShard(shard, false)
+}
@@ -22,13 +22,18 @@ import (
 	"fmt"
 	"github.com/echovault/sugardb/internal"
 	"github.com/echovault/sugardb/internal/aof"
+	"github.com/echovault/sugardb/internal/audit"
+	"github.com/echovault/sugardb/internal/backup"
 	"github.com/echovault/sugardb/internal/clock"
 	"github.com/echovault/sugardb/internal/config"
 	"github.com/echovault/sugardb/internal/constants"
+	"github.com/echovault/sugardb/internal/encryption"
 	"github.com/echovault/sugardb/internal/eviction"
+	"github.com/echovault/sugardb/internal/forward"
 	"github.com/echovault/sugardb/internal/memberlist"
 	"github.com/echovault/sugardb/internal/modules/acl"
 	"github.com/echovault/sugardb/internal/modules/admin"
+	"github.com/echovault/sugardb/internal/modules/cluster"
 	"github.com/echovault/sugardb/internal/modules/connection"
 	"github.com/echovault/sugardb/internal/modules/generic"
 	"github.com/echovault/sugardb/internal/modules/hash"
@@ -38,11 +43,15 @@ import (
 	"github.com/echovault/sugardb/internal/modules/sorted_set"
 	str "github.com/echovault/sugardb/internal/modules/string"
 	"github.com/echovault/sugardb/internal/raft"
+	"github.com/echovault/sugardb/internal/replication"
+	"github.com/echovault/sugardb/internal/sharding"
 	"github.com/echovault/sugardb/internal/snapshot"
 	"io"
 	"log"
 	"net"
 	"os"
+	"slices"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -53,12 +62,17 @@ type SugarDB struct {
 	clock clock.Clock
 
 	// config holds the echovault configuration variables.
-	config config.Config
+	// The settings that can be reloaded are read with liveConfig and written while holding configMut.
+	config    config.Config
+	configMut sync.RWMutex
+	reloadMut sync.Mutex // Ensures only one reload is in progress at a time.
 
 	// The current index for the latest connection id.
 	// This number is incremented everytime there's a new connection and
 	// the new number is the new connection's ID.
 	connId atomic.Uint64
+	// The number of TCP connections refused by the client limits or the protected mode.
+	rejectedConnections atomic.Uint64
 
 	// connInfo holds the connection information for embedded and TCP clients.
 	// It keeps track of the protocol and database that each client is operating on.
@@ -104,26 +118,63 @@ type SugarDB struct {
 	// Holds the list of all commands supported by the echovault.
 	commandsRWMut sync.RWMutex
 	commands      []internal.Command
+	loadedModules []internal.LoadedModule // Modules loaded from dynamic libraries, guarded by commandsRWMut.
 
 	raft       *raft.Raft             // The raft replication layer for the echovault.
 	memberList *memberlist.MemberList // The memberlist layer for the echovault.
 
+	forwardServer *forward.Server // Receives the write commands forwarded by followers.
+	forwardClient *forward.Client // Forwards write commands to the leader when ForwardCommand is enabled.
+
+	slotMap        *sharding.SlotMap // The slots served by each shard of the cluster.
+	stopLeadership chan struct{}     // Channel that signals the leadership watcher goroutine to stop execution.
+
 	context context.Context
 
 	acl    *acl.ACL
 	pubSub *pubsub.PubSub
 
+	publishSequence atomic.Uint64   // The sequence number of the latest message published to the other cluster members.
+	recentPublishes *recentMessages // The ids of the latest messages received from the other cluster members.
+
 	snapshotInProgress         atomic.Bool      // Atomic boolean that's true when actively taking a snapshot.
 	rewriteAOFInProgress       atomic.Bool      // Atomic boolean that's true when actively rewriting AOF file is in progress.
-	stateCopyInProgress        atomic.Bool      // Atomic boolean that's true when actively copying state for snapshotting or preamble generation.
-	stateMutationInProgress    atomic.Bool      // Atomic boolean that is set to true when state mutation is in progress.
 	latestSnapshotMilliseconds atomic.Int64     // Unix epoch in milliseconds.
 	snapshotEngine             *snapshot.Engine // Snapshot engine for standalone mode.
 	aofEngine                  *aof.Engine      // AOF engine for standalone mode.
+	backupTarget               backup.Target    // Custom backup target passed with WithBackupTarget.
+	backupEngine               *backup.Engine   // Backup engine for standalone mode. Nil when there's no backup target.
+
+	auditHook func(event internal.AuditEvent) // Hook passed with WithAuditHook.
+	audit     *audit.Logger                   // Audit log of the administrative and dangerous commands.
+
+	// stateCapture tracks the copy-on-write state captures used for snapshots and AOF rewrites.
+	stateCapture struct {
+		// Write commands hold the read lock while executing. A capture holds the write lock
+		// only for as long as it takes to record the keyspace.
+		pause sync.RWMutex
+		// Mutex that guards the active captures and their pre-images.
+		mut sync.Mutex
+		// The captures that are currently being copied.
+		active []*stateCapture
+		// Metrics about the state captures.
+		count     atomic.Uint64 // Total number of completed captures.
+		lastPause atomic.Int64  // Time in nanoseconds that writes were paused during the latest capture.
+		lastCopy  atomic.Int64  // Time in nanoseconds it took to copy the latest capture.
+	}
 
-	listener atomic.Value  // Holds the TCP listener.
-	quit     chan struct{} // Channel that signals the closing of all client connections.
-	stopTTL  chan struct{} // Channel that signals the TTL sampling goroutine to stop execution.
+	// replication holds the primary-replica replication of standalone mode.
+	replication struct {
+		mut     sync.RWMutex
+		primary *replication.Primary // Streams the writes of this instance to its replicas.
+		replica *replication.Replica // Follows the primary of this instance. Nil when it's not a replica.
+	}
+
+	listener  atomic.Value               // Holds the TCP listener.
+	tlsConfig atomic.Pointer[tls.Config] // The TLS config used for new connections, replaced when the certificates are reloaded.
+	quit      chan struct{}              // Channel that signals the closing of all client connections.
+	stopTTL   chan struct{}              // Channel that signals the TTL sampling goroutine to stop execution.
+	stopWatch context.CancelFunc         // Stops the goroutine that watches the config files for changes.
 }
 
 // WithContext is an options that for the NewSugarDB function that allows you to
@@ -180,6 +231,7 @@ func NewSugarDB(options ...func(sugarDB *SugarDB)) (*SugarDB, error) {
 			var commands []internal.Command
 			commands = append(commands, acl.Commands()...)
 			commands = append(commands, admin.Commands()...)
+			commands = append(commands, cluster.Commands()...)
 			commands = append(commands, connection.Commands()...)
 			commands = append(commands, generic.Commands()...)
 			commands = append(commands, hash.Commands()...)
@@ -190,14 +242,59 @@ func NewSugarDB(options ...func(sugarDB *SugarDB)) (*SugarDB, error) {
 			commands = append(commands, str.Commands()...)
 			return commands
 		}(),
-		quit:    make(chan struct{}),
-		stopTTL: make(chan struct{}),
+		quit:            make(chan struct{}),
+		stopTTL:         make(chan struct{}),
+		slotMap:         sharding.NewSlotMap(),
+		stopLeadership:  make(chan struct{}),
+		recentPublishes: newRecentMessages(recentPublishesSize),
 	}
 
 	for _, option := range options {
 		option(sugarDB)
 	}
 
+	if sugarDB.config.ReadConsistency == "" {
+		sugarDB.config.ReadConsistency = constants.ReadConsistencyStale
+	}
+	if !isReadConsistency(sugarDB.config.ReadConsistency) {
+		return nil, fmt.Errorf("unsupported read consistency %q", sugarDB.config.ReadConsistency)
+	}
+	sugarDB.connInfo.embedded.ReadConsistency = sugarDB.config.ReadConsistency
+
+	if sugarDB.config.ShardID == "" {
+		sugarDB.config.ShardID = "0"
+	}
+	if sugarDB.config.Replica && sugarDB.config.BootstrapCluster {
+		return nil, errors.New("a replica cannot bootstrap the cluster")
+	}
+	if sugarDB.config.ReplicaOf != "" && sugarDB.isInCluster() {
+		return nil, errors.New("replica-of is only supported in standalone mode")
+	}
+	if sugarDB.isInCluster() && sugarDB.config.ClusterSecret == "" {
+		return nil, errors.New("cluster-secret must be provided in cluster mode")
+	}
+	if sugarDB.isInCluster() && sugarDB.config.BootstrapCluster {
+		if _, err := sharding.ParseSlotRanges(sugarDB.config.ShardSlots); err != nil {
+			return nil, fmt.Errorf("shard slots: %w", err)
+		}
+	}
+
+	// Rename and disable the commands as configured.
+	commands := sugarDB.commands
+	sugarDB.commands = make([]internal.Command, 0, len(commands))
+	for _, command := range commands {
+		command, ok := sugarDB.configureCommand(command)
+		if !ok {
+			continue
+		}
+		if slices.ContainsFunc(sugarDB.commands, func(c internal.Command) bool {
+			return strings.EqualFold(c.Command, command.Command)
+		}) {
+			return nil, fmt.Errorf("rename command: command %s already exists", command.Command)
+		}
+		sugarDB.commands = append(sugarDB.commands, command)
+	}
+
 	sugarDB.context = context.WithValue(
 		sugarDB.context, "ServerID",
 		internal.ContextServerID(sugarDB.config.ServerID),
@@ -205,22 +302,51 @@ func NewSugarDB(options ...func(sugarDB *SugarDB)) (*SugarDB, error) {
 
 	// Load .so modules from config
 	for _, path := range sugarDB.config.Modules {
-		if err := sugarDB.LoadModule(path); err != nil {
+		if err := sugarDB.loadModule(path); err != nil {
 			log.Printf("%s %v\n", path, err)
 			continue
 		}
 		log.Printf("loaded plugin %s\n", path)
 	}
 
+	// Load the keys used to encrypt the persistence files at rest.
+	encryptionKeys, err := encryption.LoadKeys(sugarDB.config.EncryptionKeyFile, sugarDB.config.EncryptionKeyEnv)
+	if err != nil {
+		return nil, err
+	}
+	cipher, err := encryption.NewCipher(encryptionKeys...)
+	if err != nil {
+		return nil, err
+	}
+	if sugarDB.config.EncryptionPlaintext {
+		cipher.AllowPlaintext()
+	}
+
+	// Set up the audit log
+	if sugarDB.audit, err = audit.NewLogger(
+		audit.WithClock(sugarDB.clock),
+		audit.WithPath(sugarDB.config.AuditLog),
+		audit.WithMaxSize(sugarDB.config.AuditLogMaxSize),
+		audit.WithMaxFiles(sugarDB.config.AuditLogMaxFiles),
+		audit.WithCategories(sugarDB.config.AuditLogCategories),
+		audit.WithCommands(sugarDB.config.AuditLogCommands),
+		audit.WithExcludeCommands(sugarDB.config.AuditLogExcludeCommands),
+		audit.WithHook(sugarDB.auditHook),
+		audit.WithOriginalCommand(sugarDB.originalCommand),
+	); err != nil {
+		return nil, fmt.Errorf("audit log: %w", err)
+	}
+
 	// Set up ACL module
-	sugarDB.acl = acl.NewACL(sugarDB.config)
+	sugarDB.acl = acl.NewACL(sugarDB.config, acl.WithKeyspace(sugarDB.storeLock.RLocker(), sugarDB.rangeKeyUsage))
 
 	// Set up Pub/Sub module
-	sugarDB.pubSub = pubsub.NewPubSub()
+	sugarDB.pubSub = pubsub.NewPubSub(pubsub.WithSubscriptionsChanged(sugarDB.subscriptionsChanged))
 
 	if sugarDB.isInCluster() {
 		sugarDB.raft = raft.NewRaft(raft.Opts{
 			Config:                sugarDB.config,
+			Cipher:                cipher,
 			GetCommand:            sugarDB.getCommand,
 			SetValues:             sugarDB.setValues,
 			SetExpiry:             sugarDB.setExpiry,
@@ -233,50 +359,101 @@ func NewSugarDB(options ...func(sugarDB *SugarDB)) (*SugarDB, error) {
 				defer sugarDB.storeLock.Unlock()
 				return sugarDB.deleteKey(ctx, key)
 			},
-			GetState: func() map[int]map[string]internal.KeyData {
-				state := make(map[int]map[string]internal.KeyData)
-				for database, store := range sugarDB.getState() {
-					for k, v := range store {
-						if data, ok := v.(internal.KeyData); ok {
-							state[database][k] = data
-						}
-					}
-				}
-				return state
-			},
+			GetState:    sugarDB.getState,
+			GetShard:    sugarDB.getShard,
+			SetShard:    sugarDB.setShard,
+			GetACLUsers: sugarDB.acl.MarshalUsers,
+			SetACLUsers: sugarDB.acl.RestoreUsers,
+			GetModules:  sugarDB.getModules,
+			SetModules:  sugarDB.setModules,
 		})
 		sugarDB.memberList = memberlist.NewMemberList(memberlist.Opts{
-			Config:           sugarDB.config,
-			HasJoinedCluster: sugarDB.raft.HasJoinedCluster,
-			AddVoter:         sugarDB.raft.AddVoter,
-			RemoveRaftServer: sugarDB.raft.RemoveServer,
-			IsRaftLeader:     sugarDB.raft.IsRaftLeader,
-			ApplyMutate:      sugarDB.raftApplyCommand,
-			ApplyDeleteKey:   sugarDB.raftApplyDeleteKey,
+			Config:              sugarDB.config,
+			HasJoinedCluster:    sugarDB.raft.HasJoinedCluster,
+			AddVoter:            sugarDB.raft.AddVoter,
+			AddNonvoter:         sugarDB.raft.AddNonvoter,
+			AddRaftServer:       sugarDB.raft.AddServer,
+			RemoveRaftServer:    sugarDB.raft.RemoveServer,
+			IsRaftLeader:        sugarDB.raft.IsRaftLeader,
+			ApplyMutate:         sugarDB.raftApplyCommand,
+			ApplyDeleteKey:      sugarDB.raftApplyDeleteKey,
+			GetShards:           sugarDB.getShards,
+			MergeShards:         sugarDB.mergeShards,
+			DeliverPublish:      sugarDB.deliverPublish,
+			GetSubscriptions:    sugarDB.getSubscriptions,
+			MergeSubscriptions:  sugarDB.mergeSubscriptions,
+			ForgetSubscriptions: sugarDB.forgetSubscriptions,
+		})
+		sugarDB.forwardServer = forward.NewServer(forward.ServerOpts{
+			Addr:               fmt.Sprintf("%s:%d", sugarDB.config.RaftBindAddr, sugarDB.config.ForwardPort),
+			Apply:              sugarDB.applyForwardedCommand,
+			ReadIndex:          sugarDB.readIndex,
+			CheckModule:        sugarDB.checkModule,
+			TransferLeadership: sugarDB.transferLeadership,
+			AddNode:            sugarDB.addNode,
+			RemoveNode:         sugarDB.removeNode,
+			PromoteNode:        sugarDB.promoteNode,
+			DemoteNode:         sugarDB.demoteNode,
+			Secret:             sugarDB.config.ClusterSecret,
+			Timeout:            sugarDB.config.ForwardTimeout,
+		})
+		sugarDB.forwardClient = forward.NewClient(forward.ClientOpts{
+			LeaderAddr: sugarDB.forwardLeaderAddr,
+			Timeout:    sugarDB.config.ForwardTimeout,
+			Secret:     sugarDB.config.ClusterSecret,
 		})
 	} else {
+		// Set up the backup engine and restore the backup before the snapshot and AOF engines open the files.
+		target, err := sugarDB.newBackupTarget()
+		if err != nil {
+			return nil, err
+		}
+		if target != nil {
+			sugarDB.backupEngine = backup.NewBackupEngine(
+				backup.WithClock(sugarDB.clock),
+				backup.WithDirectory(sugarDB.config.DataDir),
+				backup.WithTarget(target),
+				backup.WithInterval(sugarDB.config.BackupInterval),
+				backup.WithGetLatestSnapshotTimeFunc(sugarDB.getLatestSnapshotTime),
+				backup.WithReadAOFFunc(func() ([]byte, []byte, error) {
+					return sugarDB.aofEngine.ReadFiles()
+				}),
+			)
+			if sugarDB.config.RestoreBackup {
+				if err = sugarDB.backupEngine.Restore(sugarDB.context); err != nil {
+					return nil, err
+				}
+			}
+		}
+
 		// Set up standalone snapshot engine
 		sugarDB.snapshotEngine = snapshot.NewSnapshotEngine(
 			snapshot.WithClock(sugarDB.clock),
 			snapshot.WithDirectory(sugarDB.config.DataDir),
+			snapshot.WithExportDirectory(sugarDB.config.SnapshotExportDir),
+			snapshot.WithCipher(cipher),
 			snapshot.WithThreshold(sugarDB.config.SnapShotThreshold),
 			snapshot.WithInterval(sugarDB.config.SnapshotInterval),
+			snapshot.WithSaveRules(func() []snapshot.SaveRule {
+				rules := make([]snapshot.SaveRule, len(sugarDB.config.SaveRules))
+				for i, rule := range sugarDB.config.SaveRules {
+					rules[i] = snapshot.SaveRule{
+						Interval: time.Duration(rule.Seconds) * time.Second,
+						Changes:  rule.Changes,
+					}
+				}
+				return rules
+			}()...),
+			snapshot.WithRetention(snapshot.Retention{
+				Last:   int(sugarDB.config.SnapshotRetainLast),
+				Hourly: int(sugarDB.config.SnapshotRetainHourly),
+				Daily:  int(sugarDB.config.SnapshotRetainDaily),
+			}),
 			snapshot.WithStartSnapshotFunc(sugarDB.startSnapshot),
 			snapshot.WithFinishSnapshotFunc(sugarDB.finishSnapshot),
 			snapshot.WithSetLatestSnapshotTimeFunc(sugarDB.setLatestSnapshot),
 			snapshot.WithGetLatestSnapshotTimeFunc(sugarDB.getLatestSnapshotTime),
-			snapshot.WithGetStateFunc(func() map[int]map[string]internal.KeyData {
-				state := make(map[int]map[string]internal.KeyData)
-				for database, data := range sugarDB.getState() {
-					state[database] = make(map[string]internal.KeyData)
-					for key, value := range data {
-						if keyData, ok := value.(internal.KeyData); ok {
-							state[database][key] = keyData
-						}
-					}
-				}
-				return state
-			}),
+			snapshot.WithGetStateFunc(sugarDB.getState),
 			snapshot.WithSetKeyDataFunc(func(database int, key string, data internal.KeyData) {
 				ctx := context.WithValue(context.Background(), "Database", database)
 				if err := sugarDB.setValues(ctx, map[string]interface{}{key: data.Value}); err != nil {
@@ -291,20 +468,11 @@ func NewSugarDB(options ...func(sugarDB *SugarDB)) (*SugarDB, error) {
 			aof.WithClock(sugarDB.clock),
 			aof.WithDirectory(sugarDB.config.DataDir),
 			aof.WithStrategy(sugarDB.config.AOFSyncStrategy),
+			aof.WithCipher(cipher),
 			aof.WithStartRewriteFunc(sugarDB.startRewriteAOF),
 			aof.WithFinishRewriteFunc(sugarDB.finishRewriteAOF),
-			aof.WithGetStateFunc(func() map[int]map[string]internal.KeyData {
-				state := make(map[int]map[string]internal.KeyData)
-				for database, data := range sugarDB.getState() {
-					state[database] = make(map[string]internal.KeyData)
-					for key, value := range data {
-						if keyData, ok := value.(internal.KeyData); ok {
-							state[database][key] = keyData
-						}
-					}
-				}
-				return state
-			}),
+			aof.WithGetStateFunc(sugarDB.getState),
+			aof.WithCaptureStateFunc(sugarDB.captureState),
 			aof.WithSetKeyDataFunc(func(database int, key string, value internal.KeyData) {
 				ctx := context.WithValue(context.Background(), "Database", database)
 				if err := sugarDB.setValues(ctx, map[string]interface{}{key: value.Value}); err != nil {
@@ -325,55 +493,89 @@ func NewSugarDB(options ...func(sugarDB *SugarDB)) (*SugarDB, error) {
 			return nil, err
 		}
 		sugarDB.aofEngine = aofEngine
+
+		// Set up the replication stream for the replicas of this instance.
+		sugarDB.replication.primary = replication.NewPrimary(replication.PrimaryOpts{
+			BacklogSize:  int(sugarDB.config.ReplBacklogSize),
+			CaptureState: sugarDB.captureState,
+		})
 	}
 
-	// If eviction policy is not noeviction, start a goroutine to evict keys at the configured interval.
-	if sugarDB.config.EvictionPolicy != constants.NoEviction {
-		go func() {
-			ticker := time.NewTicker(sugarDB.config.EvictionInterval)
-			defer func() {
-				ticker.Stop()
-			}()
-			for {
-				select {
-				case <-ticker.C:
-					// Run key eviction for each database that has volatile keys.
-					wg := sync.WaitGroup{}
-					for database, _ := range sugarDB.keysWithExpiry.keys {
-						wg.Add(1)
-						ctx := context.WithValue(context.Background(), "Database", database)
-						go func(ctx context.Context, wg *sync.WaitGroup) {
-							if err := sugarDB.evictKeysWithExpiredTTL(ctx); err != nil {
-								log.Printf("evict with ttl: %v\n", err)
-							}
-							wg.Done()
-						}(ctx, &wg)
-					}
-					wg.Wait()
-				case <-sugarDB.stopTTL:
-					break
+	// Start a goroutine to evict keys at the configured interval. Keys are only evicted when the eviction policy
+	// is not noeviction. The policy and interval are read on every tick as they can be changed by a reload.
+	go func() {
+		interval := evictionInterval(sugarDB.liveConfig())
+		ticker := time.NewTicker(interval)
+		defer func() {
+			ticker.Stop()
+		}()
+		for {
+			select {
+			case <-ticker.C:
+				conf := sugarDB.liveConfig()
+				if evictionInterval(conf) != interval {
+					interval = evictionInterval(conf)
+					ticker.Reset(interval)
+				}
+				if conf.EvictionPolicy == constants.NoEviction {
+					continue
+				}
+				// Run key eviction for each database that has volatile keys.
+				sugarDB.keysWithExpiry.rwMutex.RLock()
+				databases := make([]int, 0, len(sugarDB.keysWithExpiry.keys))
+				for database, _ := range sugarDB.keysWithExpiry.keys {
+					databases = append(databases, database)
 				}
+				sugarDB.keysWithExpiry.rwMutex.RUnlock()
+				wg := sync.WaitGroup{}
+				for _, database := range databases {
+					wg.Add(1)
+					ctx := context.WithValue(context.Background(), "Database", database)
+					go func(ctx context.Context, wg *sync.WaitGroup) {
+						if err := sugarDB.evictKeysWithExpiredTTL(ctx); err != nil {
+							log.Printf("evict with ttl: %v\n", err)
+						}
+						wg.Done()
+					}(ctx, &wg)
+				}
+				wg.Wait()
+			case <-sugarDB.stopTTL:
+				return
 			}
-		}()
-	}
+		}
+	}()
 
 	if sugarDB.config.TLS && len(sugarDB.config.CertKeyPairs) <= 0 {
 		return nil, errors.New("must provide certificate and key file paths for TLS mode")
 	}
 
 	if sugarDB.isInCluster() {
+		// Start listening for forwarded commands before joining the cluster
+		// so that the node can accept them as soon as it's elected leader.
+		if err := sugarDB.forwardServer.Start(); err != nil {
+			return nil, err
+		}
 		// Initialise raft and memberlist
 		sugarDB.raft.RaftInit(sugarDB.context)
 		sugarDB.memberList.MemberListInit(sugarDB.context)
+		go sugarDB.watchLeadership()
 		// Initialise caches
 		sugarDB.initialiseCaches()
 	}
 
+	if sugarDB.isInCluster() && (sugarDB.config.BackupTarget != "" || sugarDB.backupTarget != nil) {
+		log.Println("backup targets are only supported in standalone mode, skipping backups")
+	}
+
 	if !sugarDB.isInCluster() {
 		sugarDB.initialiseCaches()
 		// Restore from AOF by default if it's enabled
 		if sugarDB.config.RestoreAOF {
 			err := sugarDB.aofEngine.Restore()
+			if isEncryptionError(err) {
+				sugarDB.aofEngine.Close()
+				return nil, err
+			}
 			if err != nil {
 				log.Println(err)
 			}
@@ -382,20 +584,56 @@ func NewSugarDB(options ...func(sugarDB *SugarDB)) (*SugarDB, error) {
 		// Restore from snapshot if snapshot restore is enabled and AOF restore is disabled
 		if sugarDB.config.RestoreSnapshot && !sugarDB.config.RestoreAOF {
 			err := sugarDB.snapshotEngine.Restore()
+			if isEncryptionError(err) {
+				sugarDB.aofEngine.Close()
+				return nil, err
+			}
 			if err != nil {
 				log.Println(err)
 			}
 		}
+
+		if sugarDB.backupEngine != nil {
+			sugarDB.backupEngine.Start()
+		}
+
+		if sugarDB.config.ReplicaOf != "" {
+			if err = sugarDB.replicaOf(sugarDB.config.ReplicaOf); err != nil {
+				return nil, err
+			}
+		}
 	}
 
+	// Reload the config when the config file, the ACL file or the TLS certificates change.
+	var watchCtx context.Context
+	watchCtx, sugarDB.stopWatch = context.WithCancel(context.Background())
+	go sugarDB.watchConfig(watchCtx)
+
 	return sugarDB, nil
 }
 
+// evictionInterval returns the interval between each sampling of keys to evict,
+// or the default interval if the configured one is not positive.
+func evictionInterval(conf config.Config) time.Duration {
+	if conf.EvictionInterval <= 0 {
+		return 100 * time.Millisecond
+	}
+	return conf.EvictionInterval
+}
+
+// isEncryptionError returns true if the error was caused by a missing or wrong encryption key.
+// These errors stop SugarDB from starting, as the data on disk cannot be read with the configured keys.
+func isEncryptionError(err error) bool {
+	return errors.Is(err, encryption.ErrNoKey) || errors.Is(err, encryption.ErrWrongKey)
+}
+
 func (server *SugarDB) startTCP() {
-	conf := server.config
+	conf := server.liveConfig()
 
+	// The keepalive of each connection is set by handleConnection, so that reloads of TCPKeepAlive apply to new
+	// connections.
 	listenConfig := net.ListenConfig{
-		KeepAlive: 200 * time.Millisecond,
+		KeepAlive: -1,
 	}
 
 	listener, err := listenConfig.Listen(
@@ -421,44 +659,26 @@ func (server *SugarDB) startTCP() {
 			log.Printf("Starting TLS server at Address %s, Port %d...\n", conf.BindAddr, conf.Port)
 		}
 
-		var certificates []tls.Certificate
-		for _, certKeyPair := range conf.CertKeyPairs {
-			c, err := tls.LoadX509KeyPair(certKeyPair[0], certKeyPair[1])
-			if err != nil {
-				log.Printf("load cert key pair: %v\n", err)
-				return
-			}
-			certificates = append(certificates, c)
-		}
-
-		clientAuth := tls.NoClientCert
-		clientCerts := x509.NewCertPool()
-
-		if conf.MTLS {
-			clientAuth = tls.RequireAndVerifyClientCert
-			for _, c := range conf.ClientCAs {
-				ca, err := os.Open(c)
-				if err != nil {
-					log.Printf("client cert open: %v\n", err)
-					return
-				}
-				certBytes, err := io.ReadAll(ca)
-				if err != nil {
-					log.Printf("client cert read: %v\n", err)
-				}
-				if ok := clientCerts.AppendCertsFromPEM(certBytes); !ok {
-					log.Printf("client cert append: %v\n", err)
-				}
-			}
+		tlsConfig, err := loadTLSConfig(conf)
+		if err != nil {
+			log.Println(err)
+			return
 		}
+		server.tlsConfig.Store(tlsConfig)
 
+		// Each connection uses the latest TLS config so that reloaded certificates apply to new connections.
 		listener = tls.NewListener(listener, &tls.Config{
-			Certificates: certificates,
-			ClientAuth:   clientAuth,
-			ClientCAs:    clientCerts,
+			GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+				return server.tlsConfig.Load(), nil
+			},
 		})
 	}
 
+	if conf.ProtectedMode && !server.authenticationConfigured(conf) && !isLoopback(net.JoinHostPort(conf.BindAddr, "0")) {
+		log.Printf("WARNING: protected mode is enabled and no authentication is configured. " +
+			"Only connections from the loopback interface will be accepted.\n")
+	}
+
 	server.listener.Store(listener)
 
 	// Listen to connection.
@@ -478,30 +698,91 @@ func (server *SugarDB) startTCP() {
 	}
 }
 
+// loadTLSConfig loads the certificates and the client certificate authorities of the config.
+func loadTLSConfig(conf config.Config) (*tls.Config, error) {
+	var certificates []tls.Certificate
+	for _, certKeyPair := range conf.CertKeyPairs {
+		c, err := tls.LoadX509KeyPair(certKeyPair[0], certKeyPair[1])
+		if err != nil {
+			return nil, fmt.Errorf("load cert key pair: %v", err)
+		}
+		certificates = append(certificates, c)
+	}
+
+	clientAuth := tls.NoClientCert
+	clientCerts := x509.NewCertPool()
+
+	if conf.MTLS {
+		clientAuth = tls.RequireAndVerifyClientCert
+		for _, c := range conf.ClientCAs {
+			ca, err := os.Open(c)
+			if err != nil {
+				return nil, fmt.Errorf("client cert open: %v", err)
+			}
+			certBytes, err := io.ReadAll(ca)
+			_ = ca.Close()
+			if err != nil {
+				log.Printf("client cert read: %v\n", err)
+			}
+			if ok := clientCerts.AppendCertsFromPEM(certBytes); !ok {
+				log.Printf("client cert append: %v\n", err)
+			}
+		}
+	}
+
+	return &tls.Config{
+		Certificates: certificates,
+		ClientAuth:   clientAuth,
+		ClientCAs:    clientCerts,
+	}, nil
+}
+
 func (server *SugarDB) handleConnection(conn net.Conn) {
+	// Generate connection ID
+	cid := server.connId.Add(1)
+
+	if err := setKeepAlive(conn, server.liveConfig().TCPKeepAlive); err != nil {
+		log.Printf("set keepalive: %v\n", err)
+	}
+
+	// Set the default connection information, refusing the connection if it exceeds the client limits.
+	if err := server.registerConnection(&conn, cid); err != nil {
+		server.rejectedConnections.Add(1)
+		log.Printf("refused connection %d from %s: %v\n", cid, conn.RemoteAddr(), err)
+		_ = conn.SetWriteDeadline(time.Now().Add(time.Second))
+		_, _ = conn.Write([]byte(fmt.Sprintf("-%s\r\n", err.Error())))
+		if err = conn.Close(); err != nil {
+			log.Println(err)
+		}
+		return
+	}
+
 	// If ACL module is loaded, register the connection with the ACL
 	if server.acl != nil {
-		server.acl.RegisterConnection(&conn)
+		if err := server.acl.RegisterConnection(&conn); err != nil {
+			log.Printf("register connection: %v\n", err)
+			server.unregisterConnection(&conn)
+			_, _ = conn.Write([]byte(fmt.Sprintf("-Error %s\r\n", err.Error())))
+			if err = conn.Close(); err != nil {
+				log.Println(err)
+			}
+			return
+		}
 	}
 
 	w, r := io.Writer(conn), io.Reader(conn)
 
-	// Generate connection ID
-	cid := server.connId.Add(1)
 	ctx := context.WithValue(server.context, internal.ContextConnID("ConnectionID"),
 		fmt.Sprintf("%s-%d", server.context.Value(internal.ContextServerID("ServerID")), cid))
 
-	// Set the default connection information
-	server.connInfo.mut.Lock()
-	server.connInfo.tcpClients[&conn] = internal.ConnectionInfo{
-		Id:       cid,
-		Name:     "",
-		Protocol: 2,
-		Database: 0,
-	}
-	server.connInfo.mut.Unlock()
-
 	defer func() {
+		if server.replication.primary != nil {
+			server.replication.primary.Disconnect(&conn)
+		}
+		if server.acl != nil {
+			server.acl.UnregisterConnection(&conn)
+		}
+		server.unregisterConnection(&conn)
 		log.Printf("closing connection %d...", cid)
 		if err := conn.Close(); err != nil {
 			log.Println(err)
@@ -509,8 +790,26 @@ func (server *SugarDB) handleConnection(conn net.Conn) {
 	}()
 
 	for {
+		// Disconnect the client if it's idle for longer than the timeout.
+		if err := conn.SetReadDeadline(server.idleDeadline(&conn)); err != nil {
+			log.Println(err)
+		}
+		// The ACL terminates a connection with a read deadline in the past, which the idle deadline overrides
+		// if the connection was terminated while its command was running. Checking after the deadline is set
+		// ensures that a termination is never missed.
+		if server.acl != nil && server.acl.Terminated(&conn) {
+			break
+		}
+
 		message, err := internal.ReadMessage(r)
 
+		if err != nil && errors.Is(err, os.ErrDeadlineExceeded) {
+			if server.acl == nil || !server.acl.Terminated(&conn) {
+				log.Printf("closing idle connection %d\n", cid)
+			}
+			break
+		}
+
 		if err != nil && errors.Is(err, io.EOF) {
 			// Connection closed
 			log.Println(err)
@@ -526,14 +825,32 @@ func (server *SugarDB) handleConnection(conn net.Conn) {
 		if err != nil && errors.Is(err, io.EOF) {
 			break
 		}
+		// After PSYNC, the connection belongs to the replication stream.
+		if server.replication.primary != nil && server.replication.primary.Linked(&conn) {
+			server.serveReplica(&conn, r)
+			break
+		}
 		if err != nil {
 			log.Println(err)
-			if _, err = w.Write([]byte(fmt.Sprintf("-Error %s\r\n", err.Error()))); err != nil {
+			// Cluster errors such as MOVED are sent as is, so that cluster clients can act on them.
+			format := "-Error %s\r\n"
+			if sharding.IsError(err) {
+				format = "-%s\r\n"
+			}
+			n, err := w.Write([]byte(fmt.Sprintf(format, err.Error())))
+			if err != nil {
 				log.Println(err)
 			}
+			if server.acl != nil {
+				server.acl.RecordBytesOut(&conn, n)
+			}
 			continue
 		}
 
+		if server.acl != nil {
+			server.acl.RecordBytesOut(&conn, len(res))
+		}
+
 		chunkSize := 1024
 
 		// If the length of the response is 0, return nothing to the client.
@@ -576,9 +893,28 @@ func (server *SugarDB) Start() {
 }
 
 // takeSnapshot triggers a snapshot when called.
+// In standalone mode, the snapshot is taken before returning so that any error is reported to the caller.
+// In cluster mode, the snapshot is taken by the raft layer in the background.
 func (server *SugarDB) takeSnapshot() error {
 	if server.snapshotInProgress.Load() {
-		return errors.New("snapshot already in progress")
+		return snapshot.ErrSnapshotInProgress
+	}
+
+	if !server.isInCluster() {
+		if err := server.snapshotEngine.TakeSnapshot(); err != nil && !errors.Is(err, snapshot.ErrNothingToSnapshot) {
+			return err
+		}
+		return nil
+	}
+
+	return server.bgSave()
+}
+
+// bgSave triggers a snapshot in the background.
+// The outcome of the snapshot is reported in the persistence section of the server info.
+func (server *SugarDB) bgSave() error {
+	if server.snapshotInProgress.Load() {
+		return snapshot.ErrSnapshotInProgress
 	}
 
 	go func() {
@@ -598,6 +934,81 @@ func (server *SugarDB) takeSnapshot() error {
 	return nil
 }
 
+// listSnapshots returns the information about the snapshots on disk when running in standalone mode.
+func (server *SugarDB) listSnapshots() ([]internal.SnapshotInfo, error) {
+	if server.isInCluster() {
+		return nil, errors.New("snapshot listing is only supported in standalone mode")
+	}
+	return server.snapshotEngine.List()
+}
+
+// restoreSnapshot restores the snapshot with the given id into the running instance.
+// When database is -1, all the databases are replaced with the databases in the snapshot.
+// Otherwise, only the target database is replaced with the given database from the snapshot.
+// The AOF file is rewritten after the restore so that it reflects the restored state.
+func (server *SugarDB) restoreSnapshot(id int64, database int, target int) error {
+	if server.isInCluster() {
+		return errors.New("snapshot restore is only supported in standalone mode")
+	}
+
+	snapshotObject, err := server.snapshotEngine.Load(id)
+	if err != nil {
+		return err
+	}
+
+	state := snapshotObject.State
+	if database != -1 {
+		data, ok := state[database]
+		if !ok {
+			return fmt.Errorf("database %d not found in snapshot %d", database, id)
+		}
+		state = map[int]map[string]internal.KeyData{target: data}
+	}
+
+	// Pause write commands until the restore is complete.
+	server.stateCapture.pause.Lock()
+	defer server.stateCapture.pause.Unlock()
+
+	// Clear the databases that will be replaced.
+	if database == -1 {
+		server.Flush(-1)
+	} else {
+		server.storeLock.Lock()
+		if server.store[target] == nil {
+			server.createDatabase(target)
+		}
+		server.storeLock.Unlock()
+		server.Flush(target)
+	}
+
+	for db, data := range state {
+		ctx := context.WithValue(context.Background(), "Database", db)
+		for key, keyData := range data {
+			if err = server.setValues(ctx, map[string]interface{}{key: keyData.Value}); err != nil {
+				return err
+			}
+			if keyData.ExpireAt != (time.Time{}) {
+				server.setExpiry(ctx, key, keyData.ExpireAt, false)
+			}
+		}
+	}
+
+	// Rewrite the AOF file in the background once writes have resumed.
+	if err = server.bgRewriteAOF(); err != nil {
+		log.Printf("restore snapshot: rewrite aof error: %+v\n", err)
+	}
+
+	return nil
+}
+
+// exportSnapshot writes a database from the snapshot with the given id to a file.
+func (server *SugarDB) exportSnapshot(id int64, database int, path string) error {
+	if server.isInCluster() {
+		return errors.New("snapshot export is only supported in standalone mode")
+	}
+	return server.snapshotEngine.Export(id, database, path)
+}
+
 func (server *SugarDB) startSnapshot() {
 	server.snapshotInProgress.Store(true)
 }
@@ -625,7 +1036,9 @@ func (server *SugarDB) finishRewriteAOF() {
 
 // rewriteAOF triggers an AOF compaction when running in standalone mode.
 func (server *SugarDB) rewriteAOF() error {
-	if server.rewriteAOFInProgress.Load() {
+	// The flag is set here, so that two concurrent calls can't both start a rewrite.
+	// RewriteLog clears it when it's done.
+	if !server.rewriteAOFInProgress.CompareAndSwap(false, true) {
 		return errors.New("aof rewrite in progress")
 	}
 	if err := server.aofEngine.RewriteLog(); err != nil {
@@ -634,9 +1047,31 @@ func (server *SugarDB) rewriteAOF() error {
 	return nil
 }
 
+// bgRewriteAOF triggers an AOF compaction in the background when running in standalone mode.
+// Write commands are only paused while the keyspace is recorded, not for the whole rewrite.
+func (server *SugarDB) bgRewriteAOF() error {
+	if server.isInCluster() {
+		return errors.New("aof rewrite is not supported in cluster mode")
+	}
+	// The flag is set before the rewrite starts in the background, so that two concurrent calls can't both
+	// start a rewrite. RewriteLog clears it when it's done.
+	if !server.rewriteAOFInProgress.CompareAndSwap(false, true) {
+		return errors.New("aof rewrite in progress")
+	}
+	go func() {
+		if err := server.aofEngine.RewriteLog(); err != nil {
+			log.Println(err)
+		}
+	}()
+	return nil
+}
+
 // ShutDown gracefully shuts down the SugarDB instance.
 // This function shuts down the memberlist and raft layers.
 func (server *SugarDB) ShutDown() {
+	if server.stopWatch != nil {
+		server.stopWatch()
+	}
 	if server.listener.Load() != nil {
 		go func() { server.quit <- struct{}{} }()
 		go func() { server.stopTTL <- struct{}{} }()
@@ -646,11 +1081,23 @@ func (server *SugarDB) ShutDown() {
 		}
 	}
 	if !server.isInCluster() {
+		if err := server.replicaOf(""); err != nil {
+			log.Println(err)
+		}
+		server.replication.primary.Close()
+		if server.backupEngine != nil {
+			server.backupEngine.Stop()
+		}
 		server.aofEngine.Close()
 	}
 	if server.isInCluster() {
+		close(server.stopLeadership)
 		server.raft.RaftShutdown()
 		server.memberList.MemberListShutdown()
+		server.forwardServer.Shutdown()
+	}
+	if err := server.audit.Close(); err != nil {
+		log.Printf("audit log close: %v\n", err)
 	}
 }
 
@@ -19,18 +19,26 @@ import (
 	"context"
 	"crypto/tls"
 	"crypto/x509"
+	"errors"
 	"fmt"
 	"github.com/echovault/sugardb/internal"
 	"github.com/echovault/sugardb/internal/clock"
 	"github.com/echovault/sugardb/internal/config"
 	"github.com/echovault/sugardb/internal/constants"
+	"github.com/echovault/sugardb/internal/encryption"
+	"github.com/echovault/sugardb/internal/sharding"
 	"github.com/go-test/deep"
 	"github.com/tidwall/resp"
 	"io"
+	"io/fs"
 	"math"
 	"net"
 	"os"
 	"path"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
 	"testing"
@@ -90,6 +98,7 @@ func setupServer(
 	conf.ServerID = serverId
 	conf.DiscoveryPort = uint16(discoveryPort)
 	conf.BootstrapCluster = bootstrapCluster
+	conf.ClusterSecret = "cluster-secret"
 	conf.EvictionPolicy = constants.NoEviction
 
 	return NewSugarDB(
@@ -354,33 +363,35 @@ func Test_Cluster(t *testing.T) {
 			}
 		}
 
-		// Delete the key on the leader node
-		// 1. Prepare delete command.
-		command := []resp.Value{resp.StringValue("DEL")}
+		// Delete the keys on the leader node
+		// 1. Send a delete command for each key, as the keys are in different slots.
+		deleted := 0
 		for _, test := range tests {
-			command = append(command, resp.StringValue(test.key))
-		}
-		// 2. Send delete command.
-		if err := nodes[0].client.WriteArray(command); err != nil {
-			t.Error(err)
-			return
-		}
-		res, _, err := nodes[0].client.ReadValue()
-		if err != nil {
-			t.Error(err)
-			return
+			if err := nodes[0].client.WriteArray([]resp.Value{
+				resp.StringValue("DEL"),
+				resp.StringValue(test.key),
+			}); err != nil {
+				t.Error(err)
+				return
+			}
+			res, _, err := nodes[0].client.ReadValue()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			deleted += res.Integer()
 		}
 
-		// 3. Check the delete count is equal to length of tests.
-		if res.Integer() != len(tests) {
-			t.Errorf("expected delete response to be %d, got %d", len(tests), res.Integer())
+		// 2. Check the delete count is equal to length of tests.
+		if deleted != len(tests) {
+			t.Errorf("expected delete response to be %d, got %d", len(tests), deleted)
 		}
 
 		// Yield
 		ticker.Reset(200 * time.Millisecond)
 		<-ticker.C
 
-		// 4. Check if the data is absent in quorum (majority of the cluster).
+		// 3. Check if the data is absent in quorum (majority of the cluster).
 		for i, test := range tests {
 			count := 0
 			for j := 0; j < len(nodes); j++ {
@@ -399,7 +410,7 @@ func Test_Cluster(t *testing.T) {
 					count += 1 // If the expected value is found, increment the count.
 				}
 			}
-			// 5. Fail if count is less than quorum.
+			// 4. Fail if count is less than quorum.
 			if count < quorum {
 				t.Errorf("could not find value %s at key %s in cluster quorum", test.value, test.key)
 			}
@@ -571,6 +582,131 @@ func Test_Cluster(t *testing.T) {
 		}
 	})
 
+	t.Run("Test_ForwardCommandReply", func(t *testing.T) {
+		// The follower returns the reply or error from the leader once the command is applied.
+		node := nodes[1]
+		tests := []struct {
+			name          string
+			command       []string
+			expectedValue string
+			expectedErr   string
+		}{
+			{
+				name:        "1. Return the error returned by the leader",
+				command:     []string{"LPUSHX", "forward-list", "value1"},
+				expectedErr: "LPUSHX command on non-existent key",
+			},
+			{
+				name:          "2. Return the reply returned by the leader",
+				command:       []string{"LPUSH", "forward-list", "value1", "value2"},
+				expectedValue: "2",
+			},
+			{
+				name:          "3. Return the reply of a command that depends on the previous command",
+				command:       []string{"LPUSHX", "forward-list", "value3"},
+				expectedValue: "3",
+			},
+		}
+
+		for _, test := range tests {
+			t.Run(test.name, func(t *testing.T) {
+				command := make([]resp.Value, len(test.command))
+				for i, arg := range test.command {
+					command[i] = resp.StringValue(arg)
+				}
+				if err := node.client.WriteArray(command); err != nil {
+					t.Error(err)
+					return
+				}
+				res, _, err := node.client.ReadValue()
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if test.expectedErr != "" {
+					if res.Error() == nil || !strings.Contains(res.Error().Error(), test.expectedErr) {
+						t.Errorf("expected error \"%s\", got %v", test.expectedErr, res)
+					}
+					return
+				}
+				if res.String() != test.expectedValue {
+					t.Errorf("expected response \"%s\", got \"%s\"", test.expectedValue, res.String())
+				}
+			})
+		}
+	})
+
+	t.Run("Test_ReadConsistency", func(t *testing.T) {
+		// Reads on a node observe the writes acknowledged by the leader before the read.
+		tests := []struct {
+			name        string
+			node        int
+			consistency string
+		}{
+			{name: "1. Linearizable reads on a follower", node: 2, consistency: "linearizable"},
+			{name: "2. Lease reads on a follower", node: 3, consistency: "lease"},
+			{name: "3. Linearizable reads on the leader", node: 0, consistency: "linearizable"},
+		}
+
+		for _, test := range tests {
+			t.Run(test.name, func(t *testing.T) {
+				reader := nodes[test.node]
+				if err := reader.client.WriteArray([]resp.Value{
+					resp.StringValue("READCONSISTENCY"),
+					resp.StringValue(test.consistency),
+				}); err != nil {
+					t.Error(err)
+					return
+				}
+				if res, _, err := reader.client.ReadValue(); err != nil || !strings.EqualFold(res.String(), "ok") {
+					t.Errorf("expected OK response when setting read consistency, got %v (%v)", res, err)
+					return
+				}
+				t.Cleanup(func() {
+					_ = reader.client.WriteArray([]resp.Value{
+						resp.StringValue("READCONSISTENCY"),
+						resp.StringValue("stale"),
+					})
+					_, _, _ = reader.client.ReadValue()
+				})
+
+				for i := 0; i < 20; i++ {
+					key := fmt.Sprintf("read-consistency-%d-%d", test.node, i)
+					value := fmt.Sprintf("value-%d", i)
+					if err := nodes[0].client.WriteArray([]resp.Value{
+						resp.StringValue("SET"),
+						resp.StringValue(key),
+						resp.StringValue(value),
+					}); err != nil {
+						t.Error(err)
+						return
+					}
+					if _, _, err := nodes[0].client.ReadValue(); err != nil {
+						t.Error(err)
+						return
+					}
+
+					if err := reader.client.WriteArray([]resp.Value{
+						resp.StringValue("GET"),
+						resp.StringValue(key),
+					}); err != nil {
+						t.Error(err)
+						return
+					}
+					res, _, err := reader.client.ReadValue()
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					if res.String() != value {
+						t.Errorf("expected value \"%s\" at key \"%s\", got \"%s\"", value, key, res.String())
+						return
+					}
+				}
+			})
+		}
+	})
+
 	t.Run("Test_NotLeaderError", func(t *testing.T) {
 		node := nodes[len(nodes)-1]
 		err := node.client.WriteArray([]resp.Value{
@@ -601,65 +737,1264 @@ func Test_Cluster(t *testing.T) {
 		// TODO: Implement test for evicting expired keys on the cluster.
 	})
 
-	t.Run("Test_GetServerInfo", func(t *testing.T) {
-		nodeInfo := []internal.ServerInfo{
-			{
-				Server:     "sugardb",
-				Version:    constants.Version,
-				Id:         nodes[0].serverId,
-				Mode:       "cluster",
-				Role:       "master",
-				Modules:    nodes[0].server.ListModules(),
-				MemoryUsed: nodes[0].server.memUsed,
-				MaxMemory:  nodes[0].server.config.MaxMemory,
-			},
-			{
-				Server:     "sugardb",
-				Version:    constants.Version,
-				Id:         nodes[1].serverId,
-				Mode:       "cluster",
-				Role:       "replica",
-				Modules:    nodes[1].server.ListModules(),
-				MemoryUsed: nodes[1].server.memUsed,
-				MaxMemory:  nodes[1].server.config.MaxMemory,
-			},
-			{
-				Server:     "sugardb",
-				Version:    constants.Version,
-				Id:         nodes[2].serverId,
-				Mode:       "cluster",
-				Role:       "replica",
-				Modules:    nodes[2].server.ListModules(),
-				MemoryUsed: nodes[2].server.memUsed,
-				MaxMemory:  nodes[2].server.config.MaxMemory,
-			},
-			{
-				Server:     "sugardb",
-				Version:    constants.Version,
-				Id:         nodes[3].serverId,
-				Mode:       "cluster",
-				Role:       "replica",
-				Modules:    nodes[3].server.ListModules(),
-				MemoryUsed: nodes[3].server.memUsed,
-				MaxMemory:  nodes[3].server.config.MaxMemory,
-			},
-			{
-				Server:     "sugardb",
-				Version:    constants.Version,
-				Id:         nodes[4].serverId,
-				Mode:       "cluster",
-				Role:       "replica",
-				Modules:    nodes[4].server.ListModules(),
-				MemoryUsed: nodes[4].server.memUsed,
-				MaxMemory:  nodes[4].server.config.MaxMemory,
-			},
+	t.Run("Test_GetServerInfo", func(t *testing.T) {
+		// Each node has the connection of its test client.
+		wantClients := internal.ClientsInfo{
+			Connected:     1,
+			MaxClients:    10000,
+			TCPKeepAlive:  300 * time.Second,
+			ProtectedMode: true,
+		}
+		// The connections of the previous tests are unregistered once the nodes see them close.
+		for i := 0; i < len(nodes); i++ {
+			deadline := time.Now().Add(5 * time.Second)
+			for nodes[i].server.GetServerInfo().Clients.Connected != wantClients.Connected && time.Now().Before(deadline) {
+				time.Sleep(50 * time.Millisecond)
+			}
+		}
+		nodeInfo := []internal.ServerInfo{
+			{
+				Server:     "sugardb",
+				Version:    constants.Version,
+				Id:         nodes[0].serverId,
+				Mode:       "cluster",
+				Role:       "master",
+				Modules:    nodes[0].server.ListModules(),
+				MemoryUsed: nodes[0].server.memUsed,
+				MaxMemory:  nodes[0].server.config.MaxMemory,
+				Clients:    wantClients,
+			},
+			{
+				Server:     "sugardb",
+				Version:    constants.Version,
+				Id:         nodes[1].serverId,
+				Mode:       "cluster",
+				Role:       "replica",
+				Modules:    nodes[1].server.ListModules(),
+				MemoryUsed: nodes[1].server.memUsed,
+				MaxMemory:  nodes[1].server.config.MaxMemory,
+				Clients:    wantClients,
+			},
+			{
+				Server:     "sugardb",
+				Version:    constants.Version,
+				Id:         nodes[2].serverId,
+				Mode:       "cluster",
+				Role:       "replica",
+				Modules:    nodes[2].server.ListModules(),
+				MemoryUsed: nodes[2].server.memUsed,
+				MaxMemory:  nodes[2].server.config.MaxMemory,
+				Clients:    wantClients,
+			},
+			{
+				Server:     "sugardb",
+				Version:    constants.Version,
+				Id:         nodes[3].serverId,
+				Mode:       "cluster",
+				Role:       "replica",
+				Modules:    nodes[3].server.ListModules(),
+				MemoryUsed: nodes[3].server.memUsed,
+				MaxMemory:  nodes[3].server.config.MaxMemory,
+				Clients:    wantClients,
+			},
+			{
+				Server:     "sugardb",
+				Version:    constants.Version,
+				Id:         nodes[4].serverId,
+				Mode:       "cluster",
+				Role:       "replica",
+				Modules:    nodes[4].server.ListModules(),
+				MemoryUsed: nodes[4].server.memUsed,
+				MaxMemory:  nodes[4].server.config.MaxMemory,
+				Clients:    wantClients,
+			},
+		}
+		for i := 0; i < len(nodes); i++ {
+			if diff := deep.Equal(nodes[i].server.GetServerInfo(), nodeInfo[i]); diff != nil {
+				t.Errorf("GetServerInfo() - node %d: %v", i, diff)
+				return
+			}
+		}
+	})
+}
+
+type shardNode struct {
+	shardId   string
+	slots     string
+	bootstrap bool
+	replica   bool
+}
+
+// setUpShards starts a cluster node for each spec. Every node discovers the cluster through the first node.
+func setUpShards(t *testing.T, specs []shardNode) []ClientServerPair {
+	nodes := make([]ClientServerPair, len(specs))
+	t.Cleanup(func() {
+		for i := len(nodes) - 1; i > -1; i-- {
+			if nodes[i].raw != nil {
+				_ = nodes[i].raw.Close()
+			}
+			if nodes[i].server != nil {
+				nodes[i].server.ShutDown()
+			}
+		}
+	})
+
+	for i, spec := range specs {
+		port, err := internal.GetFreePort()
+		if err != nil {
+			t.Fatalf("could not get free port: %v", err)
+		}
+		discoveryPort, err := internal.GetFreePort()
+		if err != nil {
+			t.Fatalf("could not get free memberlist port: %v", err)
+		}
+		nodes[i] = ClientServerPair{
+			serverId:         fmt.Sprintf("SHARD-%s-%d", spec.shardId, i),
+			bindAddr:         getBindAddr().String(),
+			port:             port,
+			discoveryPort:    discoveryPort,
+			bootstrapCluster: spec.bootstrap,
+			forwardCommand:   true,
+		}
+		if i > 0 {
+			nodes[i].joinAddr = fmt.Sprintf("%s/%s:%d", nodes[0].serverId, nodes[0].bindAddr, nodes[0].discoveryPort)
+		}
+
+		conf := DefaultConfig()
+		conf.DataDir = ""
+		conf.ForwardCommand = nodes[i].forwardCommand
+		conf.BindAddr = nodes[i].bindAddr
+		conf.JoinAddr = nodes[i].joinAddr
+		conf.Port = uint16(nodes[i].port)
+		conf.ServerID = nodes[i].serverId
+		conf.DiscoveryPort = uint16(nodes[i].discoveryPort)
+		conf.BootstrapCluster = nodes[i].bootstrapCluster
+		conf.ClusterSecret = "cluster-secret"
+		conf.EvictionPolicy = constants.NoEviction
+
+		server, err := NewSugarDB(
+			WithContext(context.Background()),
+			WithConfig(conf),
+			WithShardID(spec.shardId),
+			WithShardSlots(spec.slots),
+			WithReplica(spec.replica),
+		)
+		if err != nil {
+			t.Fatalf("could not start server %d: %v", i, err)
+		}
+		go func() {
+			server.Start()
+		}()
+		nodes[i].server = server
+
+		conn, err := internal.GetConnection(nodes[i].bindAddr, nodes[i].port)
+		if err != nil {
+			t.Fatalf("could not open tcp connection to server %d: %v", i, err)
+		}
+		nodes[i].raw = conn
+		nodes[i].client = resp.NewConn(conn)
+	}
+	return nodes
+}
+
+// waitForShards waits until every node knows the slots of the shards, and the leader of every shard.
+func waitForShards(t *testing.T, nodes []ClientServerPair, wantSlots map[string][][2]int) {
+	shardIds := make(map[string]struct{})
+	for _, node := range nodes {
+		shardIds[node.server.config.ShardID] = struct{}{}
+	}
+	deadline := time.Now().Add(20 * time.Second)
+	for _, node := range nodes {
+		for {
+			shards, err := node.server.ClusterShards()
+			if err != nil {
+				t.Fatalf("ClusterShards() on %s: %v", node.serverId, err)
+			}
+			got := make(map[string][][2]int)
+			for _, shard := range shards {
+				if len(shard.Slots) > 0 {
+					got[shard.ID] = shard.Slots
+				}
+			}
+			leaders := make(map[string]struct{})
+			metas := node.server.memberList.NodeMetas()
+			for _, meta := range metas {
+				if meta.Leader {
+					leaders[meta.ShardID] = struct{}{}
+				}
+			}
+			if reflect.DeepEqual(got, wantSlots) && len(metas) == len(nodes) && len(leaders) == len(shardIds) {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("cluster did not converge on %s, got shards %+v", node.serverId, shards)
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+	}
+}
+
+// doCommand sends the command to the node and returns the reply.
+func doCommand(t *testing.T, node ClientServerPair, cmd ...string) resp.Value {
+	values := make([]resp.Value, len(cmd))
+	for i, c := range cmd {
+		values[i] = resp.StringValue(c)
+	}
+	if err := node.client.WriteArray(values); err != nil {
+		t.Fatalf("could not write %v to %s: %v", cmd, node.serverId, err)
+	}
+	res, _, err := node.client.ReadValue()
+	if err != nil {
+		t.Fatalf("could not read reply to %v from %s: %v", cmd, node.serverId, err)
+	}
+	return res
+}
+
+func Test_ClusterSharding(t *testing.T) {
+	// Set up two shards with two nodes each. Shard "a" serves slots 0-8191 and shard "b" serves slots 8192-16383.
+	nodes := setUpShards(t, []shardNode{
+		{shardId: "a", slots: "0-8191", bootstrap: true},
+		{shardId: "a"},
+		{shardId: "b", slots: "8192-16383", bootstrap: true},
+		{shardId: "b"},
+	})
+	waitForShards(t, nodes, map[string][][2]int{"a": {{0, 8191}}, "b": {{8192, 16383}}})
+
+	do := func(node ClientServerPair, cmd ...string) resp.Value {
+		return doCommand(t, node, cmd...)
+	}
+
+	// "foo" hashes to slot 12182, which is served by shard "b".
+	if res := do(nodes[0], "CLUSTER", "KEYSLOT", "foo"); res.Integer() != 12182 {
+		t.Errorf("expected CLUSTER KEYSLOT foo to be 12182, got %v", res)
+	}
+
+	t.Run("Test_Moved", func(t *testing.T) {
+		// Both nodes of shard "a" redirect to the leader of shard "b".
+		want := fmt.Sprintf("MOVED 12182 %s:%d", nodes[2].bindAddr, nodes[2].port)
+		for _, node := range nodes[:2] {
+			res := do(node, "SET", "foo", "bar")
+			if res.Error() == nil || res.Error().Error() != want {
+				t.Errorf("expected %q from %s, got %v", want, node.serverId, res)
+			}
+		}
+	})
+
+	t.Run("Test_ServedByOwner", func(t *testing.T) {
+		// Writes to the follower of shard "b" are forwarded to the leader of the shard.
+		for _, node := range nodes[2:] {
+			if res := do(node, "SET", "foo", node.serverId); res.String() != "OK" {
+				t.Errorf("expected OK from %s, got %v", node.serverId, res)
+			}
+		}
+		if res := do(nodes[2], "CLUSTER", "COUNTKEYSINSLOT", "12182"); res.Integer() != 1 {
+			t.Errorf("expected 1 key in slot 12182, got %v", res)
+		}
+		// Shard "a" does not have the key.
+		if n, _ := nodes[0].server.ClusterCountKeysInSlot(12182); n != 0 {
+			t.Errorf("expected no keys in slot 12182 on shard a, got %d", n)
+		}
+	})
+
+	t.Run("Test_CrossSlot", func(t *testing.T) {
+		res := do(nodes[0], "MSET", "foo", "1", "bar", "2")
+		want := "CROSSSLOT Keys in request don't hash to the same slot"
+		if res.Error() == nil || res.Error().Error() != want {
+			t.Errorf("expected %q, got %v", want, res)
+		}
+		// Keys with the same hashtag hash to the same slot.
+		if res = do(nodes[0], "MSET", "{user1}.name", "a", "{user1}.email", "b"); res.String() != "OK" {
+			t.Errorf("expected OK, got %v", res)
+		}
+		// Keys in different slots can't be accessed together, even when the slots are served by the same shard.
+		if res = do(nodes[0], "MSET", "bar", "a", "{user1}.age", "b"); res.Error() == nil || res.Error().Error() != want {
+			t.Errorf("expected %q, got %v", want, res)
+		}
+	})
+
+	t.Run("Test_ClusterSlots", func(t *testing.T) {
+		res := do(nodes[1], "CLUSTER", "SLOTS")
+		want := [][]int{{0, 8191}, {8192, 16383}}
+		if len(res.Array()) != len(want) {
+			t.Fatalf("expected %d slot ranges, got %v", len(want), res)
+		}
+		for i, entry := range res.Array() {
+			if entry.Array()[0].Integer() != want[i][0] || entry.Array()[1].Integer() != want[i][1] {
+				t.Errorf("expected slot range %v, got %v", want[i], entry)
+			}
+			// Each range lists the leader of the shard followed by the follower.
+			if len(entry.Array()) != 4 {
+				t.Errorf("expected 2 nodes for slot range %v, got %v", want[i], entry)
+			}
+		}
+	})
+}
+
+func Test_ClusterRebalance(t *testing.T) {
+	// Shard "a" serves all the slots, and shard "b" starts without slots.
+	nodes := setUpShards(t, []shardNode{
+		{shardId: "a", slots: "0-16383", bootstrap: true},
+		{shardId: "a"},
+		{shardId: "b", bootstrap: true},
+		{shardId: "b"},
+	})
+	waitForShards(t, nodes, map[string][][2]int{"a": {{0, 16383}}})
+
+	do := func(node ClientServerPair, cmd ...string) resp.Value {
+		return doCommand(t, node, cmd...)
+	}
+
+	// Shard "b" redirects every command to shard "a".
+	if res := do(nodes[2], "SET", "foo", "bar"); res.Error() == nil || !strings.HasPrefix(res.Error().Error(), "MOVED") {
+		t.Fatalf("expected MOVED from shard b, got %v", res)
+	}
+
+	keys := make([]string, 100)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("key-%d", i)
+		if res := do(nodes[0], "SET", keys[i], keys[i]); res.String() != "OK" {
+			t.Fatalf("could not set %s: %v", keys[i], res)
+		}
+	}
+	// "foo" hashes to slot 12182. Some keys are in database 1.
+	for _, cmd := range [][]string{
+		{"SET", "foo", "bar", "PX", "100000"},
+		{"SELECT", "1"},
+		{"SET", "{foo}.db1", "value"},
+		{"SET", "{key-1}.db1", "value"},
+		{"SET", "{key-2}.db1", "value"},
+		{"SET", "{key-3}.db1", "value"},
+		{"SELECT", "0"},
+	} {
+		if res := do(nodes[0], cmd...); res.String() != "OK" {
+			t.Fatalf("could not run %v: %v", cmd, res)
+		}
+	}
+	addrB := fmt.Sprintf("%s:%d", nodes[2].bindAddr, nodes[2].port)
+
+	t.Run("Test_MigrateSlot", func(t *testing.T) {
+		// Move slot 12182 to shard "b" step by step.
+		if res := do(nodes[2], "CLUSTER", "SETSLOT", "12182", "IMPORTING", "a"); res.String() != "OK" {
+			t.Fatalf("expected OK from SETSLOT IMPORTING, got %v", res)
+		}
+		// The source shard can be identified by one of its nodes.
+		if res := do(nodes[0], "CLUSTER", "SETSLOT", "12182", "MIGRATING", nodes[3].serverId); res.String() != "OK" {
+			t.Fatalf("expected OK from SETSLOT MIGRATING, got %v", res)
+		}
+		// SETSLOT must be sent to the leader of the shard.
+		if res := do(nodes[1], "CLUSTER", "SETSLOT", "12182", "STABLE"); res.Error() == nil {
+			t.Errorf("expected error from SETSLOT on the follower, got %v", res)
+		}
+
+		// Keys that have not been moved yet are still served by the source shard.
+		if res := do(nodes[0], "GET", "foo"); res.String() != "bar" {
+			t.Errorf("expected bar, got %v", res)
+		}
+		// Keys that are not on the source shard are served by the destination shard.
+		want := "ASK 12182 " + addrB
+		if res := do(nodes[0], "GET", "{foo}.new"); res.Error() == nil || res.Error().Error() != want {
+			t.Errorf("expected %q, got %v", want, res)
+		}
+		// The destination shard only serves the slot after ASKING.
+		if res := do(nodes[2], "GET", "{foo}.new"); res.Error() == nil || !strings.HasPrefix(res.Error().Error(), "MOVED") {
+			t.Errorf("expected MOVED without ASKING, got %v", res)
+		}
+		if res := do(nodes[2], "ASKING"); res.String() != "OK" {
+			t.Errorf("expected OK from ASKING, got %v", res)
+		}
+		if res := do(nodes[2], "SET", "{foo}.new", "value"); res.String() != "OK" {
+			t.Errorf("expected OK after ASKING, got %v", res)
+		}
+
+		// The slot can't be given away while it has keys.
+		if res := do(nodes[0], "CLUSTER", "SETSLOT", "12182", "NODE", "b"); res.Error() == nil {
+			t.Errorf("expected error from SETSLOT NODE while the slot has keys, got %v", res)
+		}
+
+		for database, key := range []string{"foo", "{foo}.db1"} {
+			do(nodes[0], "SELECT", strconv.Itoa(database))
+			res := do(nodes[0], "MIGRATE", nodes[2].bindAddr, strconv.Itoa(nodes[2].port), key, strconv.Itoa(database), "5000")
+			if res.String() != "OK" {
+				t.Fatalf("expected OK from MIGRATE, got %v", res)
+			}
+		}
+		do(nodes[0], "SELECT", "0")
+		if res := do(nodes[0], "GET", "foo"); res.Error() == nil || res.Error().Error() != "ASK 12182 "+addrB {
+			t.Errorf("expected ASK for the migrated key, got %v", res)
+		}
+
+		if res := do(nodes[2], "CLUSTER", "SETSLOT", "12182", "NODE", "b"); res.String() != "OK" {
+			t.Fatalf("expected OK from SETSLOT NODE on the destination, got %v", res)
+		}
+		if res := do(nodes[0], "CLUSTER", "SETSLOT", "12182", "NODE", "b"); res.String() != "OK" {
+			t.Fatalf("expected OK from SETSLOT NODE on the source, got %v", res)
+		}
+		waitForShards(t, nodes, map[string][][2]int{"a": {{0, 12181}, {12183, 16383}}, "b": {{12182, 12182}}})
+
+		want = "MOVED 12182 " + addrB
+		if res := do(nodes[1], "GET", "foo"); res.Error() == nil || res.Error().Error() != want {
+			t.Errorf("expected %q, got %v", want, res)
+		}
+		if res := do(nodes[2], "GET", "foo"); res.String() != "bar" {
+			t.Errorf("expected bar from shard b, got %v", res)
+		}
+	})
+
+	t.Run("Test_Rebalance", func(t *testing.T) {
+		// Shard "a" gives its highest 8191 slots to shard "b".
+		res := do(nodes[1], "CLUSTER", "REBALANCE", "BATCH", "10")
+		if res.Error() != nil || res.Integer() != 8191 {
+			t.Fatalf("expected 8191 slots to be moved, got %v", res)
+		}
+		waitForShards(t, nodes, map[string][][2]int{"a": {{0, 8191}}, "b": {{8192, 16383}}})
+
+		for _, key := range keys {
+			owner, other := nodes[0], nodes[2]
+			if slot, _ := nodes[0].server.ClusterKeySlot(key); slot >= 8192 {
+				owner, other = nodes[2], nodes[0]
+			}
+			if res := do(owner, "GET", key); res.String() != key {
+				t.Errorf("expected %s from %s, got %v", key, owner.serverId, res)
+			}
+			if res := do(other, "GET", key); res.Error() == nil || !strings.HasPrefix(res.Error().Error(), "MOVED") {
+				t.Errorf("expected MOVED for %s from %s, got %v", key, other.serverId, res)
+			}
+		}
+		for _, key := range []string{"key-1", "key-2", "key-3"} {
+			owner := nodes[0]
+			if slot, _ := nodes[0].server.ClusterKeySlot(key); slot >= 8192 {
+				owner = nodes[2]
+			}
+			do(owner, "SELECT", "1")
+			if res := do(owner, "GET", fmt.Sprintf("{%s}.db1", key)); res.String() != "value" {
+				t.Errorf("expected {%s}.db1 in database 1 of %s, got %v", key, owner.serverId, res)
+			}
+			do(owner, "SELECT", "0")
+		}
+		// The keys moved in the first step are not moved again, and keep their expiry time.
+		if res := do(nodes[2], "PTTL", "foo"); res.Integer() <= 0 {
+			t.Errorf("expected foo to keep its ttl, got %v", res)
+		}
+		if n, _ := nodes[0].server.ClusterCountKeysInSlot(12182); n != 0 {
+			t.Errorf("expected no keys in slot 12182 on shard a, got %d", n)
+		}
+	})
+}
+
+func Test_ClusterPubSub(t *testing.T) {
+	// Set up two shards with two nodes each. Shard "a" serves slots 0-8191 and shard "b" serves slots 8192-16383.
+	nodes := setUpShards(t, []shardNode{
+		{shardId: "a", slots: "0-8191", bootstrap: true},
+		{shardId: "a"},
+		{shardId: "b", slots: "8192-16383", bootstrap: true},
+		{shardId: "b"},
+	})
+	waitForShards(t, nodes, map[string][][2]int{"a": {{0, 8191}}, "b": {{8192, 16383}}})
+
+	do := func(node ClientServerPair, cmd ...string) resp.Value {
+		return doCommand(t, node, cmd...)
+	}
+
+	// subscribe opens a new connection to the node and sends the subscribe command on it.
+	subscribe := func(t *testing.T, node ClientServerPair, cmd ...string) *resp.Conn {
+		conn, err := internal.GetConnection(node.bindAddr, node.port)
+		if err != nil {
+			t.Fatalf("could not open tcp connection to %s: %v", node.serverId, err)
+		}
+		t.Cleanup(func() {
+			_ = conn.Close()
+		})
+		_ = conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+		client := resp.NewConn(conn)
+		values := make([]resp.Value, len(cmd))
+		for i, c := range cmd {
+			values[i] = resp.StringValue(c)
+		}
+		if err = client.WriteArray(values); err != nil {
+			t.Fatalf("could not write %v to %s: %v", cmd, node.serverId, err)
+		}
+		for i := 1; i < len(cmd); i++ {
+			res, _, err := client.ReadValue()
+			if err != nil {
+				t.Fatalf("could not read reply to %v from %s: %v", cmd, node.serverId, err)
+			}
+			if !strings.EqualFold(res.Array()[0].String(), cmd[0]) {
+				t.Fatalf("expected %s confirmation from %s, got %v", cmd[0], node.serverId, res)
+			}
+		}
+		return client
+	}
+
+	// readMessage reads the next message delivered to the subscriber.
+	readMessage := func(t *testing.T, client *resp.Conn) []string {
+		res, _, err := client.ReadValue()
+		if err != nil {
+			t.Fatalf("could not read message: %v", err)
+		}
+		var message []string
+		for _, v := range res.Array() {
+			message = append(message, v.String())
+		}
+		return message
+	}
+
+	// waitFor polls the command on the node until it returns the wanted reply.
+	waitFor := func(t *testing.T, node ClientServerPair, want string, cmd ...string) {
+		deadline := time.Now().Add(10 * time.Second)
+		for {
+			res := doCommand(t, node, cmd...)
+			if res.String() == want {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("expected %v on %s to return %s, got %s", cmd, node.serverId, want, res.String())
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+	}
+
+	t.Run("Test_Publish", func(t *testing.T) {
+		// Subscribers on both shards receive the messages published on any node.
+		subscribers := []*resp.Conn{
+			subscribe(t, nodes[1], "SUBSCRIBE", "news"),
+			subscribe(t, nodes[3], "SUBSCRIBE", "news"),
+		}
+		patternSubscriber := subscribe(t, nodes[2], "PSUBSCRIBE", "new*")
+
+		// PUBSUB returns the subscriptions of the whole cluster.
+		waitFor(t, nodes[0], "[[news 2]]", "PUBSUB", "NUMSUB", "news")
+		waitFor(t, nodes[0], "1", "PUBSUB", "NUMPAT")
+		waitFor(t, nodes[0], "[news new*]", "PUBSUB", "CHANNELS")
+
+		for _, message := range []string{"hello", "bye"} {
+			if res := do(nodes[0], "PUBLISH", "news", message); res.String() != "OK" {
+				t.Fatalf("expected OK, got %v", res)
+			}
+		}
+		// Each subscriber receives every message once, in order.
+		for _, message := range []string{"hello", "bye"} {
+			for i, subscriber := range subscribers {
+				want := []string{"message", "news", message}
+				if got := readMessage(t, subscriber); !reflect.DeepEqual(got, want) {
+					t.Errorf("expected subscriber %d to receive %v, got %v", i, want, got)
+				}
+			}
+			want := []string{"message", "new*", message}
+			if got := readMessage(t, patternSubscriber); !reflect.DeepEqual(got, want) {
+				t.Errorf("expected pattern subscriber to receive %v, got %v", want, got)
+			}
+		}
+	})
+
+	t.Run("Test_ShardedPubSub", func(t *testing.T) {
+		// "foo" hashes to slot 12182, which is served by shard "b".
+		want := fmt.Sprintf("MOVED 12182 %s:%d", nodes[2].bindAddr, nodes[2].port)
+		for _, cmd := range [][]string{{"SSUBSCRIBE", "foo"}, {"SPUBLISH", "foo", "bar"}} {
+			res := do(nodes[0], cmd...)
+			if res.Error() == nil || res.Error().Error() != want {
+				t.Errorf("expected %q for %v, got %v", want, cmd, res)
+			}
+		}
+		// A renamed shard channel command is routed like the original one.
+		command, err := nodes[0].server.getCommand("spublish")
+		if err != nil {
+			t.Fatal(err)
+		}
+		command.Command, command.OriginalCommand = "myspublish", "spublish"
+		err = nodes[0].server.routeCommand(context.Background(), command, internal.SubCommand{}, []string{"MYSPUBLISH", "foo", "bar"}, false)
+		if err == nil || err.Error() != want {
+			t.Errorf("expected %q for the renamed SPUBLISH, got %v", want, err)
+		}
+
+		subscribers := []*resp.Conn{
+			subscribe(t, nodes[2], "SSUBSCRIBE", "foo"),
+			subscribe(t, nodes[3], "SSUBSCRIBE", "foo"),
+		}
+		// Shard channels are only counted by the nodes of the shard.
+		waitFor(t, nodes[2], "[[foo 2]]", "PUBSUB", "SHARDNUMSUB", "foo")
+		waitFor(t, nodes[3], "[foo]", "PUBSUB", "SHARDCHANNELS")
+		waitFor(t, nodes[0], "[[foo 0]]", "PUBSUB", "SHARDNUMSUB", "foo")
+
+		if res := do(nodes[3], "SPUBLISH", "foo", "bar"); res.String() != "OK" {
+			t.Fatalf("expected OK, got %v", res)
+		}
+		for i, subscriber := range subscribers {
+			want := []string{"smessage", "foo", "bar"}
+			if got := readMessage(t, subscriber); !reflect.DeepEqual(got, want) {
+				t.Errorf("expected subscriber %d to receive %v, got %v", i, want, got)
+			}
+		}
+	})
+}
+
+func Test_ClusterACL(t *testing.T) {
+	// Set up two shards with two nodes each. Shard "a" serves slots 0-8191 and shard "b" serves slots 8192-16383.
+	nodes := setUpShards(t, []shardNode{
+		{shardId: "a", slots: "0-8191", bootstrap: true},
+		{shardId: "a"},
+		{shardId: "b", slots: "8192-16383", bootstrap: true},
+		{shardId: "b"},
+	})
+	waitForShards(t, nodes, map[string][][2]int{"a": {{0, 8191}}, "b": {{8192, 16383}}})
+
+	// waitForUsers waits until every node has the wanted users.
+	waitForUsers := func(t *testing.T, want []string) {
+		deadline := time.Now().Add(10 * time.Second)
+		for _, node := range nodes {
+			for {
+				users, err := node.server.ACLUsers()
+				if err != nil {
+					t.Fatalf("ACLUsers() on %s: %v", node.serverId, err)
+				}
+				slices.Sort(users)
+				if slices.Equal(users, want) {
+					break
+				}
+				if time.Now().After(deadline) {
+					t.Fatalf("expected users %v on %s, got %v", want, node.serverId, users)
+				}
+				time.Sleep(100 * time.Millisecond)
+			}
+		}
+	}
+
+	t.Run("Test_SetUser", func(t *testing.T) {
+		// The user is created on every shard, even though the command was sent to a follower of shard "a".
+		if res := doCommand(t, nodes[1], "ACL", "SETUSER", "user1", "on", ">password1", "+@all"); res.String() != "OK" {
+			t.Fatalf("expected OK, got %v", res)
+		}
+		waitForUsers(t, []string{"default", "user1"})
+	})
+
+	t.Run("Test_DelUser", func(t *testing.T) {
+		if res := doCommand(t, nodes[3], "ACL", "DELUSER", "user1"); res.String() != "OK" {
+			t.Fatalf("expected OK, got %v", res)
+		}
+		waitForUsers(t, []string{"default"})
+	})
+
+	t.Run("Test_ForwardedUser", func(t *testing.T) {
+		if res := doCommand(t, nodes[1], "ACL", "SETUSER", "reader", "on", ">password1", "+@read", "~*"); res.String() != "OK" {
+			t.Fatalf("expected OK, got %v", res)
+		}
+		if res := doCommand(t, nodes[1], "ACL", "SETUSER", "limited", "on", ">password1", "+@all", "~limited:*", "maxkeys=1"); res.String() != "OK" {
+			t.Fatalf("expected OK, got %v", res)
+		}
+		waitForUsers(t, []string{"default", "limited", "reader"})
+		t.Cleanup(func() {
+			doCommand(t, nodes[1], "ACL", "DELUSER", "reader", "limited")
+			waitForUsers(t, []string{"default"})
+		})
+
+		leader := nodes[0].server
+		setRequirePass := func(requirePass bool) {
+			leader.acl.LockUsers()
+			defer leader.acl.UnlockUsers()
+			leader.acl.Config.RequirePass = requirePass
+		}
+		setRequirePass(true)
+		t.Cleanup(func() { setRequirePass(false) })
+
+		// The leader authorizes the forwarded command with the permissions and quotas of the user on the leader,
+		// and routes its keys again. The keys with the hashtag {forwarded_key} are served by shard "a".
+		tests := []struct {
+			name     string
+			username string
+			rules    []string
+			system   bool
+			key      string
+			wantErr  bool
+		}{
+			{name: "1. Allowed user", username: "default", key: "forwarded_key"},
+			{name: "2. Denied user", username: "reader", key: "forwarded_key", wantErr: true},
+			{name: "3. Unknown user", username: "unknown", key: "forwarded_key", wantErr: true},
+			{name: "4. No user", key: "forwarded_key", wantErr: true},
+			{name: "5. System command", system: true, key: "forwarded_key"},
+			{
+				name:     "6. Allowed identity",
+				username: "identity",
+				rules:    []string{"on", "+@all", "~*"},
+				key:      "forwarded_key",
+			},
+			{
+				name:     "7. Denied identity",
+				username: "identity",
+				rules:    []string{"on", "+@read", "~*"},
+				key:      "forwarded_key",
+				wantErr:  true,
+			},
+			{name: "8. Within quota", username: "limited", key: "limited:{forwarded_key}1"},
+			{name: "9. Over quota", username: "limited", key: "limited:{forwarded_key}2", wantErr: true},
+			{name: "10. Key of another shard", username: "default", key: "foo", wantErr: true},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				ctx := context.WithValue(context.Background(), internal.ContextUsername("Username"), tt.username)
+				ctx = context.WithValue(ctx, internal.ContextUserRules("UserRules"), tt.rules)
+				ctx = context.WithValue(ctx, internal.ContextSystem("System"), tt.system)
+				_, err := leader.applyForwardedCommand(ctx, []string{"SET", tt.key, "value"})
+				if tt.wantErr && err == nil {
+					t.Errorf("expected the command of user %q to be denied", tt.username)
+				}
+				if !tt.wantErr && err != nil {
+					t.Errorf("expected the command of user %q to be applied, got %v", tt.username, err)
+				}
+			})
+		}
+	})
+
+	t.Run("Test_ReloadUsers", func(t *testing.T) {
+		if res := doCommand(t, nodes[2], "ACL", "SETUSER", "stale", "on", ">password1", "+@all"); res.String() != "OK" {
+			t.Fatalf("expected OK, got %v", res)
+		}
+		waitForUsers(t, []string{"default", "stale"})
+
+		aclFile := filepath.Join(t.TempDir(), "acl.json")
+		if err := os.WriteFile(aclFile, []byte(`[{"Username": "reloaded", "Enabled": true, "NoPassword": true}]`), 0644); err != nil {
+			t.Fatal(err)
+		}
+		for _, node := range nodes {
+			node.server.acl.LockUsers()
+			node.server.acl.Config.AclConfig = aclFile
+			node.server.acl.UnlockUsers()
+		}
+		t.Cleanup(func() {
+			doCommand(t, nodes[1], "ACL", "DELUSER", "reloaded")
+			waitForUsers(t, []string{"default"})
+		})
+
+		// The reload on a follower of shard "a" is applied on every node of both shards.
+		if err := nodes[1].server.reloadUsers(); err != nil {
+			t.Fatal(err)
+		}
+		waitForUsers(t, []string{"default", "reloaded"})
+	})
+
+	t.Run("Test_ModuleConflict", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "module_missing.so")
+		res := doCommand(t, nodes[0], "MODULE", "LOAD", path)
+		want := fmt.Sprintf("Error module %s not found", path)
+		if res.Error() == nil || res.Error().Error() != want {
+			t.Errorf("expected %q, got %v", want, res)
+		}
+		for _, node := range nodes {
+			if modules := node.server.ListModules(); slices.Contains(modules, strings.ToLower(path)) {
+				t.Errorf("expected module %s not to be loaded on %s", path, node.serverId)
+			}
+		}
+	})
+}
+
+func Test_ClusterTopology(t *testing.T) {
+	// Set up shard "a" with three nodes and shard "b" with one node.
+	nodes := setUpShards(t, []shardNode{
+		{shardId: "a", slots: "0-8191", bootstrap: true},
+		{shardId: "a"},
+		{shardId: "a"},
+		{shardId: "b", slots: "8192-16383", bootstrap: true},
+	})
+	waitForShards(t, nodes, map[string][][2]int{"a": {{0, 8191}}, "b": {{8192, 16383}}})
+
+	do := func(node ClientServerPair, cmd ...string) resp.Value {
+		return doCommand(t, node, cmd...)
+	}
+
+	// waitForLeader waits until the node knows the leader of its shard.
+	waitForLeader := func(t *testing.T, node ClientServerPair, want string) {
+		deadline := time.Now().Add(10 * time.Second)
+		for {
+			if res := do(node, "CLUSTER", "LEADER"); res.String() == want {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("expected leader %s on %s", want, node.serverId)
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+	}
+
+	// nodeLine returns the line of CLUSTER NODES that describes the node with the id.
+	nodeLine := func(t *testing.T, node ClientServerPair, id string) string {
+		for _, line := range strings.Split(do(node, "CLUSTER", "NODES").String(), "\n") {
+			if strings.HasPrefix(line, id+" ") {
+				return line
+			}
+		}
+		return ""
+	}
+
+	t.Run("Test_MyIDAndLeader", func(t *testing.T) {
+		for _, node := range nodes {
+			if res := do(node, "CLUSTER", "MYID"); res.String() != node.serverId {
+				t.Errorf("expected id %s, got %v", node.serverId, res)
+			}
+		}
+		waitForLeader(t, nodes[2], nodes[0].serverId)
+		waitForLeader(t, nodes[3], nodes[3].serverId)
+	})
+
+	t.Run("Test_Info", func(t *testing.T) {
+		info := do(nodes[1], "CLUSTER", "INFO").String()
+		for _, want := range []string{
+			"cluster_state:ok", "cluster_slots_assigned:16384", "cluster_known_nodes:4", "cluster_size:2",
+			"cluster_my_id:" + nodes[1].serverId, "cluster_my_shard_id:a", "raft_state:follower",
+		} {
+			if !strings.Contains(info, want+"\r\n") {
+				t.Errorf("expected CLUSTER INFO to contain %q, got %q", want, info)
+			}
+		}
+	})
+
+	t.Run("Test_Nodes", func(t *testing.T) {
+		want := fmt.Sprintf("%s %s:%d@", nodes[1].serverId, nodes[1].bindAddr, nodes[1].port)
+		line := nodeLine(t, nodes[1], nodes[1].serverId)
+		if !strings.HasPrefix(line, want) ||
+			!strings.HasSuffix(line, fmt.Sprintf(" myself,slave %s 0 0 0 connected", nodes[0].serverId)) {
+			t.Errorf("unexpected node line %q", line)
+		}
+		line = nodeLine(t, nodes[1], nodes[3].serverId)
+		if !strings.HasSuffix(line, " master - 0 0 0 connected 8192-16383") {
+			t.Errorf("unexpected node line %q", line)
+		}
+	})
+
+	t.Run("Test_Role", func(t *testing.T) {
+		res := do(nodes[0], "ROLE").Array()
+		if res[0].String() != "master" || len(res[2].Array()) != 2 {
+			t.Errorf("expected master with 2 replicas, got %v", res)
+		}
+		res = do(nodes[1], "ROLE").Array()
+		if res[0].String() != "slave" || res[1].String() != nodes[0].bindAddr ||
+			res[2].Integer() != nodes[0].port || res[3].String() != "connected" {
+			t.Errorf("expected slave of %s:%d, got %v", nodes[0].bindAddr, nodes[0].port, res)
+		}
+	})
+
+	t.Run("Test_Failover", func(t *testing.T) {
+		// A follower takes over the leadership of its shard.
+		if res := do(nodes[1], "CLUSTER", "FAILOVER"); res.String() != "OK" {
+			t.Fatalf("expected OK, got %v", res)
+		}
+		for _, node := range nodes[:3] {
+			waitForLeader(t, node, nodes[1].serverId)
+		}
+		// The leader hands the leadership over to the chosen node.
+		if res := do(nodes[2], "CLUSTER", "FAILOVER", nodes[0].serverId); res.String() != "OK" {
+			t.Fatalf("expected OK, got %v", res)
+		}
+		for _, node := range nodes[:3] {
+			waitForLeader(t, node, nodes[0].serverId)
+		}
+	})
+
+	t.Run("Test_AddAndForgetNode", func(t *testing.T) {
+		// The ghost node never joins, so it's listed as failed until it's forgotten.
+		if res := do(nodes[2], "CLUSTER", "ADDNODE", "ghost-1", "127.0.0.1:1"); res.String() != "OK" {
+			t.Fatalf("expected OK, got %v", res)
+		}
+		deadline := time.Now().Add(10 * time.Second)
+		for !strings.Contains(nodeLine(t, nodes[2], "ghost-1"), " slave,fail ") {
+			if time.Now().After(deadline) {
+				t.Fatalf("expected ghost-1 to be listed as failed, got %q", nodeLine(t, nodes[2], "ghost-1"))
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+
+		res := do(nodes[2], "CLUSTER", "FORGET", nodes[1].serverId)
+		want := fmt.Sprintf("Error node %s is still a member of the cluster, use CLUSTER REMOVENODE", nodes[1].serverId)
+		if res.Error() == nil || res.Error().Error() != want {
+			t.Errorf("expected %q, got %v", want, res)
+		}
+
+		if res = do(nodes[2], "CLUSTER", "FORGET", "ghost-1"); res.String() != "OK" {
+			t.Fatalf("expected OK, got %v", res)
+		}
+		for nodeLine(t, nodes[2], "ghost-1") != "" {
+			if time.Now().After(deadline) {
+				t.Fatal("expected ghost-1 to be forgotten")
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+	})
+
+	t.Run("Test_RemoveNode", func(t *testing.T) {
+		if ok, err := nodes[1].server.ClusterAddNode("ghost-2", "127.0.0.1:2"); err != nil || !ok {
+			t.Fatalf("ClusterAddNode() = %v, %v", ok, err)
+		}
+		if ok, err := nodes[1].server.ClusterRemoveNode("ghost-2"); err != nil || !ok {
+			t.Fatalf("ClusterRemoveNode() = %v, %v", ok, err)
+		}
+		if _, err := nodes[1].server.ClusterRemoveNode("ghost-2"); err == nil || err.Error() != "unknown node ghost-2" {
+			t.Errorf("expected unknown node error, got %v", err)
+		}
+	})
+}
+
+func Test_ClusterReplicas(t *testing.T) {
+	// Set up a shard with two voters and a non-voting replica.
+	nodes := setUpShards(t, []shardNode{
+		{shardId: "a", slots: "0-16383", bootstrap: true},
+		{shardId: "a"},
+		{shardId: "a", replica: true},
+	})
+	waitForShards(t, nodes, map[string][][2]int{"a": {{0, 16383}}})
+
+	do := func(node ClientServerPair, cmd ...string) resp.Value {
+		return doCommand(t, node, cmd...)
+	}
+
+	// waitFor retries the check until it passes.
+	waitFor := func(t *testing.T, msg string, check func() bool) {
+		deadline := time.Now().Add(10 * time.Second)
+		for !check() {
+			if time.Now().After(deadline) {
+				t.Fatal(msg)
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+	}
+
+	replica := nodes[2]
+	isReplica := func(node ClientServerPair) bool {
+		return strings.Contains(do(node, "CLUSTER", "INFO").String(), "raft_replica:1\r\n")
+	}
+	waitFor(t, "expected the node to join as a replica", func() bool { return isReplica(replica) })
+
+	t.Run("Test_ReplicaServesReads", func(t *testing.T) {
+		if res := do(nodes[0], "SET", "key1", "value1"); res.String() != "OK" {
+			t.Fatalf("expected OK, got %v", res)
+		}
+		waitFor(t, "expected the replica to apply the write", func() bool {
+			return do(replica, "GET", "key1").String() == "value1"
+		})
+
+		res := do(replica, "SET", "key2", "value2")
+		if res.Error() == nil || res.Error().Error() != sharding.ErrReadOnly.Error() {
+			t.Errorf("expected READONLY error, got %v", res)
+		}
+		if _, _, err := replica.server.Set("key2", "value2", SETOptions{}); !errors.Is(err, sharding.ErrReadOnly) {
+			t.Errorf("expected READONLY error from the embedded API, got %v", err)
+		}
+	})
+
+	t.Run("Test_ReplicaMetrics", func(t *testing.T) {
+		line := ""
+		for _, l := range strings.Split(do(nodes[0], "CLUSTER", "NODES").String(), "\n") {
+			if strings.HasPrefix(l, replica.serverId+" ") {
+				line = l
+			}
+		}
+		if !strings.Contains(line, " slave,nofailover ") {
+			t.Errorf("expected the replica to be flagged with nofailover, got %q", line)
+		}
+
+		info := do(replica, "INFO", "replication").String()
+		for _, want := range []string{"role:slave", "master_link_status:up", "slave_read_only:1", "slave_repl_lag:"} {
+			if !strings.Contains(info, want) {
+				t.Errorf("expected INFO to contain %q, got %q", want, info)
+			}
+		}
+		if role := replica.server.Role(); !role.Replica || role.LastContact < 0 {
+			t.Errorf("expected a replica in contact with the leader, got %+v", role)
+		}
+	})
+
+	t.Run("Test_PromoteAndDemote", func(t *testing.T) {
+		if res := do(nodes[1], "CLUSTER", "PROMOTE", replica.serverId); res.String() != "OK" {
+			t.Fatalf("expected OK, got %v", res)
+		}
+		waitFor(t, "expected the replica to be promoted", func() bool { return !isReplica(replica) })
+		if res := do(replica, "SET", "key2", "value2"); res.String() != "OK" {
+			t.Errorf("expected the promoted node to forward the write, got %v", res)
+		}
+
+		res := do(replica, "CLUSTER", "PROMOTE", replica.serverId)
+		want := fmt.Sprintf("Error node %s is already a voter", replica.serverId)
+		if res.Error() == nil || res.Error().Error() != want {
+			t.Errorf("expected %q, got %v", want, res)
+		}
+		res = do(replica, "CLUSTER", "DEMOTE", nodes[0].serverId)
+		want = fmt.Sprintf("Error node %s is the leader, transfer the leadership first", nodes[0].serverId)
+		if res.Error() == nil || res.Error().Error() != want {
+			t.Errorf("expected %q, got %v", want, res)
+		}
+
+		if ok, err := nodes[0].server.ClusterDemote(replica.serverId); err != nil || !ok {
+			t.Fatalf("ClusterDemote() = %v, %v", ok, err)
+		}
+		waitFor(t, "expected the node to be demoted", func() bool { return isReplica(replica) })
+	})
+}
+
+func Test_StandaloneReplication(t *testing.T) {
+	newServer := func(t *testing.T) (*SugarDB, int) {
+		port, err := internal.GetFreePort()
+		if err != nil {
+			t.Fatal(err)
+		}
+		server, err := NewSugarDB(
+			WithConfig(config.Config{
+				BindAddr:       "localhost",
+				Port:           uint16(port),
+				DataDir:        t.TempDir(),
+				EvictionPolicy: constants.NoEviction,
+			}),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		go func() {
+			server.Start()
+		}()
+		t.Cleanup(func() {
+			server.ShutDown()
+		})
+		return server, port
+	}
+
+	// waitFor retries the check until it passes.
+	waitFor := func(t *testing.T, msg string, check func() bool) {
+		deadline := time.Now().Add(10 * time.Second)
+		for !check() {
+			if time.Now().After(deadline) {
+				t.Fatal(msg)
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+	}
+
+	primary, primaryPort := newServer(t)
+	replica, replicaPort := newServer(t)
+
+	// Write some data before the replica connects, so that it's sent in the full resynchronization.
+	if _, _, err := primary.Set("key1", "value1", SETOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := primary.SAdd("set1", "a", "b", "c"); err != nil {
+		t.Fatal(err)
+	}
+	// This key is overwritten by the full resynchronization.
+	if _, _, err := replica.Set("stale", "value", SETOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := internal.GetConnection("localhost", replicaPort)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+	client := resp.NewConn(conn)
+	if err = client.WriteArray([]resp.Value{
+		resp.StringValue("REPLICAOF"), resp.StringValue("localhost"), resp.StringValue(strconv.Itoa(primaryPort)),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if res, _, err := client.ReadValue(); err != nil || res.String() != "OK" {
+		t.Fatalf("expected OK, got %v, %v", res, err)
+	}
+
+	t.Run("Test_FullResync", func(t *testing.T) {
+		waitFor(t, "expected the replica to load the primary's dataset", func() bool {
+			value, _ := replica.Get("key1")
+			return value == "value1"
+		})
+		members, err := replica.SMembers("set1")
+		if err != nil || len(members) != 3 {
+			t.Errorf("expected the set to be replicated, got %v, %v", members, err)
+		}
+		if value, _ := replica.Get("stale"); value != "" {
+			t.Errorf("expected the replica's previous dataset to be replaced, got %q", value)
+		}
+	})
+
+	t.Run("Test_StreamedWrites", func(t *testing.T) {
+		if _, _, err := primary.Set("key2", "value2", SETOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		if err := primary.SelectDB(1); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := primary.Set("key3", "value3", SETOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		if err := primary.SelectDB(0); err != nil {
+			t.Fatal(err)
+		}
+		waitFor(t, "expected the replica to apply the write", func() bool {
+			value, _ := replica.Get("key2")
+			return value == "value2"
+		})
+		if err := replica.SelectDB(1); err != nil {
+			t.Fatal(err)
+		}
+		waitFor(t, "expected the replica to apply the write to database 1", func() bool {
+			value, _ := replica.Get("key3")
+			return value == "value3"
+		})
+		if err := replica.SelectDB(0); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("Test_ReplicaIsReadOnly", func(t *testing.T) {
+		if _, _, err := replica.Set("key4", "value4", SETOptions{}); err == nil || !strings.HasPrefix(err.Error(), "READONLY") {
+			t.Errorf("expected READONLY error, got %v", err)
+		}
+		if err := client.WriteArray([]resp.Value{
+			resp.StringValue("SET"), resp.StringValue("key4"), resp.StringValue("value4"),
+		}); err != nil {
+			t.Fatal(err)
+		}
+		res, _, err := client.ReadValue()
+		if err != nil || res.Error() == nil || res.Error().Error() != sharding.ErrReadOnly.Error() {
+			t.Errorf("expected READONLY error, got %v, %v", res, err)
+		}
+
+		// A rejected write does not wait for the state capture that pauses the writes.
+		replica.stateCapture.pause.Lock()
+		done := make(chan error, 1)
+		go func() {
+			_, _, err := replica.Set("key4", "value4", SETOptions{})
+			done <- err
+		}()
+		select {
+		case err := <-done:
+			if err == nil || !strings.HasPrefix(err.Error(), "READONLY") {
+				t.Errorf("expected READONLY error, got %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Errorf("expected the write to be rejected while the writes are paused")
+			replica.stateCapture.pause.Unlock()
+			<-done
+			return
+		}
+		replica.stateCapture.pause.Unlock()
+	})
+
+	t.Run("Test_Role", func(t *testing.T) {
+		waitFor(t, "expected the primary to list the replica", func() bool {
+			role := primary.Role()
+			return len(role.Replicas) == 1 && role.Replicas[0].Port == replicaPort &&
+				role.Links[role.Replicas[0].ServerID].Offset == role.Offset
+		})
+		role := replica.Role()
+		if role.Role != "slave" || role.State != "connected" || role.LeaderPort != primaryPort ||
+			role.ReplicationID != primary.Role().ReplicationID {
+			t.Errorf("unexpected replica role %+v", role)
+		}
+
+		info, err := replica.Info("replication")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info["replication"]["master_link_status"] != "up" || info["replication"]["slave_read_only"] != "1" {
+			t.Errorf("unexpected replica info %v", info["replication"])
+		}
+		info, err = primary.Info("replication")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info["replication"]["connected_slaves"] != "1" || info["replication"]["sync_full"] != "1" ||
+			!strings.Contains(info["replication"]["slave0"], fmt.Sprintf("port=%d", replicaPort)) {
+			t.Errorf("unexpected primary info %v", info["replication"])
+		}
+	})
+
+	t.Run("Test_PartialResync", func(t *testing.T) {
+		// Break the link, and write while the replica is disconnected.
+		replica.replication.replica.Disconnect()
+		if _, _, err := primary.Set("key5", "value5", SETOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		waitFor(t, "expected the replica to catch up", func() bool {
+			value, _ := replica.Get("key5")
+			return value == "value5"
+		})
+		role := primary.Role()
+		if role.SyncFull != 1 || role.SyncPartialOK != 1 {
+			t.Errorf("expected the replica to continue from its offset, got %d full and %d partial resyncs",
+				role.SyncFull, role.SyncPartialOK)
+		}
+	})
+
+	t.Run("Test_LinkIsExclusive", func(t *testing.T) {
+		conn, err := internal.GetConnection("localhost", primaryPort)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() {
+			_ = conn.Close()
+		}()
+		link := resp.NewConn(conn)
+		if err = link.WriteArray([]resp.Value{
+			resp.StringValue("PSYNC"), resp.StringValue("?"), resp.StringValue("-1"),
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if res, _, err := link.ReadValue(); err != nil || !strings.HasPrefix(res.String(), "FULLRESYNC") {
+			t.Fatalf("expected FULLRESYNC, got %v, %v", res, err)
+		}
+		if _, _, err = link.ReadValue(); err != nil {
+			t.Fatal(err)
+		}
+
+		// Commands other than the acknowledgements are not replied to, so the replies don't corrupt the stream.
+		if err = link.WriteArray([]resp.Value{resp.StringValue("GET"), resp.StringValue("key1")}); err != nil {
+			t.Fatal(err)
+		}
+		if err = link.WriteArray([]resp.Value{resp.StringValue("UNKNOWN")}); err != nil {
+			t.Fatal(err)
+		}
+		// The connection's commands are handled in order, so the commands were handled once the ack is recorded.
+		if err = link.WriteArray([]resp.Value{
+			resp.StringValue("REPLCONF"), resp.StringValue("ACK"), resp.StringValue("424242"),
+		}); err != nil {
+			t.Fatal(err)
+		}
+		waitFor(t, "expected the primary to record the ack", func() bool {
+			for _, l := range primary.Role().Links {
+				if l.Offset == 424242 {
+					return true
+				}
+			}
+			return false
+		})
+		if _, _, err := primary.Set("key6", "value6", SETOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		_ = conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+		for {
+			res, _, err := link.ReadValue()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Type() != resp.Array {
+				t.Fatalf("expected the stream to only hold commands, got %v", res)
+			}
+			if cmd := res.Array(); len(cmd) == 3 && cmd[0].String() == "SET" && cmd[1].String() == "key6" {
+				break
+			}
+		}
+	})
+
+	t.Run("Test_ReplicaOfNoOne", func(t *testing.T) {
+		if ok, err := replica.ReplicaOfNoOne(); err != nil || !ok {
+			t.Fatalf("ReplicaOfNoOne() = %v, %v", ok, err)
 		}
-		for i := 0; i < len(nodes); i++ {
-			if diff := deep.Equal(nodes[i].server.GetServerInfo(), nodeInfo[i]); diff != nil {
-				t.Errorf("GetServerInfo() - node %d: %+v expected %v got %v", i, err, nodes[i].server.GetServerInfo(), nodeInfo[i])
-				return
-			}
+		if role := replica.Role(); role.Role != "master" {
+			t.Errorf("expected the replica to become a master, got %s", role.Role)
+		}
+		if _, _, err := replica.Set("key6", "value6", SETOptions{}); err != nil {
+			t.Errorf("expected the former replica to accept writes, got %v", err)
 		}
+		if value, _ := replica.Get("key1"); value != "value1" {
+			t.Errorf("expected the former replica to keep its dataset, got %q", value)
+		}
+		waitFor(t, "expected the primary to forget the replica", func() bool {
+			return len(primary.Role().Replicas) == 0
+		})
 	})
 }
 
@@ -1134,6 +2469,20 @@ func Test_Standalone(t *testing.T) {
 			}
 		}
 
+		// Write to another database with the embedded API.
+		if err = mockServer.SelectDB(1); err != nil {
+			t.Error(err)
+			return
+		}
+		if _, _, err = mockServer.Set("key7", "value7", SETOptions{}); err != nil {
+			t.Error(err)
+			return
+		}
+		if err = mockServer.SelectDB(0); err != nil {
+			t.Error(err)
+			return
+		}
+
 		// Yield
 		<-ticker.C
 
@@ -1159,6 +2508,282 @@ func Test_Standalone(t *testing.T) {
 				return
 			}
 		}
+
+		// Check that the write is restored to the database it was made on.
+		if res, _ := mockServer.Get("key7"); res != "" {
+			t.Errorf("expected key \"key7\" to not be in database 0, got \"%s\"", res)
+		}
+		if err = mockServer.SelectDB(1); err != nil {
+			t.Error(err)
+			return
+		}
+		if res, err := mockServer.Get("key7"); err != nil || res != "value7" {
+			t.Errorf("expected value at key \"key7\" in database 1 to be \"value7\", got \"%s\", %v", res, err)
+		}
+	})
+
+	t.Run("Test_EncryptionAtRest", func(t *testing.T) {
+		t.Parallel()
+
+		dataDir := path.Join(".", "testdata", "test_encryption")
+		t.Cleanup(func() {
+			_ = os.RemoveAll(dataDir)
+		})
+
+		if err := os.MkdirAll(dataDir, os.ModePerm); err != nil {
+			t.Error(err)
+			return
+		}
+		writeKeyFile := func(name string, keys ...string) string {
+			p := path.Join(dataDir, name)
+			if err := os.WriteFile(p, []byte(strings.Join(keys, "\n")), os.ModePerm); err != nil {
+				t.Error(err)
+			}
+			return p
+		}
+		oldKey := strings.Repeat("01", 32)
+		newKey := strings.Repeat("02", 32)
+		oldKeyFile := writeKeyFile("old.key", oldKey)
+		rotatedKeyFile := writeKeyFile("rotated.key", newKey, oldKey)
+		newKeyFile := writeKeyFile("new.key", newKey)
+
+		values := map[string]string{"key1": "secret-value1", "key2": "secret-value2"}
+
+		conf := DefaultConfig()
+		conf.DataDir = dataDir
+		conf.RestoreAOF = true
+		conf.AOFSyncStrategy = "always"
+		conf.EncryptionKeyFile = oldKeyFile
+
+		mockServer, err := NewSugarDB(WithConfig(conf))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		for key, value := range values {
+			if _, _, err = mockServer.Set(key, value, SETOptions{}); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+		if _, err = mockServer.Save(); err != nil {
+			t.Error(err)
+			return
+		}
+		if _, err = mockServer.RewriteAOF(); err != nil {
+			t.Error(err)
+			return
+		}
+		if _, _, err = mockServer.Set("key3", "secret-value3", SETOptions{}); err != nil {
+			t.Error(err)
+			return
+		}
+		values["key3"] = "secret-value3"
+		mockServer.ShutDown()
+
+		// None of the persistence files should contain the values in plaintext.
+		err = filepath.WalkDir(dataDir, func(p string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			b, err := os.ReadFile(p)
+			if err != nil {
+				return err
+			}
+			if strings.Contains(string(b), "secret-value") {
+				t.Errorf("expected file %s to be encrypted", p)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		// Starting with the wrong key returns an error.
+		conf.EncryptionKeyFile = newKeyFile
+		if _, err = NewSugarDB(WithConfig(conf)); !errors.Is(err, encryption.ErrWrongKey) {
+			t.Errorf("expected error %v, got %v", encryption.ErrWrongKey, err)
+			return
+		}
+
+		// Rotate the key. The previous key is still used to read the files, which are re-encrypted on rewrite.
+		conf.EncryptionKeyFile = rotatedKeyFile
+		mockServer, err = NewSugarDB(WithConfig(conf))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		for key, value := range values {
+			if res, _ := mockServer.Get(key); res != value {
+				t.Errorf("expected value at key \"%s\" to be \"%s\", got \"%s\"", key, value, res)
+			}
+		}
+		if _, err = mockServer.RewriteAOF(); err != nil {
+			t.Error(err)
+			return
+		}
+		mockServer.ShutDown()
+
+		// After the rewrite, the previous key is no longer required.
+		conf.EncryptionKeyFile = newKeyFile
+		mockServer, err = NewSugarDB(WithConfig(conf))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer mockServer.ShutDown()
+		for key, value := range values {
+			if res, _ := mockServer.Get(key); res != value {
+				t.Errorf("expected value at key \"%s\" to be \"%s\", got \"%s\"", key, value, res)
+			}
+		}
+	})
+
+	t.Run("Test_BackupRestore", func(t *testing.T) {
+		t.Parallel()
+
+		dataDir := path.Join(".", "testdata", "test_backup")
+		t.Cleanup(func() {
+			_ = os.RemoveAll(dataDir)
+		})
+
+		target := NewFileBackupTarget(path.Join(dataDir, "backups"))
+		values := map[string]string{"key1": "value1", "key2": "value2"}
+
+		conf := DefaultConfig()
+		conf.DataDir = path.Join(dataDir, "source")
+		conf.BackupInterval = 20 * time.Millisecond
+
+		mockServer, err := NewSugarDB(WithConfig(conf), WithBackupTarget(target))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		for key, value := range values {
+			if _, _, err = mockServer.Set(key, value, SETOptions{}); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+		if _, err = mockServer.Save(); err != nil {
+			t.Error(err)
+			return
+		}
+
+		// Wait for the snapshot to be uploaded.
+		uploaded := false
+		for i := 0; i < 50 && !uploaded; i++ {
+			<-time.After(20 * time.Millisecond)
+			names, err := target.List(context.Background(), "snapshots/")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			uploaded = len(names) > 0
+		}
+		mockServer.ShutDown()
+		if !uploaded {
+			t.Error("expected the snapshot to be uploaded to the backup target")
+			return
+		}
+
+		// Start a new instance with an empty data directory that restores from the backup.
+		conf.DataDir = path.Join(dataDir, "restored")
+		conf.BackupInterval = 0
+		conf.RestoreBackup = true
+		conf.RestoreSnapshot = true
+		mockServer, err = NewSugarDB(WithConfig(conf), WithBackupTarget(target))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer mockServer.ShutDown()
+
+		for key, value := range values {
+			if res, _ := mockServer.Get(key); res != value {
+				t.Errorf("expected value at key \"%s\" to be \"%s\", got \"%s\"", key, value, res)
+			}
+		}
+	})
+
+	t.Run("Test_StateCapture", func(t *testing.T) {
+		t.Parallel()
+
+		server := createSugarDB()
+
+		// Prepare the state before the capture.
+		if _, _, err := server.Set("capture_key1", "value1", SETOptions{}); err != nil {
+			t.Error(err)
+			return
+		}
+		if _, _, err := server.Set("capture_key2", "value2", SETOptions{}); err != nil {
+			t.Error(err)
+			return
+		}
+		if _, err := server.HSet("capture_hash", map[string]string{"field1": "value1"}); err != nil {
+			t.Error(err)
+			return
+		}
+		if _, err := server.LPush("capture_list", "value1"); err != nil {
+			t.Error(err)
+			return
+		}
+
+		capture := server.beginStateCapture(nil)
+
+		// Mutate the state while the capture is in progress.
+		if _, _, err := server.Set("capture_key1", "value1-updated", SETOptions{}); err != nil {
+			t.Error(err)
+			return
+		}
+		if _, err := server.Del("capture_key2"); err != nil {
+			t.Error(err)
+			return
+		}
+		if _, _, err := server.Set("capture_key3", "value3", SETOptions{}); err != nil {
+			t.Error(err)
+			return
+		}
+		if _, err := server.HSet("capture_hash", map[string]string{"field1": "value1-updated", "field2": "value2"}); err != nil {
+			t.Error(err)
+			return
+		}
+		if _, err := server.LPush("capture_list", "value2"); err != nil {
+			t.Error(err)
+			return
+		}
+
+		state := server.collectStateCapture(capture)
+
+		want := map[string]interface{}{
+			"capture_key1": "value1",
+			"capture_key2": "value2",
+			"capture_hash": map[string]interface{}{"field1": "value1"},
+			"capture_list": []string{"value1"},
+		}
+		if len(state[0]) != len(want) {
+			t.Errorf("expected captured state to have %d keys, got %d", len(want), len(state[0]))
+		}
+		for key, value := range want {
+			if diff := deep.Equal(value, state[0][key].Value); diff != nil {
+				t.Errorf("captured value at key \"%s\": %+v", key, diff)
+			}
+		}
+
+		// The live state must contain the updates made during the capture.
+		res, err := server.Get("capture_key1")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if res != "value1-updated" {
+			t.Errorf("expected value at key \"capture_key1\" to be \"value1-updated\", got \"%s\"", res)
+		}
+
+		if server.hasActiveStateCapture() {
+			t.Error("expected no active state capture after collecting the capture")
+		}
 	})
 
 	t.Run("Test_EvictExpiredTTL", func(t *testing.T) {
@@ -1166,17 +2791,38 @@ func Test_Standalone(t *testing.T) {
 	})
 
 	t.Run("Test_GetServerInfo", func(t *testing.T) {
+		conn, err := internal.GetConnection("localhost", port)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() {
+			_ = conn.Close()
+		}()
+		client := resp.NewConn(conn)
+		if err = client.WriteArray([]resp.Value{resp.StringValue("PING")}); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err = client.ReadValue(); err != nil {
+			t.Fatal(err)
+		}
+
+		// Only the client of this test is connected once the connections of the previous tests are unregistered.
+		deadline := time.Now().Add(5 * time.Second)
+		for mockServer.GetServerInfo().Clients.Connected != 1 && time.Now().Before(deadline) {
+			time.Sleep(50 * time.Millisecond)
+		}
 		wantInfo := internal.ServerInfo{
 			Server:  "sugardb",
 			Version: constants.Version,
-			Id:      mockServer.config.ServerID,
+			Id:      "Server_1",
 			Mode:    "standalone",
 			Role:    "master",
 			Modules: mockServer.ListModules(),
+			Clients: internal.ClientsInfo{Connected: 1},
 		}
 		info := mockServer.GetServerInfo()
 		if diff := deep.Equal(wantInfo, info); diff != nil {
-			t.Errorf("GetServerInfo(): %+v", err)
+			t.Errorf("GetServerInfo(): %v", diff)
 		}
 	})
 }
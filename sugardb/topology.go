@@ -0,0 +1,328 @@
+// Copyright 2024 Kelvin Clement Mwinuka
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sugardb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/echovault/sugardb/internal"
+	"github.com/echovault/sugardb/internal/forward"
+	"github.com/echovault/sugardb/internal/raft"
+	"github.com/echovault/sugardb/internal/sharding"
+)
+
+// getClusterInfo returns the state of the cluster as seen by this node.
+func (server *SugarDB) getClusterInfo() (internal.ClusterInfo, error) {
+	if !server.isInCluster() {
+		return internal.ClusterInfo{}, errClusterDisabled
+	}
+
+	metas := server.memberList.NodeMetas()
+	leaders := make(map[string]string)
+	for _, meta := range metas {
+		if meta.Leader {
+			leaders[meta.ShardID] = string(meta.ServerID)
+		}
+	}
+
+	info := internal.ClusterInfo{
+		State:      "ok",
+		KnownNodes: len(metas),
+		MyID:       server.config.ServerID,
+		ShardID:    server.config.ShardID,
+		LeaderID:   server.raft.LeaderID(),
+		RaftState:  server.raft.State(),
+		Replica:    server.raft.IsNonvoter(),
+	}
+	for _, shard := range server.slotMap.Shards() {
+		slots := len(sharding.ExpandSlotRanges(shard.Slots))
+		if slots == 0 {
+			continue
+		}
+		info.SlotsAssigned += slots
+		info.Size++
+		if leaders[shard.ID] == "" {
+			info.State = "fail"
+		}
+	}
+	if info.SlotsAssigned != sharding.SlotCount {
+		info.State = "fail"
+	}
+
+	stats := server.raft.Stats()
+	info.Term, _ = strconv.ParseUint(stats["term"], 10, 64)
+	info.CommitIndex, _ = strconv.ParseUint(stats["commit_index"], 10, 64)
+	info.AppliedIndex, _ = strconv.ParseUint(stats["applied_index"], 10, 64)
+	info.Lag, _ = server.raft.ReplicationLag()
+
+	membership := server.memberList.MembershipStats()
+	info.MembersJoined = membership.Joined
+	info.MembersLeft = membership.Left
+	info.MembersFailed = membership.Failed
+	info.MembersRecovered = membership.Recovered
+	info.MembersRemoved = membership.Removed
+	info.MembersPendingRemoval = membership.PendingRemoval
+
+	return info, nil
+}
+
+// getClusterNodes returns the members of the cluster, and the nodes of the raft configuration of this
+// node's shard that are no longer members. The nodes are sorted by shard with the leader of each shard first.
+func (server *SugarDB) getClusterNodes() ([]internal.ClusterNodeInfo, error) {
+	if !server.isInCluster() {
+		return nil, errClusterDisabled
+	}
+
+	slots := make(map[string][][2]int)
+	for _, shard := range server.slotMap.Shards() {
+		for _, r := range shard.Slots {
+			slots[shard.ID] = append(slots[shard.ID], [2]int{r.Start, r.End})
+		}
+	}
+
+	metas := server.memberList.NodeMetas()
+	leaders := make(map[string]string)
+	for _, meta := range metas {
+		if meta.Leader {
+			leaders[meta.ShardID] = string(meta.ServerID)
+		}
+	}
+
+	var nodes []internal.ClusterNodeInfo
+	for _, meta := range metas {
+		node := internal.ClusterNode{ServerID: string(meta.ServerID), Leader: meta.Leader}
+		if n, ok := clusterNode(meta); ok {
+			node = n
+		}
+		nodes = append(nodes, internal.ClusterNodeInfo{
+			ClusterNode: node,
+			ShardID:     meta.ShardID,
+			RaftAddr:    string(meta.RaftAddr),
+			LeaderID:    leaders[meta.ShardID],
+			Slots:       slots[meta.ShardID],
+			Myself:      node.ServerID == server.config.ServerID,
+			Replica:     meta.Replica,
+			Connected:   true,
+		})
+	}
+
+	// The raft configuration of this node's shard tells which of its nodes are replicas, including the
+	// nodes that were promoted or demoted after they joined.
+	servers, err := server.raft.Servers()
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range servers {
+		if i := slices.IndexFunc(nodes, func(node internal.ClusterNodeInfo) bool {
+			return node.ServerID == s.ID
+		}); i != -1 {
+			nodes[i].Replica = !s.Voter
+			continue
+		}
+		host, _, _ := net.SplitHostPort(s.Address)
+		nodes = append(nodes, internal.ClusterNodeInfo{
+			ClusterNode: internal.ClusterNode{ServerID: s.ID, Host: host},
+			ShardID:     server.config.ShardID,
+			RaftAddr:    s.Address,
+			LeaderID:    leaders[server.config.ShardID],
+			Slots:       slots[server.config.ShardID],
+			Replica:     !s.Voter,
+		})
+	}
+
+	slices.SortFunc(nodes, func(a, b internal.ClusterNodeInfo) int {
+		if a.ShardID != b.ShardID {
+			return strings.Compare(a.ShardID, b.ShardID)
+		}
+		if a.Leader != b.Leader {
+			if a.Leader {
+				return -1
+			}
+			return 1
+		}
+		return strings.Compare(a.ServerID, b.ServerID)
+	})
+	return nodes, nil
+}
+
+// getRole returns the replication role of this node. A standalone node is always a master.
+func (server *SugarDB) getRole() internal.RoleInfo {
+	if !server.isInCluster() {
+		return server.getStandaloneRole()
+	}
+
+	role := internal.RoleInfo{}
+	role.Offset, _ = strconv.ParseUint(server.raft.Stats()["applied_index"], 10, 64)
+
+	if server.raft.IsRaftLeader() {
+		role.Role = "master"
+		role.Replicas = make([]internal.ClusterNode, 0)
+		for _, meta := range server.memberList.NodeMetas() {
+			if meta.ShardID != server.config.ShardID || string(meta.ServerID) == server.config.ServerID {
+				continue
+			}
+			if node, ok := clusterNode(meta); ok {
+				role.Replicas = append(role.Replicas, node)
+			}
+		}
+		slices.SortFunc(role.Replicas, func(a, b internal.ClusterNode) int {
+			return strings.Compare(a.ServerID, b.ServerID)
+		})
+		return role
+	}
+
+	role.Role = "slave"
+	role.State = "connect"
+	role.Replica = server.raft.IsNonvoter()
+	role.Lag, role.LastContact = server.raft.ReplicationLag()
+	if meta, ok := server.memberList.GetNodeMeta(server.raft.LeaderID()); ok {
+		if node, ok := clusterNode(meta); ok {
+			role.LeaderHost = node.Host
+			role.LeaderPort = node.Port
+			role.State = "connected"
+		}
+	}
+	return role
+}
+
+// clusterFailover transfers the leadership of this node's shard to the node with the id.
+// When the id is empty, a follower takes over the leadership itself, and a leader hands it over
+// to the most up-to-date follower.
+func (server *SugarDB) clusterFailover(ctx context.Context, id string) error {
+	if !server.isInCluster() {
+		return errClusterDisabled
+	}
+	if id == "" && !server.raft.IsRaftLeader() {
+		id = server.config.ServerID
+	}
+	return server.onShardLeader(
+		func() error { return server.transferLeadership(id) },
+		func() error { return server.forwardClient.TransferLeadership(ctx, id) },
+	)
+}
+
+// clusterForget removes a node that has left or failed from the raft configuration of this node's shard,
+// and drops the subscriptions it had.
+func (server *SugarDB) clusterForget(ctx context.Context, id string) error {
+	if !server.isInCluster() {
+		return errClusterDisabled
+	}
+	if id == server.config.ServerID {
+		return errors.New("can't forget myself")
+	}
+	if _, ok := server.memberList.GetNodeMeta(id); ok {
+		return fmt.Errorf("node %s is still a member of the cluster, use CLUSTER REMOVENODE", id)
+	}
+	if err := server.clusterRemoveNode(ctx, id); err != nil {
+		return err
+	}
+	server.forgetSubscriptions(id)
+	return nil
+}
+
+// clusterAddNode adds the node as a voter to the raft configuration of this node's shard.
+func (server *SugarDB) clusterAddNode(ctx context.Context, id string, addr string) error {
+	if !server.isInCluster() {
+		return errClusterDisabled
+	}
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return fmt.Errorf("invalid raft address %s", addr)
+	}
+	return server.onShardLeader(
+		func() error { return server.addNode(id, addr) },
+		func() error { return server.forwardClient.AddNode(ctx, id, addr) },
+	)
+}
+
+// clusterRemoveNode removes the node from the raft configuration of this node's shard.
+func (server *SugarDB) clusterRemoveNode(ctx context.Context, id string) error {
+	if !server.isInCluster() {
+		return errClusterDisabled
+	}
+	return server.onShardLeader(
+		func() error { return server.removeNode(id) },
+		func() error { return server.forwardClient.RemoveNode(ctx, id) },
+	)
+}
+
+// clusterPromote turns the non-voting replica into a voter of this node's shard.
+func (server *SugarDB) clusterPromote(ctx context.Context, id string) error {
+	if !server.isInCluster() {
+		return errClusterDisabled
+	}
+	return server.onShardLeader(
+		func() error { return server.promoteNode(id) },
+		func() error { return server.forwardClient.PromoteNode(ctx, id) },
+	)
+}
+
+// clusterDemote turns the voter into a non-voting replica of this node's shard.
+func (server *SugarDB) clusterDemote(ctx context.Context, id string) error {
+	if !server.isInCluster() {
+		return errClusterDisabled
+	}
+	return server.onShardLeader(
+		func() error { return server.demoteNode(id) },
+		func() error { return server.forwardClient.DemoteNode(ctx, id) },
+	)
+}
+
+// onShardLeader runs the change on this node when it's the leader of its shard,
+// and asks the leader of the shard to make the change otherwise.
+func (server *SugarDB) onShardLeader(local func() error, remote func() error) error {
+	if server.raft.IsRaftLeader() {
+		if err := local(); !errors.Is(err, forward.ErrNotLeader) {
+			return err
+		}
+	}
+	return remote()
+}
+
+// transferLeadership, addNode, removeNode, promoteNode and demoteNode change the raft configuration of the shard on its leader.
+// They are called by the forwarding server on behalf of the followers.
+
+func (server *SugarDB) transferLeadership(id string) error {
+	return notLeaderError(server.raft.TransferLeadership(id))
+}
+
+func (server *SugarDB) addNode(id, addr string) error {
+	return notLeaderError(server.raft.AddNode(id, addr))
+}
+
+func (server *SugarDB) removeNode(id string) error {
+	return notLeaderError(server.raft.RemoveNode(id))
+}
+
+func (server *SugarDB) promoteNode(id string) error {
+	return notLeaderError(server.raft.PromoteNode(id))
+}
+
+func (server *SugarDB) demoteNode(id string) error {
+	return notLeaderError(server.raft.DemoteNode(id))
+}
+
+// notLeaderError converts the raft error returned when the node is not the leader into forward.ErrNotLeader.
+func notLeaderError(err error) error {
+	if raft.IsNotLeaderError(err) {
+		return forward.ErrNotLeader
+	}
+	return err
+}